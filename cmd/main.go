@@ -20,9 +20,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/klog/v2"
 
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
 	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver"
 )
 
@@ -31,21 +34,113 @@ const etcAmazonEfs = "/etc/amazon/efs"
 
 func main() {
 	var (
-		endpoint                 = flag.String("endpoint", "unix://tmp/csi.sock", "CSI Endpoint")
+		mode                     = flag.String("mode", string(driver.AllMode), "The CSI services to serve, one of controller, node or all. In node mode, the driver does not create an EFS client and needs no AWS permissions. In smoke-test mode, the driver mounts the volume of smoke-test-volume-handle, writes and reads back a file, prints the result as JSON and exits.")
 		version                  = flag.Bool("version", false, "Print the version and exit")
 		efsUtilsCfgDirPath       = flag.String("efs-utils-config-dir-path", "/var/amazon/efs", "The preferred path for the efs-utils config directory. efs-utils-config-legacy-dir-path will be used if it is not empty, otherwise efs-utils-config-dir-path will be used.")
 		efsUtilsCfgLegacyDirPath = flag.String("efs-utils-config-legacy-dir-path", "/etc/amazon/efs-legacy", "The path to the legacy efs-utils config directory mounted from the host path /etc/amazon/efs")
-		efsUtilsStaticFilesPath  = flag.String("efs-utils-static-files-path", "/etc/amazon/efs-static-files/", "The path to efs-utils static files directory")
-		volMetricsOptIn          = flag.Bool("vol-metrics-opt-in", false, "Opt in to emit volume metrics")
-		volMetricsRefreshPeriod  = flag.Float64("vol-metrics-refresh-period", 240, "Refresh period for volume metrics in minutes")
-		volMetricsFsRateLimit    = flag.Int("vol-metrics-fs-rate-limit", 5, "Volume metrics routines rate limiter per file system")
-		deleteAccessPointRootDir = flag.Bool("delete-access-point-root-dir", false,
-			"Opt in to delete access point root directory by DeleteVolume. By default, DeleteVolume will delete the access point behind Persistent Volume and deleting access point will not delete the access point root directory or its contents.")
-		tags = flag.String("tags", "", "Space separated key:value pairs which will be added as tags for EFS resources. For example, 'environment:prod region:us-east-1'")
+		migrateLegacyVolumes     = flag.String("migrate-legacy-volumes", "", "Scan the persistent volumes created by the legacy efs-provisioner, migrate them to CSI volume handles and exit. One of report, dry-run or apply. The report mode only validates the volumes, dry-run also prints the CSI persistent volumes replacing them and apply recreates the volumes that are not bound.")
+		legacyProvisionerName    = flag.String("legacy-provisioner-name", driver.DefaultLegacyProvisionerName, "The provisioner name of the legacy efs-provisioner, used by migrate-legacy-volumes")
+		profile                  = flag.String("profile", defaultProfile, "Preset of recommended flag values, one of default, large-cluster or air-gapped. Flags set explicitly take precedence over the profile.")
+		smokeTestVolumeHandle    = flag.String("smoke-test-volume-handle", "", "The volume handle mounted in smoke-test mode, e.g. fs-0123456789abcdef0::fsap-0123456789abcdef0")
+		smokeTestMountOptions    = flag.String("smoke-test-mount-options", "", "Comma separated mount options of the volume mounted in smoke-test mode, in addition to tls and the access point of the volume handle")
+		startupChecks            = flag.Bool("startup-checks", false, "Check the prerequisites of the mode on startup, before serving: the efs-utils config directory is writable, the unix domain sockets of the endpoints can be created, the web identity token of IAM roles for service accounts is readable or the instance metadata service is reachable when the driver needs them, and the efs-utils mount helper is installed in node mode. The driver prints a summary table of the checks and exits with a distinct code for the first failed check: 10 for the config directory, 11 for the sockets, 12 for the instance metadata service, 13 for the web identity token and 14 for the mount helper.")
 	)
+	cfg := &driver.Config{EfsUtilsCfgPath: etcAmazonEfs}
+	flag.StringVar(&cfg.Endpoint, "endpoint", "unix://tmp/csi.sock", "CSI Endpoint")
+	flag.StringVar(&cfg.VersionedEndpoint, "versioned-endpoint", "", "Additional CSI endpoint, a unix domain socket specific to the version of the driver, e.g. unix:/csi/csi-v2.0.0.sock. It is served along with the endpoint, which the new driver takes over atomically during an upgrade, and removed on termination. The default value is empty, which means only the endpoint is served.")
+	flag.StringVar(&cfg.EfsUtilsStaticFilesPath, "efs-utils-static-files-path", "/etc/amazon/efs-static-files/", "The path to efs-utils static files directory")
+	flag.BoolVar(&cfg.VolMetricsOptIn, "vol-metrics-opt-in", false, "Opt in to emit volume metrics")
+	flag.Float64Var(&cfg.VolMetricsRefreshPeriod, "vol-metrics-refresh-period", 240, "Refresh period for volume metrics in minutes")
+	flag.IntVar(&cfg.VolMetricsFsRateLimit, "vol-metrics-fs-rate-limit", 5, "Volume metrics routines rate limiter per file system")
+	flag.BoolVar(&cfg.DeleteAccessPointRootDir, "delete-access-point-root-dir", false, "Opt in to delete access point root directory by DeleteVolume. By default, DeleteVolume will delete the access point behind Persistent Volume and deleting access point will not delete the access point root directory or its contents.")
+	flag.IntVar(&cfg.DeleteParentDirsMaxDepth, "delete-empty-parent-dirs-max-depth", 0, "Maximum number of empty parent directories of the access point root directory that DeleteVolume removes with it, if delete-access-point-root-dir is set. Only the parents created by the subPathPattern of volumes provisioned while this flag is set, which did not exist before the volume, are removed, from the deepest up to basePath. The default value is 0, which means parent directories are never removed.")
+	flag.DurationVar(&cfg.DeletionFencingLease.Duration, "deletion-fencing-lease", 0, "Lease of the fencing token tagged on an access point by the controller replica deleting its root directory, if delete-access-point-root-dir is set. The token is renewed while the root directory is deleted, and the other replicas do not delete the access point until the lease expires, and access points being deleted are not reused by reuseAccessPoint. The default value is 0, which disables the fencing.")
+	flag.StringVar(&cfg.Tags, "tags", "", "Space separated key:value pairs which will be added as tags for EFS resources. For example, 'environment:prod region:us-east-1'")
+	flag.StringVar(&cfg.PosixIdentityWebhookUrl, "posix-identity-webhook-url", "", "URL of a webhook that is called by CreateVolume with the PVC metadata and returns the uid, gid and secondaryGids of the access point. If not set, the driver allocates the posix identity from the gid range of the storage class.")
+	flag.StringVar(&cfg.StatusAddress, "status-address", "", "The TCP network address where the controller serves the retry and backoff state of the EFS API calls per operation and per file system as JSON on /status/efs-api (example: :8081). The default value is empty string, which means the status endpoint is disabled. Only set it on the controller.")
+	flag.DurationVar(&cfg.ConfigDirReconcileInterval.Duration, "config-dir-reconcile-interval", time.Minute, "Interval between checks of the symlink or directory at /etc/amazon/efs and of the efs-utils config file, which are repaired if they drifted from their state on startup. The check also runs on SIGHUP. If 0, the check only runs on SIGHUP.")
+	flag.StringVar(&cfg.DeleteAuditSink, "delete-audit-sink", "", "Where the controller writes a JSON audit record for every DeleteVolume call that removed the directory of a volume, with the access point, the directory, the estimated bytes removed and the persistent volume and claim: an http(s) URL the records are posted to, or an absolute file path the records are appended to as JSON lines. The default value is empty string, which means the audit is disabled.")
+	flag.DurationVar(&cfg.WarmupTimeout.Duration, "warmup-timeout", 45*time.Second, "Maximum duration for which the controller reports itself not ready on startup, while it retries the EFS API until its credentials work and creates the EFS API clients of the regions, endpoints and roles of the storage classes, so that the first CreateVolume does not pay for it. If 0, the clients are created by the first CreateVolume that needs them.")
+	flag.BoolVar(&cfg.MountHelperFeatureGating, "mount-helper-feature-gating", false, "If set to true, the nodes advertise the mount options supported by their efs-utils mount helper on their CSINode object, and the controller fails CreateVolume when no schedulable node supports the mount options required by the volume or by the CSIDriver object. It must be set on both the controller and the nodes.")
+	flag.StringVar(&cfg.MetricsAddress, "metrics-address", "", "The TCP network address where the prometheus metrics endpoint will listen (example: :8080). The default value is empty string, which means metrics endpoint is disabled.")
+	flag.DurationVar(&cfg.DescribeTimeout.Duration, "describe-timeout", 0, "Timeout of EFS describe and list API calls, including retries. The default value is 0, which means the calls are only bound by the deadline of the CSI request.")
+	flag.DurationVar(&cfg.CreateTimeout.Duration, "create-timeout", 0, "Timeout of EFS create API calls, including retries. The default value is 0, which means the calls are only bound by the deadline of the CSI request.")
+	flag.StringVar(&cfg.PreferredMountTargetSubnets, "preferred-mount-target-subnets", "", "Comma separated subnet IDs whose mount targets are picked first, in order, when a file system has several mount targets available in the availability zone. The other mount targets are picked by lowest IP address.")
+	flag.DurationVar(&cfg.DeleteTimeout.Duration, "delete-timeout", 0, "Timeout of EFS delete API calls, including retries. The default value is 0, which means the calls are only bound by the deadline of the CSI request.")
+	flag.StringVar(&cfg.MinDirectoryPerms, "min-directory-perms", "", "Octal permission bits that the directoryPerms storage class parameter must grant, e.g. 700. If either min-directory-perms or max-directory-perms is set, CreateVolume rejects dynamic provisioning with directoryPerms out of their bounds.")
+	flag.StringVar(&cfg.MaxDirectoryPerms, "max-directory-perms", "", "Octal permission bits that the directoryPerms storage class parameter may grant, e.g. 775 to reject 777. If either min-directory-perms or max-directory-perms is set, CreateVolume rejects dynamic provisioning with directoryPerms out of their bounds.")
+	flag.DurationVar(&cfg.PendingAccessPointTTL.Duration, "pending-access-point-ttl", 0, "On startup, delete the access points left pending for longer than this duration by a CreateVolume that was interrupted and never retried. The default value is 0, which means pending access points are never deleted. Only set it on the controller.")
+	flag.DurationVar(&cfg.ProgressEventThreshold.Duration, "provisioning-progress-event-threshold", 0, "Duration after which a step of CreateVolume that is still running, such as assuming the cross account role, discovering mount targets or creating the access point, is reported as a Provisioning event of the claim. The default value is 0, which means no such event is emitted. Only set it on the controller.")
+	flag.IntVar(&cfg.SubPathPatternMaxDepth, "sub-path-pattern-max-depth", 0, "Maximum number of directories of the access point root directory of dynamically provisioned volumes, including basePath and subPathPattern. The default value is 0, which means the EFS limit of 5.")
+	flag.IntVar(&cfg.SubPathPatternMaxLength, "sub-path-pattern-max-length", 0, "Maximum length of the access point root directory of dynamically provisioned volumes, including basePath and subPathPattern. The default value is 0, which means the EFS limit of 100 characters.")
+	flag.StringVar(&cfg.MountTargetCacheConfigMap, "mount-target-cache-configmap", "", "ConfigMap, as namespace/name, caching the IP address of the mount target of every file system in every availability zone. The node looks up the mount target IP of a volume in it before falling back to DNS. The default value is empty, which means the cache is disabled.")
+	flag.StringVar(&cfg.MountOptionsConfigMap, "mount-options-configmap", "", "ConfigMap, as namespace/name, of rules appending mount options to the volumes published on the nodes whose labels match, e.g. a bigger rsize on network optimized instances. Every key holds one rule as JSON, {\"nodeSelector\": <label selector>, \"mountOptions\": [...]}, and the rules are applied in the order of the keys. An option already set by the volume or an earlier rule is not appended again. Changes to the ConfigMap and to the labels of the node apply to the volumes published afterwards. The default value is empty, which means no options are appended. Only set it on the node.")
+	flag.DurationVar(&cfg.AccessPointInventoryInterval.Duration, "access-point-inventory-interval", 0, "Interval between syncs of the cluster scoped EFSAccessPoint objects, one per access point of the persistent volumes of the driver with its file system, root directory, POSIX user, persistent volumes and claims. Objects are created, updated and deleted to match the access points. Requires the EFSAccessPoint CustomResourceDefinition. The default value is 0, which means the inventory is disabled. Only set it on the controller.")
+	flag.DurationVar(&cfg.GidRangeAuditInterval.Duration, "gid-range-audit-interval", time.Minute, "Interval between polls of the storage classes of the driver annotated with efs.csi.aws.com/gid-range-audit, whose access points are audited against the current GID range of the storage class, e.g. after changing gidRangeStart and gidRangeEnd. The annotation value is report, or tag to also tag the access points outside of the range. The result is stored in the efs.csi.aws.com/gid-range-audit-result annotation and reported in an event. 0 disables the audits. Only set it on the controller.")
+	flag.DurationVar(&cfg.OrphanedDirectoryReportInterval.Duration, "orphaned-directory-report-interval", 0, "Interval between reports of the orphaned directories of the file systems of the efs-ap storage classes of the driver: the directories of their base paths that hold the root directory of no persistent volume, e.g. left by access points deleted without delete-access-point-root-dir. The controller mounts each file system, logs the orphaned directories, sets the efs_csi_controller_orphaned_directories metric and reports them in an event of the storage classes. The default value is 0, which means the reports are disabled. Only set it on the controller.")
+	flag.DurationVar(&cfg.VolumeLabelsInterval.Duration, "volume-labels-interval", 0, "Interval between syncs of the labels of the persistent volumes of the driver: efs.csi.aws.com/file-system-id with their file system and efs.csi.aws.com/access-point-id with their access point, added to the volumes missing them so that they can be selected per file system with label selectors. The default value is 0, which means the volumes are not labeled. Only set it on the controller.")
+	flag.StringVar(&cfg.QuotaEnforcement, "quota-enforcement", "", "Enforce the capacity requested by the claims of the volumes of the dedicated access points created by the driver, which EFS does not limit. Once per quota-enforcement-interval, the controller sums the size of the files under the root directory of every access point and records a QuotaExceeded Event on the claims of the volumes over their capacity, with event. With read-only, the volumes over their capacity are also annotated with efs.csi.aws.com/quota-exceeded and the nodes publish them read-only to the pods started from then on. Set it on the controller and, with read-only, on the nodes. The default value is empty string, which means quotas are not enforced.")
+	flag.DurationVar(&cfg.QuotaEnforcementInterval.Duration, "quota-enforcement-interval", time.Hour, "Interval between the scans of the volumes by quota-enforcement. Scanning a file system reads the metadata of all the files of its volumes. Only set it on the controller.")
+	flag.BoolVar(&cfg.DeleteOrphanedDirectories, "delete-orphaned-directories", false, "Delete the orphaned directories found by the orphaned directory reports in which no access point is rooted. The directories left by access points that still exist are only reported. Only set it on the controller.")
+	flag.StringVar(&cfg.DirectoryCollisionPolicy, "directory-collision-policy", "", "Policy applied by CreateVolume when another storage class of the driver on the same file system would use the same root directory for the same claim, with a subPathPattern without ensureUniqueDirectory: warn logs the collision, fail also fails CreateVolume. The default value is empty, which means collisions are not checked. Only set it on the controller.")
+	flag.BoolVar(&cfg.AllowUnenforcedIdentity, "allow-unenforced-user-identity", false, "Allow the enforceUserIdentity=false storage class parameter, which creates access points without posix user so that the clients keep their own uid and gid within the root directory of the access point. CreateVolume fails with PermissionDenied for it otherwise. Only set it on the controller.")
+	flag.DurationVar(&cfg.ProvisioningBatchWindow.Duration, "provisioning-batch-window", 0, "Duration for which CreateVolume calls for the same file system share the result of describing the file system or listing the GIDs of its access points, including the calls in flight, so that bursts of claims make fewer EFS API calls. The default value is 0, which means every CreateVolume calls the EFS API. Only set it on the controller.")
+	flag.IntVar(&cfg.MaxConcurrentAPCreations, "max-concurrent-access-point-creations", 0, "Maximum number of access points created at a time by CreateVolume, the others waiting for their turn. The default value is 0, which means no limit. Only set it on the controller.")
+	flag.BoolVar(&cfg.StrictParameters, "strict-parameters", false, "Fail CreateVolume with InvalidArgument for the storage class parameters the driver does not know, such as misspelled parameters, instead of ignoring them. Only set it on the controller.")
+	flag.BoolVar(&cfg.SharedVolumeMounts, "shared-volume-mounts", false, "Mount each volume once per node and set of mount options in the plugin directory of the kubelet, and bind mount it read-only or read-write at the target path of each pod, instead of mounting the volume for each pod. The mount is unmounted with its last pod. Volumes with a sub path are always staged once per node, in their own directory. Only set it on the node.")
+	flag.BoolVar(&cfg.AccessPointMountSource, "access-point-mount-source", false, "Mount the access point of a volume with the access point in the mount source, e.g. fsap-0123456789abcdef0.fs-abcd1234:/, instead of the accesspoint mount option, when the efs-utils mount helper supports it, so that efs-utils resolves the DNS name of the access point. The mount helpers without support fall back to the accesspoint mount option. Only set it on the node.")
+	flag.StringVar(&cfg.DNSNameservers, "dns-nameservers", "", "Comma separated IP addresses, with an optional port, of the nameservers resolving the DNS names of the file systems instead of those of the node, e.g. the inbound endpoints of a Route 53 Resolver. NodePublishVolume mounts the resolved address as mounttargetip, unless the volume sets one or is cross account. The default value is empty, which means efs-utils resolves the names with the nameservers of the node. Only set it on the node.")
+	flag.DurationVar(&cfg.DNSTimeout.Duration, "dns-timeout", 5*time.Second, "Timeout of the resolution of the DNS name of a file system with dns-nameservers")
+	flag.IntVar(&cfg.MaxConcurrentMounts, "max-concurrent-mounts", 0, "Maximum number of NodePublishVolume mounts in progress on the node. The waiting calls are queued per volume and the volumes take turns, so that the pods of a volume are not stuck behind all the pods of another volume when the kubelet replays its calls after a reboot. The default value is 0, which means no limit. Only set it on the node.")
+	flag.StringVar(&cfg.AdminSocket, "admin-socket", "", "Path of a unix domain socket where the node serves break-glass operations to root only, e.g. /csi/admin.sock: a POST of {\"targetPath\": <target path of a pod volume>, \"volumeId\": <volume ID>, \"lazy\": true} on /admin/force-unmount unmounts the target with force, detached if lazy, and drops its tracking state, to recover a stuck mount without draining or rebooting the node. On the controller, a POST of {\"name\": <volume name>, \"parameters\": <storage class parameters>, \"secrets\": <provisioner secrets>} on /admin/simulate-create-volume returns the access point, or file system, CreateVolume would create, without creating anything. The default value is empty, which means the admin socket is disabled.")
+	flag.BoolVar(&cfg.PrewarmVolumes, "prewarm-volumes", false, "Mount the persistent volumes annotated with efs.csi.aws.com/prewarm=true at startup, before removing the taint of the node, in a staging directory of the plugin directory of the kubelet, so that the pods scheduled after a node replacement do not wait for the first mount of their volume. Most effective with shared-volume-mounts, where the pods bind mount the prewarmed mount. The staging mounts of the volumes no longer annotated are unmounted at the next start. Requires listing persistent volumes. Only set it on the node.")
+	flag.BoolVar(&cfg.CrossAccountRoleValidation, "cross-account-role-validation", false, "Validate the cross account volumes, whose volume context has crossaccount set, before mounting them: the node publish secrets of the volume must have the awsRoleArn of the account of the file system, and crossaccount set to true if set, and the node must be able to assume the role. NodePublishVolume fails with FailedPrecondition without the secrets, InvalidArgument when they do not match and PermissionDenied when the role may not be assumed. Requires the sts:AssumeRole permission on the roles. Only set it on the node.")
+	flag.BoolVar(&cfg.CrossAccountValidationCache, "cross-account-validation-cache", false, "Cache the validation of each volume by cross-account-role-validation until the credentials of the role it assumed expire, so that the remounts of the volume are not validated again. The credentials are not passed to efs-utils, which assumes the role on its own. Only set it on the node.")
+	flag.DurationVar(&cfg.UnmountBusyTimeout.Duration, "unmount-busy-timeout", 0, "Duration for which NodeUnpublishVolume retries the unmounts failing because the target is busy, e.g. a process of the terminating pod still has a file open, measured from the first busy attempt across the retries of the kubelet. A warning Event is recorded on the node when the target is still busy after it. The default value is 0, which means busy unmounts fail at once. Only set it on the node.")
+	flag.BoolVar(&cfg.LazyUnmountFallback, "lazy-unmount-fallback", false, "Unmount lazily, like umount -l, the targets still busy after unmount-busy-timeout, so that stuck unmounts do not block pod deletion and node drains forever. The mount stays in use by the processes using it until they exit. Only set it on the node.")
+	flag.StringVar(&cfg.MountFailureDiagnostics, "mount-failure-diagnostics", "", "Record the mount command, exit code and first lines of the output of the mount helper of the failed mounts of NodePublishVolume on the pod of the volume, in an Event of the pod (event). Requires podInfoOnMount in the CSIDriver object. Only set it on the node. Disabled if empty.")
+	flag.StringVar(&cfg.NodeStateFile, "node-state-file", "", "File where the node persists the targets published by NodePublishVolume, with the hash of their publish request and the port of their proxy, so that the node plugin replacing another one, e.g. during an upgrade, recognizes the targets already published and restores their volume metrics. It must be on the host, e.g. in the plugin directory of the kubelet. Only set it on the node. Disabled if empty.")
+	flag.DurationVar(&cfg.PublishedOptionsInterval.Duration, "published-options-check-interval", 0, "Interval at which the node compares the mount options and attributes with which its targets were published with the ones of their persistent volume, e.g. after the persistent volume was edited. The targets keep the options of their publish until their pods are restarted, so the drifted targets are counted by the efs_csi_node_drifted_targets metric and a RemountRequired warning Event is recorded on their persistent volume. The targets published before the node plugin started are only checked with node-state-file. Requires getting persistent volumes. Only set it on the node. Disabled if 0.")
+	flag.StringVar(&cfg.SecureMountOptions, "secure-mount-options", "", "Comma separated mount options among nosuid, nodev and noexec added to all the volumes published on the node, unless the mount options of their persistent volume lift them with suid, dev or exec, which is only allowed with allow-secure-mount-opt-out. Only set it on the node. Disabled if empty.")
+	flag.BoolVar(&cfg.AllowSecureMountOptOut, "allow-secure-mount-opt-out", false, "Allow the persistent volumes to opt out of the secure-mount-options with the suid, dev or exec mount options. Otherwise NodePublishVolume fails for such volumes. Only set it on the node.")
+	flag.BoolVar(&cfg.DefaultIdentityFromTags, "default-identity-from-file-system-tags", false, "Default the uid and gid of the access points created by the storage classes without the uid and gid parameters to the efs.csi.aws.com/default-uid and efs.csi.aws.com/default-gid tags of their file system, cached for 5 minutes. Requires the elasticfilesystem:ListTagsForResource permission. Only set it on the controller.")
+	flag.StringVar(&cfg.SnapshotBackupVault, "snapshot-backup-vault", "", "Name of the AWS Backup vault, in the region of the controller, where CreateSnapshot backs up the file system of a volume, so that the CSI VolumeSnapshots of the volumes are recovery points of AWS Backup. Only the volumes of whole file systems have snapshots, unless snapshot-subpath-volumes is set. Requires snapshot-backup-role-arn, the external-snapshotter sidecar, and the backup:StartBackupJob, backup:DescribeBackupJob, backup:DescribeRecoveryPoint, backup:DeleteRecoveryPoint, backup:ListRecoveryPointsByBackupVault, backup:ListTags, backup:TagResource and iam:PassRole permissions. The default value is empty, which means snapshots are not supported. Only set it on the controller.")
+	flag.StringVar(&cfg.SnapshotBackupRoleArn, "snapshot-backup-role-arn", "", "ARN of the IAM role that AWS Backup assumes to back up the file systems to snapshot-backup-vault. Only set it on the controller.")
+	flag.BoolVar(&cfg.SnapshotSubpathVolumes, "snapshot-subpath-volumes", false, "Also take the snapshots of the volumes of access points and subpaths. The snapshot of such a volume is a backup of the whole file system, with the data of the other volumes of the file system, e.g. of other tenants, restored with AWS Backup. Requires snapshot-backup-vault. Only set it on the controller.")
+	flag.StringVar(&cfg.BurstCreditCheck, "burst-credit-check", "", "Check at CreateVolume the burst credit balance that a file system in bursting throughput mode reports to CloudWatch, as the workloads of volumes provisioned on a file system out of burst credits are throttled from the start. With warn, the volumes of a file system at or below burst-credit-min-balance are provisioned with a BurstCreditsLow Event on their claim. With fail, their provisioning fails until the file system earns credits back. The file systems of other accounts are not checked. Requires the cloudwatch:GetMetricStatistics permission. The default value is empty string, which means burst credits are not checked. Only set it on the controller.")
+	flag.Int64Var(&cfg.BurstCreditMinBalance, "burst-credit-min-balance", 0, "Burst credit balance in bytes at or below which burst-credit-check warns or fails. The default value is 0, which means only the file systems out of burst credits are reported. Only set it on the controller.")
+	flag.BoolVar(&cfg.RequireIMDSv2, "require-imdsv2", false, "Fetch the metadata of the instance with IMDSv2 only, and exit on startup with the remediation if no IMDSv2 token can be fetched, e.g. because the hop limit of the instance metadata options is 1, instead of falling back to IMDSv1 or the Kubernetes API. The failure is also recorded as an IMDSv2HopLimit Event on the node.")
+	flag.StringVar(&cfg.AWSCABundle, "aws-ca-bundle", os.Getenv(cloud.AWSCABundleEnv), "Path of a PEM bundle of CA certificates trusted by the EFS, STS, Secrets Manager, AWS Backup and CloudWatch clients of the driver in addition to the CAs of the system, e.g. for the endpoints of a private CA in air-gapped or ISO regions. The node also passes it to the mount helper and watchdog of efs-utils as the AWS_CA_BUNDLE environment variable, with which botocore trusts only the bundle, and renders it as the stunnel_cafile of the efs-utils config, with which stunnel trusts only the bundle. The default value is the AWS_CA_BUNDLE environment variable, the CAs of the system only if empty.")
+	flag.StringVar(&cfg.EFSEndpointURL, "efs-endpoint-url", os.Getenv(cloud.EFSEndpointURLEnv), "URL of the EFS API called instead of the endpoint of the region, e.g. an interface VPC endpoint or localstack. The storage classes with the apiEndpoint parameter call theirs, and the ones with an apiRegion other than the region of the instance call the endpoint of their region. The node also passes it to efs-utils as the AWS_ENDPOINT_URL_EFS environment variable. The default value is the AWS_ENDPOINT_URL_EFS environment variable, the endpoint of the region if empty.")
+	flag.StringVar(&cfg.STSEndpointURL, "sts-endpoint-url", os.Getenv(cloud.STSEndpointURLEnv), "URL of the STS API through which the roles of the storage classes and of the cross account volumes are assumed instead of the endpoint of the region, e.g. an interface VPC endpoint or localstack. The node also passes it to efs-utils as the AWS_ENDPOINT_URL_STS environment variable. The default value is the AWS_ENDPOINT_URL_STS environment variable, the endpoint of the region if empty.")
+	flag.BoolVar(&cfg.VolumeMountCommand, "volume-mount-command", false, "Add the mountCommand volume attribute to the persistent volumes created by CreateVolume, with a mount command equivalent to the mount of the volume by the nodes, so that the mount of a pod can be reproduced manually when troubleshooting. The nodes must run a version of the driver ignoring this attribute. Only set it on the controller.")
+	flag.BoolVar(&cfg.VolumeProvisioningDetails, "volume-provisioning-details", false, "Add the decisions of CreateVolume to the volume attributes of the persistent volumes created, under the provisioning.efs.csi.aws.com/ prefix: the provisioning mode, whether the access point was reused, the source, uid and gid of its posix user, its root directory and the mount target IP, so that audit and observability controllers can analyze them without scraping the logs. The nodes must run a version of the driver ignoring these attributes. Only set it on the controller.")
+	flag.StringVar(&cfg.VolumeHandleFormat, "volume-handle-format", driver.VolumeHandleFormatLegacy, "Format of the volume handles of the persistent volumes created: legacy, {fileSystemId}:{mountPath}:{accessPointId}, or v2, efs://{fileSystemId}?ap={accessPointId}&path={mountPath}&region={region}, whose region is set for the file systems in another region than the controller so that DeleteVolume and the nodes need not be told it. The nodes and the controller accept both formats, the nodes must run a version of the driver accepting v2 before it is set. Only set it on the controller.")
+	flag.StringVar(&cfg.FileSystemAliasesConfigMap, "file-system-aliases-configmap", "", "ConfigMap, as namespace/name, mapping file system aliases, e.g. team-a-prod, to file system IDs or ARNs. A fileSystemId storage class parameter that is neither a file system ID nor an ARN is resolved with it, so that the file system of the storage classes of an alias is changed by editing the ConfigMap only. Changes apply to the volumes provisioned afterwards. The default value is empty, which means no aliases. Only set it on the controller.")
+	flag.StringVar(&cfg.MaintenanceAccessPoints, "maintenance-access-points", "", "Comma separated fileSystemId:accessPointId pairs of the access points through which the controller mounts the file systems, with iam, to check the base and root directories of the volumes and to delete their root directory with delete-access-point-root-dir, instead of mounting their root. Each access point must have the root directory / and a posix user allowed to manage the directories, e.g. fs-0123456789abcdef0:fsap-0123456789abcdef0. The default value is empty, which means the root of the file systems is mounted. Only set it on the controller.")
+	flag.StringVar(&cfg.ClusterId, "cluster-id", "", "ID of the cluster, unique among the clusters provisioning volumes on the same file systems, e.g. prod-us-east-1. The access points created are tagged with efs.csi.aws.com/cluster-id set to it, and an access point found by client token with reuseAccessPoint is only reused if its tag matches. An access point of another cluster is logged and reused unless strict-access-point-ownership is set. The default value is empty, which means no ownership check. Only set it on the controller.")
+	flag.BoolVar(&cfg.StrictAccessPointOwnership, "strict-access-point-ownership", false, "Fail CreateVolume with FailedPrecondition, instead of logging a warning, when the access point found by client token with reuseAccessPoint is tagged with another cluster ID than cluster-id, or is not tagged with a cluster ID. Requires cluster-id. Only set it on the controller.")
+	flag.DurationVar(&cfg.MountTargetCacheInterval.Duration, "mount-target-cache-refresh-interval", 0, "Interval between refreshes of the mount target cache ConfigMap. The default value is 0, which means the cache is only read. Only set it on the controller.")
+	flag.BoolVar(&cfg.ControllerPublishUnpublish, "controller-publish-unpublish", false, "Report the PUBLISH_UNPUBLISH_VOLUME controller capability for tooling expecting the attach and detach flow. Publishing an EFS volume is a no-op, the controller only records the volumes published to every node. Requires attachRequired in the CSIDriver and the external-attacher sidecar. Only set it on the controller.")
+	flag.IntVar(&cfg.VolumeAttachLimit, "volume-attach-limit", 0, "Maximum number of volumes that ControllerPublishVolume publishes to a node, if controller-publish-unpublish is set. The default value is 0, which means no limit.")
+	flag.BoolVar(&cfg.EnforceSingleNodeWriter, "enforce-single-node-writer", false, "Fail ControllerPublishVolume with FailedPrecondition when a volume is published to a node while published to another one, if either has the SINGLE_NODE_WRITER access mode of ReadWriteOnce volumes, so that their pods cannot run on two nodes at once. EFS itself mounts volumes on any number of nodes. Requires controller-publish-unpublish. Only set it on the controller.")
+	flag.StringVar(&cfg.FileSystemIdentityCheck, "verify-file-system-identity", "", "Verify the identity of the file system after NodePublishVolume mounts it, and unmount it if it is not the requested one. One of state, which compares the file system ID of the efs-utils state of TLS mounts, or sentinel, which compares the content of the .efs-csi-file-system-id file at the root of the file system or access point. The default value is empty, which means the identity is not verified.")
+	flag.BoolVar(&cfg.ProvisioningPolicies, "provisioning-policies", false, "Enforce the EFSProvisioningPolicy objects of the namespace of the claim in CreateVolume. A namespace with policies may only provision access points whose file system, base path, uid and gid are allowed by one of its policies. Requires the EFSProvisioningPolicy CustomResourceDefinition and the --extra-create-metadata flag of the external-provisioner. Only set it on the controller.")
+	flag.DurationVar(&cfg.SecretsCacheTTL.Duration, "secrets-manager-cache-ttl", 5*time.Minute, "Duration for which the controller caches the AWS Secrets Manager secrets referenced by the provisioner secrets with the secretsmanager: prefix. Rotated secrets are picked up once their cached value expires. Only set it on the controller.")
+	flag.StringVar(&cfg.KubeletDir, "kubelet-root-dir", "/var/lib/kubelet", "The root directory of the kubelet, as set by its --root-dir flag. The mount propagation of the directory is verified by mount-propagation-check, and NodePublishVolume warns about target paths outside of its pods directory.")
+	flag.StringVar(&cfg.MountPropagationCheck, "mount-propagation-check", driver.MountPropagationCheckReport, "Verify on startup that the kubelet directory is mounted from the host with Bidirectional mount propagation, without which the volumes mounted by the node service are not visible to the pods. One of fail, which exits with the cause, or report, which keeps the node service running and logs the cause as a warning. The default value is report. Set it to empty to disable the check. Only set it on the node.")
+	flag.StringVar(&cfg.FaultInjection, "fault-injection", os.Getenv(cloud.FaultInjectionEnv), "Comma separated rules injecting faults into the EFS API calls, for testing only, e.g. 'DescribeAccessPoints:throttle@0.5,CreateAccessPoint:latency=2s,DeleteAccessPoint:notfound'. Each rule is <operation>:<fault>[@<probability>], with an EFS API operation or * and one of throttle, latency=<duration> or notfound. The default value is the EFS_CSI_FAULT_INJECTION environment variable, no faults if empty.")
+	flag.IntVar(&cfg.EFSAPIMaxAttempts, "efs-api-max-attempts", 3, "Maximum number of attempts of each EFS API call, including the first one, retried with exponential backoff on throttling and transient errors. Only set it on the controller.")
+	flag.IntVar(&cfg.EFSAPIRetryTokens, "efs-api-retry-tokens", 500, "Size of the retry token bucket shared by all the EFS API calls of the driver, whatever their operation, role or region. Each retry takes 5 tokens, or 10 after a timeout, and each successful call returns 1, so that retries stop once most calls fail, e.g. when the API is throttling, instead of piling up. 0 disables the limit. Only set it on the controller.")
+	flag.DurationVar(&cfg.MountStatsInterval.Duration, "mount-stats-annotation-interval", 0, "Minimum interval between updates of the per volume mount stats annotation on the CSINode object. The default value is 0, which means the annotation is disabled.")
+	flag.StringVar(&cfg.KubeletDir, "kubelet-dir", cfg.KubeletDir, "Deprecated: use kubelet-root-dir instead.")
 	klog.InitFlags(nil)
 	flag.Parse()
 
+	if err := applyProfile(flag.CommandLine, *profile); err != nil {
+		klog.Fatalln(err)
+	}
+
 	if *version {
 		info, err := driver.GetVersionJSON()
 		if err != nil {
@@ -54,13 +149,54 @@ func main() {
 		fmt.Println(info)
 		os.Exit(0)
 	}
+	if *migrateLegacyVolumes != "" {
+		if err := driver.MigrateLegacyVolumes(cloud.DefaultKubernetesAPIClient, *legacyProvisionerName, *migrateLegacyVolumes, os.Stdout); err != nil {
+			klog.Fatalln(err)
+		}
+		os.Exit(0)
+	}
 
 	// chose which configuration directory we will use and create a symlink to it
-	err := driver.InitConfigDir(*efsUtilsCfgLegacyDirPath, *efsUtilsCfgDirPath, etcAmazonEfs)
+	configDirErr := driver.InitConfigDir(*efsUtilsCfgLegacyDirPath, *efsUtilsCfgDirPath, etcAmazonEfs)
+	if configDirErr != nil && !*startupChecks {
+		klog.Fatalln(configDirErr)
+	}
+	driverMode, err := driver.ParseMode(*mode)
 	if err != nil {
 		klog.Fatalln(err)
 	}
-	drv := driver.NewDriver(*endpoint, etcAmazonEfs, *efsUtilsStaticFilesPath, *tags, *volMetricsOptIn, *volMetricsRefreshPeriod, *volMetricsFsRateLimit, *deleteAccessPointRootDir)
+	cfg.Mode = driverMode
+	if *startupChecks {
+		// the config directory error is reported by the checks with its own exit code
+		exitCode := driver.RunStartupChecks(driver.StartupCheckOptions{
+			EtcAmazonEfs:  etcAmazonEfs,
+			ConfigDirErr:  configDirErr,
+			Endpoints:     []string{cfg.Endpoint, cfg.VersionedEndpoint},
+			RequireIMDSv2: cfg.RequireIMDSv2,
+			Mode:          driverMode,
+		}, os.Stdout)
+		if exitCode != 0 {
+			klog.Flush()
+			os.Exit(exitCode)
+		}
+	}
+	if driverMode == driver.SmokeTestMode {
+		var mountOptions []string
+		for _, option := range strings.Split(*smokeTestMountOptions, ",") {
+			if option = strings.TrimSpace(option); option != "" {
+				mountOptions = append(mountOptions, option)
+			}
+		}
+		if err := driver.RunSmokeTest(cfg, *smokeTestVolumeHandle, mountOptions, os.Stdout); err != nil {
+			klog.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+	if err := cfg.Validate(); err != nil {
+		klog.Fatalln(err)
+	}
+	klog.Infof("Effective configuration of profile %s: %s", *profile, cfg)
+	drv := driver.NewDriver(cfg)
 	if err := drv.Run(); err != nil {
 		klog.Fatalln(err)
 	}
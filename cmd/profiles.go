@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const defaultProfile = "default"
+
+// profiles bundle the recommended flag values of common deployment archetypes: rate limits, caches, timeouts
+// and retry budgets. Flags set explicitly on the command line take precedence over the profile. The CA bundle
+// and the FIPS endpoints depend on the environment, e.g. the path of the bundle mounted in the pods, so no
+// profile presets them.
+var profiles = map[string]map[string]string{
+	defaultProfile: {},
+	// large-cluster spreads the load of many volumes and nodes on the EFS and Kubernetes APIs, and gives the
+	// retries of the EFS API calls a larger budget shared by the many calls in flight
+	"large-cluster": {
+		"vol-metrics-refresh-period":            "480",
+		"vol-metrics-fs-rate-limit":             "2",
+		"mount-stats-annotation-interval":       "5m",
+		"describe-timeout":                      "30s",
+		"create-timeout":                        "1m",
+		"delete-timeout":                        "1m",
+		"max-concurrent-access-point-creations": "10",
+		"max-concurrent-mounts":                 "20",
+		"secrets-manager-cache-ttl":             "15m",
+		"efs-api-max-attempts":                  "5",
+		"efs-api-retry-tokens":                  "2000",
+	},
+	// air-gapped fails fast when the EFS API is only reachable through VPC endpoints that are misconfigured,
+	// instead of retrying until the deadline of the CSI request, and calls the endpoints less often
+	"air-gapped": {
+		"describe-timeout":          "15s",
+		"create-timeout":            "30s",
+		"delete-timeout":            "30s",
+		"efs-api-max-attempts":      "2",
+		"secrets-manager-cache-ttl": "30m",
+	},
+}
+
+// applyProfile sets the flags of the profile that were not set explicitly
+func applyProfile(fs *flag.FlagSet, profile string) error {
+	presets, ok := profiles[profile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, must be one of %s", profile, strings.Join(profileNames(), ", "))
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, value := range presets {
+		if explicit[name] {
+			klog.Infof("Flag --%s is set explicitly, ignoring value %s of profile %s", name, value, profile)
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("failed to set flag --%s of profile %s: %v", name, profile, err)
+		}
+	}
+	return nil
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestApplyProfile(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		args                  []string
+		profile               string
+		expectRefreshPeriod   float64
+		expectDescribeTimeout time.Duration
+		expectError           bool
+	}{
+		{
+			name:                "default profile keeps the defaults",
+			profile:             defaultProfile,
+			expectRefreshPeriod: 240,
+		},
+		{
+			name:                  "profile presets flags",
+			profile:               "large-cluster",
+			expectRefreshPeriod:   480,
+			expectDescribeTimeout: 30 * time.Second,
+		},
+		{
+			name:                  "explicit flags take precedence",
+			args:                  []string{"--vol-metrics-refresh-period=60"},
+			profile:               "large-cluster",
+			expectRefreshPeriod:   60,
+			expectDescribeTimeout: 30 * time.Second,
+		},
+		{
+			name:        "unknown profile",
+			profile:     "small-cluster",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			refreshPeriod := fs.Float64("vol-metrics-refresh-period", 240, "")
+			fs.Int("vol-metrics-fs-rate-limit", 5, "")
+			fs.Duration("mount-stats-annotation-interval", 0, "")
+			describeTimeout := fs.Duration("describe-timeout", 0, "")
+			fs.Duration("create-timeout", 0, "")
+			fs.Duration("delete-timeout", 0, "")
+			fs.Int("max-concurrent-access-point-creations", 0, "")
+			fs.Int("max-concurrent-mounts", 0, "")
+			fs.Duration("secrets-manager-cache-ttl", 5*time.Minute, "")
+			fs.Int("efs-api-max-attempts", 3, "")
+			fs.Int("efs-api-retry-tokens", 500, "")
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyProfile(fs, tc.profile)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyProfile failed: %v", err)
+			}
+			if *refreshPeriod != tc.expectRefreshPeriod || *describeTimeout != tc.expectDescribeTimeout {
+				t.Fatalf("Expected refresh period %v and describe timeout %v, got %v and %v",
+					tc.expectRefreshPeriod, tc.expectDescribeTimeout, *refreshPeriod, *describeTimeout)
+			}
+		})
+	}
+}
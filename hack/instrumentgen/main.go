@@ -0,0 +1,355 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// instrumentgen generates a decorator of an interface of the package of the current directory that times,
+// counts and traces every call with util.Instrument. It is run by go:generate, e.g.
+//
+//	//go:generate go run ../../hack/instrumentgen -type Cloud -name instrumentedCloud -dependency cloud -output zz_generated.instrumented_cloud.go
+//
+// The methods of the embedded interfaces are included, those of other packages being resolved with go list.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const utilImportPath = "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+
+var (
+	typeName   = flag.String("type", "", "Interface to decorate")
+	name       = flag.String("name", "", "Name of the decorator, instrumented<type> if empty")
+	dependency = flag.String("dependency", "", "Value of the dependency label of the calls, the lower case type if empty")
+	output     = flag.String("output", "", "File to write the decorator to")
+)
+
+// method is a method of the interface, with its types printed as in the generated file
+type method struct {
+	name     string
+	params   []string
+	results  []string
+	variadic bool
+}
+
+type generator struct {
+	fset *token.FileSet
+	// imports holds the import paths used by the methods, by name
+	imports map[string]string
+	methods map[string]method
+}
+
+func main() {
+	flag.Parse()
+	if *typeName == "" || *output == "" {
+		fmt.Fprintln(os.Stderr, "usage: instrumentgen -type <interface> -output <file> [-name <decorator>] [-dependency <label>]")
+		os.Exit(2)
+	}
+	if *name == "" {
+		*name = "instrumented" + strings.ToUpper((*typeName)[:1]) + (*typeName)[1:]
+	}
+	if *dependency == "" {
+		*dependency = strings.ToLower(*typeName)
+	}
+
+	g := &generator{fset: token.NewFileSet(), imports: map[string]string{}, methods: map[string]method{}}
+	pkg, err := g.parseDir(".", *output)
+	if err != nil {
+		fatal(err)
+	}
+	if err := g.collect(pkg, *typeName, ""); err != nil {
+		fatal(err)
+	}
+	src, err := format.Source(g.render(pkg.Name))
+	if err != nil {
+		fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "instrumentgen:", err)
+	os.Exit(1)
+}
+
+// parseDir parses the non-test files of the package in the directory, except the generated file
+func (g *generator) parseDir(dir, exclude string) (*ast.Package, error) {
+	pkgs, err := parser.ParseDir(g.fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != filepath.Base(exclude)
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if !strings.HasSuffix(pkg.Name, "_test") && pkg.Name != "main" {
+			return pkg, nil
+		}
+	}
+	return nil, fmt.Errorf("no package in %s", dir)
+}
+
+// collect adds the methods of the interface of the package, qualifying its types with the qualifier if the
+// package is not the one of the generated file
+func (g *generator) collect(pkg *ast.Package, typeName, qualifier string) error {
+	file, iface := findInterface(pkg, typeName)
+	if iface == nil {
+		return fmt.Errorf("interface %s not found in package %s", typeName, pkg.Name)
+	}
+	fileImports := importsOf(file)
+	for _, field := range iface.Methods.List {
+		switch t := field.Type.(type) {
+		case *ast.FuncType:
+			for _, ident := range field.Names {
+				// The unexported methods of another package can't be called, they are promoted from the
+				// wrapped interface instead
+				if qualifier != "" && !ident.IsExported() {
+					continue
+				}
+				g.methods[ident.Name] = g.newMethod(ident.Name, t, fileImports, qualifier)
+			}
+		case *ast.Ident:
+			if err := g.collect(pkg, t.Name, qualifier); err != nil {
+				return err
+			}
+		case *ast.SelectorExpr:
+			pkgName := t.X.(*ast.Ident).Name
+			importPath, ok := fileImports[pkgName]
+			if !ok {
+				return fmt.Errorf("import of %s not found", pkgName)
+			}
+			dir, err := packageDir(importPath)
+			if err != nil {
+				return err
+			}
+			embedded, err := g.parseDir(dir, "")
+			if err != nil {
+				return err
+			}
+			g.imports[pkgName] = importPath
+			if err := g.collect(embedded, t.Sel.Name, pkgName); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported embedded type %T in interface %s", t, typeName)
+		}
+	}
+	return nil
+}
+
+func (g *generator) newMethod(name string, t *ast.FuncType, fileImports map[string]string, qualifier string) method {
+	m := method{name: name}
+	for _, field := range t.Params.List {
+		typ := field.Type
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+			m.variadic = true
+			typ = ellipsis.Elt
+		}
+		for i := 0; i < max(1, len(field.Names)); i++ {
+			m.params = append(m.params, g.typeString(typ, fileImports, qualifier))
+		}
+	}
+	if t.Results != nil {
+		for _, field := range t.Results.List {
+			for i := 0; i < max(1, len(field.Names)); i++ {
+				m.results = append(m.results, g.typeString(field.Type, fileImports, qualifier))
+			}
+		}
+	}
+	return m
+}
+
+// typeString prints the type, qualifying the exported types of another package and recording the imports
+func (g *generator) typeString(expr ast.Expr, fileImports map[string]string, qualifier string) string {
+	expr = qualify(expr, qualifier)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				if importPath, ok := fileImports[ident.Name]; ok {
+					g.imports[ident.Name] = importPath
+				}
+			}
+			return false
+		}
+		return true
+	})
+	var b bytes.Buffer
+	printer.Fprint(&b, g.fset, expr)
+	return b.String()
+}
+
+// qualify returns a copy of the type with the exported identifiers qualified by the package name
+func qualify(expr ast.Expr, qualifier string) ast.Expr {
+	if qualifier == "" {
+		return expr
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if t.IsExported() {
+			return &ast.SelectorExpr{X: ast.NewIdent(qualifier), Sel: ast.NewIdent(t.Name)}
+		}
+		return t
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: qualify(t.X, qualifier)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: t.Len, Elt: qualify(t.Elt, qualifier)}
+	case *ast.MapType:
+		return &ast.MapType{Key: qualify(t.Key, qualifier), Value: qualify(t.Value, qualifier)}
+	case *ast.ChanType:
+		return &ast.ChanType{Dir: t.Dir, Value: qualify(t.Value, qualifier)}
+	default:
+		return expr
+	}
+}
+
+func findInterface(pkg *ast.Package, typeName string) (*ast.File, *ast.InterfaceType) {
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if iface, ok := ts.Type.(*ast.InterfaceType); ok && ts.Name.Name == typeName {
+					return file, iface
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// importsOf returns the import paths of the file by package name, assuming that the name of a package
+// imported without alias is the last element of its path
+func importsOf(file *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+	return imports
+}
+
+func packageDir(importPath string) (string, error) {
+	out, err := exec.Command("go", "list", "-f", "{{.Dir}}", importPath).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not find package %s: %v", importPath, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g *generator) render(pkgName string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by instrumentgen. DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+
+	imports := map[string]string{"context": "context"}
+	for k, v := range g.imports {
+		imports[k] = v
+	}
+	if !strings.HasSuffix(utilImportPath, "/"+pkgName) {
+		imports["util"] = utilImportPath
+	}
+	// The standard library is imported first, like goimports does
+	var std, others []string
+	for k, v := range imports {
+		if strings.Contains(strings.Split(v, "/")[0], ".") {
+			others = append(others, k)
+		} else {
+			std = append(std, k)
+		}
+	}
+	b.WriteString("import (\n")
+	for _, names := range [][]string{std, others} {
+		sort.Slice(names, func(i, j int) bool { return imports[names[i]] < imports[names[j]] })
+		for _, k := range names {
+			if k == filepath.Base(imports[k]) {
+				fmt.Fprintf(&b, "\t%q\n", imports[k])
+			} else {
+				fmt.Fprintf(&b, "\t%s %q\n", k, imports[k])
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")\n\n")
+
+	fmt.Fprintf(&b, "// %s times, counts and traces the calls to the wrapped %s\n", *name, *typeName)
+	fmt.Fprintf(&b, "type %s struct {\n\t%s\n}\n\n", *name, *typeName)
+	fmt.Fprintf(&b, "func new%s(wrapped %s) %s {\n\treturn &%s{%s: wrapped}\n}\n", strings.ToUpper((*name)[:1])+(*name)[1:], *typeName, *typeName, *name, *typeName)
+
+	var methodNames []string
+	for k := range g.methods {
+		methodNames = append(methodNames, k)
+	}
+	sort.Strings(methodNames)
+	for _, k := range methodNames {
+		renderMethod(&b, g.methods[k])
+	}
+	return b.Bytes()
+}
+
+func renderMethod(b *bytes.Buffer, m method) {
+	var params, args, results []string
+	for i, p := range m.params {
+		arg := fmt.Sprintf("a%d", i)
+		if m.variadic && i == len(m.params)-1 {
+			params = append(params, arg+" ..."+p)
+			arg += "..."
+		} else {
+			params = append(params, arg+" "+p)
+		}
+		args = append(args, arg)
+	}
+	for i := range m.results {
+		results = append(results, fmt.Sprintf("r%d", i))
+	}
+
+	ctx := "context.Background()"
+	ctxVar := "_"
+	if len(m.params) > 0 && m.params[0] == "context.Context" {
+		ctx, ctxVar = "a0", "ctx"
+		args[0] = "ctx"
+	}
+	errResult := "nil"
+	if len(m.results) > 0 && m.results[len(m.results)-1] == "error" {
+		errResult = results[len(results)-1]
+	}
+
+	fmt.Fprintf(b, "\nfunc (i *%s) %s(%s) (%s) {\n", *name, m.name, strings.Join(params, ", "), strings.Join(m.results, ", "))
+	fmt.Fprintf(b, "\t%s, done := util.Instrument(%s, %q, %q)\n", ctxVar, ctx, *dependency, m.name)
+	call := fmt.Sprintf("i.%s.%s(%s)", *typeName, m.name, strings.Join(args, ", "))
+	if len(results) == 0 {
+		fmt.Fprintf(b, "\t%s\n\tdone(nil)\n}\n", call)
+		return
+	}
+	fmt.Fprintf(b, "\t%s := %s\n\tdone(%s)\n\treturn %s\n}\n", strings.Join(results, ", "), call, errResult, strings.Join(results, ", "))
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	apiStatusCallMiddlewareID    = "EFSCSIAPIStatusCall"
+	apiStatusAttemptMiddlewareID = "EFSCSIAPIStatusAttempt"
+)
+
+type fileSystemIdKey struct{}
+
+// CallStatus is the retry and backoff state of the calls of an EFS API operation, or of the calls for a
+// file system
+type CallStatus struct {
+	// Calls is the number of calls, including their retries
+	Calls int64 `json:"calls"`
+	// Attempts is the number of requests sent, which is more than Calls if calls were retried
+	Attempts int64 `json:"attempts"`
+	// Throttled is the number of attempts throttled by the EFS API
+	Throttled int64 `json:"throttled"`
+	// Failed is the number of calls that failed for another reason than throttling
+	Failed int64 `json:"failed"`
+	// BackingOff is true if the last attempt was throttled, so the call is waiting to be retried
+	BackingOff bool `json:"backingOff"`
+	// ConsecutiveThrottled is the number of attempts throttled since the last one that was not
+	ConsecutiveThrottled int64      `json:"consecutiveThrottled"`
+	LastThrottled        *time.Time `json:"lastThrottled,omitempty"`
+	LastError            string     `json:"lastError,omitempty"`
+	LastErrorTime        *time.Time `json:"lastErrorTime,omitempty"`
+	LastSuccess          *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// APIStatusSnapshot is the state of the EFS API calls per operation and per file system
+type APIStatusSnapshot struct {
+	Operations  map[string]CallStatus `json:"operations"`
+	FileSystems map[string]CallStatus `json:"fileSystems"`
+}
+
+// APIStatus records the throttling, retries and failures of the EFS API calls, so that operators can
+// tell whether slow provisioning is due to throttling or to other failures
+type APIStatus struct {
+	now func() time.Time
+
+	mu          sync.Mutex
+	operations  map[string]*CallStatus
+	fileSystems map[string]*CallStatus
+}
+
+func NewAPIStatus() *APIStatus {
+	return &APIStatus{
+		now:         time.Now,
+		operations:  map[string]*CallStatus{},
+		fileSystems: map[string]*CallStatus{},
+	}
+}
+
+// Snapshot returns a copy of the current state
+func (s *APIStatus) Snapshot() APIStatusSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := APIStatusSnapshot{
+		Operations:  make(map[string]CallStatus, len(s.operations)),
+		FileSystems: make(map[string]CallStatus, len(s.fileSystems)),
+	}
+	for operation, status := range s.operations {
+		snapshot.Operations[operation] = *status
+	}
+	for fileSystemId, status := range s.fileSystems {
+		snapshot.FileSystems[fileSystemId] = *status
+	}
+	return snapshot
+}
+
+// addMiddleware is the API option recording the calls of the EFS client. The calls are recorded before
+// the retry middleware of the SDK and their attempts after it.
+func (s *APIStatus) addMiddleware(stack *middleware.Stack) error {
+	if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc(apiStatusCallMiddlewareID, s.handleInitialize), middleware.After); err != nil {
+		return err
+	}
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(apiStatusAttemptMiddlewareID, s.handleFinalize), "Retry", middleware.After)
+}
+
+func (s *APIStatus) handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	fileSystemId := fileSystemIdOf(in.Parameters)
+	ctx = middleware.WithStackValue(ctx, fileSystemIdKey{}, fileSystemId)
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	s.recordCall(awsmiddleware.GetOperationName(ctx), fileSystemId, err)
+	return out, metadata, err
+}
+
+func (s *APIStatus) handleFinalize(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleFinalize(ctx, in)
+	fileSystemId, _ := middleware.GetStackValue(ctx, fileSystemIdKey{}).(string)
+	s.recordAttempt(awsmiddleware.GetOperationName(ctx), fileSystemId, isThrottled(err))
+	return out, metadata, err
+}
+
+func (s *APIStatus) recordCall(operation, fileSystemId string, err error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, status := range s.statuses(operation, fileSystemId) {
+		status.Calls++
+		status.BackingOff = false
+		if err == nil {
+			status.LastSuccess = &now
+		} else if !isThrottled(err) {
+			status.Failed++
+			status.LastError = err.Error()
+			status.LastErrorTime = &now
+		}
+	}
+}
+
+func (s *APIStatus) recordAttempt(operation, fileSystemId string, throttled bool) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, status := range s.statuses(operation, fileSystemId) {
+		status.Attempts++
+		status.BackingOff = throttled
+		if throttled {
+			status.Throttled++
+			status.ConsecutiveThrottled++
+			status.LastThrottled = &now
+		} else {
+			status.ConsecutiveThrottled = 0
+		}
+	}
+}
+
+// statuses returns the statuses of the operation and of the file system, if any
+func (s *APIStatus) statuses(operation, fileSystemId string) []*CallStatus {
+	statuses := []*CallStatus{getOrAddCallStatus(s.operations, operation)}
+	if fileSystemId != "" {
+		statuses = append(statuses, getOrAddCallStatus(s.fileSystems, fileSystemId))
+	}
+	return statuses
+}
+
+func getOrAddCallStatus(statuses map[string]*CallStatus, key string) *CallStatus {
+	status, ok := statuses[key]
+	if !ok {
+		status = &CallStatus{}
+		statuses[key] = status
+	}
+	return status
+}
+
+// fileSystemIdOf returns the file system of the input of an EFS API call, if any
+func fileSystemIdOf(params interface{}) string {
+	var fileSystemId *string
+	switch input := params.(type) {
+	case *efs.CreateAccessPointInput:
+		fileSystemId = input.FileSystemId
+	case *efs.DescribeAccessPointsInput:
+		fileSystemId = input.FileSystemId
+	case *efs.DescribeFileSystemsInput:
+		fileSystemId = input.FileSystemId
+	case *efs.DescribeMountTargetsInput:
+		fileSystemId = input.FileSystemId
+	case *efs.TagResourceInput:
+		fileSystemId = input.ResourceId
+	case *efs.UntagResourceInput:
+		fileSystemId = input.ResourceId
+	case *efs.ListTagsForResourceInput:
+		fileSystemId = input.ResourceId
+	}
+	// The resource of the tag operations may be an access point
+	if fileSystemId == nil || !strings.HasPrefix(*fileSystemId, "fs-") {
+		return ""
+	}
+	return *fileSystemId
+}
+
+// isThrottled returns true if the error is a throttling error of the API
+func isThrottled(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, ok := retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]
+	return ok
+}
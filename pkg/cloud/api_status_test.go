@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestAPIStatus(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch requests {
+		case 1:
+			// The first attempt of the first call is throttled
+			w.Header().Set("X-Amzn-ErrorType", "ThrottlingException")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"Rate exceeded"}`))
+		case 2:
+			_, _ = w.Write([]byte(`{"FileSystems":[]}`))
+		default:
+			w.Header().Set("X-Amzn-ErrorType", "FileSystemNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"ErrorCode":"FileSystemNotFound","Message":"File system 'fs-abcd1234' does not exist."}`))
+		}
+	}))
+	defer server.Close()
+
+	apiStatus := NewAPIStatus()
+	client := efs.New(efs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		HTTPClient:   server.Client(),
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+		APIOptions: []func(*middleware.Stack) error{apiStatus.addMiddleware},
+	})
+
+	ctx := context.Background()
+	if _, err := client.DescribeFileSystems(ctx, &efs.DescribeFileSystemsInput{FileSystemId: aws.String("fs-abcd1234")}); err != nil {
+		t.Fatalf("Expected the throttling to be retried, got %v", err)
+	}
+	snapshot := apiStatus.Snapshot()
+	status := snapshot.Operations["DescribeFileSystems"]
+	if status.Calls != 1 || status.Attempts != 2 || status.Throttled != 1 || status.Failed != 0 || status.ConsecutiveThrottled != 0 || status.LastThrottled == nil || status.LastSuccess == nil {
+		t.Fatalf("Unexpected status after a retried call: %+v", status)
+	}
+	if snapshot.FileSystems["fs-abcd1234"].Throttled != 1 {
+		t.Fatalf("Expected the throttling to be recorded for the file system, got %+v", snapshot.FileSystems)
+	}
+
+	if _, err := client.DescribeAccessPoints(ctx, &efs.DescribeAccessPointsInput{FileSystemId: aws.String("fs-abcd1234")}); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	snapshot = apiStatus.Snapshot()
+	status = snapshot.Operations["DescribeAccessPoints"]
+	if status.Calls != 1 || status.Attempts != 1 || status.Throttled != 0 || status.Failed != 1 || status.LastError == "" {
+		t.Fatalf("Unexpected status after a failed call: %+v", status)
+	}
+	if fsStatus := snapshot.FileSystems["fs-abcd1234"]; fsStatus.Calls != 2 || fsStatus.Failed != 1 {
+		t.Fatalf("Unexpected status of the file system: %+v", fsStatus)
+	}
+}
+
+func TestFileSystemIdOf(t *testing.T) {
+	testCases := []struct {
+		params interface{}
+		expect string
+	}{
+		{params: &efs.DescribeMountTargetsInput{FileSystemId: aws.String("fs-abcd1234")}, expect: "fs-abcd1234"},
+		{params: &efs.TagResourceInput{ResourceId: aws.String("fsap-abcd1234")}, expect: ""},
+		{params: &efs.DescribeFileSystemsInput{}, expect: ""},
+		{params: &efs.DeleteAccessPointInput{AccessPointId: aws.String("fsap-abcd1234")}, expect: ""},
+	}
+
+	for _, tc := range testCases {
+		if got := fileSystemIdOf(tc.params); got != tc.expect {
+			t.Errorf("fileSystemIdOf(%T) = %q, expected %q", tc.params, got, tc.expect)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"fmt"
+	"strings"
+)
+
+const fileSystemArnResourcePrefix = "file-system/"
+
+// FileSystemArn identifies a file system, possibly owned by another account or in another region,
+// e.g. arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-abcd1234
+type FileSystemArn struct {
+	Partition    string
+	Region       string
+	AccountId    string
+	FileSystemId string
+}
+
+// IsArn returns whether the value is an ARN rather than a resource ID
+func IsArn(value string) bool {
+	return strings.HasPrefix(value, "arn:")
+}
+
+// ParseFileSystemArn parses the ARN of a file system and checks that its partition is the one of its region
+func ParseFileSystemArn(value string) (*FileSystemArn, error) {
+	// arn:partition:service:region:account-id:resource
+	tokens := strings.SplitN(value, ":", 6)
+	if len(tokens) != 6 || tokens[0] != "arn" {
+		return nil, fmt.Errorf("%q is not an ARN", value)
+	}
+	if tokens[2] != "elasticfilesystem" {
+		return nil, fmt.Errorf("ARN %q is not an EFS ARN", value)
+	}
+	if !strings.HasPrefix(tokens[5], fileSystemArnResourcePrefix) {
+		return nil, fmt.Errorf("ARN %q is not the ARN of a file system", value)
+	}
+	arn := &FileSystemArn{
+		Partition:    tokens[1],
+		Region:       tokens[3],
+		AccountId:    tokens[4],
+		FileSystemId: strings.TrimPrefix(tokens[5], fileSystemArnResourcePrefix),
+	}
+	if arn.Region == "" || arn.AccountId == "" || !strings.HasPrefix(arn.FileSystemId, "fs-") {
+		return nil, fmt.Errorf("ARN %q must have a region, an account ID and a file system ID", value)
+	}
+	if partition := regionPartition(arn.Region); arn.Partition != partition {
+		return nil, fmt.Errorf("ARN %q has partition %s but region %s belongs to partition %s", value, arn.Partition, arn.Region, partition)
+	}
+	return arn, nil
+}
+
+// String returns the ARN of the file system
+func (a *FileSystemArn) String() string {
+	return fmt.Sprintf("arn:%s:elasticfilesystem:%s:%s:%s%s", a.Partition, a.Region, a.AccountId, fileSystemArnResourcePrefix, a.FileSystemId)
+}
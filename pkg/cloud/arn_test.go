@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFileSystemArn(t *testing.T) {
+	testCases := []struct {
+		name      string
+		arn       string
+		expected  *FileSystemArn
+		expectErr bool
+	}{
+		{
+			name: "Success: commercial partition",
+			arn:  "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-abcd1234",
+			expected: &FileSystemArn{
+				Partition:    "aws",
+				Region:       "us-west-2",
+				AccountId:    "111122223333",
+				FileSystemId: "fs-abcd1234",
+			},
+		},
+		{
+			name: "Success: china partition",
+			arn:  "arn:aws-cn:elasticfilesystem:cn-north-1:111122223333:file-system/fs-abcd1234",
+			expected: &FileSystemArn{
+				Partition:    "aws-cn",
+				Region:       "cn-north-1",
+				AccountId:    "111122223333",
+				FileSystemId: "fs-abcd1234",
+			},
+		},
+		{
+			name: "Success: iso-e partition",
+			arn:  "arn:aws-iso-e:elasticfilesystem:eu-isoe-west-1:111122223333:file-system/fs-abcd1234",
+			expected: &FileSystemArn{
+				Partition:    "aws-iso-e",
+				Region:       "eu-isoe-west-1",
+				AccountId:    "111122223333",
+				FileSystemId: "fs-abcd1234",
+			},
+		},
+		{
+			name:      "Fail: partition of another region",
+			arn:       "arn:aws:elasticfilesystem:us-gov-west-1:111122223333:file-system/fs-abcd1234",
+			expectErr: true,
+		},
+		{
+			name:      "Fail: access point ARN",
+			arn:       "arn:aws:elasticfilesystem:us-west-2:111122223333:access-point/fsap-abcd1234",
+			expectErr: true,
+		},
+		{
+			name:      "Fail: ARN of another service",
+			arn:       "arn:aws:s3:us-west-2:111122223333:file-system/fs-abcd1234",
+			expectErr: true,
+		},
+		{
+			name:      "Fail: missing account",
+			arn:       "arn:aws:elasticfilesystem:us-west-2::file-system/fs-abcd1234",
+			expectErr: true,
+		},
+		{
+			name:      "Fail: file system ID",
+			arn:       "fs-abcd1234",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			arn, err := ParseFileSystemArn(tc.arn)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error parsing %q", tc.arn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", tc.arn, err)
+			}
+			if !reflect.DeepEqual(arn, tc.expected) {
+				t.Fatalf("Expected %+v, got %+v", tc.expected, arn)
+			}
+			if arn.String() != tc.arn {
+				t.Fatalf("Expected %q, got %q", tc.arn, arn.String())
+			}
+		})
+	}
+}
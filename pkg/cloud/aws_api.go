@@ -0,0 +1,298 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+	"k8s.io/klog/v2"
+)
+
+// awsAPI sends the requests of the driver to an AWS API whose SDK the driver does not vendor, the way the SDK
+// clients do: signed with the credentials of the SDK config, retried by its retryer, and sent to the endpoint
+// that the SDK config resolves for the API, i.e. the configured endpoint of the service or of all services, or
+// else the endpoint of the region with the FIPS and dual-stack variants of the config.
+type awsAPI struct {
+	// service is the signing name of the API and the prefix of the hostname of its endpoints
+	service string
+	// sdkId is the SDK ID of the API, which names its configured endpoint, e.g. AWS_ENDPOINT_URL_CLOUDWATCH
+	sdkId       string
+	credentials aws.CredentialsProvider
+	httpClient  aws.HTTPClient
+	retryer     aws.Retryer
+	signer      *v4.Signer
+	// baseEndpoint is the configured endpoint of all services, if any
+	baseEndpoint *string
+	// configSources are the sources of the SDK config, of the configured endpoint of the service and of the
+	// endpoint variants
+	configSources []interface{}
+	options       Options
+}
+
+// newAWSAPI returns the API of the service with the default SDK config of the driver
+func newAWSAPI(options Options, service, sdkId string) (*awsAPI, error) {
+	cfg, err := loadConfig(context.TODO(), options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	var retryer aws.Retryer = retry.NewStandard()
+	if cfg.Retryer != nil {
+		retryer = cfg.Retryer()
+	}
+	return &awsAPI{
+		service:       service,
+		sdkId:         sdkId,
+		credentials:   cfg.Credentials,
+		httpClient:    cfg.HTTPClient,
+		retryer:       retryer,
+		signer:        v4.NewSigner(),
+		baseEndpoint:  cfg.BaseEndpoint,
+		configSources: cfg.ConfigSources,
+		options:       options,
+	}, nil
+}
+
+// apiRequest is a request of an operation of an API, in a region
+type apiRequest struct {
+	operation string
+	method    string
+	region    string
+	path      string
+	query     url.Values
+	header    http.Header
+	body      []byte
+}
+
+// apiError is the error of an API call that the API responded to. Like the errors of the SDK clients, it is a
+// smithy.APIError, and has the HTTP status code that the retryers check.
+type apiError struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("api error %s: %s", e.code, e.message)
+}
+
+func (e *apiError) ErrorCode() string {
+	return e.code
+}
+
+func (e *apiError) ErrorMessage() string {
+	return e.message
+}
+
+func (e *apiError) ErrorFault() smithy.ErrorFault {
+	if e.statusCode >= 500 {
+		return smithy.FaultServer
+	}
+	return smithy.FaultClient
+}
+
+func (e *apiError) HTTPStatusCode() int {
+	return e.statusCode
+}
+
+// decodeAPIError returns the error of the response of an API, with a status code other than 2xx
+type decodeAPIError func(res *http.Response, content []byte) *apiError
+
+// call sends the request until it succeeds, or its error is not retryable or the attempts of the retryer run
+// out, and returns the content of the response. The errors of access denied, timeouts and throttling are
+// ErrAccessDenied, ErrDeadlineExceeded and ErrThrottled, and the other errors of the API wrap an *apiError.
+func (a *awsAPI) call(ctx context.Context, req *apiRequest, decodeError decodeAPIError) ([]byte, error) {
+	klog.V(5).Infof("Calling %s %s %s", req.operation, req.method, req.path)
+	ctx, cancel := withTimeout(ctx, a.options.DescribeTimeout)
+	defer cancel()
+
+	endpoint, err := a.endpoint(ctx, req.region)
+	if err != nil {
+		return nil, err
+	}
+	releaseRetryToken := func(error) error { return nil }
+	for attempt := 1; ; attempt++ {
+		content, err := a.send(ctx, endpoint, req, decodeError)
+		_ = releaseRetryToken(err)
+		if err == nil {
+			return content, nil
+		}
+		if attempt >= a.retryer.MaxAttempts() || !a.retryer.IsErrorRetryable(err) {
+			return nil, a.error(req.operation, err)
+		}
+		delay, delayErr := a.retryer.RetryDelay(attempt, err)
+		if delayErr != nil {
+			return nil, a.error(req.operation, err)
+		}
+		// The retry quota of the retryer stops the retries of an API that keeps failing
+		if releaseRetryToken, delayErr = a.retryer.GetRetryToken(ctx, err); delayErr != nil {
+			return nil, a.error(req.operation, err)
+		}
+		klog.V(4).Infof("Retrying %s in %v after attempt %d failed: %v", req.operation, delay, attempt, err)
+		select {
+		case <-ctx.Done():
+			return nil, a.error(req.operation, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send signs and sends the request to the endpoint once
+func (a *awsAPI) send(ctx context.Context, endpoint string, req *apiRequest, decodeError decodeAPIError) ([]byte, error) {
+	u := endpoint + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, bytes.NewReader(req.body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+
+	creds, err := a.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	payloadHash := sha256.Sum256(req.body)
+	if err := a.signer.SignHTTP(ctx, creds, httpReq, hex.EncodeToString(payloadHash[:]), a.service, req.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign %s request: %w", req.operation, err)
+	}
+
+	res, err := a.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", req.operation, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, decodeError(res, content)
+	}
+	return content, nil
+}
+
+// error returns the error of the operation
+func (a *awsAPI) error(operation string, err error) error {
+	if isDeadlineExceeded(err) {
+		return ErrDeadlineExceeded
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.code == AccessDeniedException || apiErr.code == "AccessDenied":
+			return ErrAccessDenied
+		case retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool():
+			return fmt.Errorf("%w: %s failed: %s", ErrThrottled, operation, apiErr.message)
+		}
+	}
+	return fmt.Errorf("%s failed: %w", operation, err)
+}
+
+// endpoint returns the URL of the API in the region: the configured endpoint of the service or of all services,
+// e.g. AWS_ENDPOINT_URL_BACKUP or AWS_ENDPOINT_URL, unless the config ignores them, or else the endpoint of the
+// region, with the FIPS and dual-stack variants of the config, e.g. AWS_USE_FIPS_ENDPOINT
+func (a *awsAPI) endpoint(ctx context.Context, region string) (string, error) {
+	ignoreConfigured := false
+	for _, source := range a.configSources {
+		if p, ok := source.(interface {
+			GetIgnoreConfiguredEndpoints(context.Context) (bool, bool, error)
+		}); ok {
+			if value, found, err := p.GetIgnoreConfiguredEndpoints(ctx); err == nil && found {
+				ignoreConfigured = value
+				break
+			}
+		}
+	}
+	if !ignoreConfigured {
+		for _, source := range a.configSources {
+			if p, ok := source.(interface {
+				GetServiceBaseEndpoint(context.Context, string) (string, bool, error)
+			}); ok {
+				endpoint, found, err := p.GetServiceBaseEndpoint(ctx, a.sdkId)
+				if err != nil {
+					return "", err
+				}
+				if found {
+					return endpoint, nil
+				}
+			}
+		}
+	}
+	// The config resolves the endpoint of all services, unless it ignores the configured endpoints
+	if a.baseEndpoint != nil {
+		return *a.baseEndpoint, nil
+	}
+
+	var fips aws.FIPSEndpointState
+	var dualStack aws.DualStackEndpointState
+	for _, source := range a.configSources {
+		if p, ok := source.(interface {
+			GetUseFIPSEndpoint(context.Context) (aws.FIPSEndpointState, bool, error)
+		}); ok && fips == aws.FIPSEndpointStateUnset {
+			value, found, err := p.GetUseFIPSEndpoint(ctx)
+			if err != nil {
+				return "", err
+			}
+			if found {
+				fips = value
+			}
+		}
+		if p, ok := source.(interface {
+			GetUseDualStackEndpoint(context.Context) (aws.DualStackEndpointState, bool, error)
+		}); ok && dualStack == aws.DualStackEndpointStateUnset {
+			value, found, err := p.GetUseDualStackEndpoint(ctx)
+			if err != nil {
+				return "", err
+			}
+			if found {
+				dualStack = value
+			}
+		}
+	}
+	return regionEndpoint(a.service, region, fips == aws.FIPSEndpointStateEnabled, dualStack == aws.DualStackEndpointStateEnabled)
+}
+
+// regionEndpoint returns the URL of the endpoint of the API of the service in the region, e.g.
+// https://backup-fips.us-gov-west-1.amazonaws.com for the FIPS endpoint of AWS Backup in us-gov-west-1
+func regionEndpoint(service, region string, fips, dualStack bool) (string, error) {
+	if fips {
+		service += "-fips"
+	}
+	dnsSuffix := regionDNSSuffix(region)
+	if dualStack {
+		if dnsSuffix = regionDualStackDNSSuffix(region); dnsSuffix == "" {
+			return "", fmt.Errorf("the partition of region %s has no dual-stack endpoints", region)
+		}
+	}
+	return fmt.Sprintf("https://%s.%s.%s", service, region, dnsSuffix), nil
+}
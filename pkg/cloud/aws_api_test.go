@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// newTestAWSAPI returns the API of the service served by the test server, without retries
+func newTestAWSAPI(service, sdkId string, server *httptest.Server) *awsAPI {
+	return &awsAPI{
+		service:      service,
+		sdkId:        sdkId,
+		credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		httpClient:   server.Client(),
+		retryer:      aws.NopRetryer{},
+		signer:       v4.NewSigner(),
+		baseEndpoint: aws.String(server.URL),
+	}
+}
+
+func TestAWSAPIEndpoint(t *testing.T) {
+	testCases := []struct {
+		name             string
+		region           string
+		env              map[string]string
+		baseEndpoint     string
+		envConfig        config.EnvConfig
+		expectedEndpoint string
+		expectErr        bool
+	}{
+		{
+			name:             "Success: endpoint of the region",
+			region:           "us-iso-east-1",
+			expectedEndpoint: "https://backup.us-iso-east-1.c2s.ic.gov",
+		},
+		{
+			name:             "Success: FIPS endpoint",
+			region:           "us-gov-west-1",
+			envConfig:        config.EnvConfig{UseFIPSEndpoint: aws.FIPSEndpointStateEnabled},
+			expectedEndpoint: "https://backup-fips.us-gov-west-1.amazonaws.com",
+		},
+		{
+			name:             "Success: dual-stack endpoint",
+			region:           "cn-north-1",
+			envConfig:        config.EnvConfig{UseDualStackEndpoint: aws.DualStackEndpointStateEnabled},
+			expectedEndpoint: "https://backup.cn-north-1.api.amazonwebservices.com.cn",
+		},
+		{
+			name:             "Success: configured endpoint of all services",
+			region:           "us-east-1",
+			baseEndpoint:     "https://vpce.example.com",
+			envConfig:        config.EnvConfig{UseFIPSEndpoint: aws.FIPSEndpointStateEnabled},
+			expectedEndpoint: "https://vpce.example.com",
+		},
+		{
+			name:             "Success: configured endpoint of the service",
+			region:           "us-east-1",
+			env:              map[string]string{"AWS_ENDPOINT_URL_BACKUP": "https://backup.example.com"},
+			baseEndpoint:     "https://vpce.example.com",
+			expectedEndpoint: "https://backup.example.com",
+		},
+		{
+			name:             "Success: configured endpoints ignored",
+			region:           "us-east-1",
+			env:              map[string]string{"AWS_ENDPOINT_URL_BACKUP": "https://backup.example.com"},
+			envConfig:        config.EnvConfig{IgnoreConfiguredEndpoints: aws.Bool(true)},
+			expectedEndpoint: "https://backup.us-east-1.amazonaws.com",
+		},
+		{
+			name:      "Fail: no dual-stack endpoint in the partition",
+			region:    "us-isob-east-1",
+			envConfig: config.EnvConfig{UseDualStackEndpoint: aws.DualStackEndpointStateEnabled},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			a := &awsAPI{
+				service:       backupService,
+				sdkId:         backupSDKId,
+				configSources: []interface{}{tc.envConfig},
+			}
+			if tc.baseEndpoint != "" {
+				a.baseEndpoint = aws.String(tc.baseEndpoint)
+			}
+			endpoint, err := a.endpoint(context.Background(), tc.region)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got endpoint %s", endpoint)
+				}
+				return
+			}
+			if err != nil || endpoint != tc.expectedEndpoint {
+				t.Fatalf("Expected endpoint %s, got %s: %v", tc.expectedEndpoint, endpoint, err)
+			}
+		})
+	}
+}
+
+func TestAWSAPICallRetries(t *testing.T) {
+	testCases := []struct {
+		name             string
+		statuses         []int
+		expectedAttempts int
+		expectedErr      error
+		expectErr        bool
+	}{
+		{
+			name:             "Success: server error retried",
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusOK},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "Fail: attempts run out",
+			statuses:         []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			expectedAttempts: 3,
+			expectErr:        true,
+		},
+		{
+			name:             "Fail: throttled",
+			statuses:         []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests},
+			expectedAttempts: 3,
+			expectedErr:      ErrThrottled,
+		},
+		{
+			name:             "Fail: access denied not retried",
+			statuses:         []int{http.StatusForbidden},
+			expectedAttempts: 1,
+			expectedErr:      ErrAccessDenied,
+		},
+	}
+	codes := map[int]string{
+		http.StatusServiceUnavailable:  "ServiceUnavailableException",
+		http.StatusInternalServerError: "InternalFailure",
+		http.StatusTooManyRequests:     "ThrottlingException",
+		http.StatusForbidden:           AccessDeniedException,
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[attempts]
+				attempts++
+				w.Header().Set("X-Amzn-Errortype", codes[status])
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+			a := newTestAWSAPI(backupService, backupSDKId, server)
+			a.retryer = retry.NewStandard(func(o *retry.StandardOptions) {
+				o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+			})
+
+			_, err := a.call(context.Background(), &apiRequest{operation: "Test", method: http.MethodGet, region: "us-east-1", path: "/"}, decodeBackupError)
+			if attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, attempts)
+			}
+			switch {
+			case tc.expectedErr != nil:
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+			case tc.expectErr:
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+			case err != nil:
+				t.Fatalf("call failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	backupService = "backup"
+	backupSDKId   = "Backup"
+
+	// The states of the backup jobs and the statuses of the recovery points
+	BackupStateCompleted = "COMPLETED"
+	BackupStateAvailable = "AVAILABLE"
+)
+
+// backupFailedStates are the states of the backup jobs, and the statuses of the recovery points, that never
+// become completed
+var backupFailedStates = []string{"ABORTING", "ABORTED", "FAILED", "EXPIRED", "PARTIAL", "DELETING", "STOPPED"}
+
+// ErrInvalidBackupRequest is returned when AWS Backup rejects a request in the current state of the resource,
+// e.g. the deletion of a recovery point whose backup job is running
+var ErrInvalidBackupRequest = errors.New("Invalid backup request")
+
+// RecoveryPoint is a backup of a file system in a vault of AWS Backup
+type RecoveryPoint struct {
+	RecoveryPointArn string
+	// ResourceArn is the ARN of the file system
+	ResourceArn string
+	// Status is the status of the recovery point, or the state of its backup job while it runs
+	Status        string
+	StatusMessage string
+	CreationTime  time.Time
+	SizeBytes     int64
+	// IamRoleArn is the role that AWS Backup assumed to create the recovery point
+	IamRoleArn string
+	// BackupPlanId is the backup plan that created the recovery point, empty for the on-demand backup jobs
+	BackupPlanId string
+	// Tags are the tags of the recovery point, nil when listed
+	Tags map[string]string
+}
+
+// Ready returns whether the backup of the recovery point is complete
+func (r *RecoveryPoint) Ready() bool {
+	return r.Status == BackupStateCompleted || r.Status == BackupStateAvailable
+}
+
+// Failed returns whether the recovery point will never be ready
+func (r *RecoveryPoint) Failed() bool {
+	for _, state := range backupFailedStates {
+		if r.Status == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Backup backs up file systems to the vaults of AWS Backup. The region and partition of the calls are the
+// ones of the ARN of the file system or recovery point.
+type Backup interface {
+	// StartBackup starts the backup job of the file system to the vault, assumed by AWS Backup with the IAM role,
+	// and returns its recovery point tagged with the tags. The calls with the idempotency token of a previous
+	// call return the recovery point of the backup job of the previous call, in its current state.
+	StartBackup(ctx context.Context, vaultName, idempotencyToken, fileSystemArn, iamRoleArn string, tags map[string]string) (*RecoveryPoint, error)
+	// DescribeRecoveryPoint returns the recovery point of the vault with its tags, or ErrNotFound
+	DescribeRecoveryPoint(ctx context.Context, vaultName, recoveryPointArn string) (*RecoveryPoint, error)
+	// DeleteRecoveryPoint deletes the recovery point of the vault. It returns ErrNotFound if it does not exist
+	// and ErrInvalidBackupRequest while its backup job runs.
+	DeleteRecoveryPoint(ctx context.Context, vaultName, recoveryPointArn string) error
+	// ListRecoveryPoints returns a page of the recovery points of file systems of the vault in the region, of the
+	// file system of the ARN if any, without their tags, and the token of the next page, empty for the last page
+	ListRecoveryPoints(ctx context.Context, region, vaultName, resourceArn, nextToken string, maxResults int32) ([]*RecoveryPoint, string, error)
+	// ListTags returns the tags of the recovery point, or ErrNotFound
+	ListTags(ctx context.Context, recoveryPointArn string) (map[string]string, error)
+}
+
+// backup calls the AWS Backup API with the default SDK config of the driver
+type backup struct {
+	api *awsAPI
+}
+
+// NewBackup returns an AWS Backup client using the default credentials of the driver
+func NewBackup(options Options) (Backup, error) {
+	api, err := newAWSAPI(options, backupService, backupSDKId)
+	if err != nil {
+		return nil, err
+	}
+	return &backup{api: api}, nil
+}
+
+// arnRegion returns the region of an ARN, arn:partition:service:region:account-id:resource
+func arnRegion(arn string) (string, error) {
+	tokens := strings.SplitN(arn, ":", 6)
+	if len(tokens) != 6 || tokens[0] != "arn" || tokens[3] == "" {
+		return "", fmt.Errorf("%q is not the ARN of a regional resource", arn)
+	}
+	return tokens[3], nil
+}
+
+// escapeArn escapes the ARN as a segment of the path of a request, as the SDK does
+func escapeArn(arn string) string {
+	return strings.ReplaceAll(url.PathEscape(arn), ":", "%3A")
+}
+
+// backupTime is a timestamp of the AWS Backup API, in seconds since the epoch
+type backupTime float64
+
+func (t backupTime) time() time.Time {
+	sec, frac := math.Modf(float64(t))
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+type backupJob struct {
+	BackupJobId       string     `json:"BackupJobId"`
+	RecoveryPointArn  string     `json:"RecoveryPointArn"`
+	ResourceArn       string     `json:"ResourceArn"`
+	State             string     `json:"State"`
+	StatusMessage     string     `json:"StatusMessage"`
+	CreationDate      backupTime `json:"CreationDate"`
+	BackupSizeInBytes int64      `json:"BackupSizeInBytes"`
+}
+
+type recoveryPoint struct {
+	RecoveryPointArn  string     `json:"RecoveryPointArn"`
+	ResourceArn       string     `json:"ResourceArn"`
+	Status            string     `json:"Status"`
+	StatusMessage     string     `json:"StatusMessage"`
+	CreationDate      backupTime `json:"CreationDate"`
+	BackupSizeInBytes int64      `json:"BackupSizeInBytes"`
+	IamRoleArn        string     `json:"IamRoleArn"`
+	CreatedBy         struct {
+		BackupPlanId string `json:"BackupPlanId"`
+	} `json:"CreatedBy"`
+}
+
+func (r *recoveryPoint) recoveryPoint(tags map[string]string) *RecoveryPoint {
+	return &RecoveryPoint{
+		RecoveryPointArn: r.RecoveryPointArn,
+		ResourceArn:      r.ResourceArn,
+		Status:           r.Status,
+		StatusMessage:    r.StatusMessage,
+		CreationTime:     r.CreationDate.time(),
+		SizeBytes:        r.BackupSizeInBytes,
+		IamRoleArn:       r.IamRoleArn,
+		BackupPlanId:     r.CreatedBy.BackupPlanId,
+		Tags:             tags,
+	}
+}
+
+type backupError struct {
+	Type    string `json:"__type"`
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+func (b *backup) StartBackup(ctx context.Context, vaultName, idempotencyToken, fileSystemArn, iamRoleArn string, tags map[string]string) (*RecoveryPoint, error) {
+	region, err := arnRegion(fileSystemArn)
+	if err != nil {
+		return nil, err
+	}
+	started := backupJob{}
+	err = b.call(ctx, "StartBackupJob", http.MethodPut, region, "/backup-jobs", nil, map[string]interface{}{
+		"BackupVaultName":   vaultName,
+		"ResourceArn":       fileSystemArn,
+		"IamRoleArn":        iamRoleArn,
+		"IdempotencyToken":  idempotencyToken,
+		"RecoveryPointTags": tags,
+	}, &started)
+	if err != nil {
+		return nil, err
+	}
+	job := backupJob{}
+	if err := b.call(ctx, "DescribeBackupJob", http.MethodGet, region, "/backup-jobs/"+url.PathEscape(started.BackupJobId), nil, nil, &job); err != nil {
+		return nil, err
+	}
+	klog.V(4).Infof("Backup job %s of file system %s to recovery point %s is %s", started.BackupJobId, job.ResourceArn, job.RecoveryPointArn, job.State)
+	// The job of a previous call with the idempotency token may be the backup of another file system
+	return &RecoveryPoint{
+		RecoveryPointArn: job.RecoveryPointArn,
+		ResourceArn:      job.ResourceArn,
+		Status:           job.State,
+		StatusMessage:    job.StatusMessage,
+		CreationTime:     job.CreationDate.time(),
+		SizeBytes:        job.BackupSizeInBytes,
+		Tags:             tags,
+	}, nil
+}
+
+func (b *backup) DescribeRecoveryPoint(ctx context.Context, vaultName, recoveryPointArn string) (*RecoveryPoint, error) {
+	region, err := arnRegion(recoveryPointArn)
+	if err != nil {
+		return nil, err
+	}
+	rp := recoveryPoint{}
+	err = b.call(ctx, "DescribeRecoveryPoint", http.MethodGet, region, "/backup-vaults/"+url.PathEscape(vaultName)+"/recovery-points/"+escapeArn(recoveryPointArn), nil, nil, &rp)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := b.ListTags(ctx, recoveryPointArn)
+	if err != nil {
+		return nil, err
+	}
+	return rp.recoveryPoint(tags), nil
+}
+
+func (b *backup) DeleteRecoveryPoint(ctx context.Context, vaultName, recoveryPointArn string) error {
+	region, err := arnRegion(recoveryPointArn)
+	if err != nil {
+		return err
+	}
+	return b.call(ctx, "DeleteRecoveryPoint", http.MethodDelete, region, "/backup-vaults/"+url.PathEscape(vaultName)+"/recovery-points/"+escapeArn(recoveryPointArn), nil, nil, nil)
+}
+
+func (b *backup) ListRecoveryPoints(ctx context.Context, region, vaultName, resourceArn, nextToken string, maxResults int32) ([]*RecoveryPoint, string, error) {
+	query := url.Values{"resourceType": []string{"EFS"}}
+	if resourceArn != "" {
+		query.Set("resourceArn", resourceArn)
+	}
+	if nextToken != "" {
+		query.Set("nextToken", nextToken)
+	}
+	if maxResults > 0 {
+		query.Set("maxResults", strconv.Itoa(int(maxResults)))
+	}
+	page := struct {
+		NextToken      string          `json:"NextToken"`
+		RecoveryPoints []recoveryPoint `json:"RecoveryPoints"`
+	}{}
+	if err := b.call(ctx, "ListRecoveryPointsByBackupVault", http.MethodGet, region, "/backup-vaults/"+url.PathEscape(vaultName)+"/recovery-points/", query, nil, &page); err != nil {
+		return nil, "", err
+	}
+	recoveryPoints := make([]*RecoveryPoint, 0, len(page.RecoveryPoints))
+	for i := range page.RecoveryPoints {
+		recoveryPoints = append(recoveryPoints, page.RecoveryPoints[i].recoveryPoint(nil))
+	}
+	return recoveryPoints, page.NextToken, nil
+}
+
+func (b *backup) ListTags(ctx context.Context, recoveryPointArn string) (map[string]string, error) {
+	region, err := arnRegion(recoveryPointArn)
+	if err != nil {
+		return nil, err
+	}
+	res := struct {
+		Tags map[string]string `json:"Tags"`
+	}{}
+	if err := b.call(ctx, "ListTags", http.MethodGet, region, "/tags/"+escapeArn(recoveryPointArn)+"/", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Tags, nil
+}
+
+// call sends the request of the operation to the API of the region, and decodes the response into out
+func (b *backup) call(ctx context.Context, operation, method, region, path string, query url.Values, in, out interface{}) error {
+	req := &apiRequest{operation: operation, method: method, region: region, path: path, query: query}
+	if in != nil {
+		body, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		req.body = body
+		req.header = http.Header{"Content-Type": []string{"application/json"}}
+	}
+	content, err := b.api.call(ctx, req, decodeBackupError)
+	if err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			switch apiErr.code {
+			case "ResourceNotFoundException":
+				return ErrNotFound
+			case "InvalidRequestException":
+				return fmt.Errorf("%w: %s", ErrInvalidBackupRequest, apiErr.message)
+			}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("failed to parse %s response: %v", operation, err)
+	}
+	return nil
+}
+
+// decodeBackupError returns the error of a response of the AWS Backup API
+func decodeBackupError(res *http.Response, content []byte) *apiError {
+	body := backupError{}
+	_ = json.Unmarshal(content, &body)
+	// The type is in the header, possibly followed by a namespace, e.g. ResourceNotFoundException:http://...
+	code := res.Header.Get("X-Amzn-Errortype")
+	if code == "" {
+		code = body.Code
+	}
+	if code == "" {
+		code = body.Type[strings.LastIndex(body.Type, "#")+1:]
+	}
+	return &apiError{
+		statusCode: res.StatusCode,
+		code:       strings.SplitN(code, ":", 2)[0],
+		message:    body.Message,
+	}
+}
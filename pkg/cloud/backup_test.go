@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testFileSystemArn    = "arn:aws-us-gov:elasticfilesystem:us-gov-west-1:111122223333:file-system/fs-abcd1234"
+	testRecoveryPointArn = "arn:aws-us-gov:backup:us-gov-west-1:111122223333:recovery-point:1EB3B5E7-9EB0-435A-A80B-108B488B0D45"
+)
+
+func newTestBackup(t *testing.T, handler http.HandlerFunc) *backup {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The calls go to the region of the ARN, in another partition than the one of the controller
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "/us-gov-west-1/backup/aws4_request") {
+			t.Errorf("Request is not signed for AWS Backup in us-gov-west-1: %q", auth)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return &backup{api: newTestAWSAPI(backupService, backupSDKId, server)}
+}
+
+func TestStartBackup(t *testing.T) {
+	b := newTestBackup(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/backup-jobs":
+			input := map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input["ResourceArn"] != testFileSystemArn || input["IdempotencyToken"] != "snapshot-1234" || input["BackupVaultName"] != "efs-csi" {
+				t.Errorf("Unexpected input %v: %v", input, err)
+			}
+			_, _ = w.Write([]byte(`{"BackupJobId":"job-1","RecoveryPointArn":"` + testRecoveryPointArn + `","CreationDate":1700000000.5}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/backup-jobs/job-1":
+			_, _ = w.Write([]byte(`{"BackupJobId":"job-1","RecoveryPointArn":"` + testRecoveryPointArn + `","ResourceArn":"` + testFileSystemArn + `","State":"RUNNING","CreationDate":1700000000.5}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	recoveryPoint, err := b.StartBackup(context.Background(), "efs-csi", "snapshot-1234", testFileSystemArn, "arn:aws-us-gov:iam::111122223333:role/backup", map[string]string{"k": "v"})
+	if err != nil {
+		t.Fatalf("StartBackup failed: %v", err)
+	}
+	if recoveryPoint.RecoveryPointArn != testRecoveryPointArn || recoveryPoint.ResourceArn != testFileSystemArn || recoveryPoint.Ready() || recoveryPoint.Failed() {
+		t.Fatalf("Unexpected recovery point %+v", recoveryPoint)
+	}
+	if expected := time.Unix(1700000000, 5e8).UTC(); !recoveryPoint.CreationTime.Equal(expected) {
+		t.Fatalf("Expected creation time %v, got %v", expected, recoveryPoint.CreationTime)
+	}
+}
+
+func TestDescribeRecoveryPoint(t *testing.T) {
+	escaped := escapeArn(testRecoveryPointArn)
+	b := newTestBackup(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/backup-vaults/efs-csi/recovery-points/" + escaped:
+			_, _ = w.Write([]byte(`{"RecoveryPointArn":"` + testRecoveryPointArn + `","Status":"COMPLETED","BackupSizeInBytes":1024}`))
+		case "/tags/" + escaped + "/":
+			_, _ = w.Write([]byte(`{"Tags":{"efs.csi.aws.com/source-volume-id":"fs-abcd1234"}}`))
+		default:
+			w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException:http://internal.amazon.com/coral/com.amazonaws.backup/")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"Code":"ResourceNotFoundException","Message":"not found"}`))
+		}
+	})
+
+	recoveryPoint, err := b.DescribeRecoveryPoint(context.Background(), "efs-csi", testRecoveryPointArn)
+	if err != nil {
+		t.Fatalf("DescribeRecoveryPoint failed: %v", err)
+	}
+	if !recoveryPoint.Ready() || recoveryPoint.SizeBytes != 1024 || recoveryPoint.Tags["efs.csi.aws.com/source-volume-id"] != "fs-abcd1234" {
+		t.Fatalf("Unexpected recovery point %+v", recoveryPoint)
+	}
+	if _, err := b.DescribeRecoveryPoint(context.Background(), "other", testRecoveryPointArn); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeleteRecoveryPoint(t *testing.T) {
+	testCases := []struct {
+		name        string
+		status      int
+		response    string
+		expectedErr error
+	}{
+		{
+			name:   "Success",
+			status: http.StatusOK,
+		},
+		{
+			name:        "Fail: backup job running",
+			status:      http.StatusBadRequest,
+			response:    `{"Code":"InvalidRequestException","Message":"Recovery point is being created"}`,
+			expectedErr: ErrInvalidBackupRequest,
+		},
+		{
+			name:        "Fail: Access Denied",
+			status:      http.StatusForbidden,
+			response:    `{"__type":"AccessDeniedException","Message":"not authorized"}`,
+			expectedErr: ErrAccessDenied,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newTestBackup(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					t.Errorf("Unexpected method %s", r.Method)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.response))
+			})
+			err := b.DeleteRecoveryPoint(context.Background(), "efs-csi", testRecoveryPointArn)
+			if !errors.Is(err, tc.expectedErr) || (tc.expectedErr == nil && err != nil) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestListRecoveryPoints(t *testing.T) {
+	b := newTestBackup(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/backup-vaults/efs-csi/recovery-points/" {
+			t.Errorf("Unexpected request %s %s, the recovery points are listed without their tags", r.Method, r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("resourceType") != "EFS" || query.Get("resourceArn") != testFileSystemArn || query.Get("nextToken") != "token-1" {
+			t.Errorf("Unexpected query %v", query)
+		}
+		_, _ = w.Write([]byte(`{"NextToken":"token-2","RecoveryPoints":[{"RecoveryPointArn":"` + testRecoveryPointArn + `","ResourceArn":"` + testFileSystemArn + `","Status":"COMPLETED","IamRoleArn":"arn:aws-us-gov:iam::111122223333:role/backup","CreatedBy":{"BackupPlanId":"plan-1"}}]}`))
+	})
+
+	recoveryPoints, nextToken, err := b.ListRecoveryPoints(context.Background(), "us-gov-west-1", "efs-csi", testFileSystemArn, "token-1", 10)
+	if err != nil {
+		t.Fatalf("ListRecoveryPoints failed: %v", err)
+	}
+	if nextToken != "token-2" || len(recoveryPoints) != 1 {
+		t.Fatalf("Unexpected page %v %q", recoveryPoints, nextToken)
+	}
+	if rp := recoveryPoints[0]; rp.IamRoleArn != "arn:aws-us-gov:iam::111122223333:role/backup" || rp.BackupPlanId != "plan-1" || rp.Tags != nil {
+		t.Fatalf("Unexpected recovery point %+v", rp)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"k8s.io/klog/v2"
+)
+
+// AWSCABundleEnv is the environment variable of the CA bundle of the AWS SDKs, read by botocore in efs-utils
+const AWSCABundleEnv = "AWS_CA_BUNDLE"
+
+// LoadCABundle reads the PEM bundle of CA certificates at the path, and checks that it holds at least one
+func LoadCABundle(path string) ([]byte, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s holds no PEM certificate", path)
+	}
+	return pem, nil
+}
+
+// caBundleRootCAs returns the CAs of the system with the ones of the PEM bundle
+func caBundleRootCAs(pem []byte) *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		klog.Warningf("Failed to load the system CAs, trusting only the CA bundle: %v", err)
+		pool = x509.NewCertPool()
+	}
+	pool.AppendCertsFromPEM(pem)
+	return pool
+}
+
+// loadConfig loads the default AWS config of the driver. Its HTTP client trusts the CA bundle of the options,
+// if any, in addition to the CAs of the system, e.g. for the endpoints of a private CA in air-gapped regions.
+func loadConfig(ctx context.Context, options Options, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	if len(options.CABundle) > 0 {
+		rootCAs := caBundleRootCAs(options.CABundle)
+		client := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			tr.TLSClientConfig.RootCAs = rootCAs
+		})
+		optFns = append(optFns, config.WithHTTPClient(client))
+	}
+	return config.LoadDefaultConfig(ctx, optFns...)
+}
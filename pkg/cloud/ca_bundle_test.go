@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCABundle writes the certificate of the TLS server as a PEM bundle, and returns its path
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca-bundle.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if bundle, err := LoadCABundle(writeCABundle(t, server)); err != nil || len(bundle) == 0 {
+		t.Fatalf("Expected the bundle, got %q: %v", bundle, err)
+	}
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCABundle(invalid); err == nil {
+		t.Fatalf("Expected an error for a bundle without certificate")
+	}
+	if _, err := LoadCABundle(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Fatalf("Expected an error for a missing bundle")
+	}
+}
+
+func TestLoadConfigWithCABundle(t *testing.T) {
+	// The certificate of the server is signed by a CA unknown to the system, as a private CA would be
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	bundle, err := LoadCABundle(writeCABundle(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	cfg, err := loadConfig(ctx, Options{})
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if res, err := cfg.HTTPClient.Do(newGetRequest(t, server.URL)); err == nil {
+		res.Body.Close()
+		t.Fatalf("Expected the certificate of the server not to be trusted without the bundle")
+	}
+
+	cfg, err = loadConfig(ctx, Options{CABundle: bundle})
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	res, err := cfg.HTTPClient.Do(newGetRequest(t, server.URL))
+	if err != nil {
+		t.Fatalf("Expected the certificate of the server to be trusted with the bundle: %v", err)
+	}
+	res.Body.Close()
+}
+
+func newGetRequest(t *testing.T, url string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"sync"
+)
+
+// clientTokenIndexMaxEntries bounds the memory of the index, which is reset when it is full
+const clientTokenIndexMaxEntries = 100000
+
+// clientTokenIndex maps the file systems and client tokens to the IDs of their access points. DescribeAccessPoints
+// cannot filter the access points by client token, so finding the access point of a client token scans all the
+// access points of the file system. The client tokens of the access points created or scanned by the cloud are
+// indexed, so that the access point of an indexed client token is described by ID instead. An entry may be stale,
+// e.g. if another controller replica deleted its access point, so the access point described must be checked.
+// A nil clientTokenIndex is valid and indexes nothing.
+type clientTokenIndex struct {
+	maxEntries int
+
+	mu sync.Mutex
+	// accessPoints holds the access point ID of each file system and client token, keyed by clientTokenKey
+	accessPoints map[string]string
+	// keys holds the clientTokenKey of each access point ID
+	keys map[string]string
+}
+
+func newClientTokenIndex() *clientTokenIndex {
+	return &clientTokenIndex{
+		maxEntries:   clientTokenIndexMaxEntries,
+		accessPoints: map[string]string{},
+		keys:         map[string]string{},
+	}
+}
+
+// add indexes the access point of the client token on the file system
+func (i *clientTokenIndex) add(fileSystemId, clientToken, accessPointId string) {
+	if i == nil || clientToken == "" {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.accessPoints) >= i.maxEntries {
+		i.accessPoints = map[string]string{}
+		i.keys = map[string]string{}
+	}
+	key := clientTokenKey(fileSystemId, clientToken)
+	i.accessPoints[key] = accessPointId
+	i.keys[accessPointId] = key
+}
+
+// get returns the ID of the access point indexed for the client token on the file system
+func (i *clientTokenIndex) get(fileSystemId, clientToken string) (string, bool) {
+	if i == nil {
+		return "", false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	accessPointId, ok := i.accessPoints[clientTokenKey(fileSystemId, clientToken)]
+	return accessPointId, ok
+}
+
+// forget removes the access point from the index, once it is deleted or found stale
+func (i *clientTokenIndex) forget(accessPointId string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if key, ok := i.keys[accessPointId]; ok {
+		delete(i.accessPoints, key)
+		delete(i.keys, accessPointId)
+	}
+}
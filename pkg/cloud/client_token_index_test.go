@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+)
+
+// pagedEfs serves the access points of a file system in pages, and counts the calls and access points described
+type pagedEfs struct {
+	Efs
+	pageSize     int
+	accessPoints []types.AccessPointDescription
+
+	calls     int
+	described int
+}
+
+func newPagedEfs(fileSystemId string, count, pageSize int) *pagedEfs {
+	e := &pagedEfs{pageSize: pageSize}
+	for i := 0; i < count; i++ {
+		e.accessPoints = append(e.accessPoints, types.AccessPointDescription{
+			AccessPointId: aws.String(fmt.Sprintf("fsap-%d", i)),
+			FileSystemId:  aws.String(fileSystemId),
+			ClientToken:   aws.String(fmt.Sprintf("token-%d", i)),
+			RootDirectory: &types.RootDirectory{Path: aws.String(fmt.Sprintf("/dir-%d", i))},
+		})
+	}
+	return e
+}
+
+func (e *pagedEfs) DescribeAccessPoints(_ context.Context, input *efs.DescribeAccessPointsInput, _ ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error) {
+	e.calls++
+	if input.AccessPointId != nil {
+		for _, ap := range e.accessPoints {
+			if *ap.AccessPointId == *input.AccessPointId {
+				e.described++
+				return &efs.DescribeAccessPointsOutput{AccessPoints: []types.AccessPointDescription{ap}}, nil
+			}
+		}
+		return nil, &types.AccessPointNotFound{Message: aws.String("Access point not found")}
+	}
+	if aws.ToString(input.FileSystemId) != aws.ToString(e.accessPoints[0].FileSystemId) {
+		return &efs.DescribeAccessPointsOutput{}, nil
+	}
+	start := 0
+	if input.NextToken != nil {
+		start, _ = strconv.Atoi(*input.NextToken)
+	}
+	end := start + e.pageSize
+	if end > len(e.accessPoints) {
+		end = len(e.accessPoints)
+	}
+	output := &efs.DescribeAccessPointsOutput{AccessPoints: e.accessPoints[start:end]}
+	if end < len(e.accessPoints) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	e.described += end - start
+	return output, nil
+}
+
+func TestFindAccessPointByClientTokenPages(t *testing.T) {
+	fsId := "fs-abcd1234"
+	ctx := context.Background()
+
+	t.Run("Success: found on a later page without listing the next ones", func(t *testing.T) {
+		mockEfs := newPagedEfs(fsId, 30, 10)
+		c := &cloud{efs: mockEfs}
+		res, err := c.FindAccessPointByClientToken(ctx, "token-15", fsId)
+		if err != nil || res == nil || res.AccessPointId != "fsap-15" || res.AccessPointRootDir != "/dir-15" {
+			t.Fatalf("Expected access point fsap-15, got %+v: %v", res, err)
+		}
+		if mockEfs.calls != 2 {
+			t.Fatalf("Expected 2 pages listed, got %d", mockEfs.calls)
+		}
+	})
+
+	t.Run("Success: not found on any page", func(t *testing.T) {
+		mockEfs := newPagedEfs(fsId, 30, 10)
+		c := &cloud{efs: mockEfs}
+		res, err := c.FindAccessPointByClientToken(ctx, "token-missing", fsId)
+		if err != nil || res != nil {
+			t.Fatalf("Expected no access point, got %+v: %v", res, err)
+		}
+		if mockEfs.calls != 3 {
+			t.Fatalf("Expected 3 pages listed, got %d", mockEfs.calls)
+		}
+	})
+}
+
+func TestFindAccessPointByClientTokenIndex(t *testing.T) {
+	fsId := "fs-abcd1234"
+	ctx := context.Background()
+	mockEfs := newPagedEfs(fsId, 30, 10)
+	c := &cloud{efs: mockEfs, clientTokens: newClientTokenIndex()}
+
+	// The scan indexes the client tokens of the pages listed
+	if res, err := c.FindAccessPointByClientToken(ctx, "token-15", fsId); err != nil || res == nil {
+		t.Fatalf("Expected access point fsap-15, got %+v: %v", res, err)
+	}
+
+	// An indexed client token is described by ID
+	mockEfs.calls, mockEfs.described = 0, 0
+	res, err := c.FindAccessPointByClientToken(ctx, "token-3", fsId)
+	if err != nil || res == nil || res.AccessPointId != "fsap-3" {
+		t.Fatalf("Expected access point fsap-3, got %+v: %v", res, err)
+	}
+	if mockEfs.calls != 1 || mockEfs.described != 1 {
+		t.Fatalf("Expected a single access point described, got %d in %d calls", mockEfs.described, mockEfs.calls)
+	}
+
+	// The client token of an access point indexed on another file system is not used
+	if res, err := c.FindAccessPointByClientToken(ctx, "token-3", "fs-other"); err != nil || res != nil {
+		t.Fatalf("Expected no access point on another file system, got %+v: %v", res, err)
+	}
+
+	// A stale entry falls back to the scan and is forgotten
+	mockEfs.accessPoints = append(mockEfs.accessPoints[:3], mockEfs.accessPoints[4:]...)
+	mockEfs.calls = 0
+	if res, err := c.FindAccessPointByClientToken(ctx, "token-3", fsId); err != nil || res != nil {
+		t.Fatalf("Expected no access point once deleted, got %+v: %v", res, err)
+	}
+	if mockEfs.calls != 4 {
+		t.Fatalf("Expected the access point described and 3 pages listed, got %d calls", mockEfs.calls)
+	}
+	if _, ok := c.clientTokens.get(fsId, "token-3"); ok {
+		t.Fatalf("Expected the stale entry to be forgotten")
+	}
+}
+
+func TestClientTokenIndexMaxEntries(t *testing.T) {
+	index := newClientTokenIndex()
+	index.maxEntries = 2
+	index.add("fs-abcd1234", "token-1", "fsap-1")
+	index.add("fs-abcd1234", "token-2", "fsap-2")
+	index.add("fs-abcd1234", "token-3", "fsap-3")
+	if _, ok := index.get("fs-abcd1234", "token-1"); ok {
+		t.Fatalf("Expected the full index to be reset")
+	}
+	if accessPointId, ok := index.get("fs-abcd1234", "token-3"); !ok || accessPointId != "fsap-3" {
+		t.Fatalf("Expected fsap-3, got %q", accessPointId)
+	}
+	index.forget("fsap-3")
+	if _, ok := index.get("fs-abcd1234", "token-3"); ok {
+		t.Fatalf("Expected fsap-3 to be forgotten")
+	}
+}
+
+// BenchmarkFindAccessPointByClientToken finds the access points of a file system with the access point limit,
+// and reports the access points described per lookup: all of them without the index, one with it
+func BenchmarkFindAccessPointByClientToken(b *testing.B) {
+	fsId := "fs-abcd1234"
+	ctx := context.Background()
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("indexed=%t", indexed), func(b *testing.B) {
+			mockEfs := newPagedEfs(fsId, AccessPointPerFsLimit, 100)
+			c := &cloud{efs: mockEfs}
+			if indexed {
+				c.clientTokens = newClientTokenIndex()
+				if _, err := c.FindAccessPointByClientToken(ctx, "token-missing", fsId); err != nil {
+					b.Fatal(err)
+				}
+			}
+			mockEfs.calls, mockEfs.described = 0, 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// The last access point created is the one looked up again by the retries of CreateVolume
+				if _, err := c.FindAccessPointByClientToken(ctx, fmt.Sprintf("token-%d", AccessPointPerFsLimit-1), fsId); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(mockEfs.described)/float64(b.N), "accesspoints/op")
+			b.ReportMetric(float64(mockEfs.calls)/float64(b.N), "calls/op")
+		})
+	}
+}
@@ -21,9 +21,13 @@ import (
 	"errors"
 	"fmt"
 
+	"bytes"
 	"github.com/aws/smithy-go"
-	"math/rand"
+	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -42,16 +46,105 @@ const (
 	AccessPointAlreadyExists = "AccessPointAlreadyExists"
 	PvcNameTagKey            = "pvcName"
 	AccessPointPerFsLimit    = 1000
+
+	// ProvisioningStateTagKey tracks the two phase creation of access points. Access points are created
+	// in the pending state and tagged as provisioned once their creation is confirmed.
+	// Access points without the tag were created before it was introduced and are provisioned.
+	ProvisioningStateTagKey = "efs.csi.aws.com/provisioning-state"
+	// PendingSinceTagKey records when a pending access point was created, in RFC 3339 format
+	PendingSinceTagKey           = "efs.csi.aws.com/pending-since"
+	ProvisioningStatePending     = "pending"
+	ProvisioningStateProvisioned = "provisioned"
+
+	// ParentDirsBasePathTagKey records the directory under which the parents of the root directory of the
+	// access point were created for it by subPathPattern, and may be deleted with it once empty
+	ParentDirsBasePathTagKey = "efs.csi.aws.com/parent-dirs-base-path"
+	// SharedAccessPointTagKey marks the access point shared by the volumes of a namespace, each in its own
+	// directory, and records the namespace
+	SharedAccessPointTagKey = "efs.csi.aws.com/shared-access-point-namespace"
+	// DirectoryVolumesTagKey marks the existing access point of the accessPointId parameter in which the driver
+	// created the directories of volumes, so that DeleteVolume deletes them
+	DirectoryVolumesTagKey = "efs.csi.aws.com/directory-volumes"
+	// ExistingRootDirTagKey marks the access point created without CreationInfo on a root directory that
+	// existed before it, which is kept when the access point is deleted
+	ExistingRootDirTagKey = "efs.csi.aws.com/existing-root-directory"
+	// ClusterIdTagKey records the cluster ID of the controller that created the access point, so that an
+	// access point found by client token is only reused by its own cluster
+	ClusterIdTagKey = "efs.csi.aws.com/cluster-id"
+	// DeletionTokenTagKey records the fencing token of the controller deleting the access point, so that a
+	// single controller replica deletes its root directory
+	DeletionTokenTagKey = "efs.csi.aws.com/deletion-token"
+	// DeletingSinceTagKey records when the deletion of the access point started, in RFC 3339 format
+	DeletingSinceTagKey = "efs.csi.aws.com/deleting-since"
+	// CapacityTagKey records the capacity of the volume of the access point, in bytes, as requested by its
+	// claim when created and expanded. EFS does not consider it, file systems being elastic.
+	CapacityTagKey = "efs.csi.aws.com/capacity-bytes"
 )
 
 var (
-	ErrNotFound      = errors.New("Resource was not found")
-	ErrAlreadyExists = errors.New("Resource already exists")
-	ErrAccessDenied  = errors.New("Access denied")
+	ErrNotFound         = errors.New("Resource was not found")
+	ErrAlreadyExists    = errors.New("Resource already exists")
+	ErrAccessDenied     = errors.New("Access denied")
+	ErrDeadlineExceeded = errors.New("Deadline exceeded")
+	// ErrDeniedByPolicy is returned by CheckAccess when the EFS API is explicitly denied
+	// by a service control policy of the organization, which no IAM policy can grant
+	ErrDeniedByPolicy = errors.New("Access denied by a service control policy")
+	// ErrThrottled wraps the errors of the calls still throttled by the EFS API after the retries
+	ErrThrottled = errors.New("Throttled")
+	// ErrAccessPointLimitExceeded is returned when the file system has the maximum number of access points
+	ErrAccessPointLimitExceeded = errors.New("Access point limit exceeded")
 )
 
+// Options configures the EFS API calls made by the cloud
+type Options struct {
+	// DescribeTimeout bounds the duration of describe and list calls. No timeout if 0
+	DescribeTimeout time.Duration
+	// CreateTimeout bounds the duration of create calls. No timeout if 0
+	CreateTimeout time.Duration
+	// DeleteTimeout bounds the duration of delete calls. No timeout if 0
+	DeleteTimeout time.Duration
+	// PreferredSubnetIds are the subnets whose mount targets are picked first, in order, when several are available
+	PreferredSubnetIds []string
+	// FaultInjector injects faults into the EFS API calls for testing. No faults if nil
+	FaultInjector *FaultInjector
+	// APIStatus records the throttling and failures of the EFS API calls. Not recorded if nil
+	APIStatus *APIStatus
+	// RetryPolicy configures the retries of the EFS API calls. The standard retryer of the SDK if nil
+	RetryPolicy *RetryPolicy
+	// RequireIMDSv2 fails the creation of the cloud if no IMDSv2 token can be fetched, instead of falling
+	// back to IMDSv1 or the Kubernetes API for the metadata of the instance
+	RequireIMDSv2 bool
+	// CABundle is a PEM bundle of CAs trusted by the AWS API clients in addition to the CAs of the system
+	CABundle []byte
+	// EFSEndpoint overrides the URL of the EFS API of the clouds whose API config has no endpoint, in the region
+	// of the instance, e.g. an interface VPC endpoint or localstack. The endpoint of the region if empty
+	EFSEndpoint string
+	// STSEndpoint overrides the URL of the STS API through which the roles are assumed. The endpoint of the
+	// region if empty
+	STSEndpoint string
+}
+
+// APIConfig selects the EFS API called by a cloud and the credentials used to call it. The zero value
+// is the API of the region of the instance called with the credentials of the driver.
+type APIConfig struct {
+	// Region of the API, whose partition is the one of the API, e.g. aws-us-gov for us-gov-west-1. The region of
+	// the endpoint if empty, or else the region of the instance
+	Region string
+	// Endpoint overrides the URL of the API, e.g. an interface VPC endpoint or the API of another partition.
+	// The requests are signed for the region
+	Endpoint string
+	// RoleArn is the role assumed to call the API, the credentials of the driver if empty
+	RoleArn string
+}
+
 type FileSystem struct {
 	FileSystemId string
+	// FileSystemArn is only set by DescribeFileSystem
+	FileSystemArn string
+	// LifeCycleState is the state of the file system, e.g. creating or available
+	LifeCycleState string
+	// ThroughputMode is only set by DescribeFileSystem, e.g. bursting or elastic
+	ThroughputMode string
 }
 
 type AccessPoint struct {
@@ -62,6 +155,24 @@ type AccessPoint struct {
 	// EFS does not consider capacity while provisioning new file systems or access points
 	CapacityGiB int64
 	PosixUser   *PosixUser
+	// Pending is set for access points whose creation was never confirmed, see ProvisioningStateTagKey
+	Pending      bool
+	PendingSince time.Time
+	// ParentDirsBasePath is set for access points whose parent directories may be deleted, see ParentDirsBasePathTagKey
+	ParentDirsBasePath string
+	// SharedNamespace is the namespace whose volumes share the access point, see SharedAccessPointTagKey
+	SharedNamespace string
+	// ExistingRootDir is set for access points created on an existing root directory, see ExistingRootDirTagKey
+	ExistingRootDir bool
+	// ClusterId is the cluster ID of the controller that created the access point, see ClusterIdTagKey
+	ClusterId string
+	// Tags are the tags of the access point, when described
+	Tags map[string]string
+	// DeletionToken is set for access points being deleted, see DeletionTokenTagKey
+	DeletionToken string
+	DeletingSince time.Time
+	// CapacityBytes is the capacity recorded for the volume of the access point, see CapacityTagKey
+	CapacityBytes int64
 }
 
 type PosixUser struct {
@@ -77,9 +188,16 @@ type AccessPointOptions struct {
 	FileSystemId   string
 	Uid            int64
 	Gid            int64
+	SecondaryGids  []int64
 	DirectoryPerms string
 	DirectoryPath  string
-	Tags           map[string]string
+	// SkipCreationInfo creates the access point without CreationInfo, EFS then requires its root
+	// directory to exist and DirectoryPerms is ignored
+	SkipCreationInfo bool
+	// SkipPosixUser creates the access point without PosixUser, so that the identity of the clients is
+	// kept. Uid and Gid then only own the root directory.
+	SkipPosixUser bool
+	Tags          map[string]string
 }
 
 type MountTarget struct {
@@ -95,44 +213,144 @@ type Efs interface {
 	DeleteAccessPoint(context.Context, *efs.DeleteAccessPointInput, ...func(*efs.Options)) (*efs.DeleteAccessPointOutput, error)
 	DescribeAccessPoints(context.Context, *efs.DescribeAccessPointsInput, ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error)
 	DescribeFileSystems(context.Context, *efs.DescribeFileSystemsInput, ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error)
+	CreateFileSystem(context.Context, *efs.CreateFileSystemInput, ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error)
+	DeleteFileSystem(context.Context, *efs.DeleteFileSystemInput, ...func(*efs.Options)) (*efs.DeleteFileSystemOutput, error)
+	CreateMountTarget(context.Context, *efs.CreateMountTargetInput, ...func(*efs.Options)) (*efs.CreateMountTargetOutput, error)
+	DeleteMountTarget(context.Context, *efs.DeleteMountTargetInput, ...func(*efs.Options)) (*efs.DeleteMountTargetOutput, error)
 	DescribeMountTargets(context.Context, *efs.DescribeMountTargetsInput, ...func(*efs.Options)) (*efs.DescribeMountTargetsOutput, error)
+	TagResource(context.Context, *efs.TagResourceInput, ...func(*efs.Options)) (*efs.TagResourceOutput, error)
+	UntagResource(context.Context, *efs.UntagResourceInput, ...func(*efs.Options)) (*efs.UntagResourceOutput, error)
+	ListTagsForResource(context.Context, *efs.ListTagsForResourceInput, ...func(*efs.Options)) (*efs.ListTagsForResourceOutput, error)
 }
 
+//go:generate go run ../../hack/instrumentgen -type Cloud -dependency cloud -output zz_generated.instrumented_cloud.go
+
 type Cloud interface {
 	GetMetadata() MetadataService
+	// CreateAccessPoint creates a pending access point, which must be marked as provisioned once the caller
+	// has confirmed its creation. It returns ErrAlreadyExists if the client token was used with other options.
 	CreateAccessPoint(ctx context.Context, clientToken string, accessPointOpts *AccessPointOptions) (accessPoint *AccessPoint, err error)
+	MarkAccessPointProvisioned(ctx context.Context, accessPointId string) (err error)
 	DeleteAccessPoint(ctx context.Context, accessPointId string) (err error)
 	DescribeAccessPoint(ctx context.Context, accessPointId string) (accessPoint *AccessPoint, err error)
 	FindAccessPointByClientToken(ctx context.Context, clientToken, fileSystemId string) (accessPoint *AccessPoint, err error)
 	ListAccessPoints(ctx context.Context, fileSystemId string) (accessPoints []*AccessPoint, err error)
+	// ListAccessPointsPages calls fn with every page of access points of the file system, until fn returns false
+	ListAccessPointsPages(ctx context.Context, fileSystemId string, fn func(accessPoints []*AccessPoint) bool) (err error)
 	DescribeFileSystem(ctx context.Context, fileSystemId string) (fs *FileSystem, err error)
+	// CreateFileSystem creates a file system tagged with ProvisionedFileSystemTagKey, or returns the one
+	// already created with the creation token
+	CreateFileSystem(ctx context.Context, creationToken string, fileSystemOpts *FileSystemOptions) (fs *FileSystem, err error)
+	// EnsureMountTargets creates the missing mount targets of the file system in the subnets. It returns
+	// true once the mount targets of all the subnets are available.
+	EnsureMountTargets(ctx context.Context, fileSystemId string, subnetIds, securityGroupIds []string) (available bool, err error)
+	// DeleteFileSystem deletes the mount targets of the file system, then the file system once they are
+	// deleted. It returns ErrFileSystemInUse until then.
+	DeleteFileSystem(ctx context.Context, fileSystemId string) (err error)
 	DescribeMountTargets(ctx context.Context, fileSystemId, az string) (fs *MountTarget, err error)
+	// ListMountTargets lists the available mount targets of the file system, in the order of preference
+	ListMountTargets(ctx context.Context, fileSystemId string) (mountTargets []*MountTarget, err error)
+	// ListPendingAccessPoints lists the pending access points of all file systems that have all the tags
+	ListPendingAccessPoints(ctx context.Context, tags map[string]string) (accessPoints []*AccessPoint, err error)
+	// TagResource adds the tags to the file system or access point, overwriting the value of existing keys
+	TagResource(ctx context.Context, resourceId string, tags map[string]string) (err error)
+	// UntagResource removes the tags with the keys from the file system or access point
+	UntagResource(ctx context.Context, resourceId string, tagKeys []string) (err error)
+	// DescribeTags returns the tags of the file system or access point
+	DescribeTags(ctx context.Context, resourceId string) (tags map[string]string, err error)
+	// CheckAccess makes a read-only EFS API call to verify that the credentials may use the EFS API, on the
+	// file system if set, as the IAM policies may only allow the calls on some file systems.
+	// It returns ErrDeniedByPolicy or ErrAccessDenied if they may not.
+	CheckAccess(ctx context.Context, fileSystemId string) (err error)
 }
 
 type cloud struct {
 	metadata MetadataService
 	efs      Efs
+	options  Options
+	// created holds the access points created recently, whose lookups are retried until they are visible
+	created *createdAccessPoints
+	// clientTokens indexes the access points by client token, for FindAccessPointByClientToken
+	clientTokens *clientTokenIndex
 }
 
 // NewCloud returns a new instance of AWS cloud
 // It panics if session is invalid
-func NewCloud() (Cloud, error) {
-	return createCloud("")
+func NewCloud(options Options) (Cloud, error) {
+	return createCloud(APIConfig{}, options)
 }
 
 // NewCloudWithRole returns a new instance of AWS cloud after assuming an aws role
 // It panics if driver does not have permissions to assume role.
-func NewCloudWithRole(awsRoleArn string) (Cloud, error) {
-	return createCloud(awsRoleArn)
+func NewCloudWithRole(awsRoleArn string, options Options) (Cloud, error) {
+	return createCloud(APIConfig{RoleArn: awsRoleArn}, options)
 }
 
-func createCloud(awsRoleArn string) (Cloud, error) {
+// NewCloudInRegion returns a new instance of AWS cloud calling the EFS API of the region, after assuming
+// the aws role if not empty. The partition of the API, and of the role, is the one of the region.
+func NewCloudInRegion(awsRoleArn, region string, options Options) (Cloud, error) {
+	return createCloud(APIConfig{Region: region, RoleArn: awsRoleArn}, options)
+}
+
+// NewCloudWithAPIConfig returns a new instance of AWS cloud calling the EFS API selected by the config.
+// It fails with ErrPartitionMismatch if the region, endpoint and role of the config are in different partitions.
+func NewCloudWithAPIConfig(apiConfig APIConfig, options Options) (Cloud, error) {
+	return createCloud(apiConfig, options)
+}
+
+// NewMetadataCloud returns a new instance of AWS cloud that only provides the metadata of the instance.
+// It has no EFS client and fails all the calls to the EFS API.
+func NewMetadataCloud(options Options) (Cloud, error) {
+	metadata, err := createMetadata(options)
+	if err != nil {
+		return nil, err
+	}
+	return newInstrumentedCloud(&cloud{
+		metadata: metadata,
+		efs:      disabledEfs{},
+		options:  options,
+	}), nil
+}
+
+func createCloud(apiConfig APIConfig, options Options) (Cloud, error) {
+	metadata, err := createMetadata(options)
+	if err != nil {
+		return nil, err
+	}
+
+	apiConfig, err = resolveAPIConfig(apiConfig, options, metadata.GetRegion())
+	if err != nil {
+		return nil, err
+	}
+	efs_client := createEfsClient(apiConfig, options)
+	klog.V(5).Infof("EFS Client created for region %v", apiConfig.Region)
+
+	return newInstrumentedCloud(&cloud{
+		metadata:     metadata,
+		efs:          efs_client,
+		options:      options,
+		created:      newCreatedAccessPoints(),
+		clientTokens: newClientTokenIndex(),
+	}), nil
+}
+
+func createMetadata(options Options) (MetadataService, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		klog.Warningf("Could not load config: %v", err)
 	}
 
-	svc := imds.NewFromConfig(cfg)
+	if options.RequireIMDSv2 && !isDriverBootedInECS() {
+		if err := CheckIMDSv2(context.TODO(), DefaultIMDSEndpoint, imdsCheckTimeout); err != nil {
+			return nil, err
+		}
+		klog.Info("IMDSv2 token fetched")
+	}
+	svc := imds.NewFromConfig(cfg, func(o *imds.Options) {
+		if options.RequireIMDSv2 {
+			o.EnableFallback = aws.FalseTernary
+		}
+	})
 	api, err := DefaultKubernetesAPIClient()
 
 	if err != nil && !isDriverBootedInECS() {
@@ -148,24 +366,33 @@ func createCloud(awsRoleArn string) (Cloud, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not get metadata: %v", err)
 	}
-
-	efs_client := createEfsClient(awsRoleArn, metadata)
-	klog.V(5).Infof("EFS Client created using the following endpoint: %+v", cfg.BaseEndpoint)
-
-	return &cloud{
-		metadata: metadata,
-		efs:      efs_client,
-	}, nil
+	return metadata, nil
 }
 
-func createEfsClient(awsRoleArn string, metadata MetadataService) Efs {
-	cfg, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(metadata.GetRegion()))
-	if awsRoleArn != "" {
-		stsClient := sts.NewFromConfig(cfg)
-		roleProvider := stscreds.NewAssumeRoleProvider(stsClient, awsRoleArn)
+func createEfsClient(apiConfig APIConfig, options Options) Efs {
+	cfg, _ := loadConfig(context.TODO(), options, config.WithRegion(apiConfig.Region))
+	if apiConfig.RoleArn != "" {
+		// The STS endpoint is the one of the region, in the partition of the role, unless overridden
+		stsClient := sts.NewFromConfig(cfg, options.stsEndpoint)
+		roleProvider := stscreds.NewAssumeRoleProvider(stsClient, apiConfig.RoleArn)
 		cfg.Credentials = aws.NewCredentialsCache(roleProvider)
 	}
-	return efs.NewFromConfig(cfg)
+	if options.FaultInjector != nil {
+		klog.Warningf("Injecting faults into the EFS API calls")
+		cfg.APIOptions = append(cfg.APIOptions, options.FaultInjector.addMiddleware)
+	}
+	if options.APIStatus != nil {
+		// Added after the fault injection, so that the attempts see the injected faults
+		cfg.APIOptions = append(cfg.APIOptions, options.APIStatus.addMiddleware)
+	}
+	return efs.NewFromConfig(cfg, func(o *efs.Options) {
+		if apiConfig.Endpoint != "" {
+			o.BaseEndpoint = aws.String(apiConfig.Endpoint)
+		}
+		if retryer := options.RetryPolicy.retryer(); retryer != nil {
+			o.Retryer = retryer
+		}
+	})
 }
 
 func (c *cloud) GetMetadata() MetadataService {
@@ -173,13 +400,25 @@ func (c *cloud) GetMetadata() MetadataService {
 }
 
 func (c *cloud) CreateAccessPoint(ctx context.Context, clientToken string, accessPointOpts *AccessPointOptions) (accessPoint *AccessPoint, err error) {
-	efsTags := parseEfsTags(accessPointOpts.Tags)
+	pendingSince := time.Now().UTC().Truncate(time.Second)
+	tags := map[string]string{
+		ProvisioningStateTagKey: ProvisioningStatePending,
+		PendingSinceTagKey:      pendingSince.Format(time.RFC3339),
+	}
+	for k, v := range accessPointOpts.Tags {
+		tags[k] = v
+	}
+	if accessPointOpts.SkipCreationInfo {
+		tags[ExistingRootDirTagKey] = "true"
+	}
+	efsTags := parseEfsTags(tags)
 	createAPInput := &efs.CreateAccessPointInput{
 		ClientToken:  &clientToken,
 		FileSystemId: &accessPointOpts.FileSystemId,
 		PosixUser: &types.PosixUser{
-			Gid: &accessPointOpts.Gid,
-			Uid: &accessPointOpts.Uid,
+			Gid:           &accessPointOpts.Gid,
+			Uid:           &accessPointOpts.Uid,
+			SecondaryGids: accessPointOpts.SecondaryGids,
 		},
 		RootDirectory: &types.RootDirectory{
 			CreationInfo: &types.CreationInfo{
@@ -191,49 +430,132 @@ func (c *cloud) CreateAccessPoint(ctx context.Context, clientToken string, acces
 		},
 		Tags: efsTags,
 	}
+	if accessPointOpts.SkipCreationInfo {
+		createAPInput.RootDirectory.CreationInfo = nil
+	}
+	if accessPointOpts.SkipPosixUser {
+		createAPInput.PosixUser = nil
+	}
 
 	klog.V(5).Infof("Calling Create AP with input: %+v", *createAPInput)
+	ctx, cancel := withTimeout(ctx, c.options.CreateTimeout)
+	defer cancel()
 	res, err := c.efs.CreateAccessPoint(ctx, createAPInput)
 	if err != nil {
 		if isAccessDenied(err) {
 			return nil, ErrAccessDenied
 		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
+		if isAccessPointAlreadyExists(err) {
+			return nil, ErrAlreadyExists
+		}
+		if isAccessPointLimitExceeded(err) {
+			return nil, ErrAccessPointLimitExceeded
+		}
+		if isThrottled(err) {
+			return nil, fmt.Errorf("%w: Failed to create access point: %v", ErrThrottled, err)
+		}
 		return nil, fmt.Errorf("Failed to create access point: %v", err)
 	}
 	klog.V(5).Infof("Create AP response : %+v", res)
 
-	return &AccessPoint{
+	accessPoint = &AccessPoint{
 		AccessPointId: *res.AccessPointId,
 		FileSystemId:  *res.FileSystemId,
 		CapacityGiB:   accessPointOpts.CapacityGiB,
-	}, nil
+		Pending:       true,
+		PendingSince:  pendingSince,
+	}
+	if res.RootDirectory != nil && res.RootDirectory.Path != nil {
+		accessPoint.AccessPointRootDir = *res.RootDirectory.Path
+	}
+	if res.PosixUser != nil && res.PosixUser.Uid != nil && res.PosixUser.Gid != nil {
+		accessPoint.PosixUser = &PosixUser{Uid: *res.PosixUser.Uid, Gid: *res.PosixUser.Gid}
+	}
+	c.created.add(accessPoint, clientToken)
+	c.clientTokens.add(accessPoint.FileSystemId, clientToken, accessPoint.AccessPointId)
+	return accessPoint, nil
+}
+
+func (c *cloud) MarkAccessPointProvisioned(ctx context.Context, accessPointId string) (err error) {
+	// The access point created recently may not be found yet
+	c.created.retry(ctx, accessPointId, func() bool {
+		err = c.markAccessPointProvisioned(ctx, accessPointId)
+		return errors.Is(err, ErrNotFound)
+	})
+	return err
+}
+
+func (c *cloud) markAccessPointProvisioned(ctx context.Context, accessPointId string) (err error) {
+	tagInput := &efs.TagResourceInput{
+		ResourceId: &accessPointId,
+		Tags:       parseEfsTags(map[string]string{ProvisioningStateTagKey: ProvisioningStateProvisioned}),
+	}
+	ctx, cancel := withTimeout(ctx, c.options.CreateTimeout)
+	defer cancel()
+	_, err = c.efs.TagResource(ctx, tagInput)
+	if err != nil {
+		if isAccessDenied(err) {
+			return ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return ErrDeadlineExceeded
+		}
+		if isAccessPointNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("Failed to mark access point %v as provisioned: %v", accessPointId, err)
+	}
+	return nil
 }
 
 func (c *cloud) DeleteAccessPoint(ctx context.Context, accessPointId string) (err error) {
 	deleteAccessPointInput := &efs.DeleteAccessPointInput{AccessPointId: &accessPointId}
+	ctx, cancel := withTimeout(ctx, c.options.DeleteTimeout)
+	defer cancel()
 	_, err = c.efs.DeleteAccessPoint(ctx, deleteAccessPointInput)
 	if err != nil {
 		if isAccessDenied(err) {
 			return ErrAccessDenied
 		}
+		if isDeadlineExceeded(err) {
+			return ErrDeadlineExceeded
+		}
 		if isAccessPointNotFound(err) {
+			c.clientTokens.forget(accessPointId)
 			return ErrNotFound
 		}
 		return fmt.Errorf("Failed to delete access point: %v, error: %v", accessPointId, err)
 	}
+	c.clientTokens.forget(accessPointId)
 
 	return nil
 }
 
 func (c *cloud) DescribeAccessPoint(ctx context.Context, accessPointId string) (accessPoint *AccessPoint, err error) {
+	c.created.retry(ctx, accessPointId, func() bool {
+		accessPoint, err = c.describeAccessPoint(ctx, accessPointId)
+		return errors.Is(err, ErrNotFound)
+	})
+	return accessPoint, err
+}
+
+func (c *cloud) describeAccessPoint(ctx context.Context, accessPointId string) (accessPoint *AccessPoint, err error) {
 	describeAPInput := &efs.DescribeAccessPointsInput{
 		AccessPointId: &accessPointId,
 	}
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
 	res, err := c.efs.DescribeAccessPoints(ctx, describeAPInput)
 	if err != nil {
 		if isAccessDenied(err) {
 			return nil, ErrAccessDenied
 		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
 		if isAccessPointNotFound(err) {
 			return nil, ErrNotFound
 		}
@@ -245,94 +567,262 @@ func (c *cloud) DescribeAccessPoint(ctx context.Context, accessPointId string) (
 		return nil, fmt.Errorf("DescribeAccessPoint failed. Expected exactly 1 access point in DescribeAccessPoint result. However, recevied %d access points", len(accessPoints))
 	}
 
-	return &AccessPoint{
+	accessPoint = &AccessPoint{
 		AccessPointId:      *accessPoints[0].AccessPointId,
 		FileSystemId:       *accessPoints[0].FileSystemId,
 		AccessPointRootDir: *accessPoints[0].RootDirectory.Path,
-	}, nil
+	}
+	setProvisioningState(accessPoint, accessPoints[0].Tags)
+	return accessPoint, nil
 }
 
 func (c *cloud) FindAccessPointByClientToken(ctx context.Context, clientToken, fileSystemId string) (accessPoint *AccessPoint, err error) {
+	c.created.retry(ctx, clientTokenKey(fileSystemId, clientToken), func() bool {
+		accessPoint, err = c.findAccessPointByClientToken(ctx, clientToken, fileSystemId)
+		return accessPoint == nil && err == nil
+	})
+	return accessPoint, err
+}
+
+func (c *cloud) findAccessPointByClientToken(ctx context.Context, clientToken, fileSystemId string) (accessPoint *AccessPoint, err error) {
 	klog.V(5).Infof("Filesystem ID to find AP : %+v", fileSystemId)
 	klog.V(2).Infof("ClientToken to find AP : %s", clientToken)
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	if accessPointId, ok := c.clientTokens.get(fileSystemId, clientToken); ok {
+		accessPoint, err = c.describeAccessPointOfClientToken(ctx, accessPointId, clientToken, fileSystemId)
+		if err != nil || accessPoint != nil {
+			return accessPoint, err
+		}
+		klog.V(4).Infof("Access point %s indexed for client token %s is gone, listing the access points of %s", accessPointId, clientToken, fileSystemId)
+		c.clientTokens.forget(accessPointId)
+	}
+
+	// DescribeAccessPoints cannot filter by client token: the pages are scanned until the access point is found,
+	// and the client tokens scanned are indexed for the next lookups
 	describeAPInput := &efs.DescribeAccessPointsInput{
 		FileSystemId: &fileSystemId,
 		MaxResults:   aws.Int32(AccessPointPerFsLimit),
 	}
-	res, err := c.efs.DescribeAccessPoints(ctx, describeAPInput)
+	for {
+		res, err := c.efs.DescribeAccessPoints(ctx, describeAPInput)
+		if err != nil {
+			if isAccessDenied(err) {
+				return nil, ErrAccessDenied
+			}
+			if isDeadlineExceeded(err) {
+				return nil, ErrDeadlineExceeded
+			}
+			if isFileSystemNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("failed to list Access Points of efs = %s : %v", fileSystemId, err)
+		}
+		for _, ap := range res.AccessPoints {
+			token := aws.ToString(ap.ClientToken)
+			c.clientTokens.add(fileSystemId, token, aws.ToString(ap.AccessPointId))
+			// check if AP exists with same client token
+			if token == clientToken {
+				return accessPointOfClientToken(ap), nil
+			}
+		}
+		if res.NextToken == nil {
+			break
+		}
+		describeAPInput.NextToken = res.NextToken
+	}
+	klog.V(2).Infof("Access point does not exist")
+	return nil, nil
+}
+
+// describeAccessPointOfClientToken describes the access point indexed for the client token. It returns nil if the
+// access point no longer exists or no longer matches the client token and file system.
+func (c *cloud) describeAccessPointOfClientToken(ctx context.Context, accessPointId, clientToken, fileSystemId string) (*AccessPoint, error) {
+	res, err := c.efs.DescribeAccessPoints(ctx, &efs.DescribeAccessPointsInput{AccessPointId: &accessPointId})
 	if err != nil {
+		if isAccessPointNotFound(err) {
+			return nil, nil
+		}
 		if isAccessDenied(err) {
 			return nil, ErrAccessDenied
 		}
-		if isFileSystemNotFound(err) {
-			return nil, ErrNotFound
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
 		}
-		err = fmt.Errorf("failed to list Access Points of efs = %s : %v", fileSystemId, err)
-		return
+		return nil, fmt.Errorf("failed to describe Access Point %s of client token %s: %v", accessPointId, clientToken, err)
 	}
 	for _, ap := range res.AccessPoints {
-		// check if AP exists with same client token
-		if *ap.ClientToken == clientToken {
-			return &AccessPoint{
-				AccessPointId:      *ap.AccessPointId,
-				FileSystemId:       *ap.FileSystemId,
-				AccessPointRootDir: *ap.RootDirectory.Path,
-			}, nil
+		if aws.ToString(ap.ClientToken) == clientToken && aws.ToString(ap.FileSystemId) == fileSystemId {
+			return accessPointOfClientToken(ap), nil
 		}
 	}
-	klog.V(2).Infof("Access point does not exist")
 	return nil, nil
 }
 
+func accessPointOfClientToken(ap types.AccessPointDescription) *AccessPoint {
+	accessPoint := &AccessPoint{
+		AccessPointId:      *ap.AccessPointId,
+		FileSystemId:       *ap.FileSystemId,
+		AccessPointRootDir: *ap.RootDirectory.Path,
+	}
+	setProvisioningState(accessPoint, ap.Tags)
+	return accessPoint
+}
+
 func (c *cloud) ListAccessPoints(ctx context.Context, fileSystemId string) (accessPoints []*AccessPoint, err error) {
+	err = c.ListAccessPointsPages(ctx, fileSystemId, func(page []*AccessPoint) bool {
+		accessPoints = append(accessPoints, page...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accessPoints, nil
+}
+
+func (c *cloud) ListAccessPointsPages(ctx context.Context, fileSystemId string, fn func(accessPoints []*AccessPoint) bool) (err error) {
 	describeAPInput := &efs.DescribeAccessPointsInput{
 		FileSystemId: &fileSystemId,
 		MaxResults:   aws.Int32(AccessPointPerFsLimit),
 	}
-	res, err := c.efs.DescribeAccessPoints(ctx, describeAPInput)
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	for {
+		res, err := c.efs.DescribeAccessPoints(ctx, describeAPInput)
+		if err != nil {
+			if isAccessDenied(err) {
+				return ErrAccessDenied
+			}
+			if isDeadlineExceeded(err) {
+				return ErrDeadlineExceeded
+			}
+			if isFileSystemNotFound(err) {
+				return ErrNotFound
+			}
+			if isThrottled(err) {
+				return fmt.Errorf("%w: List Access Points failed: %v", ErrThrottled, err)
+			}
+			return fmt.Errorf("List Access Points failed: %v", err)
+		}
+
+		var accessPoints []*AccessPoint
+		var posixUser *PosixUser
+		for _, accessPointDescription := range res.AccessPoints {
+			if accessPointDescription.PosixUser != nil {
+				posixUser = &PosixUser{
+					Gid: *accessPointDescription.PosixUser.Gid,
+					Uid: *accessPointDescription.PosixUser.Uid,
+				}
+			} else {
+				posixUser = nil
+			}
+			accessPoint := &AccessPoint{
+				AccessPointId: *accessPointDescription.AccessPointId,
+				FileSystemId:  *accessPointDescription.FileSystemId,
+				PosixUser:     posixUser,
+			}
+			if accessPointDescription.RootDirectory != nil && accessPointDescription.RootDirectory.Path != nil {
+				accessPoint.AccessPointRootDir = *accessPointDescription.RootDirectory.Path
+			}
+			setProvisioningState(accessPoint, accessPointDescription.Tags)
+			accessPoints = append(accessPoints, accessPoint)
+		}
+
+		if !fn(accessPoints) || res.NextToken == nil {
+			return nil
+		}
+		describeAPInput.NextToken = res.NextToken
+	}
+}
+
+func (c *cloud) CheckAccess(ctx context.Context, fileSystemId string) error {
+	describeFsInput := &efs.DescribeFileSystemsInput{MaxItems: aws.Int32(1)}
+	if fileSystemId != "" {
+		describeFsInput.FileSystemId = aws.String(fileSystemId)
+	}
+	klog.V(5).Infof("Calling DescribeFileSystems with input: %+v", *describeFsInput)
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	_, err := c.efs.DescribeFileSystems(ctx, describeFsInput)
 	if err != nil {
+		if isDeniedByPolicy(err) {
+			return ErrDeniedByPolicy
+		}
 		if isAccessDenied(err) {
-			return nil, ErrAccessDenied
+			return ErrAccessDenied
 		}
 		if isFileSystemNotFound(err) {
-			return nil, ErrNotFound
+			return ErrNotFound
 		}
-		err = fmt.Errorf("List Access Points failed: %v", err)
-		return
+		if isDeadlineExceeded(err) {
+			return ErrDeadlineExceeded
+		}
+		return fmt.Errorf("Describe File Systems failed: %v", err)
 	}
+	return nil
+}
 
-	var posixUser *PosixUser
-	for _, accessPointDescription := range res.AccessPoints {
-		if accessPointDescription.PosixUser != nil {
-			posixUser = &PosixUser{
-				Gid: *accessPointDescription.PosixUser.Gid,
-				Uid: *accessPointDescription.PosixUser.Gid,
+func (c *cloud) ListPendingAccessPoints(ctx context.Context, tags map[string]string) (accessPoints []*AccessPoint, err error) {
+	describeAPInput := &efs.DescribeAccessPointsInput{
+		MaxResults: aws.Int32(AccessPointPerFsLimit),
+	}
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	for {
+		res, err := c.efs.DescribeAccessPoints(ctx, describeAPInput)
+		if err != nil {
+			if isAccessDenied(err) {
+				return nil, ErrAccessDenied
+			}
+			if isDeadlineExceeded(err) {
+				return nil, ErrDeadlineExceeded
 			}
-		} else {
-			posixUser = nil
+			return nil, fmt.Errorf("List Access Points failed: %v", err)
 		}
-		accessPoint := &AccessPoint{
-			AccessPointId: *accessPointDescription.AccessPointId,
-			FileSystemId:  *accessPointDescription.FileSystemId,
-			PosixUser:     posixUser,
+
+		for _, ap := range res.AccessPoints {
+			accessPoint := &AccessPoint{
+				AccessPointId: *ap.AccessPointId,
+				FileSystemId:  *ap.FileSystemId,
+			}
+			setProvisioningState(accessPoint, ap.Tags)
+			if !accessPoint.Pending || !hasTags(accessPoint, tags) {
+				continue
+			}
+			// The age of an access point without a valid pending-since tag is unknown, it may be in flight
+			if accessPoint.PendingSince.IsZero() {
+				klog.Warningf("Access point %v of file system %v is pending without a valid %s tag, ignoring it", accessPoint.AccessPointId, accessPoint.FileSystemId, PendingSinceTagKey)
+				continue
+			}
+			accessPoints = append(accessPoints, accessPoint)
 		}
-		accessPoints = append(accessPoints, accessPoint)
-	}
 
-	return
+		if res.NextToken == nil {
+			return accessPoints, nil
+		}
+		describeAPInput.NextToken = res.NextToken
+	}
 }
 
 func (c *cloud) DescribeFileSystem(ctx context.Context, fileSystemId string) (fs *FileSystem, err error) {
 	describeFsInput := &efs.DescribeFileSystemsInput{FileSystemId: &fileSystemId}
 	klog.V(5).Infof("Calling DescribeFileSystems with input: %+v", *describeFsInput)
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
 	res, err := c.efs.DescribeFileSystems(ctx, describeFsInput)
 	if err != nil {
 		if isAccessDenied(err) {
 			return nil, ErrAccessDenied
 		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
 		if isFileSystemNotFound(err) {
 			return nil, ErrNotFound
 		}
+		if isThrottled(err) {
+			return nil, fmt.Errorf("%w: Describe File System failed: %v", ErrThrottled, err)
+		}
 		return nil, fmt.Errorf("Describe File System failed: %v", err)
 	}
 
@@ -341,18 +831,26 @@ func (c *cloud) DescribeFileSystem(ctx context.Context, fileSystemId string) (fs
 		return nil, fmt.Errorf("DescribeFileSystem failed. Expected exactly 1 file system in DescribeFileSystem result. However, recevied %d file systems", len(fileSystems))
 	}
 	return &FileSystem{
-		FileSystemId: *res.FileSystems[0].FileSystemId,
+		FileSystemId:   *res.FileSystems[0].FileSystemId,
+		FileSystemArn:  aws.ToString(res.FileSystems[0].FileSystemArn),
+		LifeCycleState: string(res.FileSystems[0].LifeCycleState),
+		ThroughputMode: string(res.FileSystems[0].ThroughputMode),
 	}, nil
 }
 
 func (c *cloud) DescribeMountTargets(ctx context.Context, fileSystemId, azName string) (fs *MountTarget, err error) {
 	describeMtInput := &efs.DescribeMountTargetsInput{FileSystemId: &fileSystemId}
 	klog.V(5).Infof("Calling DescribeMountTargets with input: %+v", *describeMtInput)
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
 	res, err := c.efs.DescribeMountTargets(ctx, describeMtInput)
 	if err != nil {
 		if isAccessDenied(err) {
 			return nil, ErrAccessDenied
 		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
 		if isFileSystemNotFound(err) {
 			return nil, ErrNotFound
 		}
@@ -370,17 +868,19 @@ func (c *cloud) DescribeMountTargets(ctx context.Context, fileSystemId, azName s
 		return nil, fmt.Errorf("No mount target for file system %v is in available state. Please retry in 5 minutes.", fileSystemId)
 	}
 
+	// The same mount target is picked every time, so that network issues can be reproduced
+	sortMountTargets(availableMountTargets, c.options.PreferredSubnetIds)
 	var mountTarget *types.MountTargetDescription
 	if azName != "" {
 		mountTarget = getMountTargetForAz(availableMountTargets, azName)
 	}
 
-	// Pick random Mount target from available mount target if azName is not provided.
-	// Or if there is no mount target matching azName
+	// Pick the first available mount target if azName is not provided,
+	// or if there is no mount target matching azName
 	if mountTarget == nil {
-		klog.Infof("Picking a random mount target from available mount target")
-		rand.Seed(time.Now().Unix())
-		mountTarget = &availableMountTargets[rand.Intn(len(availableMountTargets))]
+		mountTarget = &availableMountTargets[0]
+		klog.Infof("Picked mount target %v with IP %v in %v, the first of %d available mount targets of file system %v",
+			*mountTarget.MountTargetId, *mountTarget.IpAddress, *mountTarget.AvailabilityZoneName, len(availableMountTargets), fileSystemId)
 	}
 
 	return &MountTarget{
@@ -391,6 +891,112 @@ func (c *cloud) DescribeMountTargets(ctx context.Context, fileSystemId, azName s
 	}, nil
 }
 
+func (c *cloud) ListMountTargets(ctx context.Context, fileSystemId string) (mountTargets []*MountTarget, err error) {
+	describeMtInput := &efs.DescribeMountTargetsInput{FileSystemId: &fileSystemId}
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	res, err := c.efs.DescribeMountTargets(ctx, describeMtInput)
+	if err != nil {
+		if isAccessDenied(err) {
+			return nil, ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
+		if isFileSystemNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("Describe Mount Targets failed: %v", err)
+	}
+
+	availableMountTargets := getAvailableMountTargets(res.MountTargets)
+	sortMountTargets(availableMountTargets, c.options.PreferredSubnetIds)
+	for _, mt := range availableMountTargets {
+		mountTargets = append(mountTargets, &MountTarget{
+			AZName:        *mt.AvailabilityZoneName,
+			AZId:          *mt.AvailabilityZoneId,
+			MountTargetId: *mt.MountTargetId,
+			IPAddress:     *mt.IpAddress,
+		})
+	}
+	return mountTargets, nil
+}
+
+func (c *cloud) TagResource(ctx context.Context, resourceId string, tags map[string]string) (err error) {
+	tagInput := &efs.TagResourceInput{
+		ResourceId: &resourceId,
+		Tags:       parseEfsTags(tags),
+	}
+	ctx, cancel := withTimeout(ctx, c.options.CreateTimeout)
+	defer cancel()
+	_, err = c.efs.TagResource(ctx, tagInput)
+	if err != nil {
+		if isAccessDenied(err) {
+			return ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return ErrDeadlineExceeded
+		}
+		if isFileSystemNotFound(err) || isAccessPointNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("Failed to tag resource %v: %v", resourceId, err)
+	}
+	return nil
+}
+
+func (c *cloud) UntagResource(ctx context.Context, resourceId string, tagKeys []string) (err error) {
+	untagInput := &efs.UntagResourceInput{
+		ResourceId: &resourceId,
+		TagKeys:    tagKeys,
+	}
+	ctx, cancel := withTimeout(ctx, c.options.DeleteTimeout)
+	defer cancel()
+	_, err = c.efs.UntagResource(ctx, untagInput)
+	if err != nil {
+		if isAccessDenied(err) {
+			return ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return ErrDeadlineExceeded
+		}
+		if isFileSystemNotFound(err) || isAccessPointNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("Failed to untag resource %v: %v", resourceId, err)
+	}
+	return nil
+}
+
+func (c *cloud) DescribeTags(ctx context.Context, resourceId string) (tags map[string]string, err error) {
+	listTagsInput := &efs.ListTagsForResourceInput{ResourceId: &resourceId}
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	tags = map[string]string{}
+	for {
+		res, err := c.efs.ListTagsForResource(ctx, listTagsInput)
+		if err != nil {
+			if isAccessDenied(err) {
+				return nil, ErrAccessDenied
+			}
+			if isDeadlineExceeded(err) {
+				return nil, ErrDeadlineExceeded
+			}
+			if isFileSystemNotFound(err) || isAccessPointNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("Failed to describe tags of resource %v: %v", resourceId, err)
+		}
+		for _, tag := range res.Tags {
+			tags[*tag.Key] = *tag.Value
+		}
+		if res.NextToken == nil {
+			return tags, nil
+		}
+		listTagsInput.NextToken = res.NextToken
+	}
+}
+
 func isFileSystemNotFound(err error) bool {
 	var FileSystemNotFoundErr *types.FileSystemNotFound
 	if errors.As(err, &FileSystemNotFoundErr) {
@@ -407,6 +1013,19 @@ func isAccessPointNotFound(err error) bool {
 	return false
 }
 
+func isAccessPointAlreadyExists(err error) bool {
+	var AccessPointAlreadyExistsErr *types.AccessPointAlreadyExists
+	if errors.As(err, &AccessPointAlreadyExistsErr) {
+		return true
+	}
+	return false
+}
+
+func isAccessPointLimitExceeded(err error) bool {
+	var accessPointLimitExceededErr *types.AccessPointLimitExceeded
+	return errors.As(err, &accessPointLimitExceededErr)
+}
+
 func isAccessDenied(err error) bool {
 	var apiErr smithy.APIError
 	if errors.As(err, &apiErr) {
@@ -417,6 +1036,29 @@ func isAccessDenied(err error) bool {
 	return false
 }
 
+// isDeniedByPolicy returns true if the access was denied by a service control policy, whose
+// denial message is the only way to tell it apart from a missing IAM permission
+func isDeniedByPolicy(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && isAccessDenied(err) {
+		return strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "service control policy")
+	}
+	return false
+}
+
+func isDeadlineExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// withTimeout bounds the context with the given timeout, if any.
+// The deadline of the CSI call carried by the context is kept when it is shorter.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 func isDriverBootedInECS() bool {
 	ecsContainerMetadataUri := os.Getenv(taskMetadataV4EnvName)
 	return ecsContainerMetadataUri != ""
@@ -435,6 +1077,56 @@ func parseEfsTags(tagMap map[string]string) []types.Tag {
 	return efsTags
 }
 
+// hasTags returns whether the access point has all the tags
+func hasTags(accessPoint *AccessPoint, tags map[string]string) bool {
+	for k, v := range tags {
+		if value, ok := accessPoint.Tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// setProvisioningState keeps the tags of the access point, and sets its provisioning state, the parent directories
+// base path, the shared namespace and the other tagged fields from them
+func setProvisioningState(accessPoint *AccessPoint, tags []types.Tag) {
+	for _, tag := range tags {
+		if tag.Key == nil || tag.Value == nil {
+			continue
+		}
+		if accessPoint.Tags == nil {
+			accessPoint.Tags = map[string]string{}
+		}
+		accessPoint.Tags[*tag.Key] = *tag.Value
+		switch *tag.Key {
+		case ProvisioningStateTagKey:
+			accessPoint.Pending = *tag.Value == ProvisioningStatePending
+		case PendingSinceTagKey:
+			if t, err := time.Parse(time.RFC3339, *tag.Value); err == nil {
+				accessPoint.PendingSince = t
+			}
+		case ParentDirsBasePathTagKey:
+			accessPoint.ParentDirsBasePath = *tag.Value
+		case SharedAccessPointTagKey:
+			accessPoint.SharedNamespace = *tag.Value
+		case ExistingRootDirTagKey:
+			accessPoint.ExistingRootDir = *tag.Value == "true"
+		case ClusterIdTagKey:
+			accessPoint.ClusterId = *tag.Value
+		case DeletionTokenTagKey:
+			accessPoint.DeletionToken = *tag.Value
+		case DeletingSinceTagKey:
+			if t, err := time.Parse(time.RFC3339, *tag.Value); err == nil {
+				accessPoint.DeletingSince = t
+			}
+		case CapacityTagKey:
+			if capacity, err := strconv.ParseInt(*tag.Value, 10, 64); err == nil {
+				accessPoint.CapacityBytes = capacity
+			}
+		}
+	}
+}
+
 func getAvailableMountTargets(mountTargets []types.MountTargetDescription) []types.MountTargetDescription {
 	availableMountTargets := []types.MountTargetDescription{}
 	for _, mt := range mountTargets {
@@ -447,11 +1139,42 @@ func getAvailableMountTargets(mountTargets []types.MountTargetDescription) []typ
 }
 
 func getMountTargetForAz(mountTargets []types.MountTargetDescription, azName string) *types.MountTargetDescription {
+	var matching []types.MountTargetDescription
 	for _, mt := range mountTargets {
 		if *mt.AvailabilityZoneName == azName {
-			return &mt
+			matching = append(matching, mt)
 		}
 	}
-	klog.Infof("There is no mount target match %v", azName)
-	return nil
+	if len(matching) == 0 {
+		klog.Infof("There is no mount target match %v", azName)
+		return nil
+	}
+	if len(matching) > 1 {
+		klog.Infof("Picked mount target %v with IP %v in subnet %v, the first of %d mount targets in %v",
+			*matching[0].MountTargetId, *matching[0].IpAddress, aws.ToString(matching[0].SubnetId), len(matching), azName)
+	}
+	return &matching[0]
+}
+
+// sortMountTargets sorts the mount targets in the preferred subnets first, in the order of the subnets,
+// then the other ones by IP address
+func sortMountTargets(mountTargets []types.MountTargetDescription, preferredSubnetIds []string) {
+	subnetRank := func(mt types.MountTargetDescription) int {
+		for i, subnetId := range preferredSubnetIds {
+			if aws.ToString(mt.SubnetId) == subnetId {
+				return i
+			}
+		}
+		return len(preferredSubnetIds)
+	}
+	sort.SliceStable(mountTargets, func(i, j int) bool {
+		if ri, rj := subnetRank(mountTargets[i]), subnetRank(mountTargets[j]); ri != rj {
+			return ri < rj
+		}
+		ipi, ipj := net.ParseIP(aws.ToString(mountTargets[i].IpAddress)), net.ParseIP(aws.ToString(mountTargets[j].IpAddress))
+		if c := bytes.Compare(ipi.To16(), ipj.To16()); c != 0 {
+			return c < 0
+		}
+		return aws.ToString(mountTargets[i].MountTargetId) < aws.ToString(mountTargets[j].MountTargetId)
+	})
 }
@@ -3,8 +3,10 @@ package cloud
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aws/smithy-go"
 
@@ -82,7 +84,19 @@ func TestCreateAccessPoint(t *testing.T) {
 				}
 
 				ctx := context.Background()
-				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).Return(output, nil)
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+					func(_ context.Context, input *efs.CreateAccessPointInput, _ ...func(*efs.Options)) (*efs.CreateAccessPointOutput, error) {
+						pending := false
+						for _, tag := range input.Tags {
+							if *tag.Key == ProvisioningStateTagKey && *tag.Value == ProvisioningStatePending {
+								pending = true
+							}
+						}
+						if !pending || len(input.Tags) != 3 {
+							t.Fatalf("Expected access point to be created as pending with its tags, got %+v", input.Tags)
+						}
+						return output, nil
+					})
 				res, err := c.CreateAccessPoint(ctx, clientToken, req)
 
 				if err != nil {
@@ -93,6 +107,10 @@ func TestCreateAccessPoint(t *testing.T) {
 					t.Fatal("Result is nil")
 				}
 
+				if !res.Pending {
+					t.Fatal("Expected access point to be pending")
+				}
+
 				if accessPointId != res.AccessPointId {
 					t.Fatalf("AccessPointId mismatched. Expected: %v, Actual: %v", accessPointId, res.AccessPointId)
 				}
@@ -103,6 +121,89 @@ func TestCreateAccessPoint(t *testing.T) {
 				mockCtl.Finish()
 			},
 		},
+		{
+			name: "Success: without CreationInfo",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockEfs := mocks.NewMockEfs(mockCtl)
+				c := &cloud{efs: mockEfs}
+
+				req := &AccessPointOptions{
+					FileSystemId:     fsId,
+					Uid:              uid,
+					Gid:              gid,
+					DirectoryPerms:   directoryPerms,
+					DirectoryPath:    directoryPath,
+					SkipCreationInfo: true,
+				}
+
+				output := &efs.CreateAccessPointOutput{
+					AccessPointId: aws.String(accessPointId),
+					FileSystemId:  aws.String(fsId),
+				}
+
+				ctx := context.Background()
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+					func(_ context.Context, input *efs.CreateAccessPointInput, _ ...func(*efs.Options)) (*efs.CreateAccessPointOutput, error) {
+						if input.RootDirectory.CreationInfo != nil || *input.RootDirectory.Path != directoryPath {
+							t.Fatalf("Expected root directory %v without CreationInfo, got %+v", directoryPath, input.RootDirectory)
+						}
+						existing := false
+						for _, tag := range input.Tags {
+							if *tag.Key == ExistingRootDirTagKey && *tag.Value == "true" {
+								existing = true
+							}
+						}
+						if !existing {
+							t.Fatalf("Expected access point to be tagged with %v, got %+v", ExistingRootDirTagKey, input.Tags)
+						}
+						return output, nil
+					})
+				if _, err := c.CreateAccessPoint(ctx, clientToken, req); err != nil {
+					t.Fatalf("CreateAccessPoint failed: %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: without PosixUser",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockEfs := mocks.NewMockEfs(mockCtl)
+				c := &cloud{efs: mockEfs}
+
+				req := &AccessPointOptions{
+					FileSystemId:   fsId,
+					Uid:            uid,
+					Gid:            gid,
+					DirectoryPerms: directoryPerms,
+					DirectoryPath:  directoryPath,
+					SkipPosixUser:  true,
+				}
+
+				output := &efs.CreateAccessPointOutput{
+					AccessPointId: aws.String(accessPointId),
+					FileSystemId:  aws.String(fsId),
+				}
+
+				ctx := context.Background()
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+					func(_ context.Context, input *efs.CreateAccessPointInput, _ ...func(*efs.Options)) (*efs.CreateAccessPointOutput, error) {
+						if input.PosixUser != nil {
+							t.Fatalf("Expected no PosixUser, got %+v", input.PosixUser)
+						}
+						creationInfo := input.RootDirectory.CreationInfo
+						if creationInfo == nil || *creationInfo.OwnerUid != uid || *creationInfo.OwnerGid != gid {
+							t.Fatalf("Expected root directory owned by %d:%d, got %+v", uid, gid, creationInfo)
+						}
+						return output, nil
+					})
+				if _, err := c.CreateAccessPoint(ctx, clientToken, req); err != nil {
+					t.Fatalf("CreateAccessPoint failed: %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
 		{
 			name: "Fail",
 			testFunc: func(t *testing.T) {
@@ -158,6 +259,33 @@ func TestCreateAccessPoint(t *testing.T) {
 				mockCtl.Finish()
 			},
 		},
+		{
+			name: "Fail: Client token already used",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockEfs := mocks.NewMockEfs(mockCtl)
+				c := &cloud{efs: mockEfs}
+
+				req := &AccessPointOptions{
+					FileSystemId:   fsId,
+					Uid:            uid,
+					Gid:            gid,
+					DirectoryPerms: directoryPerms,
+					DirectoryPath:  directoryPath,
+				}
+
+				ctx := context.Background()
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).Return(nil,
+					&types.AccessPointAlreadyExists{
+						Message: aws.String("Access point already exists"),
+					})
+				_, err := c.CreateAccessPoint(ctx, clientToken, req)
+				if err != ErrAlreadyExists {
+					t.Fatalf("Failed. Expected: %v, Actual:%v", ErrAlreadyExists, err)
+				}
+				mockCtl.Finish()
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -165,6 +293,114 @@ func TestCreateAccessPoint(t *testing.T) {
 	}
 }
 
+func TestMarkAccessPointProvisioned(t *testing.T) {
+	accessPointId := "fsap-abcd1234xyz987"
+	testCases := []struct {
+		name      string
+		tagErr    error
+		expectErr error
+	}{
+		{
+			name: "Success",
+		},
+		{
+			name:      "Fail: Access point not found",
+			tagErr:    &types.AccessPointNotFound{Message: aws.String("Access point not found")},
+			expectErr: ErrNotFound,
+		},
+		{
+			name:      "Fail: Access Denied",
+			tagErr:    &smithy.GenericAPIError{Code: AccessDeniedException, Message: "Access Denied"},
+			expectErr: ErrAccessDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockEfs := mocks.NewMockEfs(mockCtl)
+			c := &cloud{efs: mockEfs}
+
+			ctx := context.Background()
+			mockEfs.EXPECT().TagResource(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *efs.TagResourceInput, _ ...func(*efs.Options)) (*efs.TagResourceOutput, error) {
+					if *input.ResourceId != accessPointId || len(input.Tags) != 1 ||
+						*input.Tags[0].Key != ProvisioningStateTagKey || *input.Tags[0].Value != ProvisioningStateProvisioned {
+						t.Fatalf("Unexpected tag input: %+v", input)
+					}
+					return &efs.TagResourceOutput{}, tc.tagErr
+				})
+			err := c.MarkAccessPointProvisioned(ctx, accessPointId)
+			if err != tc.expectErr {
+				t.Fatalf("Failed. Expected: %v, Actual:%v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestListPendingAccessPoints(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockEfs := mocks.NewMockEfs(mockCtl)
+	c := &cloud{efs: mockEfs}
+
+	pendingSince := "2024-01-02T03:04:05Z"
+	accessPoint := func(id, state string, tags ...string) types.AccessPointDescription {
+		ap := types.AccessPointDescription{
+			AccessPointId: aws.String(id),
+			FileSystemId:  aws.String("fs-abcd1234"),
+		}
+		if state != "" {
+			ap.Tags = []types.Tag{
+				{Key: aws.String(ProvisioningStateTagKey), Value: aws.String(state)},
+				{Key: aws.String(PendingSinceTagKey), Value: aws.String(pendingSince)},
+			}
+		}
+		for i := 0; i < len(tags); i += 2 {
+			ap.Tags = append(ap.Tags, types.Tag{Key: aws.String(tags[i]), Value: aws.String(tags[i+1])})
+		}
+		return ap
+	}
+	driverTags := []string{"efs.csi.aws.com/cluster", "true", ClusterIdTagKey, "cluster-a"}
+
+	ctx := context.Background()
+	gomock.InOrder(
+		mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(&efs.DescribeAccessPointsOutput{
+			AccessPoints: []types.AccessPointDescription{
+				accessPoint("fsap-pending", ProvisioningStatePending, driverTags...),
+				accessPoint("fsap-provisioned", ProvisioningStateProvisioned, driverTags...),
+				accessPoint("fsap-other-cluster", ProvisioningStatePending, "efs.csi.aws.com/cluster", "true", ClusterIdTagKey, "cluster-b"),
+				accessPoint("fsap-not-driver", ProvisioningStatePending, ClusterIdTagKey, "cluster-a"),
+				accessPoint("fsap-no-pending-since", "", append([]string{ProvisioningStateTagKey, ProvisioningStatePending, PendingSinceTagKey, "yesterday"}, driverTags...)...),
+			},
+			NextToken: aws.String("next"),
+		}, nil),
+		mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *efs.DescribeAccessPointsInput, _ ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error) {
+				if input.NextToken == nil || *input.NextToken != "next" {
+					t.Fatalf("Expected the next page to be requested, got %+v", input)
+				}
+				return &efs.DescribeAccessPointsOutput{
+					AccessPoints: []types.AccessPointDescription{
+						accessPoint("fsap-untagged", ""),
+					},
+				}, nil
+			}),
+	)
+
+	res, err := c.ListPendingAccessPoints(ctx, map[string]string{"efs.csi.aws.com/cluster": "true", ClusterIdTagKey: "cluster-a"})
+	if err != nil {
+		t.Fatalf("ListPendingAccessPoints failed: %v", err)
+	}
+	if len(res) != 1 || res[0].AccessPointId != "fsap-pending" {
+		t.Fatalf("Expected only fsap-pending to be pending, got %+v", res)
+	}
+	if res[0].PendingSince.Format(time.RFC3339) != pendingSince {
+		t.Fatalf("Expected pending since %v, got %v", pendingSince, res[0].PendingSince)
+	}
+}
+
 func TestDeleteAccessPoint(t *testing.T) {
 	var (
 		accessPointId = "fsap-abcd1234xyz987"
@@ -297,6 +533,9 @@ func TestDescribeAccessPoint(t *testing.T) {
 								},
 								Path: aws.String(directoryPath),
 							},
+							Tags: []types.Tag{
+								{Key: aws.String(CapacityTagKey), Value: aws.String("5368709120")},
+							},
 						},
 					},
 					NextToken: nil,
@@ -319,6 +558,9 @@ func TestDescribeAccessPoint(t *testing.T) {
 				if fsId != res.FileSystemId {
 					t.Fatalf("FileSystemId mismatched. Expected: %v, Actual: %v", fsId, res.FileSystemId)
 				}
+				if res.CapacityBytes != 5368709120 {
+					t.Fatalf("CapacityBytes mismatched. Expected: 5368709120, Actual: %v", res.CapacityBytes)
+				}
 				mockctl.Finish()
 			},
 		},
@@ -638,7 +880,8 @@ func TestListAccessPoints(t *testing.T) {
 		fsId                = "fs-abcd1234"
 		accessPointId       = "ap-abc123"
 		Gid           int64 = 1000
-		Uid           int64 = 1000
+		Uid           int64 = 2000
+		rootDir             = "/dynamic/pvc-1234"
 	)
 	testCases := []struct {
 		name     string
@@ -660,6 +903,7 @@ func TestListAccessPoints(t *testing.T) {
 								Gid: aws.Int64(Gid),
 								Uid: aws.Int64(Uid),
 							},
+							RootDirectory: &types.RootDirectory{Path: aws.String(rootDir)},
 						},
 					},
 					NextToken: nil,
@@ -680,6 +924,10 @@ func TestListAccessPoints(t *testing.T) {
 					t.Fatalf("Expected only one AccessPoint in response but got: %v", res)
 				}
 
+				if res[0].AccessPointRootDir != rootDir || res[0].PosixUser.Uid != Uid || res[0].PosixUser.Gid != Gid {
+					t.Fatalf("Unexpected AccessPoint in response: %+v, %+v", res[0], res[0].PosixUser)
+				}
+
 				mockctl.Finish()
 			},
 		},
@@ -756,6 +1004,65 @@ func TestListAccessPoints(t *testing.T) {
 	}
 }
 
+func TestListAccessPointsPages(t *testing.T) {
+	fsId := "fs-abcd1234"
+	page := func(nextToken *string, gids ...int64) *efs.DescribeAccessPointsOutput {
+		output := &efs.DescribeAccessPointsOutput{NextToken: nextToken}
+		for _, gid := range gids {
+			output.AccessPoints = append(output.AccessPoints, types.AccessPointDescription{
+				AccessPointId: aws.String(fmt.Sprintf("fsap-%d", gid)),
+				FileSystemId:  aws.String(fsId),
+				PosixUser:     &types.PosixUser{Gid: aws.Int64(gid), Uid: aws.Int64(gid)},
+			})
+		}
+		return output
+	}
+
+	t.Run("Success: all pages", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		mockEfs := mocks.NewMockEfs(mockCtl)
+		c := &cloud{efs: mockEfs}
+
+		ctx := context.Background()
+		gomock.InOrder(
+			mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(page(aws.String("token"), 1000, 1001), nil),
+			mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *efs.DescribeAccessPointsInput, _ ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error) {
+					if aws.ToString(input.NextToken) != "token" || aws.ToString(input.FileSystemId) != fsId {
+						t.Fatalf("Unexpected describe input: %+v", input)
+					}
+					return page(nil, 1002), nil
+				}),
+		)
+		res, err := c.ListAccessPoints(ctx, fsId)
+		if err != nil {
+			t.Fatalf("List Access Points failed: %v", err)
+		}
+		if len(res) != 3 {
+			t.Fatalf("Expected the access points of both pages, got %d", len(res))
+		}
+	})
+
+	t.Run("Success: stopped by the callback", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		mockEfs := mocks.NewMockEfs(mockCtl)
+		c := &cloud{efs: mockEfs}
+
+		ctx := context.Background()
+		mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(page(aws.String("token"), 1000), nil)
+		pages := 0
+		err := c.ListAccessPointsPages(ctx, fsId, func(accessPoints []*AccessPoint) bool {
+			pages++
+			return false
+		})
+		if err != nil || pages != 1 {
+			t.Fatalf("Expected a single page, got %d: %v", pages, err)
+		}
+	})
+}
+
 func TestDescribeFileSystem(t *testing.T) {
 	var (
 		fsId = "fs-abcd1234"
@@ -774,11 +1081,12 @@ func TestDescribeFileSystem(t *testing.T) {
 				output := &efs.DescribeFileSystemsOutput{
 					FileSystems: []types.FileSystemDescription{
 						{
-							CreationToken: aws.String("test"),
-							Encrypted:     aws.Bool(true),
-							FileSystemId:  aws.String(fsId),
-							Name:          aws.String("test"),
-							OwnerId:       aws.String("1234567890"),
+							CreationToken:  aws.String("test"),
+							Encrypted:      aws.Bool(true),
+							FileSystemId:   aws.String(fsId),
+							Name:           aws.String("test"),
+							OwnerId:        aws.String("1234567890"),
+							ThroughputMode: types.ThroughputModeBursting,
 						},
 					},
 				}
@@ -797,6 +1105,10 @@ func TestDescribeFileSystem(t *testing.T) {
 				if fsId != res.FileSystemId {
 					t.Fatalf("FileSystemId mismatched. Expected: %v, Actual: %v", fsId, res.FileSystemId)
 				}
+
+				if res.ThroughputMode != ThroughputModeBursting {
+					t.Fatalf("ThroughputMode mismatched. Expected: %v, Actual: %v", ThroughputModeBursting, res.ThroughputMode)
+				}
 				mockctl.Finish()
 			},
 		},
@@ -916,6 +1228,50 @@ func TestDescribeFileSystem(t *testing.T) {
 				mockctl.Finish()
 			},
 		},
+		{
+			name: "Fail: Describe timeout exceeded",
+			testFunc: func(t *testing.T) {
+				mockctl := gomock.NewController(t)
+				mockEfs := mocks.NewMockEfs(mockctl)
+				c := &cloud{efs: mockEfs, options: Options{DescribeTimeout: 10 * time.Millisecond}}
+
+				ctx := context.Background()
+				mockEfs.EXPECT().DescribeFileSystems(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, input *efs.DescribeFileSystemsInput, optFns ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error) {
+						if _, ok := ctx.Deadline(); !ok {
+							t.Fatalf("Expected context to have a deadline")
+						}
+						<-ctx.Done()
+						return nil, ctx.Err()
+					})
+				_, err := c.DescribeFileSystem(ctx, fsId)
+				if err != ErrDeadlineExceeded {
+					t.Fatalf("Failed. Expected: %v, Actual:%v", ErrDeadlineExceeded, err)
+				}
+				mockctl.Finish()
+			},
+		},
+		{
+			name: "Fail: CSI request deadline exceeded",
+			testFunc: func(t *testing.T) {
+				mockctl := gomock.NewController(t)
+				mockEfs := mocks.NewMockEfs(mockctl)
+				c := &cloud{efs: mockEfs, options: Options{DescribeTimeout: time.Hour}}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				mockEfs.EXPECT().DescribeFileSystems(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, input *efs.DescribeFileSystemsInput, optFns ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error) {
+						<-ctx.Done()
+						return nil, ctx.Err()
+					})
+				_, err := c.DescribeFileSystem(ctx, fsId)
+				if err != ErrDeadlineExceeded {
+					t.Fatalf("Failed. Expected: %v, Actual:%v", ErrDeadlineExceeded, err)
+				}
+				mockctl.Finish()
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, tc.testFunc)
@@ -1050,6 +1406,162 @@ func TestDescribeMountTargets(t *testing.T) {
 	}
 }
 
+func TestDescribeMountTargetsSelection(t *testing.T) {
+	fsId := "fs-abcd1234"
+	mountTarget := func(id, az, subnetId, ip string) types.MountTargetDescription {
+		return types.MountTargetDescription{
+			AvailabilityZoneId:   aws.String(az + "-id"),
+			AvailabilityZoneName: aws.String(az),
+			FileSystemId:         aws.String(fsId),
+			IpAddress:            aws.String(ip),
+			LifeCycleState:       types.LifeCycleStateAvailable,
+			MountTargetId:        aws.String(id),
+			SubnetId:             aws.String(subnetId),
+		}
+	}
+	mountTargets := []types.MountTargetDescription{
+		mountTarget("fsmt-1", "us-east-1b", "subnet-1", "10.0.2.9"),
+		mountTarget("fsmt-2", "us-east-1a", "subnet-2", "10.0.1.20"),
+		mountTarget("fsmt-3", "us-east-1a", "subnet-3", "10.0.1.3"),
+		mountTarget("fsmt-4", "us-east-1b", "subnet-4", "10.0.2.10"),
+	}
+
+	testCases := []struct {
+		name             string
+		az               string
+		preferredSubnets []string
+		expectedId       string
+	}{
+		{
+			name:       "lowest IP of the availability zone",
+			az:         "us-east-1a",
+			expectedId: "fsmt-3",
+		},
+		{
+			name:       "lowest IP without availability zone",
+			expectedId: "fsmt-3",
+		},
+		{
+			name:       "lowest IP of all when no mount target is in the availability zone",
+			az:         "us-east-1c",
+			expectedId: "fsmt-3",
+		},
+		{
+			name:             "preferred subnet of the availability zone",
+			az:               "us-east-1a",
+			preferredSubnets: []string{"subnet-4", "subnet-2"},
+			expectedId:       "fsmt-2",
+		},
+		{
+			name:             "first preferred subnet without availability zone",
+			preferredSubnets: []string{"subnet-4", "subnet-2"},
+			expectedId:       "fsmt-4",
+		},
+		{
+			name:             "lowest IP when the availability zone has no preferred subnet",
+			az:               "us-east-1b",
+			preferredSubnets: []string{"subnet-2"},
+			expectedId:       "fsmt-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockEfs := mocks.NewMockEfs(mockCtl)
+			c := &cloud{efs: mockEfs, options: Options{PreferredSubnetIds: tc.preferredSubnets}}
+
+			ctx := context.Background()
+			// The selection is the same every time
+			for i := 0; i < 3; i++ {
+				output := &efs.DescribeMountTargetsOutput{MountTargets: append([]types.MountTargetDescription{}, mountTargets...)}
+				mockEfs.EXPECT().DescribeMountTargets(gomock.Eq(ctx), gomock.Any()).Return(output, nil)
+				mt, err := c.DescribeMountTargets(ctx, fsId, tc.az)
+				if err != nil {
+					t.Fatalf("DescribeMountTargets failed: %v", err)
+				}
+				if mt.MountTargetId != tc.expectedId {
+					t.Fatalf("Expected mount target %v, got %v", tc.expectedId, mt.MountTargetId)
+				}
+			}
+		})
+	}
+}
+
+func TestListMountTargets(t *testing.T) {
+	var fsId = "fs-abcd1234"
+	mountTarget := func(az, ip string, state types.LifeCycleState) types.MountTargetDescription {
+		return types.MountTargetDescription{
+			AvailabilityZoneId:   aws.String(az + "-id"),
+			AvailabilityZoneName: aws.String(az),
+			FileSystemId:         aws.String(fsId),
+			IpAddress:            aws.String(ip),
+			LifeCycleState:       state,
+			MountTargetId:        aws.String("fsmt-" + az),
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		mockOutput  *efs.DescribeMountTargetsOutput
+		mockError   error
+		expectIPs   map[string]string
+		expectError errtyp
+	}{
+		{
+			name: "Success: only available mount targets are listed",
+			mockOutput: &efs.DescribeMountTargetsOutput{
+				MountTargets: []types.MountTargetDescription{
+					mountTarget("us-east-1a", "10.0.0.1", types.LifeCycleStateAvailable),
+					mountTarget("us-east-1b", "10.0.0.2", types.LifeCycleStateAvailable),
+					mountTarget("us-east-1c", "10.0.0.3", types.LifeCycleStateCreating),
+				},
+			},
+			expectIPs: map[string]string{"us-east-1a": "10.0.0.1", "us-east-1b": "10.0.0.2"},
+		},
+		{
+			name: "Fail: File System Not Found",
+			mockError: &types.FileSystemNotFound{
+				Message: aws.String("File System not found"),
+			},
+			expectError: errtyp{message: "Resource was not found"},
+		},
+		{
+			name: "Fail: Access Denied",
+			mockError: &smithy.GenericAPIError{
+				Code:    AccessDeniedException,
+				Message: "Access Denied",
+			},
+			expectError: errtyp{message: "Access denied"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockctl := gomock.NewController(t)
+			defer mockctl.Finish()
+			mockEfs := mocks.NewMockEfs(mockctl)
+			c := &cloud{efs: mockEfs}
+			ctx := context.Background()
+
+			mockEfs.EXPECT().DescribeMountTargets(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(tc.mockOutput, tc.mockError)
+
+			res, err := c.ListMountTargets(ctx, fsId)
+			testResult(t, "ListMountTargets", res, err, tc.expectError)
+			if tc.expectIPs != nil {
+				ips := map[string]string{}
+				for _, mt := range res {
+					ips[mt.AZName] = mt.IPAddress
+				}
+				if !reflect.DeepEqual(ips, tc.expectIPs) {
+					t.Fatalf("Expected mount targets %v, got %v", tc.expectIPs, ips)
+				}
+			}
+		})
+	}
+}
+
 func testResult(t *testing.T, funcName string, ret interface{}, err error, expectError errtyp) {
 	if expectError.message == "" {
 		if err != nil {
@@ -1069,6 +1581,203 @@ func testResult(t *testing.T, funcName string, ret interface{}, err error, expec
 	}
 }
 
+func TestTagResource(t *testing.T) {
+	resourceId := "fsap-abcd1234xyz987"
+	testCases := []struct {
+		name      string
+		tagErr    error
+		expectErr error
+	}{
+		{
+			name: "Success",
+		},
+		{
+			name:      "Fail: File system not found",
+			tagErr:    &types.FileSystemNotFound{Message: aws.String("File system not found")},
+			expectErr: ErrNotFound,
+		},
+		{
+			name:      "Fail: Access Denied",
+			tagErr:    &smithy.GenericAPIError{Code: AccessDeniedException, Message: "Access Denied"},
+			expectErr: ErrAccessDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockEfs := mocks.NewMockEfs(mockCtl)
+			c := &cloud{efs: mockEfs}
+
+			ctx := context.Background()
+			mockEfs.EXPECT().TagResource(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *efs.TagResourceInput, _ ...func(*efs.Options)) (*efs.TagResourceOutput, error) {
+					if *input.ResourceId != resourceId || len(input.Tags) != 1 || *input.Tags[0].Key != "key" || *input.Tags[0].Value != "value" {
+						t.Fatalf("Unexpected tag input: %+v", input)
+					}
+					return &efs.TagResourceOutput{}, tc.tagErr
+				})
+			err := c.TagResource(ctx, resourceId, map[string]string{"key": "value"})
+			if err != tc.expectErr {
+				t.Fatalf("Failed. Expected: %v, Actual:%v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestUntagResource(t *testing.T) {
+	resourceId := "fs-abcd1234"
+	testCases := []struct {
+		name      string
+		untagErr  error
+		expectErr error
+	}{
+		{
+			name: "Success",
+		},
+		{
+			name:      "Fail: Access point not found",
+			untagErr:  &types.AccessPointNotFound{Message: aws.String("Access point not found")},
+			expectErr: ErrNotFound,
+		},
+		{
+			name:      "Fail: Deadline exceeded",
+			untagErr:  context.DeadlineExceeded,
+			expectErr: ErrDeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockEfs := mocks.NewMockEfs(mockCtl)
+			c := &cloud{efs: mockEfs}
+
+			ctx := context.Background()
+			mockEfs.EXPECT().UntagResource(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *efs.UntagResourceInput, _ ...func(*efs.Options)) (*efs.UntagResourceOutput, error) {
+					if *input.ResourceId != resourceId || !reflect.DeepEqual(input.TagKeys, []string{"a", "b"}) {
+						t.Fatalf("Unexpected untag input: %+v", input)
+					}
+					return &efs.UntagResourceOutput{}, tc.untagErr
+				})
+			err := c.UntagResource(ctx, resourceId, []string{"a", "b"})
+			if err != tc.expectErr {
+				t.Fatalf("Failed. Expected: %v, Actual:%v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestDescribeTags(t *testing.T) {
+	resourceId := "fs-abcd1234"
+	tag := func(key, value string) types.Tag {
+		return types.Tag{Key: aws.String(key), Value: aws.String(value)}
+	}
+
+	t.Run("Success: paginated", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		mockEfs := mocks.NewMockEfs(mockCtl)
+		c := &cloud{efs: mockEfs}
+
+		ctx := context.Background()
+		gomock.InOrder(
+			mockEfs.EXPECT().ListTagsForResource(gomock.Eq(ctx), gomock.Any()).Return(&efs.ListTagsForResourceOutput{
+				Tags:      []types.Tag{tag("a", "1")},
+				NextToken: aws.String("token"),
+			}, nil),
+			mockEfs.EXPECT().ListTagsForResource(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *efs.ListTagsForResourceInput, _ ...func(*efs.Options)) (*efs.ListTagsForResourceOutput, error) {
+					if *input.ResourceId != resourceId || aws.ToString(input.NextToken) != "token" {
+						t.Fatalf("Unexpected list tags input: %+v", input)
+					}
+					return &efs.ListTagsForResourceOutput{Tags: []types.Tag{tag("b", "2")}}, nil
+				}),
+		)
+		tags, err := c.DescribeTags(ctx, resourceId)
+		if err != nil {
+			t.Fatalf("DescribeTags failed: %v", err)
+		}
+		if expected := map[string]string{"a": "1", "b": "2"}; !reflect.DeepEqual(tags, expected) {
+			t.Fatalf("Expected %v, got %v", expected, tags)
+		}
+	})
+
+	t.Run("Fail: Access Denied", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		mockEfs := mocks.NewMockEfs(mockCtl)
+		c := &cloud{efs: mockEfs}
+
+		ctx := context.Background()
+		mockEfs.EXPECT().ListTagsForResource(gomock.Eq(ctx), gomock.Any()).Return(nil,
+			&smithy.GenericAPIError{Code: AccessDeniedException, Message: "Access Denied"})
+		if _, err := c.DescribeTags(ctx, resourceId); err != ErrAccessDenied {
+			t.Fatalf("Expected %v, got %v", ErrAccessDenied, err)
+		}
+	})
+}
+
+func TestCheckAccess(t *testing.T) {
+	testCases := []struct {
+		name         string
+		fileSystemId string
+		efsErr       error
+		expectedErr  error
+	}{
+		{
+			name: "Success",
+		},
+		{
+			name:         "Success: file system described",
+			fileSystemId: "fs-abcd1234",
+		},
+		{
+			name:         "Fail: file system not found",
+			fileSystemId: "fs-abcd1234",
+			efsErr:       &types.FileSystemNotFound{Message: aws.String("File system 'fs-abcd1234' does not exist.")},
+			expectedErr:  ErrNotFound,
+		},
+		{
+			name:        "Fail: Access Denied",
+			efsErr:      &smithy.GenericAPIError{Code: AccessDeniedException, Message: "User is not authorized to perform: elasticfilesystem:DescribeFileSystems"},
+			expectedErr: ErrAccessDenied,
+		},
+		{
+			name:        "Fail: Denied by service control policy",
+			efsErr:      &smithy.GenericAPIError{Code: AccessDeniedException, Message: "User is not authorized to perform: elasticfilesystem:DescribeFileSystems with an explicit deny in a service control policy"},
+			expectedErr: ErrDeniedByPolicy,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockEfs := mocks.NewMockEfs(mockCtl)
+			c := &cloud{efs: mockEfs}
+
+			ctx := context.Background()
+			mockEfs.EXPECT().DescribeFileSystems(gomock.Eq(ctx), gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *efs.DescribeFileSystemsInput, _ ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error) {
+					if aws.ToString(input.FileSystemId) != tc.fileSystemId || aws.ToInt32(input.MaxItems) != 1 {
+						t.Fatalf("Unexpected describe file systems input: %+v", input)
+					}
+					if tc.efsErr != nil {
+						return nil, tc.efsErr
+					}
+					return &efs.DescribeFileSystemsOutput{}, nil
+				})
+			if err := c.CheckAccess(ctx, tc.fileSystemId); err != tc.expectedErr {
+				t.Fatalf("Expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
 func Test_findAccessPointByPath(t *testing.T) {
 	fsId := "testFsId"
 	clientToken := "testPvcName"
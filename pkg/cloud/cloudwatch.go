@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	cloudWatchService    = "monitoring"
+	cloudWatchSDKId      = "CloudWatch"
+	cloudWatchAPIVersion = "2010-08-01"
+
+	// burstCreditBalanceWindow is how far back the burst credit balance of a file system is looked up. EFS
+	// reports it every minute.
+	burstCreditBalanceWindow = 15 * time.Minute
+)
+
+// CloudWatch reads the metrics that EFS reports to CloudWatch. The region of the calls is the one of the
+// ARN of the file system.
+type CloudWatch interface {
+	// BurstCreditBalance returns the latest burst credit balance of the file system in bytes, and false if
+	// the file system reported none recently
+	BurstCreditBalance(ctx context.Context, fileSystemArn string) (float64, bool, error)
+}
+
+// cloudWatch calls the CloudWatch API with the default SDK config of the driver
+type cloudWatch struct {
+	api *awsAPI
+	// now returns the current time, to compute the window of the metrics
+	now func() time.Time
+}
+
+// NewCloudWatch returns a CloudWatch client using the default credentials of the driver
+func NewCloudWatch(options Options) (CloudWatch, error) {
+	api, err := newAWSAPI(options, cloudWatchService, cloudWatchSDKId)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudWatch{
+		api: api,
+		now: time.Now,
+	}, nil
+}
+
+type metricDatapoint struct {
+	Timestamp time.Time `xml:"Timestamp"`
+	Minimum   float64   `xml:"Minimum"`
+}
+
+type cloudWatchError struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+func (c *cloudWatch) BurstCreditBalance(ctx context.Context, fileSystemArn string) (float64, bool, error) {
+	region, err := arnRegion(fileSystemArn)
+	if err != nil {
+		return 0, false, err
+	}
+	fileSystemId := fileSystemArn[strings.LastIndex(fileSystemArn, "/")+1:]
+	end := c.now().UTC()
+	res := struct {
+		Datapoints []metricDatapoint `xml:"GetMetricStatisticsResult>Datapoints>member"`
+	}{}
+	err = c.call(ctx, "GetMetricStatistics", region, url.Values{
+		"Namespace":                 []string{"AWS/EFS"},
+		"MetricName":                []string{"BurstCreditBalance"},
+		"Dimensions.member.1.Name":  []string{"FileSystemId"},
+		"Dimensions.member.1.Value": []string{fileSystemId},
+		"StartTime":                 []string{end.Add(-burstCreditBalanceWindow).Format(time.RFC3339)},
+		"EndTime":                   []string{end.Format(time.RFC3339)},
+		"Period":                    []string{"60"},
+		"Statistics.member.1":       []string{"Minimum"},
+	}, &res)
+	if err != nil {
+		return 0, false, err
+	}
+	// The datapoints are not sorted
+	var latest *metricDatapoint
+	for i := range res.Datapoints {
+		if latest == nil || res.Datapoints[i].Timestamp.After(latest.Timestamp) {
+			latest = &res.Datapoints[i]
+		}
+	}
+	if latest == nil {
+		return 0, false, nil
+	}
+	return latest.Minimum, true, nil
+}
+
+// call sends the query of the action to the API of the region, and decodes the XML response into out
+func (c *cloudWatch) call(ctx context.Context, action, region string, params url.Values, out interface{}) error {
+	params.Set("Action", action)
+	params.Set("Version", cloudWatchAPIVersion)
+	content, err := c.api.call(ctx, &apiRequest{
+		operation: action,
+		method:    http.MethodPost,
+		region:    region,
+		path:      "/",
+		header:    http.Header{"Content-Type": []string{"application/x-www-form-urlencoded; charset=utf-8"}},
+		body:      []byte(params.Encode()),
+	}, decodeCloudWatchError)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("failed to parse %s response: %v", action, err)
+	}
+	return nil
+}
+
+// decodeCloudWatchError returns the error of a response of the CloudWatch API
+func decodeCloudWatchError(res *http.Response, content []byte) *apiError {
+	body := cloudWatchError{}
+	_ = xml.Unmarshal(content, &body)
+	return &apiError{
+		statusCode: res.StatusCode,
+		code:       body.Code,
+		message:    body.Message,
+	}
+}
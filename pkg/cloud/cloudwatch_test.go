@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+func newTestCloudWatch(t *testing.T, handler http.HandlerFunc) *cloudWatch {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "/us-gov-west-1/monitoring/aws4_request") {
+			t.Errorf("Request is not signed for CloudWatch in us-gov-west-1: %q", auth)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return &cloudWatch{
+		api: newTestAWSAPI(cloudWatchService, cloudWatchSDKId, server),
+		now: func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) },
+	}
+}
+
+func TestCloudWatchEndpoint(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL_CLOUDWATCH", "https://monitoring.example.com")
+	a := &awsAPI{service: cloudWatchService, sdkId: cloudWatchSDKId, configSources: []interface{}{config.EnvConfig{}}}
+	if endpoint, err := a.endpoint(context.Background(), "cn-north-1"); err != nil || endpoint != "https://monitoring.example.com" {
+		t.Fatalf("Unexpected endpoint %s: %v", endpoint, err)
+	}
+	if endpoint, err := regionEndpoint(cloudWatchService, "cn-north-1", false, false); err != nil || endpoint != "https://monitoring.cn-north-1.amazonaws.com.cn" {
+		t.Fatalf("Unexpected endpoint %s: %v", endpoint, err)
+	}
+}
+
+func TestBurstCreditBalance(t *testing.T) {
+	testCases := []struct {
+		name            string
+		status          int
+		response        string
+		expectedBalance float64
+		expectedFound   bool
+		expectedErr     error
+	}{
+		{
+			name: "Success: latest datapoint",
+			response: `<GetMetricStatisticsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <GetMetricStatisticsResult>
+    <Datapoints>
+      <member><Timestamp>2024-01-01T11:58:00Z</Timestamp><Minimum>2.0E12</Minimum><Unit>Bytes</Unit></member>
+      <member><Timestamp>2024-01-01T11:59:00Z</Timestamp><Minimum>1.5E12</Minimum><Unit>Bytes</Unit></member>
+      <member><Timestamp>2024-01-01T11:57:00Z</Timestamp><Minimum>3.0E12</Minimum><Unit>Bytes</Unit></member>
+    </Datapoints>
+    <Label>BurstCreditBalance</Label>
+  </GetMetricStatisticsResult>
+</GetMetricStatisticsResponse>`,
+			expectedBalance: 1.5e12,
+			expectedFound:   true,
+		},
+		{
+			name: "Success: no datapoint",
+			response: `<GetMetricStatisticsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <GetMetricStatisticsResult><Datapoints/><Label>BurstCreditBalance</Label></GetMetricStatisticsResult>
+</GetMetricStatisticsResponse>`,
+		},
+		{
+			name:        "Fail: access denied",
+			status:      http.StatusForbidden,
+			response:    `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`,
+			expectedErr: ErrAccessDenied,
+		},
+		{
+			name:        "Fail: throttled",
+			status:      http.StatusBadRequest,
+			response:    `<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error></ErrorResponse>`,
+			expectedErr: ErrThrottled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCloudWatch(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Fatal(err)
+				}
+				for key, expected := range map[string]string{
+					"Action":                    "GetMetricStatistics",
+					"Namespace":                 "AWS/EFS",
+					"MetricName":                "BurstCreditBalance",
+					"Dimensions.member.1.Value": "fs-abcd1234",
+					"StartTime":                 "2024-01-01T11:45:00Z",
+					"EndTime":                   "2024-01-01T12:00:00Z",
+				} {
+					if value := r.PostForm.Get(key); value != expected {
+						t.Errorf("Expected %s %q, got %q", key, expected, value)
+					}
+				}
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				_, _ = w.Write([]byte(tc.response))
+			})
+
+			balance, found, err := c.BurstCreditBalance(context.Background(), testFileSystemArn)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BurstCreditBalance failed: %v", err)
+			}
+			if balance != tc.expectedBalance || found != tc.expectedFound {
+				t.Fatalf("Expected balance %v found %v, got %v %v", tc.expectedBalance, tc.expectedFound, balance, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+)
+
+var errEfsDisabled = errors.New("the EFS API is not available to the node service")
+
+// disabledEfs is the EFS client of the cloud of the node service, which does not call the EFS API
+type disabledEfs struct{}
+
+func (disabledEfs) CreateAccessPoint(context.Context, *efs.CreateAccessPointInput, ...func(*efs.Options)) (*efs.CreateAccessPointOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) DeleteAccessPoint(context.Context, *efs.DeleteAccessPointInput, ...func(*efs.Options)) (*efs.DeleteAccessPointOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) DescribeAccessPoints(context.Context, *efs.DescribeAccessPointsInput, ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) DescribeFileSystems(context.Context, *efs.DescribeFileSystemsInput, ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) CreateFileSystem(context.Context, *efs.CreateFileSystemInput, ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) DeleteFileSystem(context.Context, *efs.DeleteFileSystemInput, ...func(*efs.Options)) (*efs.DeleteFileSystemOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) CreateMountTarget(context.Context, *efs.CreateMountTargetInput, ...func(*efs.Options)) (*efs.CreateMountTargetOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) DeleteMountTarget(context.Context, *efs.DeleteMountTargetInput, ...func(*efs.Options)) (*efs.DeleteMountTargetOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) DescribeMountTargets(context.Context, *efs.DescribeMountTargetsInput, ...func(*efs.Options)) (*efs.DescribeMountTargetsOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) TagResource(context.Context, *efs.TagResourceInput, ...func(*efs.Options)) (*efs.TagResourceOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) UntagResource(context.Context, *efs.UntagResourceInput, ...func(*efs.Options)) (*efs.UntagResourceOutput, error) {
+	return nil, errEfsDisabled
+}
+
+func (disabledEfs) ListTagsForResource(context.Context, *efs.ListTagsForResourceInput, ...func(*efs.Options)) (*efs.ListTagsForResourceOutput, error) {
+	return nil, errEfsDisabled
+}
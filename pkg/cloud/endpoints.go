@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const (
+	// EFSEndpointURLEnv is the environment variable of the endpoint of the EFS API of the AWS SDKs
+	EFSEndpointURLEnv = "AWS_ENDPOINT_URL_EFS"
+	// STSEndpointURLEnv is the environment variable of the endpoint of the STS API of the AWS SDKs
+	STSEndpointURLEnv = "AWS_ENDPOINT_URL_STS"
+)
+
+// IsEndpointURL returns whether the value is the http or https URL of an API endpoint
+func IsEndpointURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// efsEndpoint returns the endpoint of the EFS API of the config, or else the one of the options for the
+// configs in the region of the instance, or an empty string for the endpoint of the region. The endpoint of the
+// options is the one of the region of the instance, e.g. an interface VPC endpoint, which cannot serve the volumes
+// of the other regions.
+func efsEndpoint(apiConfig APIConfig, options Options, instanceRegion string) string {
+	if apiConfig.Endpoint != "" {
+		return apiConfig.Endpoint
+	}
+	if apiConfig.Region != "" && apiConfig.Region != instanceRegion {
+		return ""
+	}
+	return options.EFSEndpoint
+}
+
+// stsEndpoint sets the endpoint of the STS API of the options, if any, on the STS client
+func (options Options) stsEndpoint(o *sts.Options) {
+	if options.STSEndpoint != "" {
+		o.BaseEndpoint = aws.String(options.STSEndpoint)
+	}
+}
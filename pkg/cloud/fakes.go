@@ -2,6 +2,7 @@ package cloud
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"math/rand"
 	"time"
@@ -12,6 +13,7 @@ type FakeCloudProvider struct {
 	fileSystems  map[string]*FileSystem
 	accessPoints map[string]*AccessPoint
 	mountTargets map[string]*MountTarget
+	tags         map[string]map[string]string
 }
 
 func NewFakeCloudProvider() *FakeCloudProvider {
@@ -20,6 +22,7 @@ func NewFakeCloudProvider() *FakeCloudProvider {
 		fileSystems:  make(map[string]*FileSystem),
 		accessPoints: make(map[string]*AccessPoint),
 		mountTargets: make(map[string]*MountTarget),
+		tags:         make(map[string]map[string]string),
 	}
 }
 
@@ -43,12 +46,24 @@ func (c *FakeCloudProvider) CreateAccessPoint(ctx context.Context, clientToken s
 		AccessPointId: apId,
 		FileSystemId:  fsId,
 		CapacityGiB:   accessPointOpts.CapacityGiB,
+		Pending:       true,
+		PendingSince:  time.Now(),
 	}
 
 	c.accessPoints[clientToken] = ap
 	return ap, nil
 }
 
+func (c *FakeCloudProvider) MarkAccessPointProvisioned(ctx context.Context, accessPointId string) (err error) {
+	for _, ap := range c.accessPoints {
+		if ap.AccessPointId == accessPointId {
+			ap.Pending = false
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
 func (c *FakeCloudProvider) DeleteAccessPoint(ctx context.Context, accessPointId string) (err error) {
 	for name, ap := range c.accessPoints {
 		if ap.AccessPointId == accessPointId {
@@ -90,6 +105,46 @@ func (c *FakeCloudProvider) DescribeFileSystem(ctx context.Context, fileSystemId
 	return fs, nil
 }
 
+func (c *FakeCloudProvider) CreateFileSystem(ctx context.Context, creationToken string, fileSystemOpts *FileSystemOptions) (*FileSystem, error) {
+	fsId := fmt.Sprintf("fs-%x", sha256.Sum256([]byte(creationToken)))[:11]
+	if fs, ok := c.fileSystems[fsId]; ok {
+		return fs, nil
+	}
+	fs := &FileSystem{
+		FileSystemId:   fsId,
+		LifeCycleState: FileSystemStateAvailable,
+	}
+	c.fileSystems[fsId] = fs
+	c.tags[fsId] = map[string]string{ProvisionedFileSystemTagKey: creationToken}
+	for k, v := range fileSystemOpts.Tags {
+		c.tags[fsId][k] = v
+	}
+	return fs, nil
+}
+
+func (c *FakeCloudProvider) EnsureMountTargets(ctx context.Context, fileSystemId string, subnetIds, securityGroupIds []string) (bool, error) {
+	if _, ok := c.fileSystems[fileSystemId]; !ok {
+		return false, ErrNotFound
+	}
+	c.mountTargets[fileSystemId] = &MountTarget{
+		AZName:        "us-east-1a",
+		AZId:          "mock-AZ-id",
+		MountTargetId: "fsmt-abcd1234",
+		IPAddress:     "127.0.0.1",
+	}
+	return true, nil
+}
+
+func (c *FakeCloudProvider) DeleteFileSystem(ctx context.Context, fileSystemId string) error {
+	if _, ok := c.fileSystems[fileSystemId]; !ok {
+		return ErrNotFound
+	}
+	delete(c.fileSystems, fileSystemId)
+	delete(c.mountTargets, fileSystemId)
+	delete(c.tags, fileSystemId)
+	return nil
+}
+
 func (c *FakeCloudProvider) DescribeMountTargets(ctx context.Context, fileSystemId, az string) (mountTarget *MountTarget, err error) {
 	if mt, ok := c.mountTargets[fileSystemId]; ok {
 		return mt, nil
@@ -112,3 +167,58 @@ func (c *FakeCloudProvider) ListAccessPoints(ctx context.Context, fileSystemId s
 	}
 	return accessPoints, nil
 }
+
+func (c *FakeCloudProvider) ListAccessPointsPages(ctx context.Context, fileSystemId string, fn func(accessPoints []*AccessPoint) bool) error {
+	accessPoints, err := c.ListAccessPoints(ctx, fileSystemId)
+	if err != nil {
+		return err
+	}
+	fn(accessPoints)
+	return nil
+}
+
+func (c *FakeCloudProvider) ListPendingAccessPoints(ctx context.Context, tags map[string]string) ([]*AccessPoint, error) {
+	var accessPoints []*AccessPoint
+	for _, ap := range c.accessPoints {
+		if ap.Pending && hasTags(ap, tags) {
+			accessPoints = append(accessPoints, ap)
+		}
+	}
+	return accessPoints, nil
+}
+
+func (c *FakeCloudProvider) ListMountTargets(ctx context.Context, fileSystemId string) ([]*MountTarget, error) {
+	if mt, ok := c.mountTargets[fileSystemId]; ok {
+		return []*MountTarget{mt}, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (c *FakeCloudProvider) TagResource(ctx context.Context, resourceId string, tags map[string]string) error {
+	if _, ok := c.tags[resourceId]; !ok {
+		c.tags[resourceId] = map[string]string{}
+	}
+	for k, v := range tags {
+		c.tags[resourceId][k] = v
+	}
+	return nil
+}
+
+func (c *FakeCloudProvider) UntagResource(ctx context.Context, resourceId string, tagKeys []string) error {
+	for _, k := range tagKeys {
+		delete(c.tags[resourceId], k)
+	}
+	return nil
+}
+
+func (c *FakeCloudProvider) DescribeTags(ctx context.Context, resourceId string) (map[string]string, error) {
+	tags := map[string]string{}
+	for k, v := range c.tags[resourceId] {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (c *FakeCloudProvider) CheckAccess(ctx context.Context, fileSystemId string) error {
+	return nil
+}
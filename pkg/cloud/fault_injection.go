@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// FaultInjectionEnv is the environment variable holding the fault injection rules if the flag is not set
+	FaultInjectionEnv = "EFS_CSI_FAULT_INJECTION"
+
+	faultThrottle = "throttle"
+	faultLatency  = "latency"
+	faultNotFound = "notfound"
+
+	faultInjectionMiddlewareID = "EFSCSIFaultInjection"
+	throttlingExceptionCode    = "ThrottlingException"
+)
+
+// faultRule injects a fault into the calls of an EFS API operation, or of every operation if "*"
+type faultRule struct {
+	operation   string
+	fault       string
+	latency     time.Duration
+	probability float64
+}
+
+// FaultInjector injects throttling, latency and not found errors into the EFS API calls, to exercise the
+// retries and error handling of the driver without touching AWS. The faults are injected after the retry
+// middleware of the SDK, so that every attempt of a call may fail and injected throttling is retried
+// with backoff like real throttling.
+type FaultInjector struct {
+	rules []faultRule
+	rand  func() float64
+}
+
+// ParseFaultInjector parses comma separated rules of the form <operation>:<fault>[@<probability>], e.g.
+// "DescribeAccessPoints:throttle@0.5,CreateAccessPoint:latency=2s,DeleteAccessPoint:notfound". The
+// operation is the name of an EFS API operation or * for all of them, the fault one of throttle,
+// latency=<duration> or notfound, and the probability defaults to 1. It returns nil if spec is empty.
+func ParseFaultInjector(spec string) (*FaultInjector, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	injector := &FaultInjector{rand: rand.Float64}
+	for _, r := range strings.Split(spec, ",") {
+		rule, err := parseFaultRule(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault injection rule %q: %v", r, err)
+		}
+		injector.rules = append(injector.rules, rule)
+	}
+	return injector, nil
+}
+
+func parseFaultRule(r string) (faultRule, error) {
+	rule := faultRule{probability: 1}
+	operation, fault, ok := strings.Cut(r, ":")
+	if !ok || operation == "" {
+		return rule, fmt.Errorf("must be of the form <operation>:<fault>[@<probability>]")
+	}
+	rule.operation = operation
+	rule.fault = fault
+	if fault, probability, ok := strings.Cut(fault, "@"); ok {
+		p, err := strconv.ParseFloat(probability, 64)
+		if err != nil || p < 0 || p > 1 {
+			return rule, fmt.Errorf("probability %q must be between 0 and 1", probability)
+		}
+		rule.fault = fault
+		rule.probability = p
+	}
+	switch {
+	case rule.fault == faultThrottle, rule.fault == faultNotFound:
+	case strings.HasPrefix(rule.fault, faultLatency+"="):
+		latency, err := time.ParseDuration(strings.TrimPrefix(rule.fault, faultLatency+"="))
+		if err != nil {
+			return rule, fmt.Errorf("invalid latency: %v", err)
+		}
+		rule.fault = faultLatency
+		rule.latency = latency
+	default:
+		return rule, fmt.Errorf("fault %q must be one of %s, %s=<duration> or %s", rule.fault, faultThrottle, faultLatency, faultNotFound)
+	}
+	return rule, nil
+}
+
+// addMiddleware is the API option adding the fault injection to the middleware stack of the EFS client
+func (f *FaultInjector) addMiddleware(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(faultInjectionMiddlewareID, f.handleFinalize), "Retry", middleware.After)
+}
+
+func (f *FaultInjector) handleFinalize(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	if err := f.inject(ctx, awsmiddleware.GetOperationName(ctx)); err != nil {
+		return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+	}
+	return next.HandleFinalize(ctx, in)
+}
+
+// inject applies the faults of the rules matching the operation in order. A latency fault delays the
+// call and lets the next rules apply, the other faults fail it.
+func (f *FaultInjector) inject(ctx context.Context, operation string) error {
+	for _, rule := range f.rules {
+		if rule.operation != "*" && rule.operation != operation {
+			continue
+		}
+		if f.rand() >= rule.probability {
+			continue
+		}
+		klog.V(4).Infof("Injecting %s fault into %s", rule.fault, operation)
+		switch rule.fault {
+		case faultLatency:
+			select {
+			case <-time.After(rule.latency):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case faultThrottle:
+			return &smithy.GenericAPIError{Code: throttlingExceptionCode, Message: "Rate exceeded (injected fault)", Fault: smithy.FaultClient}
+		case faultNotFound:
+			return notFoundFault(operation)
+		}
+	}
+	return nil
+}
+
+// notFoundFault returns the not found error of the resource of the operation
+func notFoundFault(operation string) error {
+	message := "injected fault"
+	if strings.Contains(operation, "AccessPoint") && operation != "CreateAccessPoint" {
+		return &types.AccessPointNotFound{Message: &message}
+	}
+	return &types.FileSystemNotFound{Message: &message}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestParseFaultInjector(t *testing.T) {
+	testCases := []struct {
+		spec      string
+		rules     []faultRule
+		expectErr bool
+	}{
+		{spec: ""},
+		{
+			spec: "DescribeAccessPoints:throttle@0.5, CreateAccessPoint:latency=2s,*:notfound",
+			rules: []faultRule{
+				{operation: "DescribeAccessPoints", fault: faultThrottle, probability: 0.5},
+				{operation: "CreateAccessPoint", fault: faultLatency, latency: 2 * time.Second, probability: 1},
+				{operation: "*", fault: faultNotFound, probability: 1},
+			},
+		},
+		{spec: "throttle", expectErr: true},
+		{spec: "DescribeFileSystems:explode", expectErr: true},
+		{spec: "DescribeFileSystems:latency=soon", expectErr: true},
+		{spec: "DescribeFileSystems:throttle@2", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			injector, err := ParseFaultInjector(tc.spec)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.rules == nil {
+				if injector != nil {
+					t.Fatalf("Expected no injector, got %+v", injector)
+				}
+				return
+			}
+			if len(injector.rules) != len(tc.rules) {
+				t.Fatalf("Expected rules %+v, got %+v", tc.rules, injector.rules)
+			}
+			for i := range tc.rules {
+				if injector.rules[i] != tc.rules[i] {
+					t.Fatalf("Expected rule %+v, got %+v", tc.rules[i], injector.rules[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFaultInjectorInject(t *testing.T) {
+	injector, err := ParseFaultInjector("DescribeFileSystems:throttle@0.5,DeleteAccessPoint:notfound,DescribeMountTargets:notfound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	injector.rand = func() float64 { return 0.7 }
+	if err := injector.inject(ctx, "DescribeFileSystems"); err != nil {
+		t.Fatalf("Expected no fault above the probability, got %v", err)
+	}
+	injector.rand = func() float64 { return 0.2 }
+	var apiErr smithy.APIError
+	if err := injector.inject(ctx, "DescribeFileSystems"); !errors.As(err, &apiErr) || apiErr.ErrorCode() != throttlingExceptionCode {
+		t.Fatalf("Expected throttling, got %v", err)
+	}
+	if err := injector.inject(ctx, "DeleteAccessPoint"); !isAccessPointNotFound(err) {
+		t.Fatalf("Expected AccessPointNotFound, got %v", err)
+	}
+	if err := injector.inject(ctx, "DescribeMountTargets"); !isFileSystemNotFound(err) {
+		t.Fatalf("Expected FileSystemNotFound, got %v", err)
+	}
+	if err := injector.inject(ctx, "CreateAccessPoint"); err != nil {
+		t.Fatalf("Expected no fault, got %v", err)
+	}
+
+	latency, _ := ParseFaultInjector("*:latency=1h")
+	latency.rand = func() float64 { return 0 }
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := latency.inject(ctx, "DescribeFileSystems"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the latency to be bound by the context, got %v", err)
+	}
+}
+
+func TestFaultInjectorRetried(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"FileSystems":[]}`))
+	}))
+	defer server.Close()
+
+	injector, err := ParseFaultInjector("DescribeFileSystems:throttle@0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Throttle the first attempt only
+	attempts := 0
+	injector.rand = func() float64 {
+		attempts++
+		if attempts == 1 {
+			return 0
+		}
+		return 1
+	}
+
+	client := efs.New(efs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		HTTPClient:   server.Client(),
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+		APIOptions: []func(*middleware.Stack) error{injector.addMiddleware},
+	})
+	if _, err := client.DescribeFileSystems(context.Background(), &efs.DescribeFileSystemsInput{}); err != nil {
+		t.Fatalf("Expected the injected throttling to be retried, got %v", err)
+	}
+	if attempts != 2 || requests != 1 {
+		t.Fatalf("Expected 2 attempts and 1 request, got %d attempts and %d requests", attempts, requests)
+	}
+}
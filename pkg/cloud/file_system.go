@@ -0,0 +1,268 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ProvisionedFileSystemTagKey marks the file systems created by the driver for a volume, and records the
+	// name of the volume. A file system without it is never deleted by the driver.
+	ProvisionedFileSystemTagKey = "efs.csi.aws.com/provisioned-volume"
+
+	FileSystemStateAvailable = string(types.LifeCycleStateAvailable)
+
+	// ThroughputModeBursting is the throughput mode of the file systems whose throughput is limited by their
+	// burst credits
+	ThroughputModeBursting = string(types.ThroughputModeBursting)
+)
+
+var (
+	// ErrFileSystemInUse is returned by DeleteFileSystem while the mount targets of the file system are deleted
+	ErrFileSystemInUse = errors.New("File system in use")
+	// ErrFileSystemLimitExceeded is returned when the account has the maximum number of file systems
+	ErrFileSystemLimitExceeded = errors.New("File system limit exceeded")
+)
+
+// FileSystemOptions are the options of the file systems created by CreateFileSystem. The empty options are
+// the defaults of EFS.
+type FileSystemOptions struct {
+	ThroughputMode string
+	// ProvisionedThroughputInMibps is only set with the provisioned throughput mode
+	ProvisionedThroughputInMibps float64
+	PerformanceMode              string
+	Encrypted                    bool
+	// KmsKeyId is the key encrypting the file system, the AWS managed key of EFS if empty
+	KmsKeyId string
+	Tags     map[string]string
+}
+
+func (c *cloud) CreateFileSystem(ctx context.Context, creationToken string, fileSystemOpts *FileSystemOptions) (fileSystem *FileSystem, err error) {
+	tags := map[string]string{ProvisionedFileSystemTagKey: creationToken}
+	for k, v := range fileSystemOpts.Tags {
+		tags[k] = v
+	}
+	createFsInput := &efs.CreateFileSystemInput{
+		CreationToken:   &creationToken,
+		Encrypted:       aws.Bool(fileSystemOpts.Encrypted),
+		PerformanceMode: types.PerformanceMode(fileSystemOpts.PerformanceMode),
+		ThroughputMode:  types.ThroughputMode(fileSystemOpts.ThroughputMode),
+		Tags:            parseEfsTags(tags),
+	}
+	if fileSystemOpts.KmsKeyId != "" {
+		createFsInput.KmsKeyId = &fileSystemOpts.KmsKeyId
+	}
+	if fileSystemOpts.ProvisionedThroughputInMibps > 0 {
+		createFsInput.ProvisionedThroughputInMibps = &fileSystemOpts.ProvisionedThroughputInMibps
+	}
+
+	klog.V(5).Infof("Calling CreateFileSystem with input: %+v", *createFsInput)
+	createCtx, cancel := withTimeout(ctx, c.options.CreateTimeout)
+	defer cancel()
+	res, err := c.efs.CreateFileSystem(createCtx, createFsInput)
+	if err != nil {
+		if isAccessDenied(err) {
+			return nil, ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
+		// The file system of the creation token was created by a previous call
+		if isFileSystemAlreadyExists(err) {
+			return c.describeFileSystemOfCreationToken(ctx, creationToken)
+		}
+		if isFileSystemLimitExceeded(err) {
+			return nil, ErrFileSystemLimitExceeded
+		}
+		if isThrottled(err) {
+			return nil, fmt.Errorf("%w: Failed to create file system: %v", ErrThrottled, err)
+		}
+		return nil, fmt.Errorf("Failed to create file system: %v", err)
+	}
+	klog.V(5).Infof("Create FS response : %+v", res)
+	return &FileSystem{
+		FileSystemId:   *res.FileSystemId,
+		LifeCycleState: string(res.LifeCycleState),
+	}, nil
+}
+
+func (c *cloud) describeFileSystemOfCreationToken(ctx context.Context, creationToken string) (*FileSystem, error) {
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	res, err := c.efs.DescribeFileSystems(ctx, &efs.DescribeFileSystemsInput{CreationToken: &creationToken})
+	if err != nil {
+		if isAccessDenied(err) {
+			return nil, ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
+		return nil, fmt.Errorf("Describe File System of creation token %v failed: %v", creationToken, err)
+	}
+	if len(res.FileSystems) != 1 {
+		return nil, fmt.Errorf("Expected exactly 1 file system of creation token %v, received %d file systems", creationToken, len(res.FileSystems))
+	}
+	return &FileSystem{
+		FileSystemId:   *res.FileSystems[0].FileSystemId,
+		LifeCycleState: string(res.FileSystems[0].LifeCycleState),
+	}, nil
+}
+
+func (c *cloud) EnsureMountTargets(ctx context.Context, fileSystemId string, subnetIds, securityGroupIds []string) (available bool, err error) {
+	mountTargets, err := c.describeAllMountTargets(ctx, fileSystemId)
+	if err != nil {
+		return false, err
+	}
+	available = true
+	for _, subnetId := range subnetIds {
+		var mountTarget *types.MountTargetDescription
+		for i := range mountTargets {
+			if aws.ToString(mountTargets[i].SubnetId) == subnetId {
+				mountTarget = &mountTargets[i]
+				break
+			}
+		}
+		if mountTarget != nil {
+			if mountTarget.LifeCycleState != types.LifeCycleStateAvailable {
+				available = false
+			}
+			continue
+		}
+
+		available = false
+		createMtInput := &efs.CreateMountTargetInput{
+			FileSystemId:   &fileSystemId,
+			SubnetId:       aws.String(subnetId),
+			SecurityGroups: securityGroupIds,
+		}
+		klog.V(5).Infof("Calling CreateMountTarget with input: %+v", *createMtInput)
+		createCtx, cancel := withTimeout(ctx, c.options.CreateTimeout)
+		res, err := c.efs.CreateMountTarget(createCtx, createMtInput)
+		cancel()
+		if err != nil {
+			if isAccessDenied(err) {
+				return false, ErrAccessDenied
+			}
+			if isDeadlineExceeded(err) {
+				return false, ErrDeadlineExceeded
+			}
+			if isThrottled(err) {
+				return false, fmt.Errorf("%w: Failed to create mount target in subnet %v: %v", ErrThrottled, subnetId, err)
+			}
+			return false, fmt.Errorf("Failed to create mount target of file system %v in subnet %v: %v", fileSystemId, subnetId, err)
+		}
+		klog.V(4).Infof("Created mount target %v of file system %v in subnet %v", aws.ToString(res.MountTargetId), fileSystemId, subnetId)
+	}
+	return available, nil
+}
+
+func (c *cloud) DeleteFileSystem(ctx context.Context, fileSystemId string) (err error) {
+	mountTargets, err := c.describeAllMountTargets(ctx, fileSystemId)
+	if err != nil {
+		return err
+	}
+	for _, mt := range mountTargets {
+		if mt.LifeCycleState == types.LifeCycleStateDeleting || mt.LifeCycleState == types.LifeCycleStateDeleted {
+			continue
+		}
+		deleteCtx, cancel := withTimeout(ctx, c.options.DeleteTimeout)
+		_, err := c.efs.DeleteMountTarget(deleteCtx, &efs.DeleteMountTargetInput{MountTargetId: mt.MountTargetId})
+		cancel()
+		if err != nil && !isMountTargetNotFound(err) {
+			if isAccessDenied(err) {
+				return ErrAccessDenied
+			}
+			if isDeadlineExceeded(err) {
+				return ErrDeadlineExceeded
+			}
+			return fmt.Errorf("Failed to delete mount target %v of file system %v: %v", aws.ToString(mt.MountTargetId), fileSystemId, err)
+		}
+		klog.V(4).Infof("Deleting mount target %v of file system %v", aws.ToString(mt.MountTargetId), fileSystemId)
+	}
+	// The file system cannot be deleted until its mount targets are
+	if len(mountTargets) > 0 {
+		return ErrFileSystemInUse
+	}
+
+	ctx, cancel := withTimeout(ctx, c.options.DeleteTimeout)
+	defer cancel()
+	_, err = c.efs.DeleteFileSystem(ctx, &efs.DeleteFileSystemInput{FileSystemId: &fileSystemId})
+	if err != nil {
+		if isAccessDenied(err) {
+			return ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return ErrDeadlineExceeded
+		}
+		if isFileSystemNotFound(err) {
+			return ErrNotFound
+		}
+		if isFileSystemInUse(err) {
+			return ErrFileSystemInUse
+		}
+		return fmt.Errorf("Failed to delete file system %v: %v", fileSystemId, err)
+	}
+	return nil
+}
+
+// describeAllMountTargets describes the mount targets of the file system in any state
+func (c *cloud) describeAllMountTargets(ctx context.Context, fileSystemId string) ([]types.MountTargetDescription, error) {
+	ctx, cancel := withTimeout(ctx, c.options.DescribeTimeout)
+	defer cancel()
+	res, err := c.efs.DescribeMountTargets(ctx, &efs.DescribeMountTargetsInput{FileSystemId: &fileSystemId})
+	if err != nil {
+		if isAccessDenied(err) {
+			return nil, ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return nil, ErrDeadlineExceeded
+		}
+		if isFileSystemNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("Describe Mount Targets failed: %v", err)
+	}
+	return res.MountTargets, nil
+}
+
+func isFileSystemAlreadyExists(err error) bool {
+	var fileSystemAlreadyExistsErr *types.FileSystemAlreadyExists
+	return errors.As(err, &fileSystemAlreadyExistsErr)
+}
+
+func isFileSystemLimitExceeded(err error) bool {
+	var fileSystemLimitExceededErr *types.FileSystemLimitExceeded
+	return errors.As(err, &fileSystemLimitExceededErr)
+}
+
+func isFileSystemInUse(err error) bool {
+	var fileSystemInUseErr *types.FileSystemInUse
+	return errors.As(err, &fileSystemInUseErr)
+}
+
+func isMountTargetNotFound(err error) bool {
+	var mountTargetNotFoundErr *types.MountTargetNotFound
+	return errors.As(err, &mountTargetNotFoundErr)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
+)
+
+func TestCreateFileSystem(t *testing.T) {
+	fsId := "fs-abcd1234"
+	volName := "pvc-1234"
+	options := &FileSystemOptions{
+		ThroughputMode:               "provisioned",
+		ProvisionedThroughputInMibps: 64,
+		PerformanceMode:              "generalPurpose",
+		Encrypted:                    true,
+		KmsKeyId:                     "alias/efs",
+		Tags:                         map[string]string{"cluster": "test"},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockctl := gomock.NewController(t)
+		defer mockctl.Finish()
+		mockEfs := mocks.NewMockEfs(mockctl)
+		c := &cloud{efs: mockEfs}
+
+		ctx := context.Background()
+		mockEfs.EXPECT().CreateFileSystem(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *efs.CreateFileSystemInput, _ ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error) {
+				if aws.ToString(input.CreationToken) != volName || !aws.ToBool(input.Encrypted) || aws.ToString(input.KmsKeyId) != "alias/efs" ||
+					input.ThroughputMode != types.ThroughputModeProvisioned || aws.ToFloat64(input.ProvisionedThroughputInMibps) != 64 {
+					t.Fatalf("Unexpected CreateFileSystem input %+v", input)
+				}
+				tags := map[string]string{}
+				for _, tag := range input.Tags {
+					tags[*tag.Key] = *tag.Value
+				}
+				if tags[ProvisionedFileSystemTagKey] != volName || tags["cluster"] != "test" {
+					t.Fatalf("Unexpected tags %v", tags)
+				}
+				return &efs.CreateFileSystemOutput{FileSystemId: aws.String(fsId), LifeCycleState: types.LifeCycleStateCreating}, nil
+			})
+		fs, err := c.CreateFileSystem(ctx, volName, options)
+		if err != nil {
+			t.Fatalf("CreateFileSystem failed: %v", err)
+		}
+		if fs.FileSystemId != fsId || fs.LifeCycleState != "creating" {
+			t.Fatalf("Unexpected file system %+v", fs)
+		}
+	})
+
+	t.Run("Success: already created with the creation token", func(t *testing.T) {
+		mockctl := gomock.NewController(t)
+		defer mockctl.Finish()
+		mockEfs := mocks.NewMockEfs(mockctl)
+		c := &cloud{efs: mockEfs}
+
+		ctx := context.Background()
+		mockEfs.EXPECT().CreateFileSystem(gomock.Any(), gomock.Any()).Return(nil, &types.FileSystemAlreadyExists{FileSystemId: aws.String(fsId)})
+		mockEfs.EXPECT().DescribeFileSystems(gomock.Any(), &efs.DescribeFileSystemsInput{CreationToken: aws.String(volName)}).Return(
+			&efs.DescribeFileSystemsOutput{FileSystems: []types.FileSystemDescription{{FileSystemId: aws.String(fsId), LifeCycleState: types.LifeCycleStateAvailable}}}, nil)
+		fs, err := c.CreateFileSystem(ctx, volName, options)
+		if err != nil {
+			t.Fatalf("CreateFileSystem failed: %v", err)
+		}
+		if fs.FileSystemId != fsId || fs.LifeCycleState != FileSystemStateAvailable {
+			t.Fatalf("Unexpected file system %+v", fs)
+		}
+	})
+
+	t.Run("Fail: file system limit exceeded", func(t *testing.T) {
+		mockctl := gomock.NewController(t)
+		defer mockctl.Finish()
+		mockEfs := mocks.NewMockEfs(mockctl)
+		c := &cloud{efs: mockEfs}
+
+		mockEfs.EXPECT().CreateFileSystem(gomock.Any(), gomock.Any()).Return(nil, &types.FileSystemLimitExceeded{})
+		if _, err := c.CreateFileSystem(context.Background(), volName, options); err != ErrFileSystemLimitExceeded {
+			t.Fatalf("Expected ErrFileSystemLimitExceeded, got %v", err)
+		}
+	})
+}
+
+func TestEnsureMountTargets(t *testing.T) {
+	fsId := "fs-abcd1234"
+	mountTarget := func(subnetId string, state types.LifeCycleState) types.MountTargetDescription {
+		return types.MountTargetDescription{MountTargetId: aws.String("fsmt-" + subnetId), SubnetId: aws.String(subnetId), LifeCycleState: state}
+	}
+	testCases := []struct {
+		name              string
+		mountTargets      []types.MountTargetDescription
+		expectedCreated   []string
+		expectedAvailable bool
+	}{
+		{
+			name:            "mount targets created in all the subnets",
+			expectedCreated: []string{"subnet-a", "subnet-b"},
+		},
+		{
+			name:            "mount target created in the missing subnet",
+			mountTargets:    []types.MountTargetDescription{mountTarget("subnet-a", types.LifeCycleStateAvailable)},
+			expectedCreated: []string{"subnet-b"},
+		},
+		{
+			name:         "mount targets being created",
+			mountTargets: []types.MountTargetDescription{mountTarget("subnet-a", types.LifeCycleStateAvailable), mountTarget("subnet-b", types.LifeCycleStateCreating)},
+		},
+		{
+			name:              "mount targets available",
+			mountTargets:      []types.MountTargetDescription{mountTarget("subnet-a", types.LifeCycleStateAvailable), mountTarget("subnet-b", types.LifeCycleStateAvailable)},
+			expectedAvailable: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockctl := gomock.NewController(t)
+			defer mockctl.Finish()
+			mockEfs := mocks.NewMockEfs(mockctl)
+			c := &cloud{efs: mockEfs}
+
+			mockEfs.EXPECT().DescribeMountTargets(gomock.Any(), gomock.Any()).Return(&efs.DescribeMountTargetsOutput{MountTargets: tc.mountTargets}, nil)
+			for _, subnetId := range tc.expectedCreated {
+				input := &efs.CreateMountTargetInput{FileSystemId: aws.String(fsId), SubnetId: aws.String(subnetId), SecurityGroups: []string{"sg-1234"}}
+				mockEfs.EXPECT().CreateMountTarget(gomock.Any(), input).Return(&efs.CreateMountTargetOutput{MountTargetId: aws.String("fsmt-" + subnetId)}, nil)
+			}
+			available, err := c.EnsureMountTargets(context.Background(), fsId, []string{"subnet-a", "subnet-b"}, []string{"sg-1234"})
+			if err != nil {
+				t.Fatalf("EnsureMountTargets failed: %v", err)
+			}
+			if available != tc.expectedAvailable {
+				t.Fatalf("Expected available %t, got %t", tc.expectedAvailable, available)
+			}
+		})
+	}
+}
+
+func TestDeleteFileSystem(t *testing.T) {
+	fsId := "fs-abcd1234"
+
+	t.Run("Fail: mount targets deleted first", func(t *testing.T) {
+		mockctl := gomock.NewController(t)
+		defer mockctl.Finish()
+		mockEfs := mocks.NewMockEfs(mockctl)
+		c := &cloud{efs: mockEfs}
+
+		mockEfs.EXPECT().DescribeMountTargets(gomock.Any(), gomock.Any()).Return(&efs.DescribeMountTargetsOutput{MountTargets: []types.MountTargetDescription{
+			{MountTargetId: aws.String("fsmt-a"), LifeCycleState: types.LifeCycleStateAvailable},
+			{MountTargetId: aws.String("fsmt-b"), LifeCycleState: types.LifeCycleStateDeleting},
+		}}, nil)
+		mockEfs.EXPECT().DeleteMountTarget(gomock.Any(), &efs.DeleteMountTargetInput{MountTargetId: aws.String("fsmt-a")}).Return(&efs.DeleteMountTargetOutput{}, nil)
+		if err := c.DeleteFileSystem(context.Background(), fsId); err != ErrFileSystemInUse {
+			t.Fatalf("Expected ErrFileSystemInUse, got %v", err)
+		}
+	})
+
+	t.Run("Success: without mount targets", func(t *testing.T) {
+		mockctl := gomock.NewController(t)
+		defer mockctl.Finish()
+		mockEfs := mocks.NewMockEfs(mockctl)
+		c := &cloud{efs: mockEfs}
+
+		mockEfs.EXPECT().DescribeMountTargets(gomock.Any(), gomock.Any()).Return(&efs.DescribeMountTargetsOutput{}, nil)
+		mockEfs.EXPECT().DeleteFileSystem(gomock.Any(), &efs.DeleteFileSystemInput{FileSystemId: aws.String(fsId)}).Return(&efs.DeleteFileSystemOutput{}, nil)
+		if err := c.DeleteFileSystem(context.Background(), fsId); err != nil {
+			t.Fatalf("DeleteFileSystem failed: %v", err)
+		}
+	})
+
+	t.Run("Fail: file system not found", func(t *testing.T) {
+		mockctl := gomock.NewController(t)
+		defer mockctl.Finish()
+		mockEfs := mocks.NewMockEfs(mockctl)
+		c := &cloud{efs: mockEfs}
+
+		mockEfs.EXPECT().DescribeMountTargets(gomock.Any(), gomock.Any()).Return(nil, &types.FileSystemNotFound{})
+		if err := c.DeleteFileSystem(context.Background(), fsId); err != ErrNotFound {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultIMDSEndpoint is the endpoint of the instance metadata service
+	DefaultIMDSEndpoint = "http://169.254.169.254"
+	imdsTokenPath       = "/latest/api/token"
+	imdsTokenTTLHeader  = "X-aws-ec2-metadata-token-ttl-seconds"
+	imdsCheckTimeout    = 5 * time.Second
+)
+
+var (
+	// ErrIMDSv2HopLimit is returned when the instance metadata service accepts connections but its IMDSv2
+	// token responses never arrive, as their hop limit is too low for the network namespace of the container
+	ErrIMDSv2HopLimit = errors.New("IMDSv2 token responses do not reach the container, the hop limit of the instance metadata options is likely 1")
+	// ErrIMDSUnreachable is returned when the instance metadata service does not accept connections
+	ErrIMDSUnreachable = errors.New("instance metadata service unreachable")
+)
+
+// IMDSv2HopLimitRemediation explains how to fix ErrIMDSv2HopLimit
+const IMDSv2HopLimitRemediation = "increase the HTTP PUT response hop limit of the instance metadata options to 2, " +
+	"e.g. with aws ec2 modify-instance-metadata-options --http-put-response-hop-limit 2 or the launch template of the nodes, " +
+	"or get the credentials from IAM roles for service accounts and disable --require-imdsv2"
+
+// CheckIMDSv2 fetches an IMDSv2 token from the instance metadata service at the endpoint, and tells a hop
+// limit blocking the token responses apart from an unreachable or disabled service: the connection to the
+// service then succeeds, but the response to the token request never arrives.
+func CheckIMDSv2(ctx context.Context, endpoint string, timeout time.Duration) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid instance metadata service endpoint %q: %v", endpoint, err)
+	}
+	if err := dialIMDS(ctx, u, timeout); err != nil {
+		return fmt.Errorf("%w at %s: %v", ErrIMDSUnreachable, endpoint, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+imdsTokenPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(imdsTokenTTLHeader, "60")
+	client := &http.Client{Transport: &http.Transport{Proxy: nil}}
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return fmt.Errorf("%w: no response to the token request within %v, %s", ErrIMDSv2HopLimit, timeout, IMDSv2HopLimitRemediation)
+		}
+		return fmt.Errorf("failed to fetch IMDSv2 token from %s: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch IMDSv2 token from %s: %s, the instance metadata service may be disabled", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// CheckIMDSReachable tells whether the instance metadata service at the endpoint accepts connections, without
+// fetching any token or metadata
+func CheckIMDSReachable(ctx context.Context, endpoint string, timeout time.Duration) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid instance metadata service endpoint %q: %v", endpoint, err)
+	}
+	if err := dialIMDS(ctx, u, timeout); err != nil {
+		return fmt.Errorf("%w at %s: %v", ErrIMDSUnreachable, endpoint, err)
+	}
+	return nil
+}
+
+func dialIMDS(ctx context.Context, u *url.URL, timeout time.Duration) error {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// RunsInECS returns true if the driver runs in an ECS task, which gets its metadata and credentials from the
+// task metadata endpoint instead of the instance metadata service
+func RunsInECS() bool {
+	return isDriverBootedInECS()
+}
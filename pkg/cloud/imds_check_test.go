@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckIMDSv2(t *testing.T) {
+	testCases := []struct {
+		name        string
+		handler     http.HandlerFunc
+		expectErr   bool
+		expectedErr error
+	}{
+		{
+			name: "token fetched",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != imdsTokenPath || r.Header.Get(imdsTokenTTLHeader) == "" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Write([]byte("token"))
+			},
+		},
+		{
+			name: "token response dropped by the hop limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			expectErr:   true,
+			expectedErr: ErrIMDSv2HopLimit,
+		},
+		{
+			name: "instance metadata service disabled",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+			err := CheckIMDSv2(context.Background(), server.URL, 100*time.Millisecond)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected %v, got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr == nil && errors.Is(err, ErrIMDSv2HopLimit) {
+				t.Fatalf("Expected another error than the hop limit, got %v", err)
+			}
+		})
+	}
+
+	// Nothing listens on the port of a closed listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	err = CheckIMDSv2(context.Background(), "http://"+listener.Addr().String(), 100*time.Millisecond)
+	if !errors.Is(err, ErrIMDSUnreachable) {
+		t.Fatalf("Expected %v, got %v", ErrIMDSUnreachable, err)
+	}
+}
@@ -55,6 +55,46 @@ func (mr *MockEfsMockRecorder) CreateAccessPoint(arg0, arg1 interface{}, arg2 ..
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessPoint", reflect.TypeOf((*MockEfs)(nil).CreateAccessPoint), varargs...)
 }
 
+// CreateFileSystem mocks base method.
+func (m *MockEfs) CreateFileSystem(arg0 context.Context, arg1 *efs.CreateFileSystemInput, arg2 ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CreateFileSystem", varargs...)
+	ret0, _ := ret[0].(*efs.CreateFileSystemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateFileSystem indicates an expected call of CreateFileSystem.
+func (mr *MockEfsMockRecorder) CreateFileSystem(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFileSystem", reflect.TypeOf((*MockEfs)(nil).CreateFileSystem), varargs...)
+}
+
+// CreateMountTarget mocks base method.
+func (m *MockEfs) CreateMountTarget(arg0 context.Context, arg1 *efs.CreateMountTargetInput, arg2 ...func(*efs.Options)) (*efs.CreateMountTargetOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CreateMountTarget", varargs...)
+	ret0, _ := ret[0].(*efs.CreateMountTargetOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMountTarget indicates an expected call of CreateMountTarget.
+func (mr *MockEfsMockRecorder) CreateMountTarget(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMountTarget", reflect.TypeOf((*MockEfs)(nil).CreateMountTarget), varargs...)
+}
+
 // DeleteAccessPoint mocks base method.
 func (m *MockEfs) DeleteAccessPoint(arg0 context.Context, arg1 *efs.DeleteAccessPointInput, arg2 ...func(*efs.Options)) (*efs.DeleteAccessPointOutput, error) {
 	m.ctrl.T.Helper()
@@ -75,6 +115,46 @@ func (mr *MockEfsMockRecorder) DeleteAccessPoint(arg0, arg1 interface{}, arg2 ..
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccessPoint", reflect.TypeOf((*MockEfs)(nil).DeleteAccessPoint), varargs...)
 }
 
+// DeleteFileSystem mocks base method.
+func (m *MockEfs) DeleteFileSystem(arg0 context.Context, arg1 *efs.DeleteFileSystemInput, arg2 ...func(*efs.Options)) (*efs.DeleteFileSystemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteFileSystem", varargs...)
+	ret0, _ := ret[0].(*efs.DeleteFileSystemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteFileSystem indicates an expected call of DeleteFileSystem.
+func (mr *MockEfsMockRecorder) DeleteFileSystem(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileSystem", reflect.TypeOf((*MockEfs)(nil).DeleteFileSystem), varargs...)
+}
+
+// DeleteMountTarget mocks base method.
+func (m *MockEfs) DeleteMountTarget(arg0 context.Context, arg1 *efs.DeleteMountTargetInput, arg2 ...func(*efs.Options)) (*efs.DeleteMountTargetOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteMountTarget", varargs...)
+	ret0, _ := ret[0].(*efs.DeleteMountTargetOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMountTarget indicates an expected call of DeleteMountTarget.
+func (mr *MockEfsMockRecorder) DeleteMountTarget(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMountTarget", reflect.TypeOf((*MockEfs)(nil).DeleteMountTarget), varargs...)
+}
+
 // DescribeAccessPoints mocks base method.
 func (m *MockEfs) DescribeAccessPoints(arg0 context.Context, arg1 *efs.DescribeAccessPointsInput, arg2 ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error) {
 	m.ctrl.T.Helper()
@@ -134,3 +214,63 @@ func (mr *MockEfsMockRecorder) DescribeMountTargets(arg0, arg1 interface{}, arg2
 	varargs := append([]interface{}{arg0, arg1}, arg2...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeMountTargets", reflect.TypeOf((*MockEfs)(nil).DescribeMountTargets), varargs...)
 }
+
+// ListTagsForResource mocks base method.
+func (m *MockEfs) ListTagsForResource(arg0 context.Context, arg1 *efs.ListTagsForResourceInput, arg2 ...func(*efs.Options)) (*efs.ListTagsForResourceOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListTagsForResource", varargs...)
+	ret0, _ := ret[0].(*efs.ListTagsForResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTagsForResource indicates an expected call of ListTagsForResource.
+func (mr *MockEfsMockRecorder) ListTagsForResource(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTagsForResource", reflect.TypeOf((*MockEfs)(nil).ListTagsForResource), varargs...)
+}
+
+// TagResource mocks base method.
+func (m *MockEfs) TagResource(arg0 context.Context, arg1 *efs.TagResourceInput, arg2 ...func(*efs.Options)) (*efs.TagResourceOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "TagResource", varargs...)
+	ret0, _ := ret[0].(*efs.TagResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TagResource indicates an expected call of TagResource.
+func (mr *MockEfsMockRecorder) TagResource(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagResource", reflect.TypeOf((*MockEfs)(nil).TagResource), varargs...)
+}
+
+// UntagResource mocks base method.
+func (m *MockEfs) UntagResource(arg0 context.Context, arg1 *efs.UntagResourceInput, arg2 ...func(*efs.Options)) (*efs.UntagResourceOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "UntagResource", varargs...)
+	ret0, _ := ret[0].(*efs.UntagResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UntagResource indicates an expected call of UntagResource.
+func (mr *MockEfsMockRecorder) UntagResource(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UntagResource", reflect.TypeOf((*MockEfs)(nil).UntagResource), varargs...)
+}
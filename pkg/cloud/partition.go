@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrPartitionMismatch is returned when the region, endpoint and role of an API config are not all in the same
+// partition, e.g. a role of the aws partition with a file system of a GovCloud region, as the credentials and
+// the roles of a partition are not valid in the others
+var ErrPartitionMismatch = errors.New("Partition mismatch")
+
+// partitions are the partitions of the regions, by region prefix, with the DNS suffix of their endpoints, and of
+// their dual-stack endpoints if any. The regions without a prefix of the list are in the aws partition.
+var partitions = []struct {
+	regionPrefix       string
+	id                 string
+	dnsSuffix          string
+	dualStackDNSSuffix string
+}{
+	{"cn-", "aws-cn", "amazonaws.com.cn", "api.amazonwebservices.com.cn"},
+	{"us-gov-", "aws-us-gov", "amazonaws.com", "api.aws"},
+	{"us-isob-", "aws-iso-b", "sc2s.sgov.gov", ""},
+	{"us-isof-", "aws-iso-f", "csp.hci.ic.gov", ""},
+	{"us-iso-", "aws-iso", "c2s.ic.gov", ""},
+	{"eu-isoe-", "aws-iso-e", "cloud.adc-e.uk", ""},
+}
+
+// regionPattern matches the names of the regions, e.g. us-gov-west-1
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// regionPartition returns the partition of the region. The SDK resolves the EFS endpoint of the region, and so
+// its partition, so this is used to check that the ARNs, endpoint and region of an API config agree.
+func regionPartition(region string) string {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.regionPrefix) {
+			return p.id
+		}
+	}
+	return "aws"
+}
+
+// regionDNSSuffix returns the DNS suffix of the endpoints of the region, e.g. c2s.ic.gov for us-iso-east-1
+func regionDNSSuffix(region string) string {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.regionPrefix) {
+			return p.dnsSuffix
+		}
+	}
+	return "amazonaws.com"
+}
+
+// regionDualStackDNSSuffix returns the DNS suffix of the dual-stack endpoints of the region, e.g. api.aws for
+// us-east-1, or an empty string if the partition of the region has none
+func regionDualStackDNSSuffix(region string) string {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.regionPrefix) {
+			return p.dualStackDNSSuffix
+		}
+	}
+	return "api.aws"
+}
+
+// endpointRegion returns the region of the URL of an AWS endpoint, e.g. us-iso-east-1 for
+// https://elasticfilesystem.us-iso-east-1.c2s.ic.gov or an interface VPC endpoint of the region, or an empty
+// string if the host has no region, e.g. a local stub of the API
+func endpointRegion(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	for _, label := range strings.Split(u.Hostname(), ".") {
+		if regionPattern.MatchString(label) {
+			return label
+		}
+	}
+	return ""
+}
+
+// arnPartition returns the partition of an ARN, arn:partition:service:region:account-id:resource
+func arnPartition(arn string) string {
+	tokens := strings.SplitN(arn, ":", 3)
+	if len(tokens) < 3 {
+		return ""
+	}
+	return tokens[1]
+}
+
+// resolveAPIConfig returns the API config with the endpoint, if overridden, and the region whose partition, and
+// signing region, the API calls use. Without a region, it is the region of the endpoint, as the requests to the
+// endpoint of another partition must be signed for its region, or else the region of the instance.
+func resolveAPIConfig(apiConfig APIConfig, options Options, instanceRegion string) (APIConfig, error) {
+	apiConfig.Endpoint = efsEndpoint(apiConfig, options, instanceRegion)
+	region := endpointRegion(apiConfig.Endpoint)
+	if apiConfig.Region == "" {
+		apiConfig.Region = region
+	}
+	if apiConfig.Region == "" {
+		apiConfig.Region = instanceRegion
+	}
+	partition := regionPartition(apiConfig.Region)
+	if region != "" && regionPartition(region) != partition {
+		return apiConfig, fmt.Errorf("%w: endpoint %s is in partition %s but region %s is in partition %s", ErrPartitionMismatch, apiConfig.Endpoint, regionPartition(region), apiConfig.Region, partition)
+	}
+	if apiConfig.RoleArn != "" {
+		if rolePartition := arnPartition(apiConfig.RoleArn); rolePartition != partition {
+			return apiConfig, fmt.Errorf("%w: role %s of partition %s cannot be assumed in region %s of partition %s", ErrPartitionMismatch, apiConfig.RoleArn, rolePartition, apiConfig.Region, partition)
+		}
+	}
+	return apiConfig, nil
+}
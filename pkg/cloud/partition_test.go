@@ -0,0 +1,132 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegionPartition(t *testing.T) {
+	for region, expected := range map[string]string{
+		"us-west-2":       "aws",
+		"cn-northwest-1":  "aws-cn",
+		"us-gov-west-1":   "aws-us-gov",
+		"us-iso-east-1":   "aws-iso",
+		"us-isob-east-1":  "aws-iso-b",
+		"eu-isoe-west-1":  "aws-iso-e",
+		"us-isof-south-1": "aws-iso-f",
+	} {
+		if partition := regionPartition(region); partition != expected {
+			t.Errorf("Expected partition %s for region %s, got %s", expected, region, partition)
+		}
+	}
+}
+
+func TestResolveAPIConfig(t *testing.T) {
+	testCases := []struct {
+		name             string
+		apiConfig        APIConfig
+		endpointOverride string
+		expectedRegion   string
+		expectedEndpoint string
+		expectErr        bool
+	}{
+		{
+			name:           "Success: region of the instance",
+			apiConfig:      APIConfig{},
+			expectedRegion: "us-east-1",
+		},
+		{
+			name:           "Success: region of another partition",
+			apiConfig:      APIConfig{Region: "us-gov-west-1", RoleArn: "arn:aws-us-gov:iam::111122223333:role/efs"},
+			expectedRegion: "us-gov-west-1",
+		},
+		{
+			name:           "Success: signing region of the endpoint",
+			apiConfig:      APIConfig{Endpoint: "https://elasticfilesystem.us-iso-east-1.c2s.ic.gov"},
+			expectedRegion: "us-iso-east-1",
+		},
+		{
+			name:           "Success: signing region of an interface VPC endpoint",
+			apiConfig:      APIConfig{Endpoint: "https://vpce-0123-abcd.elasticfilesystem.us-gov-east-1.vpce.amazonaws.com"},
+			expectedRegion: "us-gov-east-1",
+		},
+		{
+			name:           "Success: endpoint without region",
+			apiConfig:      APIConfig{Endpoint: "http://localhost:4566"},
+			expectedRegion: "us-east-1",
+		},
+		{
+			name:             "Success: signing region of the endpoint override",
+			apiConfig:        APIConfig{},
+			endpointOverride: "https://vpce-0123-abcd.elasticfilesystem.us-east-1.vpce.amazonaws.com",
+			expectedRegion:   "us-east-1",
+			expectedEndpoint: "https://vpce-0123-abcd.elasticfilesystem.us-east-1.vpce.amazonaws.com",
+		},
+		{
+			name:             "Success: signing region of the endpoint override of another partition",
+			apiConfig:        APIConfig{},
+			endpointOverride: "https://elasticfilesystem-fips.us-gov-west-1.amazonaws.com",
+			expectedRegion:   "us-gov-west-1",
+			expectedEndpoint: "https://elasticfilesystem-fips.us-gov-west-1.amazonaws.com",
+		},
+		{
+			name:             "Success: endpoint override ignored in another region",
+			apiConfig:        APIConfig{Region: "us-west-2"},
+			endpointOverride: "https://vpce-0123-abcd.elasticfilesystem.us-east-1.vpce.amazonaws.com",
+			expectedRegion:   "us-west-2",
+		},
+		{
+			name:             "Success: endpoint of the config over the endpoint override",
+			apiConfig:        APIConfig{Endpoint: "http://localhost:4566"},
+			endpointOverride: "https://vpce-0123-abcd.elasticfilesystem.us-east-1.vpce.amazonaws.com",
+			expectedRegion:   "us-east-1",
+			expectedEndpoint: "http://localhost:4566",
+		},
+		{
+			name:      "Fail: role of another partition",
+			apiConfig: APIConfig{Region: "us-gov-west-1", RoleArn: "arn:aws:iam::111122223333:role/efs"},
+			expectErr: true,
+		},
+		{
+			name:      "Fail: endpoint of another partition",
+			apiConfig: APIConfig{Region: "us-west-2", Endpoint: "https://elasticfilesystem.cn-north-1.amazonaws.com.cn"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiConfig, err := resolveAPIConfig(tc.apiConfig, Options{EFSEndpoint: tc.endpointOverride}, "us-east-1")
+			if tc.expectErr {
+				if !errors.Is(err, ErrPartitionMismatch) {
+					t.Fatalf("Expected ErrPartitionMismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if apiConfig.Region != tc.expectedRegion {
+				t.Fatalf("Expected region %s, got %s", tc.expectedRegion, apiConfig.Region)
+			}
+			if tc.endpointOverride != "" && apiConfig.Endpoint != tc.expectedEndpoint {
+				t.Fatalf("Expected endpoint %q, got %q", tc.expectedEndpoint, apiConfig.Endpoint)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// readAfterWriteWindow is how long after its creation an access point may not be visible yet
+	readAfterWriteWindow      = 30 * time.Second
+	readAfterWriteMinInterval = 100 * time.Millisecond
+	readAfterWriteMaxInterval = 2 * time.Second
+)
+
+// createdAccessPoints remembers the access points created recently by the cloud, by ID and by file system and
+// client token. DescribeAccessPoints is eventually consistent: an access point may not be returned for a few
+// seconds after CreateAccessPoint returned it. The lookups of such an access point are retried with backoff
+// until it is visible or the read-after-write window since its creation expires, so that a missing access
+// point is only reported once it is missing for good. A nil createdAccessPoints is valid and never retries.
+type createdAccessPoints struct {
+	window      time.Duration
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	mu sync.Mutex
+	// createdAt holds when each access point ID or file system and client token was created
+	createdAt map[string]time.Time
+}
+
+func newCreatedAccessPoints() *createdAccessPoints {
+	return &createdAccessPoints{
+		window:      readAfterWriteWindow,
+		minInterval: readAfterWriteMinInterval,
+		maxInterval: readAfterWriteMaxInterval,
+		createdAt:   map[string]time.Time{},
+	}
+}
+
+// clientTokenKey returns the key of the access point created with the client token on the file system
+func clientTokenKey(fileSystemId, clientToken string) string {
+	return fileSystemId + "/" + clientToken
+}
+
+// add records the creation of the access point with the client token
+func (c *createdAccessPoints) add(accessPoint *AccessPoint, clientToken string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for key, createdAt := range c.createdAt {
+		if now.Sub(createdAt) > c.window {
+			delete(c.createdAt, key)
+		}
+	}
+	c.createdAt[accessPoint.AccessPointId] = now
+	c.createdAt[clientTokenKey(accessPoint.FileSystemId, clientToken)] = now
+}
+
+// deadline returns when the read-after-write window of the key expires, if it was created recently
+func (c *createdAccessPoints) deadline(key string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	createdAt, ok := c.createdAt[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	deadline := createdAt.Add(c.window)
+	return deadline, time.Now().Before(deadline)
+}
+
+// retry calls lookup until it finds the access point of the key, i.e. returns false, while the key is in its
+// read-after-write window and ctx is not done. lookup is called once for the keys not created recently.
+func (c *createdAccessPoints) retry(ctx context.Context, key string, lookup func() (missing bool)) {
+	if !lookup() || c == nil {
+		return
+	}
+	deadline, ok := c.deadline(key)
+	if !ok {
+		return
+	}
+	interval := c.minInterval
+	for attempt := 1; ; attempt++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			klog.Warningf("Access point %s is still not visible %v after its creation", key, c.window)
+			return
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		klog.V(4).Infof("Access point %s created recently is not visible yet, retrying in %v", key, interval)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+		if !lookup() {
+			klog.V(4).Infof("Access point %s created recently is visible after %d retries", key, attempt)
+			return
+		}
+		interval *= 2
+		if interval > c.maxInterval {
+			interval = c.maxInterval
+		}
+	}
+}
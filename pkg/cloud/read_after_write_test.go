@@ -0,0 +1,161 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"github.com/golang/mock/gomock"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
+)
+
+// newReadAfterWriteCloud returns a cloud retrying the lookups of its access points every millisecond for the window
+func newReadAfterWriteCloud(mockEfs *mocks.MockEfs, window time.Duration) *cloud {
+	created := newCreatedAccessPoints()
+	created.window, created.minInterval, created.maxInterval = window, time.Millisecond, time.Millisecond
+	return &cloud{efs: mockEfs, created: created}
+}
+
+func TestReadAfterWrite(t *testing.T) {
+	var (
+		accessPointId = "fsap-abcd1234xyz987"
+		fsId          = "fs-abcd1234"
+		clientToken   = "pvc-1234"
+	)
+	notFound := &types.AccessPointNotFound{Message: aws.String("Access point not found")}
+	description := types.AccessPointDescription{
+		AccessPointId: aws.String(accessPointId),
+		ClientToken:   aws.String(clientToken),
+		FileSystemId:  aws.String(fsId),
+		RootDirectory: &types.RootDirectory{Path: aws.String("/test")},
+	}
+	createOutput := &efs.CreateAccessPointOutput{AccessPointId: aws.String(accessPointId), FileSystemId: aws.String(fsId)}
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		testFunc func(t *testing.T)
+	}{
+		{
+			name: "Describe retried until the created access point is visible",
+			testFunc: func(t *testing.T) {
+				mockEfs := mocks.NewMockEfs(gomock.NewController(t))
+				c := newReadAfterWriteCloud(mockEfs, time.Minute)
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).Return(createOutput, nil)
+				if _, err := c.CreateAccessPoint(ctx, clientToken, &AccessPointOptions{FileSystemId: fsId}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				gomock.InOrder(
+					mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, notFound).Times(2),
+					mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(&efs.DescribeAccessPointsOutput{AccessPoints: []types.AccessPointDescription{description}}, nil),
+				)
+				accessPoint, err := c.DescribeAccessPoint(ctx, accessPointId)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if accessPoint.AccessPointId != accessPointId {
+					t.Fatalf("Expected access point %s, got %s", accessPointId, accessPoint.AccessPointId)
+				}
+			},
+		},
+		{
+			name: "Find by client token retried until the created access point is listed",
+			testFunc: func(t *testing.T) {
+				mockEfs := mocks.NewMockEfs(gomock.NewController(t))
+				c := newReadAfterWriteCloud(mockEfs, time.Minute)
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).Return(createOutput, nil)
+				if _, err := c.CreateAccessPoint(ctx, clientToken, &AccessPointOptions{FileSystemId: fsId}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				gomock.InOrder(
+					mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(&efs.DescribeAccessPointsOutput{}, nil),
+					mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(&efs.DescribeAccessPointsOutput{AccessPoints: []types.AccessPointDescription{description}}, nil),
+				)
+				accessPoint, err := c.FindAccessPointByClientToken(ctx, clientToken, fsId)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if accessPoint == nil || accessPoint.AccessPointId != accessPointId {
+					t.Fatalf("Expected access point %s, got %+v", accessPointId, accessPoint)
+				}
+			},
+		},
+		{
+			name: "Tag retried until the created access point is found",
+			testFunc: func(t *testing.T) {
+				mockEfs := mocks.NewMockEfs(gomock.NewController(t))
+				c := newReadAfterWriteCloud(mockEfs, time.Minute)
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).Return(createOutput, nil)
+				if _, err := c.CreateAccessPoint(ctx, clientToken, &AccessPointOptions{FileSystemId: fsId}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				gomock.InOrder(
+					mockEfs.EXPECT().TagResource(gomock.Eq(ctx), gomock.Any()).Return(nil, notFound),
+					mockEfs.EXPECT().TagResource(gomock.Eq(ctx), gomock.Any()).Return(&efs.TagResourceOutput{}, nil),
+				)
+				if err := c.MarkAccessPointProvisioned(ctx, accessPointId); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			},
+		},
+		{
+			name: "Not found after the window",
+			testFunc: func(t *testing.T) {
+				mockEfs := mocks.NewMockEfs(gomock.NewController(t))
+				c := newReadAfterWriteCloud(mockEfs, 20*time.Millisecond)
+				mockEfs.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any()).Return(createOutput, nil)
+				if _, err := c.CreateAccessPoint(ctx, clientToken, &AccessPointOptions{FileSystemId: fsId}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, notFound).MinTimes(2)
+				if _, err := c.DescribeAccessPoint(ctx, accessPointId); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("Expected ErrNotFound, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Access point not created recently not retried",
+			testFunc: func(t *testing.T) {
+				mockEfs := mocks.NewMockEfs(gomock.NewController(t))
+				c := newReadAfterWriteCloud(mockEfs, time.Minute)
+
+				mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, notFound).Times(1)
+				if _, err := c.DescribeAccessPoint(ctx, accessPointId); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("Expected ErrNotFound, got %v", err)
+				}
+				mockEfs.EXPECT().DescribeAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(&efs.DescribeAccessPointsOutput{}, nil).Times(1)
+				if accessPoint, err := c.FindAccessPointByClientToken(ctx, clientToken, fsId); err != nil || accessPoint != nil {
+					t.Fatalf("Expected no access point, got %+v, %v", accessPoint, err)
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.testFunc)
+	}
+}
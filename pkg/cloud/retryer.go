@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// RetryPolicy configures the retries of the EFS API calls of every cloud created with it. The retryers of
+// the clouds share one retry token bucket, so that throttling, whatever the operation, role or region of
+// the call, slows down the retries of all the calls instead of each client draining its own bucket. A nil
+// RetryPolicy is valid and keeps the standard retryer of the SDK, with a token bucket per client.
+type RetryPolicy struct {
+	maxAttempts int
+	rateLimiter retry.RateLimiter
+}
+
+// NewRetryPolicy returns the policy making at most maxAttempts attempts per call, with a shared bucket of
+// retryTokens tokens. Each retry takes retry.DefaultRetryCost tokens, or retry.DefaultRetryTimeoutCost
+// after a timeout, and each successful call returns one. Retries are not limited if retryTokens is 0.
+func NewRetryPolicy(maxAttempts, retryTokens int) (*RetryPolicy, error) {
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("invalid maximum number of attempts of the EFS API calls %d, must be at least 1", maxAttempts)
+	}
+	if retryTokens < 0 {
+		return nil, fmt.Errorf("invalid number of retry tokens of the EFS API calls %d, must not be negative", retryTokens)
+	}
+	var rateLimiter retry.RateLimiter = ratelimit.None
+	if retryTokens > 0 {
+		rateLimiter = ratelimit.NewTokenRateLimit(uint(retryTokens))
+	}
+	return &RetryPolicy{
+		maxAttempts: maxAttempts,
+		rateLimiter: rateLimiter,
+	}, nil
+}
+
+// retryer returns a standard retryer of the SDK drawing from the token bucket of the policy, or nil for
+// the default retryer of the SDK
+func (p *RetryPolicy) retryer() aws.Retryer {
+	if p == nil {
+		return nil
+	}
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = p.maxAttempts
+		o.RateLimiter = p.rateLimiter
+	})
+}
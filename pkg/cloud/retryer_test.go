@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxAttempts int
+		retryTokens int
+		expectError bool
+	}{
+		{
+			name:        "defaults",
+			maxAttempts: retry.DefaultMaxAttempts,
+			retryTokens: int(retry.DefaultRetryRateTokens),
+		},
+		{
+			name:        "unlimited retries",
+			maxAttempts: 5,
+		},
+		{
+			name:        "no attempt",
+			maxAttempts: 0,
+			expectError: true,
+		},
+		{
+			name:        "negative retry tokens",
+			maxAttempts: 3,
+			retryTokens: -1,
+			expectError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := NewRetryPolicy(tc.maxAttempts, tc.retryTokens)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if maxAttempts := policy.retryer().MaxAttempts(); maxAttempts != tc.maxAttempts {
+				t.Fatalf("Expected %d attempts, got %d", tc.maxAttempts, maxAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicySharedTokenBucket(t *testing.T) {
+	policy, err := NewRetryPolicy(3, int(retry.DefaultRetryCost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := policy.retryer(), policy.retryer()
+	ctx := context.Background()
+	throttled := errors.New("throttled")
+
+	if _, err := first.GetRetryToken(ctx, throttled); err != nil {
+		t.Fatalf("Expected a retry token, got: %v", err)
+	}
+	if _, err := second.GetRetryToken(ctx, throttled); err == nil {
+		t.Fatal("Expected the retry tokens of the first retryer to be taken from the shared bucket")
+	}
+}
+
+func TestNilRetryPolicy(t *testing.T) {
+	var policy *RetryPolicy
+	if retryer := policy.retryer(); retryer != nil {
+		t.Fatalf("Expected the default retryer, got %v", retryer)
+	}
+}
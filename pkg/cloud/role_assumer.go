@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"k8s.io/klog/v2"
+)
+
+// stsAccessDenied is the error code of STS when the role may not be assumed
+const stsAccessDenied = "AccessDenied"
+
+// RoleAssumer assumes IAM roles with the credentials of the driver
+type RoleAssumer interface {
+	// AssumeRole assumes the role with the STS API of the region and returns when its credentials expire. It
+	// returns an error wrapping ErrAccessDenied if the credentials of the driver may not assume the role.
+	AssumeRole(ctx context.Context, roleArn, region string) (expires time.Time, err error)
+}
+
+type roleAssumer struct {
+	cfg     aws.Config
+	options Options
+}
+
+// NewRoleAssumer returns a RoleAssumer using the default credentials of the driver
+func NewRoleAssumer(options Options) (RoleAssumer, error) {
+	cfg, err := loadConfig(context.TODO(), options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	return &roleAssumer{cfg: cfg, options: options}, nil
+}
+
+func (r *roleAssumer) AssumeRole(ctx context.Context, roleArn, region string) (time.Time, error) {
+	klog.V(5).Infof("Assuming role %s in region %s", roleArn, region)
+	ctx, cancel := withTimeout(ctx, r.options.DescribeTimeout)
+	defer cancel()
+
+	client := sts.NewFromConfig(r.cfg, r.options.stsEndpoint, func(o *sts.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+	creds, err := stscreds.NewAssumeRoleProvider(client, roleArn).Retrieve(ctx)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == stsAccessDenied {
+			return time.Time{}, fmt.Errorf("%w: %s", ErrAccessDenied, apiErr.ErrorMessage())
+		}
+		if isDeadlineExceeded(err) {
+			return time.Time{}, ErrDeadlineExceeded
+		}
+		return time.Time{}, err
+	}
+	return creds.Expires, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"k8s.io/klog/v2"
+)
+
+const secretsManagerService = "secretsmanager"
+
+// SecretsManager reads secrets from AWS Secrets Manager
+type SecretsManager interface {
+	// GetSecretValue returns the current value of the secret with the ARN. It returns ErrNotFound if
+	// the secret does not exist and ErrAccessDenied if the secret, or its KMS key, may not be read.
+	GetSecretValue(ctx context.Context, secretArn string) (value string, err error)
+}
+
+// secretsManagerClient is the part of the Secrets Manager SDK client called by the driver
+type secretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// secretsManager calls the GetSecretValue API of Secrets Manager with the credentials of the driver, in the
+// region of the secret
+type secretsManager struct {
+	client  secretsManagerClient
+	options Options
+}
+
+// NewSecretsManager returns a Secrets Manager client using the default credentials of the driver
+func NewSecretsManager(options Options) (SecretsManager, error) {
+	cfg, err := loadConfig(context.TODO(), options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	return &secretsManager{
+		client:  secretsmanager.NewFromConfig(cfg),
+		options: options,
+	}, nil
+}
+
+// parseSecretArn returns the region of a secret ARN of the form
+// arn:<partition>:secretsmanager:<region>:<account>:secret:<name>
+func parseSecretArn(secretArn string) (string, error) {
+	parts := strings.SplitN(secretArn, ":", 7)
+	if len(parts) != 7 || parts[0] != "arn" || parts[2] != secretsManagerService || parts[3] == "" || parts[5] != "secret" || parts[6] == "" {
+		return "", fmt.Errorf("%q is not the ARN of a Secrets Manager secret", secretArn)
+	}
+	return parts[3], nil
+}
+
+func (s *secretsManager) GetSecretValue(ctx context.Context, secretArn string) (string, error) {
+	region, err := parseSecretArn(secretArn)
+	if err != nil {
+		return "", err
+	}
+	klog.V(5).Infof("Calling GetSecretValue of secret %s", secretArn)
+	ctx, cancel := withTimeout(ctx, s.options.DescribeTimeout)
+	defer cancel()
+
+	// The endpoint, and so the partition, is the one of the region of the secret
+	output, err := s.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretArn)}, func(o *secretsmanager.Options) {
+		o.Region = region
+	})
+	if err != nil {
+		var notFoundErr *types.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return "", ErrNotFound
+		}
+		if isAccessDenied(err) {
+			return "", ErrAccessDenied
+		}
+		if isDeadlineExceeded(err) {
+			return "", ErrDeadlineExceeded
+		}
+		return "", fmt.Errorf("GetSecretValue failed: %v", err)
+	}
+	if output.SecretString != nil {
+		return *output.SecretString, nil
+	}
+	if output.SecretBinary != nil {
+		return string(output.SecretBinary), nil
+	}
+	return "", fmt.Errorf("secret %s has no value", secretArn)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+func TestParseSecretArn(t *testing.T) {
+	testCases := []struct {
+		arn       string
+		region    string
+		expectErr bool
+	}{
+		{arn: "arn:aws:secretsmanager:us-east-1:111122223333:secret:efs-role-AbCdEf", region: "us-east-1"},
+		{arn: "arn:aws-cn:secretsmanager:cn-north-1:111122223333:secret:efs/role", region: "cn-north-1"},
+		{arn: "arn:aws:iam::111122223333:role/efs", expectErr: true},
+		{arn: "arn:aws:secretsmanager:us-east-1:111122223333:secret:", expectErr: true},
+		{arn: "efs-role", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		region, err := parseSecretArn(tc.arn)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("Expected %q to be rejected", tc.arn)
+			}
+			continue
+		}
+		if err != nil || region != tc.region {
+			t.Errorf("parseSecretArn(%q) = %q, %v", tc.arn, region, err)
+		}
+	}
+}
+
+func TestGetSecretValue(t *testing.T) {
+	secretArn := "arn:aws:secretsmanager:us-east-1:111122223333:secret:efs-role-AbCdEf"
+	testCases := []struct {
+		name          string
+		status        int
+		response      string
+		expectedValue string
+		expectedErr   error
+		expectErr     bool
+	}{
+		{
+			name:          "Success: string secret",
+			status:        http.StatusOK,
+			response:      `{"ARN":"` + secretArn + `","SecretString":"arn:aws:iam::111122223333:role/efs"}`,
+			expectedValue: "arn:aws:iam::111122223333:role/efs",
+		},
+		{
+			name:          "Success: binary secret",
+			status:        http.StatusOK,
+			response:      `{"ARN":"` + secretArn + `","SecretBinary":"dmFsdWU="}`,
+			expectedValue: "value",
+		},
+		{
+			name:        "Fail: Access Denied",
+			status:      http.StatusBadRequest,
+			response:    `{"__type":"AccessDeniedException","message":"not authorized to perform kms:Decrypt"}`,
+			expectedErr: ErrAccessDenied,
+		},
+		{
+			name:        "Fail: Not Found",
+			status:      http.StatusBadRequest,
+			response:    `{"__type":"com.amazonaws.secretsmanager#ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`,
+			expectedErr: ErrNotFound,
+		},
+		{
+			name:      "Fail: Other error",
+			status:    http.StatusInternalServerError,
+			response:  `{"__type":"InternalServiceError","message":"internal"}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+					t.Errorf("Unexpected target %q", r.Header.Get("X-Amz-Target"))
+				}
+				if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "/us-east-1/secretsmanager/aws4_request") {
+					t.Errorf("Request is not signed for Secrets Manager in us-east-1: %q", auth)
+				}
+				input := map[string]string{}
+				if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input["SecretId"] != secretArn {
+					t.Errorf("Unexpected input %v: %v", input, err)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			defer server.Close()
+
+			s := &secretsManager{
+				client: secretsmanager.New(secretsmanager.Options{
+					Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+					HTTPClient:   server.Client(),
+					BaseEndpoint: aws.String(server.URL),
+					Retryer:      aws.NopRetryer{},
+				}),
+			}
+			value, err := s.GetSecretValue(context.Background(), secretArn)
+			if tc.expectedErr != nil || tc.expectErr {
+				if err == nil || (tc.expectedErr != nil && err != tc.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSecretValue failed: %v", err)
+			}
+			if value != tc.expectedValue {
+				t.Fatalf("Expected %q, got %q", tc.expectedValue, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Code generated by instrumentgen. DO NOT EDIT.
+
+package cloud
+
+import (
+	"context"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+)
+
+// instrumentedCloud times, counts and traces the calls to the wrapped Cloud
+type instrumentedCloud struct {
+	Cloud
+}
+
+func newInstrumentedCloud(wrapped Cloud) Cloud {
+	return &instrumentedCloud{Cloud: wrapped}
+}
+
+func (i *instrumentedCloud) CheckAccess(a0 context.Context, a1 string) error {
+	ctx, done := util.Instrument(a0, "cloud", "CheckAccess")
+	r0 := i.Cloud.CheckAccess(ctx, a1)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedCloud) CreateAccessPoint(a0 context.Context, a1 string, a2 *AccessPointOptions) (*AccessPoint, error) {
+	ctx, done := util.Instrument(a0, "cloud", "CreateAccessPoint")
+	r0, r1 := i.Cloud.CreateAccessPoint(ctx, a1, a2)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) CreateFileSystem(a0 context.Context, a1 string, a2 *FileSystemOptions) (*FileSystem, error) {
+	ctx, done := util.Instrument(a0, "cloud", "CreateFileSystem")
+	r0, r1 := i.Cloud.CreateFileSystem(ctx, a1, a2)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) DeleteAccessPoint(a0 context.Context, a1 string) error {
+	ctx, done := util.Instrument(a0, "cloud", "DeleteAccessPoint")
+	r0 := i.Cloud.DeleteAccessPoint(ctx, a1)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedCloud) DeleteFileSystem(a0 context.Context, a1 string) error {
+	ctx, done := util.Instrument(a0, "cloud", "DeleteFileSystem")
+	r0 := i.Cloud.DeleteFileSystem(ctx, a1)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedCloud) DescribeAccessPoint(a0 context.Context, a1 string) (*AccessPoint, error) {
+	ctx, done := util.Instrument(a0, "cloud", "DescribeAccessPoint")
+	r0, r1 := i.Cloud.DescribeAccessPoint(ctx, a1)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) DescribeFileSystem(a0 context.Context, a1 string) (*FileSystem, error) {
+	ctx, done := util.Instrument(a0, "cloud", "DescribeFileSystem")
+	r0, r1 := i.Cloud.DescribeFileSystem(ctx, a1)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) DescribeMountTargets(a0 context.Context, a1 string, a2 string) (*MountTarget, error) {
+	ctx, done := util.Instrument(a0, "cloud", "DescribeMountTargets")
+	r0, r1 := i.Cloud.DescribeMountTargets(ctx, a1, a2)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) DescribeTags(a0 context.Context, a1 string) (map[string]string, error) {
+	ctx, done := util.Instrument(a0, "cloud", "DescribeTags")
+	r0, r1 := i.Cloud.DescribeTags(ctx, a1)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) EnsureMountTargets(a0 context.Context, a1 string, a2 []string, a3 []string) (bool, error) {
+	ctx, done := util.Instrument(a0, "cloud", "EnsureMountTargets")
+	r0, r1 := i.Cloud.EnsureMountTargets(ctx, a1, a2, a3)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) FindAccessPointByClientToken(a0 context.Context, a1 string, a2 string) (*AccessPoint, error) {
+	ctx, done := util.Instrument(a0, "cloud", "FindAccessPointByClientToken")
+	r0, r1 := i.Cloud.FindAccessPointByClientToken(ctx, a1, a2)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) GetMetadata() MetadataService {
+	_, done := util.Instrument(context.Background(), "cloud", "GetMetadata")
+	r0 := i.Cloud.GetMetadata()
+	done(nil)
+	return r0
+}
+
+func (i *instrumentedCloud) ListAccessPoints(a0 context.Context, a1 string) ([]*AccessPoint, error) {
+	ctx, done := util.Instrument(a0, "cloud", "ListAccessPoints")
+	r0, r1 := i.Cloud.ListAccessPoints(ctx, a1)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) ListAccessPointsPages(a0 context.Context, a1 string, a2 func(accessPoints []*AccessPoint) bool) error {
+	ctx, done := util.Instrument(a0, "cloud", "ListAccessPointsPages")
+	r0 := i.Cloud.ListAccessPointsPages(ctx, a1, a2)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedCloud) ListMountTargets(a0 context.Context, a1 string) ([]*MountTarget, error) {
+	ctx, done := util.Instrument(a0, "cloud", "ListMountTargets")
+	r0, r1 := i.Cloud.ListMountTargets(ctx, a1)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) ListPendingAccessPoints(a0 context.Context, a1 map[string]string) ([]*AccessPoint, error) {
+	ctx, done := util.Instrument(a0, "cloud", "ListPendingAccessPoints")
+	r0, r1 := i.Cloud.ListPendingAccessPoints(ctx, a1)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedCloud) MarkAccessPointProvisioned(a0 context.Context, a1 string) error {
+	ctx, done := util.Instrument(a0, "cloud", "MarkAccessPointProvisioned")
+	r0 := i.Cloud.MarkAccessPointProvisioned(ctx, a1)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedCloud) TagResource(a0 context.Context, a1 string, a2 map[string]string) error {
+	ctx, done := util.Instrument(a0, "cloud", "TagResource")
+	r0 := i.Cloud.TagResource(ctx, a1, a2)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedCloud) UntagResource(a0 context.Context, a1 string, a2 []string) error {
+	ctx, done := util.Instrument(a0, "cloud", "UntagResource")
+	r0 := i.Cloud.UntagResource(ctx, a1, a2)
+	done(r0)
+	return r0
+}
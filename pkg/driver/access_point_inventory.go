@@ -0,0 +1,265 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// accessPointInventoryResource is the cluster scoped EFSAccessPoint custom resource, named after the access point ID
+var accessPointInventoryResource = schema.GroupVersionResource{
+	Group:    "efs.csi.aws.com",
+	Version:  "v1alpha1",
+	Resource: "efsaccesspoints",
+}
+
+const (
+	accessPointInventoryKind = "EFSAccessPoint"
+
+	// AccessPointInventoryManagedByLabel marks the EFSAccessPoint objects maintained by the controller
+	AccessPointInventoryManagedByLabel = "app.kubernetes.io/managed-by"
+	// FileSystemIdLabel holds the file system of the access point of an EFSAccessPoint object
+	FileSystemIdLabel = "efs.csi.aws.com/file-system-id"
+)
+
+// accessPointInventorySpec is the spec of an EFSAccessPoint
+type accessPointInventorySpec struct {
+	FileSystemId  string     `json:"fileSystemId"`
+	RootDirectory string     `json:"rootDirectory,omitempty"`
+	PosixUser     *posixUser `json:"posixUser,omitempty"`
+	// PersistentVolumes and PersistentVolumeClaims use the access point, several for a shared access point
+	PersistentVolumes      []string `json:"persistentVolumes,omitempty"`
+	PersistentVolumeClaims []string `json:"persistentVolumeClaims,omitempty"`
+}
+
+type posixUser struct {
+	Uid int64 `json:"uid"`
+	Gid int64 `json:"gid"`
+}
+
+// accessPointInventory keeps one EFSAccessPoint object per access point of the persistent volumes of the
+// driver, so that the access points can be listed without access to the EFS API.
+type accessPointInventory struct {
+	interval  time.Duration
+	resource  dynamic.ResourceInterface
+	k8sClient cloud.KubernetesAPIClient
+}
+
+// newAccessPointInventory returns the inventory synced once per interval, or nil if the interval is 0
+func newAccessPointInventory(interval time.Duration, dynamicClient func() (dynamic.Interface, error), k8sClient cloud.KubernetesAPIClient) (*accessPointInventory, error) {
+	if interval <= 0 {
+		return nil, nil
+	}
+	client, err := dynamicClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic Kubernetes client: %v", err)
+	}
+	return &accessPointInventory{
+		interval:  interval,
+		resource:  client.Resource(accessPointInventoryResource),
+		k8sClient: k8sClient,
+	}, nil
+}
+
+// run syncs the inventory once per interval until stopCh is closed
+func (i *accessPointInventory) run(localCloud cloud.Cloud, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		if err := i.sync(context.Background(), localCloud); err != nil {
+			klog.Warningf("Failed to sync access point inventory: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// sync creates, updates and deletes the EFSAccessPoint objects to match the access points of the persistent
+// volumes of the driver. The objects of a file system whose access points cannot be listed, e.g. because it
+// belongs to another account, are kept as is.
+func (i *accessPointInventory) sync(ctx context.Context, localCloud cloud.Cloud) error {
+	desired, err := i.listVolumeAccessPoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	fileSystemIds := map[string]bool{}
+	for _, spec := range desired {
+		fileSystemIds[spec.FileSystemId] = true
+	}
+	unlisted := map[string]bool{}
+	for fileSystemId := range fileSystemIds {
+		accessPoints, err := localCloud.ListAccessPoints(ctx, fileSystemId)
+		if err != nil {
+			klog.Warningf("Failed to list access points of file system %v, keeping its inventory: %v", fileSystemId, err)
+			unlisted[fileSystemId] = true
+			continue
+		}
+		found := map[string]*cloud.AccessPoint{}
+		for _, ap := range accessPoints {
+			found[ap.AccessPointId] = ap
+		}
+		for apId, spec := range desired {
+			if spec.FileSystemId != fileSystemId {
+				continue
+			}
+			ap, ok := found[apId]
+			if !ok {
+				// The access point was deleted, its persistent volumes are stale
+				delete(desired, apId)
+				continue
+			}
+			spec.RootDirectory = ap.AccessPointRootDir
+			if ap.PosixUser != nil {
+				spec.PosixUser = &posixUser{Uid: ap.PosixUser.Uid, Gid: ap.PosixUser.Gid}
+			}
+		}
+	}
+	for apId, spec := range desired {
+		if unlisted[spec.FileSystemId] {
+			delete(desired, apId)
+		}
+	}
+
+	existing, err := i.resource.List(ctx, metav1.ListOptions{LabelSelector: AccessPointInventoryManagedByLabel + "=" + driverName})
+	if err != nil {
+		return fmt.Errorf("failed to list EFSAccessPoint objects: %v", err)
+	}
+	for idx := range existing.Items {
+		obj := &existing.Items[idx]
+		spec, ok := desired[obj.GetName()]
+		if !ok {
+			if unlisted[obj.GetLabels()[FileSystemIdLabel]] {
+				continue
+			}
+			klog.V(4).Infof("Deleting EFSAccessPoint %s", obj.GetName())
+			if err := i.resource.Delete(ctx, obj.GetName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				klog.Warningf("Failed to delete EFSAccessPoint %s: %v", obj.GetName(), err)
+			}
+			continue
+		}
+		delete(desired, obj.GetName())
+
+		current, err := parseAccessPointInventorySpec(obj)
+		if err == nil && reflect.DeepEqual(current, spec) {
+			continue
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+		if err != nil {
+			return err
+		}
+		obj.Object["spec"] = content
+		klog.V(4).Infof("Updating EFSAccessPoint %s", obj.GetName())
+		if _, err := i.resource.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			klog.Warningf("Failed to update EFSAccessPoint %s: %v", obj.GetName(), err)
+		}
+	}
+
+	for apId, spec := range desired {
+		obj, err := newAccessPointInventoryObject(apId, spec)
+		if err != nil {
+			return err
+		}
+		klog.V(4).Infof("Creating EFSAccessPoint %s", apId)
+		if _, err := i.resource.Create(ctx, obj, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			klog.Warningf("Failed to create EFSAccessPoint %s: %v", apId, err)
+		}
+	}
+	return nil
+}
+
+// listVolumeAccessPoints returns the access points of the persistent volumes of the driver, with their volumes
+func (i *accessPointInventory) listVolumeAccessPoints(ctx context.Context) (map[string]*accessPointInventorySpec, error) {
+	clientset, err := i.k8sClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+
+	accessPoints := map[string]*accessPointInventorySpec{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		fsid, _, apid, err := parseVolumeId(pv.Spec.CSI.VolumeHandle)
+		if err != nil || apid == "" {
+			continue
+		}
+		spec, ok := accessPoints[apid]
+		if !ok {
+			spec = &accessPointInventorySpec{FileSystemId: fsid}
+			accessPoints[apid] = spec
+		}
+		spec.PersistentVolumes = append(spec.PersistentVolumes, pv.Name)
+		if pv.Spec.ClaimRef != nil {
+			spec.PersistentVolumeClaims = append(spec.PersistentVolumeClaims, pv.Spec.ClaimRef.Namespace+"/"+pv.Spec.ClaimRef.Name)
+		}
+	}
+	for _, spec := range accessPoints {
+		sort.Strings(spec.PersistentVolumes)
+		sort.Strings(spec.PersistentVolumeClaims)
+	}
+	return accessPoints, nil
+}
+
+func newAccessPointInventoryObject(accessPointId string, spec *accessPointInventorySpec) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": content}}
+	obj.SetAPIVersion(accessPointInventoryResource.GroupVersion().String())
+	obj.SetKind(accessPointInventoryKind)
+	obj.SetName(accessPointId)
+	obj.SetLabels(map[string]string{
+		AccessPointInventoryManagedByLabel: driverName,
+		FileSystemIdLabel:                  spec.FileSystemId,
+	})
+	return obj, nil
+}
+
+func parseAccessPointInventorySpec(u *unstructured.Unstructured) (*accessPointInventorySpec, error) {
+	content, _, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+	spec := &accessPointInventorySpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
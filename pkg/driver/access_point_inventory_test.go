@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+// fakeResource stores the objects of a cluster scoped resource, ignoring the list options
+type fakeResource struct {
+	dynamic.ResourceInterface
+	objects map[string]*unstructured.Unstructured
+	updates int
+}
+
+func (r *fakeResource) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+	for _, obj := range r.objects {
+		list.Items = append(list.Items, *obj.DeepCopy())
+	}
+	return list, nil
+}
+
+func (r *fakeResource) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if _, ok := r.objects[obj.GetName()]; ok {
+		return nil, apierrors.NewAlreadyExists(accessPointInventoryResource.GroupResource(), obj.GetName())
+	}
+	r.objects[obj.GetName()] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (r *fakeResource) Update(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.objects[obj.GetName()] = obj.DeepCopy()
+	r.updates++
+	return obj, nil
+}
+
+func (r *fakeResource) Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error {
+	if _, ok := r.objects[name]; !ok {
+		return apierrors.NewNotFound(accessPointInventoryResource.GroupResource(), name)
+	}
+	delete(r.objects, name)
+	return nil
+}
+
+func newAccessPointPV(name, volumeHandle, claimNamespace, claimName string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: volumeHandle},
+			},
+			ClaimRef: &corev1.ObjectReference{Namespace: claimNamespace, Name: claimName},
+		},
+	}
+}
+
+func TestAccessPointInventorySync(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+
+	clientset := fake.NewSimpleClientset(
+		newAccessPointPV("pv-1", "fs-abcd1234::fsap-abcd1234", "team-a", "data"),
+		newAccessPointPV("pv-2", "fs-abcd1234::fsap-efgh5678", "team-b", "cache"),
+		newAccessPointPV("pv-3", "fs-abcd1234:/shared:fsap-efgh5678", "team-b", "logs"),
+		newAccessPointPV("pv-4", "fs-abcd1234::fsap-deleted", "team-c", "stale"),
+		newAccessPointPV("pv-5", "fs-efgh5678::fsap-other", "team-d", "data"),
+		newAccessPointPV("pv-6", "fs-abcd1234", "team-e", "static"),
+	)
+	resource := &fakeResource{objects: map[string]*unstructured.Unstructured{}}
+	inventory := &accessPointInventory{
+		resource: resource,
+		k8sClient: func() (kubernetes.Interface, error) {
+			return clientset, nil
+		},
+	}
+
+	// An object of a file system whose access points cannot be listed is kept
+	kept, err := newAccessPointInventoryObject("fsap-other", &accessPointInventorySpec{FileSystemId: "fs-efgh5678", RootDirectory: "/other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.objects["fsap-other"] = kept
+	// An object of an access point no longer used is deleted
+	removed, err := newAccessPointInventoryObject("fsap-removed", &accessPointInventorySpec{FileSystemId: "fs-abcd1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.objects["fsap-removed"] = removed
+
+	ctx := context.Background()
+	accessPoints := []*cloud.AccessPoint{
+		{AccessPointId: "fsap-abcd1234", FileSystemId: "fs-abcd1234", AccessPointRootDir: "/dynamic/pvc-1", PosixUser: &cloud.PosixUser{Uid: 1000, Gid: 2000}},
+		{AccessPointId: "fsap-efgh5678", FileSystemId: "fs-abcd1234", AccessPointRootDir: "/shared"},
+	}
+	mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), "fs-abcd1234").Return(accessPoints, nil).Times(2)
+	mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), "fs-efgh5678").Return(nil, cloud.ErrAccessDenied).Times(2)
+
+	if err := inventory.sync(ctx, mockCloud); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]*accessPointInventorySpec{
+		"fsap-abcd1234": {
+			FileSystemId:           "fs-abcd1234",
+			RootDirectory:          "/dynamic/pvc-1",
+			PosixUser:              &posixUser{Uid: 1000, Gid: 2000},
+			PersistentVolumes:      []string{"pv-1"},
+			PersistentVolumeClaims: []string{"team-a/data"},
+		},
+		"fsap-efgh5678": {
+			FileSystemId:           "fs-abcd1234",
+			RootDirectory:          "/shared",
+			PersistentVolumes:      []string{"pv-2", "pv-3"},
+			PersistentVolumeClaims: []string{"team-b/cache", "team-b/logs"},
+		},
+		"fsap-other": {
+			FileSystemId:  "fs-efgh5678",
+			RootDirectory: "/other",
+		},
+	}
+	if len(resource.objects) != len(expected) {
+		t.Fatalf("Expected objects %v, got %v", expected, resource.objects)
+	}
+	for name, spec := range expected {
+		obj, ok := resource.objects[name]
+		if !ok {
+			t.Fatalf("Expected object %s", name)
+		}
+		actual, err := parseAccessPointInventorySpec(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, spec) {
+			t.Fatalf("Expected spec %+v of %s, got %+v", spec, name, actual)
+		}
+		if obj.GetLabels()[FileSystemIdLabel] != spec.FileSystemId || obj.GetKind() != accessPointInventoryKind {
+			t.Fatalf("Unexpected object %+v", obj)
+		}
+	}
+
+	// A second sync without changes does not update anything
+	if err := inventory.sync(ctx, mockCloud); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resource.updates != 0 {
+		t.Fatalf("Expected no update, got %d", resource.updates)
+	}
+}
+
+func TestNewAccessPointInventory(t *testing.T) {
+	dynamicClient := func() (dynamic.Interface, error) {
+		return nil, errors.New("not in a cluster")
+	}
+	inventory, err := newAccessPointInventory(0, dynamicClient, nil)
+	if inventory != nil || err != nil {
+		t.Fatalf("Expected a disabled inventory, got %v, %v", inventory, err)
+	}
+	if _, err := newAccessPointInventory(time.Minute, dynamicClient, nil); err == nil {
+		t.Fatal("Expected an error without dynamic client")
+	}
+}
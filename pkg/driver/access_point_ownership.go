@@ -0,0 +1,46 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"k8s.io/klog/v2"
+)
+
+// checkAccessPointOwnership checks that the access point found by client token with reuseAccessPoint was
+// created by this cluster. The client token only depends on the PVC name and the storage class parameters,
+// so a cluster may find the access point of another cluster with a claim of the same name. Without a
+// cluster ID every access point is reused. Otherwise an access point tagged with another cluster ID, or
+// not tagged, is only logged, unless strictAPOwnership is set.
+func (d *Driver) checkAccessPointOwnership(ap *cloud.AccessPoint) error {
+	if d.clusterId == "" || ap.ClusterId == d.clusterId {
+		return nil
+	}
+	var err error
+	if ap.ClusterId == "" {
+		err = fmt.Errorf("access point is not tagged with %v, it may belong to another cluster than %v", cloud.ClusterIdTagKey, d.clusterId)
+	} else {
+		err = fmt.Errorf("access point belongs to cluster %v, not %v", ap.ClusterId, d.clusterId)
+	}
+	if d.strictAPOwnership {
+		return err
+	}
+	klog.Warningf("Reusing access point %v of file system %v: %v", ap.AccessPointId, ap.FileSystemId, err)
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+func TestCheckAccessPointOwnership(t *testing.T) {
+	testCases := []struct {
+		name              string
+		clusterId         string
+		strictAPOwnership bool
+		apClusterId       string
+		expectErr         bool
+	}{
+		{
+			name:        "no cluster ID",
+			apClusterId: "cluster-b",
+		},
+		{
+			name:        "same cluster",
+			clusterId:   "cluster-a",
+			apClusterId: "cluster-a",
+		},
+		{
+			name:        "other cluster",
+			clusterId:   "cluster-a",
+			apClusterId: "cluster-b",
+		},
+		{
+			name:      "untagged",
+			clusterId: "cluster-a",
+		},
+		{
+			name:              "same cluster, strict",
+			clusterId:         "cluster-a",
+			strictAPOwnership: true,
+			apClusterId:       "cluster-a",
+		},
+		{
+			name:              "other cluster, strict",
+			clusterId:         "cluster-a",
+			strictAPOwnership: true,
+			apClusterId:       "cluster-b",
+			expectErr:         true,
+		},
+		{
+			name:              "untagged, strict",
+			clusterId:         "cluster-a",
+			strictAPOwnership: true,
+			expectErr:         true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &Driver{
+				clusterId:         tc.clusterId,
+				strictAPOwnership: tc.strictAPOwnership,
+			}
+			err := d.checkAccessPointOwnership(&cloud.AccessPoint{
+				AccessPointId: "fsap-abcd1234xyz987",
+				FileSystemId:  "fs-abcd1234",
+				ClusterId:     tc.apClusterId,
+			})
+			if tc.expectErr && err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
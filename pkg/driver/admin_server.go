@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+const (
+	adminForceUnmountPath = "/admin/force-unmount"
+
+	// adminReadTimeout bounds the time to read a request of the admin socket
+	adminReadTimeout = 10 * time.Second
+	// adminWriteTimeout bounds the time to serve a request of the admin socket, e.g. a CreateVolume simulation
+	// calling the EFS API
+	adminWriteTimeout = 2 * time.Minute
+)
+
+// forceUnmountRequest is the JSON body of a force unmount request of the admin socket
+type forceUnmountRequest struct {
+	TargetPath string `json:"targetPath"`
+	// VolumeId is the volume mounted at the target path, whose metrics and cached stats are dropped if set
+	VolumeId string `json:"volumeId,omitempty"`
+	// Lazy detaches the mount even if it is busy, instead of failing
+	Lazy bool `json:"lazy,omitempty"`
+}
+
+type forceUnmountResponse struct {
+	TargetPath string `json:"targetPath"`
+	Unmounted  bool   `json:"unmounted"`
+	Error      string `json:"error,omitempty"`
+}
+
+// forceUnmount unmounts the target with force, even if the NFS server does not respond, and detaches it if lazy.
+// A symbolic link at the target, e.g. created by a pod in its volume directory, is not followed.
+var forceUnmount = func(target string, lazy bool) error {
+	flags := unix.MNT_FORCE | unix.UMOUNT_NOFOLLOW
+	if lazy {
+		flags |= unix.MNT_DETACH
+	}
+	return unix.Unmount(target, flags)
+}
+
+// startAdminServer serves the break-glass operations of the node, and the CreateVolume simulations of the
+// controller, on the unix domain socket at socketPath in the background. Only the owner of the socket, root, may
+// connect, e.g. from the node with
+// curl --unix-socket <socketPath> -d '{"targetPath": "..."}' http://localhost/admin/force-unmount
+func (d *Driver) startAdminServer(socketPath string) error {
+	listener, err := listenAdminSocket(socketPath)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	if d.mode.servesNode() {
+		mux.Handle(adminForceUnmountPath, d.forceUnmountHandler())
+	}
+	if d.mode.servesController() {
+		mux.Handle(adminSimulateCreateVolumePath, d.simulateCreateVolumeHandler())
+	}
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  adminReadTimeout,
+		WriteTimeout: adminWriteTimeout,
+	}
+	go func() {
+		klog.Infof("Serving admin operations on %s", socketPath)
+		if err := server.Serve(listener); err != nil {
+			klog.Errorf("Admin server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// listenAdminSocket listens on the socket at socketPath, reserved to its owner. The socket is created in a
+// private directory, where it is restricted before being renamed to socketPath, so that no other user may
+// connect to it in between.
+func listenAdminSocket(socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0750); err != nil {
+		return nil, err
+	}
+	privateDir, err := os.MkdirTemp(filepath.Dir(socketPath), ".admin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(privateDir)
+	tmp := filepath.Join(privateDir, filepath.Base(socketPath))
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, socketPath); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("could not move admin socket %q to %q: %v", tmp, socketPath, err)
+	}
+	return listener, nil
+}
+
+func (d *Driver) forceUnmountHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req := &forceUnmountRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		res, code := d.forceUnmountTarget(req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			klog.Warningf("Failed to write force unmount response: %v", err)
+		}
+	})
+}
+
+// forceUnmountTarget unmounts the target path of a pod with force, then cleans the state NodeUnpublishVolume
+// would have cleaned, so that the next NodeUnpublishVolume of the target succeeds
+func (d *Driver) forceUnmountTarget(req *forceUnmountRequest) (*forceUnmountResponse, int) {
+	target := filepath.Clean(req.TargetPath)
+	res := &forceUnmountResponse{TargetPath: target}
+	podsDir := filepath.Join(d.kubeletDir, "pods") + "/"
+	if !filepath.IsAbs(req.TargetPath) || !strings.HasPrefix(target, podsDir) {
+		res.Error = fmt.Sprintf("target path must be a volume path of a pod, under %s", podsDir)
+		return res, http.StatusBadRequest
+	}
+
+	// The mount table is read without accessing the target, which may hang on an unresponsive server
+	_, refCount, err := d.mounter.GetDeviceName(target)
+	if err != nil {
+		res.Error = fmt.Sprintf("failed to check if %s is mounted: %v", target, err)
+		return res, http.StatusInternalServerError
+	}
+	if refCount > 0 {
+		klog.Warningf("Force unmounting %s (lazy: %t) on admin request", target, req.Lazy)
+		if err := forceUnmount(target, req.Lazy); err != nil {
+			res.Error = fmt.Sprintf("failed to force unmount %s: %v", target, err)
+			return res, http.StatusInternalServerError
+		}
+		res.Unmounted = true
+	}
+
+	if err := d.releaseSharedMount(target); err != nil {
+		res.Error = err.Error()
+		return res, http.StatusInternalServerError
+	}
+	if req.VolumeId != "" {
+		d.mountStats.remove(req.VolumeId, target)
+		if res.Unmounted {
+			d.uncountPublishedVolume(req.VolumeId, target)
+		}
+	}
+	return res, http.StatusOK
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestForceUnmountTarget(t *testing.T) {
+	kubeletDir := "/var/lib/kubelet"
+	target := kubeletDir + "/pods/uid/volumes/kubernetes.io~csi/pv-1/mount"
+
+	testCases := []struct {
+		name            string
+		req             *forceUnmountRequest
+		refCount        int
+		unmountErr      error
+		expectUnmount   bool
+		expectLazy      bool
+		expectCode      int
+		expectUnmounted bool
+	}{
+		{
+			name:            "success: stuck mount",
+			req:             &forceUnmountRequest{TargetPath: target, VolumeId: "fs-abcd1234", Lazy: true},
+			refCount:        1,
+			expectUnmount:   true,
+			expectLazy:      true,
+			expectCode:      http.StatusOK,
+			expectUnmounted: true,
+		},
+		{
+			name:       "success: not mounted",
+			req:        &forceUnmountRequest{TargetPath: target},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:          "fail: unmount error",
+			req:           &forceUnmountRequest{TargetPath: target},
+			refCount:      1,
+			unmountErr:    errors.New("device busy"),
+			expectUnmount: true,
+			expectCode:    http.StatusInternalServerError,
+		},
+		{
+			name:       "fail: path outside of the pods",
+			req:        &forceUnmountRequest{TargetPath: kubeletDir + "/pods/../plugins"},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "fail: relative path",
+			req:        &forceUnmountRequest{TargetPath: "pods/uid"},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter := mocks.NewMockMounter(mockCtrl)
+			driver := &Driver{mounter: mockMounter, kubeletDir: kubeletDir, volStatter: NewVolStatter(), volMetricsOptIn: true}
+			if tc.expectCode != http.StatusBadRequest {
+				mockMounter.EXPECT().GetDeviceName(target).Return("", tc.refCount, nil)
+			}
+
+			unmounted := false
+			defer func(f func(string, bool) error) { forceUnmount = f }(forceUnmount)
+			forceUnmount = func(path string, lazy bool) error {
+				unmounted = true
+				if path != target || lazy != tc.expectLazy {
+					t.Fatalf("Unexpected force unmount of %s (lazy: %t)", path, lazy)
+				}
+				return tc.unmountErr
+			}
+			volumeIdCounter[tc.req.VolumeId] = 1
+
+			res, code := driver.forceUnmountTarget(tc.req)
+			if code != tc.expectCode || res.Unmounted != tc.expectUnmounted || unmounted != tc.expectUnmount {
+				t.Fatalf("Expected code %d, unmounted %t, got %d, %+v (force unmount called: %t)", tc.expectCode, tc.expectUnmounted, code, res, unmounted)
+			}
+			if _, counted := volumeIdCounter[tc.req.VolumeId]; counted == tc.expectUnmounted {
+				t.Fatalf("Expected the volume counted: %t", !tc.expectUnmounted)
+			}
+			delete(volumeIdCounter, tc.req.VolumeId)
+		})
+	}
+}
+
+func TestAdminServer(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter := mocks.NewMockMounter(mockCtrl)
+	driver := &Driver{mounter: mockMounter, kubeletDir: "/var/lib/kubelet"}
+	target := "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount"
+	mockMounter.EXPECT().GetDeviceName(target).Return("", 0, nil)
+
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+	if err := driver.startAdminServer(socketPath); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(socketPath)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the socket to be reserved to its owner, got %v: %v", info, err)
+	}
+	// The private directory where the socket was restricted is removed
+	if entries, err := os.ReadDir(filepath.Dir(socketPath)); err != nil || len(entries) != 1 {
+		t.Fatalf("Expected the socket only, got %v: %v", entries, err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Post("http://localhost"+adminForceUnmountPath, "application/json", strings.NewReader(`{"targetPath": "`+target+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	res := &forceUnmountResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || res.TargetPath != target || res.Unmounted {
+		t.Fatalf("Unexpected response %d: %+v", resp.StatusCode, res)
+	}
+
+	resp, err = client.Get("http://localhost" + adminForceUnmountPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected GET to be rejected, got %d", resp.StatusCode)
+	}
+}
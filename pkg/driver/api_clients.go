@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// apiClients caches the clouds calling the EFS APIs other than the one of the driver, one per unique
+// API config, so that one controller serves storage classes backed by file systems in several regions,
+// partitions or accounts without creating a client, and assuming a role, on every request.
+// A nil apiClients is valid and creates a cloud on every call.
+type apiClients struct {
+	newCloud func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error)
+
+	mu     sync.Mutex
+	clouds map[cloud.APIConfig]cloud.Cloud
+}
+
+func newAPIClients() *apiClients {
+	return &apiClients{
+		newCloud: cloud.NewCloudWithAPIConfig,
+		clouds:   map[cloud.APIConfig]cloud.Cloud{},
+	}
+}
+
+// get returns the cloud of the API config, creating it on first use
+func (c *apiClients) get(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+	if c == nil {
+		return cloud.NewCloudWithAPIConfig(apiConfig, options)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if localCloud, ok := c.clouds[apiConfig]; ok {
+		return localCloud, nil
+	}
+	localCloud, err := c.newCloud(apiConfig, options)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(4).Infof("Created EFS API client for region %q, endpoint %q and role %q", apiConfig.Region, apiConfig.Endpoint, apiConfig.RoleArn)
+	c.clouds[apiConfig] = localCloud
+	return localCloud, nil
+}
+
+// parseAPIConfig returns the API config of the storage class parameters, or of the secrets of DeleteVolume
+func parseAPIConfig(values map[string]string) (cloud.APIConfig, error) {
+	apiConfig := cloud.APIConfig{
+		Region:   strings.TrimSpace(values[APIRegion]),
+		Endpoint: strings.TrimSpace(values[APIEndpoint]),
+		RoleArn:  strings.TrimSpace(values[APIRoleArn]),
+	}
+	if apiConfig.Endpoint != "" {
+		if !cloud.IsEndpointURL(apiConfig.Endpoint) {
+			return apiConfig, fmt.Errorf("%v %q must be an http or https URL", APIEndpoint, apiConfig.Endpoint)
+		}
+	}
+	if apiConfig.RoleArn != "" && !cloud.IsArn(apiConfig.RoleArn) {
+		return apiConfig, fmt.Errorf("%v %q must be the ARN of an IAM role", APIRoleArn, apiConfig.RoleArn)
+	}
+	return apiConfig, nil
+}
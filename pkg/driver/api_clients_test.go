@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestAPIClientsGet(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	created := map[cloud.APIConfig]int{}
+	fail := true
+	clients := newAPIClients()
+	clients.newCloud = func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+		created[apiConfig]++
+		if apiConfig.RoleArn != "" && fail {
+			return nil, errors.New("failed to assume role")
+		}
+		return mocks.NewMockCloud(mockCtl), nil
+	}
+
+	west := cloud.APIConfig{Region: "us-west-2"}
+	first, err := clients.get(west, cloud.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := clients.get(west, cloud.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first != second || created[west] != 1 {
+		t.Fatalf("Expected the cloud of %+v to be created once, created %d times", west, created[west])
+	}
+
+	withEndpoint := cloud.APIConfig{Region: "us-west-2", Endpoint: "https://vpce.example.com"}
+	if other, _ := clients.get(withEndpoint, cloud.Options{}); other == first {
+		t.Fatalf("Expected another cloud for %+v", withEndpoint)
+	}
+
+	// Failures are not cached, so that the role may be fixed without restarting the controller
+	withRole := cloud.APIConfig{Region: "us-west-2", RoleArn: "arn:aws:iam::111122223333:role/EFSRole"}
+	if _, err := clients.get(withRole, cloud.Options{}); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	fail = false
+	if _, err := clients.get(withRole, cloud.Options{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created[withRole] != 2 {
+		t.Fatalf("Expected the cloud of %+v to be created twice, created %d times", withRole, created[withRole])
+	}
+}
+
+func TestParseAPIConfig(t *testing.T) {
+	testCases := []struct {
+		name      string
+		values    map[string]string
+		expect    cloud.APIConfig
+		expectErr bool
+	}{
+		{
+			name:   "Success: empty",
+			values: map[string]string{},
+		},
+		{
+			name:   "Success: all set",
+			values: map[string]string{APIRegion: " us-gov-west-1", APIEndpoint: "https://efs.us-gov-west-1.amazonaws.com", APIRoleArn: "arn:aws-us-gov:iam::111122223333:role/EFSRole"},
+			expect: cloud.APIConfig{Region: "us-gov-west-1", Endpoint: "https://efs.us-gov-west-1.amazonaws.com", RoleArn: "arn:aws-us-gov:iam::111122223333:role/EFSRole"},
+		},
+		{
+			name:      "Fail: endpoint without scheme",
+			values:    map[string]string{APIEndpoint: "efs.us-east-1.amazonaws.com"},
+			expectErr: true,
+		},
+		{
+			name:      "Fail: role is not an ARN",
+			values:    map[string]string{APIRoleArn: "EFSRole"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiConfig, err := parseAPIConfig(tc.values)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if apiConfig != tc.expect {
+				t.Fatalf("Expected %+v, got %+v", tc.expect, apiConfig)
+			}
+		})
+	}
+}
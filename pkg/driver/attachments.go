@@ -0,0 +1,239 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// attachmentsRestoreRetryInterval is the interval between the attempts to restore the attachments
+const attachmentsRestoreRetryInterval = 10 * time.Second
+
+var (
+	errVolumeAttachLimit = errors.New("volume attach limit reached")
+	// errAttachmentsNotRestored is returned while the attachments published before the controller started
+	// are not restored, as the limits cannot be enforced without them
+	errAttachmentsNotRestored = errors.New("volume attachments not restored yet")
+	// errVolumePublishedToOtherNode is returned when a volume with a single node access mode is already
+	// published to another node
+	errVolumePublishedToOtherNode = errors.New("volume published to another node")
+)
+
+// attachmentTracker records the volumes published to every node by ControllerPublishVolume. Publishing
+// an EFS volume is a no-op, the attachments are only recorded for observability, to enforce the
+// volume attach limit of the nodes and, if singleNodeWriter is set, to publish the volumes with a
+// single node access mode to one node at a time, as EFS would mount them on any number of nodes.
+type attachmentTracker struct {
+	limit            int
+	singleNodeWriter bool
+
+	mu    sync.Mutex
+	nodes map[string]map[string]bool
+	// singleNode has the volumes published with a single node access mode
+	singleNode map[string]bool
+
+	// restored is closed once the attachments published before the controller started are restored
+	restored     chan struct{}
+	restoredOnce sync.Once
+}
+
+// newAttachmentTracker returns a tracker allowing up to limit volumes per node, or any number if 0
+func newAttachmentTracker(limit int, singleNodeWriter bool) *attachmentTracker {
+	return &attachmentTracker{
+		limit:            limit,
+		singleNodeWriter: singleNodeWriter,
+		nodes:            map[string]map[string]bool{},
+		singleNode:       map[string]bool{},
+		restored:         make(chan struct{}),
+	}
+}
+
+// markRestored lets the volumes be attached, once the attachments published before are restored
+func (t *attachmentTracker) markRestored() {
+	t.restoredOnce.Do(func() {
+		close(t.restored)
+	})
+}
+
+// attach records the volume as published to the node. It is idempotent and returns
+// errAttachmentsNotRestored until the attachments are restored, errVolumeAttachLimit if the node already
+// has the maximum number of volumes, or errVolumePublishedToOtherNode if singleNodeWriter is set and the
+// volume is published to another node while either publication has a single node access mode.
+func (t *attachmentTracker) attach(volumeId, nodeId string, singleNode bool) error {
+	select {
+	case <-t.restored:
+	default:
+		return errAttachmentsNotRestored
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	volumes, ok := t.nodes[nodeId]
+	if !ok {
+		volumes = map[string]bool{}
+		t.nodes[nodeId] = volumes
+	}
+	if volumes[volumeId] {
+		return nil
+	}
+	if t.singleNodeWriter && (singleNode || t.singleNode[volumeId]) {
+		for node, nodeVolumes := range t.nodes {
+			if node != nodeId && nodeVolumes[volumeId] {
+				if len(volumes) == 0 {
+					delete(t.nodes, nodeId)
+				}
+				return fmt.Errorf("%w %s", errVolumePublishedToOtherNode, node)
+			}
+		}
+	}
+	if t.limit > 0 && len(volumes) >= t.limit {
+		return errVolumeAttachLimit
+	}
+	volumes[volumeId] = true
+	if singleNode {
+		t.singleNode[volumeId] = true
+	}
+	attachedVolumes.WithLabelValues(nodeId).Set(float64(len(volumes)))
+	return nil
+}
+
+// detach removes the volume from the node, or from every node if nodeId is empty
+func (t *attachmentTracker) detach(volumeId, nodeId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	published := false
+	for node, volumes := range t.nodes {
+		if nodeId != "" && node != nodeId {
+			published = published || volumes[volumeId]
+			continue
+		}
+		delete(volumes, volumeId)
+		if len(volumes) == 0 {
+			delete(t.nodes, node)
+			attachedVolumes.DeleteLabelValues(node)
+		} else {
+			attachedVolumes.WithLabelValues(node).Set(float64(len(volumes)))
+		}
+	}
+	if !published {
+		delete(t.singleNode, volumeId)
+	}
+}
+
+// count returns the number of volumes published to the node
+func (t *attachmentTracker) count(nodeId string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.nodes[nodeId])
+}
+
+// restoreUntilSucceed restores the attachments, retrying every interval until it succeeds
+func (t *attachmentTracker) restoreUntilSucceed(interval time.Duration, k8sClient cloud.KubernetesAPIClient) {
+	for {
+		err := t.restore(context.Background(), k8sClient)
+		if err == nil {
+			return
+		}
+		klog.Warningf("Failed to restore volume attachments, retrying in %v: %v", interval, err)
+		time.Sleep(interval)
+	}
+}
+
+// restore records the attachments of the VolumeAttachment objects of the driver, so that the volumes
+// published before the controller restarted count towards the limit. The external-attacher does not
+// call ControllerPublishVolume again for them. The volumes are attached only once they are restored.
+func (t *attachmentTracker) restore(ctx context.Context, k8sClient cloud.KubernetesAPIClient) error {
+	clientset, err := k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	attachments, err := clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list volume attachments: %v", err)
+	}
+	// VolumeAttachments refer to the persistent volume, whose volume handle is the volume ID. The access
+	// modes of the volume are those of the persistent volume.
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+	volumeIds := map[string]string{}
+	singleNodeVolumes := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == driverName {
+			volumeIds[pv.Name] = pv.Spec.CSI.VolumeHandle
+			for _, mode := range pv.Spec.AccessModes {
+				if mode == corev1.ReadWriteOnce || mode == corev1.ReadWriteOncePod {
+					singleNodeVolumes[pv.Name] = true
+				}
+			}
+		}
+	}
+	// VolumeAttachments refer to the Kubernetes node, whose CSINode has the ID of the node in the driver
+	csiNodes, err := clientset.StorageV1().CSINodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list CSI nodes: %v", err)
+	}
+	nodeIds := map[string]string{}
+	for _, csiNode := range csiNodes.Items {
+		for _, driver := range csiNode.Spec.Drivers {
+			if driver.Name == driverName {
+				nodeIds[csiNode.Name] = driver.NodeID
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	restored := 0
+	for _, va := range attachments.Items {
+		if va.Spec.Attacher != driverName || va.Spec.Source.PersistentVolumeName == nil || !va.Status.Attached {
+			continue
+		}
+		volumeId, ok := volumeIds[*va.Spec.Source.PersistentVolumeName]
+		if !ok {
+			continue
+		}
+		nodeId, ok := nodeIds[va.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		volumes, ok := t.nodes[nodeId]
+		if !ok {
+			volumes = map[string]bool{}
+			t.nodes[nodeId] = volumes
+		}
+		volumes[volumeId] = true
+		if singleNodeVolumes[*va.Spec.Source.PersistentVolumeName] {
+			t.singleNode[volumeId] = true
+		}
+		attachedVolumes.WithLabelValues(nodeId).Set(float64(len(volumes)))
+		restored++
+	}
+	t.markRestored()
+	klog.Infof("Restored %d volume attachments", restored)
+	return nil
+}
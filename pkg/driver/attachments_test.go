@@ -0,0 +1,174 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAttachmentTrackerLimit(t *testing.T) {
+	tracker := newRestoredAttachmentTracker(2, false)
+	for _, volumeId := range []string{"fs-1", "fs-2", "fs-2"} {
+		if err := tracker.attach(volumeId, "i-1", false); err != nil {
+			t.Fatalf("Failed to attach %s: %v", volumeId, err)
+		}
+	}
+	if err := tracker.attach("fs-3", "i-1", false); err != errVolumeAttachLimit {
+		t.Fatalf("Expected %v, got %v", errVolumeAttachLimit, err)
+	}
+	// The limit is per node
+	if err := tracker.attach("fs-3", "i-2", false); err != nil {
+		t.Fatalf("Failed to attach fs-3 to another node: %v", err)
+	}
+	tracker.detach("fs-1", "i-1")
+	if err := tracker.attach("fs-3", "i-1", false); err != nil {
+		t.Fatalf("Failed to attach fs-3 after detaching fs-1: %v", err)
+	}
+}
+
+func TestAttachmentTrackerSingleNodeWriter(t *testing.T) {
+	tracker := newRestoredAttachmentTracker(0, true)
+	if err := tracker.attach("fs-1", "i-1", true); err != nil {
+		t.Fatalf("Failed to attach fs-1: %v", err)
+	}
+	if err := tracker.attach("fs-1", "i-1", true); err != nil {
+		t.Fatalf("Expected attaching fs-1 again to the same node to succeed, got %v", err)
+	}
+	// Neither a single node nor a multi node publication to another node is allowed
+	for _, singleNode := range []bool{true, false} {
+		if err := tracker.attach("fs-1", "i-2", singleNode); !errors.Is(err, errVolumePublishedToOtherNode) {
+			t.Fatalf("Expected %v, got %v", errVolumePublishedToOtherNode, err)
+		}
+	}
+	if tracker.count("i-2") != 0 {
+		t.Fatalf("Expected nothing published to i-2, got %v", tracker.nodes)
+	}
+	tracker.detach("fs-1", "i-1")
+	if err := tracker.attach("fs-1", "i-2", true); err != nil {
+		t.Fatalf("Failed to attach fs-1 after detaching it: %v", err)
+	}
+
+	// A volume published to several nodes cannot be published with a single node access mode
+	for _, nodeId := range []string{"i-1", "i-2"} {
+		if err := tracker.attach("fs-2", nodeId, false); err != nil {
+			t.Fatalf("Failed to attach fs-2 to %s: %v", nodeId, err)
+		}
+	}
+	if err := tracker.attach("fs-2", "i-3", true); !errors.Is(err, errVolumePublishedToOtherNode) {
+		t.Fatalf("Expected %v, got %v", errVolumePublishedToOtherNode, err)
+	}
+
+	// Without enforcement, single node volumes are published to any number of nodes
+	tracker = newRestoredAttachmentTracker(0, false)
+	for _, nodeId := range []string{"i-1", "i-2"} {
+		if err := tracker.attach("fs-1", nodeId, true); err != nil {
+			t.Fatalf("Failed to attach fs-1 to %s: %v", nodeId, err)
+		}
+	}
+}
+
+func TestAttachmentTrackerRestore(t *testing.T) {
+	pvName, otherPvName := "pv-efs", "pv-other"
+	clientset := fake.NewSimpleClientset(
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: pvName},
+			Spec: corev1.PersistentVolumeSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: "fs-abcd1234::fsap-abcd1234"},
+				},
+			},
+		},
+		&storagev1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Spec: storagev1.CSINodeSpec{
+				Drivers: []storagev1.CSINodeDriver{{Name: driverName, NodeID: "i-1"}},
+			},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "attached"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: driverName,
+				NodeName: "node-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: true},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "attaching"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: driverName,
+				NodeName: "node-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &otherPvName},
+			},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-driver"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: "ebs.csi.aws.com",
+				NodeName: "node-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &otherPvName},
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: true},
+		},
+	)
+
+	tracker := newAttachmentTracker(0, true)
+	err := tracker.restore(context.Background(), func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to restore attachments: %v", err)
+	}
+	if !tracker.nodes["i-1"]["fs-abcd1234::fsap-abcd1234"] || tracker.count("i-1") != 1 {
+		t.Fatalf("Expected the attached volume to be restored, got %v", tracker.nodes)
+	}
+	if err := tracker.attach("fs-abcd1234::fsap-abcd1234", "i-2", false); !errors.Is(err, errVolumePublishedToOtherNode) {
+		t.Fatalf("Expected the restored ReadWriteOnce volume to only be published to i-1, got %v", err)
+	}
+}
+
+// newRestoredAttachmentTracker returns a tracker that accepts attachments right away
+func newRestoredAttachmentTracker(limit int, singleNodeWriter bool) *attachmentTracker {
+	t := newAttachmentTracker(limit, singleNodeWriter)
+	t.markRestored()
+	return t
+}
+
+func TestAttachmentTrackerNotRestored(t *testing.T) {
+	tracker := newAttachmentTracker(0, false)
+	if err := tracker.attach("fs-1", "i-1", false); err != errAttachmentsNotRestored {
+		t.Fatalf("Expected %v, got %v", errAttachmentsNotRestored, err)
+	}
+	err := tracker.restore(context.Background(), func() (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(), nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to restore attachments: %v", err)
+	}
+	if err := tracker.attach("fs-1", "i-1", false); err != nil {
+		t.Fatalf("Expected the volume to be attached once restored, got %v", err)
+	}
+}
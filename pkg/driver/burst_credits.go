@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// BurstCreditCheckWarn provisions the volumes of the file systems low on burst credits, recording an event
+	BurstCreditCheckWarn = "warn"
+	// BurstCreditCheckFail fails the provisioning of the volumes of the file systems low on burst credits
+	BurstCreditCheckFail = "fail"
+
+	// BurstCreditsLowEventReason is the reason of the events of the claims provisioned on a file system low on
+	// burst credits
+	BurstCreditsLowEventReason = "BurstCreditsLow"
+)
+
+// burstCreditCheck checks at CreateVolume that the file system in bursting throughput mode has burst credits
+// left, as the workloads of volumes provisioned on a file system out of credits are throttled to its baseline
+// throughput from the start. The balance is the BurstCreditBalance metric that EFS reports to CloudWatch.
+// The file systems in elastic or provisioned throughput mode are not checked. Neither are the file systems
+// of other accounts, whose metrics the driver cannot read. A failure to read the balance is logged and does
+// not fail the provisioning. A nil burstCreditCheck is valid and checks nothing.
+type burstCreditCheck struct {
+	policy     string
+	minBalance int64
+	cloudWatch cloud.CloudWatch
+	k8sClient  cloud.KubernetesAPIClient
+}
+
+// newBurstCreditCheck returns the check of the policy, or nil if the policy is empty
+func newBurstCreditCheck(policy string, minBalance int64, cloudWatch cloud.CloudWatch, k8sClient cloud.KubernetesAPIClient) (*burstCreditCheck, error) {
+	if minBalance < 0 {
+		return nil, fmt.Errorf("burst-credit-min-balance %d must not be negative", minBalance)
+	}
+	switch policy {
+	case "":
+		return nil, nil
+	case BurstCreditCheckWarn, BurstCreditCheckFail:
+	default:
+		return nil, fmt.Errorf("invalid burst credit check %q, must be %s or %s", policy, BurstCreditCheckWarn, BurstCreditCheckFail)
+	}
+	return &burstCreditCheck{
+		policy:     policy,
+		minBalance: minBalance,
+		cloudWatch: cloudWatch,
+		k8sClient:  k8sClient,
+	}, nil
+}
+
+// check checks the burst credits of the file system of the volume. It returns an error if the policy is fail
+// and the balance is at or below the minimum.
+func (c *burstCreditCheck) check(ctx context.Context, fs *cloud.FileSystem, volName string, volumeParams map[string]string) error {
+	if c == nil || fs == nil || fs.ThroughputMode != cloud.ThroughputModeBursting || fs.FileSystemArn == "" {
+		return nil
+	}
+	balance, found, err := c.cloudWatch.BurstCreditBalance(ctx, fs.FileSystemArn)
+	if err != nil {
+		klog.Warningf("Failed to get the burst credit balance of file system %s, provisioning volume %s without checking it: %v", fs.FileSystemId, volName, err)
+		return nil
+	}
+	if !found {
+		klog.V(4).Infof("File system %s reported no burst credit balance recently, provisioning volume %s without checking it", fs.FileSystemId, volName)
+		return nil
+	}
+	burstCreditBalanceBytes.WithLabelValues(fs.FileSystemId).Set(balance)
+	if balance > float64(c.minBalance) {
+		return nil
+	}
+
+	message := fmt.Sprintf("File system %s has a burst credit balance of %.0f bytes, at or below the minimum of %d bytes: the throughput of its volumes is limited to its baseline", fs.FileSystemId, balance, c.minBalance)
+	if c.policy == BurstCreditCheckFail {
+		lowBurstCreditProvisions.WithLabelValues(fs.FileSystemId, "failed").Inc()
+		return status.Errorf(codes.FailedPrecondition, "%s", message)
+	}
+	lowBurstCreditProvisions.WithLabelValues(fs.FileSystemId, "warned").Inc()
+	klog.Warningf("Provisioning volume %s: %s", volName, message)
+	if err := c.recordEvent(ctx, volumeParams, message); err != nil {
+		klog.Warningf("Failed to record the low burst credits of file system %s on the claim of volume %s: %v", fs.FileSystemId, volName, err)
+	}
+	return nil
+}
+
+// recordEvent records a warning event on the claim of the volume, if it is known from the parameters
+// passed by the external-provisioner with --extra-create-metadata
+func (c *burstCreditCheck) recordEvent(ctx context.Context, volumeParams map[string]string, message string) error {
+	pvcName, pvcNamespace := volumeParams[PvcName], volumeParams[PvcNamespace]
+	if pvcName == "" || pvcNamespace == "" {
+		return nil
+	}
+	clientset, err := c.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	// The UID of the claim is required for the event to be listed by kubectl describe
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(pvcNamespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get claim: %v", err)
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pvcName + ".",
+			Namespace:    pvcNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "PersistentVolumeClaim",
+			Namespace:       pvcNamespace,
+			Name:            pvcName,
+			UID:             pvc.UID,
+			ResourceVersion: pvc.ResourceVersion,
+		},
+		Reason:         BurstCreditsLowEventReason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: driverName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err = clientset.CoreV1().Events(pvcNamespace).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
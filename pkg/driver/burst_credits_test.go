@@ -0,0 +1,170 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const testBurstFileSystemArn = "arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/fs-abcd1234"
+
+// fakeCloudWatch returns the balance of the file system of testBurstFileSystemArn
+type fakeCloudWatch struct {
+	balance float64
+	found   bool
+	err     error
+	calls   int
+}
+
+func (f *fakeCloudWatch) BurstCreditBalance(ctx context.Context, fileSystemArn string) (float64, bool, error) {
+	f.calls++
+	if fileSystemArn != testBurstFileSystemArn {
+		return 0, false, cloud.ErrNotFound
+	}
+	return f.balance, f.found, f.err
+}
+
+func TestNewBurstCreditCheck(t *testing.T) {
+	if c, err := newBurstCreditCheck("", 0, nil, nil); c != nil || err != nil {
+		t.Errorf("Expected no check without policy, got %v: %v", c, err)
+	}
+	if _, err := newBurstCreditCheck("block", 0, nil, nil); err == nil {
+		t.Errorf("Expected an error for an invalid policy")
+	}
+	if _, err := newBurstCreditCheck(BurstCreditCheckWarn, -1, nil, nil); err == nil {
+		t.Errorf("Expected an error for a negative minimum balance")
+	}
+	if c, err := newBurstCreditCheck(BurstCreditCheckFail, 1<<30, nil, nil); c == nil || err != nil {
+		t.Errorf("Expected a check, got %v: %v", c, err)
+	}
+}
+
+func TestBurstCreditCheck(t *testing.T) {
+	bursting := &cloud.FileSystem{FileSystemId: "fs-abcd1234", FileSystemArn: testBurstFileSystemArn, ThroughputMode: cloud.ThroughputModeBursting}
+	testCases := []struct {
+		name         string
+		policy       string
+		fs           *cloud.FileSystem
+		cloudWatch   *fakeCloudWatch
+		expectCall   bool
+		expectEvent  bool
+		expectedCode codes.Code
+	}{
+		{
+			name:       "Success: balance above the minimum",
+			policy:     BurstCreditCheckFail,
+			fs:         bursting,
+			cloudWatch: &fakeCloudWatch{balance: 2 << 30, found: true},
+			expectCall: true,
+		},
+		{
+			name:        "Success: low balance reported",
+			policy:      BurstCreditCheckWarn,
+			fs:          bursting,
+			cloudWatch:  &fakeCloudWatch{balance: 1 << 20, found: true},
+			expectCall:  true,
+			expectEvent: true,
+		},
+		{
+			name:       "Success: elastic throughput not checked",
+			policy:     BurstCreditCheckFail,
+			fs:         &cloud.FileSystem{FileSystemId: "fs-abcd1234", FileSystemArn: testBurstFileSystemArn, ThroughputMode: "elastic"},
+			cloudWatch: &fakeCloudWatch{found: true},
+		},
+		{
+			name:       "Success: no balance reported",
+			policy:     BurstCreditCheckFail,
+			fs:         bursting,
+			cloudWatch: &fakeCloudWatch{},
+			expectCall: true,
+		},
+		{
+			name:       "Success: balance not readable",
+			policy:     BurstCreditCheckFail,
+			fs:         bursting,
+			cloudWatch: &fakeCloudWatch{err: cloud.ErrAccessDenied},
+			expectCall: true,
+		},
+		{
+			name:         "Fail: low balance",
+			policy:       BurstCreditCheckFail,
+			fs:           bursting,
+			cloudWatch:   &fakeCloudWatch{balance: 1 << 20, found: true},
+			expectCall:   true,
+			expectedCode: codes.FailedPrecondition,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data", UID: "uid-1"}}
+			clientset := fake.NewSimpleClientset(pvc)
+			check, err := newBurstCreditCheck(tc.policy, 1<<30, tc.cloudWatch, func() (kubernetes.Interface, error) { return clientset, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			err = check.check(ctx, tc.fs, "pvc-1", map[string]string{PvcName: "data", PvcNamespace: "team-a"})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+			if tc.expectCall != (tc.cloudWatch.calls == 1) {
+				t.Fatalf("Expected the balance read %v, got %d calls", tc.expectCall, tc.cloudWatch.calls)
+			}
+			events, err := clientset.CoreV1().Events("team-a").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectEvent != (len(events.Items) == 1) {
+				t.Fatalf("Expected event %v, got %v", tc.expectEvent, events.Items)
+			}
+			if tc.expectEvent && (events.Items[0].Reason != BurstCreditsLowEventReason || events.Items[0].InvolvedObject.UID != "uid-1" || events.Items[0].Type != corev1.EventTypeWarning) {
+				t.Fatalf("Unexpected event %+v", events.Items[0])
+			}
+		})
+	}
+
+	var disabled *burstCreditCheck
+	if err := disabled.check(context.Background(), bursting, "pvc-1", nil); err != nil {
+		t.Fatalf("Expected no check without policy, got %v", err)
+	}
+}
+
+func TestBurstCreditCheckWithoutClaim(t *testing.T) {
+	check, err := newBurstCreditCheck(BurstCreditCheckWarn, 0, &fakeCloudWatch{found: true}, func() (kubernetes.Interface, error) {
+		return nil, errors.New("no client expected")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &cloud.FileSystem{FileSystemId: "fs-abcd1234", FileSystemArn: testBurstFileSystemArn, ThroughputMode: cloud.ThroughputModeBursting}
+	// Without --extra-create-metadata, the low balance is only logged
+	if err := check.check(context.Background(), fs, "pvc-1", map[string]string{}); err != nil {
+		t.Fatalf("Expected the volume to be provisioned, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// LazyUnmountEventReason is the reason of the Event recorded on the node when a busy volume is unmounted lazily
+	LazyUnmountEventReason = "LazyUnmount"
+	// BusyUnmountEventReason is the reason of the Event recorded on the node when a volume stays busy past the timeout
+	BusyUnmountEventReason = "BusyUnmount"
+
+	busyUnmountMinInterval = time.Second
+	busyUnmountMaxInterval = 10 * time.Second
+)
+
+// LazyUnmounter detaches a mount from the file system hierarchy even if it is busy, the mount being cleaned up
+// once no longer busy, like umount -l
+type LazyUnmounter interface {
+	UnmountLazy(target string) error
+}
+
+// busyUnmount retries the unmounts of NodeUnpublishVolume failing because the target is busy, e.g. a process
+// of the pod still has a file open while it terminates, until the timeout since the first busy attempt, so that
+// the retries of the kubelet do not restart the timeout. With lazyFallback, a target still busy after the timeout
+// is unmounted lazily, so that the pod deletion and node drains are not blocked forever by the busy mount.
+// Otherwise the unmount keeps failing. A nil busyUnmount is valid and unmounts once.
+type busyUnmount struct {
+	timeout      time.Duration
+	lazyFallback bool
+	nodeName     string
+	k8sClient    cloud.KubernetesAPIClient
+
+	mu sync.Mutex
+	// busySince holds when the unmount of each busy target first failed
+	busySince map[string]time.Time
+}
+
+// newBusyUnmount returns the busy unmount retrying for the timeout, or nil if the timeout is 0
+func newBusyUnmount(timeout time.Duration, lazyFallback bool, nodeName string, k8sClient cloud.KubernetesAPIClient) *busyUnmount {
+	if timeout <= 0 {
+		return nil
+	}
+	return &busyUnmount{
+		timeout:      timeout,
+		lazyFallback: lazyFallback,
+		nodeName:     nodeName,
+		k8sClient:    k8sClient,
+		busySince:    map[string]time.Time{},
+	}
+}
+
+// unmount unmounts the target, retrying while it is busy until ctx is done or the timeout expires
+func (b *busyUnmount) unmount(ctx context.Context, mounter Mounter, volumeId, target string) error {
+	if b == nil {
+		return mounter.Unmount(target)
+	}
+	interval := busyUnmountMinInterval
+	for {
+		err := mounter.Unmount(target)
+		if err == nil || !isBusyUnmount(err) {
+			if since, ok := b.forget(target); ok && err == nil {
+				klog.Infof("NodeUnpublishVolume: unmounted %s once no longer busy after %v", target, time.Since(since).Round(time.Second))
+				busyUnmounts.WithLabelValues("unmounted").Inc()
+			}
+			return err
+		}
+
+		since := b.markBusy(target)
+		remaining := b.timeout - time.Since(since)
+		if remaining <= 0 {
+			return b.fallback(mounter, volumeId, target, since, err)
+		}
+		klog.V(4).Infof("NodeUnpublishVolume: %s is busy, retrying the unmount: %v", target, err)
+		if interval > remaining {
+			interval = remaining
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("target is still busy: %v", err)
+		}
+		interval *= 2
+		if interval > busyUnmountMaxInterval {
+			interval = busyUnmountMaxInterval
+		}
+	}
+}
+
+// fallback unmounts lazily the target still busy after the timeout, if enabled and supported by the mounter
+func (b *busyUnmount) fallback(mounter Mounter, volumeId, target string, since time.Time, busyErr error) error {
+	lazyUnmounter, ok := mounter.(LazyUnmounter)
+	if !b.lazyFallback || !ok {
+		klog.Warningf("NodeUnpublishVolume: %s is still busy after %v: %v", target, b.timeout, busyErr)
+		busyUnmounts.WithLabelValues("failed").Inc()
+		b.recordEvent(BusyUnmountEventReason, fmt.Sprintf("Volume %s at %s is still busy after %v and cannot be unmounted, stop the processes using it", volumeId, target, time.Since(since).Round(time.Second)))
+		return busyErr
+	}
+	if err := lazyUnmounter.UnmountLazy(target); err != nil {
+		busyUnmounts.WithLabelValues("failed").Inc()
+		return fmt.Errorf("lazy unmount failed: %v", err)
+	}
+	b.forget(target)
+	klog.Warningf("NodeUnpublishVolume: lazily unmounted %s, still busy after %v", target, b.timeout)
+	busyUnmounts.WithLabelValues("lazy").Inc()
+	b.recordEvent(LazyUnmountEventReason, fmt.Sprintf("Volume %s at %s was unmounted lazily, still busy after %v. Its mount stays in use by the processes using it until they exit", volumeId, target, time.Since(since).Round(time.Second)))
+	return nil
+}
+
+func (b *busyUnmount) markBusy(target string) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	since, ok := b.busySince[target]
+	if !ok {
+		since = time.Now()
+		b.busySince[target] = since
+	}
+	return since
+}
+
+func (b *busyUnmount) forget(target string) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	since, ok := b.busySince[target]
+	delete(b.busySince, target)
+	return since, ok
+}
+
+// recordEvent records a warning Event on the node, where the operators draining it look
+func (b *busyUnmount) recordEvent(reason, message string) {
+	if b.nodeName == "" {
+		return
+	}
+	clientset, err := b.k8sClient()
+	if err != nil {
+		klog.Warningf("Failed to record the %s Event: %v", reason, err)
+		return
+	}
+	now := metav1.Now()
+	// Events of cluster scoped objects are stored in the default namespace
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: b.nodeName + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       b.nodeName,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: driverName, Host: b.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := clientset.CoreV1().Events(metav1.NamespaceDefault).Create(context.Background(), event, metav1.CreateOptions{}); err != nil {
+		klog.Warningf("Failed to record the %s Event: %v", reason, err)
+	}
+}
+
+// isBusyUnmount returns whether the unmount failed because the target is in use, umount reporting
+// "target is busy" or "device is busy" depending on its version
+func isBusyUnmount(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "target is busy") || strings.Contains(message, "device is busy") || strings.Contains(message, "resource busy")
+}
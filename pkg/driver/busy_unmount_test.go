@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+// lazyMockMounter is a mock mounter supporting lazy unmounts
+type lazyMockMounter struct {
+	*mocks.MockMounter
+	lazyUnmounted []string
+}
+
+func (m *lazyMockMounter) UnmountLazy(target string) error {
+	m.lazyUnmounted = append(m.lazyUnmounted, target)
+	return nil
+}
+
+func TestBusyUnmount(t *testing.T) {
+	const target = "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pv-1/mount"
+	busyErr := errors.New("unmount failed: exit status 32\nOutput: umount: " + target + ": target is busy.")
+
+	testCases := []struct {
+		name          string
+		timeout       time.Duration
+		lazyFallback  bool
+		unmountErrs   []error
+		expectErr     bool
+		expectLazy    bool
+		expectedEvent string
+	}{
+		{
+			name:        "Success: unmounted at once",
+			timeout:     time.Minute,
+			unmountErrs: []error{nil},
+		},
+		{
+			name:        "Success: unmounted once no longer busy",
+			timeout:     time.Minute,
+			unmountErrs: []error{busyErr, nil},
+		},
+		{
+			name:        "Fail: not busy",
+			timeout:     time.Minute,
+			unmountErrs: []error{errors.New("unmount failed: permission denied")},
+			expectErr:   true,
+		},
+		{
+			name:          "Success: unmounted lazily after the timeout",
+			timeout:       time.Millisecond,
+			lazyFallback:  true,
+			unmountErrs:   []error{busyErr, busyErr},
+			expectLazy:    true,
+			expectedEvent: LazyUnmountEventReason,
+		},
+		{
+			name:          "Fail: still busy after the timeout without lazy fallback",
+			timeout:       time.Millisecond,
+			unmountErrs:   []error{busyErr, busyErr},
+			expectErr:     true,
+			expectedEvent: BusyUnmountEventReason,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			mounter := &lazyMockMounter{MockMounter: mocks.NewMockMounter(mockCtl)}
+			var calls []*gomock.Call
+			for _, err := range tc.unmountErrs {
+				calls = append(calls, mounter.EXPECT().Unmount(target).Return(err))
+			}
+			gomock.InOrder(calls...)
+
+			clientset := fake.NewSimpleClientset()
+			k8sClient := func() (kubernetes.Interface, error) { return clientset, nil }
+			b := newBusyUnmount(tc.timeout, tc.lazyFallback, "ip-10-0-0-1", k8sClient)
+
+			err := b.unmount(context.Background(), mounter, "fs-abcd1234", target)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tc.expectErr, err)
+			}
+			if tc.expectLazy != (len(mounter.lazyUnmounted) == 1) {
+				t.Fatalf("Expected lazy unmount %v, got %v", tc.expectLazy, mounter.lazyUnmounted)
+			}
+			events, err := clientset.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectedEvent == "" && len(events.Items) != 0 {
+				t.Fatalf("Expected no event, got %+v", events.Items)
+			}
+			if tc.expectedEvent != "" && (len(events.Items) != 1 || events.Items[0].Reason != tc.expectedEvent) {
+				t.Fatalf("Expected a %s event, got %+v", tc.expectedEvent, events.Items)
+			}
+			mockCtl.Finish()
+		})
+	}
+}
+
+func TestBusyUnmountKeepsTimeoutAcrossCalls(t *testing.T) {
+	const target = "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pv-1/mount"
+	busyErr := errors.New("umount: " + target + ": target is busy.")
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mounter := mocks.NewMockMounter(mockCtl)
+	mounter.EXPECT().Unmount(target).Return(busyErr).AnyTimes()
+
+	b := newBusyUnmount(time.Hour, false, "", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.unmount(ctx, mounter, "fs-abcd1234", target); err == nil {
+		t.Fatal("Expected the busy unmount to fail once the context is done")
+	}
+	first := b.busySince[target]
+	if err := b.unmount(ctx, mounter, "fs-abcd1234", target); err == nil {
+		t.Fatal("Expected the busy unmount to fail once the context is done")
+	}
+	if !b.busySince[target].Equal(first) {
+		t.Fatalf("Expected the timeout to start at the first busy attempt %v, got %v", first, b.busySince[target])
+	}
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// redacted replaces the values of the configuration that may hold credentials when it is logged
+const redacted = "REDACTED"
+
+// Config is the configuration of the driver, bound to its command line flags. The JSON name of every field
+// is the name of its flag, so that the effective configuration logged at startup reads like the command line.
+type Config struct {
+	Mode                    Mode    `json:"mode"`
+	Endpoint                string  `json:"endpoint"`
+	VersionedEndpoint       string  `json:"versioned-endpoint"`
+	EfsUtilsCfgPath         string  `json:"efs-utils-config-path"`
+	EfsUtilsStaticFilesPath string  `json:"efs-utils-static-files-path"`
+	KubeletDir              string  `json:"kubelet-root-dir"`
+	VolMetricsOptIn         bool    `json:"vol-metrics-opt-in"`
+	VolMetricsRefreshPeriod float64 `json:"vol-metrics-refresh-period"`
+	VolMetricsFsRateLimit   int     `json:"vol-metrics-fs-rate-limit"`
+	MetricsAddress          string  `json:"metrics-address"`
+	StatusAddress           string  `json:"status-address"`
+	AdminSocket             string  `json:"admin-socket"`
+
+	// EFS API
+	DescribeTimeout             metav1.Duration `json:"describe-timeout"`
+	CreateTimeout               metav1.Duration `json:"create-timeout"`
+	DeleteTimeout               metav1.Duration `json:"delete-timeout"`
+	PreferredMountTargetSubnets string          `json:"preferred-mount-target-subnets"`
+	FaultInjection              string          `json:"fault-injection"`
+	EFSAPIMaxAttempts           int             `json:"efs-api-max-attempts"`
+	EFSAPIRetryTokens           int             `json:"efs-api-retry-tokens"`
+	RequireIMDSv2               bool            `json:"require-imdsv2"`
+	AWSCABundle                 string          `json:"aws-ca-bundle"`
+	EFSEndpointURL              string          `json:"efs-endpoint-url"`
+	STSEndpointURL              string          `json:"sts-endpoint-url"`
+	WarmupTimeout               metav1.Duration `json:"warmup-timeout"`
+	SecretsCacheTTL             metav1.Duration `json:"secrets-manager-cache-ttl"`
+
+	// Provisioning
+	Tags                       string          `json:"tags"`
+	PosixIdentityWebhookUrl    string          `json:"posix-identity-webhook-url"`
+	MinDirectoryPerms          string          `json:"min-directory-perms"`
+	MaxDirectoryPerms          string          `json:"max-directory-perms"`
+	PendingAccessPointTTL      metav1.Duration `json:"pending-access-point-ttl"`
+	ProgressEventThreshold     metav1.Duration `json:"provisioning-progress-event-threshold"`
+	SubPathPatternMaxDepth     int             `json:"sub-path-pattern-max-depth"`
+	SubPathPatternMaxLength    int             `json:"sub-path-pattern-max-length"`
+	DirectoryCollisionPolicy   string          `json:"directory-collision-policy"`
+	AllowUnenforcedIdentity    bool            `json:"allow-unenforced-user-identity"`
+	ProvisioningBatchWindow    metav1.Duration `json:"provisioning-batch-window"`
+	MaxConcurrentAPCreations   int             `json:"max-concurrent-access-point-creations"`
+	StrictParameters           bool            `json:"strict-parameters"`
+	ProvisioningPolicies       bool            `json:"provisioning-policies"`
+	VolumeMountCommand         bool            `json:"volume-mount-command"`
+	VolumeProvisioningDetails  bool            `json:"volume-provisioning-details"`
+	VolumeHandleFormat         string          `json:"volume-handle-format"`
+	FileSystemAliasesConfigMap string          `json:"file-system-aliases-configmap"`
+	MaintenanceAccessPoints    string          `json:"maintenance-access-points"`
+	ClusterId                  string          `json:"cluster-id"`
+	StrictAccessPointOwnership bool            `json:"strict-access-point-ownership"`
+	DefaultIdentityFromTags    bool            `json:"default-identity-from-file-system-tags"`
+	SnapshotBackupVault        string          `json:"snapshot-backup-vault"`
+	SnapshotBackupRoleArn      string          `json:"snapshot-backup-role-arn"`
+	SnapshotSubpathVolumes     bool            `json:"snapshot-subpath-volumes"`
+	BurstCreditCheck           string          `json:"burst-credit-check"`
+	BurstCreditMinBalance      int64           `json:"burst-credit-min-balance"`
+
+	// Deletion
+	DeleteAccessPointRootDir  bool            `json:"delete-access-point-root-dir"`
+	DeleteParentDirsMaxDepth  int             `json:"delete-empty-parent-dirs-max-depth"`
+	DeletionFencingLease      metav1.Duration `json:"deletion-fencing-lease"`
+	DeleteAuditSink           string          `json:"delete-audit-sink"`
+	DeleteOrphanedDirectories bool            `json:"delete-orphaned-directories"`
+
+	// Background syncs of the controller
+	MountTargetCacheConfigMap       string          `json:"mount-target-cache-configmap"`
+	MountTargetCacheInterval        metav1.Duration `json:"mount-target-cache-refresh-interval"`
+	AccessPointInventoryInterval    metav1.Duration `json:"access-point-inventory-interval"`
+	GidRangeAuditInterval           metav1.Duration `json:"gid-range-audit-interval"`
+	OrphanedDirectoryReportInterval metav1.Duration `json:"orphaned-directory-report-interval"`
+	VolumeLabelsInterval            metav1.Duration `json:"volume-labels-interval"`
+	QuotaEnforcement                string          `json:"quota-enforcement"`
+	QuotaEnforcementInterval        metav1.Duration `json:"quota-enforcement-interval"`
+
+	// Publishing
+	ControllerPublishUnpublish bool   `json:"controller-publish-unpublish"`
+	VolumeAttachLimit          int    `json:"volume-attach-limit"`
+	EnforceSingleNodeWriter    bool   `json:"enforce-single-node-writer"`
+	FileSystemIdentityCheck    string `json:"verify-file-system-identity"`
+
+	// Node
+	MountStatsInterval          metav1.Duration `json:"mount-stats-annotation-interval"`
+	MountPropagationCheck       string          `json:"mount-propagation-check"`
+	MountHelperFeatureGating    bool            `json:"mount-helper-feature-gating"`
+	ConfigDirReconcileInterval  metav1.Duration `json:"config-dir-reconcile-interval"`
+	MountOptionsConfigMap       string          `json:"mount-options-configmap"`
+	SharedVolumeMounts          bool            `json:"shared-volume-mounts"`
+	DNSNameservers              string          `json:"dns-nameservers"`
+	DNSTimeout                  metav1.Duration `json:"dns-timeout"`
+	MaxConcurrentMounts         int             `json:"max-concurrent-mounts"`
+	PrewarmVolumes              bool            `json:"prewarm-volumes"`
+	CrossAccountRoleValidation  bool            `json:"cross-account-role-validation"`
+	CrossAccountValidationCache bool            `json:"cross-account-validation-cache"`
+	UnmountBusyTimeout          metav1.Duration `json:"unmount-busy-timeout"`
+	LazyUnmountFallback         bool            `json:"lazy-unmount-fallback"`
+	MountFailureDiagnostics     string          `json:"mount-failure-diagnostics"`
+	NodeStateFile               string          `json:"node-state-file"`
+	PublishedOptionsInterval    metav1.Duration `json:"published-options-check-interval"`
+	SecureMountOptions          string          `json:"secure-mount-options"`
+	AllowSecureMountOptOut      bool            `json:"allow-secure-mount-opt-out"`
+	AccessPointMountSource      bool            `json:"access-point-mount-source"`
+}
+
+// String returns the configuration as JSON, with the credentials that the URLs of the flags may hold redacted
+func (c *Config) String() string {
+	cfg := *c
+	for _, u := range []*string{&cfg.PosixIdentityWebhookUrl, &cfg.DeleteAuditSink, &cfg.EFSEndpointURL, &cfg.STSEndpointURL} {
+		*u = redactURL(*u)
+	}
+	data, err := json.Marshal(&cfg)
+	if err != nil {
+		return fmt.Sprintf("%+v", cfg)
+	}
+	return string(data)
+}
+
+// redactURL returns the http(s) URL with its userinfo, query and fragment redacted, as they may hold credentials,
+// e.g. the token of a webhook. Other values, e.g. file paths, are returned as is.
+func redactURL(value string) string {
+	if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" || u.ForceQuery {
+		u.RawQuery = redacted
+	}
+	if u.Fragment != "" {
+		u.Fragment = redacted
+	}
+	return u.String()
+}
+
+// Validate returns the errors of all the invalid values of the configuration and of the combinations of flags
+// that do not work together, so that the driver reports them at once on startup instead of one at a time.
+// The flags of the services that the mode does not serve are not validated, as they are ignored.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	require := func(set bool, flag, required string) {
+		if set {
+			check(fmt.Errorf("%s requires %s", flag, required))
+		}
+	}
+
+	if c.Mode != "" {
+		_, err := ParseMode(string(c.Mode))
+		check(err)
+	}
+	for name, d := range map[string]metav1.Duration{
+		"describe-timeout":                      c.DescribeTimeout,
+		"create-timeout":                        c.CreateTimeout,
+		"delete-timeout":                        c.DeleteTimeout,
+		"warmup-timeout":                        c.WarmupTimeout,
+		"secrets-manager-cache-ttl":             c.SecretsCacheTTL,
+		"pending-access-point-ttl":              c.PendingAccessPointTTL,
+		"provisioning-progress-event-threshold": c.ProgressEventThreshold,
+		"provisioning-batch-window":             c.ProvisioningBatchWindow,
+		"deletion-fencing-lease":                c.DeletionFencingLease,
+		"mount-target-cache-refresh-interval":   c.MountTargetCacheInterval,
+		"access-point-inventory-interval":       c.AccessPointInventoryInterval,
+		"gid-range-audit-interval":              c.GidRangeAuditInterval,
+		"orphaned-directory-report-interval":    c.OrphanedDirectoryReportInterval,
+		"volume-labels-interval":                c.VolumeLabelsInterval,
+		"quota-enforcement-interval":            c.QuotaEnforcementInterval,
+		"mount-stats-annotation-interval":       c.MountStatsInterval,
+		"config-dir-reconcile-interval":         c.ConfigDirReconcileInterval,
+		"dns-timeout":                           c.DNSTimeout,
+		"unmount-busy-timeout":                  c.UnmountBusyTimeout,
+		"published-options-check-interval":      c.PublishedOptionsInterval,
+	} {
+		if d.Duration < 0 {
+			check(fmt.Errorf("%s %v must not be negative", name, d.Duration))
+		}
+	}
+	for name, limit := range map[string]int{
+		"max-concurrent-access-point-creations": c.MaxConcurrentAPCreations,
+		"max-concurrent-mounts":                 c.MaxConcurrentMounts,
+		"volume-attach-limit":                   c.VolumeAttachLimit,
+		"delete-empty-parent-dirs-max-depth":    c.DeleteParentDirsMaxDepth,
+	} {
+		if limit < 0 {
+			check(fmt.Errorf("%s %d must not be negative", name, limit))
+		}
+	}
+	if c.VolMetricsOptIn {
+		if c.VolMetricsRefreshPeriod <= 0 {
+			check(fmt.Errorf("vol-metrics-refresh-period %v must be positive with vol-metrics-opt-in", c.VolMetricsRefreshPeriod))
+		}
+		if c.VolMetricsFsRateLimit <= 0 {
+			check(fmt.Errorf("vol-metrics-fs-rate-limit %d must be positive with vol-metrics-opt-in", c.VolMetricsFsRateLimit))
+		}
+	}
+	_, err := c.cloudOptions()
+	check(err)
+	_, err = newFileSystemIdentityCheck(c.FileSystemIdentityCheck)
+	check(err)
+	_, err = newMountTargetCache(c.MountTargetCacheConfigMap, nil)
+	check(err)
+	_, err = newQuotaEnforcer(c.QuotaEnforcement, c.QuotaEnforcementInterval.Duration, nil)
+	check(err)
+
+	if c.Mode.servesController() {
+		_, err = ParseDirectoryPermsPolicy(c.MinDirectoryPerms, c.MaxDirectoryPerms)
+		check(err)
+		_, err = NewSubPathPatternLimits(c.SubPathPatternMaxDepth, c.SubPathPatternMaxLength)
+		check(err)
+		_, err = parseMaintenanceAccessPoints(c.MaintenanceAccessPoints)
+		check(err)
+		_, err = parseVolumeHandleFormat(c.VolumeHandleFormat)
+		check(err)
+		_, err = newDirectoryCollisionCheck(c.DirectoryCollisionPolicy, nil)
+		check(err)
+		_, err = newBurstCreditCheck(c.BurstCreditCheck, c.BurstCreditMinBalance, nil, nil)
+		check(err)
+		require(c.SnapshotBackupVault != "" && c.SnapshotBackupRoleArn == "", "snapshot-backup-vault", "snapshot-backup-role-arn")
+		require(c.SnapshotBackupRoleArn != "" && c.SnapshotBackupVault == "", "snapshot-backup-role-arn", "snapshot-backup-vault")
+		require(c.SnapshotSubpathVolumes && c.SnapshotBackupVault == "", "snapshot-subpath-volumes", "snapshot-backup-vault")
+		require(c.BurstCreditMinBalance > 0 && c.BurstCreditCheck == "", "burst-credit-min-balance", "burst-credit-check")
+		require(c.StrictAccessPointOwnership && c.ClusterId == "", "strict-access-point-ownership", "cluster-id")
+		require(c.DeletionFencingLease.Duration > 0 && !c.DeleteAccessPointRootDir, "deletion-fencing-lease", "delete-access-point-root-dir")
+		require(c.DeleteParentDirsMaxDepth > 0 && !c.DeleteAccessPointRootDir, "delete-empty-parent-dirs-max-depth", "delete-access-point-root-dir")
+		require(c.DeleteOrphanedDirectories && c.OrphanedDirectoryReportInterval.Duration == 0, "delete-orphaned-directories", "orphaned-directory-report-interval")
+		require(c.MountTargetCacheInterval.Duration > 0 && c.MountTargetCacheConfigMap == "", "mount-target-cache-refresh-interval", "mount-target-cache-configmap")
+		require(c.EnforceSingleNodeWriter && !c.ControllerPublishUnpublish, "enforce-single-node-writer", "controller-publish-unpublish")
+		require(c.VolumeAttachLimit > 0 && !c.ControllerPublishUnpublish, "volume-attach-limit", "controller-publish-unpublish")
+	}
+
+	if c.Mode.servesNode() {
+		_, err = newMountPropagationCheck(c.MountPropagationCheck, c.KubeletDir)
+		check(err)
+		_, err = newDNSResolver(c.DNSNameservers, c.DNSTimeout.Duration)
+		check(err)
+		_, err = newSecureMountOptions(c.SecureMountOptions, c.AllowSecureMountOptOut)
+		check(err)
+		_, err = newMountDiagnostics(c.MountFailureDiagnostics, "", nil)
+		check(err)
+		require(c.CrossAccountValidationCache && !c.CrossAccountRoleValidation, "cross-account-validation-cache", "cross-account-role-validation")
+		require(c.LazyUnmountFallback && c.UnmountBusyTimeout.Duration == 0, "lazy-unmount-fallback", "unmount-busy-timeout")
+	}
+	return errors.Join(errs...)
+}
+
+// cloudOptions returns the options of the EFS, Secrets Manager, STS, AWS Backup and CloudWatch clients of the driver
+func (c *Config) cloudOptions() (cloud.Options, error) {
+	options := cloud.Options{
+		DescribeTimeout: c.DescribeTimeout.Duration,
+		CreateTimeout:   c.CreateTimeout.Duration,
+		DeleteTimeout:   c.DeleteTimeout.Duration,
+		RequireIMDSv2:   c.RequireIMDSv2,
+	}
+	for _, subnetId := range strings.Split(c.PreferredMountTargetSubnets, ",") {
+		if subnetId = strings.TrimSpace(subnetId); subnetId != "" {
+			options.PreferredSubnetIds = append(options.PreferredSubnetIds, subnetId)
+		}
+	}
+	var err error
+	if options.FaultInjector, err = cloud.ParseFaultInjector(c.FaultInjection); err != nil {
+		return cloud.Options{}, err
+	}
+	if options.RetryPolicy, err = cloud.NewRetryPolicy(c.EFSAPIMaxAttempts, c.EFSAPIRetryTokens); err != nil {
+		return cloud.Options{}, err
+	}
+	if c.StatusAddress != "" {
+		options.APIStatus = cloud.NewAPIStatus()
+	}
+	if c.AWSCABundle != "" {
+		if options.CABundle, err = cloud.LoadCABundle(c.AWSCABundle); err != nil {
+			return cloud.Options{}, err
+		}
+	}
+	if c.EFSEndpointURL != "" && !cloud.IsEndpointURL(c.EFSEndpointURL) {
+		return cloud.Options{}, fmt.Errorf("efs-endpoint-url %q must be an http or https URL", c.EFSEndpointURL)
+	}
+	if c.STSEndpointURL != "" && !cloud.IsEndpointURL(c.STSEndpointURL) {
+		return cloud.Options{}, fmt.Errorf("sts-endpoint-url %q must be an http or https URL", c.STSEndpointURL)
+	}
+	options.EFSEndpoint, options.STSEndpoint = c.EFSEndpointURL, c.STSEndpointURL
+	return options, nil
+}
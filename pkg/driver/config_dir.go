@@ -17,10 +17,15 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
 	"fmt"
-	"k8s.io/klog/v2"
 	"os"
+	"os/signal"
 	"path"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
 )
 
 // InitConfigDir decides which of two mounted directories will be used to store driver config files. It creates a
@@ -98,3 +103,150 @@ func InitConfigDir(legacyDir, preferredDir, etcAmazonEfs string) error {
 
 	return nil
 }
+
+// configDirReconciler repairs the efs-utils config directory when it drifts from the state set up on startup,
+// e.g. when a node configuration management tool removes the symlink at etcAmazonEfs or rewrites the config
+// file. Without the repair, every new mount fails until the driver restarts. A nil reconciler is valid and
+// does nothing.
+type configDirReconciler struct {
+	etcAmazonEfs string
+	interval     time.Duration
+	// target is the directory the symlink at etcAmazonEfs points to, empty if etcAmazonEfs is a directory
+	target string
+	// config returns the expected content of the efs-utils config file
+	config func() ([]byte, error)
+}
+
+func newConfigDirReconciler(etcAmazonEfs string, interval time.Duration, config func() ([]byte, error)) *configDirReconciler {
+	return &configDirReconciler{
+		etcAmazonEfs: etcAmazonEfs,
+		interval:     interval,
+		config:       config,
+	}
+}
+
+// start records the current state of the config directory as the expected one, then reconciles it every
+// interval, if not 0, and on SIGHUP
+func (r *configDirReconciler) start(stopCh <-chan struct{}) error {
+	if r == nil {
+		return nil
+	}
+	info, err := os.Lstat(r.etcAmazonEfs)
+	if err != nil {
+		return fmt.Errorf("unable to stat config directory '%s': %v", r.etcAmazonEfs, err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if r.target, err = os.Readlink(r.etcAmazonEfs); err != nil {
+			return fmt.Errorf("unable to read symlink '%s': %v", r.etcAmazonEfs, err)
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigs)
+		var tick <-chan time.Time
+		if r.interval > 0 {
+			ticker := time.NewTicker(r.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-tick:
+			case <-sigs:
+				klog.Info("Received SIGHUP, checking the config directory")
+			case <-stopCh:
+				return
+			}
+			if err := r.reconcile(); err != nil {
+				klog.Errorf("Failed to repair the config directory '%s': %v", r.etcAmazonEfs, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reconcile repairs the symlink or directory at etcAmazonEfs, then the efs-utils config file
+func (r *configDirReconciler) reconcile() error {
+	if r.target != "" {
+		if err := r.reconcileSymlink(); err != nil {
+			return err
+		}
+	} else if err := r.reconcileDir(); err != nil {
+		return err
+	}
+	return r.reconcileConfig()
+}
+
+func (r *configDirReconciler) reconcileSymlink() error {
+	info, err := os.Lstat(r.etcAmazonEfs)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(r.etcAmazonEfs)
+		if err != nil {
+			return fmt.Errorf("unable to read symlink '%s': %v", r.etcAmazonEfs, err)
+		}
+		if target == r.target {
+			return nil
+		}
+		klog.Warningf("Symlink '%s' points to '%s' instead of '%s', repairing it", r.etcAmazonEfs, target, r.target)
+	} else if err == nil {
+		klog.Warningf("'%s' is not a symlink to '%s' anymore, repairing it", r.etcAmazonEfs, r.target)
+	} else if os.IsNotExist(err) {
+		klog.Warningf("Symlink '%s' to '%s' was removed, repairing it", r.etcAmazonEfs, r.target)
+	} else {
+		return fmt.Errorf("unable to stat '%s': %v", r.etcAmazonEfs, err)
+	}
+
+	// Only an empty directory is replaced, the files of a non empty one are left for the operator to check
+	if err == nil {
+		if err := os.Remove(r.etcAmazonEfs); err != nil {
+			return fmt.Errorf("unable to remove '%s': %v", r.etcAmazonEfs, err)
+		}
+	}
+	if err := os.Symlink(r.target, r.etcAmazonEfs); err != nil {
+		return fmt.Errorf("unable to create symlink from '%s' to '%s': %v", r.etcAmazonEfs, r.target, err)
+	}
+	configDirRemediations.WithLabelValues("symlink").Inc()
+	return nil
+}
+
+func (r *configDirReconciler) reconcileDir() error {
+	info, err := os.Stat(r.etcAmazonEfs)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", r.etcAmazonEfs)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to stat '%s': %v", r.etcAmazonEfs, err)
+	}
+	klog.Warningf("Directory '%s' was removed, repairing it", r.etcAmazonEfs)
+	if err := os.MkdirAll(r.etcAmazonEfs, 0755); err != nil {
+		return fmt.Errorf("unable to create directory at '%s': %v", r.etcAmazonEfs, err)
+	}
+	configDirRemediations.WithLabelValues("directory").Inc()
+	return nil
+}
+
+func (r *configDirReconciler) reconcileConfig() error {
+	expected, err := r.config()
+	if err != nil {
+		return fmt.Errorf("unable to render the efs-utils config: %v", err)
+	}
+	configFile := path.Join(r.etcAmazonEfs, efsUtilsConfigFileName)
+	actual, err := os.ReadFile(configFile)
+	if err == nil && bytes.Equal(actual, expected) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read '%s': %v", configFile, err)
+	}
+	klog.Warningf("Config file '%s' was removed or modified, repairing it", configFile)
+	if err := os.WriteFile(configFile, expected, 0644); err != nil {
+		return fmt.Errorf("unable to write '%s': %v", configFile, err)
+	}
+	configDirRemediations.WithLabelValues("config").Inc()
+	return nil
+}
@@ -21,7 +21,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func tempDir(t *testing.T) string {
@@ -240,3 +244,128 @@ func TestInitConfigDirPreExistingConfigError(t *testing.T) {
 		t.Errorf("Expected an error when calling InitConfigDir")
 	}
 }
+
+// TestConfigDirReconcilerSymlink asserts that a removed or replaced symlink and a modified config file are repaired
+func TestConfigDirReconcilerSymlink(t *testing.T) {
+	dir := tempDir(t)
+	defer cleanup(t, dir)
+
+	legacyDir, _ := create(t, dir, legacy, doNotCreateConfig)
+	preferredDir, _ := create(t, dir, preferred, doNotCreateConfig)
+	etcAmazonEfs := filepath.Join(dir, canonical)
+	if err := InitConfigDir(legacyDir, preferredDir, etcAmazonEfs); err != nil {
+		t.Fatalf("InitConfigDir returned an error: %v", err)
+	}
+
+	expectedConfig := []byte("[mount]\n")
+	r := newConfigDirReconciler(etcAmazonEfs, 0, func() ([]byte, error) {
+		return expectedConfig, nil
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := r.start(stopCh); err != nil {
+		t.Fatalf("Failed to start the reconciler: %v", err)
+	}
+
+	repairs := testutil.ToFloat64(configDirRemediations.WithLabelValues("symlink"))
+	testCases := []struct {
+		name  string
+		drift func()
+	}{
+		{
+			name: "symlink removed",
+			drift: func() {
+				os.Remove(etcAmazonEfs)
+			},
+		},
+		{
+			name: "symlink to another directory",
+			drift: func() {
+				os.Remove(etcAmazonEfs)
+				os.Symlink(legacyDir, etcAmazonEfs)
+			},
+		},
+		{
+			name: "symlink replaced by an empty directory",
+			drift: func() {
+				os.Remove(etcAmazonEfs)
+				os.Mkdir(etcAmazonEfs, 0755)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.drift()
+			if err := r.reconcile(); err != nil {
+				t.Fatalf("Failed to reconcile: %v", err)
+			}
+			assertSymlink(t, etcAmazonEfs, preferredDir)
+			repairs++
+			if value := testutil.ToFloat64(configDirRemediations.WithLabelValues("symlink")); value != repairs {
+				t.Fatalf("Expected %v symlink repairs, got %v", repairs, value)
+			}
+		})
+	}
+
+	// A non empty directory is left for the operator to check
+	os.Remove(etcAmazonEfs)
+	create(t, dir, canonical, createConfig)
+	if err := r.reconcile(); err == nil {
+		t.Fatal("Expected an error when the symlink is replaced by a non empty directory")
+	}
+	os.RemoveAll(etcAmazonEfs)
+
+	// The config file is rewritten on SIGHUP when it differs
+	if err := os.WriteFile(filepath.Join(preferredDir, configFilename), []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(preferredDir, configFilename))
+		if string(data) == string(expectedConfig) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the config file to be repaired on SIGHUP, got %q", string(data))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertSymlink(t, etcAmazonEfs, preferredDir)
+}
+
+// TestConfigDirReconcilerDirectory asserts that a removed directory is recreated with its config file
+func TestConfigDirReconcilerDirectory(t *testing.T) {
+	dir := tempDir(t)
+	defer cleanup(t, dir)
+
+	etcAmazonEfs := filepath.Join(dir, canonical)
+	if err := InitConfigDir(filepath.Join(dir, legacy), filepath.Join(dir, preferred), etcAmazonEfs); err != nil {
+		t.Fatalf("InitConfigDir returned an error: %v", err)
+	}
+
+	r := newConfigDirReconciler(etcAmazonEfs, 0, func() ([]byte, error) {
+		return []byte("[mount]\n"), nil
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := r.start(stopCh); err != nil {
+		t.Fatalf("Failed to start the reconciler: %v", err)
+	}
+
+	os.RemoveAll(etcAmazonEfs)
+	if err := r.reconcile(); err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(etcAmazonEfs, configFilename)); err != nil {
+		t.Fatalf("Expected the directory and config file to be recreated: %v", err)
+	}
+
+	// A nil reconciler does nothing
+	var nilReconciler *configDirReconciler
+	if err := nilReconciler.start(stopCh); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -19,6 +19,7 @@ package driver
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -38,6 +39,8 @@ import (
 
 const (
 	AccessPointMode       = "efs-ap"
+	SharedAccessPointMode = "efs-shared-ap"
+	FileSystemMode        = "efs-fs"
 	AzName                = "az"
 	BasePath              = "basePath"
 	DefaultGidMin         = int64(50000)
@@ -62,24 +65,75 @@ const (
 	ReuseAccessPointKey   = "reuseAccessPoint"
 	PvcNameKey            = "csi.storage.k8s.io/pvc/name"
 	CrossAccount          = "crossaccount"
+	RequireBasePath       = "requireExistingBasePath"
+	SkipCreationInfo      = "skipCreationInfo"
+	EnforceUserIdentity   = "enforceUserIdentity"
+	// Volume attributes overriding the volume metrics options of the node for a single volume
+	VolMetricsRefreshPeriod = "volmetricsrefreshperiod"
+	VolMetricsFsRateLimit   = "volmetricsfsratelimit"
+	VolMetricsJitter        = "volmetricsjitter"
+	// Volume attributes exposing a sub directory of the volume instead of its root
+	SubPath                = "subpath"
+	CreateSubPathIfMissing = "createsubpathifmissing"
+	// Volume attribute holding the ARN of a file system owned by another account or in another region
+	FileSystemArn = "filesystemarn"
+	// Volume attributes overriding the region, and the DNS name suffix derived from it, of the mount of a
+	// replica file system in another region than the node
+	VolumeRegion  = "region"
+	DnsNameSuffix = "dnsnamesuffix"
+	// Volume attributes of the address family of the mount target, and of the port of its mount target IP when
+	// not the NFS port, e.g. behind NAT or port forwarding in hybrid networks
+	IpFamily        = "ipfamily"
+	MountTargetPort = "mounttargetport"
+	// Volume attribute describing the mount command equivalent to NodePublishVolume, for troubleshooting only
+	MountCommand = "mountcommand"
+	// Volume attribute opting the mount out of the efs-utils watchdog, for short-lived pods
+	DisableWatchdog = "disablewatchdog"
+	// Secret holding the region of the file system, which DeleteVolume cannot derive from the volume ID
+	// when the storage class refers to a file system ARN in another region
+	AwsRegion = "awsRegion"
+	// Parameters selecting the EFS API called, and the role assumed, for the volumes of a storage class.
+	// DeleteVolume does not get the parameters and reads them from the provisioner secrets instead.
+	APIRegion   = "apiRegion"
+	APIEndpoint = "apiEndpoint"
+	APIRoleArn  = "roleArn"
+	// Parameter of an existing access point, managed outside of the driver, in which each volume is a directory
+	AccessPointId = "accessPointId"
+	// Parameter limiting the number of volume directories created in the directory of the volumes of an
+	// efs-shared-ap namespace, or in the basePath of an accessPointId
+	MaxDirectoriesPerBasePath = "maxDirectoriesPerBasePath"
+	// Parameters of the file systems created by provisioning mode efs-fs, and of their mount targets
+	ThroughputMode               = "throughputMode"
+	ProvisionedThroughputInMibps = "provisionedThroughputInMibps"
+	PerformanceMode              = "performanceMode"
+	Encrypted                    = "encrypted"
+	KmsKeyId                     = "kmsKeyId"
+	SubnetIds                    = "subnetIds"
+	SecurityGroupIds             = "securityGroupIds"
 )
 
 var (
 	// controllerCaps represents the capability of controller service
 	controllerCaps = []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 	}
-	// subPathPatternComponents shows the elements that we allow to be in the construction of the root directory
-	// of the access point, as well as the values we need to extract them from the Volume Parameters.
-	subPathPatternComponents = map[string]string{
-		".PVC.name":      PvcName,
-		".PVC.namespace": PvcNamespace,
-		".PV.name":       PvName,
+	// storageClassParameters are the parameters accepted by CreateVolume with --strict-parameters, besides
+	// the csi.storage.k8s.io/ parameters of the external-provisioner
+	storageClassParameters = []string{
+		AccessPointId, APIEndpoint, APIRegion, APIRoleArn, AzName, BasePath, DirectoryPerms, Encrypted, EnforceUserIdentity, EnsureUniqueDirectory,
+		FsId, Gid, GidMax, GidMin, KmsKeyId, MaxDirectoriesPerBasePath, PerformanceMode, ProvisionedThroughputInMibps, ProvisioningMode,
+		RequireBasePath, ReuseAccessPointKey, SecurityGroupIds, SkipCreationInfo, SubnetIds, SubPathPattern, ThroughputMode, Uid,
 	}
 )
 
 func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 	klog.V(4).Infof("CreateVolume: called with args %+v", util.SanitizeRequest(*req))
+	return d.createVolume(ctx, req, nil)
+}
+
+// createVolume creates the volume, or with a simulation, records what it would create and returns no volume
+func (d *Driver) createVolume(ctx context.Context, req *csi.CreateVolumeRequest, simulation *createVolumeSimulation) (*csi.CreateVolumeResponse, error) {
 
 	var reuseAccessPoint bool
 	var err error
@@ -102,6 +156,12 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	if volName == "" {
 		return nil, status.Error(codes.InvalidArgument, "Volume name not provided")
 	}
+	if d.strictParameters {
+		if unknown := unknownParameters(volumeParams); len(unknown) > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown parameters %s, the accepted parameters are %s",
+				strings.Join(unknown, ", "), strings.Join(storageClassParameters, ", "))
+		}
+	}
 
 	// Volume size is required to match PV to PVC by k8s.
 	// Volume size is not consumed by EFS for any purposes.
@@ -125,6 +185,7 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		gid                    int64
 		gidMin                 int64
 		gidMax                 int64
+		fsArn                  *cloud.FileSystemArn
 		localCloud             cloud.Cloud
 		provisioningMode       string
 		roleArn                string
@@ -135,14 +196,52 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	//Parse parameters
 	if value, ok := volumeParams[ProvisioningMode]; ok {
 		provisioningMode = value
-		//TODO: Add FS provisioning mode check when implemented
-		if provisioningMode != AccessPointMode {
-			errStr := "Provisioning mode " + provisioningMode + " is not supported. Only Access point provisioning: 'efs-ap' is supported"
+		if provisioningMode != AccessPointMode && provisioningMode != SharedAccessPointMode && provisioningMode != FileSystemMode {
+			errStr := "Provisioning mode " + provisioningMode + " is not supported. Only Access point provisioning: 'efs-ap' or 'efs-shared-ap', or File system provisioning: 'efs-fs' is supported"
 			return nil, status.Error(codes.InvalidArgument, errStr)
 		}
+		if provisioningMode == FileSystemMode {
+			return d.createFileSystemVolume(ctx, req, volumeParams, simulation)
+		}
+		for _, param := range fileSystemParameters {
+			if _, ok := volumeParams[param]; ok {
+				return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is only supported by provisioning mode %v", param, FileSystemMode)
+			}
+		}
+		if provisioningMode == SharedAccessPointMode {
+			if _, ok := volumeParams[PvcNamespace]; !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "Provisioning mode %v requires the namespace of the claim, the external-provisioner must run with --extra-create-metadata", SharedAccessPointMode)
+			}
+			if reuseAccessPoint {
+				return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is not supported by provisioning mode %v", ReuseAccessPointKey, SharedAccessPointMode)
+			}
+		}
 	} else {
 		return nil, status.Errorf(codes.InvalidArgument, "Missing %v parameter", ProvisioningMode)
 	}
+	existingAccessPointId := volumeParams[AccessPointId]
+	if existingAccessPointId != "" {
+		if provisioningMode != AccessPointMode {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is not supported by provisioning mode %v", AccessPointId, provisioningMode)
+		}
+		// The posix user and root directory are the ones of the existing access point
+		for _, param := range []string{ReuseAccessPointKey, Uid, Gid, GidMin, GidMax, SubPathPattern, EnsureUniqueDirectory, DirectoryPerms} {
+			if _, ok := volumeParams[param]; ok {
+				return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is not supported with %v", param, AccessPointId)
+			}
+		}
+	}
+	var maxDirs int
+	if value, ok := volumeParams[MaxDirectoriesPerBasePath]; ok {
+		// The access points of efs-ap are already limited per file system by EFS
+		if provisioningMode != SharedAccessPointMode && existingAccessPointId == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is only supported by provisioning mode %v or with %v", MaxDirectoriesPerBasePath, SharedAccessPointMode, AccessPointId)
+		}
+		maxDirs, err = strconv.Atoi(value)
+		if err != nil || maxDirs <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v must be a positive integer, got %q", MaxDirectoriesPerBasePath, value)
+		}
+	}
 
 	accessPointsOptions := &cloud.AccessPointOptions{
 		CapacityGiB: volSize,
@@ -152,32 +251,118 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		if strings.TrimSpace(value) == "" {
 			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v cannot be empty", FsId)
 		}
+		if d.fileSystemAliases != nil && isFileSystemAlias(value) {
+			resolved, err := d.fileSystemAliases.resolve(value)
+			if err == errFileSystemAliasesNotSynced {
+				return nil, status.Error(codes.Unavailable, err.Error())
+			}
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid %v parameter: %v", FsId, err)
+			}
+			klog.V(4).Infof("CreateVolume: resolved file system alias %q to %v", value, resolved)
+			value = resolved
+		}
 		accessPointsOptions.FileSystemId = value
+		// The API calls for a file system ARN go to the region, and so the partition, of the file system
+		if cloud.IsArn(value) {
+			fsArn, err = cloud.ParseFileSystemArn(value)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid %v parameter: %v", FsId, err)
+			}
+			accessPointsOptions.FileSystemId = fsArn.FileSystemId
+		}
 	} else {
 		return nil, status.Errorf(codes.InvalidArgument, "Missing %v parameter", FsId)
 	}
 
-	localCloud, roleArn, crossAccountDNSEnabled, err = getCloud(req.GetSecrets(), d)
+	// The claim of a simulation does not exist
+	var progress *provisioningProgress
+	if simulation == nil {
+		progress = newProvisioningProgress(d.progressEventThreshold, cloud.DefaultKubernetesAPIClient, volName, volumeParams)
+		defer progress.done()
+	}
+
+	apiConfig, err := parseAPIConfig(volumeParams)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid API parameters: %v", err)
+	}
+	if fsArn != nil {
+		if apiConfig.Region != "" && apiConfig.Region != fsArn.Region {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v %v does not match the region %v of %v", APIRegion, apiConfig.Region, fsArn.Region, FsId)
+		}
+		apiConfig.Region = fsArn.Region
+	}
+	region := apiConfig.Region
+	secrets, err := d.secretsResolver.resolve(ctx, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := secrets[RoleArn]; ok || apiConfig.RoleArn != "" {
+		progress.step("assuming the cross account role")
+	}
+	localCloud, roleArn, crossAccountDNSEnabled, err = getCloud(secrets, d, apiConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := d.mountHelperFeatureGate.check(ctx, requiredMountHelperFeatures(roleArn, crossAccountDNSEnabled)); err != nil {
+		if errors.Is(err, errMountHelperFeaturesUnsupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "Volume %v cannot be mounted: %v", volName, err)
+		}
+		return nil, status.Errorf(codes.Unavailable, "Failed to check the mount helper features of the nodes: %v", err)
+	}
+
 	var accessPoint *cloud.AccessPoint
+	details := newProvisioningDetails(provisioningMode)
+	if existingAccessPointId != "" {
+		progress.step(fmt.Sprintf("describing access point %v", existingAccessPointId))
+		accessPoint, err = d.describeExistingAccessPoint(ctx, localCloud, existingAccessPointId, accessPointsOptions.FileSystemId)
+		if err != nil {
+			return nil, err
+		}
+		details.reusedAccessPoint = true
+		details.rootDirectory = accessPoint.AccessPointRootDir
+		if accessPoint.PosixUser != nil {
+			details.uid, details.gid = accessPoint.PosixUser.Uid, accessPoint.PosixUser.Gid
+		}
+	}
 	//if reuseAccessPoint is true, check for AP with same Root Directory exists in efs
 	// if found reuse that AP
 	if reuseAccessPoint {
+		progress.step("finding an existing access point")
 		existingAP, err := localCloud.FindAccessPointByClientToken(ctx, clientToken, accessPointsOptions.FileSystemId)
 		if err != nil {
+			if err == cloud.ErrDeadlineExceeded {
+				return nil, status.Errorf(codes.DeadlineExceeded, "Timed out finding access point: %v", err)
+			}
 			return nil, fmt.Errorf("failed to find access point: %v", err)
 		}
 		if existingAP != nil {
 			//AP path already exists
 			klog.V(2).Infof("Existing AccessPoint found : %+v", existingAP)
+			if err := d.checkAccessPointOwnership(existingAP); err != nil {
+				return nil, status.Errorf(codes.FailedPrecondition, "Cannot reuse access point %v for volume %v: %v", existingAP.AccessPointId, volName, err)
+			}
+			if existingAP.DeletionToken != "" {
+				return nil, status.Errorf(codes.Aborted, "Cannot reuse access point %v for volume %v: it is being deleted since %v", existingAP.AccessPointId, volName, existingAP.DeletingSince)
+			}
+			if simulation != nil {
+				simulation.reusedAccessPoint(existingAP.AccessPointId, "")
+				return nil, nil
+			}
+			if err := markAccessPointProvisioned(ctx, localCloud, existingAP); err != nil {
+				if err == cloud.ErrDeadlineExceeded {
+					return nil, status.Errorf(codes.DeadlineExceeded, "Timed out completing pending access point %v: %v", existingAP.AccessPointId, err)
+				}
+				return nil, status.Errorf(codes.Internal, "Failed to complete pending access point %v: %v", existingAP.AccessPointId, err)
+			}
 			accessPoint = &cloud.AccessPoint{
 				AccessPointId: existingAP.AccessPointId,
 				FileSystemId:  existingAP.FileSystemId,
 				CapacityGiB:   accessPointsOptions.CapacityGiB,
 			}
+			details.reusedAccessPoint = true
+			details.rootDirectory = existingAP.AccessPointRootDir
 		}
 	}
 
@@ -186,6 +371,13 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		tags := map[string]string{
 			DefaultTagKey: DefaultTagValue,
 		}
+		if d.clusterId != "" {
+			tags[cloud.ClusterIdTagKey] = d.clusterId
+		}
+		// The access points of efs-shared-ap hold the volumes of several claims
+		if volSize > 0 && provisioningMode == AccessPointMode {
+			tags[cloud.CapacityTagKey] = strconv.FormatInt(volSize, 10)
+		}
 
 		// Append input tags to default tag
 		if len(d.tags) != 0 {
@@ -218,6 +410,21 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 			}
 		}
 
+		// The identity not set by the parameters may default to the one the file system is tagged with
+		identityFromTags := false
+		if uid == -1 || gid == -1 {
+			tagUid, tagGid, err := d.fileSystemIdentities.get(ctx, localCloud, accessPointsOptions.FileSystemId)
+			if err != nil {
+				return nil, fileSystemIdentityError(err, accessPointsOptions.FileSystemId)
+			}
+			if uid == -1 && tagUid != -1 {
+				uid, identityFromTags = tagUid, true
+			}
+			if gid == -1 && tagGid != -1 {
+				gid, identityFromTags = tagGid, true
+			}
+		}
+
 		if value, ok := volumeParams[GidMin]; ok {
 			gidMin, err = strconv.ParseInt(value, 10, 64)
 			if err != nil {
@@ -256,6 +463,43 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		if value, ok := volumeParams[DirectoryPerms]; ok {
 			accessPointsOptions.DirectoryPerms = value
 		}
+		if d.directoryPermsPolicy != nil {
+			if err := d.directoryPermsPolicy.validate(accessPointsOptions.DirectoryPerms); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+
+		// The access point may be created on an existing root directory, so that the driver never creates directories
+		if value, ok := volumeParams[SkipCreationInfo]; ok {
+			skipCreationInfo, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid value for %v parameter: %v", SkipCreationInfo, err)
+			}
+			if skipCreationInfo && provisioningMode == SharedAccessPointMode {
+				return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is not supported with provisioning mode %v", SkipCreationInfo, SharedAccessPointMode)
+			}
+			accessPointsOptions.SkipCreationInfo = skipCreationInfo
+		}
+
+		// Without the posix user of the access point, the clients keep their own identity within its root directory
+		if value, ok := volumeParams[EnforceUserIdentity]; ok {
+			enforceUserIdentity, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid value for %v parameter: %v", EnforceUserIdentity, err)
+			}
+			if !enforceUserIdentity {
+				if !d.allowUnenforcedIdentity {
+					return nil, status.Errorf(codes.PermissionDenied, "Parameter %v=false is not allowed by the driver", EnforceUserIdentity)
+				}
+				if provisioningMode == SharedAccessPointMode {
+					return nil, status.Errorf(codes.InvalidArgument, "Parameter %v=false is not supported with provisioning mode %v", EnforceUserIdentity, SharedAccessPointMode)
+				}
+				if (uid == -1 || gid == -1) && !accessPointsOptions.SkipCreationInfo {
+					return nil, status.Errorf(codes.InvalidArgument, "Parameter %v=false requires the %v and %v parameters to own the root directory, unless %v is set", EnforceUserIdentity, Uid, Gid, SkipCreationInfo)
+				}
+				accessPointsOptions.SkipPosixUser = true
+			}
+		}
 
 		// Storage class parameter `az` will be used to fetch preferred mount target for cross account mount.
 		// If the `az` storage class parameter is not provided, a random mount target will be picked for mounting.
@@ -266,13 +510,58 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 			azName = value
 		}
 
+		// The volumes of a namespace use the posix user of its shared access point once it exists, so no
+		// identity is allocated for them
+		var sharedAccessPoint *cloud.AccessPoint
+		if provisioningMode == SharedAccessPointMode {
+			sharedRootDir := path.Join("/", volumeParams[BasePath], volumeParams[PvcNamespace])
+			sharedAccessPoint, err = localCloud.FindAccessPointByClientToken(ctx, sharedAccessPointClientToken(accessPointsOptions.FileSystemId, sharedRootDir), accessPointsOptions.FileSystemId)
+			if err != nil {
+				if err == cloud.ErrAccessDenied {
+					return nil, status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
+				}
+				if err == cloud.ErrNotFound {
+					return nil, status.Errorf(codes.InvalidArgument, "File System does not exist: %v", err)
+				}
+				if err == cloud.ErrDeadlineExceeded {
+					return nil, status.Errorf(codes.DeadlineExceeded, "Timed out finding the shared access point of namespace %v in File System %v", volumeParams[PvcNamespace], accessPointsOptions.FileSystemId)
+				}
+				return nil, status.Errorf(codes.Internal, "Failed to find the shared access point of namespace %v in File System %v: %v", volumeParams[PvcNamespace], accessPointsOptions.FileSystemId, err)
+			}
+		}
+
+		// The posix identity webhook, if configured, takes over the allocation of uid/gid that are not set explicitly
+		// Neither is needed without the posix user of the access point
+		useIdentityWebhook := d.posixIdentityWebhook != nil && (uid == -1 || gid == -1) && !accessPointsOptions.SkipPosixUser
+		allocateGid := !useIdentityWebhook && (uid == -1 || gid == -1) && !accessPointsOptions.SkipPosixUser
+		switch {
+		case sharedAccessPoint != nil && sharedAccessPoint.PosixUser != nil:
+			klog.V(4).Infof("Using the posix user of shared access point %v for volume %v", sharedAccessPoint.AccessPointId, volName)
+			uid, gid = sharedAccessPoint.PosixUser.Uid, sharedAccessPoint.PosixUser.Gid
+			useIdentityWebhook, allocateGid = false, false
+			details.reusedAccessPoint = true
+		case accessPointsOptions.SkipPosixUser:
+			details.posixUserSource = posixUserNone
+		case useIdentityWebhook:
+			details.posixUserSource = posixUserFromWebhook
+		case allocateGid:
+			details.posixUserSource = posixUserFromAllocation
+		case identityFromTags:
+			details.posixUserSource = posixUserFromFileSystemTags
+		default:
+			details.posixUserSource = posixUserFromParameters
+		}
+
 		// Check if file system exists. Describe FS or List APs handle appropriate error codes
 		// With dynamic uid/gid provisioning we can save a call to describe FS, as list APs fails if FS ID does not exist
-		var accessPoints []*cloud.AccessPoint
-		if uid == -1 || gid == -1 {
-			accessPoints, err = localCloud.ListAccessPoints(ctx, accessPointsOptions.FileSystemId)
+		var usedGids map[int64]bool
+		var fileSystem *cloud.FileSystem
+		var uidAllocated, gidAllocated bool
+		progress.step(fmt.Sprintf("describing file system %v", accessPointsOptions.FileSystemId))
+		if allocateGid {
+			usedGids, err = d.provisioningBatch.listUsedGids(ctx, localCloud, accessPointsOptions.FileSystemId, gidMin, gidMax)
 		} else {
-			_, err = localCloud.DescribeFileSystem(ctx, accessPointsOptions.FileSystemId)
+			fileSystem, err = d.provisioningBatch.describeFileSystem(ctx, localCloud, accessPointsOptions.FileSystemId)
 		}
 		if err != nil {
 			if err == cloud.ErrAccessDenied {
@@ -281,35 +570,131 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 			if err == cloud.ErrNotFound {
 				return nil, status.Errorf(codes.InvalidArgument, "File System does not exist: %v", err)
 			}
+			if err == cloud.ErrDeadlineExceeded {
+				return nil, status.Errorf(codes.DeadlineExceeded, "Timed out fetching Access Points or describing File System: %v", err)
+			}
+			if errors.Is(err, cloud.ErrThrottled) {
+				return nil, errorWithRetryDelay(codes.ResourceExhausted, throttledRetryDelay, "Throttled fetching Access Points or describing File System: %v", err)
+			}
 			return nil, status.Errorf(codes.Internal, "Failed to fetch Access Points or Describe File System: %v", err)
 		}
 
-		var allocatedGid int64
-		if uid == -1 || gid == -1 {
-			allocatedGid, err = d.gidAllocator.getNextGid(accessPointsOptions.FileSystemId, accessPoints, gidMin, gidMax)
+		// The metrics of the file systems of other accounts cannot be read with the credentials of the driver
+		if d.burstCredits != nil && roleArn == "" {
+			progress.step(fmt.Sprintf("checking the burst credits of file system %v", accessPointsOptions.FileSystemId))
+			if fileSystem == nil {
+				fileSystem, err = d.provisioningBatch.describeFileSystem(ctx, localCloud, accessPointsOptions.FileSystemId)
+			}
 			if err != nil {
+				klog.Warningf("Failed to describe file system %s to check its burst credits: %v", accessPointsOptions.FileSystemId, err)
+			} else if err := d.burstCredits.check(ctx, fileSystem, volName, volumeParams); err != nil {
 				return nil, err
 			}
 		}
-		if uid == -1 {
-			uid = allocatedGid
-		}
-		if gid == -1 {
-			gid = allocatedGid
-		}
 
 		if value, ok := volumeParams[BasePath]; ok {
 			basePath = value
 		}
 
+		if value, ok := volumeParams[RequireBasePath]; ok {
+			requireBasePath, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid value for %v parameter: %v", RequireBasePath, err)
+			}
+			// The root of the file system always exists
+			if requireBasePath && strings.Trim(basePath, "/") != "" {
+				progress.step(fmt.Sprintf("mounting file system %v to check base path %q", accessPointsOptions.FileSystemId, basePath))
+				exists, err := d.directoryExists(ctx, localCloud, accessPointsOptions.FileSystemId, basePath, volName, roleArn, region, crossAccountDNSEnabled)
+				if err != nil {
+					return nil, status.Errorf(codes.Internal, "Could not check if base path %q exists in File System %v: %v", basePath, accessPointsOptions.FileSystemId, err)
+				}
+				if !exists {
+					return nil, status.Errorf(codes.FailedPrecondition, "Base path %q does not exist in File System %v", basePath, accessPointsOptions.FileSystemId)
+				}
+			}
+		}
+
+		// A simulation does not call the posix identity webhook, which may allocate the identity
+		if useIdentityWebhook && simulation != nil {
+			klog.V(4).Infof("Simulation of volume %v does not get the posix identity from the webhook", volName)
+		} else if useIdentityWebhook {
+			progress.step("getting the posix identity from the webhook")
+			identity, err := d.posixIdentityWebhook.GetPosixIdentity(ctx, &PosixIdentityRequest{
+				FileSystemId: accessPointsOptions.FileSystemId,
+				PvName:       volumeParams[PvName],
+				PvcName:      volumeParams[PvcName],
+				PvcNamespace: volumeParams[PvcNamespace],
+			})
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "Failed to get posix identity for volume %v: %v", volName, err)
+			}
+			if uid == -1 {
+				uid = *identity.Uid
+			}
+			if gid == -1 {
+				gid = *identity.Gid
+			}
+			accessPointsOptions.SecondaryGids = identity.SecondaryGids
+		} else if allocateGid {
+			getNextGid := d.gidAllocator.getNextGid
+			if simulation != nil {
+				getNextGid = d.gidAllocator.peekNextGid
+			}
+			allocatedGid, err := getNextGid(accessPointsOptions.FileSystemId, usedGids, gidMin, gidMax)
+			if errors.Is(err, errGidRangeExhausted) {
+				return nil, errorWithRetryDelay(codes.ResourceExhausted, exhaustedRetryDelay, "No GID available in range %v:%v of File System %v", gidMin, gidMax, accessPointsOptions.FileSystemId)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if uid == -1 {
+				uid = allocatedGid
+				uidAllocated = true
+			}
+			if gid == -1 {
+				gid = allocatedGid
+				gidAllocated = true
+			}
+		}
+
+		if d.provisioningPolicies != nil {
+			namespace, ok := volumeParams[PvcNamespace]
+			if !ok {
+				return nil, status.Errorf(codes.PermissionDenied, "Provisioning policies are enabled but the namespace of the claim is unknown, the external-provisioner must run with --extra-create-metadata")
+			}
+			err := d.provisioningPolicies.check(&provisioningRequest{
+				namespace:       namespace,
+				fileSystemId:    accessPointsOptions.FileSystemId,
+				basePath:        basePath,
+				uid:             uid,
+				gid:             gid,
+				identityUnknown: useIdentityWebhook && simulation != nil,
+			})
+			if err == errProvisioningPoliciesNotSynced {
+				return nil, status.Error(codes.Unavailable, err.Error())
+			}
+			if err != nil {
+				return nil, status.Errorf(codes.PermissionDenied, "Volume %v is not allowed: %v", volName, err)
+			}
+		}
+
 		rootDirName := volName
-		// Check if a custom structure should be imposed on the access point directory
-		if value, ok := volumeParams[SubPathPattern]; ok {
+		recordParentDirs := false
+		if provisioningMode == SharedAccessPointMode {
+			// The access point of the namespace is the parent of the directories of its volumes
+			rootDirName = volumeParams[PvcNamespace]
+		} else if value, ok := volumeParams[SubPathPattern]; ok {
+			// Check if a custom structure should be imposed on the access point directory
 			// Try and construct the root directory and check it only contains supported components
-			val, err := interpolateRootDirectoryName(value, volumeParams)
+			val, err := interpolateRootDirectoryName(value, &subPathPatternContext{
+				ctx:          ctx,
+				volumeParams: volumeParams,
+				k8sClient:    cloud.DefaultKubernetesAPIClient,
+			})
 			if err == nil {
 				klog.Infof("Using user-specified structure for access point directory.")
 				rootDirName = val
+				recordParentDirs = d.deleteAccessPointRootDir && d.deleteParentDirsMaxDepth > 0 && !accessPointsOptions.SkipCreationInfo
 				if value, ok := volumeParams[EnsureUniqueDirectory]; ok {
 					if ensureUniqueDirectory, err := strconv.ParseBool(value); !ensureUniqueDirectory && err == nil {
 						klog.Infof("Not appending PVC UID to path.")
@@ -329,16 +714,78 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		}
 
 		rootDir := path.Join("/", basePath, rootDirName)
-		if ok, err := validateEfsPathRequirements(rootDir); !ok {
+		if err := d.subPathPatternLimits.validate(rootDir); err != nil {
 			return nil, err
 		}
 		klog.Infof("Using %v as the access point directory.", rootDir)
 
+		if err := d.directoryCollisionCheck.check(ctx, volumeParams, accessPointsOptions.FileSystemId); err != nil {
+			if errors.Is(err, errDirectoryCollision) {
+				return nil, status.Errorf(codes.FailedPrecondition, "Volume %v cannot be created: %v", volName, err)
+			}
+			return nil, status.Errorf(codes.Unavailable, "Failed to check the directory collisions of volume %v: %v", volName, err)
+		}
+
+		// Without CreationInfo, EFS only requires the root directory to exist when the access point is first
+		// mounted, so it is checked here instead
+		if accessPointsOptions.SkipCreationInfo {
+			progress.step(fmt.Sprintf("mounting file system %v to check root directory %q", accessPointsOptions.FileSystemId, rootDir))
+			exists, err := d.directoryExists(ctx, localCloud, accessPointsOptions.FileSystemId, rootDir, volName, roleArn, region, crossAccountDNSEnabled)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "Could not check if root directory %q exists in File System %v: %v", rootDir, accessPointsOptions.FileSystemId, err)
+			}
+			if !exists {
+				return nil, status.Errorf(codes.FailedPrecondition, "Root directory %q does not exist in File System %v, it must be created beforehand with %v", rootDir, accessPointsOptions.FileSystemId, SkipCreationInfo)
+			}
+		}
+
 		accessPointsOptions.Uid = uid
 		accessPointsOptions.Gid = gid
 		accessPointsOptions.DirectoryPath = rootDir
+		details.rootDirectory = rootDir
+
+		if simulation != nil {
+			if sharedAccessPoint != nil {
+				simulation.reusedAccessPoint(sharedAccessPoint.AccessPointId, path.Join(rootDir, volName))
+			} else if provisioningMode == SharedAccessPointMode {
+				accessPointsOptions.Tags[cloud.SharedAccessPointTagKey] = volumeParams[PvcNamespace]
+				simulation.accessPoint(sharedAccessPointClientToken(accessPointsOptions.FileSystemId, rootDir), accessPointsOptions, details.posixUserSource)
+				simulation.res.Directory = path.Join(rootDir, volName)
+			} else {
+				simulation.accessPoint(clientToken, accessPointsOptions, details.posixUserSource)
+			}
+			return nil, nil
+		}
+
+		// Record the parents of the root directory that do not exist yet, which EFS creates for this volume
+		// and may be deleted with it, unless other volumes use them
+		if recordParentDirs {
+			progress.step(fmt.Sprintf("mounting file system %v to check the parent directories of %q", accessPointsOptions.FileSystemId, rootDir))
+			parentDirsBasePath, err := d.existingParentDir(ctx, localCloud, accessPointsOptions.FileSystemId, rootDir, basePath, volName, roleArn, region, crossAccountDNSEnabled)
+			if err != nil {
+				klog.Warningf("Not deleting the parent directories of %q with volume %v, which could not be checked: %v", rootDir, volName, err)
+			} else {
+				accessPointsOptions.Tags[cloud.ParentDirsBasePathTagKey] = parentDirsBasePath
+			}
+		}
 
-		accessPoint, err = localCloud.CreateAccessPoint(ctx, clientToken, accessPointsOptions)
+		progress.step("waiting for the access point creations in progress")
+		release, err := d.provisioningBatch.acquireCreation(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.DeadlineExceeded, "Timed out waiting for the access point creations in progress: %v", err)
+		}
+		progress.step(fmt.Sprintf("creating access point with root directory %v", rootDir))
+		if sharedAccessPoint != nil {
+			accessPoint, err = sharedAccessPoint, markAccessPointProvisioned(ctx, localCloud, sharedAccessPoint)
+		} else if provisioningMode == SharedAccessPointMode {
+			accessPointsOptions.Tags[cloud.SharedAccessPointTagKey] = volumeParams[PvcNamespace]
+			accessPoint, err = findOrCreateSharedAccessPoint(ctx, localCloud, sharedAccessPointClientToken(accessPointsOptions.FileSystemId, rootDir), accessPointsOptions)
+		} else if gidAllocated {
+			accessPoint, err = d.createAccessPointWithAllocatedGid(ctx, localCloud, clientToken, accessPointsOptions, uidAllocated, gidMin, gidMax)
+		} else {
+			accessPoint, err = createAccessPoint(ctx, localCloud, clientToken, accessPointsOptions)
+		}
+		release()
 		if err != nil {
 			if err == cloud.ErrAccessDenied {
 				return nil, status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
@@ -346,40 +793,120 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 			if err == cloud.ErrAlreadyExists {
 				return nil, status.Errorf(codes.AlreadyExists, "Access Point already exists")
 			}
+			if err == cloud.ErrDeadlineExceeded {
+				return nil, status.Errorf(codes.DeadlineExceeded, "Timed out creating Access point in File System %v : %v", accessPointsOptions.FileSystemId, err)
+			}
+			if err == cloud.ErrAccessPointLimitExceeded {
+				return nil, errorWithRetryDelay(codes.ResourceExhausted, exhaustedRetryDelay, "File System %v has the maximum number of Access Points", accessPointsOptions.FileSystemId)
+			}
+			if errors.Is(err, errGidRangeExhausted) {
+				return nil, errorWithRetryDelay(codes.ResourceExhausted, exhaustedRetryDelay, "No GID available in range %v:%v of File System %v", gidMin, gidMax, accessPointsOptions.FileSystemId)
+			}
+			if errors.Is(err, cloud.ErrThrottled) {
+				return nil, errorWithRetryDelay(codes.ResourceExhausted, throttledRetryDelay, "Throttled creating Access point in File System %v : %v", accessPointsOptions.FileSystemId, err)
+			}
 			return nil, status.Errorf(codes.Internal, "Failed to create Access point in File System %v : %v", accessPointsOptions.FileSystemId, err)
 		}
+		// The allocated gid may have been replaced after a collision, and a shared access point keeps the
+		// posix user of its first volume
+		if accessPoint.PosixUser != nil {
+			details.uid, details.gid = accessPoint.PosixUser.Uid, accessPoint.PosixUser.Gid
+		} else if !accessPointsOptions.SkipPosixUser {
+			details.uid, details.gid = accessPointsOptions.Uid, accessPointsOptions.Gid
+		}
 	}
 
-	volContext := map[string]string{}
+	// Only the volumes of an existing access point get here in a simulation
+	if simulation != nil {
+		simulation.reusedAccessPoint(existingAccessPointId, path.Join("/", volumeParams[BasePath], volName))
+		return nil, nil
+	}
 
-	// Enable cross-account dns resolution or fetch mount target Ip for cross-account mount
-	if roleArn != "" {
-		if crossAccountDNSEnabled {
-			// This option indicates the customer would like to use DNS to resolve
-			// the cross-account mount target ip address (in order to mount to
-			// the same AZ-ID as the client instance); mounttargetip should
-			// not be used as a mount option in this case.
-			volContext[CrossAccount] = strconv.FormatBool(true)
-		} else {
-			mountTarget, err := localCloud.DescribeMountTargets(ctx, accessPointsOptions.FileSystemId, azName)
-			if err != nil {
-				klog.Warningf("Failed to describe mount targets for file system %v. Skip using `mounttargetip` mount option: %v", accessPointsOptions.FileSystemId, err)
-			} else {
-				volContext[MountTargetIp] = mountTarget.IPAddress
+	volumeId := d.volumeId(accessPointsOptions.FileSystemId, "", accessPoint.AccessPointId, apiConfig)
+	if provisioningMode == SharedAccessPointMode {
+		progress.step(fmt.Sprintf("creating directory %v in shared access point %v", volName, accessPoint.AccessPointId))
+		err := d.withSharedAccessPoint(ctx, localCloud, accessPoint, roleArn, region, crossAccountDNSEnabled, func(ctx context.Context, target string) error {
+			if err := checkDirectoryLimit(target, volName, maxDirs); err != nil {
+				return err
+			}
+			return d.makeSharedDirectory(accessPoint, target, volName)
+		})
+		if errors.Is(err, errDirectoryLimitReached) {
+			return nil, errorWithRetryDelay(codes.ResourceExhausted, exhaustedRetryDelay, "Could not create directory %v in shared access point %v, which has the %v directories of parameter %v", volName, accessPoint.AccessPointId, maxDirs, MaxDirectoriesPerBasePath)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not create directory %v in shared access point %v: %v", volName, accessPoint.AccessPointId, err)
+		}
+		volumeId = d.volumeId(accessPointsOptions.FileSystemId, "/"+volName, accessPoint.AccessPointId, apiConfig)
+	}
+	if existingAccessPointId != "" {
+		dir := path.Join("/", volumeParams[BasePath], volName)
+		markDirectoryVolumes(ctx, localCloud, accessPoint)
+		progress.step(fmt.Sprintf("creating directory %v in access point %v", dir, existingAccessPointId))
+		err := d.withSharedAccessPoint(ctx, localCloud, accessPoint, roleArn, region, crossAccountDNSEnabled, func(ctx context.Context, target string) error {
+			if err := checkDirectoryLimit(path.Join(target, path.Dir(dir)), volName, maxDirs); err != nil {
+				return err
 			}
+			return d.makeSharedDirectory(accessPoint, target, dir)
+		})
+		if errors.Is(err, errDirectoryLimitReached) {
+			return nil, errorWithRetryDelay(codes.ResourceExhausted, exhaustedRetryDelay, "Could not create directory %v in access point %v, whose base path has the %v directories of parameter %v", dir, existingAccessPointId, maxDirs, MaxDirectoriesPerBasePath)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not create directory %v in access point %v: %v", dir, existingAccessPointId, err)
+		}
+		volumeId = d.volumeId(accessPointsOptions.FileSystemId, dir, existingAccessPointId, apiConfig)
+	}
+
+	volContext := map[string]string{}
+	if fsArn != nil {
+		volContext[FileSystemArn] = fsArn.String()
+	}
+
+	d.addMountTargetVolumeContext(ctx, progress, localCloud, accessPointsOptions.FileSystemId, azName, roleArn, crossAccountDNSEnabled, volContext)
 
+	if d.volumeMountCommand {
+		volContext[MountCommand] = mountCommand(volumeId, volContext, volCaps, d.cloud.GetMetadata().GetRegion())
+	}
+	if d.provisioningDetails {
+		details.mountTargetIp = volContext[MountTargetIp]
+		for k, v := range details.volumeContext() {
+			volContext[k] = v
 		}
 	}
 
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
 			CapacityBytes: volSize,
-			VolumeId:      accessPointsOptions.FileSystemId + "::" + accessPoint.AccessPointId,
+			VolumeId:      volumeId,
 			VolumeContext: volContext,
 		},
 	}, nil
 }
 
+// addMountTargetVolumeContext enables the cross-account DNS resolution, or sets the mount target IP, of the
+// cross-account mounts of the file system in the volume context
+func (d *Driver) addMountTargetVolumeContext(ctx context.Context, progress *provisioningProgress, localCloud cloud.Cloud, fileSystemId, azName, roleArn string, crossAccountDNSEnabled bool, volContext map[string]string) {
+	if roleArn == "" {
+		return
+	}
+	if crossAccountDNSEnabled {
+		// This option indicates the customer would like to use DNS to resolve
+		// the cross-account mount target ip address (in order to mount to
+		// the same AZ-ID as the client instance); mounttargetip should
+		// not be used as a mount option in this case.
+		volContext[CrossAccount] = strconv.FormatBool(true)
+		return
+	}
+	progress.step("discovering the mount targets of the file system")
+	mountTarget, err := localCloud.DescribeMountTargets(ctx, fileSystemId, azName)
+	if err != nil {
+		klog.Warningf("Failed to describe mount targets for file system %v. Skip using `mounttargetip` mount option: %v", fileSystemId, err)
+	} else {
+		volContext[MountTargetIp] = mountTarget.IPAddress
+	}
+}
+
 func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 	var (
 		localCloud             cloud.Cloud
@@ -388,7 +915,32 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 		err                    error
 	)
 
-	localCloud, roleArn, crossAccountDNSEnabled, err = getCloud(req.GetSecrets(), d)
+	secrets, err := d.secretsResolver.resolve(ctx, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	apiConfig, err := parseAPIConfig(secrets)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid API secrets: %v", err)
+	}
+	if apiConfig.Region == "" {
+		apiConfig.Region = secrets[AwsRegion]
+	}
+	// The v2 volume handle records the EFS API of the volume if it is not the one of the controller, which the
+	// secrets override
+	if handle, err := parseVolumeHandle(req.GetVolumeId()); err == nil {
+		recorded := handle.apiConfig()
+		if apiConfig.Region == "" {
+			apiConfig.Region = recorded.Region
+		}
+		if apiConfig.Endpoint == "" {
+			apiConfig.Endpoint = recorded.Endpoint
+		}
+		if _, ok := secrets[RoleArn]; !ok && apiConfig.RoleArn == "" {
+			apiConfig.RoleArn = recorded.RoleArn
+		}
+	}
+	localCloud, roleArn, crossAccountDNSEnabled, err = getCloud(secrets, d, apiConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -399,15 +951,29 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
 	}
 
-	fileSystemId, _, accessPointId, err := parseVolumeId(volId)
+	fileSystemId, subpath, accessPointId, err := parseVolumeId(volId)
 	if err != nil {
 		//Returning success for an invalid volume ID. See here - https://github.com/kubernetes-csi/csi-test/blame/5deb83d58fea909b2895731d43e32400380aae3c/pkg/sanity/controller.go#L733
 		klog.V(5).Infof("DeleteVolume: Failed to parse volumeID: %v, err: %v, returning success", volId, err)
 		return &csi.DeleteVolumeResponse{}, nil
 	}
 
-	//TODO: Add Delete File System when FS provisioning is implemented
+	// The volumes of provisioning mode efs-fs are whole file systems
+	if accessPointId == "" && subpath == "" {
+		if err := d.deleteFileSystemVolume(ctx, localCloud, volId, fileSystemId); err != nil {
+			return nil, err
+		}
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+	// The volumes with a sub path are directories of an access point that is kept
+	if accessPointId != "" && subpath != "" {
+		if err := d.deleteSharedVolume(ctx, localCloud, volId, fileSystemId, subpath, accessPointId, roleArn, apiConfig.Region, crossAccountDNSEnabled); err != nil {
+			return nil, err
+		}
+		return &csi.DeleteVolumeResponse{}, nil
+	}
 	if accessPointId != "" {
+		var fencingToken string
 
 		// Delete access point root directory if delete-access-point-root-dir is set.
 		if d.deleteAccessPointRootDir {
@@ -419,59 +985,83 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 					return nil, status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
 				}
 				if err == cloud.ErrNotFound {
+					if err := checkAccessPointDeleted(ctx, localCloud, volId, fileSystemId, accessPointId); err != nil {
+						return nil, err
+					}
 					klog.V(5).Infof("DeleteVolume: Access Point %v not found, returning success", accessPointId)
 					return &csi.DeleteVolumeResponse{}, nil
 				}
+				if err == cloud.ErrDeadlineExceeded {
+					return nil, status.Errorf(codes.DeadlineExceeded, "Timed out describing Access Point: %v", accessPointId)
+				}
 				return nil, status.Errorf(codes.Internal, "Could not get describe Access Point: %v , error: %v", accessPointId, err)
 			}
+			fencingToken, err = d.deletionFencing.acquire(ctx, localCloud, accessPoint)
+			if err != nil {
+				return nil, deletionFencingError(accessPointId, err)
+			}
 
-			//Mount File System at it root and delete access point root directory
-			mountOptions := []string{"tls", "iam"}
-			if roleArn != "" {
-				if crossAccountDNSEnabled {
-					// Connect via dns rather than mounttargetip
-					mountOptions = append(mountOptions, CrossAccount)
-				} else {
-					mountTarget, err := localCloud.DescribeMountTargets(ctx, fileSystemId, "")
-					if err == nil {
-						mountOptions = append(mountOptions, MountTargetIp+"="+mountTarget.IPAddress)
-					} else {
-						klog.Warningf("Failed to describe mount targets for file system %v. Skip using `mounttargetip` mount option: %v", fileSystemId, err)
+			// The root directory of an access point created on an existing directory was not created by the driver
+			if accessPoint.ExistingRootDir {
+				klog.Infof("DeleteVolume: keeping root directory %q of access point %v, which existed before it", accessPoint.AccessPointRootDir, accessPointId)
+			} else {
+				//Mount File System at it root and delete access point root directory
+				mountOptions := d.rootMountOptions(ctx, localCloud, fileSystemId, roleArn, apiConfig.Region, crossAccountDNSEnabled)
+				target := TempMountPathPrefix + "/" + accessPointId
+				audit := d.deleteAudit.newRecord(ctx, volId, fileSystemId, accessPointId, accessPoint.AccessPointRootDir)
+				err = d.withTempMount(ctx, fileSystemId, target, mountOptions, func(ctx context.Context, target string) error {
+					// Another replica may have taken over the deletion while the file system was mounted
+					if err := d.deletionFencing.check(ctx, localCloud, accessPointId, fencingToken); err != nil {
+						return err
 					}
+					holdCtx, stop := d.deletionFencing.hold(ctx, localCloud, accessPointId, fencingToken)
+					removed, err := removeAllWithContext(holdCtx, target+accessPoint.AccessPointRootDir)
+					stop()
+					if cause := context.Cause(holdCtx); errors.Is(cause, errDeletionFenced) {
+						err = cause
+					}
+					d.deleteAudit.write(audit, removed, err)
+					if errors.Is(err, errDeletionFenced) {
+						return err
+					}
+					if err != nil {
+						return fmt.Errorf("could not delete access point root directory %q: %v", accessPoint.AccessPointRootDir, err)
+					}
+					if d.deleteParentDirsMaxDepth > 0 && accessPoint.ParentDirsBasePath != "" {
+						removeEmptyParentDirs(target, accessPoint.AccessPointRootDir, accessPoint.ParentDirsBasePath, d.deleteParentDirsMaxDepth)
+					}
+					return nil
+				})
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, status.FromContextError(ctxErr).Err()
+				}
+				if errors.Is(err, errDeletionFenced) || errors.Is(err, cloud.ErrAccessDenied) {
+					return nil, deletionFencingError(accessPointId, err)
+				}
+				if err != nil {
+					return nil, status.Errorf(codes.Internal, "Could not delete access point root directory %q: %v", accessPoint.AccessPointRootDir, err)
 				}
-			}
-
-			target := TempMountPathPrefix + "/" + accessPointId
-			if err := d.mounter.MakeDir(target); err != nil {
-				return nil, status.Errorf(codes.Internal, "Could not create dir %q: %v", target, err)
-			}
-			if err := d.mounter.Mount(fileSystemId, target, "efs", mountOptions); err != nil {
-				os.Remove(target)
-				return nil, status.Errorf(codes.Internal, "Could not mount %q at %q: %v", fileSystemId, target, err)
-			}
-			err = os.RemoveAll(target + accessPoint.AccessPointRootDir)
-			if err != nil {
-				return nil, status.Errorf(codes.Internal, "Could not delete access point root directory %q: %v", accessPoint.AccessPointRootDir, err)
-			}
-			err = d.mounter.Unmount(target)
-			if err != nil {
-				return nil, status.Errorf(codes.Internal, "Could not unmount %q: %v", target, err)
-			}
-			err = os.RemoveAll(target)
-			if err != nil {
-				return nil, status.Errorf(codes.Internal, "Could not delete %q: %v", target, err)
 			}
 		}
 
-		// Delete access point
+		// Delete access point, unless another replica took over its deletion meanwhile
+		if err := d.deletionFencing.check(ctx, localCloud, accessPointId, fencingToken); err != nil {
+			return nil, deletionFencingError(accessPointId, err)
+		}
 		if err = localCloud.DeleteAccessPoint(ctx, accessPointId); err != nil {
 			if err == cloud.ErrAccessDenied {
 				return nil, status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
 			}
 			if err == cloud.ErrNotFound {
+				if err := checkAccessPointDeleted(ctx, localCloud, volId, fileSystemId, accessPointId); err != nil {
+					return nil, err
+				}
 				klog.V(5).Infof("DeleteVolume: Access Point not found, returning success")
 				return &csi.DeleteVolumeResponse{}, nil
 			}
+			if err == cloud.ErrDeadlineExceeded {
+				return nil, status.Errorf(codes.DeadlineExceeded, "Timed out deleting volume %v", volId)
+			}
 			return nil, status.Errorf(codes.Internal, "Failed to Delete volume %v: %v", volId, err)
 		}
 	} else {
@@ -481,12 +1071,82 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
+// checkAccessPointDeleted returns nil if the access point of the volume, which the EFS API did not find, was
+// deleted. The file system must be found, otherwise the API configuration of the volume, e.g. its region or
+// role in another account, could not be reconstructed from the secrets and the volume ID, and the access
+// point may still exist.
+func checkAccessPointDeleted(ctx context.Context, localCloud cloud.Cloud, volId, fileSystemId, accessPointId string) error {
+	_, err := localCloud.DescribeFileSystem(ctx, fileSystemId)
+	if err == nil {
+		return nil
+	}
+	if err == cloud.ErrNotFound {
+		return status.Errorf(codes.FailedPrecondition, "Access point %v of volume %v not found, nor its File System %v: the region or role of the volume cannot be determined, the secrets of its StorageClass must be passed to DeleteVolume", accessPointId, volId, fileSystemId)
+	}
+	if err == cloud.ErrAccessDenied {
+		return status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
+	}
+	if err == cloud.ErrDeadlineExceeded {
+		return status.Errorf(codes.DeadlineExceeded, "Timed out describing File System: %v", fileSystemId)
+	}
+	return status.Errorf(codes.Internal, "Could not describe File System %v of volume %v: %v", fileSystemId, volId, err)
+}
+
 func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	if d.attachments == nil {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	klog.V(4).Infof("ControllerPublishVolume: called with args %+v", util.SanitizeRequest(*req))
+	volId := req.GetVolumeId()
+	if volId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
+	}
+	nodeId := req.GetNodeId()
+	if nodeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Node ID not provided")
+	}
+	volCap := req.GetVolumeCapability()
+	if volCap == nil {
+		return nil, status.Error(codes.InvalidArgument, "Volume capability not provided")
+	}
+	if err := d.isValidVolumeCapabilities([]*csi.VolumeCapability{volCap}); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, _, _, err := parseVolumeId(volId); err != nil {
+		return nil, status.Errorf(codes.NotFound, "Volume not found, err: %v", err)
+	}
+
+	// EFS volumes are mounted by the node without any attachment, the volume is only recorded
+	singleNode := volCap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+	if err := d.attachments.attach(volId, nodeId, singleNode); err != nil {
+		if err == errAttachmentsNotRestored {
+			return nil, status.Errorf(codes.Unavailable, "Volume %v cannot be published to node %v: %v", volId, nodeId, err)
+		}
+		if err == errVolumeAttachLimit {
+			return nil, status.Errorf(codes.ResourceExhausted, "Node %v already has the maximum of %d volumes published", nodeId, d.attachments.limit)
+		}
+		if errors.Is(err, errVolumePublishedToOtherNode) {
+			return nil, status.Errorf(codes.FailedPrecondition, "Volume %v with a single node access mode cannot be published to node %v: %v", volId, nodeId, err)
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to publish volume %v to node %v: %v", volId, nodeId, err)
+	}
+	klog.V(5).Infof("ControllerPublishVolume: volume %v published to node %v, which has %d volumes", volId, nodeId, d.attachments.count(nodeId))
+	return &csi.ControllerPublishVolumeResponse{}, nil
 }
 
 func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	if d.attachments == nil {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	klog.V(4).Infof("ControllerUnpublishVolume: called with args %+v", util.SanitizeRequest(*req))
+	volId := req.GetVolumeId()
+	if volId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
+	}
+
+	// An empty node ID unpublishes the volume from all the nodes
+	d.attachments.detach(volId, req.GetNodeId())
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
 func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
@@ -526,7 +1186,17 @@ func (d *Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (
 func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
 	klog.V(4).Infof("ControllerGetCapabilities: called with args %+v", util.SanitizeRequest(*req))
 	var caps []*csi.ControllerServiceCapability
-	for _, cap := range controllerCaps {
+	if d.efsAPIDenied.Load() {
+		return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
+	}
+	rpcCaps := controllerCaps
+	if d.attachments != nil {
+		rpcCaps = append(rpcCaps[:len(rpcCaps):len(rpcCaps)], csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME)
+	}
+	if d.snapshots != nil {
+		rpcCaps = append(rpcCaps[:len(rpcCaps):len(rpcCaps)], csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT, csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
+	}
+	for _, cap := range rpcCaps {
 		c := &csi.ControllerServiceCapability{
 			Type: &csi.ControllerServiceCapability_Rpc{
 				Rpc: &csi.ControllerServiceCapability_RPC{
@@ -539,39 +1209,25 @@ func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.Control
 	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
 }
 
-func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
-
-func (d *Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
-
-func (d *Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
-
-func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
-
 func (d *Driver) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
 
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-func getCloud(secrets map[string]string, driver *Driver) (cloud.Cloud, string, bool, error) {
+// getCloud returns the cloud calling the EFS API of the config, or of the region in the secrets if it has
+// none, with the role of the config or else the role in the secrets if any
+func getCloud(secrets map[string]string, driver *Driver, apiConfig cloud.APIConfig) (cloud.Cloud, string, bool, error) {
 
 	var localCloud cloud.Cloud
-	var roleArn string
 	var crossAccountDNSEnabled bool
 	var err error
 
 	// Fetch aws role ARN for cross account mount from CSI secrets. Link to CSI secrets below
 	// https://kubernetes-csi.github.io/docs/secrets-and-credentials.html#csi-operation-secrets
-	if value, ok := secrets[RoleArn]; ok {
-		roleArn = value
+	if value, ok := secrets[RoleArn]; ok && apiConfig.RoleArn == "" {
+		apiConfig.RoleArn = value
 	}
+	roleArn := apiConfig.RoleArn
 	if value, ok := secrets[CrossAccount]; ok {
 		crossAccountDNSEnabled, err = strconv.ParseBool(value)
 		if err != nil {
@@ -580,9 +1236,15 @@ func getCloud(secrets map[string]string, driver *Driver) (cloud.Cloud, string, b
 	} else {
 		crossAccountDNSEnabled = false
 	}
+	if value, ok := secrets[AwsRegion]; ok && apiConfig.Region == "" {
+		apiConfig.Region = value
+	}
 
-	if roleArn != "" {
-		localCloud, err = cloud.NewCloudWithRole(roleArn)
+	if roleArn != "" || apiConfig.Endpoint != "" || (apiConfig.Region != "" && apiConfig.Region != driver.cloud.GetMetadata().GetRegion()) {
+		localCloud, err = driver.apiClients.get(apiConfig, driver.cloudOptions)
+		if errors.Is(err, cloud.ErrPartitionMismatch) {
+			return nil, "", false, status.Errorf(codes.InvalidArgument, "Invalid API config: %v", err)
+		}
 		if err != nil {
 			return nil, "", false, status.Errorf(codes.Unauthenticated, "Unable to initialize aws cloud: %v. Please verify role has the correct AWS permissions for cross account mount", err)
 		}
@@ -593,52 +1255,56 @@ func getCloud(secrets map[string]string, driver *Driver) (cloud.Cloud, string, b
 	return localCloud, roleArn, crossAccountDNSEnabled, nil
 }
 
-func interpolateRootDirectoryName(rootDirectoryPath string, volumeParams map[string]string) (string, error) {
-	r := strings.NewReplacer(createListOfVariableSubstitutions(volumeParams)...)
-	result := r.Replace(rootDirectoryPath)
-
-	// Check if any templating characters still exist
-	if strings.Contains(result, "${") || strings.Contains(result, "}") {
-		return "", status.Errorf(codes.InvalidArgument,
-			"Path specified \"%v\" contains invalid elements. Can only contain %v", rootDirectoryPath,
-			getSupportedComponentNames())
+// getRootMountOptions returns the options used by the controller to mount the root of a file system
+func getRootMountOptions(ctx context.Context, localCloud cloud.Cloud, fileSystemId, roleArn, region string, crossAccountDNSEnabled bool) []string {
+	mountOptions := []string{"tls", "iam"}
+	if region != "" && region != localCloud.GetMetadata().GetRegion() {
+		mountOptions = append(mountOptions, "region="+region)
 	}
-	return result, nil
-}
-
-func createListOfVariableSubstitutions(volumeParams map[string]string) []string {
-	variableSubstitutions := make([]string, 2*len(subPathPatternComponents))
-	i := 0
-	for key, volumeParamsKey := range subPathPatternComponents {
-		variableSubstitutions[i] = "${" + key + "}"
-		variableSubstitutions[i+1] = volumeParams[volumeParamsKey]
-		i += 2
+	if roleArn != "" {
+		if crossAccountDNSEnabled {
+			// Connect via dns rather than mounttargetip
+			mountOptions = append(mountOptions, CrossAccount)
+		} else {
+			mountTarget, err := localCloud.DescribeMountTargets(ctx, fileSystemId, "")
+			if err == nil {
+				mountOptions = append(mountOptions, MountTargetIp+"="+mountTarget.IPAddress)
+			} else {
+				klog.Warningf("Failed to describe mount targets for file system %v. Skip using `mounttargetip` mount option: %v", fileSystemId, err)
+			}
+		}
 	}
-	return variableSubstitutions
+	return mountOptions
 }
 
-func getSupportedComponentNames() []string {
-	keys := make([]string, len(subPathPatternComponents))
-
-	i := 0
-	for key := range subPathPatternComponents {
-		keys[i] = key
-		i++
+// directoryExists mounts the root of the file system on a temporary path of the controller
+// and checks whether the path is an existing directory.
+func (d *Driver) directoryExists(ctx context.Context, localCloud cloud.Cloud, fileSystemId, dirPath, volName, roleArn, region string, crossAccountDNSEnabled bool) (bool, error) {
+	mountOptions := d.rootMountOptions(ctx, localCloud, fileSystemId, roleArn, region, crossAccountDNSEnabled)
+	target := TempMountPathPrefix + "/" + volName
+	if err := d.mounter.MakeDir(target); err != nil {
+		return false, fmt.Errorf("could not create dir %q: %v", target, err)
 	}
-	sort.Strings(keys)
-	return keys
-}
+	if err := d.mounter.Mount(fileSystemId, target, "efs", mountOptions); err != nil {
+		os.Remove(target)
+		return false, fmt.Errorf("could not mount %q at %q: %v", fileSystemId, target, err)
+	}
+	defer func() {
+		if err := d.mounter.Unmount(target); err != nil {
+			klog.Warningf("Could not unmount %q: %v", target, err)
+			return
+		}
+		os.Remove(target)
+	}()
 
-func validateEfsPathRequirements(proposedPath string) (bool, error) {
-	if len(proposedPath) > 100 {
-		// Check the proposed path is 100 characters or fewer
-		return false, status.Errorf(codes.InvalidArgument, "Proposed path '%s' exceeds EFS limit of 100 characters", proposedPath)
-	} else if strings.Count(proposedPath, "/") > 5 {
-		// Check the proposed path contains at most 4 subdirectories
-		return false, status.Errorf(codes.InvalidArgument, "Proposed path '%s' EFS limit of 4 subdirectories", proposedPath)
-	} else {
-		return true, nil
+	info, err := os.Stat(path.Join(target, "/", dirPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
 	}
+	return info.IsDir(), nil
 }
 
 func get64LenHash(text string) string {
@@ -646,3 +1312,26 @@ func get64LenHash(text string) string {
 	h.Write([]byte(text))
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
+
+// unknownParameters returns the sorted parameters that are neither storage class parameters of the driver nor
+// parameters of the external-provisioner, which are mostly typos of the storage class parameters
+func unknownParameters(volumeParams map[string]string) []string {
+	var unknown []string
+	for key := range volumeParams {
+		if strings.HasPrefix(key, "csi.storage.k8s.io/") {
+			continue
+		}
+		known := false
+		for _, param := range storageClassParameters {
+			if key == param {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
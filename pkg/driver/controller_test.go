@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -16,6 +20,7 @@ import (
 	"github.com/golang/mock/gomock"
 
 	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	cloudmocks "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
 	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
 )
 
@@ -102,6 +107,77 @@ func TestCreateVolume(t *testing.T) {
 				if res.Volume.VolumeId != volumeId {
 					t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", volumeId, res.Volume.VolumeId)
 				}
+				// Older nodes reject the mountCommand volume attribute, it is only added with volume-mount-command
+				if _, ok := res.Volume.VolumeContext[MountCommand]; ok {
+					t.Fatalf("Unexpected %s in the volume context %v", MountCommand, res.Volume.VolumeContext)
+				}
+				// Nor are the provisioning details added without volume-provisioning-details
+				for key := range res.Volume.VolumeContext {
+					if strings.HasPrefix(key, ProvisioningDetailsPrefix) {
+						t.Fatalf("Unexpected %s in the volume context %v", key, res.Volume.VolumeContext)
+					}
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: Provisioning details in the volume context",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:            endpoint,
+					cloud:               mockCloud,
+					gidAllocator:        NewGidAllocator(),
+					provisioningDetails: true,
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						BasePath:         "test",
+						Uid:              "1000",
+						Gid:              "1001",
+					},
+				}
+
+				ctx := context.Background()
+				fileSystem := &cloud.FileSystem{
+					FileSystemId: fsId,
+				}
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+				}
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(fileSystem, nil)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).Return(accessPoint, nil)
+
+				res, err := driver.CreateVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+
+				expected := map[string]string{
+					ProvisioningDetailsPrefix + "provisioningMode":  "efs-ap",
+					ProvisioningDetailsPrefix + "reusedAccessPoint": "false",
+					ProvisioningDetailsPrefix + "posixUserSource":   "parameters",
+					ProvisioningDetailsPrefix + "uid":               "1000",
+					ProvisioningDetailsPrefix + "gid":               "1001",
+					ProvisioningDetailsPrefix + "rootDirectory":     "/test/" + volumeName,
+				}
+				if !reflect.DeepEqual(res.Volume.VolumeContext, expected) {
+					t.Fatalf("Volume context mismatched. Expected: %v, Actual: %v", expected, res.Volume.VolumeContext)
+				}
 				mockCtl.Finish()
 			},
 		},
@@ -227,7 +303,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				var expectedGid int64 = 1003 //1001 and 1002 are taken, next available is 1003
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
 						if accessPointOpts.Uid != expectedGid {
@@ -322,7 +398,7 @@ func TestCreateVolume(t *testing.T) {
 				accessPoints := []*cloud.AccessPoint{ap1, ap2, ap3}
 				var expectedGid int64 = 1004 // 1001-1003 is taken.
 
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(ap2, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
 						if accessPointOpts.Uid != expectedGid {
@@ -339,7 +415,7 @@ func TestCreateVolume(t *testing.T) {
 				accessPoints = []*cloud.AccessPoint{}
 				expectedGid = 1001 // 1001 is now free and lowest possible, if no GID return would happen allocator would pick 1005.
 
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(ap3, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
 						if accessPointOpts.Uid != expectedGid {
@@ -356,7 +432,7 @@ func TestCreateVolume(t *testing.T) {
 				accessPoints = []*cloud.AccessPoint{ap1, ap4}
 				expectedGid = 1002 // 1001 and 1004 are now taken, lowest available is 1002
 
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(ap2, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
 						if accessPointOpts.Uid != expectedGid {
@@ -443,7 +519,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				expectedGid := 2000
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(lastAccessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
 						if accessPointOpts.Uid != int64(expectedGid) {
@@ -463,7 +539,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				accessPoints = append(accessPoints, lastAccessPoint)
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 
 				// All 1000 GIDs are taken now, internal limit should take effect causing CreateVolume to fail.
 				_, err = driver.CreateVolume(ctx, req)
@@ -511,7 +587,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				expectedGid := 1000 // Allocator should pick lowest available GID
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
 						if accessPointOpts.Uid != int64(expectedGid) {
@@ -573,7 +649,7 @@ func TestCreateVolume(t *testing.T) {
 					},
 				}
 				accessPoints := []*cloud.AccessPoint{accessPoint}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).Return(accessPoint, nil)
 
 				res, err := driver.CreateVolume(ctx, req)
@@ -592,6 +668,122 @@ func TestCreateVolume(t *testing.T) {
 				mockCtl.Finish()
 			},
 		},
+		{
+			name: "Success: Using posix identity webhook",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+					tags:         parseTagsFromStr(""),
+					posixIdentityWebhook: &fakePosixIdentityWebhook{
+						identity: &PosixIdentity{Uid: int64Ptr(3000), Gid: int64Ptr(3001), SecondaryGids: []int64{3002}},
+					},
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						PvcName:          "pvc",
+						PvcNamespace:     "ns",
+					},
+				}
+
+				ctx := context.Background()
+				fileSystem := &cloud.FileSystem{
+					FileSystemId: fsId,
+				}
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+				}
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(fileSystem, nil)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).Return(accessPoint, nil).
+					Do(func(ctx context.Context, clientToken string, accessPointsOptions *cloud.AccessPointOptions) {
+						if accessPointsOptions.Uid != 3000 {
+							t.Fatalf("Uid mismatched. Expected: %v, actual: %v", 3000, accessPointsOptions.Uid)
+						}
+						if accessPointsOptions.Gid != 3001 {
+							t.Fatalf("Gid mismatched. Expected: %v, actual: %v", 3001, accessPointsOptions.Gid)
+						}
+						if len(accessPointsOptions.SecondaryGids) != 1 || accessPointsOptions.SecondaryGids[0] != 3002 {
+							t.Fatalf("SecondaryGids mismatched. Expected: %v, actual: %v", []int64{3002}, accessPointsOptions.SecondaryGids)
+						}
+					})
+
+				res, err := driver.CreateVolume(ctx, req)
+
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+
+				if res.Volume.VolumeId != volumeId {
+					t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", volumeId, res.Volume.VolumeId)
+				}
+				webhookReq := driver.posixIdentityWebhook.(*fakePosixIdentityWebhook).req
+				if webhookReq.PvcName != "pvc" || webhookReq.PvcNamespace != "ns" || webhookReq.FileSystemId != fsId {
+					t.Fatalf("Unexpected posix identity webhook request: %+v", webhookReq)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: Posix identity webhook fails",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:             endpoint,
+					cloud:                mockCloud,
+					gidAllocator:         NewGidAllocator(),
+					tags:                 parseTagsFromStr(""),
+					posixIdentityWebhook: &fakePosixIdentityWebhook{err: errors.New("webhook unavailable")},
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+					},
+				}
+
+				ctx := context.Background()
+				fileSystem := &cloud.FileSystem{
+					FileSystemId: fsId,
+				}
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(fileSystem, nil)
+
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				if status.Code(err) != codes.Internal {
+					t.Fatalf("Expected error code %v, got %v", codes.Internal, status.Code(err))
+				}
+				mockCtl.Finish()
+			},
+		},
 		{
 			name: "Success: Using Default GID ranges",
 			testFunc: func(t *testing.T) {
@@ -629,7 +821,7 @@ func TestCreateVolume(t *testing.T) {
 					},
 				}
 				accessPoints := []*cloud.AccessPoint{accessPoint}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil)
 
 				res, err := driver.CreateVolume(ctx, req)
@@ -688,7 +880,7 @@ func TestCreateVolume(t *testing.T) {
 					},
 				}
 				accessPoints := []*cloud.AccessPoint{accessPoint}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil)
 
 				res, err := driver.CreateVolume(ctx, req)
@@ -747,7 +939,7 @@ func TestCreateVolume(t *testing.T) {
 					},
 				}
 				accessPoints := []*cloud.AccessPoint{accessPoint}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(accessPoints, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(accessPoints, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil)
 
 				res, err := driver.CreateVolume(ctx, req)
@@ -830,7 +1022,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Success: Normal flow with a valid directory structure set",
+			name: "Fail: reuseAccessPointName is true with an access point being deleted",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -842,10 +1034,6 @@ func TestCreateVolume(t *testing.T) {
 					tags:         parseTagsFromStr(""),
 				}
 
-				pvName := "foo"
-				pvcName := "bar"
-				directoryCreated := fmt.Sprintf("/%s/%s", pvName, pvcName)
-
 				req := &csi.CreateVolumeRequest{
 					Name: volumeName,
 					VolumeCapabilities: []*csi.VolumeCapability{
@@ -855,52 +1043,84 @@ func TestCreateVolume(t *testing.T) {
 						RequiredBytes: capacityRange,
 					},
 					Parameters: map[string]string{
-						ProvisioningMode: "efs-ap",
-						FsId:             fsId,
-						GidMin:           "1000",
-						GidMax:           "2000",
-						DirectoryPerms:   "777",
-						SubPathPattern:   "${.PV.name}/${.PVC.name}",
-						PvName:           pvName,
-						PvcName:          pvcName,
+						ProvisioningMode:    "efs-ap",
+						FsId:                fsId,
+						DirectoryPerms:      "777",
+						ReuseAccessPointKey: "true",
+						PvcNameKey:          "test-pvc",
 					},
 				}
 
 				ctx := context.Background()
+
 				accessPoint := &cloud.AccessPoint{
 					AccessPointId: apId,
 					FileSystemId:  fsId,
+					DeletionToken: "controller-0-1234",
+					DeletingSince: time.Now(),
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Any(), gomock.Eq(fsId)).Return(accessPoint, nil)
 
-				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
-					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
-						if !verifyPathWhenUUIDIncluded(accessPointOpts.DirectoryPath, directoryCreated) {
-							t.Fatalf("Root directory mismatch. Expected: %v (with UID appended), actual: %v",
-								directoryCreated,
-								accessPointOpts.DirectoryPath)
-						}
-					})
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.Aborted {
+					t.Fatalf("Expected the reuse of the access point being deleted to be aborted, got %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: reuseAccessPointName is true with an access point of another cluster",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
 
-				res, err := driver.CreateVolume(ctx, req)
+				driver := &Driver{
+					endpoint:          endpoint,
+					cloud:             mockCloud,
+					gidAllocator:      NewGidAllocator(),
+					tags:              parseTagsFromStr(""),
+					clusterId:         "cluster-a",
+					strictAPOwnership: true,
+				}
 
-				if err != nil {
-					t.Fatalf("CreateVolume failed: %v", err)
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode:    "efs-ap",
+						FsId:                fsId,
+						GidMin:              "1000",
+						GidMax:              "2000",
+						DirectoryPerms:      "777",
+						ReuseAccessPointKey: "true",
+						PvcNameKey:          "test-pvc",
+					},
 				}
 
-				if res.Volume == nil {
-					t.Fatal("Volume is nil")
+				ctx := context.Background()
+
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+					ClusterId:     "cluster-b",
 				}
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Any(), gomock.Eq(fsId)).Return(accessPoint, nil)
 
-				if res.Volume.VolumeId != volumeId {
-					t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", volumeId, res.Volume.VolumeId)
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.FailedPrecondition {
+					t.Fatalf("Expected FailedPrecondition, got: %v", err)
 				}
 
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Success: Normal flow with a valid directory structure set, using a single element",
+			name: "Success: Normal flow with a valid directory structure set",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -912,8 +1132,9 @@ func TestCreateVolume(t *testing.T) {
 					tags:         parseTagsFromStr(""),
 				}
 
-				pvcName := "foo"
-				directoryCreated := fmt.Sprintf("/%s", pvcName)
+				pvName := "foo"
+				pvcName := "bar"
+				directoryCreated := fmt.Sprintf("/%s/%s", pvName, pvcName)
 
 				req := &csi.CreateVolumeRequest{
 					Name: volumeName,
@@ -929,7 +1150,8 @@ func TestCreateVolume(t *testing.T) {
 						GidMin:           "1000",
 						GidMax:           "2000",
 						DirectoryPerms:   "777",
-						SubPathPattern:   "${.PVC.name}",
+						SubPathPattern:   "${.PV.name}/${.PVC.name}",
+						PvName:           pvName,
 						PvcName:          pvcName,
 					},
 				}
@@ -939,7 +1161,7 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
@@ -968,22 +1190,22 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Success: Normal flow with a valid directory structure set, and a basePath",
+			name: "Success: Normal flow with a valid directory structure set, recording the parent directories base path",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
 				driver := &Driver{
-					endpoint:     endpoint,
-					cloud:        mockCloud,
-					gidAllocator: NewGidAllocator(),
-					tags:         parseTagsFromStr(""),
+					endpoint:                 endpoint,
+					cloud:                    mockCloud,
+					mounter:                  mockMounter,
+					gidAllocator:             NewGidAllocator(),
+					tags:                     parseTagsFromStr(""),
+					deleteAccessPointRootDir: true,
+					deleteParentDirsMaxDepth: 2,
 				}
 
-				pvcName := "foo"
-				basePath := "bash"
-				directoryCreated := fmt.Sprintf("/%s/%s", basePath, pvcName)
-
 				req := &csi.CreateVolumeRequest{
 					Name: volumeName,
 					VolumeCapabilities: []*csi.VolumeCapability{
@@ -993,15 +1215,15 @@ func TestCreateVolume(t *testing.T) {
 						RequiredBytes: capacityRange,
 					},
 					Parameters: map[string]string{
-						ProvisioningMode:      "efs-ap",
-						FsId:                  fsId,
-						GidMin:                "1000",
-						GidMax:                "2000",
-						DirectoryPerms:        "777",
-						SubPathPattern:        "${.PVC.name}",
-						BasePath:              basePath,
-						EnsureUniqueDirectory: "true",
-						PvcName:               pvcName,
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+						BasePath:         "dynamic/",
+						SubPathPattern:   "${.PVC.namespace}/${.PVC.name}",
+						PvcNamespace:     "foo",
+						PvcName:          "bar",
 					},
 				}
 
@@ -1010,18 +1232,149 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+				// None of the parent directories exist, they are created with the access point
+				mockMounter.EXPECT().MakeDir(gomock.Eq(TempMountPathPrefix + "/" + volumeName)).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(TempMountPathPrefix+"/"+volumeName), gomock.Eq("efs"), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Eq(TempMountPathPrefix + "/" + volumeName)).Return(nil)
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
-						if !verifyPathWhenUUIDIncluded(accessPointOpts.DirectoryPath, directoryCreated) {
-							t.Fatalf("Root directory mismatch. Expected: %v (with UID appended), actual: %v",
-								directoryCreated,
-								accessPointOpts.DirectoryPath)
+						if basePath := accessPointOpts.Tags[cloud.ParentDirsBasePathTagKey]; basePath != "/dynamic" {
+							t.Fatalf("Parent directories base path mismatch. Expected: %v, actual: %v", "/dynamic", basePath)
 						}
 					})
 
-				res, err := driver.CreateVolume(ctx, req)
+				if _, err := driver.CreateVolume(ctx, req); err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: Normal flow with a valid directory structure set, using a single element",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+					tags:         parseTagsFromStr(""),
+				}
+
+				pvcName := "foo"
+				directoryCreated := fmt.Sprintf("/%s", pvcName)
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+						SubPathPattern:   "${.PVC.name}",
+						PvcName:          pvcName,
+					},
+				}
+
+				ctx := context.Background()
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+				}
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
+					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
+						if !verifyPathWhenUUIDIncluded(accessPointOpts.DirectoryPath, directoryCreated) {
+							t.Fatalf("Root directory mismatch. Expected: %v (with UID appended), actual: %v",
+								directoryCreated,
+								accessPointOpts.DirectoryPath)
+						}
+					})
+
+				res, err := driver.CreateVolume(ctx, req)
+
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+
+				if res.Volume == nil {
+					t.Fatal("Volume is nil")
+				}
+
+				if res.Volume.VolumeId != volumeId {
+					t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", volumeId, res.Volume.VolumeId)
+				}
+
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: Normal flow with a valid directory structure set, and a basePath",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+					tags:         parseTagsFromStr(""),
+				}
+
+				pvcName := "foo"
+				basePath := "bash"
+				directoryCreated := fmt.Sprintf("/%s/%s", basePath, pvcName)
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode:      "efs-ap",
+						FsId:                  fsId,
+						GidMin:                "1000",
+						GidMax:                "2000",
+						DirectoryPerms:        "777",
+						SubPathPattern:        "${.PVC.name}",
+						BasePath:              basePath,
+						EnsureUniqueDirectory: "true",
+						PvcName:               pvcName,
+					},
+				}
+
+				ctx := context.Background()
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+				}
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
+					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
+						if !verifyPathWhenUUIDIncluded(accessPointOpts.DirectoryPath, directoryCreated) {
+							t.Fatalf("Root directory mismatch. Expected: %v (with UID appended), actual: %v",
+								directoryCreated,
+								accessPointOpts.DirectoryPath)
+						}
+					})
+
+				res, err := driver.CreateVolume(ctx, req)
 
 				if err != nil {
 					t.Fatalf("CreateVolume failed: %v", err)
@@ -1081,7 +1434,7 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
@@ -1151,7 +1504,7 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
@@ -1216,7 +1569,7 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
@@ -1282,7 +1635,7 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
@@ -1350,7 +1703,7 @@ func TestCreateVolume(t *testing.T) {
 					AccessPointId: apId,
 					FileSystemId:  fsId,
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
 
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(accessPoint, nil).
 					Do(func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) {
@@ -1378,6 +1731,82 @@ func TestCreateVolume(t *testing.T) {
 				mockCtl.Finish()
 			},
 		},
+		{
+			name: "Fail: directoryPerms violates the directory permissions policy",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:             endpoint,
+					cloud:                mockCloud,
+					gidAllocator:         NewGidAllocator(),
+					directoryPermsPolicy: &DirectoryPermsPolicy{Min: 0700, Max: 0775},
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected InvalidArgument error, got %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: unknown parameter with strict parameters",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:         endpoint,
+					cloud:            mockCloud,
+					gidAllocator:     NewGidAllocator(),
+					strictParameters: true,
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						"directroyPerms": "700",
+						PvcName:          "data",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected InvalidArgument error, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "directroyPerms") || !strings.Contains(err.Error(), DirectoryPerms) {
+					t.Fatalf("Expected the unknown and accepted parameters in the error, got %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
 		{
 			name: "Fail: Volume name missing",
 			testFunc: func(t *testing.T) {
@@ -1620,7 +2049,7 @@ func TestCreateVolume(t *testing.T) {
 						stdVolCap,
 					},
 					Parameters: map[string]string{
-						ProvisioningMode: "efs-fs",
+						ProvisioningMode: "efs-unknown",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
 					},
@@ -1738,43 +2167,66 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: Uid invalid",
+			name: "Success: FsId is the ARN of a file system in the region of the driver",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
 
 				driver := &Driver{
 					endpoint:     endpoint,
 					cloud:        mockCloud,
 					gidAllocator: NewGidAllocator(),
+					tags:         parseTagsFromStr(""),
 				}
 
+				fsArn := "arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/" + fsId
 				req := &csi.CreateVolumeRequest{
 					Name: volumeName,
-					CapacityRange: &csi.CapacityRange{
-						RequiredBytes: capacityRange,
-					},
 					VolumeCapabilities: []*csi.VolumeCapability{
 						stdVolCap,
 					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
 					Parameters: map[string]string{
 						ProvisioningMode: "efs-ap",
-						FsId:             fsId,
+						FsId:             fsArn,
 						DirectoryPerms:   "777",
-						Uid:              "invalid",
 					},
 				}
 
 				ctx := context.Background()
-				_, err := driver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatal("CreateVolume did not fail")
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+				}
+				mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+				mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Eq(fsId), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, opts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+						if opts.FileSystemId != fsId {
+							t.Fatalf("Expected access point in file system %v, got %v", fsId, opts.FileSystemId)
+						}
+						return accessPoint, nil
+					})
+
+				res, err := driver.CreateVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+				if res.Volume.VolumeId != volumeId {
+					t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", volumeId, res.Volume.VolumeId)
+				}
+				if res.Volume.VolumeContext[FileSystemArn] != fsArn {
+					t.Fatalf("Expected volume context %v to be %v, got %v", FileSystemArn, fsArn, res.Volume.VolumeContext[FileSystemArn])
 				}
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail: Uid cannot be negative",
+			name: "Fail: FsId is an invalid ARN",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -1795,22 +2247,21 @@ func TestCreateVolume(t *testing.T) {
 					},
 					Parameters: map[string]string{
 						ProvisioningMode: "efs-ap",
-						FsId:             fsId,
+						FsId:             "arn:aws:elasticfilesystem:us-east-1:111122223333:access-point/" + apId,
 						DirectoryPerms:   "777",
-						Uid:              "-5",
 					},
 				}
 
 				ctx := context.Background()
 				_, err := driver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatal("CreateVolume did not fail")
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected InvalidArgument, got %v", err)
 				}
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail: Gid invalid",
+			name: "Fail: Uid invalid",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -1833,7 +2284,7 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						Gid:              "invalid",
+						Uid:              "invalid",
 					},
 				}
 
@@ -1846,7 +2297,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: Gid cannot be negative",
+			name: "Fail: Uid cannot be negative",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -1869,7 +2320,7 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						Gid:              "-5",
+						Uid:              "-5",
 					},
 				}
 
@@ -1882,7 +2333,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: Gid min cannot be 0",
+			name: "Fail: Gid invalid",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -1905,7 +2356,7 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						GidMin:           "0",
+						Gid:              "invalid",
 					},
 				}
 
@@ -1918,7 +2369,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: GidMin must be an integer",
+			name: "Fail: Gid cannot be negative",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -1941,7 +2392,7 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						GidMin:           "test",
+						Gid:              "-5",
 					},
 				}
 
@@ -1954,7 +2405,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: GidMax must be an integer",
+			name: "Fail: Gid min cannot be 0",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -1977,8 +2428,7 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						GidMin:           "2000",
-						GidMax:           "test",
+						GidMin:           "0",
 					},
 				}
 
@@ -1991,7 +2441,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: GidMax must be greater than GidMin",
+			name: "Fail: GidMin must be an integer",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2014,8 +2464,7 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						GidMin:           "2000",
-						GidMax:           "1000",
+						GidMin:           "test",
 					},
 				}
 
@@ -2028,7 +2477,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: GidMax must be provided with GidMin",
+			name: "Fail: GidMax must be an integer",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2052,6 +2501,7 @@ func TestCreateVolume(t *testing.T) {
 						FsId:             fsId,
 						DirectoryPerms:   "777",
 						GidMin:           "2000",
+						GidMax:           "test",
 					},
 				}
 
@@ -2064,7 +2514,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: GidMin must be provided with GidMax",
+			name: "Fail: GidMax must be greater than GidMin",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2087,7 +2537,8 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						DirectoryPerms:   "777",
-						GidMax:           "2000",
+						GidMin:           "2000",
+						GidMax:           "1000",
 					},
 				}
 
@@ -2100,7 +2551,79 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: File system does not exist with fixed uid/gid",
+			name: "Fail: GidMax must be provided with GidMin",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						GidMin:           "2000",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: GidMin must be provided with GidMax",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						GidMax:           "2000",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: File system does not exist with fixed uid/gid",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2169,7 +2692,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				ctx := context.Background()
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, cloud.ErrNotFound)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, cloud.ErrNotFound))
 				_, err := driver.CreateVolume(ctx, req)
 				if err == nil {
 					t.Fatal("CreateVolume did not fail")
@@ -2247,7 +2770,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				ctx := context.Background()
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, cloud.ErrAccessDenied)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, cloud.ErrAccessDenied))
 				_, err := driver.CreateVolume(ctx, req)
 				if err == nil {
 					t.Fatal("CreateVolume did not fail")
@@ -2325,7 +2848,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				ctx := context.Background()
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, errors.New("ListAccessPoints failed"))
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, errors.New("ListAccessPoints failed")))
 				_, err := driver.CreateVolume(ctx, req)
 				if err == nil {
 					t.Fatal("CreateVolume did not fail")
@@ -2363,7 +2886,7 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				ctx := context.Background()
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return([]*cloud.AccessPoint{}, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
 				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil, errors.New("CreateAccessPoint call failed"))
 				_, err := driver.CreateVolume(ctx, req)
 				if err == nil {
@@ -2373,7 +2896,7 @@ func TestCreateVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: CreateAccessPoint Access Denied",
+			name: "Fail: Create Access Point call is throttled",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2402,17 +2925,15 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				ctx := context.Background()
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return([]*cloud.AccessPoint{}, nil)
-				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil, cloud.ErrAccessDenied)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("%w: Failed to create access point: %v", cloud.ErrThrottled, errors.New("ThrottlingException")))
 				_, err := driver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatal("CreateVolume did not fail")
-				}
+				verifyRetryDelay(t, err, throttledRetryDelay)
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail: Run out of GIDs",
+			name: "Fail: File system has the maximum number of access points",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2435,58 +2956,125 @@ func TestCreateVolume(t *testing.T) {
 						ProvisioningMode: "efs-ap",
 						FsId:             fsId,
 						GidMin:           "1000",
-						GidMax:           "1001",
+						GidMax:           "2000",
 						DirectoryPerms:   "777",
 					},
 				}
 
 				ctx := context.Background()
-				ap1 := &cloud.AccessPoint{
-					AccessPointId: apId,
-					FileSystemId:  fsId,
-					PosixUser: &cloud.PosixUser{
-						Gid: 1000,
-						Uid: 1000,
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil, cloud.ErrAccessPointLimitExceeded)
+				_, err := driver.CreateVolume(ctx, req)
+				verifyRetryDelay(t, err, exhaustedRetryDelay)
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: requireExistingBasePath is set and basePath is the root directory",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					mounter:      mockMounter,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+						BasePath:         "/",
+						RequireBasePath:  "true",
 					},
 				}
-				ap2 := &cloud.AccessPoint{
+
+				ctx := context.Background()
+				accessPoint := &cloud.AccessPoint{
 					AccessPointId: apId,
 					FileSystemId:  fsId,
-					PosixUser: &cloud.PosixUser{
-						Gid: 1001,
-						Uid: 1001,
-					},
 				}
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return([]*cloud.AccessPoint{ap1, ap2}, nil).AnyTimes()
-				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(ap2, nil).AnyTimes()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).Return(accessPoint, nil)
+				_, err := driver.CreateVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: requireExistingBasePath is set and basePath does not exist",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
-				var err error
-				// All GIDs from available range are taken, CreateVolume should fail.
-				_, err = driver.CreateVolume(ctx, req)
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					mounter:      mockMounter,
+					gidAllocator: NewGidAllocator(),
+				}
 
-				if err == nil {
-					t.Fatalf("CreateVolume did not fail")
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+						BasePath:         "missing",
+						RequireBasePath:  "true",
+					},
+				}
+
+				ctx := context.Background()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Any(), gomock.Eq("efs"), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Any()).Return(nil)
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.FailedPrecondition {
+					t.Fatalf("Expected error code %v, got %v", codes.FailedPrecondition, err)
 				}
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail: Cannot assume role for x-account",
+			name: "Fail: requireExistingBasePath is set and file system cannot be mounted",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
 				driver := &Driver{
 					endpoint:     endpoint,
 					cloud:        mockCloud,
+					mounter:      mockMounter,
 					gidAllocator: NewGidAllocator(),
-					tags:         parseTagsFromStr(""),
 				}
 
-				secrets := map[string]string{}
-				secrets["awsRoleArn"] = "arn:aws:iam::1234567890:role/EFSCrossAccountRole"
-				secrets["crossaccount"] = "true"
-
 				req := &csi.CreateVolumeRequest{
 					Name: volumeName,
 					VolumeCapabilities: []*csi.VolumeCapability{
@@ -2501,191 +3089,1375 @@ func TestCreateVolume(t *testing.T) {
 						GidMin:           "1000",
 						GidMax:           "2000",
 						DirectoryPerms:   "777",
-						AzName:           "us-east-1a",
+						BasePath:         "test",
+						RequireBasePath:  "true",
 					},
-					Secrets: secrets,
 				}
 
 				ctx := context.Background()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Any(), gomock.Eq("efs"), gomock.Any()).Return(errors.New("mount failed"))
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.Internal {
+					t.Fatalf("Expected error code %v, got %v", codes.Internal, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: requireExistingBasePath is invalid",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					mounter:      mockMounter,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+						BasePath:         "test",
+						RequireBasePath:  "maybe",
+					},
+				}
 
+				ctx := context.Background()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
 				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected error code %v, got %v", codes.InvalidArgument, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: skipCreationInfo is set and the root directory does not exist",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
-				if err == nil {
-					t.Fatalf("CreateVolume did not fail")
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					mounter:      mockMounter,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						Uid:              "1000",
+						Gid:              "1000",
+						DirectoryPerms:   "777",
+						BasePath:         "teams",
+						SkipCreationInfo: "true",
+					},
+				}
+
+				ctx := context.Background()
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+				mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Any(), gomock.Eq("efs"), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Any()).Return(nil)
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.FailedPrecondition {
+					t.Fatalf("Expected error code %v, got %v", codes.FailedPrecondition, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: skipCreationInfo is invalid",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						SkipCreationInfo: "maybe",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected error code %v, got %v", codes.InvalidArgument, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: skipCreationInfo is set with shared access points",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: SharedAccessPointMode,
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						PvcNamespace:     "team-a",
+						SkipCreationInfo: "true",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected error code %v, got %v", codes.InvalidArgument, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: enforceUserIdentity is false",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:                endpoint,
+					cloud:                   mockCloud,
+					gidAllocator:            NewGidAllocator(),
+					allowUnenforcedIdentity: true,
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode:    "efs-ap",
+						FsId:                fsId,
+						Uid:                 "1000",
+						Gid:                 "1000",
+						DirectoryPerms:      "775",
+						EnforceUserIdentity: "false",
+					},
+				}
+
+				ctx := context.Background()
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+				}
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, opts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+						if !opts.SkipPosixUser || opts.Uid != 1000 || opts.Gid != 1000 {
+							t.Fatalf("Expected access point without posix user and root directory owned by 1000:1000, got %+v", opts)
+						}
+						return accessPoint, nil
+					})
+				mockCloud.EXPECT().TagResource(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+				if _, err := driver.CreateVolume(ctx, req); err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: enforceUserIdentity is false without the owner of the root directory",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:                endpoint,
+					cloud:                   mockCloud,
+					gidAllocator:            NewGidAllocator(),
+					allowUnenforcedIdentity: true,
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode:    "efs-ap",
+						FsId:                fsId,
+						DirectoryPerms:      "775",
+						EnforceUserIdentity: "false",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected error code %v, got %v", codes.InvalidArgument, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: enforceUserIdentity is false without the driver allowing it",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode:    "efs-ap",
+						FsId:                fsId,
+						Uid:                 "1000",
+						Gid:                 "1000",
+						DirectoryPerms:      "775",
+						EnforceUserIdentity: "false",
+					},
+				}
+
+				ctx := context.Background()
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.PermissionDenied {
+					t.Fatalf("Expected error code %v, got %v", codes.PermissionDenied, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: Create Access Point call times out",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+					},
+				}
+
+				ctx := context.Background()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil, cloud.ErrDeadlineExceeded)
+				_, err := driver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.DeadlineExceeded {
+					t.Fatalf("Expected error code %v, got %v", codes.DeadlineExceeded, err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: CreateAccessPoint Access Denied",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+					},
+				}
+
+				ctx := context.Background()
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{}, nil))
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil, cloud.ErrAccessDenied)
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: Run out of GIDs",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "1001",
+						DirectoryPerms:   "777",
+					},
+				}
+
+				ctx := context.Background()
+				ap1 := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+					PosixUser: &cloud.PosixUser{
+						Gid: 1000,
+						Uid: 1000,
+					},
+				}
+				ap2 := &cloud.AccessPoint{
+					AccessPointId: apId,
+					FileSystemId:  fsId,
+					PosixUser: &cloud.PosixUser{
+						Gid: 1001,
+						Uid: 1001,
+					},
+				}
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{ap1, ap2}, nil)).AnyTimes()
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(ap2, nil).AnyTimes()
+
+				var err error
+				// All GIDs from available range are taken, CreateVolume should fail.
+				_, err = driver.CreateVolume(ctx, req)
+
+				if err == nil {
+					t.Fatalf("CreateVolume did not fail")
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: Cannot assume role for x-account",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+					tags:         parseTagsFromStr(""),
+				}
+
+				secrets := map[string]string{}
+				secrets["awsRoleArn"] = "arn:aws:iam::1234567890:role/EFSCrossAccountRole"
+				secrets["crossaccount"] = "true"
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						GidMin:           "1000",
+						GidMax:           "2000",
+						DirectoryPerms:   "777",
+						AzName:           "us-east-1a",
+					},
+					Secrets: secrets,
+				}
+
+				ctx := context.Background()
+
+				_, err := driver.CreateVolume(ctx, req)
+
+				if err == nil {
+					t.Fatalf("CreateVolume did not fail")
+				}
+
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: subPathPattern is specified but uses unsupported attributes",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				subPathPattern := "${.PVC.name}/${foo}"
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						SubPathPattern:   subPathPattern,
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Did not throw InvalidArgument error, instead threw %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail: resulting accessPointDirectory is too over 100 characters",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				subPathPattern := "this-directory-name-is-far-too-long-for-any-practical-purposes-and-only-serves-to-prove-a-point"
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						SubPathPattern:   subPathPattern,
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Did not throw InvalidArgument error, instead threw %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Fail:  resulting accessPointDirectory contains over 4 subdirectories",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				subPathPattern := "a/b/c/d/e/f"
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.CreateVolumeRequest{
+					Name: volumeName,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						stdVolCap,
+					},
+					CapacityRange: &csi.CapacityRange{
+						RequiredBytes: capacityRange,
+					},
+					Parameters: map[string]string{
+						ProvisioningMode: "efs-ap",
+						FsId:             fsId,
+						DirectoryPerms:   "777",
+						SubPathPattern:   subPathPattern,
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(nil, nil))
+
+				_, err := driver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatal("CreateVolume did not fail")
+				}
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Did not throw InvalidArgument error, instead threw %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.testFunc)
+	}
+}
+
+func TestCreateVolumeProvisioningPolicies(t *testing.T) {
+	var (
+		volumeName = "volumeName"
+		fsId       = "fs-abcd1234"
+		apId       = "fsap-abcd1234xyz987"
+		stdVolCap  = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}
+	)
+	policies := newTestProvisioningPolicies(t, newTestProvisioningPolicy("team-a", "team-a", map[string]interface{}{
+		"fileSystemIds": []interface{}{fsId},
+		"uidRange":      map[string]interface{}{"min": int64(2000), "max": int64(2999)},
+		"gidRange":      map[string]interface{}{"min": int64(2000), "max": int64(2999)},
+	}))
+
+	testCases := []struct {
+		name          string
+		params        map[string]string
+		expectCreate  bool
+		expectErrCode codes.Code
+	}{
+		{
+			name:         "Success: allowed by the policy of the namespace",
+			params:       map[string]string{Uid: "2000", Gid: "2001", PvcNamespace: "team-a"},
+			expectCreate: true,
+		},
+		{
+			name:         "Success: namespace without policy",
+			params:       map[string]string{Uid: "1000", Gid: "1001", PvcNamespace: "team-b"},
+			expectCreate: true,
+		},
+		{
+			name:          "Fail: uid out of the policy range",
+			params:        map[string]string{Uid: "1000", Gid: "2001", PvcNamespace: "team-a"},
+			expectErrCode: codes.PermissionDenied,
+		},
+		{
+			name:          "Fail: namespace of the claim unknown",
+			params:        map[string]string{Uid: "2000", Gid: "2001"},
+			expectErrCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+
+			driver := &Driver{
+				endpoint:             "endpoint",
+				cloud:                mockCloud,
+				gidAllocator:         NewGidAllocator(),
+				provisioningPolicies: policies,
+			}
+
+			params := map[string]string{
+				ProvisioningMode: "efs-ap",
+				FsId:             fsId,
+				DirectoryPerms:   "777",
+			}
+			for k, v := range tc.params {
+				params[k] = v
+			}
+			req := &csi.CreateVolumeRequest{
+				Name:               volumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{stdVolCap},
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 5368709120},
+				Parameters:         params,
+			}
+
+			ctx := context.Background()
+			mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+			if tc.expectCreate {
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).Return(&cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId}, nil)
+			}
+
+			_, err := driver.CreateVolume(ctx, req)
+			if tc.expectCreate {
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+				return
+			}
+			if status.Code(err) != tc.expectErrCode {
+				t.Fatalf("Expected error code %v, got %v", tc.expectErrCode, err)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeAPIConfig(t *testing.T) {
+	var (
+		volumeName = "volumeName"
+		fsId       = "fs-abcd1234"
+		apId       = "fsap-abcd1234xyz987"
+		roleArn    = "arn:aws:iam::111122223333:role/EFSRole"
+		stdVolCap  = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}
+	)
+
+	testCases := []struct {
+		name             string
+		params           map[string]string
+		expectAPIConfig  *cloud.APIConfig
+		expectDefaultAPI bool
+		expectErrCode    codes.Code
+	}{
+		{
+			name:            "Success: API of the storage class",
+			params:          map[string]string{APIRegion: "cn-north-1", APIEndpoint: "https://efs.cn-north-1.amazonaws.com.cn", APIRoleArn: roleArn},
+			expectAPIConfig: &cloud.APIConfig{Region: "cn-north-1", Endpoint: "https://efs.cn-north-1.amazonaws.com.cn", RoleArn: roleArn},
+		},
+		{
+			name:            "Success: region of the file system ARN",
+			params:          map[string]string{FsId: "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/" + fsId, APIRoleArn: roleArn},
+			expectAPIConfig: &cloud.APIConfig{Region: "us-west-2", RoleArn: roleArn},
+		},
+		{
+			name:             "Success: region of the driver",
+			params:           map[string]string{APIRegion: "us-east-1"},
+			expectDefaultAPI: true,
+		},
+		{
+			name:          "Fail: invalid endpoint",
+			params:        map[string]string{APIEndpoint: "efs.us-east-1.amazonaws.com"},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: invalid role",
+			params:        map[string]string{APIRoleArn: "EFSRole"},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: region does not match the file system ARN",
+			params:        map[string]string{FsId: "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/" + fsId, APIRegion: "eu-west-1"},
+			expectErrCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
+			apiCloud := mocks.NewMockCloud(mockCtl)
+
+			clients := newAPIClients()
+			clients.newCloud = func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+				if tc.expectAPIConfig == nil || apiConfig != *tc.expectAPIConfig {
+					t.Fatalf("Unexpected API config %+v", apiConfig)
+				}
+				return apiCloud, nil
+			}
+			driver := &Driver{
+				endpoint:     "endpoint",
+				cloud:        mockCloud,
+				gidAllocator: NewGidAllocator(),
+				apiClients:   clients,
+			}
+
+			params := map[string]string{
+				ProvisioningMode: "efs-ap",
+				FsId:             fsId,
+				DirectoryPerms:   "777",
+				Uid:              "1000",
+				Gid:              "1000",
+			}
+			for k, v := range tc.params {
+				params[k] = v
+			}
+			req := &csi.CreateVolumeRequest{
+				Name:               volumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{stdVolCap},
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 5368709120},
+				Parameters:         params,
+			}
+
+			ctx := context.Background()
+			mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+			mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+			expectedCloud := mockCloud
+			if tc.expectAPIConfig != nil {
+				expectedCloud = apiCloud
+			}
+			if tc.expectAPIConfig != nil || tc.expectDefaultAPI {
+				expectedCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Eq(fsId)).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+				expectedCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).Return(&cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId}, nil)
+			}
+			if tc.expectAPIConfig != nil && tc.expectAPIConfig.RoleArn != "" {
+				// The mount target of the file system of the other account is looked up with its role
+				apiCloud.EXPECT().DescribeMountTargets(gomock.Eq(ctx), gomock.Eq(fsId), gomock.Eq("")).Return(&cloud.MountTarget{IPAddress: "10.0.0.1"}, nil)
+			}
+
+			_, err := driver.CreateVolume(ctx, req)
+			if tc.expectErrCode == codes.OK {
+				if err != nil {
+					t.Fatalf("CreateVolume failed: %v", err)
+				}
+				return
+			}
+			if status.Code(err) != tc.expectErrCode {
+				t.Fatalf("Expected error code %v, got %v", tc.expectErrCode, err)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeSharedAccessPoint(t *testing.T) {
+	var (
+		volumeName = "pvc-1234"
+		fsId       = "fs-abcd1234"
+		apId       = "fsap-abcd1234xyz987"
+		target     = TempMountPathPrefix + "/" + apId
+		stdVolCap  = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}
+	)
+
+	testCases := []struct {
+		name          string
+		params        map[string]string
+		existingAP    *cloud.AccessPoint
+		policies      *provisioningPolicies
+		expectCreate  bool
+		expectErrCode codes.Code
+	}{
+		{
+			name:         "Success: first volume of the namespace creates the access point",
+			params:       map[string]string{PvcNamespace: "team-a"},
+			expectCreate: true,
+		},
+		{
+			name:       "Success: access point of the namespace is reused",
+			params:     map[string]string{PvcNamespace: "team-a"},
+			existingAP: &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/shared/team-a", SharedNamespace: "team-a"},
+		},
+		{
+			name:   "Success: posix user of the access point of the namespace checked by the policy without allocation",
+			params: map[string]string{PvcNamespace: "team-a", Uid: "", Gid: "", GidMin: "3000", GidMax: "3999"},
+			existingAP: &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/shared/team-a", SharedNamespace: "team-a",
+				PosixUser: &cloud.PosixUser{Uid: 2000, Gid: 2000}},
+			policies: newTestProvisioningPolicies(t, newTestProvisioningPolicy("team-a", "team-a", map[string]interface{}{
+				"uidRange": map[string]interface{}{"min": int64(2000), "max": int64(2999)},
+				"gidRange": map[string]interface{}{"min": int64(2000), "max": int64(2999)},
+			})),
+		},
+		{
+			name:          "Fail: namespace of the claim unknown",
+			params:        map[string]string{},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: reuseAccessPoint",
+			params:        map[string]string{PvcNamespace: "team-a", ReuseAccessPointKey: "true"},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: maximum number of directories not supported by efs-ap",
+			params:        map[string]string{ProvisioningMode: AccessPointMode, MaxDirectoriesPerBasePath: "10"},
+			expectErrCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			mockMounter := mocks.NewMockMounter(mockCtl)
+
+			driver := &Driver{
+				endpoint:     "endpoint",
+				cloud:        mockCloud,
+				mounter:      mockMounter,
+				gidAllocator: NewGidAllocator(),
+			}
+			if tc.policies != nil {
+				driver.provisioningPolicies = tc.policies
+			}
+
+			params := map[string]string{
+				ProvisioningMode: SharedAccessPointMode,
+				FsId:             fsId,
+				DirectoryPerms:   "700",
+				BasePath:         "/shared",
+				Uid:              "1000",
+				Gid:              "1000",
+			}
+			for k, v := range tc.params {
+				params[k] = v
+				if v == "" {
+					delete(params, k)
+				}
+			}
+			req := &csi.CreateVolumeRequest{
+				Name:               volumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{stdVolCap},
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 5368709120},
+				Parameters:         params,
+			}
+
+			ctx := context.Background()
+			if tc.expectErrCode == codes.OK {
+				clientToken := sharedAccessPointClientToken(fsId, "/shared/team-a")
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Eq(fsId)).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(tc.existingAP, nil)
+				if tc.expectCreate {
+					// findOrCreateSharedAccessPoint looks for the access point again before creating it
+					mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(nil, nil)
+					mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).DoAndReturn(
+						func(_ context.Context, _ string, opts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+							if opts.DirectoryPath != "/shared/team-a" {
+								t.Fatalf("Expected the root directory of the namespace, got %v", opts.DirectoryPath)
+							}
+							if opts.Tags[cloud.SharedAccessPointTagKey] != "team-a" {
+								t.Fatalf("Expected the access point to be tagged as shared by the namespace, got %v", opts.Tags)
+							}
+							return &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId}, nil
+						})
+				}
+				mockMounter.EXPECT().MakeDir(gomock.Eq(target)).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(target), gomock.Eq("efs"), gomock.Eq([]string{"tls", "iam", "accesspoint=" + apId})).Return(nil)
+				mockMounter.EXPECT().MakeDir(gomock.Eq(target + "/" + volumeName)).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Eq(target)).Return(nil)
+			}
+
+			res, err := driver.CreateVolume(ctx, req)
+			if tc.expectErrCode != codes.OK {
+				if status.Code(err) != tc.expectErrCode {
+					t.Fatalf("Expected error code %v, got %v", tc.expectErrCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateVolume failed: %v", err)
+			}
+			expectedVolumeId := fsId + ":/" + volumeName + ":" + apId
+			if res.Volume.VolumeId != expectedVolumeId {
+				t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", expectedVolumeId, res.Volume.VolumeId)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeExistingAccessPoint(t *testing.T) {
+	var (
+		volumeName = "pvc-1234"
+		fsId       = "fs-abcd1234"
+		apId       = "fsap-abcd1234xyz987"
+		target     = TempMountPathPrefix + "/" + apId
+		stdVolCap  = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}
+	)
+
+	testCases := []struct {
+		name             string
+		params           map[string]string
+		accessPoint      *cloud.AccessPoint
+		describeErr      error
+		tagErr           error
+		expectedVolumeId string
+		expectErrCode    codes.Code
+	}{
+		{
+			name:             "Success: directory of the volume created in the access point",
+			params:           map[string]string{},
+			accessPoint:      &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/team-a"},
+			expectedVolumeId: fsId + ":/" + volumeName + ":" + apId,
+		},
+		{
+			name:             "Success: access point already tagged",
+			params:           map[string]string{},
+			accessPoint:      &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/team-a", Tags: map[string]string{cloud.DirectoryVolumesTagKey: "true"}},
+			expectedVolumeId: fsId + ":/" + volumeName + ":" + apId,
+		},
+		{
+			name:             "Success: access point not allowed to be tagged",
+			params:           map[string]string{},
+			accessPoint:      &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/team-a"},
+			tagErr:           cloud.ErrAccessDenied,
+			expectedVolumeId: fsId + ":/" + volumeName + ":" + apId,
+		},
+		{
+			name:             "Success: directory of the volume created in the base path of the access point",
+			params:           map[string]string{BasePath: "dynamic"},
+			accessPoint:      &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/team-a"},
+			expectedVolumeId: fsId + ":/dynamic/" + volumeName + ":" + apId,
+		},
+		{
+			name:          "Fail: access point not found",
+			params:        map[string]string{},
+			describeErr:   cloud.ErrNotFound,
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: access point of another file system",
+			params:        map[string]string{},
+			accessPoint:   &cloud.AccessPoint{AccessPointId: apId, FileSystemId: "fs-efgh5678"},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: posix user parameters",
+			params:        map[string]string{Uid: "1000", Gid: "1000"},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: shared access point mode",
+			params:        map[string]string{ProvisioningMode: SharedAccessPointMode, PvcNamespace: "team-a"},
+			expectErrCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: invalid maximum number of directories",
+			params:        map[string]string{MaxDirectoriesPerBasePath: "0"},
+			expectErrCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			mockMounter := mocks.NewMockMounter(mockCtl)
+
+			driver := &Driver{
+				endpoint:     "endpoint",
+				cloud:        mockCloud,
+				mounter:      mockMounter,
+				gidAllocator: NewGidAllocator(),
+			}
+
+			params := map[string]string{
+				ProvisioningMode: AccessPointMode,
+				FsId:             fsId,
+				AccessPointId:    apId,
+			}
+			for k, v := range tc.params {
+				params[k] = v
+			}
+			req := &csi.CreateVolumeRequest{
+				Name:               volumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{stdVolCap},
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 5368709120},
+				Parameters:         params,
+			}
+
+			ctx := context.Background()
+			if tc.accessPoint != nil || tc.describeErr != nil {
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(tc.accessPoint, tc.describeErr)
+			}
+			if tc.expectErrCode == codes.OK {
+				_, dir, _, _ := parseVolumeId(tc.expectedVolumeId)
+				if tc.accessPoint.Tags[cloud.DirectoryVolumesTagKey] != "true" {
+					mockCloud.EXPECT().TagResource(gomock.Eq(ctx), gomock.Eq(apId), gomock.Eq(map[string]string{cloud.DirectoryVolumesTagKey: "true"})).Return(tc.tagErr)
+				}
+				mockMounter.EXPECT().MakeDir(gomock.Eq(target)).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(target), gomock.Eq("efs"), gomock.Eq([]string{"tls", "iam", "accesspoint=" + apId})).Return(nil)
+				mockMounter.EXPECT().MakeDir(gomock.Eq(target + dir)).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Eq(target)).Return(nil)
+			}
+
+			res, err := driver.CreateVolume(ctx, req)
+			if tc.expectErrCode != codes.OK {
+				if status.Code(err) != tc.expectErrCode {
+					t.Fatalf("Expected error code %v, got %v", tc.expectErrCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateVolume failed: %v", err)
+			}
+			if res.Volume.VolumeId != tc.expectedVolumeId {
+				t.Fatalf("Volume Id mismatched. Expected: %v, Actual: %v", tc.expectedVolumeId, res.Volume.VolumeId)
+			}
+		})
+	}
+}
+
+func TestDeleteVolume(t *testing.T) {
+	var (
+		apId     = "fsap-abcd1234xyz987"
+		fsId     = "fs-abcd1234"
+		endpoint = "endpoint"
+		volumeId = "fs-abcd1234::fsap-abcd1234xyz987"
+	)
+
+	testCases := []struct {
+		name     string
+		testFunc func(t *testing.T)
+	}{
+		{
+			name: "Success: Normal flow",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+
+				driver := &Driver{
+					endpoint:     endpoint,
+					cloud:        mockCloud,
+					gidAllocator: NewGidAllocator(),
+				}
+
+				req := &csi.DeleteVolumeRequest{
+					VolumeId: volumeId,
+				}
+
+				ctx := context.Background()
+				mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				_, err := driver.DeleteVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("Delete Volume failed: %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: Normal flow with deleteAccessPointRootDir",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
+
+				driver := &Driver{
+					endpoint:                 endpoint,
+					cloud:                    mockCloud,
+					mounter:                  mockMounter,
+					gidAllocator:             NewGidAllocator(),
+					deleteAccessPointRootDir: true,
+				}
+
+				req := &csi.DeleteVolumeRequest{
+					VolumeId: volumeId,
+				}
+
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId:      apId,
+					FileSystemId:       fsId,
+					AccessPointRootDir: "",
+					CapacityGiB:        0,
+				}
+
+				ctx := context.Background()
+				mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Any()).Return(nil)
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
+				mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				_, err := driver.DeleteVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("Delete Volume failed: %v", err)
+				}
+				mockCtl.Finish()
+			},
+		},
+		{
+			name: "Success: Existing root directory is kept with deleteAccessPointRootDir",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
+
+				driver := &Driver{
+					endpoint:                 endpoint,
+					cloud:                    mockCloud,
+					mounter:                  mockMounter,
+					gidAllocator:             NewGidAllocator(),
+					deleteAccessPointRootDir: true,
+				}
+
+				req := &csi.DeleteVolumeRequest{
+					VolumeId: volumeId,
+				}
+
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId:      apId,
+					FileSystemId:       fsId,
+					AccessPointRootDir: "/teams/team-a",
+					ExistingRootDir:    true,
+				}
+
+				ctx := context.Background()
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
+				mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				_, err := driver.DeleteVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("Delete Volume failed: %v", err)
 				}
-
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail: subPathPattern is specified but uses unsupported attributes",
+			name: "Success: Access point of a volume with sub path is kept",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
 
-				subPathPattern := "${.PVC.name}/${foo}"
-
 				driver := &Driver{
 					endpoint:     endpoint,
 					cloud:        mockCloud,
 					gidAllocator: NewGidAllocator(),
 				}
 
-				req := &csi.CreateVolumeRequest{
-					Name: volumeName,
-					VolumeCapabilities: []*csi.VolumeCapability{
-						stdVolCap,
-					},
-					CapacityRange: &csi.CapacityRange{
-						RequiredBytes: capacityRange,
-					},
-					Parameters: map[string]string{
-						ProvisioningMode: "efs-ap",
-						FsId:             fsId,
-						DirectoryPerms:   "777",
-						SubPathPattern:   subPathPattern,
-					},
+				req := &csi.DeleteVolumeRequest{
+					VolumeId: fsId + ":/pvc-1234:" + apId,
 				}
 
-				ctx := context.Background()
-
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
-
-				_, err := driver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatal("CreateVolume did not fail")
-				}
-				if status.Code(err) != codes.InvalidArgument {
-					t.Fatalf("Did not throw InvalidArgument error, instead threw %v", err)
+				// The access point of a volume with a sub path is neither described nor deleted, whoever created it
+				_, err := driver.DeleteVolume(context.Background(), req)
+				if err != nil {
+					t.Fatalf("Delete Volume failed: %v", err)
 				}
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail: resulting accessPointDirectory is too over 100 characters",
+			name: "Success: Directory of shared access point is deleted with deleteAccessPointRootDir",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
-
-				subPathPattern := "this-directory-name-is-far-too-long-for-any-practical-purposes-and-only-serves-to-prove-a-point"
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
 				driver := &Driver{
-					endpoint:     endpoint,
-					cloud:        mockCloud,
-					gidAllocator: NewGidAllocator(),
+					endpoint:                 endpoint,
+					cloud:                    mockCloud,
+					mounter:                  mockMounter,
+					gidAllocator:             NewGidAllocator(),
+					deleteAccessPointRootDir: true,
 				}
 
-				req := &csi.CreateVolumeRequest{
-					Name: volumeName,
-					VolumeCapabilities: []*csi.VolumeCapability{
-						stdVolCap,
-					},
-					CapacityRange: &csi.CapacityRange{
-						RequiredBytes: capacityRange,
-					},
-					Parameters: map[string]string{
-						ProvisioningMode: "efs-ap",
-						FsId:             fsId,
-						DirectoryPerms:   "777",
-						SubPathPattern:   subPathPattern,
-					},
+				req := &csi.DeleteVolumeRequest{
+					VolumeId: fsId + ":/pvc-1234:" + apId,
 				}
 
-				ctx := context.Background()
-
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
-
-				_, err := driver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatal("CreateVolume did not fail")
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId:      apId,
+					FileSystemId:       fsId,
+					AccessPointRootDir: "/team-a",
+					SharedNamespace:    "team-a",
 				}
-				if status.Code(err) != codes.InvalidArgument {
-					t.Fatalf("Did not throw InvalidArgument error, instead threw %v", err)
+
+				ctx := context.Background()
+				target := TempMountPathPrefix + "/" + apId
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
+				mockMounter.EXPECT().MakeDir(gomock.Eq(target)).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(target), gomock.Eq("efs"), gomock.Eq([]string{"tls", "iam", "accesspoint=" + apId})).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Eq(target)).Return(nil)
+				_, err := driver.DeleteVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("Delete Volume failed: %v", err)
 				}
 				mockCtl.Finish()
 			},
 		},
 		{
-			name: "Fail:  resulting accessPointDirectory contains over 4 subdirectories",
+			name: "Success: Directory of an access point marked by accessPointId is deleted with deleteAccessPointRootDir",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
-
-				subPathPattern := "a/b/c/d/e/f"
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
 				driver := &Driver{
-					endpoint:     endpoint,
-					cloud:        mockCloud,
-					gidAllocator: NewGidAllocator(),
+					endpoint:                 endpoint,
+					cloud:                    mockCloud,
+					mounter:                  mockMounter,
+					gidAllocator:             NewGidAllocator(),
+					deleteAccessPointRootDir: true,
 				}
 
-				req := &csi.CreateVolumeRequest{
-					Name: volumeName,
-					VolumeCapabilities: []*csi.VolumeCapability{
-						stdVolCap,
-					},
-					CapacityRange: &csi.CapacityRange{
-						RequiredBytes: capacityRange,
-					},
-					Parameters: map[string]string{
-						ProvisioningMode: "efs-ap",
-						FsId:             fsId,
-						DirectoryPerms:   "777",
-						SubPathPattern:   subPathPattern,
-					},
+				req := &csi.DeleteVolumeRequest{
+					VolumeId: fsId + ":/dynamic/pvc-1234:" + apId,
 				}
 
-				ctx := context.Background()
-
-				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), gomock.Any()).Return(nil, nil)
-
-				_, err := driver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatal("CreateVolume did not fail")
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId:      apId,
+					FileSystemId:       fsId,
+					AccessPointRootDir: "/team-a",
+					Tags:               map[string]string{cloud.DirectoryVolumesTagKey: "true"},
 				}
-				if status.Code(err) != codes.InvalidArgument {
-					t.Fatalf("Did not throw InvalidArgument error, instead threw %v", err)
+
+				ctx := context.Background()
+				target := TempMountPathPrefix + "/" + apId
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
+				mockMounter.EXPECT().MakeDir(gomock.Eq(target)).Return(nil)
+				mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(target), gomock.Eq("efs"), gomock.Eq([]string{"tls", "iam", "accesspoint=" + apId})).Return(nil)
+				mockMounter.EXPECT().Unmount(gomock.Eq(target)).Return(nil)
+				_, err := driver.DeleteVolume(ctx, req)
+				if err != nil {
+					t.Fatalf("Delete Volume failed: %v", err)
 				}
 				mockCtl.Finish()
 			},
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, tc.testFunc)
-	}
-}
-
-func TestDeleteVolume(t *testing.T) {
-	var (
-		apId     = "fsap-abcd1234xyz987"
-		fsId     = "fs-abcd1234"
-		endpoint = "endpoint"
-		volumeId = "fs-abcd1234::fsap-abcd1234xyz987"
-	)
-
-	testCases := []struct {
-		name     string
-		testFunc func(t *testing.T)
-	}{
 		{
-			name: "Success: Normal flow",
+			name: "Success: Directory of an access point not created by the driver is kept",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
+				mockMounter := mocks.NewMockMounter(mockCtl)
 
 				driver := &Driver{
-					endpoint:     endpoint,
-					cloud:        mockCloud,
-					gidAllocator: NewGidAllocator(),
+					endpoint:                 endpoint,
+					cloud:                    mockCloud,
+					mounter:                  mockMounter,
+					gidAllocator:             NewGidAllocator(),
+					deleteAccessPointRootDir: true,
 				}
 
+				// A static volume of a directory of an access point managed outside of the driver
 				req := &csi.DeleteVolumeRequest{
-					VolumeId: volumeId,
+					VolumeId: fsId + ":/data:" + apId,
+				}
+
+				accessPoint := &cloud.AccessPoint{
+					AccessPointId:      apId,
+					FileSystemId:       fsId,
+					AccessPointRootDir: "/team-a",
 				}
 
 				ctx := context.Background()
-				mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
 				_, err := driver.DeleteVolume(ctx, req)
 				if err != nil {
 					t.Fatalf("Delete Volume failed: %v", err)
@@ -2694,7 +4466,36 @@ func TestDeleteVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Success: Normal flow with deleteAccessPointRootDir",
+			name: "Fail: Directory that is not below the root directory of the access point is refused",
+			testFunc: func(t *testing.T) {
+				for _, subpath := range []string{"/", "/../..", "/data/../.."} {
+					mockCtl := gomock.NewController(t)
+					mockCloud := mocks.NewMockCloud(mockCtl)
+					mockMounter := mocks.NewMockMounter(mockCtl)
+
+					driver := &Driver{
+						endpoint:                 endpoint,
+						cloud:                    mockCloud,
+						mounter:                  mockMounter,
+						gidAllocator:             NewGidAllocator(),
+						deleteAccessPointRootDir: true,
+					}
+
+					req := &csi.DeleteVolumeRequest{
+						VolumeId: fsId + ":" + subpath + ":" + apId,
+					}
+
+					// Neither described nor mounted
+					_, err := driver.DeleteVolume(context.Background(), req)
+					if status.Code(err) != codes.InvalidArgument {
+						t.Fatalf("Expected InvalidArgument for sub path %q, got %v", subpath, err)
+					}
+					mockCtl.Finish()
+				}
+			},
+		},
+		{
+			name: "Success: DescribeAccessPoint Access Point Does not exist",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2712,19 +4513,9 @@ func TestDeleteVolume(t *testing.T) {
 					VolumeId: volumeId,
 				}
 
-				accessPoint := &cloud.AccessPoint{
-					AccessPointId:      apId,
-					FileSystemId:       fsId,
-					AccessPointRootDir: "",
-					CapacityGiB:        0,
-				}
-
 				ctx := context.Background()
-				mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
-				mockMounter.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-				mockMounter.EXPECT().Unmount(gomock.Any()).Return(nil)
-				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
-				mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil, cloud.ErrNotFound)
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Eq(fsId)).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
 				_, err := driver.DeleteVolume(ctx, req)
 				if err != nil {
 					t.Fatalf("Delete Volume failed: %v", err)
@@ -2733,7 +4524,7 @@ func TestDeleteVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Success: DescribeAccessPoint Access Point Does not exist",
+			name: "Fail: DescribeAccessPoint Access Point and File System do not exist",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -2751,11 +4542,13 @@ func TestDeleteVolume(t *testing.T) {
 					VolumeId: volumeId,
 				}
 
+				// The volume is in another region or account than the controller, and the secrets are missing
 				ctx := context.Background()
 				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil, cloud.ErrNotFound)
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Eq(fsId)).Return(nil, cloud.ErrNotFound)
 				_, err := driver.DeleteVolume(ctx, req)
-				if err != nil {
-					t.Fatalf("Delete Volume failed: %v", err)
+				if status.Code(err) != codes.FailedPrecondition {
+					t.Fatalf("Expected FailedPrecondition, got %v", err)
 				}
 				mockCtl.Finish()
 			},
@@ -2945,6 +4738,7 @@ func TestDeleteVolume(t *testing.T) {
 
 				ctx := context.Background()
 				mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(cloud.ErrNotFound)
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Eq(fsId)).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
 				_, err := driver.DeleteVolume(ctx, req)
 				if err != nil {
 					t.Fatalf("Delete Volume failed: %v", err)
@@ -3003,7 +4797,7 @@ func TestDeleteVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "Fail: Access Point is missing in volume Id",
+			name: "Fail: Access Point is missing in volume Id of a file system not provisioned by the driver",
 			testFunc: func(t *testing.T) {
 				mockCtl := gomock.NewController(t)
 				mockCloud := mocks.NewMockCloud(mockCtl)
@@ -3019,9 +4813,10 @@ func TestDeleteVolume(t *testing.T) {
 				}
 
 				ctx := context.Background()
+				mockCloud.EXPECT().DescribeTags(gomock.Eq(ctx), gomock.Eq("fs-abcd1234")).Return(map[string]string{}, nil)
 				_, err := driver.DeleteVolume(ctx, req)
-				if err == nil {
-					t.Fatal("DeleteVolume did not fail")
+				if status.Code(err) != codes.NotFound {
+					t.Fatalf("Expected DeleteVolume to fail with NotFound, got %v", err)
 				}
 				mockCtl.Finish()
 			},
@@ -3065,6 +4860,148 @@ func TestDeleteVolume(t *testing.T) {
 	}
 }
 
+func TestControllerPublishVolume(t *testing.T) {
+	var (
+		volumeId = "fs-abcd1234::fsap-abcd1234xyz987"
+		nodeId   = "i-abcd1234"
+		volCap   = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}
+	)
+	testCases := []struct {
+		name        string
+		attachments *attachmentTracker
+		req         *csi.ControllerPublishVolumeRequest
+		expectCode  codes.Code
+	}{
+		{
+			name:        "Success: volume recorded",
+			attachments: newRestoredAttachmentTracker(1, false),
+			req:         &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId, VolumeCapability: volCap},
+		},
+		{
+			name: "Success: volume already published",
+			attachments: func() *attachmentTracker {
+				a := newRestoredAttachmentTracker(1, false)
+				a.attach(volumeId, nodeId, false)
+				return a
+			}(),
+			req: &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId, VolumeCapability: volCap},
+		},
+		{
+			name: "Fail: node attach limit reached",
+			attachments: func() *attachmentTracker {
+				a := newRestoredAttachmentTracker(1, false)
+				a.attach("fs-abcd1234::fsap-other", nodeId, false)
+				return a
+			}(),
+			req:        &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId, VolumeCapability: volCap},
+			expectCode: codes.ResourceExhausted,
+		},
+		{
+			name: "Fail: single node writer published to another node",
+			attachments: func() *attachmentTracker {
+				a := newRestoredAttachmentTracker(0, true)
+				a.attach(volumeId, "i-other", true)
+				return a
+			}(),
+			req: &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId, VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			}},
+			expectCode: codes.FailedPrecondition,
+		},
+		{
+			name:        "Fail: attachments not restored yet",
+			attachments: newAttachmentTracker(1, false),
+			req:         &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId, VolumeCapability: volCap},
+			expectCode:  codes.Unavailable,
+		},
+		{
+			name:       "Fail: publish unpublish disabled",
+			req:        &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId, VolumeCapability: volCap},
+			expectCode: codes.Unimplemented,
+		},
+		{
+			name:        "Fail: node ID not provided",
+			attachments: newRestoredAttachmentTracker(0, false),
+			req:         &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, VolumeCapability: volCap},
+			expectCode:  codes.InvalidArgument,
+		},
+		{
+			name:        "Fail: volume capability not provided",
+			attachments: newRestoredAttachmentTracker(0, false),
+			req:         &csi.ControllerPublishVolumeRequest{VolumeId: volumeId, NodeId: nodeId},
+			expectCode:  codes.InvalidArgument,
+		},
+		{
+			name:        "Fail: invalid volume ID",
+			attachments: newRestoredAttachmentTracker(0, false),
+			req:         &csi.ControllerPublishVolumeRequest{VolumeId: "fs-abcd1234::fsap-1::extra", NodeId: nodeId, VolumeCapability: volCap},
+			expectCode:  codes.NotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &Driver{attachments: tc.attachments}
+			_, err := driver.ControllerPublishVolume(context.Background(), tc.req)
+			if tc.expectCode != codes.OK {
+				if status.Code(err) != tc.expectCode {
+					t.Fatalf("Expected %v, got %v", tc.expectCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ControllerPublishVolume failed: %v", err)
+			}
+			if count := tc.attachments.count(nodeId); count != 1 {
+				t.Fatalf("Expected 1 volume published to the node, got %d", count)
+			}
+		})
+	}
+}
+
+func TestControllerUnpublishVolume(t *testing.T) {
+	volumeId := "fs-abcd1234::fsap-abcd1234xyz987"
+	attachments := newRestoredAttachmentTracker(0, false)
+	attachments.attach(volumeId, "i-1", false)
+	attachments.attach(volumeId, "i-2", false)
+	attachments.attach("fs-abcd1234::fsap-other", "i-2", false)
+	driver := &Driver{attachments: attachments}
+	ctx := context.Background()
+
+	if _, err := driver.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument without volume ID, got %v", err)
+	}
+	// Unpublishing is idempotent
+	for i := 0; i < 2; i++ {
+		if _, err := driver.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: volumeId, NodeId: "i-1"}); err != nil {
+			t.Fatalf("ControllerUnpublishVolume failed: %v", err)
+		}
+	}
+	if attachments.count("i-1") != 0 || attachments.count("i-2") != 2 {
+		t.Fatalf("Expected the volume to only be unpublished from i-1, got %v", attachments.nodes)
+	}
+	// An empty node ID unpublishes the volume from every node
+	if _, err := driver.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: volumeId}); err != nil {
+		t.Fatalf("ControllerUnpublishVolume failed: %v", err)
+	}
+	if attachments.count("i-2") != 1 {
+		t.Fatalf("Expected the volume to be unpublished from i-2, got %v", attachments.nodes)
+	}
+
+	driver = &Driver{}
+	if _, err := driver.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: volumeId}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("Expected Unimplemented, got %v", err)
+	}
+}
+
 func TestValidateVolumeCapabilities(t *testing.T) {
 	var (
 		endpoint       = "endpoint"
@@ -3216,10 +5153,22 @@ func TestControllerGetCapabilities(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := driver.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	res, err := driver.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("ControllerGetCapabilities failed: %v", err)
+	}
+	if len(res.Capabilities) != len(controllerCaps) {
+		t.Fatalf("Expected %d capabilities, got %d", len(controllerCaps), len(res.Capabilities))
+	}
+
+	driver.attachments = newRestoredAttachmentTracker(0, false)
+	res, err = driver.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
 	if err != nil {
 		t.Fatalf("ControllerGetCapabilities failed: %v", err)
 	}
+	if last := res.Capabilities[len(res.Capabilities)-1]; last.GetRpc().GetType() != csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME {
+		t.Fatalf("Expected PUBLISH_UNPUBLISH_VOLUME capability, got %v", last)
+	}
 }
 
 func verifyPathWhenUUIDIncluded(pathToVerify string, expectedPathWithoutUUID string) bool {
@@ -3229,3 +5178,48 @@ func verifyPathWhenUUIDIncluded(pathToVerify string, expectedPathWithoutUUID str
 	_, err := uuid.Parse(matches[2])
 	return err == nil && doesPathMatchWithUuid
 }
+
+// listAccessPointsPages returns the action of a ListAccessPointsPages call listing the access points in a single page
+func listAccessPointsPages(accessPoints []*cloud.AccessPoint, err error) func(context.Context, string, func([]*cloud.AccessPoint) bool) error {
+	return func(_ context.Context, _ string, fn func([]*cloud.AccessPoint) bool) error {
+		if err != nil {
+			return err
+		}
+		fn(accessPoints)
+		return nil
+	}
+}
+
+func TestUnknownParameters(t *testing.T) {
+	params := map[string]string{
+		ProvisioningMode:              "efs-ap",
+		FsId:                          "fs-abcd1234",
+		"gidRangeEnds":                "2000",
+		PvName:                        "pv-1",
+		"csi.storage.k8s.io/pvc/name": "data",
+		"basepath":                    "/dynamic",
+	}
+	unknown := unknownParameters(params)
+	if !reflect.DeepEqual(unknown, []string{"basepath", "gidRangeEnds"}) {
+		t.Fatalf("Expected the misspelled parameters, got %v", unknown)
+	}
+	if unknown := unknownParameters(map[string]string{ProvisioningMode: "efs-ap", FsId: "fs-abcd1234"}); len(unknown) != 0 {
+		t.Fatalf("Expected no unknown parameters, got %v", unknown)
+	}
+}
+
+func verifyRetryDelay(t *testing.T, err error, delay time.Duration) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted error, got %v", err)
+	}
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			if retryInfo.RetryDelay.AsDuration() != delay {
+				t.Fatalf("Expected retry delay %v, got %v", delay, retryInfo.RetryDelay.AsDuration())
+			}
+			return
+		}
+	}
+	t.Fatalf("Expected RetryInfo detail in error %v", err)
+}
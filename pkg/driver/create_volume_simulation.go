@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/google/uuid"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+const adminSimulateCreateVolumePath = "/admin/simulate-create-volume"
+
+// createVolumeSimulationRequest is the JSON body of a CreateVolume simulation request of the admin socket
+type createVolumeSimulationRequest struct {
+	// Name is the name of the volume, generated as the external-provisioner does if empty
+	Name string `json:"name,omitempty"`
+	// Parameters are the parameters of the storage class, with the csi.storage.k8s.io/ parameters of the claim
+	// needed by the subPathPattern or the provisioning mode
+	Parameters    map[string]string `json:"parameters"`
+	CapacityBytes int64             `json:"capacityBytes,omitempty"`
+	// Secrets are the provisioner secrets of the storage class, e.g. the awsRoleArn of a cross account file system
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+type createVolumeSimulationResponse struct {
+	Name             string `json:"name"`
+	ProvisioningMode string `json:"provisioningMode"`
+	// Code is the gRPC code CreateVolume would fail with, OK if it would create the volume
+	Code  string `json:"code"`
+	Error string `json:"error,omitempty"`
+	// AccessPoint is the access point CreateVolume would create, or find with provisioning mode efs-shared-ap
+	AccessPoint *simulatedAccessPoint `json:"accessPoint,omitempty"`
+	// ReusedAccessPointId is the existing access point of the volume, with reuseAccessPoint or accessPointId
+	ReusedAccessPointId string `json:"reusedAccessPointId,omitempty"`
+	// Directory is the directory of the volume CreateVolume would create within the shared or existing access point
+	Directory string `json:"directory,omitempty"`
+	// FileSystem is the file system CreateVolume would create, with provisioning mode efs-fs
+	FileSystem *simulatedFileSystem `json:"fileSystem,omitempty"`
+}
+
+type simulatedAccessPoint struct {
+	FileSystemId  string `json:"fileSystemId"`
+	ClientToken   string `json:"clientToken"`
+	RootDirectory string `json:"rootDirectory"`
+	// Uid and Gid are not set without the posix user of the access point, with enforceUserIdentity=false, nor
+	// when they would be returned by the posix identity webhook, which is not called by simulations
+	Uid             *int64            `json:"uid,omitempty"`
+	Gid             *int64            `json:"gid,omitempty"`
+	SecondaryGids   []int64           `json:"secondaryGids,omitempty"`
+	PosixUserSource string            `json:"posixUserSource,omitempty"`
+	DirectoryPerms  string            `json:"directoryPerms,omitempty"`
+	CreationInfo    bool              `json:"creationInfo"`
+	Tags            map[string]string `json:"tags"`
+}
+
+type simulatedFileSystem struct {
+	CreationToken                string            `json:"creationToken"`
+	ThroughputMode               string            `json:"throughputMode,omitempty"`
+	ProvisionedThroughputInMibps float64           `json:"provisionedThroughputInMibps,omitempty"`
+	PerformanceMode              string            `json:"performanceMode,omitempty"`
+	Encrypted                    bool              `json:"encrypted"`
+	KmsKeyId                     string            `json:"kmsKeyId,omitempty"`
+	SubnetIds                    []string          `json:"subnetIds"`
+	SecurityGroupIds             []string          `json:"securityGroupIds,omitempty"`
+	Tags                         map[string]string `json:"tags"`
+}
+
+// createVolumeSimulation records what a CreateVolume call would provision. CreateVolume runs its validation,
+// GID selection and directory computation as usual, but stops before its first write, the creation of the
+// access point, file system or directory, or the completion of a pending access point, and returns no volume.
+// The reads, e.g. the listing of the access points or the mount checking the base path, are still done.
+type createVolumeSimulation struct {
+	res *createVolumeSimulationResponse
+}
+
+func newCreateVolumeSimulation(volName string) *createVolumeSimulation {
+	return &createVolumeSimulation{res: &createVolumeSimulationResponse{Name: volName}}
+}
+
+// accessPoint records the access point that would be created
+func (s *createVolumeSimulation) accessPoint(clientToken string, options *cloud.AccessPointOptions, posixUserSource string) {
+	if s == nil {
+		return
+	}
+	ap := &simulatedAccessPoint{
+		FileSystemId:    options.FileSystemId,
+		ClientToken:     clientToken,
+		RootDirectory:   options.DirectoryPath,
+		SecondaryGids:   options.SecondaryGids,
+		PosixUserSource: posixUserSource,
+		DirectoryPerms:  options.DirectoryPerms,
+		CreationInfo:    !options.SkipCreationInfo,
+		Tags:            options.Tags,
+	}
+	if !options.SkipPosixUser && posixUserSource != posixUserFromWebhook {
+		uid, gid := options.Uid, options.Gid
+		ap.Uid, ap.Gid = &uid, &gid
+	}
+	s.res.AccessPoint = ap
+}
+
+// reusedAccessPoint records the existing access point of the volume, and the directory that would be created in it
+func (s *createVolumeSimulation) reusedAccessPoint(accessPointId, dir string) {
+	if s == nil {
+		return
+	}
+	s.res.ReusedAccessPointId = accessPointId
+	s.res.Directory = dir
+}
+
+// fileSystem records the file system that would be created with provisioning mode efs-fs
+func (s *createVolumeSimulation) fileSystem(creationToken string, options *fileSystemVolumeOptions) {
+	if s == nil {
+		return
+	}
+	s.res.FileSystem = &simulatedFileSystem{
+		CreationToken:                creationToken,
+		ThroughputMode:               options.fileSystem.ThroughputMode,
+		ProvisionedThroughputInMibps: options.fileSystem.ProvisionedThroughputInMibps,
+		PerformanceMode:              options.fileSystem.PerformanceMode,
+		Encrypted:                    options.fileSystem.Encrypted,
+		KmsKeyId:                     options.fileSystem.KmsKeyId,
+		SubnetIds:                    options.subnetIds,
+		SecurityGroupIds:             options.securityGroupIds,
+		Tags:                         options.fileSystem.Tags,
+	}
+}
+
+// simulateCreateVolume runs CreateVolume as a simulation, with the volume capability of the external-provisioner
+// for a ReadWriteMany claim
+func (d *Driver) simulateCreateVolume(ctx context.Context, req *createVolumeSimulationRequest) *createVolumeSimulationResponse {
+	volName := req.Name
+	if volName == "" {
+		volName = "pvc-" + uuid.New().String()
+	}
+	simulation := newCreateVolumeSimulation(volName)
+	simulation.res.ProvisioningMode = req.Parameters[ProvisioningMode]
+	_, err := d.createVolume(ctx, &csi.CreateVolumeRequest{
+		Name:          volName,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: req.CapacityBytes},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+		}},
+		Parameters: req.Parameters,
+		Secrets:    req.Secrets,
+	}, simulation)
+	simulation.res.Code = status.Code(err).String()
+	if err != nil {
+		simulation.res.Error = err.Error()
+	}
+	return simulation.res
+}
+
+func (d *Driver) simulateCreateVolumeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req := &createVolumeSimulationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		res := d.simulateCreateVolume(r.Context(), req)
+		klog.V(4).Infof("Simulated CreateVolume of volume %v: %v", res.Name, res.Code)
+		w.Header().Set("Content-Type", "application/json")
+		// A volume that could not be created fails the request, e.g. for curl --fail in a CI pipeline
+		if res.Code != codes.OK.String() {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			klog.Warningf("Failed to write CreateVolume simulation response: %v", err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+	"google.golang.org/grpc/codes"
+)
+
+func TestSimulateCreateVolume(t *testing.T) {
+	const fsId = "fs-abcd1234"
+
+	t.Run("access point with an allocated gid", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		mockCloud := mocks.NewMockCloud(mockCtl)
+		driver := &Driver{cloud: mockCloud, gidAllocator: NewGidAllocator(), clusterId: "cluster-1"}
+
+		ctx := context.Background()
+		used := []*cloud.AccessPoint{{AccessPointId: "fsap-1", FileSystemId: fsId, PosixUser: &cloud.PosixUser{Gid: DefaultGidMin}}}
+		mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), gomock.Any(), gomock.Any()).DoAndReturn(listAccessPointsPages(used, nil)).Times(2)
+
+		// The allocated gid is not reserved, so that simulations do not use up the range
+		for i := 0; i < 2; i++ {
+			res := driver.simulateCreateVolume(ctx, &createVolumeSimulationRequest{
+				Name:       "pvc-1234",
+				Parameters: map[string]string{ProvisioningMode: AccessPointMode, FsId: fsId, BasePath: "/dynamic", DirectoryPerms: "700"},
+			})
+			gid := int64(DefaultGidMin + 1)
+			expected := &simulatedAccessPoint{
+				FileSystemId:    fsId,
+				ClientToken:     "pvc-1234",
+				RootDirectory:   "/dynamic/pvc-1234",
+				Uid:             &gid,
+				Gid:             &gid,
+				PosixUserSource: posixUserFromAllocation,
+				DirectoryPerms:  "700",
+				CreationInfo:    true,
+				Tags:            map[string]string{DefaultTagKey: DefaultTagValue, cloud.ClusterIdTagKey: "cluster-1"},
+			}
+			if res.Code != codes.OK.String() || !reflect.DeepEqual(res.AccessPoint, expected) {
+				t.Fatalf("Expected access point %+v, got %+v (%s: %s)", expected, res.AccessPoint, res.Code, res.Error)
+			}
+		}
+	})
+
+	t.Run("access point without calling the posix identity webhook", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		mockCloud := mocks.NewMockCloud(mockCtl)
+		webhook := &fakePosixIdentityWebhook{identity: &PosixIdentity{Uid: int64Ptr(3000), Gid: int64Ptr(3001)}}
+		driver := &Driver{cloud: mockCloud, gidAllocator: NewGidAllocator(), posixIdentityWebhook: webhook}
+
+		mockCloud.EXPECT().DescribeFileSystem(gomock.Any(), gomock.Eq(fsId)).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+
+		res := driver.simulateCreateVolume(context.Background(), &createVolumeSimulationRequest{
+			Name:       "pvc-1234",
+			Parameters: map[string]string{ProvisioningMode: AccessPointMode, FsId: fsId, DirectoryPerms: "700", PvcName: "pvc", PvcNamespace: "ns"},
+		})
+		if res.Code != codes.OK.String() || res.AccessPoint == nil {
+			t.Fatalf("Unexpected simulation %+v", res)
+		}
+		if webhook.req != nil {
+			t.Fatalf("Expected no posix identity webhook request, got %+v", webhook.req)
+		}
+		if res.AccessPoint.PosixUserSource != posixUserFromWebhook || res.AccessPoint.Uid != nil || res.AccessPoint.Gid != nil {
+			t.Fatalf("Unexpected access point %+v", res.AccessPoint)
+		}
+	})
+
+	t.Run("file system", func(t *testing.T) {
+		mockCtl := gomock.NewController(t)
+		defer mockCtl.Finish()
+		driver := &Driver{cloud: mocks.NewMockCloud(mockCtl)}
+
+		res := driver.simulateCreateVolume(context.Background(), &createVolumeSimulationRequest{
+			Parameters: map[string]string{ProvisioningMode: FileSystemMode, SubnetIds: "subnet-a,subnet-b", ThroughputMode: "elastic"},
+		})
+		if res.Code != codes.OK.String() || res.FileSystem == nil || res.FileSystem.CreationToken != res.Name || !strings.HasPrefix(res.Name, "pvc-") {
+			t.Fatalf("Unexpected simulation %+v", res)
+		}
+		if !res.FileSystem.Encrypted || res.FileSystem.ThroughputMode != "elastic" || !reflect.DeepEqual(res.FileSystem.SubnetIds, []string{"subnet-a", "subnet-b"}) {
+			t.Fatalf("Unexpected file system %+v", res.FileSystem)
+		}
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		driver := &Driver{}
+		rec := httptest.NewRecorder()
+		driver.simulateCreateVolumeHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, adminSimulateCreateVolumePath,
+			strings.NewReader(`{"name": "pvc-1234", "parameters": {"provisioningMode": "efs-ap"}}`)))
+		res := &createVolumeSimulationResponse{}
+		if err := json.NewDecoder(rec.Body).Decode(res); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusUnprocessableEntity || res.Code != codes.InvalidArgument.String() || res.Error == "" || res.AccessPoint != nil {
+			t.Fatalf("Unexpected response %d: %+v", rec.Code, res)
+		}
+	})
+}
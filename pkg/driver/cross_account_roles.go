@@ -0,0 +1,111 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// crossAccountValidationMargin is how long before the expiration of the credentials of its role the validation
+// of a volume is done again
+const crossAccountValidationMargin = 5 * time.Minute
+
+// crossAccountRoles validates the cross account volumes before they are mounted. A volume whose context has
+// crossaccount set must be published with the node publish secrets of its storage class, with the awsRoleArn
+// of the account of the file system and crossaccount set to true if set, and the node must be able to assume
+// the role. With cacheValidation, the validation of each volume is cached until the credentials of the role
+// that it assumed expire, so that the remounts of the volume are not validated again. Only the validation is
+// cached: the credentials are not used by the driver, efs-utils assumes the role of the volume on its own to
+// mount it. A nil crossAccountRoles is valid and validates nothing.
+type crossAccountRoles struct {
+	roleAssumer     cloud.RoleAssumer
+	cacheValidation bool
+
+	mu sync.Mutex
+	// validations holds the role validated for each volume, until its credentials expire
+	validations map[string]crossAccountValidation
+}
+
+type crossAccountValidation struct {
+	roleArn string
+	expires time.Time
+}
+
+func newCrossAccountRoles(roleAssumer cloud.RoleAssumer, cacheValidation bool) *crossAccountRoles {
+	return &crossAccountRoles{
+		roleAssumer:     roleAssumer,
+		cacheValidation: cacheValidation,
+		validations:     map[string]crossAccountValidation{},
+	}
+}
+
+// validate checks that the secrets of the cross account volume have a role that the node can assume in the
+// region, and returns the status error to fail NodePublishVolume with otherwise
+func (r *crossAccountRoles) validate(ctx context.Context, volumeId, region string, secrets map[string]string) error {
+	if r == nil {
+		return nil
+	}
+	roleArn, ok := secrets[RoleArn]
+	if !ok || roleArn == "" {
+		return status.Errorf(codes.FailedPrecondition, "Volume context property %q is set but the node publish secrets have no %q, "+
+			"set csi.storage.k8s.io/node-publish-secret-name and csi.storage.k8s.io/node-publish-secret-namespace in the storage class", CrossAccount, RoleArn)
+	}
+	if value, ok := secrets[CrossAccount]; ok {
+		if enabled, err := strconv.ParseBool(value); err != nil || !enabled {
+			return status.Errorf(codes.InvalidArgument, "Volume context property %q is set but the node publish secrets have %q set to %q", CrossAccount, CrossAccount, value)
+		}
+	}
+
+	if r.cacheValidation {
+		r.mu.Lock()
+		cached, ok := r.validations[volumeId]
+		r.mu.Unlock()
+		if ok && cached.roleArn == roleArn && time.Now().Add(crossAccountValidationMargin).Before(cached.expires) {
+			klog.V(4).Infof("NodePublishVolume: role %s already validated for volume %s", roleArn, volumeId)
+			return nil
+		}
+	}
+
+	expires, err := r.roleAssumer.AssumeRole(ctx, roleArn, region)
+	if err != nil {
+		if errors.Is(err, cloud.ErrAccessDenied) {
+			return status.Errorf(codes.PermissionDenied, "Node may not assume role %s of the node publish secrets: %v", roleArn, err)
+		}
+		if errors.Is(err, cloud.ErrDeadlineExceeded) {
+			return status.Errorf(codes.DeadlineExceeded, "Timed out assuming role %s of the node publish secrets", roleArn)
+		}
+		return status.Errorf(codes.Unavailable, "Could not assume role %s of the node publish secrets: %v", roleArn, err)
+	}
+	klog.V(4).Infof("NodePublishVolume: assumed role %s for volume %s", roleArn, volumeId)
+
+	if r.cacheValidation {
+		r.mu.Lock()
+		r.validations[volumeId] = crossAccountValidation{roleArn: roleArn, expires: expires}
+		r.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+type fakeRoleAssumer struct {
+	calls   int
+	expires time.Time
+	err     error
+}
+
+func (f *fakeRoleAssumer) AssumeRole(ctx context.Context, roleArn, region string) (time.Time, error) {
+	f.calls++
+	return f.expires, f.err
+}
+
+func TestCrossAccountRolesValidate(t *testing.T) {
+	roleArn := "arn:aws:iam::123456789012:role/EFSCrossAccountAccessRole"
+	testCases := []struct {
+		name          string
+		secrets       map[string]string
+		assumeErr     error
+		expectedCode  codes.Code
+		expectedCalls int
+	}{
+		{
+			name:          "Success: role assumed",
+			secrets:       map[string]string{RoleArn: roleArn, CrossAccount: "true"},
+			expectedCode:  codes.OK,
+			expectedCalls: 1,
+		},
+		{
+			name:         "Fail: no node publish secrets",
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "Fail: crossaccount disabled in secrets",
+			secrets:      map[string]string{RoleArn: roleArn, CrossAccount: "false"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:          "Fail: role may not be assumed",
+			secrets:       map[string]string{RoleArn: roleArn},
+			assumeErr:     fmt.Errorf("%w: not authorized to perform sts:AssumeRole", cloud.ErrAccessDenied),
+			expectedCode:  codes.PermissionDenied,
+			expectedCalls: 1,
+		},
+		{
+			name:          "Fail: STS unavailable",
+			secrets:       map[string]string{RoleArn: roleArn},
+			assumeErr:     errors.New("connection refused"),
+			expectedCode:  codes.Unavailable,
+			expectedCalls: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assumer := &fakeRoleAssumer{expires: time.Now().Add(time.Hour), err: tc.assumeErr}
+			roles := newCrossAccountRoles(assumer, false)
+			err := roles.validate(context.Background(), "fs-abcd1234", "us-east-1", tc.secrets)
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v: %v", tc.expectedCode, code, err)
+			}
+			if assumer.calls != tc.expectedCalls {
+				t.Fatalf("Expected %d AssumeRole calls, got %d", tc.expectedCalls, assumer.calls)
+			}
+		})
+	}
+}
+
+func TestCrossAccountRolesCache(t *testing.T) {
+	secrets := map[string]string{RoleArn: "arn:aws:iam::123456789012:role/EFSCrossAccountAccessRole"}
+	ctx := context.Background()
+
+	assumer := &fakeRoleAssumer{expires: time.Now().Add(time.Hour)}
+	roles := newCrossAccountRoles(assumer, true)
+	for i := 0; i < 2; i++ {
+		if err := roles.validate(ctx, "fs-abcd1234", "us-east-1", secrets); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if assumer.calls != 1 {
+		t.Fatalf("Expected the validation to be cached, got %d AssumeRole calls", assumer.calls)
+	}
+
+	// Another role or volume assumes the role again
+	if err := roles.validate(ctx, "fs-abcd1234", "us-east-1", map[string]string{RoleArn: "arn:aws:iam::123456789012:role/Other"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := roles.validate(ctx, "fs-efgh5678", "us-east-1", secrets); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if assumer.calls != 3 {
+		t.Fatalf("Expected 3 AssumeRole calls, got %d", assumer.calls)
+	}
+
+	// The validation is done again once the credentials are about to expire
+	assumer = &fakeRoleAssumer{expires: time.Now().Add(crossAccountValidationMargin / 2)}
+	roles = newCrossAccountRoles(assumer, true)
+	for i := 0; i < 2; i++ {
+		if err := roles.validate(ctx, "fs-abcd1234", "us-east-1", secrets); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if assumer.calls != 2 {
+		t.Fatalf("Expected the expiring credentials to be assumed again, got %d AssumeRole calls", assumer.calls)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const deleteAuditWebhookTimeout = 10 * time.Second
+
+// DeleteAuditRecord describes the data removed by a DeleteVolume call
+type DeleteAuditRecord struct {
+	Time          string `json:"time"`
+	VolumeId      string `json:"volumeId"`
+	FileSystemId  string `json:"fileSystemId"`
+	AccessPointId string `json:"accessPointId"`
+	// RootDirectory is the directory removed, relative to the root of the file system or, for the
+	// volumes of a shared access point, to the root directory of the access point
+	RootDirectory string `json:"rootDirectory"`
+	// BytesEstimated is the size of the regular files removed, hard links are counted once per link
+	BytesEstimated        int64  `json:"bytesEstimated"`
+	PersistentVolume      string `json:"persistentVolume,omitempty"`
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	// Error is set when the removal stopped before the end, the record then covers what was removed
+	Error string `json:"error,omitempty"`
+}
+
+// DeleteAuditSink stores the audit records of DeleteVolume
+type DeleteAuditSink interface {
+	Write(ctx context.Context, record *DeleteAuditRecord) error
+}
+
+// newDeleteAuditSink returns the sink of the URL, an http(s) webhook receiving every record as a JSON
+// POST, or an absolute path of a file the records are appended to as JSON lines
+func newDeleteAuditSink(url string) (DeleteAuditSink, error) {
+	if url == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return &webhookDeleteAuditSink{
+			url:    url,
+			client: &http.Client{Timeout: deleteAuditWebhookTimeout},
+		}, nil
+	}
+	if !filepath.IsAbs(url) {
+		return nil, fmt.Errorf("delete audit sink %q is neither an http(s) URL nor an absolute file path", url)
+	}
+	return &fileDeleteAuditSink{path: url}, nil
+}
+
+type fileDeleteAuditSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (s *fileDeleteAuditSink) Write(ctx context.Context, record *DeleteAuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open delete audit log %s: %v", s.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write delete audit log %s: %v", s.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync delete audit log %s: %v", s.path, err)
+	}
+	return f.Close()
+}
+
+type webhookDeleteAuditSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookDeleteAuditSink) Write(ctx context.Context, record *DeleteAuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("delete audit webhook call failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("delete audit webhook returned status %d: %s", res.StatusCode, string(resBody))
+	}
+	return nil
+}
+
+// volumeHandleIndex indexes the persistent volumes of the driver by volume handle
+const volumeHandleIndex = "volumeHandle"
+
+// deleteAuditor writes an audit record for every DeleteVolume call which removed data. The persistent
+// volumes are read from the informer shared by the controller. A nil auditor is valid and records nothing.
+type deleteAuditor struct {
+	sink    DeleteAuditSink
+	pvs     cache.Indexer
+	pvsSync cache.InformerSynced
+}
+
+func newDeleteAuditor(sinkUrl string, factory informers.SharedInformerFactory) (*deleteAuditor, error) {
+	sink, err := newDeleteAuditSink(sinkUrl)
+	if err != nil || sink == nil {
+		return nil, err
+	}
+	informer := factory.Core().V1().PersistentVolumes().Informer()
+	err = informer.AddIndexers(cache.Indexers{volumeHandleIndex: func(obj interface{}) ([]string, error) {
+		pv, ok := obj.(*corev1.PersistentVolume)
+		if !ok || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			return nil, nil
+		}
+		return []string{pv.Spec.CSI.VolumeHandle}, nil
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index persistent volumes: %v", err)
+	}
+	return &deleteAuditor{
+		sink:    sink,
+		pvs:     informer.GetIndexer(),
+		pvsSync: informer.HasSynced,
+	}, nil
+}
+
+// newRecord returns the record of the deletion of the volume, with the persistent volume and claim
+// of the volume if they can be found. It must be called before the data is removed, while the
+// persistent volume still exists.
+func (a *deleteAuditor) newRecord(ctx context.Context, volumeId, fileSystemId, accessPointId, rootDir string) *DeleteAuditRecord {
+	if a == nil {
+		return nil
+	}
+	record := &DeleteAuditRecord{
+		VolumeId:      volumeId,
+		FileSystemId:  fileSystemId,
+		AccessPointId: accessPointId,
+		RootDirectory: rootDir,
+	}
+	if !a.pvsSync() {
+		klog.Warningf("Could not find the persistent volume of volume %v for the delete audit record: persistent volumes are not synced yet", volumeId)
+		return record
+	}
+	objs, err := a.pvs.ByIndex(volumeHandleIndex, volumeId)
+	if err != nil {
+		klog.Warningf("Could not find the persistent volume of volume %v for the delete audit record: %v", volumeId, err)
+		return record
+	}
+	for _, obj := range objs {
+		pv := obj.(*corev1.PersistentVolume)
+		record.PersistentVolume = pv.Name
+		if pv.Spec.ClaimRef != nil {
+			record.PersistentVolumeClaim = pv.Spec.ClaimRef.Namespace + "/" + pv.Spec.ClaimRef.Name
+		}
+		break
+	}
+	return record
+}
+
+// write completes the record with the removal result and writes it, even if the DeleteVolume call
+// timed out. Failures are logged, the data being already removed.
+func (a *deleteAuditor) write(record *DeleteAuditRecord, bytesRemoved int64, removeErr error) {
+	if a == nil || record == nil {
+		return
+	}
+	record.Time = time.Now().UTC().Format(time.RFC3339)
+	record.BytesEstimated = bytesRemoved
+	if removeErr != nil {
+		record.Error = removeErr.Error()
+	}
+	if err := a.sink.Write(context.Background(), record); err != nil {
+		klog.Errorf("Failed to write the delete audit record %+v: %v", *record, err)
+		return
+	}
+	klog.V(4).Infof("Wrote delete audit record %+v", *record)
+}
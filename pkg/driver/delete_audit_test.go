@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestNewDeleteAuditSink(t *testing.T) {
+	testCases := []struct {
+		name      string
+		url       string
+		expectNil bool
+		expectErr bool
+	}{
+		{name: "disabled", url: "", expectNil: true},
+		{name: "webhook", url: "https://audit.example.com/efs"},
+		{name: "file", url: "/var/log/efs-csi/delete-audit.log"},
+		{name: "relative file", url: "delete-audit.log", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := newDeleteAuditSink(tc.url)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && tc.expectNil != (sink == nil) {
+				t.Fatalf("Expected nil sink: %v, got %v", tc.expectNil, sink)
+			}
+		})
+	}
+}
+
+func TestWebhookDeleteAuditSink(t *testing.T) {
+	var received []*DeleteAuditRecord
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record := &DeleteAuditRecord{}
+		if err := json.NewDecoder(r.Body).Decode(record); err != nil {
+			t.Errorf("Failed to decode record: %v", err)
+		}
+		received = append(received, record)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := newDeleteAuditSink(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), &DeleteAuditRecord{VolumeId: "fs-abcd1234::fsap-abcd1234", BytesEstimated: 42}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(received) != 1 || received[0].BytesEstimated != 42 {
+		t.Fatalf("Unexpected records received: %+v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Write(context.Background(), &DeleteAuditRecord{}); err == nil {
+		t.Fatal("Expected an error when the webhook fails")
+	}
+}
+
+func TestDeleteVolumeAudit(t *testing.T) {
+	var (
+		fsId     = "fs-abcd1234"
+		apId     = "fsap-abcd1234xyz987"
+		volumeId = fsId + "::" + apId
+		rootDir  = "/efs-audit-test-missing"
+	)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	mockMounter := mocks.NewMockMounter(mockCtl)
+
+	clientset := fake.NewSimpleClientset(&corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: volumeId},
+			},
+			ClaimRef: &corev1.ObjectReference{Namespace: "team-a", Name: "data"},
+		},
+	})
+	auditLog := filepath.Join(t.TempDir(), "delete-audit.log")
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	audit, err := newDeleteAuditor(auditLog, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	driver := &Driver{
+		cloud:                    mockCloud,
+		mounter:                  mockMounter,
+		deleteAccessPointRootDir: true,
+		deleteAudit:              audit,
+	}
+
+	ctx := context.Background()
+	mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(&cloud.AccessPoint{
+		AccessPointId:      apId,
+		FileSystemId:       fsId,
+		AccessPointRootDir: rootDir,
+	}, nil)
+	mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
+	mockMounter.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockMounter.EXPECT().Unmount(gomock.Any()).Return(nil)
+	mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+	if _, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeId}); err != nil {
+		t.Fatalf("Delete Volume failed: %v", err)
+	}
+
+	data, err := os.ReadFile(auditLog)
+	if err != nil {
+		t.Fatalf("Failed to read the audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected one audit record, got %q", string(data))
+	}
+	record := &DeleteAuditRecord{}
+	if err := json.Unmarshal([]byte(lines[0]), record); err != nil {
+		t.Fatalf("Failed to decode the audit record: %v", err)
+	}
+	if record.VolumeId != volumeId || record.AccessPointId != apId || record.RootDirectory != rootDir ||
+		record.PersistentVolume != "pv-1" || record.PersistentVolumeClaim != "team-a/data" || record.Time == "" || record.Error != "" {
+		t.Fatalf("Unexpected audit record %+v", record)
+	}
+}
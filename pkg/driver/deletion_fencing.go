@@ -0,0 +1,205 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// deletionFencingSettle is how long the fencing token tagged on an access point is left to settle before it
+// is read back, so that the replicas tagging it concurrently all read the token of the last one
+const deletionFencingSettle = 2 * time.Second
+
+var (
+	// errDeletionInProgress is returned when another controller replica holds the deletion of the access point
+	errDeletionInProgress = errors.New("deletion in progress by another controller")
+	// errDeletionFenced is returned when another controller replica took over the deletion of the access point
+	errDeletionFenced = errors.New("deletion taken over by another controller")
+)
+
+// deletionFencing records the intent of DeleteVolume to delete an access point and its root directory with a
+// fencing token tagged on the access point, so that two controller replicas, e.g. a leader and the one
+// replacing it, never delete the root directory concurrently. The token is checked again before each
+// destructive step and renewed while the root directory is removed, and the deletion of a replica is taken
+// over once its token is older than the lease. A nil deletionFencing is valid and fences nothing.
+type deletionFencing struct {
+	lease  time.Duration
+	settle time.Duration
+	holder string
+}
+
+// newDeletionFencing returns the fencing of the lease for the controller holder, or nil if the lease is 0
+func newDeletionFencing(lease time.Duration, holder string) *deletionFencing {
+	if lease <= 0 {
+		return nil
+	}
+	return &deletionFencing{
+		lease:  lease,
+		settle: deletionFencingSettle,
+		holder: holder,
+	}
+}
+
+// acquire tags the access point with a new fencing token and returns it once the token settled, or
+// errDeletionInProgress if another replica holds an unexpired token. An unexpired token of this replica, left
+// by a DeleteVolume that timed out, is taken over right away.
+func (f *deletionFencing) acquire(ctx context.Context, localCloud cloud.Cloud, accessPoint *cloud.AccessPoint) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	if f.ownToken(accessPoint.DeletionToken) {
+		klog.V(4).Infof("DeleteVolume: resuming the deletion of access point %v by token %s", accessPoint.AccessPointId, accessPoint.DeletionToken)
+	} else if accessPoint.DeletionToken != "" && time.Since(accessPoint.DeletingSince) < f.lease {
+		return "", fmt.Errorf("%w: token %s since %v", errDeletionInProgress, accessPoint.DeletionToken, accessPoint.DeletingSince)
+	} else if accessPoint.DeletionToken != "" {
+		klog.Warningf("DeleteVolume: taking over the deletion of access point %v by token %s since %v", accessPoint.AccessPointId, accessPoint.DeletionToken, accessPoint.DeletingSince)
+	}
+
+	token, err := f.newToken()
+	if err != nil {
+		return "", err
+	}
+	tags := map[string]string{
+		cloud.DeletionTokenTagKey: token,
+		cloud.DeletingSinceTagKey: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := localCloud.TagResource(ctx, accessPoint.AccessPointId, tags); err != nil {
+		return "", err
+	}
+	select {
+	case <-time.After(f.settle):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if err := f.check(ctx, localCloud, accessPoint.AccessPointId, token); err != nil {
+		return "", err
+	}
+	klog.V(4).Infof("DeleteVolume: acquired the deletion of access point %v with token %s", accessPoint.AccessPointId, token)
+	return token, nil
+}
+
+// check returns errDeletionFenced if the access point is no longer tagged with the token
+func (f *deletionFencing) check(ctx context.Context, localCloud cloud.Cloud, accessPointId, token string) error {
+	if f == nil || token == "" {
+		return nil
+	}
+	tags, err := localCloud.DescribeTags(ctx, accessPointId)
+	if err != nil {
+		return err
+	}
+	if current := tags[cloud.DeletionTokenTagKey]; current != token {
+		return fmt.Errorf("%w: token %s instead of %s", errDeletionFenced, current, token)
+	}
+	return nil
+}
+
+// hold renews the token of the access point every third of the lease until the returned stop function is
+// called, so that the deletion is not taken over while the root directory is removed. The returned context is
+// cancelled with errDeletionFenced as its cause as soon as another replica took over the deletion.
+func (f *deletionFencing) hold(ctx context.Context, localCloud cloud.Cloud, accessPointId, token string) (context.Context, func()) {
+	holdCtx, cancel := context.WithCancelCause(ctx)
+	if f == nil || token == "" {
+		return holdCtx, func() { cancel(nil) }
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(f.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-holdCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := f.renew(holdCtx, localCloud, accessPointId, token); err != nil {
+				if errors.Is(err, errDeletionFenced) {
+					cancel(err)
+					return
+				}
+				klog.Warningf("DeleteVolume: could not renew the deletion of access point %v: %v", accessPointId, err)
+			}
+		}
+	}()
+	return holdCtx, func() {
+		close(done)
+		<-stopped
+		cancel(nil)
+	}
+}
+
+// renew tags the access point with the time of its token again, unless another replica took over its deletion
+func (f *deletionFencing) renew(ctx context.Context, localCloud cloud.Cloud, accessPointId, token string) error {
+	if err := f.check(ctx, localCloud, accessPointId, token); err != nil {
+		return err
+	}
+	tags := map[string]string{
+		cloud.DeletionTokenTagKey: token,
+		cloud.DeletingSinceTagKey: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := localCloud.TagResource(ctx, accessPointId, tags); err != nil {
+		return err
+	}
+	klog.V(4).Infof("DeleteVolume: renewed the deletion of access point %v with token %s", accessPointId, token)
+	return nil
+}
+
+// ownToken returns whether the token was generated by this replica
+func (f *deletionFencing) ownToken(token string) bool {
+	return f.holder != "" && strings.HasPrefix(token, f.holder+"-")
+}
+
+// newToken returns a token unique to the deletion attempt, prefixed with the holder for troubleshooting
+func (f *deletionFencing) newToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	if f.holder == "" {
+		return hex.EncodeToString(b), nil
+	}
+	return f.holder + "-" + hex.EncodeToString(b), nil
+}
+
+// deletionFencingError returns the status error of DeleteVolume for an error of the fencing of the access point
+func deletionFencingError(accessPointId string, err error) error {
+	if errors.Is(err, errDeletionInProgress) || errors.Is(err, errDeletionFenced) {
+		return status.Errorf(codes.Aborted, "Access point %v: %v", accessPointId, err)
+	}
+	if err == cloud.ErrAccessDenied {
+		return status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
+	}
+	if err == cloud.ErrDeadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+		return status.Errorf(codes.DeadlineExceeded, "Timed out fencing the deletion of Access Point: %v", accessPointId)
+	}
+	return status.Errorf(codes.Internal, "Could not fence the deletion of Access Point %v: %v", accessPointId, err)
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestDeletionFencingAcquire(t *testing.T) {
+	const apId = "fsap-abcd1234xyz987"
+	testCases := []struct {
+		name         string
+		accessPoint  *cloud.AccessPoint
+		overwritten  bool
+		expectTagged bool
+		expectErr    error
+	}{
+		{
+			name:         "Success: access point not being deleted",
+			accessPoint:  &cloud.AccessPoint{AccessPointId: apId},
+			expectTagged: true,
+		},
+		{
+			name:         "Success: expired deletion taken over",
+			accessPoint:  &cloud.AccessPoint{AccessPointId: apId, DeletionToken: "controller-0-1234", DeletingSince: time.Now().Add(-time.Hour)},
+			expectTagged: true,
+		},
+		{
+			name:         "Success: unexpired deletion of this replica resumed",
+			accessPoint:  &cloud.AccessPoint{AccessPointId: apId, DeletionToken: "controller-0-1234", DeletingSince: time.Now()},
+			expectTagged: true,
+		},
+		{
+			name:        "Fail: deletion in progress by another replica",
+			accessPoint: &cloud.AccessPoint{AccessPointId: apId, DeletionToken: "controller-10-1234", DeletingSince: time.Now()},
+			expectErr:   errDeletionInProgress,
+		},
+		{
+			name:         "Fail: token overwritten by another replica",
+			accessPoint:  &cloud.AccessPoint{AccessPointId: apId},
+			overwritten:  true,
+			expectTagged: true,
+			expectErr:    errDeletionFenced,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			ctx := context.Background()
+
+			var tagged map[string]string
+			if tc.expectTagged {
+				mockCloud.EXPECT().TagResource(gomock.Eq(ctx), gomock.Eq(apId), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, tags map[string]string) error {
+						tagged = tags
+						return nil
+					})
+				mockCloud.EXPECT().DescribeTags(gomock.Eq(ctx), gomock.Eq(apId)).DoAndReturn(
+					func(_ context.Context, _ string) (map[string]string, error) {
+						if tc.overwritten {
+							return map[string]string{cloud.DeletionTokenTagKey: "controller-1-5678"}, nil
+						}
+						return tagged, nil
+					})
+			}
+
+			fencing := newDeletionFencing(10*time.Minute, "controller-0")
+			fencing.settle = 0
+			token, err := fencing.acquire(ctx, mockCloud, tc.accessPoint)
+			if tc.expectErr != nil {
+				if !errors.Is(err, tc.expectErr) {
+					t.Fatalf("Expected error %v, got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(token, "controller-0-") || token == tc.accessPoint.DeletionToken {
+				t.Fatalf("Expected a new token of the holder, got %s", token)
+			}
+			if tagged[cloud.DeletionTokenTagKey] != token || tagged[cloud.DeletingSinceTagKey] == "" {
+				t.Fatalf("Expected the access point to be tagged with the token, got %v", tagged)
+			}
+		})
+	}
+}
+
+func TestDeletionFencingHold(t *testing.T) {
+	const (
+		apId  = "fsap-abcd1234xyz987"
+		token = "controller-0-1234"
+	)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+
+	renewed := make(chan string, 1)
+	mockCloud.EXPECT().DescribeTags(gomock.Any(), gomock.Eq(apId)).Return(map[string]string{cloud.DeletionTokenTagKey: token}, nil)
+	mockCloud.EXPECT().TagResource(gomock.Any(), gomock.Eq(apId), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, tags map[string]string) error {
+			renewed <- tags[cloud.DeletionTokenTagKey]
+			return nil
+		})
+	mockCloud.EXPECT().DescribeTags(gomock.Any(), gomock.Eq(apId)).Return(map[string]string{cloud.DeletionTokenTagKey: "controller-1-5678"}, nil)
+
+	fencing := newDeletionFencing(30*time.Millisecond, "controller-0")
+	ctx, stop := fencing.hold(context.Background(), mockCloud, apId, token)
+	defer stop()
+	select {
+	case renewedToken := <-renewed:
+		if renewedToken != token {
+			t.Fatalf("Expected the token %s to be renewed, got %s", token, renewedToken)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the token to be renewed")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the context to be cancelled once the deletion is taken over")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, errDeletionFenced) {
+		t.Fatalf("Expected the cause %v, got %v", errDeletionFenced, cause)
+	}
+}
+
+func TestDeleteVolumeDeletionInProgress(t *testing.T) {
+	const (
+		fsId = "fs-abcd1234"
+		apId = "fsap-abcd1234xyz987"
+	)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+
+	driver := &Driver{
+		endpoint:                 "endpoint",
+		cloud:                    mockCloud,
+		gidAllocator:             NewGidAllocator(),
+		deleteAccessPointRootDir: true,
+		deletionFencing:          newDeletionFencing(10*time.Minute, "controller-1"),
+	}
+	accessPoint := &cloud.AccessPoint{
+		AccessPointId:      apId,
+		FileSystemId:       fsId,
+		AccessPointRootDir: "/pvc-1234",
+		DeletionToken:      "controller-0-1234",
+		DeletingSince:      time.Now(),
+	}
+
+	ctx := context.Background()
+	mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
+	_, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: fsId + "::" + apId})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("Expected the deletion to be aborted, got %v", err)
+	}
+}
+
+func TestDeleteVolumeDeletionTakenOverBeforeRemoval(t *testing.T) {
+	const (
+		fsId = "fs-abcd1234"
+		apId = "fsap-abcd1234xyz987"
+	)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	mockMounter := mocks.NewMockMounter(mockCtl)
+
+	fencing := newDeletionFencing(10*time.Minute, "controller-1")
+	fencing.settle = 0
+	driver := &Driver{
+		endpoint:                 "endpoint",
+		cloud:                    mockCloud,
+		mounter:                  mockMounter,
+		gidAllocator:             NewGidAllocator(),
+		deleteAccessPointRootDir: true,
+		deletionFencing:          fencing,
+	}
+	accessPoint := &cloud.AccessPoint{
+		AccessPointId:      apId,
+		FileSystemId:       fsId,
+		AccessPointRootDir: "/pvc-1234",
+	}
+
+	ctx := context.Background()
+	var tagged map[string]string
+	mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), gomock.Eq(apId)).Return(accessPoint, nil)
+	mockCloud.EXPECT().DescribeMountTargets(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, cloud.ErrNotFound).AnyTimes()
+	mockCloud.EXPECT().TagResource(gomock.Eq(ctx), gomock.Eq(apId), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, tags map[string]string) error {
+			tagged = tags
+			return nil
+		})
+	gomock.InOrder(
+		mockCloud.EXPECT().DescribeTags(gomock.Eq(ctx), gomock.Eq(apId)).DoAndReturn(
+			func(_ context.Context, _ string) (map[string]string, error) {
+				return tagged, nil
+			}),
+		mockCloud.EXPECT().DescribeTags(gomock.Any(), gomock.Eq(apId)).Return(map[string]string{cloud.DeletionTokenTagKey: "controller-0-5678"}, nil),
+	)
+	mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil)
+	mockMounter.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockMounter.EXPECT().Unmount(gomock.Any()).Return(nil)
+
+	_, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: fsId + "::" + apId})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("Expected the deletion to be aborted, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// DirectoryCollisionPolicyWarn logs the storage classes whose volumes would use the same directory
+	DirectoryCollisionPolicyWarn = "warn"
+	// DirectoryCollisionPolicyFail also fails CreateVolume with FailedPrecondition
+	DirectoryCollisionPolicyFail = "fail"
+)
+
+var errDirectoryCollision = errors.New("directory collision")
+
+// directoryCollisionCheck detects the other storage classes of the driver on the same file system whose
+// volume would use the same root directory for the same claim, e.g. two environments sharing a file
+// system with the same basePath and a subPathPattern of the claim name without ensureUniqueDirectory.
+// Only the directories that are not unique per volume are checked, as the default directory is named
+// after the persistent volume. A nil directoryCollisionCheck is valid and detects nothing.
+type directoryCollisionCheck struct {
+	policy    string
+	k8sClient cloud.KubernetesAPIClient
+	// aliases resolves the file system aliases of the storage classes
+	aliases *fileSystemAliases
+}
+
+// newDirectoryCollisionCheck returns the check of the policy, or nil if the policy is empty
+func newDirectoryCollisionCheck(policy string, k8sClient cloud.KubernetesAPIClient) (*directoryCollisionCheck, error) {
+	switch policy {
+	case "":
+		return nil, nil
+	case DirectoryCollisionPolicyWarn, DirectoryCollisionPolicyFail:
+		return &directoryCollisionCheck{policy: policy, k8sClient: k8sClient}, nil
+	default:
+		return nil, fmt.Errorf("invalid directory collision policy %q, must be one of %s or %s", policy, DirectoryCollisionPolicyWarn, DirectoryCollisionPolicyFail)
+	}
+}
+
+// check returns an error wrapping errDirectoryCollision if the policy is DirectoryCollisionPolicyFail and
+// another storage class would use the root directory of the volume parameters for the same claim. With
+// DirectoryCollisionPolicyWarn, collisions and failures to detect them are only logged.
+func (c *directoryCollisionCheck) check(ctx context.Context, volumeParams map[string]string, fileSystemId string) error {
+	if c == nil {
+		return nil
+	}
+	if volumeParams[PvcName] == "" || volumeParams[PvcNamespace] == "" {
+		klog.V(4).Infof("Not checking directory collisions without the claim of the volume")
+		return nil
+	}
+	collision, err := c.findCollision(ctx, volumeParams, fileSystemId)
+	if err != nil {
+		if c.policy == DirectoryCollisionPolicyFail {
+			return err
+		}
+		klog.Warningf("Failed to check directory collisions: %v", err)
+		return nil
+	}
+	if collision == "" {
+		return nil
+	}
+	if c.policy == DirectoryCollisionPolicyFail {
+		return fmt.Errorf("%w: %s", errDirectoryCollision, collision)
+	}
+	klog.Warningf("Directory collision: %s", collision)
+	return nil
+}
+
+// findCollision returns the description of the first collision found, or an empty string
+func (c *directoryCollisionCheck) findCollision(ctx context.Context, volumeParams map[string]string, fileSystemId string) (string, error) {
+	patternContext := &subPathPatternContext{
+		ctx:          ctx,
+		volumeParams: volumeParams,
+		k8sClient:    c.k8sClient,
+	}
+	rootDir, shared, err := sharedRootDir(volumeParams, patternContext)
+	if err != nil || !shared {
+		return "", err
+	}
+	pvc, err := patternContext.getPvc()
+	if err != nil {
+		return "", err
+	}
+	storageClassName := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClassName = *pvc.Spec.StorageClassName
+	}
+
+	clientset, err := c.k8sClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list storage classes: %v", err)
+	}
+	for _, sc := range scs.Items {
+		if sc.Provisioner != driverName || sc.Name == storageClassName {
+			continue
+		}
+		scFileSystemId, err := c.aliases.storageClassFileSystemId(sc.Parameters)
+		if err != nil || scFileSystemId != fileSystemId {
+			continue
+		}
+		scRootDir, scShared, err := sharedRootDir(sc.Parameters, patternContext)
+		if err != nil {
+			klog.V(4).Infof("Not checking the directory of storage class %s: %v", sc.Name, err)
+			continue
+		}
+		if scShared && scRootDir == rootDir {
+			return fmt.Sprintf("directory %s of file system %s for claim %s/%s of storage class %s would also be used by storage class %s",
+				rootDir, fileSystemId, pvc.Namespace, pvc.Name, storageClassName, sc.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// sharedRootDir returns the root directory the storage class of the parameters would use for the claim of
+// the context, and whether it may be used by several volumes. Directories named after the persistent
+// volume or suffixed with a UUID by ensureUniqueDirectory are unique, as are the directories of the volumes
+// of a shared access point, which are named after the persistent volume within the directory of the namespace.
+func sharedRootDir(parameters map[string]string, patternContext *subPathPatternContext) (string, bool, error) {
+	pattern, ok := parameters[SubPathPattern]
+	if !ok || parameters[ProvisioningMode] == SharedAccessPointMode {
+		return "", false, nil
+	}
+	if ensureUniqueDirectory, err := strconv.ParseBool(parameters[EnsureUniqueDirectory]); err != nil || ensureUniqueDirectory {
+		return "", false, nil
+	}
+	rootDirName, err := interpolateRootDirectoryName(pattern, patternContext)
+	if err != nil {
+		return "", false, err
+	}
+	return path.Join("/", parameters[BasePath], rootDirName), true, nil
+}
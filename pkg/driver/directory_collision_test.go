@@ -0,0 +1,141 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewDirectoryCollisionCheck(t *testing.T) {
+	if c, err := newDirectoryCollisionCheck("", nil); c != nil || err != nil {
+		t.Fatalf("Expected no check, got %v: %v", c, err)
+	}
+	if _, err := newDirectoryCollisionCheck("block", nil); err == nil {
+		t.Fatal("Expected an invalid policy to be rejected")
+	}
+	var nilCheck *directoryCollisionCheck
+	if err := nilCheck.check(context.Background(), map[string]string{}, "fs-abcd1234"); err != nil {
+		t.Fatalf("Expected a nil check to detect nothing, got %v", err)
+	}
+}
+
+func TestDirectoryCollisionCheck(t *testing.T) {
+	newStorageClass := func(name string, parameters map[string]string) *storagev1.StorageClass {
+		return &storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: name},
+			Provisioner: driverName,
+			Parameters:  parameters,
+		}
+	}
+	staging := map[string]string{
+		FsId:                  "fs-abcd1234",
+		BasePath:              "/envs",
+		SubPathPattern:        "${.PVC.namespace}/${.PVC.name}",
+		EnsureUniqueDirectory: "false",
+	}
+	volumeParams := map[string]string{PvcName: "data", PvcNamespace: "team-a"}
+	for k, v := range staging {
+		volumeParams[k] = v
+	}
+
+	testCases := []struct {
+		name         string
+		policy       string
+		volumeParams map[string]string
+		other        map[string]string
+		expectErr    bool
+	}{
+		{
+			name:         "same directory fails",
+			policy:       DirectoryCollisionPolicyFail,
+			volumeParams: volumeParams,
+			other:        map[string]string{FsId: "arn:aws:elasticfilesystem:us-east-1:123456789012:file-system/fs-abcd1234", BasePath: "envs/", SubPathPattern: "${.PVC.namespace}/${.PVC.name}", EnsureUniqueDirectory: "false"},
+			expectErr:    true,
+		},
+		{
+			name:         "same directory warns",
+			policy:       DirectoryCollisionPolicyWarn,
+			volumeParams: volumeParams,
+			other:        map[string]string{FsId: "fs-abcd1234", BasePath: "/envs", SubPathPattern: "${.PVC.namespace}/${.PVC.name}", EnsureUniqueDirectory: "false"},
+		},
+		{
+			name:         "other base path",
+			policy:       DirectoryCollisionPolicyFail,
+			volumeParams: volumeParams,
+			other:        map[string]string{FsId: "fs-abcd1234", BasePath: "/prod", SubPathPattern: "${.PVC.namespace}/${.PVC.name}", EnsureUniqueDirectory: "false"},
+		},
+		{
+			name:         "other file system",
+			policy:       DirectoryCollisionPolicyFail,
+			volumeParams: volumeParams,
+			other:        map[string]string{FsId: "fs-efgh5678", BasePath: "/envs", SubPathPattern: "${.PVC.namespace}/${.PVC.name}", EnsureUniqueDirectory: "false"},
+		},
+		{
+			name:         "other storage class with unique directories",
+			policy:       DirectoryCollisionPolicyFail,
+			volumeParams: volumeParams,
+			other:        map[string]string{FsId: "fs-abcd1234", BasePath: "/envs", SubPathPattern: "${.PVC.namespace}/${.PVC.name}"},
+		},
+		{
+			name:         "unique directory of the volume",
+			policy:       DirectoryCollisionPolicyFail,
+			volumeParams: map[string]string{PvcName: "data", PvcNamespace: "team-a", FsId: "fs-abcd1234", BasePath: "/envs", SubPathPattern: "${.PVC.namespace}/${.PVC.name}", EnsureUniqueDirectory: "true"},
+			other:        map[string]string{FsId: "fs-abcd1234", BasePath: "/envs", SubPathPattern: "${.PVC.namespace}/${.PVC.name}", EnsureUniqueDirectory: "false"},
+		},
+		{
+			name:         "same pattern of another variable",
+			policy:       DirectoryCollisionPolicyFail,
+			volumeParams: volumeParams,
+			other:        map[string]string{FsId: "fs-abcd1234", BasePath: "/envs/team-a", SubPathPattern: "${.PVC.name}", EnsureUniqueDirectory: "false"},
+			expectErr:    true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storageClassName := "staging"
+			clientset := fake.NewSimpleClientset(
+				&corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data"},
+					Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClassName},
+				},
+				newStorageClass("staging", staging),
+				newStorageClass("production", tc.other),
+			)
+			check, err := newDirectoryCollisionCheck(tc.policy, func() (kubernetes.Interface, error) {
+				return clientset, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = check.check(context.Background(), tc.volumeParams, "fs-abcd1234")
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if err != nil && !errors.Is(err, errDirectoryCollision) {
+				t.Fatalf("Expected a directory collision, got %v", err)
+			}
+		})
+	}
+}
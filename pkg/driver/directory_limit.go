@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// directoryLimitBatch is the number of entries listed at once when counting the directories of a base path
+const directoryLimitBatch = 256
+
+// errDirectoryLimitReached is returned when the base path already has the maximum number of directories
+var errDirectoryLimitReached = errors.New("maximum number of directories reached")
+
+// checkDirectoryLimit returns errDirectoryLimitReached if the parent directory already has maxDirs directories
+// or more, unless one of them is the directory of the name, created by a previous attempt of the volume. The
+// listing stops once maxDirs directories are found, so that its cost is bounded by the limit rather than by
+// the size of the parent. A maxDirs of 0 means no limit, and a missing parent has no directories.
+func checkDirectoryLimit(parent, name string, maxDirs int) error {
+	if maxDirs <= 0 {
+		return nil
+	}
+	if info, err := os.Stat(filepath.Join(parent, name)); err == nil && info.IsDir() {
+		return nil
+	}
+	f, err := os.Open(parent)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	count := 0
+	for {
+		entries, err := f.ReadDir(directoryLimitBatch)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if count++; count >= maxDirs {
+				return fmt.Errorf("%w: %s has %d directories or more", errDirectoryLimitReached, parent, maxDirs)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDirectoryLimit(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dirs        []string
+		files       []string
+		volName     string
+		maxDirs     int
+		expectLimit bool
+	}{
+		{
+			name:    "Success: below the limit",
+			dirs:    []string{"pvc-1"},
+			volName: "pvc-2",
+			maxDirs: 2,
+		},
+		{
+			name:        "Fail: limit reached",
+			dirs:        []string{"pvc-1", "pvc-2"},
+			volName:     "pvc-3",
+			maxDirs:     2,
+			expectLimit: true,
+		},
+		{
+			name:    "Success: directory of the volume exists already",
+			dirs:    []string{"pvc-1", "pvc-2"},
+			volName: "pvc-2",
+			maxDirs: 2,
+		},
+		{
+			name:    "Success: files are not counted",
+			dirs:    []string{"pvc-1"},
+			files:   []string{"README", "notes"},
+			volName: "pvc-2",
+			maxDirs: 2,
+		},
+		{
+			name:    "Success: no limit",
+			dirs:    []string{"pvc-1", "pvc-2"},
+			volName: "pvc-3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := t.TempDir()
+			for _, dir := range tc.dirs {
+				if err := os.Mkdir(filepath.Join(parent, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, file := range tc.files {
+				if err := os.WriteFile(filepath.Join(parent, file), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := checkDirectoryLimit(parent, tc.volName, tc.maxDirs)
+			if tc.expectLimit != errors.Is(err, errDirectoryLimitReached) {
+				t.Fatalf("Expected limit reached %v, got %v", tc.expectLimit, err)
+			}
+			if !tc.expectLimit && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	if err := checkDirectoryLimit(filepath.Join(t.TempDir(), "missing"), "pvc-1", 1); err != nil {
+		t.Fatalf("Expected a missing base path to have no directories, got %v", err)
+	}
+}
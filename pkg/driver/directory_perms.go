@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// DirectoryPermsPolicy bounds the directoryPerms storage class parameter of dynamically provisioned volumes.
+type DirectoryPermsPolicy struct {
+	// Min holds the permission bits that directoryPerms must grant
+	Min os.FileMode
+	// Max holds the permission bits that directoryPerms may grant
+	Max os.FileMode
+}
+
+// ParseDirectoryPermsPolicy parses the octal min and max permission bits of the policy.
+// An empty min requires no bits and an empty max allows all of them. It returns nil,
+// meaning no policy is enforced, if both are empty.
+func ParseDirectoryPermsPolicy(min, max string) (*DirectoryPermsPolicy, error) {
+	if min == "" && max == "" {
+		return nil, nil
+	}
+
+	policy := &DirectoryPermsPolicy{Min: 0, Max: os.ModePerm}
+	var err error
+	if min != "" {
+		if policy.Min, err = parseDirectoryPerms(min); err != nil {
+			return nil, fmt.Errorf("invalid min directory perms: %v", err)
+		}
+	}
+	if max != "" {
+		if policy.Max, err = parseDirectoryPerms(max); err != nil {
+			return nil, fmt.Errorf("invalid max directory perms: %v", err)
+		}
+	}
+	if policy.Min&^policy.Max != 0 {
+		return nil, fmt.Errorf("min directory perms %#o grant bits outside of max directory perms %#o", policy.Min, policy.Max)
+	}
+	return policy, nil
+}
+
+// validate returns an error describing the policy if the directoryPerms are out of its bounds
+func (p *DirectoryPermsPolicy) validate(directoryPerms string) error {
+	if directoryPerms == "" {
+		return fmt.Errorf("%v must be set, the driver only allows permissions between %#o and %#o", DirectoryPerms, p.Min, p.Max)
+	}
+	perms, err := parseDirectoryPerms(directoryPerms)
+	if err != nil {
+		return fmt.Errorf("Failed to parse invalid %v: %v", DirectoryPerms, err)
+	}
+	if perms&p.Min != p.Min || perms&^p.Max != 0 {
+		return fmt.Errorf("%v %#o violates the directory permissions policy of the driver: it must grant at least %#o and at most %#o", DirectoryPerms, perms, p.Min, p.Max)
+	}
+	return nil
+}
+
+func parseDirectoryPerms(value string) (os.FileMode, error) {
+	perms, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if perms&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("%s is not a permission mode between 0 and 0777", value)
+	}
+	return os.FileMode(perms), nil
+}
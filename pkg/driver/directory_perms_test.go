@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+)
+
+func TestParseDirectoryPermsPolicy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		min         string
+		max         string
+		expected    *DirectoryPermsPolicy
+		expectError bool
+	}{
+		{
+			name: "success: no policy",
+		},
+		{
+			name:     "success: max only",
+			max:      "775",
+			expected: &DirectoryPermsPolicy{Min: 0, Max: 0775},
+		},
+		{
+			name:     "success: min only",
+			min:      "0700",
+			expected: &DirectoryPermsPolicy{Min: 0700, Max: 0777},
+		},
+		{
+			name:        "fail: invalid octal value",
+			max:         "789",
+			expectError: true,
+		},
+		{
+			name:        "fail: not a permission mode",
+			max:         "1777",
+			expectError: true,
+		},
+		{
+			name:        "fail: min grants bits outside of max",
+			min:         "770",
+			max:         "755",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := ParseDirectoryPermsPolicy(tc.min, tc.max)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (policy == nil) != (tc.expected == nil) || (policy != nil && *policy != *tc.expected) {
+				t.Fatalf("Expected policy %+v, got %+v", tc.expected, policy)
+			}
+		})
+	}
+}
+
+func TestDirectoryPermsPolicyValidate(t *testing.T) {
+	policy := &DirectoryPermsPolicy{Min: 0700, Max: 0775}
+	testCases := []struct {
+		name           string
+		directoryPerms string
+		expectError    bool
+	}{
+		{
+			name:           "success: within bounds",
+			directoryPerms: "750",
+		},
+		{
+			name:           "success: max",
+			directoryPerms: "775",
+		},
+		{
+			name:           "fail: grants more than max",
+			directoryPerms: "777",
+			expectError:    true,
+		},
+		{
+			name:           "fail: grants less than min",
+			directoryPerms: "500",
+			expectError:    true,
+		},
+		{
+			name:           "fail: missing",
+			directoryPerms: "",
+			expectError:    true,
+		},
+		{
+			name:           "fail: invalid",
+			directoryPerms: "rwx",
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.validate(tc.directoryPerms)
+			if tc.expectError != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// dnsNameSuffixes are the DNS name suffixes of the EFS mount targets of the partitions, by region prefix,
+// as in the efs-utils configuration. The other regions use amazonaws.com.
+var dnsNameSuffixes = []struct {
+	regionPrefix string
+	suffix       string
+}{
+	{"cn-", "amazonaws.com.cn"},
+	{"us-isob-", "sc2s.sgov.gov"},
+	{"us-isof-", "csp.hci.ic.gov"},
+	{"us-iso-", "c2s.ic.gov"},
+	{"eu-isoe-", "cloud.adc-e.uk"},
+}
+
+// dnsResolver resolves the DNS names of the file systems with the configured nameservers instead of those
+// of the resolv.conf of the node, e.g. the inbound endpoints of a Route 53 Resolver in hybrid networks where
+// the node cannot resolve the EFS names. NodePublishVolume passes the address found as mount target IP, so
+// that efs-utils does not resolve the name itself. A nil dnsResolver is valid and never resolves anything.
+type dnsResolver struct {
+	nameservers []string
+	timeout     time.Duration
+	lookupHost  func(ctx context.Context, host string) ([]string, error)
+	next        uint32
+}
+
+// newDNSResolver returns the resolver of the comma separated nameservers, as IP addresses with an optional
+// port, or nil if there are none
+func newDNSResolver(nameservers string, timeout time.Duration) (*dnsResolver, error) {
+	r := &dnsResolver{timeout: timeout}
+	for _, nameserver := range strings.Split(nameservers, ",") {
+		nameserver = strings.TrimSpace(nameserver)
+		if nameserver == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(nameserver)
+		if err != nil {
+			host, port = strings.Trim(nameserver, "[]"), "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid DNS nameserver %q, must be an IP address with an optional port", nameserver)
+		}
+		r.nameservers = append(r.nameservers, net.JoinHostPort(host, port))
+	}
+	if len(r.nameservers) == 0 {
+		return nil, nil
+	}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		// The nameservers are tried in turn, whatever the address the resolver was going to dial
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			nameserver := r.nameservers[int(atomic.AddUint32(&r.next, 1))%len(r.nameservers)]
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, network, nameserver)
+		},
+	}
+	r.lookupHost = resolver.LookupHost
+	return r, nil
+}
+
+// systemDNSResolver resolves the DNS names with the nameservers of the node, for the volumes whose DNS name
+// suffix efs-utils cannot derive from their region
+var systemDNSResolver = &dnsResolver{lookupHost: net.DefaultResolver.LookupHost}
+
+// resolve returns an address of the family of the file system in the region, preferring the DNS name of its
+// mount target in the availability zone if any
+func (r *dnsResolver) resolve(ctx context.Context, fileSystemId, region, az string, family ipFamily) (string, bool) {
+	return r.resolveWithSuffix(ctx, fileSystemId, region, dnsNameSuffix(region), az, family)
+}
+
+// resolveWithSuffix resolves the file system as resolve does, with the DNS name suffix instead of the one
+// of the region
+func (r *dnsResolver) resolveWithSuffix(ctx context.Context, fileSystemId, region, suffix, az string, family ipFamily) (string, bool) {
+	if r == nil || region == "" {
+		return "", false
+	}
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	name := fmt.Sprintf("%s.efs.%s.%s", fileSystemId, region, suffix)
+	names := []string{name}
+	if az != "" {
+		names = []string{az + "." + name, name}
+	}
+	var errs []string
+	for _, name := range names {
+		addrs, err := r.lookupHost(ctx, name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if addr, ok := family.pick(addrs); ok {
+			klog.V(4).Infof("Resolved %s to %s with nameservers %v", name, addr, r.nameservers)
+			return addr, true
+		}
+		errs = append(errs, fmt.Sprintf("no %s address for %s", family, name))
+	}
+	klog.Warningf("Failed to resolve file system %s with nameservers %v: %s", fileSystemId, r.nameservers, strings.Join(errs, "; "))
+	return "", false
+}
+
+// dnsNameSuffix returns the DNS name suffix of the EFS mount targets of the region
+func dnsNameSuffix(region string) string {
+	for _, s := range dnsNameSuffixes {
+		if strings.HasPrefix(region, s.regionPrefix) {
+			return s.suffix
+		}
+	}
+	return "amazonaws.com"
+}
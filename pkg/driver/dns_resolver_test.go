@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewDNSResolver(t *testing.T) {
+	if r, err := newDNSResolver(" ", time.Second); r != nil || err != nil {
+		t.Fatalf("Expected no resolver, got %v: %v", r, err)
+	}
+	r, err := newDNSResolver("10.0.0.2, 10.0.1.2:5353,[fd00::2]", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"10.0.0.2:53", "10.0.1.2:5353", "[fd00::2]:53"}
+	if !reflect.DeepEqual(r.nameservers, expected) {
+		t.Fatalf("Expected nameservers %v, got %v", expected, r.nameservers)
+	}
+	if _, err := newDNSResolver("resolver.corp.example.com", time.Second); err == nil {
+		t.Fatal("Expected a nameserver that is not an IP address to be rejected")
+	}
+}
+
+func TestDNSResolverResolve(t *testing.T) {
+	testCases := []struct {
+		name     string
+		region   string
+		az       string
+		records  map[string][]string
+		expected string
+	}{
+		{
+			name:   "mount target of the availability zone",
+			region: "us-east-1",
+			az:     "us-east-1a",
+			records: map[string][]string{
+				"us-east-1a.fs-abcd1234.efs.us-east-1.amazonaws.com": {"10.0.0.10"},
+				"fs-abcd1234.efs.us-east-1.amazonaws.com":            {"10.0.1.10"},
+			},
+			expected: "10.0.0.10",
+		},
+		{
+			name:   "file system name without mount target in the availability zone",
+			region: "cn-north-1",
+			az:     "cn-north-1a",
+			records: map[string][]string{
+				"fs-abcd1234.efs.cn-north-1.amazonaws.com.cn": {"fd00::10", "10.0.1.10"},
+			},
+			expected: "10.0.1.10",
+		},
+		{
+			name:   "IPv6 only",
+			region: "us-east-1",
+			records: map[string][]string{
+				"fs-abcd1234.efs.us-east-1.amazonaws.com": {"fd00::10"},
+			},
+		},
+		{
+			name:   "unknown region",
+			region: "",
+			records: map[string][]string{
+				"fs-abcd1234.efs..amazonaws.com": {"10.0.1.10"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &dnsResolver{
+				nameservers: []string{"10.0.0.2:53"},
+				timeout:     time.Second,
+				lookupHost: func(_ context.Context, host string) ([]string, error) {
+					if addrs, ok := tc.records[host]; ok {
+						return addrs, nil
+					}
+					return nil, errors.New("no such host")
+				},
+			}
+			addr, ok := r.resolve(context.Background(), "fs-abcd1234", tc.region, tc.az, ipFamilyIPv4)
+			if ok != (tc.expected != "") || addr != tc.expected {
+				t.Fatalf("Expected address %q, got %q", tc.expected, addr)
+			}
+		})
+	}
+
+	var nilResolver *dnsResolver
+	if _, ok := nilResolver.resolve(context.Background(), "fs-abcd1234", "us-east-1", "", ipFamilyIPv4); ok {
+		t.Fatal("Expected a nil resolver to resolve nothing")
+	}
+}
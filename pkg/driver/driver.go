@@ -18,12 +18,17 @@ package driver
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/informers"
 	"k8s.io/klog/v2"
 
 	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
@@ -35,9 +40,14 @@ const (
 
 	// AgentNotReadyTaintKey contains the key of taints to be removed on driver startup
 	AgentNotReadyNodeTaintKey = "efs.csi.aws.com/agent-not-ready"
+
+	// sharedInformersResync is the resync period of the informers shared by the controller, which are only
+	// read through their listers
+	sharedInformersResync = 0
 )
 
 type Driver struct {
+	mode                     Mode
 	endpoint                 string
 	nodeID                   string
 	srv                      *grpc.Server
@@ -52,35 +62,372 @@ type Driver struct {
 	gidAllocator             GidAllocator
 	deleteAccessPointRootDir bool
 	tags                     map[string]string
+	posixIdentityWebhook     PosixIdentityWebhook
+	metricsAddress           string
+	mountStats               *mountStatsRecorder
+	mountStatsInterval       time.Duration
+	cloudOptions             cloud.Options
+	directoryPermsPolicy     *DirectoryPermsPolicy
+	pendingAccessPointTTL    time.Duration
+	mountTargetCache         *mountTargetCache
+	mountTargetCacheInterval time.Duration
+	progressEventThreshold   time.Duration
+	subPathPatternLimits     *SubPathPatternLimits
+	attachments              *attachmentTracker
+	fsIdentityCheck          *fileSystemIdentityCheck
+	provisioningPolicies     *provisioningPolicies
+	efsAPIDenied             atomic.Bool
+	controllerLoops          sync.Once
+	secretsResolver          *secretsResolver
+	mountPropagation         *mountPropagationCheck
+	deleteParentDirsMaxDepth int
+	apiClients               *apiClients
+	versionedEndpoint        string
+	statusAddress            string
+	mountHelperFeatureGate   *mountHelperFeatureGate
+	mountHelperPath          string
+	accessPointSource        bool
+	configDir                *configDirReconciler
+	deleteAudit              *deleteAuditor
+	warmupTimeout            time.Duration
+	warming                  atomic.Bool
+	mountOptionRules         *mountOptionRules
+	accessPointInventory     *accessPointInventory
+	kubeletDir               string
+	gidRangeAuditor          *gidRangeAuditor
+	directoryCollisionCheck  *directoryCollisionCheck
+	allowUnenforcedIdentity  bool
+	provisioningBatch        *provisioningBatcher
+	strictParameters         bool
+	sharedMounts             *sharedMounts
+	subPathStaging           *sharedMounts
+	dnsResolver              *dnsResolver
+	mountScheduler           *mountScheduler
+	volumeMountCommand       bool
+	fileSystemAliases        *fileSystemAliases
+	adminSocket              string
+	maintenanceAccessPoints  map[string]string
+	sharedAccessPointLocks   keyedLocks
+	clusterId                string
+	strictAPOwnership        bool
+	volumePrewarm            *volumePrewarm
+	provisioningDetails      bool
+	volumeHandleV2           bool
+	orphanedDirReporter      *orphanedDirectoryReporter
+	crossAccountRoles        *crossAccountRoles
+	busyUnmount              *busyUnmount
+	deletionFencing          *deletionFencing
+	mountDiagnostics         *mountDiagnostics
+	nodeState                *nodeState
+	publishedOptions         *publishedOptionsCheck
+	volumeLabeler            *volumeLabeler
+	secureMountOptions       *secureMountOptions
+	fileSystemIdentities     *fileSystemIdentities
+	unwatchedMounts          *unwatchedMounts
+	snapshots                *backupSnapshots
+	quotaEnforcer            *quotaEnforcer
+	burstCredits             *burstCreditCheck
+	informerFactory          informers.SharedInformerFactory
 }
 
-func NewDriver(endpoint, efsUtilsCfgPath, efsUtilsStaticFilesPath, tags string, volMetricsOptIn bool, volMetricsRefreshPeriod float64, volMetricsFsRateLimit int, deleteAccessPointRootDir bool) *Driver {
-	cloud, err := cloud.NewCloud()
+// NewDriver returns the driver of the configuration, which must have been validated by Config.Validate
+func NewDriver(cfg *Config) *Driver {
+	cloudOptions, err := cfg.cloudOptions()
+	if err != nil {
+		klog.Fatalln(err)
+	}
+	directoryPermsPolicy, err := ParseDirectoryPermsPolicy(cfg.MinDirectoryPerms, cfg.MaxDirectoryPerms)
+	if err != nil {
+		klog.Fatalln(err)
+	}
+	subPathPatternLimits, err := NewSubPathPatternLimits(cfg.SubPathPatternMaxDepth, cfg.SubPathPatternMaxLength)
+	if err != nil {
+		klog.Fatalln(err)
+	}
+	mtCache, err := newMountTargetCache(cfg.MountTargetCacheConfigMap, cloud.DefaultKubernetesAPIClient)
+	if err != nil {
+		klog.Fatalln(err)
+	}
+
+	fsIdentityCheck, err := newFileSystemIdentityCheck(cfg.FileSystemIdentityCheck)
+	if err != nil {
+		klog.Fatalln(err)
+	}
+
+	var mountPropagation *mountPropagationCheck
+	var shared, subPathStaging *sharedMounts
+	var resolver *dnsResolver
+	if cfg.Mode.servesNode() {
+		mountPropagation, err = newMountPropagationCheck(cfg.MountPropagationCheck, cfg.KubeletDir)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		if cfg.SharedVolumeMounts {
+			shared = newSharedMounts(cfg.KubeletDir)
+		}
+		subPathStaging = newSubPathStaging(cfg.KubeletDir)
+		resolver, err = newDNSResolver(cfg.DNSNameservers, cfg.DNSTimeout.Duration)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+	}
+
+	var policies *provisioningPolicies
+	var secrets *secretsResolver
+	var clients *apiClients
+	var featureGate *mountHelperFeatureGate
+	var fsAliases *fileSystemAliases
+	var maintenanceAPs map[string]string
+	var deleteAudit *deleteAuditor
+	var inventory *accessPointInventory
+	var gidRangeAudit *gidRangeAuditor
+	var orphanedDirReporter *orphanedDirectoryReporter
+	var collisionCheck *directoryCollisionCheck
+	var fencing *deletionFencing
+	var labeler *volumeLabeler
+	var fsIdentities *fileSystemIdentities
+	var snapshots *backupSnapshots
+	var burstCredits *burstCreditCheck
+	var informerFactory informers.SharedInformerFactory
+	var volumeHandleV2 bool
+	if cfg.Mode.servesController() {
+		// The features reading the objects of the cluster on every call share the informers watching them
+		if cfg.MountHelperFeatureGating || cfg.DeleteAuditSink != "" {
+			clientset, err := cloud.DefaultKubernetesAPIClient()
+			if err != nil {
+				klog.Fatalln(err)
+			}
+			informerFactory = informers.NewSharedInformerFactory(clientset, sharedInformersResync)
+		}
+		policies, err = newProvisioningPolicies(cfg.ProvisioningPolicies, DynamicKubernetesAPIClient)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		secretsManager, err := cloud.NewSecretsManager(cloudOptions)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		secrets = newSecretsResolver(secretsManager, cfg.SecretsCacheTTL.Duration)
+		if cfg.SnapshotBackupVault != "" {
+			backup, err := cloud.NewBackup(cloudOptions)
+			if err != nil {
+				klog.Fatalln(err)
+			}
+			snapshots = newBackupSnapshots(backup, cfg.SnapshotBackupVault, cfg.SnapshotBackupRoleArn, cfg.SnapshotSubpathVolumes)
+		}
+		if cfg.BurstCreditCheck != "" {
+			cloudWatch, err := cloud.NewCloudWatch(cloudOptions)
+			if err != nil {
+				klog.Fatalln(err)
+			}
+			burstCredits, err = newBurstCreditCheck(cfg.BurstCreditCheck, cfg.BurstCreditMinBalance, cloudWatch, cloud.DefaultKubernetesAPIClient)
+			if err != nil {
+				klog.Fatalln(err)
+			}
+		}
+		clients = newAPIClients()
+		featureGate = newMountHelperFeatureGate(cfg.MountHelperFeatureGating, informerFactory)
+		fsAliases, err = newFileSystemAliases(cfg.FileSystemAliasesConfigMap, cloud.DefaultKubernetesAPIClient)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		deleteAudit, err = newDeleteAuditor(cfg.DeleteAuditSink, informerFactory)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		inventory, err = newAccessPointInventory(cfg.AccessPointInventoryInterval.Duration, DynamicKubernetesAPIClient, cloud.DefaultKubernetesAPIClient)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		gidRangeAudit = newGidRangeAuditor(cfg.GidRangeAuditInterval.Duration, cloud.DefaultKubernetesAPIClient)
+		orphanedDirReporter = newOrphanedDirectoryReporter(cfg.OrphanedDirectoryReportInterval.Duration, cfg.DeleteOrphanedDirectories, cloud.DefaultKubernetesAPIClient)
+		collisionCheck, err = newDirectoryCollisionCheck(cfg.DirectoryCollisionPolicy, cloud.DefaultKubernetesAPIClient)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		if collisionCheck != nil {
+			collisionCheck.aliases = fsAliases
+		}
+		if gidRangeAudit != nil {
+			gidRangeAudit.aliases = fsAliases
+		}
+		if mtCache != nil {
+			mtCache.aliases = fsAliases
+		}
+		maintenanceAPs, err = parseMaintenanceAccessPoints(cfg.MaintenanceAccessPoints)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		volumeHandleV2, err = parseVolumeHandleFormat(cfg.VolumeHandleFormat)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		hostname, _ := os.Hostname()
+		fencing = newDeletionFencing(cfg.DeletionFencingLease.Duration, hostname)
+		labeler = newVolumeLabeler(cfg.VolumeLabelsInterval.Duration, cloud.DefaultKubernetesAPIClient)
+		fsIdentities = newFileSystemIdentities(cfg.DefaultIdentityFromTags)
+	}
+
+	var mountHelperPath string
+	var accessPointSource bool
+	var configDir *configDirReconciler
+	var optionRules *mountOptionRules
+	var prewarm *volumePrewarm
+	var crossAccount *crossAccountRoles
+	var busyUnmounts *busyUnmount
+	var diagnostics *mountDiagnostics
+	var state *nodeState
+	var publishedOptions *publishedOptionsCheck
+	var secureOptions *secureMountOptions
+	var unwatched *unwatchedMounts
+	if cfg.Mode.servesNode() {
+		if cfg.MountHelperFeatureGating {
+			mountHelperPath = DefaultMountHelperPath
+		}
+		if cfg.AccessPointMountSource {
+			accessPointSource = detectAccessPointSource(DefaultMountHelperPath)
+		}
+		if err := setEfsUtilsEnv(cfg); err != nil {
+			klog.Fatalln(err)
+		}
+		configDir = newConfigDirReconciler(cfg.EfsUtilsCfgPath, cfg.ConfigDirReconcileInterval.Duration, func() ([]byte, error) {
+			return renderEfsUtilsConfig(GetVersion().EfsClientSource)
+		})
+		optionRules, err = newMountOptionRules(cfg.MountOptionsConfigMap, os.Getenv("CSI_NODE_NAME"), cloud.DefaultKubernetesAPIClient)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		if cfg.PrewarmVolumes {
+			prewarm = newVolumePrewarm(cfg.KubeletDir, cloud.DefaultKubernetesAPIClient)
+		}
+		if cfg.CrossAccountRoleValidation {
+			roleAssumer, err := cloud.NewRoleAssumer(cloudOptions)
+			if err != nil {
+				klog.Fatalln(err)
+			}
+			crossAccount = newCrossAccountRoles(roleAssumer, cfg.CrossAccountValidationCache)
+		}
+		busyUnmounts = newBusyUnmount(cfg.UnmountBusyTimeout.Duration, cfg.LazyUnmountFallback, os.Getenv("CSI_NODE_NAME"), cloud.DefaultKubernetesAPIClient)
+		diagnostics, err = newMountDiagnostics(cfg.MountFailureDiagnostics, os.Getenv("CSI_NODE_NAME"), cloud.DefaultKubernetesAPIClient)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		state = newNodeState(cfg.NodeStateFile)
+		publishedOptions = newPublishedOptionsCheck(cfg.PublishedOptionsInterval.Duration, os.Getenv("CSI_NODE_NAME"), cloud.DefaultKubernetesAPIClient)
+		secureOptions, err = newSecureMountOptions(cfg.SecureMountOptions, cfg.AllowSecureMountOptOut)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		unwatched = newUnwatchedMounts(efsUtilsStateDir, "/proc")
+	}
+
+	// The controller enforces the quotas, the nodes publish the volumes over quota read-only
+	quota, err := newQuotaEnforcer(cfg.QuotaEnforcement, cfg.QuotaEnforcementInterval.Duration, cloud.DefaultKubernetesAPIClient)
+	if err != nil {
+		klog.Fatalln(err)
+	}
+
+	// The node service only needs the metadata of the instance, not the EFS API
+	newCloud := cloud.NewCloud
+	if !cfg.Mode.servesController() {
+		newCloud = cloud.NewMetadataCloud
+	}
+	cloud, err := newCloud(cloudOptions)
 	if err != nil {
+		reportIMDSv2HopLimit(err)
 		klog.Fatalln(err)
 	}
 
-	nodeCaps := SetNodeCapOptInFeatures(volMetricsOptIn)
-	watchdog := newExecWatchdog(efsUtilsCfgPath, efsUtilsStaticFilesPath, "amazon-efs-mount-watchdog")
+	var attachments *attachmentTracker
+	if cfg.ControllerPublishUnpublish {
+		attachments = newAttachmentTracker(cfg.VolumeAttachLimit, cfg.EnforceSingleNodeWriter)
+	}
+
+	nodeCaps := SetNodeCapOptInFeatures(cfg.VolMetricsOptIn)
+	watchdog := newExecWatchdog(cfg.EfsUtilsCfgPath, cfg.EfsUtilsStaticFilesPath, "amazon-efs-mount-watchdog")
 	return &Driver{
-		endpoint:                 endpoint,
+		mode:                     cfg.Mode,
+		endpoint:                 cfg.Endpoint,
 		nodeID:                   cloud.GetMetadata().GetInstanceID(),
 		mounter:                  newNodeMounter(),
 		efsWatchdog:              watchdog,
 		cloud:                    cloud,
 		nodeCaps:                 nodeCaps,
 		volStatter:               NewVolStatter(),
-		volMetricsOptIn:          volMetricsOptIn,
-		volMetricsRefreshPeriod:  volMetricsRefreshPeriod,
-		volMetricsFsRateLimit:    volMetricsFsRateLimit,
+		volMetricsOptIn:          cfg.VolMetricsOptIn,
+		volMetricsRefreshPeriod:  cfg.VolMetricsRefreshPeriod,
+		volMetricsFsRateLimit:    cfg.VolMetricsFsRateLimit,
 		gidAllocator:             NewGidAllocator(),
-		deleteAccessPointRootDir: deleteAccessPointRootDir,
-		tags:                     parseTagsFromStr(strings.TrimSpace(tags)),
+		deleteAccessPointRootDir: cfg.DeleteAccessPointRootDir,
+		tags:                     parseTagsFromStr(strings.TrimSpace(cfg.Tags)),
+		posixIdentityWebhook:     newPosixIdentityWebhook(cfg.PosixIdentityWebhookUrl),
+		metricsAddress:           cfg.MetricsAddress,
+		mountStats:               newMountStatsRecorder(),
+		mountStatsInterval:       cfg.MountStatsInterval.Duration,
+		cloudOptions:             cloudOptions,
+		directoryPermsPolicy:     directoryPermsPolicy,
+		pendingAccessPointTTL:    cfg.PendingAccessPointTTL.Duration,
+		mountTargetCache:         mtCache,
+		mountTargetCacheInterval: cfg.MountTargetCacheInterval.Duration,
+		progressEventThreshold:   cfg.ProgressEventThreshold.Duration,
+		subPathPatternLimits:     subPathPatternLimits,
+		attachments:              attachments,
+		fsIdentityCheck:          fsIdentityCheck,
+		provisioningPolicies:     policies,
+		secretsResolver:          secrets,
+		mountPropagation:         mountPropagation,
+		deleteParentDirsMaxDepth: cfg.DeleteParentDirsMaxDepth,
+		apiClients:               clients,
+		versionedEndpoint:        cfg.VersionedEndpoint,
+		statusAddress:            cfg.StatusAddress,
+		mountHelperFeatureGate:   featureGate,
+		mountHelperPath:          mountHelperPath,
+		accessPointSource:        accessPointSource,
+		configDir:                configDir,
+		deleteAudit:              deleteAudit,
+		warmupTimeout:            cfg.WarmupTimeout.Duration,
+		mountOptionRules:         optionRules,
+		accessPointInventory:     inventory,
+		kubeletDir:               cfg.KubeletDir,
+		gidRangeAuditor:          gidRangeAudit,
+		directoryCollisionCheck:  collisionCheck,
+		allowUnenforcedIdentity:  cfg.AllowUnenforcedIdentity,
+		provisioningBatch:        newProvisioningBatcher(cfg.ProvisioningBatchWindow.Duration, cfg.MaxConcurrentAPCreations),
+		strictParameters:         cfg.StrictParameters,
+		sharedMounts:             shared,
+		subPathStaging:           subPathStaging,
+		dnsResolver:              resolver,
+		mountScheduler:           newMountScheduler(cfg.MaxConcurrentMounts),
+		volumeMountCommand:       cfg.VolumeMountCommand,
+		fileSystemAliases:        fsAliases,
+		adminSocket:              cfg.AdminSocket,
+		maintenanceAccessPoints:  maintenanceAPs,
+		clusterId:                cfg.ClusterId,
+		strictAPOwnership:        cfg.StrictAccessPointOwnership,
+		volumePrewarm:            prewarm,
+		provisioningDetails:      cfg.VolumeProvisioningDetails,
+		volumeHandleV2:           volumeHandleV2,
+		orphanedDirReporter:      orphanedDirReporter,
+		crossAccountRoles:        crossAccount,
+		busyUnmount:              busyUnmounts,
+		deletionFencing:          fencing,
+		mountDiagnostics:         diagnostics,
+		nodeState:                state,
+		publishedOptions:         publishedOptions,
+		volumeLabeler:            labeler,
+		secureMountOptions:       secureOptions,
+		fileSystemIdentities:     fsIdentities,
+		unwatchedMounts:          unwatched,
+		snapshots:                snapshots,
+		quotaEnforcer:            quota,
+		informerFactory:          informerFactory,
+		burstCredits:             burstCredits,
 	}
 }
 
 func SetNodeCapOptInFeatures(volMetricsOptIn bool) []csi.NodeServiceCapability_RPC_Type {
-	var nCaps = []csi.NodeServiceCapability_RPC_Type{}
+	// NodeExpandVolume completes the resizes of the claims, there being nothing to expand on EFS
+	var nCaps = []csi.NodeServiceCapability_RPC_Type{csi.NodeServiceCapability_RPC_EXPAND_VOLUME}
 	if volMetricsOptIn {
 		klog.V(4).Infof("Enabling Node Service capability for Get Volume Stats")
 		nCaps = append(nCaps, csi.NodeServiceCapability_RPC_GET_VOLUME_STATS)
@@ -96,9 +443,34 @@ func (d *Driver) Run() error {
 		return err
 	}
 
-	listener, err := net.Listen(scheme, addr)
-	if err != nil {
-		return err
+	var listener net.Listener
+	if scheme == "unix" {
+		socket, err := listenUnixSocket(addr)
+		if err != nil {
+			return err
+		}
+		listener = socket.listener
+	} else {
+		listener, err = net.Listen(scheme, addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	var versioned []*unixSocket
+	if d.versionedEndpoint != "" {
+		versionedScheme, versionedAddr, err := util.ParseEndpoint(d.versionedEndpoint)
+		if err != nil {
+			return err
+		}
+		if versionedScheme != "unix" {
+			return fmt.Errorf("versioned endpoint %s must be a unix domain socket", d.versionedEndpoint)
+		}
+		socket, err := listenUnixSocket(versionedAddr)
+		if err != nil {
+			return err
+		}
+		versioned = append(versioned, socket)
 	}
 
 	logErr := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -113,31 +485,206 @@ func (d *Driver) Run() error {
 	}
 	d.srv = grpc.NewServer(opts...)
 
+	if d.mode.servesController() {
+		klog.Info("Cleaning up stale temporary mounts")
+		d.cleanupStaleTempMounts(TempMountPathPrefix)
+		accessVerified := d.checkEfsAccess(context.Background(), cloud.DefaultKubernetesAPIClient)
+		if !d.efsAPIDenied.Load() && d.warmupTimeout > 0 {
+			klog.Info("Warming up EFS API clients")
+			d.warmUp(accessVerified, d.warmupTimeout, cloud.DefaultKubernetesAPIClient)
+		}
+	}
+
 	csi.RegisterIdentityServer(d.srv, d)
-	klog.Info("Registering Node Server")
-	csi.RegisterNodeServer(d.srv, d)
-	klog.Info("Registering Controller Server")
-	csi.RegisterControllerServer(d.srv, d)
+	if d.mode.servesNode() {
+		klog.Info("Registering Node Server")
+		csi.RegisterNodeServer(d.srv, d)
+	}
+	if d.mode.servesController() {
+		klog.Info("Registering Controller Server")
+		csi.RegisterControllerServer(d.srv, d)
+	}
 
 	klog.Info("Starting efs-utils watchdog")
 	if err := d.efsWatchdog.start(); err != nil {
 		return err
 	}
 
+	if err := d.configDir.start(make(chan struct{})); err != nil {
+		return err
+	}
+
 	reaper := newReaper()
 	klog.Info("Starting reaper")
 	reaper.start()
 
+	if d.mode.servesNode() && d.nodeState != nil {
+		klog.Info("Restoring node state")
+		if err := d.restoreNodeState(); err != nil {
+			klog.Warningf("Failed to restore node state, starting without it: %v", err)
+		}
+	}
+
+	if d.mode.servesNode() {
+		klog.Info("Checking mount propagation of the kubelet directory")
+		if err := d.mountPropagation.run(); err != nil {
+			return fmt.Errorf("mount propagation check failed: %v", err)
+		}
+	}
+
+	if d.mode.servesNode() && d.volumePrewarm != nil {
+		klog.Info("Prewarming volumes")
+		select {
+		case <-d.prewarmVolumes(context.Background()):
+		case <-time.After(prewarmTimeout):
+			klog.Warningf("Volumes still prewarming after %v, removing the taint of the node", prewarmTimeout)
+		}
+	}
+
 	// Remove taint from node to indicate driver startup success
 	// This is done at the last possible moment to prevent race conditions or false positive removals
-	go tryRemoveNotReadyTaintUntilSucceed(time.Second, func() error {
-		return removeNotReadyTaint(cloud.DefaultKubernetesAPIClient)
-	})
+	if d.mode.servesNode() {
+		go tryRemoveNotReadyTaintUntilSucceed(time.Second, func() error {
+			return removeNotReadyTaint(cloud.DefaultKubernetesAPIClient)
+		})
+	}
+
+	if d.metricsAddress != "" {
+		if d.mode.servesNode() {
+			metricsRegistry.MustRegister(newProxyUsageCollector(efsUtilsStateDir, "/proc"))
+		}
+		startMetricsServer(d.metricsAddress)
+	}
+
+	if d.mode.servesController() && d.statusAddress != "" && d.cloudOptions.APIStatus != nil {
+		startStatusServer(d.statusAddress, d.cloudOptions.APIStatus)
+	}
+
+	if d.mode.servesNode() && d.mountHelperPath != "" {
+		klog.Info("Publishing mount helper features")
+		go publishMountHelperFeaturesUntilSucceed(mountHelperFeaturesPublishInterval, d.mountHelperPath, cloud.DefaultKubernetesAPIClient)
+	}
+
+	if d.adminSocket != "" {
+		if err := d.startAdminServer(d.adminSocket); err != nil {
+			return fmt.Errorf("failed to serve admin socket %s: %v", d.adminSocket, err)
+		}
+	}
+
+	if d.mode.servesNode() && d.mountOptionRules != nil {
+		klog.Info("Watching mount option rules")
+		d.mountOptionRules.run(make(chan struct{}))
+	}
+
+	if d.mode.servesNode() && d.mountTargetCache != nil {
+		klog.Info("Watching mount target cache")
+		if err := d.mountTargetCache.run(make(chan struct{})); err != nil {
+			klog.Warningf("Not using mount target cache: %v", err)
+		}
+	}
+
+	if d.mode.servesNode() && d.mountStatsInterval > 0 {
+		klog.Info("Starting mount stats publisher")
+		go d.mountStats.runMountStatsPublisher(d.mountStatsInterval, cloud.DefaultKubernetesAPIClient, make(chan struct{}))
+	}
+
+	if d.mode.servesNode() && d.publishedOptions != nil {
+		klog.Info("Starting published options check")
+		go d.publishedOptions.run(make(chan struct{}))
+	}
+
+	if d.mode.servesController() && d.informerFactory != nil {
+		klog.Info("Starting shared informers")
+		d.informerFactory.Start(make(chan struct{}))
+	}
+
+	if d.mode.servesController() && d.volumeLabeler != nil {
+		klog.Info("Starting persistent volume labeler")
+		go d.volumeLabeler.run(make(chan struct{}))
+	}
+
+	// The attachments are restored from the Kubernetes API only, regardless of the access to the EFS API
+	if d.mode.servesController() && d.attachments != nil {
+		klog.Info("Restoring volume attachments")
+		go d.attachments.restoreUntilSucceed(attachmentsRestoreRetryInterval, cloud.DefaultKubernetesAPIClient)
+	}
+
+	if d.controllerAvailable() {
+		d.startControllerLoops()
+	}
+	if d.mode.servesController() {
+		go d.recheckEfsAccess(efsAccessCheckInterval, cloud.DefaultKubernetesAPIClient, d.startControllerLoops, make(chan struct{}))
+	}
+
+	if scheme == "unix" {
+		klog.Info("Starting socket watcher")
+		newSocketWatcher(addr, d.srv.Serve).start()
+	}
+
+	for _, socket := range versioned {
+		klog.Infof("Listening for connections on versioned address: %#v", socket.listener.Addr())
+		go func(socket *unixSocket) {
+			if err := d.srv.Serve(socket.listener); err != nil {
+				klog.Errorf("Failed to serve on %s: %v", socket.addr, err)
+			}
+		}(socket)
+	}
+	stopOnTermination(d.srv, versioned)
 
 	klog.Infof("Listening for connections on address: %#v", listener.Addr())
 	return d.srv.Serve(listener)
 }
 
+// startControllerLoops starts the background loops of the controller that use the EFS API, once the access to
+// the EFS API is allowed. They are started at most once.
+func (d *Driver) startControllerLoops() {
+	d.controllerLoops.Do(func() {
+		if d.pendingAccessPointTTL > 0 {
+			klog.Info("Reconciling pending access points")
+			go func() {
+				if err := reconcilePendingAccessPoints(context.Background(), d.cloud, d.clusterId, d.pendingAccessPointTTL); err != nil {
+					klog.Warningf("Failed to reconcile pending access points: %v", err)
+				}
+			}()
+		}
+
+		if d.mountTargetCache != nil && d.mountTargetCacheInterval > 0 {
+			klog.Info("Starting mount target cache refresher")
+			go d.mountTargetCache.runRefresher(d.mountTargetCacheInterval, d.cloud, make(chan struct{}))
+		}
+
+		if d.accessPointInventory != nil {
+			klog.Info("Starting access point inventory")
+			go d.accessPointInventory.run(d.cloud, make(chan struct{}))
+		}
+
+		if d.gidRangeAuditor != nil {
+			klog.Info("Starting GID range auditor")
+			go d.gidRangeAuditor.run(d.storageClassCloud, make(chan struct{}))
+		}
+
+		if d.orphanedDirReporter != nil {
+			klog.Info("Starting orphaned directory reporter")
+			go d.orphanedDirReporter.run(d, make(chan struct{}))
+		}
+
+		if d.quotaEnforcer != nil {
+			klog.Info("Starting quota enforcer")
+			go d.quotaEnforcer.run(d, make(chan struct{}))
+		}
+
+		if d.provisioningPolicies != nil {
+			klog.Info("Watching provisioning policies")
+			go d.provisioningPolicies.run(make(chan struct{}))
+		}
+
+		if d.fileSystemAliases != nil {
+			klog.Info("Watching file system aliases")
+			go d.fileSystemAliases.run(make(chan struct{}))
+		}
+	})
+}
+
 func parseTagsFromStr(tagStr string) map[string]string {
 	defer func() {
 		if r := recover(); r != nil {
@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	efsAccessCheckTimeout = 30 * time.Second
+	// efsAccessCheckInterval is how often the access to the EFS API is checked again, so that a controller
+	// denied at startup recovers once the policies are fixed, and one denied since then stops advertising
+	// the controller service
+	efsAccessCheckInterval = 5 * time.Minute
+)
+
+// checkEfsAccess makes a preflight EFS API call before the controller service is served. If the access
+// is denied, dynamic provisioning is impossible: rather than failing every call, and crash looping if
+// the process exits, the driver keeps serving without advertising the controller service.
+// The call describes a file system of the storage classes of the driver, if any, as the IAM policies may
+// only allow the calls on the file systems of the cluster.
+// Other errors, such as timeouts, are assumed to be transient and do not disable the controller.
+// It returns whether the access was verified.
+func (d *Driver) checkEfsAccess(ctx context.Context, k8sClient cloud.KubernetesAPIClient) bool {
+	ctx, cancel := context.WithTimeout(ctx, efsAccessCheckTimeout)
+	defer cancel()
+	fileSystemId := d.accessCheckFileSystemId(ctx, k8sClient)
+	err := d.cloud.CheckAccess(ctx, fileSystemId)
+	switch err {
+	case nil:
+		klog.Infof("EFS API access verified on file system %q", fileSystemId)
+		d.efsAPIDenied.Store(false)
+	case cloud.ErrDeniedByPolicy:
+		klog.Errorf("The EFS API is denied by a service control policy of the AWS organization. Dynamic provisioning is disabled and the controller service is not advertised. "+
+			"Ask the administrator of the organization to allow the elasticfilesystem actions of the driver for this account, the access is checked again every %v.", efsAccessCheckInterval)
+		d.efsAPIDenied.Store(true)
+	case cloud.ErrAccessDenied:
+		klog.Errorf("The EFS API is denied to the controller. Dynamic provisioning is disabled and the controller service is not advertised. "+
+			"Attach the AmazonEFSCSIDriverPolicy, or an equivalent IAM policy, to the role of the controller service account, the access is checked again every %v.", efsAccessCheckInterval)
+		d.efsAPIDenied.Store(true)
+	default:
+		klog.Warningf("Could not verify EFS API access on file system %q, assuming it is allowed: %v", fileSystemId, err)
+		d.efsAPIDenied.Store(false)
+	}
+	if d.efsAPIDenied.Load() {
+		efsAPIAvailable.Set(0)
+	} else {
+		efsAPIAvailable.Set(1)
+	}
+	return err == nil
+}
+
+// accessCheckFileSystemId returns the ID of the first file system of the storage classes of the driver served
+// by the cloud of the driver, or an empty ID to check the access without file system if there is none
+func (d *Driver) accessCheckFileSystemId(ctx context.Context, k8sClient cloud.KubernetesAPIClient) string {
+	clientset, err := k8sClient()
+	if err != nil {
+		klog.V(4).Infof("Could not list the storage classes to check the EFS API access on their file systems: %v", err)
+		return ""
+	}
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.V(4).Infof("Could not list the storage classes to check the EFS API access on their file systems: %v", err)
+		return ""
+	}
+	for _, sc := range scs.Items {
+		if sc.Provisioner != driverName || sc.Parameters[FsId] == "" {
+			continue
+		}
+		apiConfig, err := storageClassAPIConfig(sc.Parameters, d.fileSystemAliases)
+		if err != nil || !d.isDriverAPIConfig(apiConfig) {
+			continue
+		}
+		fileSystemId, err := d.fileSystemAliases.storageClassFileSystemId(sc.Parameters)
+		if err != nil {
+			continue
+		}
+		return fileSystemId
+	}
+	return ""
+}
+
+// recheckEfsAccess checks the access to the EFS API every interval, and calls onAllowed when it is allowed
+// again after being denied
+func (d *Driver) recheckEfsAccess(interval time.Duration, k8sClient cloud.KubernetesAPIClient, onAllowed func(), stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		denied := d.efsAPIDenied.Load()
+		d.checkEfsAccess(context.Background(), k8sClient)
+		if denied && !d.efsAPIDenied.Load() {
+			klog.Info("EFS API access allowed again, advertising the controller service")
+			onAllowed()
+		}
+	}
+}
+
+// controllerAvailable returns true if the controller service is served and may use the EFS API
+func (d *Driver) controllerAvailable() bool {
+	return d.mode.servesController() && !d.efsAPIDenied.Load()
+}
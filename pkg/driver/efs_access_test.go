@@ -0,0 +1,177 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	cloudmocks "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+// newEfsAccessTestClient returns a client of a cluster with a storage class of the driver on the file system,
+// besides storage classes whose file system is not checked
+func newEfsAccessTestClient(fileSystemId string) cloud.KubernetesAPIClient {
+	clientset := fake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs-alias"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "shared"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs-cross-account"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "fs-efgh5678", APIRoleArn: "arn:aws:iam::111122223333:role/EFSRole"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: fileSystemId},
+		},
+	)
+	return func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+}
+
+func TestCheckEfsAccess(t *testing.T) {
+	testCases := []struct {
+		name           string
+		checkErr       error
+		expectDisabled bool
+	}{
+		{
+			name: "Success: access allowed",
+		},
+		{
+			name:     "Success: transient error keeps the controller",
+			checkErr: errors.New("connection reset"),
+		},
+		{
+			name:     "Success: file system not found keeps the controller",
+			checkErr: cloud.ErrNotFound,
+		},
+		{
+			name:           "Denied by service control policy",
+			checkErr:       cloud.ErrDeniedByPolicy,
+			expectDisabled: true,
+		},
+		{
+			name:           "Denied by IAM",
+			checkErr:       cloud.ErrAccessDenied,
+			expectDisabled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
+			mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+			mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+			mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).Return(tc.checkErr)
+
+			driver := &Driver{mode: AllMode, cloud: mockCloud}
+			driver.checkEfsAccess(context.Background(), newEfsAccessTestClient("arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/fs-abcd1234"))
+
+			if driver.controllerAvailable() == tc.expectDisabled {
+				t.Fatalf("Expected controller disabled %v, got %v", tc.expectDisabled, !driver.controllerAvailable())
+			}
+			expectedMetric := 1.0
+			if tc.expectDisabled {
+				expectedMetric = 0
+			}
+			if value := testutil.ToFloat64(efsAPIAvailable); value != expectedMetric {
+				t.Fatalf("Expected efs_api_available %v, got %v", expectedMetric, value)
+			}
+
+			pluginCaps, err := driver.GetPluginCapabilities(context.Background(), &csi.GetPluginCapabilitiesRequest{})
+			if err != nil {
+				t.Fatalf("GetPluginCapabilities failed: %v", err)
+			}
+			if hasController := len(pluginCaps.Capabilities) > 0; hasController == tc.expectDisabled {
+				t.Fatalf("Unexpected plugin capabilities: %v", pluginCaps.Capabilities)
+			}
+			controllerCaps, err := driver.ControllerGetCapabilities(context.Background(), &csi.ControllerGetCapabilitiesRequest{})
+			if err != nil {
+				t.Fatalf("ControllerGetCapabilities failed: %v", err)
+			}
+			if hasCaps := len(controllerCaps.Capabilities) > 0; hasCaps == tc.expectDisabled {
+				t.Fatalf("Unexpected controller capabilities: %v", controllerCaps.Capabilities)
+			}
+		})
+	}
+}
+
+func TestCheckEfsAccessWithoutStorageClass(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("")).Return(nil)
+
+	driver := &Driver{mode: ControllerMode, cloud: mockCloud}
+	if !driver.checkEfsAccess(context.Background(), func() (kubernetes.Interface, error) {
+		return nil, errors.New("not in a cluster")
+	}) {
+		t.Fatalf("Expected the access to be verified")
+	}
+}
+
+func TestRecheckEfsAccess(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	gomock.InOrder(
+		mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).Return(cloud.ErrAccessDenied),
+		mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).Return(cloud.ErrAccessDenied),
+		mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).Return(nil).MinTimes(1),
+	)
+
+	k8sClient := newEfsAccessTestClient("fs-abcd1234")
+	driver := &Driver{mode: ControllerMode, cloud: mockCloud}
+	driver.checkEfsAccess(context.Background(), k8sClient)
+	if driver.controllerAvailable() {
+		t.Fatalf("Expected the controller to be disabled")
+	}
+
+	allowed := make(chan struct{}, 1)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go driver.recheckEfsAccess(10*time.Millisecond, k8sClient, func() { allowed <- struct{}{} }, stopCh)
+	select {
+	case <-allowed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the access to be allowed again")
+	}
+	if !driver.controllerAvailable() {
+		t.Fatalf("Expected the controller to be available")
+	}
+}
@@ -14,6 +14,7 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,6 +25,8 @@ import (
 	"text/template"
 
 	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
 )
 
 // https://github.com/aws/efs-utils/blob/v1.30.2/dist/efs-utils.conf
@@ -56,7 +59,7 @@ region = {{.Region -}}
 stunnel_debug_enabled = false
 #Uncomment the below option to save all stunnel logs for a file system to the same file
 #stunnel_logs_file = /var/log/amazon/efs/{fs_id}.stunnel.log
-stunnel_cafile = /etc/amazon/efs/efs-utils.crt
+stunnel_cafile = {{or .StunnelCAFile "/etc/amazon/efs/efs-utils.crt"}}
 
 # Validate the certificate hostname on mount. This option is not supported by certain stunnel versions.
 stunnel_check_cert_hostname = true
@@ -93,31 +96,31 @@ dns_name_suffix = amazonaws.com.cn
 
 [mount.us-iso-west-1]
 dns_name_suffix = c2s.ic.gov
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount.us-iso-east-1]
 dns_name_suffix = c2s.ic.gov
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount.us-isob-west-1]
 dns_name_suffix = sc2s.sgov.gov
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount.us-isob-east-1]
 dns_name_suffix = sc2s.sgov.gov
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount.us-isof-east-1]
 dns_name_suffix = csp.hci.ic.gov
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount.us-isof-south-1]
 dns_name_suffix = csp.hci.ic.gov
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount.eu-isoe-west-1]
 dns_name_suffix = cloud.adc-e.uk
-stunnel_cafile = /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+stunnel_cafile = {{or .StunnelCAFile "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}}
 
 [mount-watchdog]
 enabled = true
@@ -182,6 +185,8 @@ type efsUtilsConfig struct {
 	EfsClientSource string
 	Region          string
 	FipsEnabled     string
+	// StunnelCAFile is the CA bundle trusted by stunnel instead of the CAs of efs-utils and of the system
+	StunnelCAFile string
 }
 
 func newExecWatchdog(efsUtilsCfgPath, efsUtilsStaticFilesPath, cmd string, arg ...string) Watchdog {
@@ -275,20 +280,49 @@ func copyFile(src, dst string) error {
 }
 
 func (w *execWatchdog) updateConfig(efsClientSource string) error {
-	efsCfgTemplate := template.Must(template.New("efs-utils-config").Parse(efsUtilsConfigTemplate))
-	f, err := os.Create(filepath.Join(w.efsUtilsCfgPath, efsUtilsConfigFileName))
+	data, err := renderEfsUtilsConfig(efsClientSource)
 	if err != nil {
+		return fmt.Errorf("cannot update config %s for efs-utils. Error: %v", w.efsUtilsCfgPath, err)
+	}
+	if err := os.WriteFile(filepath.Join(w.efsUtilsCfgPath, efsUtilsConfigFileName), data, 0644); err != nil {
 		return fmt.Errorf("cannot create config file %s for efs-utils. Error: %v", w.efsUtilsCfgPath, err)
 	}
-	defer f.Close()
+	return nil
+}
+
+// setEfsUtilsEnv exports the CA bundle and the endpoints of the configuration to the mount helper and the
+// watchdog of efs-utils, which call the AWS APIs with botocore. botocore reads them from the environment,
+// efs-utils having no option for them.
+func setEfsUtilsEnv(cfg *Config) error {
+	for env, value := range map[string]string{
+		cloud.AWSCABundleEnv:    cfg.AWSCABundle,
+		cloud.EFSEndpointURLEnv: cfg.EFSEndpointURL,
+		cloud.STSEndpointURLEnv: cfg.STSEndpointURL,
+	} {
+		if value == "" {
+			continue
+		}
+		if err := os.Setenv(env, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderEfsUtilsConfig returns the content of the efs-utils config file
+func renderEfsUtilsConfig(efsClientSource string) ([]byte, error) {
+	efsCfgTemplate := template.Must(template.New("efs-utils-config").Parse(efsUtilsConfigTemplate))
 	// used on Fargate, IMDS queries suffice otherwise
 	region := os.Getenv("AWS_DEFAULT_REGION")
 	fipsEnabled := os.Getenv("FIPS_ENABLED")
-	efsCfg := efsUtilsConfig{EfsClientSource: efsClientSource, Region: region, FipsEnabled: fipsEnabled}
-	if err = efsCfgTemplate.Execute(f, efsCfg); err != nil {
-		return fmt.Errorf("cannot update config %s for efs-utils. Error: %v", w.efsUtilsCfgPath, err)
+	// set from --aws-ca-bundle, e.g. for the mount targets of a private CA in ISO regions
+	caBundle := os.Getenv(cloud.AWSCABundleEnv)
+	efsCfg := efsUtilsConfig{EfsClientSource: efsClientSource, Region: region, FipsEnabled: fipsEnabled, StunnelCAFile: caBundle}
+	var buf bytes.Buffer
+	if err := efsCfgTemplate.Execute(&buf, efsCfg); err != nil {
+		return nil, err
 	}
-	return nil
+	return buf.Bytes(), nil
 }
 
 // stop kills the underlying process and stops the watchdog
@@ -296,7 +330,7 @@ func (w *execWatchdog) stop() {
 	close(w.stopCh)
 
 	w.mu.Lock()
-	if w.cmd.Process != nil {
+	if w.cmd != nil && w.cmd.Process != nil {
 		p := w.cmd.Process
 		err := p.Kill()
 		if err != nil {
@@ -312,7 +346,7 @@ func (w *execWatchdog) runLoop(stopCh <-chan struct{}) {
 		select {
 		case <-stopCh:
 			klog.Info("stopping...")
-			break
+			return
 		default:
 			err := w.exec()
 			if err != nil {
@@ -327,9 +361,8 @@ func (w *execWatchdog) exec() error {
 	cmd.Stdout = newInfoRedirect(w.execCmd)
 	cmd.Stderr = newErrRedirect(w.execCmd)
 
-	w.cmd = cmd
-
 	w.mu.Lock()
+	w.cmd = cmd
 	err := cmd.Start()
 	if err != nil {
 		return err
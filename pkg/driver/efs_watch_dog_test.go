@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -149,6 +150,22 @@ func TestExecWatchdog(t *testing.T) {
 	w.stop()
 }
 
+func TestExecWatchdogRunLoopStops(t *testing.T) {
+	w := newExecWatchdog("", "", "true").(*execWatchdog)
+	stopCh := make(chan struct{})
+	close(stopCh)
+	done := make(chan struct{})
+	go func() {
+		w.runLoop(stopCh)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the loop to return once stopped")
+	}
+}
+
 func createTempDir(t *testing.T) string {
 	name, err := ioutil.TempDir("", "")
 	checkError(t, err)
@@ -168,6 +185,8 @@ func createFileInDir(t *testing.T, dirName, fileName string) *os.File {
 }
 
 func TestSetupWithEmptyConfigDirectory(t *testing.T) {
+	// The expected config has the CAs of efs-utils and of the system
+	t.Setenv("AWS_CA_BUNDLE", "")
 	//create file A, B in static file directory and keep config directory empty
 	configDirName := createTempDir(t)
 	staticFileDirName := createTempDir(t)
@@ -197,6 +216,8 @@ func TestSetupWithEmptyConfigDirectory(t *testing.T) {
 }
 
 func TestSetupWithNonEmptyConfigDirectory(t *testing.T) {
+	// The expected config has the CAs of efs-utils and of the system
+	t.Setenv("AWS_CA_BUNDLE", "")
 	//create file A, B in static file directory
 	staticFileDirName := createTempDir(t)
 	defer os.RemoveAll(staticFileDirName)
@@ -300,3 +321,25 @@ func TestWrite(t *testing.T) {
 		t.Errorf("Failed to Write in redirect: %v", err)
 	}
 }
+
+func TestRenderEfsUtilsConfigCABundle(t *testing.T) {
+	caBundle := "/etc/ssl/private-ca.pem"
+	t.Setenv("AWS_CA_BUNDLE", caBundle)
+	data, err := renderEfsUtilsConfig("k8s")
+	checkError(t, err)
+
+	// The bundle replaces the CAs of efs-utils and of the system, in every region
+	lines := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "stunnel_cafile = ") {
+			continue
+		}
+		lines++
+		if line != "stunnel_cafile = "+caBundle {
+			t.Errorf("Expected stunnel to trust %s, got %q", caBundle, line)
+		}
+	}
+	if lines != 8 {
+		t.Fatalf("Expected 8 stunnel_cafile options, got %d", lines)
+	}
+}
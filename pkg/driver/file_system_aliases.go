@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+var (
+	errFileSystemAliasesNotSynced = errors.New("file system aliases are not synced yet")
+	errUnknownFileSystemAlias     = errors.New("unknown file system alias")
+)
+
+// fileSystemAliases resolves the fileSystemId parameters that are neither a file system ID nor an ARN, e.g.
+// team-a-prod, with a ConfigMap mapping every alias to a file system ID or ARN. The ConfigMap is watched, so
+// that the storage classes of an alias provision their next volumes on the file system it maps to once it
+// changes, without editing them. The volumes provisioned before keep their file system.
+// A nil fileSystemAliases is valid and resolves no alias.
+type fileSystemAliases struct {
+	namespace  string
+	name       string
+	configMaps cache.SharedIndexInformer
+}
+
+// newFileSystemAliases returns the aliases stored in the ConfigMap referenced as namespace/name, or nil if empty
+func newFileSystemAliases(configMap string, k8sClient cloud.KubernetesAPIClient) (*fileSystemAliases, error) {
+	if configMap == "" {
+		return nil, nil
+	}
+	parts := strings.Split(configMap, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("file system aliases ConfigMap %q must be of the form namespace/name", configMap)
+	}
+	clientset, err := k8sClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	namespace, name := parts[0], parts[1]
+	return &fileSystemAliases{
+		namespace:  namespace,
+		name:       name,
+		configMaps: newSingleObjectInformer(clientset, &corev1.ConfigMap{}, namespace, name),
+	}, nil
+}
+
+func (a *fileSystemAliases) run(stopCh <-chan struct{}) {
+	a.configMaps.Run(stopCh)
+}
+
+// isFileSystemAlias tells whether the fileSystemId parameter is an alias rather than a file system ID or ARN
+func isFileSystemAlias(value string) bool {
+	return !strings.HasPrefix(value, "fs-") && !cloud.IsArn(value)
+}
+
+// resolve returns the file system ID or ARN the alias maps to. It returns an error wrapping
+// errUnknownFileSystemAlias if the ConfigMap does not have the alias.
+func (a *fileSystemAliases) resolve(alias string) (string, error) {
+	if a == nil {
+		return alias, nil
+	}
+	if !a.configMaps.HasSynced() {
+		return "", errFileSystemAliasesNotSynced
+	}
+	obj, ok, err := a.configMaps.GetStore().GetByKey(a.namespace + "/" + a.name)
+	if err != nil {
+		return "", err
+	}
+	var value string
+	if ok {
+		value = strings.TrimSpace(obj.(*corev1.ConfigMap).Data[alias])
+	}
+	if value == "" {
+		return "", fmt.Errorf("%w %q in ConfigMap %s/%s", errUnknownFileSystemAlias, alias, a.namespace, a.name)
+	}
+	if isFileSystemAlias(value) {
+		return "", fmt.Errorf("file system alias %q maps to %q, which is neither a file system ID nor an ARN", alias, value)
+	}
+	return value, nil
+}
+
+// resolveParameter returns the file system ID or ARN of the fileSystemId parameter of a storage class,
+// resolving it if it is an alias
+func (a *fileSystemAliases) resolveParameter(value string) (string, error) {
+	if !isFileSystemAlias(value) {
+		return value, nil
+	}
+	if a == nil {
+		return "", fmt.Errorf("%w %q, file system aliases are not enabled", errUnknownFileSystemAlias, value)
+	}
+	return a.resolve(value)
+}
+
+// storageClassFileSystemId returns the ID of the file system of the parameters of a storage class, resolving
+// its alias or ARN
+func (a *fileSystemAliases) storageClassFileSystemId(parameters map[string]string) (string, error) {
+	fsId, err := a.resolveParameter(parameters[FsId])
+	if err != nil {
+		return "", err
+	}
+	if cloud.IsArn(fsId) {
+		fsArn, err := cloud.ParseFileSystemArn(fsId)
+		if err != nil {
+			return "", err
+		}
+		fsId = fsArn.FileSystemId
+	}
+	return fsId, nil
+}
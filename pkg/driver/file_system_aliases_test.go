@@ -0,0 +1,250 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestNewFileSystemAliases(t *testing.T) {
+	k8sClient := func() (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(), nil
+	}
+	testCases := []struct {
+		name      string
+		configMap string
+		expectNil bool
+		expectErr bool
+	}{
+		{name: "disabled", configMap: "", expectNil: true},
+		{name: "enabled", configMap: "kube-system/efs-file-system-aliases"},
+		{name: "missing namespace", configMap: "efs-file-system-aliases", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			aliases, err := newFileSystemAliases(tc.configMap, k8sClient)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && tc.expectNil != (aliases == nil) {
+				t.Fatalf("Expected nil aliases: %v, got %v", tc.expectNil, aliases)
+			}
+		})
+	}
+}
+
+func TestFileSystemAliasesResolve(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "efs-file-system-aliases"},
+		Data: map[string]string{
+			"team-a-prod": "fs-abcd1234",
+			"team-b-prod": "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-1234abcd",
+			"invalid":     "team-a-prod",
+		},
+	})
+	aliases, err := newFileSystemAliases("kube-system/efs-file-system-aliases", func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aliases.resolve("team-a-prod"); err != errFileSystemAliasesNotSynced {
+		t.Fatalf("Expected the aliases not to be synced yet, got %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go aliases.run(stopCh)
+
+	waitForAlias := func(alias, expected string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			value, err := aliases.resolve(alias)
+			if err == nil && value == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected alias %s to resolve to %s, got %q (error %v)", alias, expected, value, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitForAlias("team-a-prod", "fs-abcd1234")
+	waitForAlias("team-b-prod", "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-1234abcd")
+	if _, err := aliases.resolve("team-c-prod"); !errors.Is(err, errUnknownFileSystemAlias) {
+		t.Fatalf("Expected an unknown alias error, got %v", err)
+	}
+	if _, err := aliases.resolve("invalid"); err == nil {
+		t.Fatal("Expected an error for an alias mapping to another alias")
+	}
+
+	// The file system of the alias is rotated by editing the ConfigMap
+	ctx := context.Background()
+	cm, _ := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "efs-file-system-aliases", metav1.GetOptions{})
+	cm.Data["team-a-prod"] = "fs-5678efab"
+	if _, err := clientset.CoreV1().ConfigMaps("kube-system").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForAlias("team-a-prod", "fs-5678efab")
+
+	var disabled *fileSystemAliases
+	if value, err := disabled.resolve("team-a-prod"); value != "team-a-prod" || err != nil {
+		t.Fatalf("Expected nil aliases to keep the value, got %q, %v", value, err)
+	}
+}
+
+// newSyncedFileSystemAliases returns the aliases of the data of the ConfigMap, once synced
+func newSyncedFileSystemAliases(t *testing.T, data map[string]string) *fileSystemAliases {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "efs-file-system-aliases"},
+		Data:       data,
+	})
+	aliases, err := newFileSystemAliases("kube-system/efs-file-system-aliases", func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	go aliases.run(stopCh)
+	deadline := time.Now().Add(10 * time.Second)
+	for !aliases.configMaps.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the file system aliases to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return aliases
+}
+
+func TestFileSystemAliasesStorageClassFileSystemId(t *testing.T) {
+	aliases := newSyncedFileSystemAliases(t, map[string]string{
+		"team-a-prod": "fs-abcd1234",
+		"team-b-prod": "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-1234abcd",
+	})
+	testCases := []struct {
+		name           string
+		aliases        *fileSystemAliases
+		fsId           string
+		expected       string
+		expectedRegion string
+		expectErr      bool
+	}{
+		{name: "ID", aliases: aliases, fsId: "fs-abcd1234", expected: "fs-abcd1234"},
+		{name: "ARN", aliases: aliases, fsId: "arn:aws:elasticfilesystem:eu-west-1:111122223333:file-system/fs-5678efab", expected: "fs-5678efab", expectedRegion: "eu-west-1"},
+		{name: "alias of an ID", aliases: aliases, fsId: "team-a-prod", expected: "fs-abcd1234"},
+		{name: "alias of an ARN", aliases: aliases, fsId: "team-b-prod", expected: "fs-1234abcd", expectedRegion: "us-west-2"},
+		{name: "unknown alias", aliases: aliases, fsId: "team-c-prod", expectErr: true},
+		{name: "alias without aliases", fsId: "team-a-prod", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parameters := map[string]string{FsId: tc.fsId}
+			fsId, err := tc.aliases.storageClassFileSystemId(parameters)
+			if tc.expectErr {
+				if !errors.Is(err, errUnknownFileSystemAlias) {
+					t.Fatalf("Expected an unknown alias error, got %v", err)
+				}
+				return
+			}
+			if err != nil || fsId != tc.expected {
+				t.Fatalf("Expected file system %s, got %s: %v", tc.expected, fsId, err)
+			}
+			apiConfig, err := storageClassAPIConfig(parameters, tc.aliases)
+			if err != nil || apiConfig.Region != tc.expectedRegion {
+				t.Fatalf("Expected API region %q, got %+v: %v", tc.expectedRegion, apiConfig, err)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeFileSystemAlias(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "efs-file-system-aliases"},
+		Data:       map[string]string{"team-a-prod": "fs-abcd1234"},
+	})
+	aliases, err := newFileSystemAliases("kube-system/efs-file-system-aliases", func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go aliases.run(stopCh)
+	for !aliases.configMaps.HasSynced() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	driver := &Driver{
+		cloud:             mockCloud,
+		gidAllocator:      NewGidAllocator(),
+		fileSystemAliases: aliases,
+	}
+	req := func(fileSystemId string) *csi.CreateVolumeRequest {
+		return &csi.CreateVolumeRequest{
+			Name: "pvc-1",
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+			}},
+			Parameters: map[string]string{
+				ProvisioningMode: "efs-ap",
+				FsId:             fileSystemId,
+				DirectoryPerms:   "777",
+				Uid:              "1000",
+				Gid:              "1000",
+			},
+		}
+	}
+
+	mockCloud.EXPECT().DescribeFileSystem(gomock.Any(), "fs-abcd1234").Return(&cloud.FileSystem{FileSystemId: "fs-abcd1234"}, nil)
+	mockCloud.EXPECT().CreateAccessPoint(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, opts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+			return &cloud.AccessPoint{AccessPointId: "fsap-abcd1234", FileSystemId: opts.FileSystemId}, nil
+		})
+	res, err := driver.CreateVolume(context.Background(), req("team-a-prod"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Volume.VolumeId != "fs-abcd1234::fsap-abcd1234" {
+		t.Fatalf("Expected the volume on the file system of the alias, got %s", res.Volume.VolumeId)
+	}
+
+	if _, err := driver.CreateVolume(context.Background(), req("team-c-prod")); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument for an unknown alias, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// Tags of a file system holding the uid and gid of the access points created on it by storage classes
+// without the uid and gid parameters
+const (
+	DefaultUidTagKey = "efs.csi.aws.com/default-uid"
+	DefaultGidTagKey = "efs.csi.aws.com/default-gid"
+)
+
+// fileSystemIdentityTTL is how long the default identity of a file system is cached, so that a retagged
+// file system is picked up without listing its tags on every CreateVolume
+const fileSystemIdentityTTL = 5 * time.Minute
+
+var errInvalidIdentityTag = errors.New("invalid default identity tag")
+
+type cachedFileSystemIdentity struct {
+	uid       int64
+	gid       int64
+	fetchedAt time.Time
+}
+
+// fileSystemIdentities reads the default posix identity of the access points of a file system from its
+// DefaultUidTagKey and DefaultGidTagKey tags, so that the identity policy is set once on the file system
+// instead of in each of its storage classes. A nil fileSystemIdentities is valid and returns no identity.
+type fileSystemIdentities struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedFileSystemIdentity
+}
+
+func newFileSystemIdentities(enabled bool) *fileSystemIdentities {
+	if !enabled {
+		return nil
+	}
+	return &fileSystemIdentities{
+		ttl:   fileSystemIdentityTTL,
+		now:   time.Now,
+		cache: map[string]cachedFileSystemIdentity{},
+	}
+}
+
+// get returns the default uid and gid of the file system, -1 for those it is not tagged with
+func (f *fileSystemIdentities) get(ctx context.Context, localCloud cloud.Cloud, fileSystemId string) (uid, gid int64, err error) {
+	if f == nil {
+		return -1, -1, nil
+	}
+	f.mu.Lock()
+	cached, ok := f.cache[fileSystemId]
+	f.mu.Unlock()
+	if ok && f.now().Sub(cached.fetchedAt) < f.ttl {
+		return cached.uid, cached.gid, nil
+	}
+
+	tags, err := localCloud.DescribeTags(ctx, fileSystemId)
+	if err != nil {
+		return -1, -1, err
+	}
+	if uid, err = parseIdentityTag(tags, DefaultUidTagKey); err != nil {
+		return -1, -1, err
+	}
+	if gid, err = parseIdentityTag(tags, DefaultGidTagKey); err != nil {
+		return -1, -1, err
+	}
+	f.mu.Lock()
+	f.cache[fileSystemId] = cachedFileSystemIdentity{uid: uid, gid: gid, fetchedAt: f.now()}
+	f.mu.Unlock()
+	return uid, gid, nil
+}
+
+// parseIdentityTag returns the id of the tag, or -1 if the tag is not set
+func parseIdentityTag(tags map[string]string, key string) (int64, error) {
+	value, ok := tags[key]
+	if !ok {
+		return -1, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return -1, fmt.Errorf("%w %v=%q, must be an integer greater or equal than 0", errInvalidIdentityTag, key, value)
+	}
+	return id, nil
+}
+
+// fileSystemIdentityError returns the status of a failure to get the default identity of the file system
+func fileSystemIdentityError(err error, fileSystemId string) error {
+	switch {
+	case errors.Is(err, errInvalidIdentityTag):
+		return status.Errorf(codes.InvalidArgument, "File System %v: %v", fileSystemId, err)
+	case err == cloud.ErrAccessDenied:
+		return status.Errorf(codes.Unauthenticated, "Access Denied to the tags of File System %v. Please ensure you have the right AWS permissions: %v", fileSystemId, err)
+	case err == cloud.ErrNotFound:
+		return status.Errorf(codes.InvalidArgument, "File System does not exist: %v", err)
+	case err == cloud.ErrDeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, "Timed out describing the tags of File System %v: %v", fileSystemId, err)
+	case errors.Is(err, cloud.ErrThrottled):
+		return errorWithRetryDelay(codes.ResourceExhausted, throttledRetryDelay, "Throttled describing the tags of File System %v: %v", fileSystemId, err)
+	}
+	return status.Errorf(codes.Internal, "Failed to describe the tags of File System %v: %v", fileSystemId, err)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestFileSystemIdentitiesCache(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	ctx := context.Background()
+
+	now := time.Now()
+	identities := newFileSystemIdentities(true)
+	identities.now = func() time.Time { return now }
+	if newFileSystemIdentities(false) != nil {
+		t.Errorf("Expected no identities when disabled")
+	}
+
+	mockCloud.EXPECT().DescribeTags(gomock.Eq(ctx), gomock.Eq("fs-abcd1234")).Return(map[string]string{DefaultUidTagKey: "1000"}, nil).Times(2)
+	for i := 0; i < 2; i++ {
+		uid, gid, err := identities.get(ctx, mockCloud, "fs-abcd1234")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if uid != 1000 || gid != -1 {
+			t.Fatalf("Expected uid 1000 and no gid, got %d and %d", uid, gid)
+		}
+	}
+
+	// The tags are listed again once the cached identity expires
+	now = now.Add(fileSystemIdentityTTL)
+	if _, _, err := identities.get(ctx, mockCloud, "fs-abcd1234"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCreateVolumeFileSystemIdentity(t *testing.T) {
+	var (
+		volumeName = "volumeName"
+		fsId       = "fs-abcd1234"
+		apId       = "fsap-abcd1234xyz987"
+		stdVolCap  = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}
+	)
+
+	testCases := []struct {
+		name          string
+		params        map[string]string
+		tags          map[string]string
+		expectUid     int64
+		expectGid     int64
+		expectErrCode codes.Code
+	}{
+		{
+			name:      "Success: identity from the tags",
+			tags:      map[string]string{DefaultUidTagKey: "1000", DefaultGidTagKey: "1001"},
+			expectUid: 1000,
+			expectGid: 1001,
+		},
+		{
+			name:      "Success: parameters take precedence over the tags",
+			params:    map[string]string{Uid: "2000"},
+			tags:      map[string]string{DefaultUidTagKey: "1000", DefaultGidTagKey: "1001"},
+			expectUid: 2000,
+			expectGid: 1001,
+		},
+		{
+			name:          "Fail: invalid tag",
+			tags:          map[string]string{DefaultUidTagKey: "1000", DefaultGidTagKey: "staff"},
+			expectErrCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+
+			driver := &Driver{
+				endpoint:             "endpoint",
+				cloud:                mockCloud,
+				gidAllocator:         NewGidAllocator(),
+				fileSystemIdentities: newFileSystemIdentities(true),
+			}
+
+			params := map[string]string{
+				ProvisioningMode: "efs-ap",
+				FsId:             fsId,
+				DirectoryPerms:   "777",
+			}
+			for k, v := range tc.params {
+				params[k] = v
+			}
+			req := &csi.CreateVolumeRequest{
+				Name:               volumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{stdVolCap},
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 5368709120},
+				Parameters:         params,
+			}
+
+			ctx := context.Background()
+			mockCloud.EXPECT().DescribeTags(gomock.Eq(ctx), gomock.Eq(fsId)).Return(tc.tags, nil)
+			if tc.expectErrCode == codes.OK {
+				mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Any()).Return(&cloud.FileSystem{FileSystemId: fsId}, nil)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(volumeName), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+						if accessPointOpts.Uid != tc.expectUid || accessPointOpts.Gid != tc.expectGid {
+							t.Errorf("Expected uid %d and gid %d, got %d and %d", tc.expectUid, tc.expectGid, accessPointOpts.Uid, accessPointOpts.Gid)
+						}
+						return &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId}, nil
+					})
+			}
+
+			_, err := driver.CreateVolume(ctx, req)
+			if status.Code(err) != tc.expectErrCode {
+				t.Fatalf("Expected error code %v, got %v", tc.expectErrCode, err)
+			}
+		})
+	}
+}
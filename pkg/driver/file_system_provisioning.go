@@ -0,0 +1,276 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+var (
+	throughputModes  = []string{string(types.ThroughputModeBursting), string(types.ThroughputModeElastic), string(types.ThroughputModeProvisioned)}
+	performanceModes = []string{string(types.PerformanceModeGeneralPurpose), string(types.PerformanceModeMaxIo)}
+	// fileSystemParameters are the parameters only supported by provisioning mode efs-fs
+	fileSystemParameters = []string{Encrypted, KmsKeyId, PerformanceMode, ProvisionedThroughputInMibps, SecurityGroupIds, SubnetIds, ThroughputMode}
+	// accessPointParameters are the parameters of the access points and directories of the volumes, which are
+	// not supported by provisioning mode efs-fs
+	accessPointParameters = []string{
+		AccessPointId, BasePath, DirectoryPerms, EnforceUserIdentity, EnsureUniqueDirectory, FsId, Gid, GidMax, GidMin,
+		MaxDirectoriesPerBasePath, RequireBasePath, ReuseAccessPointKey, SkipCreationInfo, SubPathPattern, Uid,
+	}
+)
+
+// fileSystemVolumeOptions are the options of the file system created for a volume by provisioning mode efs-fs,
+// and of its mount targets
+type fileSystemVolumeOptions struct {
+	fileSystem       cloud.FileSystemOptions
+	subnetIds        []string
+	securityGroupIds []string
+}
+
+// parseFileSystemVolumeOptions parses the parameters of provisioning mode efs-fs. File systems are encrypted
+// unless encrypted is false, and get a mount target in each subnet.
+func parseFileSystemVolumeOptions(volumeParams map[string]string) (*fileSystemVolumeOptions, error) {
+	for _, param := range accessPointParameters {
+		if _, ok := volumeParams[param]; ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is not supported by provisioning mode %v", param, FileSystemMode)
+		}
+	}
+	options := &fileSystemVolumeOptions{
+		fileSystem: cloud.FileSystemOptions{Encrypted: true},
+	}
+
+	if value, ok := volumeParams[ThroughputMode]; ok {
+		if !isOneOf(value, throughputModes) {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid %v parameter %q, expected one of %v", ThroughputMode, value, strings.Join(throughputModes, ", "))
+		}
+		options.fileSystem.ThroughputMode = value
+	}
+	if value, ok := volumeParams[ProvisionedThroughputInMibps]; ok {
+		if options.fileSystem.ThroughputMode != string(types.ThroughputModeProvisioned) {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v requires %v %v", ProvisionedThroughputInMibps, ThroughputMode, types.ThroughputModeProvisioned)
+		}
+		throughput, err := strconv.ParseFloat(value, 64)
+		if err != nil || throughput <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v must be a positive number, got %q", ProvisionedThroughputInMibps, value)
+		}
+		options.fileSystem.ProvisionedThroughputInMibps = throughput
+	} else if options.fileSystem.ThroughputMode == string(types.ThroughputModeProvisioned) {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing %v parameter, required by %v %v", ProvisionedThroughputInMibps, ThroughputMode, types.ThroughputModeProvisioned)
+	}
+	if value, ok := volumeParams[PerformanceMode]; ok {
+		if !isOneOf(value, performanceModes) {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid %v parameter %q, expected one of %v", PerformanceMode, value, strings.Join(performanceModes, ", "))
+		}
+		options.fileSystem.PerformanceMode = value
+	}
+	if value, ok := volumeParams[Encrypted]; ok {
+		encrypted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid value for %v parameter: %v", Encrypted, err)
+		}
+		options.fileSystem.Encrypted = encrypted
+	}
+	if value, ok := volumeParams[KmsKeyId]; ok {
+		if !options.fileSystem.Encrypted {
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v is not supported with %v false", KmsKeyId, Encrypted)
+		}
+		options.fileSystem.KmsKeyId = strings.TrimSpace(value)
+	}
+
+	options.subnetIds = splitParameterList(volumeParams[SubnetIds])
+	if len(options.subnetIds) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing %v parameter, the subnets of the mount targets of the file system", SubnetIds)
+	}
+	options.securityGroupIds = splitParameterList(volumeParams[SecurityGroupIds])
+	return options, nil
+}
+
+// createFileSystemVolume creates the file system of a volume of provisioning mode efs-fs, and its mount targets.
+// The file system is created with the name of the volume as creation token, so that the retries of CreateVolume,
+// which fails with Unavailable until the file system and its mount targets are available, find it.
+func (d *Driver) createFileSystemVolume(ctx context.Context, req *csi.CreateVolumeRequest, volumeParams map[string]string, simulation *createVolumeSimulation) (*csi.CreateVolumeResponse, error) {
+	volName := req.GetName()
+	options, err := parseFileSystemVolumeOptions(volumeParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var progress *provisioningProgress
+	if simulation == nil {
+		progress = newProvisioningProgress(d.progressEventThreshold, cloud.DefaultKubernetesAPIClient, volName, volumeParams)
+		defer progress.done()
+	}
+
+	apiConfig, err := parseAPIConfig(volumeParams)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid API parameters: %v", err)
+	}
+	secrets, err := d.secretsResolver.resolve(ctx, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := secrets[RoleArn]; ok || apiConfig.RoleArn != "" {
+		progress.step("assuming the cross account role")
+	}
+	localCloud, roleArn, crossAccountDNSEnabled, err := getCloud(secrets, d, apiConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.mountHelperFeatureGate.check(ctx, requiredMountHelperFeatures(roleArn, crossAccountDNSEnabled)); err != nil {
+		if errors.Is(err, errMountHelperFeaturesUnsupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "Volume %v cannot be mounted: %v", volName, err)
+		}
+		return nil, status.Errorf(codes.Unavailable, "Failed to check the mount helper features of the nodes: %v", err)
+	}
+
+	tags := map[string]string{
+		DefaultTagKey: DefaultTagValue,
+	}
+	if d.clusterId != "" {
+		tags[cloud.ClusterIdTagKey] = d.clusterId
+	}
+	for k, v := range d.tags {
+		tags[k] = v
+	}
+	options.fileSystem.Tags = tags
+	if simulation != nil {
+		simulation.fileSystem(volName, options)
+		return nil, nil
+	}
+
+	progress.step("creating the file system")
+	fileSystem, err := localCloud.CreateFileSystem(ctx, volName, &options.fileSystem)
+	if err != nil {
+		return nil, fileSystemProvisioningError(err, "create file system for volume "+volName)
+	}
+	if fileSystem.LifeCycleState != cloud.FileSystemStateAvailable {
+		return nil, status.Errorf(codes.Unavailable, "File system %v of volume %v is %v, waiting for it to be available", fileSystem.FileSystemId, volName, fileSystem.LifeCycleState)
+	}
+
+	progress.step(fmt.Sprintf("creating the mount targets of file system %v", fileSystem.FileSystemId))
+	available, err := localCloud.EnsureMountTargets(ctx, fileSystem.FileSystemId, options.subnetIds, options.securityGroupIds)
+	if err != nil {
+		return nil, fileSystemProvisioningError(err, "create the mount targets of file system "+fileSystem.FileSystemId)
+	}
+	if !available {
+		return nil, status.Errorf(codes.Unavailable, "Mount targets of file system %v of volume %v are being created, waiting for them to be available", fileSystem.FileSystemId, volName)
+	}
+	klog.V(2).Infof("CreateVolume: created file system %v for volume %v", fileSystem.FileSystemId, volName)
+
+	volumeId := d.volumeId(fileSystem.FileSystemId, "", "", apiConfig)
+	volContext := map[string]string{}
+	d.addMountTargetVolumeContext(ctx, progress, localCloud, fileSystem.FileSystemId, volumeParams[AzName], roleArn, crossAccountDNSEnabled, volContext)
+	if d.volumeMountCommand {
+		volContext[MountCommand] = mountCommand(volumeId, volContext, req.GetVolumeCapabilities(), d.cloud.GetMetadata().GetRegion())
+	}
+	if d.provisioningDetails {
+		details := newProvisioningDetails(FileSystemMode)
+		details.mountTargetIp = volContext[MountTargetIp]
+		for k, v := range details.volumeContext() {
+			volContext[k] = v
+		}
+	}
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
+			VolumeId:      volumeId,
+			VolumeContext: volContext,
+		},
+	}, nil
+}
+
+// deleteFileSystemVolume deletes the file system of a volume of provisioning mode efs-fs, and its mount targets.
+// A file system not tagged with cloud.ProvisionedFileSystemTagKey was not created by the driver and is kept, and
+// one tagged with cloud.ClusterIdTagKey is kept unless it matches the cluster-id of the controller.
+func (d *Driver) deleteFileSystemVolume(ctx context.Context, localCloud cloud.Cloud, volId, fileSystemId string) error {
+	tags, err := localCloud.DescribeTags(ctx, fileSystemId)
+	if err != nil {
+		if err == cloud.ErrNotFound {
+			klog.V(5).Infof("DeleteVolume: File System %v not found, returning success", fileSystemId)
+			return nil
+		}
+		return fileSystemProvisioningError(err, "describe the tags of file system "+fileSystemId)
+	}
+	if _, ok := tags[cloud.ProvisionedFileSystemTagKey]; !ok {
+		return status.Errorf(codes.NotFound, "Failed to find access point for volume: %v", volId)
+	}
+	// A file system of a cluster is only deleted by the controllers with its cluster-id, so that a controller
+	// without one never deletes the file systems of the other clusters sharing the account
+	if clusterId := tags[cloud.ClusterIdTagKey]; clusterId != "" && clusterId != d.clusterId {
+		return status.Errorf(codes.FailedPrecondition, "Cannot delete file system %v of volume %v, it belongs to cluster %v, not %q", fileSystemId, volId, clusterId, d.clusterId)
+	}
+
+	if err := localCloud.DeleteFileSystem(ctx, fileSystemId); err != nil {
+		if err == cloud.ErrNotFound {
+			klog.V(5).Infof("DeleteVolume: File System %v not found, returning success", fileSystemId)
+			return nil
+		}
+		if err == cloud.ErrFileSystemInUse {
+			return status.Errorf(codes.Unavailable, "Mount targets of file system %v are being deleted, waiting to delete the file system", fileSystemId)
+		}
+		return fileSystemProvisioningError(err, "delete file system "+fileSystemId)
+	}
+	klog.V(2).Infof("DeleteVolume: deleted file system %v of volume %v", fileSystemId, volId)
+	return nil
+}
+
+// fileSystemProvisioningError returns the status of the failure of a call of the cloud to do the action
+func fileSystemProvisioningError(err error, action string) error {
+	switch {
+	case err == cloud.ErrAccessDenied:
+		return status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions to %v: %v", action, err)
+	case err == cloud.ErrDeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, "Timed out trying to %v", action)
+	case err == cloud.ErrFileSystemLimitExceeded:
+		return errorWithRetryDelay(codes.ResourceExhausted, exhaustedRetryDelay, "Failed to %v, the account has the maximum number of File Systems", action)
+	case errors.Is(err, cloud.ErrThrottled):
+		return errorWithRetryDelay(codes.ResourceExhausted, throttledRetryDelay, "Throttled trying to %v: %v", action, err)
+	}
+	return status.Errorf(codes.Internal, "Failed to %v: %v", action, err)
+}
+
+// splitParameterList splits the comma separated list of a parameter, ignoring the empty items
+func splitParameterList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isOneOf(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
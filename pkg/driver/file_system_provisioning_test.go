@@ -0,0 +1,251 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateVolumeFileSystemMode(t *testing.T) {
+	const (
+		fsId    = "fs-abcd1234"
+		volName = "pvc-1234"
+	)
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+	params := func(extra map[string]string) map[string]string {
+		p := map[string]string{ProvisioningMode: FileSystemMode, SubnetIds: "subnet-a, subnet-b"}
+		for k, v := range extra {
+			p[k] = v
+		}
+		return p
+	}
+
+	testCases := []struct {
+		name               string
+		params             map[string]string
+		fileSystemState    string
+		mountTargetsReady  bool
+		expectedOptions    *cloud.FileSystemOptions
+		expectedCode       codes.Code
+		expectedMountCalls bool
+	}{
+		{
+			name:               "Success: file system and mount targets available",
+			params:             params(map[string]string{ThroughputMode: "provisioned", ProvisionedThroughputInMibps: "128", PerformanceMode: "maxIO", KmsKeyId: "alias/efs", SecurityGroupIds: "sg-1234"}),
+			fileSystemState:    cloud.FileSystemStateAvailable,
+			mountTargetsReady:  true,
+			expectedOptions:    &cloud.FileSystemOptions{ThroughputMode: "provisioned", ProvisionedThroughputInMibps: 128, PerformanceMode: "maxIO", Encrypted: true, KmsKeyId: "alias/efs"},
+			expectedCode:       codes.OK,
+			expectedMountCalls: true,
+		},
+		{
+			name:            "Fail: file system being created",
+			params:          params(map[string]string{Encrypted: "false"}),
+			fileSystemState: "creating",
+			expectedOptions: &cloud.FileSystemOptions{},
+			expectedCode:    codes.Unavailable,
+		},
+		{
+			name:               "Fail: mount targets being created",
+			params:             params(nil),
+			fileSystemState:    cloud.FileSystemStateAvailable,
+			expectedOptions:    &cloud.FileSystemOptions{Encrypted: true},
+			expectedCode:       codes.Unavailable,
+			expectedMountCalls: true,
+		},
+		{
+			name:         "Fail: missing subnets",
+			params:       map[string]string{ProvisioningMode: FileSystemMode},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Fail: access point parameter",
+			params:       params(map[string]string{FsId: fsId}),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Fail: provisioned throughput without provisioned throughput mode",
+			params:       params(map[string]string{ProvisionedThroughputInMibps: "128"}),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Fail: unknown throughput mode",
+			params:       params(map[string]string{ThroughputMode: "fast"}),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Fail: KMS key of an unencrypted file system",
+			params:       params(map[string]string{Encrypted: "false", KmsKeyId: "alias/efs"}),
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			driver := &Driver{
+				cloud:     mockCloud,
+				clusterId: "cluster-1",
+			}
+
+			ctx := context.Background()
+			if tc.expectedOptions != nil {
+				mockCloud.EXPECT().CreateFileSystem(gomock.Eq(ctx), volName, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, options *cloud.FileSystemOptions) (*cloud.FileSystem, error) {
+						if options.Tags[cloud.ClusterIdTagKey] != "cluster-1" || options.Tags[DefaultTagKey] != DefaultTagValue {
+							t.Fatalf("Unexpected tags %v", options.Tags)
+						}
+						options.Tags = nil
+						if !reflect.DeepEqual(options, tc.expectedOptions) {
+							t.Fatalf("Expected options %+v, got %+v", tc.expectedOptions, options)
+						}
+						return &cloud.FileSystem{FileSystemId: fsId, LifeCycleState: tc.fileSystemState}, nil
+					})
+			}
+			if tc.expectedMountCalls {
+				securityGroupIds := splitParameterList(tc.params[SecurityGroupIds])
+				mockCloud.EXPECT().EnsureMountTargets(gomock.Eq(ctx), fsId, []string{"subnet-a", "subnet-b"}, securityGroupIds).Return(tc.mountTargetsReady, nil)
+			}
+
+			res, err := driver.CreateVolume(ctx, &csi.CreateVolumeRequest{
+				Name:               volName,
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 5 * 1024 * 1024 * 1024},
+				VolumeCapabilities: []*csi.VolumeCapability{stdVolCap},
+				Parameters:         tc.params,
+			})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+			if err == nil && res.Volume.VolumeId != fsId {
+				t.Fatalf("Expected volume ID %v, got %v", fsId, res.Volume.VolumeId)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeRejectsFileSystemParameters(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	driver := &Driver{cloud: mocks.NewMockCloud(mockCtl)}
+
+	_, err := driver.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+		Name: "pvc-1234",
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+		}},
+		Parameters: map[string]string{ProvisioningMode: AccessPointMode, FsId: "fs-abcd1234", ThroughputMode: "elastic"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestDeleteVolumeFileSystemMode(t *testing.T) {
+	const fsId = "fs-abcd1234"
+	testCases := []struct {
+		name           string
+		noClusterId    bool
+		tags           map[string]string
+		describeErr    error
+		deleteErr      error
+		expectedDelete bool
+		expectedCode   codes.Code
+	}{
+		{
+			name:           "Success: file system provisioned by the driver",
+			tags:           map[string]string{cloud.ProvisionedFileSystemTagKey: "pvc-1234", cloud.ClusterIdTagKey: "cluster-1"},
+			expectedDelete: true,
+			expectedCode:   codes.OK,
+		},
+		{
+			name:         "Success: file system already deleted",
+			describeErr:  cloud.ErrNotFound,
+			expectedCode: codes.OK,
+		},
+		{
+			name:           "Fail: mount targets being deleted",
+			tags:           map[string]string{cloud.ProvisionedFileSystemTagKey: "pvc-1234"},
+			deleteErr:      cloud.ErrFileSystemInUse,
+			expectedDelete: true,
+			expectedCode:   codes.Unavailable,
+		},
+		{
+			name:         "Fail: file system of another cluster",
+			tags:         map[string]string{cloud.ProvisionedFileSystemTagKey: "pvc-1234", cloud.ClusterIdTagKey: "cluster-2"},
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "Fail: file system of a cluster deleted by a controller without cluster-id",
+			noClusterId:  true,
+			tags:         map[string]string{cloud.ProvisionedFileSystemTagKey: "pvc-1234", cloud.ClusterIdTagKey: "cluster-1"},
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:           "Success: file system without cluster deleted by a controller without cluster-id",
+			noClusterId:    true,
+			tags:           map[string]string{cloud.ProvisionedFileSystemTagKey: "pvc-1234"},
+			expectedDelete: true,
+			expectedCode:   codes.OK,
+		},
+		{
+			name:         "Fail: file system not provisioned by the driver",
+			tags:         map[string]string{},
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			driver := &Driver{cloud: mockCloud, clusterId: "cluster-1"}
+			if tc.noClusterId {
+				driver.clusterId = ""
+			}
+
+			ctx := context.Background()
+			mockCloud.EXPECT().DescribeTags(gomock.Eq(ctx), fsId).Return(tc.tags, tc.describeErr)
+			if tc.expectedDelete {
+				mockCloud.EXPECT().DeleteFileSystem(gomock.Eq(ctx), fsId).Return(tc.deleteErr)
+			}
+			_, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: fsId})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+		})
+	}
+}
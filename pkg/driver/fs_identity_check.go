@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FileSystemIdentityCheckState compares the file system ID of the efs-utils state of the mount
+	FileSystemIdentityCheckState = "state"
+	// FileSystemIdentityCheckSentinel compares the content of the sentinel file at the root of the mount
+	FileSystemIdentityCheckSentinel = "sentinel"
+
+	// FileSystemIdSentinelFile is the file at the root of the file system, or of the access point,
+	// that contains the ID of the file system for the sentinel check
+	FileSystemIdSentinelFile = ".efs-csi-file-system-id"
+
+	efsUtilsStateDir = "/var/run/efs"
+)
+
+// efs-utils names the state file of a TLS mount <fs id>.<mount point with '.' instead of '/'>.<port>
+var efsUtilsStateFileRegex = regexp.MustCompile(`^(fs-[0-9a-f]+)\.(.+)\.([0-9]+)$`)
+
+// fileSystemIdentityCheck verifies that the file system mounted by NodePublishVolume is the requested
+// one, in case DNS poisoning or a misconfigured hostAliases entry resolved the mount target of another
+// file system. A nil fileSystemIdentityCheck is valid and verifies nothing.
+type fileSystemIdentityCheck struct {
+	mode     string
+	stateDir string
+}
+
+// newFileSystemIdentityCheck returns the check of the mode, or nil if the mode is empty
+func newFileSystemIdentityCheck(mode string) (*fileSystemIdentityCheck, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case FileSystemIdentityCheckState, FileSystemIdentityCheckSentinel:
+		return &fileSystemIdentityCheck{mode: mode, stateDir: efsUtilsStateDir}, nil
+	default:
+		return nil, fmt.Errorf("invalid file system identity check %q, must be one of %s or %s", mode, FileSystemIdentityCheckState, FileSystemIdentityCheckSentinel)
+	}
+}
+
+// verify returns an error if the file system mounted at the path is not the file system with the ID
+func (c *fileSystemIdentityCheck) verify(fileSystemId, mountPath string, mountOptions []string) error {
+	if c == nil {
+		return nil
+	}
+	if c.mode == FileSystemIdentityCheckSentinel {
+		return verifySentinel(fileSystemId, mountPath)
+	}
+	// efs-utils only keeps the state of mounts with TLS
+	if !hasOption(mountOptions, "tls") {
+		return nil
+	}
+	return c.verifyState(fileSystemId, mountPath)
+}
+
+func verifySentinel(fileSystemId, mountPath string) error {
+	content, err := os.ReadFile(filepath.Join(mountPath, FileSystemIdSentinelFile))
+	if err != nil {
+		return fmt.Errorf("failed to read sentinel file %s: %v", FileSystemIdSentinelFile, err)
+	}
+	if sentinelId := strings.TrimSpace(string(content)); sentinelId != fileSystemId {
+		return fmt.Errorf("sentinel file %s contains file system ID %q", FileSystemIdSentinelFile, sentinelId)
+	}
+	return nil
+}
+
+func (c *fileSystemIdentityCheck) verifyState(fileSystemId, mountPath string) error {
+	entries, err := os.ReadDir(c.stateDir)
+	if err != nil {
+		return fmt.Errorf("failed to read efs-utils state directory %s: %v", c.stateDir, err)
+	}
+	mountPoint := strings.TrimLeft(strings.ReplaceAll(filepath.Clean(mountPath), "/", "."), ".")
+	for _, entry := range entries {
+		match := efsUtilsStateFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil || match[2] != mountPoint {
+			continue
+		}
+		if match[1] != fileSystemId {
+			return fmt.Errorf("efs-utils state %s reports file system ID %s", entry.Name(), match[1])
+		}
+		return nil
+	}
+	return fmt.Errorf("no efs-utils state of the mount in %s", c.stateDir)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFileSystemIdentityCheck(t *testing.T) {
+	if c, err := newFileSystemIdentityCheck(""); c != nil || err != nil {
+		t.Fatalf("Expected no check, got %v: %v", c, err)
+	}
+	if _, err := newFileSystemIdentityCheck("dns"); err == nil {
+		t.Fatal("Expected an invalid mode to be rejected")
+	}
+	var nilCheck *fileSystemIdentityCheck
+	if err := nilCheck.verify("fs-abcd1234", "/does/not/exist", nil); err != nil {
+		t.Fatalf("Expected a nil check to verify nothing, got %v", err)
+	}
+}
+
+func TestFileSystemIdentityCheckSentinel(t *testing.T) {
+	mountPath := t.TempDir()
+	check := &fileSystemIdentityCheck{mode: FileSystemIdentityCheckSentinel}
+
+	if err := check.verify("fs-abcd1234", mountPath, nil); err == nil {
+		t.Fatal("Expected a missing sentinel file to fail the check")
+	}
+	if err := os.WriteFile(filepath.Join(mountPath, FileSystemIdSentinelFile), []byte("fs-abcd1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := check.verify("fs-abcd1234", mountPath, nil); err != nil {
+		t.Fatalf("Expected the sentinel file to match, got %v", err)
+	}
+	if err := check.verify("fs-5678efab", mountPath, nil); err == nil {
+		t.Fatal("Expected the sentinel file of another file system to fail the check")
+	}
+}
+
+func TestFileSystemIdentityCheckState(t *testing.T) {
+	stateDir := t.TempDir()
+	check := &fileSystemIdentityCheck{mode: FileSystemIdentityCheckState, stateDir: stateDir}
+	mountPath := "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount"
+	for _, name := range []string{
+		"fs-abcd1234.var.lib.kubelet.pods.uid.volumes.kubernetes.io~csi.pv-1.mount.20049",
+		"fs-5678efab.var.lib.kubelet.pods.uid.volumes.kubernetes.io~csi.pv-2.mount.20050",
+		"stunnel-config.fs-abcd1234.var.lib.kubelet.pods.uid.volumes.kubernetes.io~csi.pv-1.mount.20049",
+	} {
+		if err := os.WriteFile(filepath.Join(stateDir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tls := []string{"tls"}
+	if err := check.verify("fs-abcd1234", mountPath, tls); err != nil {
+		t.Fatalf("Expected the state to match, got %v", err)
+	}
+	if err := check.verify("fs-5678efab", mountPath, tls); err == nil {
+		t.Fatal("Expected the state of another file system to fail the check")
+	}
+	if err := check.verify("fs-abcd1234", "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-3/mount", tls); err == nil {
+		t.Fatal("Expected a mount without state to fail the check")
+	}
+	// efs-utils keeps no state of mounts without TLS
+	if err := check.verify("fs-5678efab", mountPath, nil); err != nil {
+		t.Fatalf("Expected mounts without TLS to be skipped, got %v", err)
+	}
+}
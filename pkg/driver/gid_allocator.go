@@ -1,13 +1,13 @@
 package driver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
-	"golang.org/x/exp/slices"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"k8s.io/klog/v2"
 )
 
@@ -16,8 +16,14 @@ type FilesystemID struct {
 	gidMax int64
 }
 
+// gidReservationTTL is how long an allocated GID is not allocated again, while the access point created
+// with it may be missing from the access points listed by concurrent CreateVolume calls
+const gidReservationTTL = time.Minute
+
 type GidAllocator struct {
 	mu sync.Mutex
+	// reserved has the recently allocated GIDs of every file system, with their allocation time
+	reserved map[string]map[int64]time.Time
 }
 
 func NewGidAllocator() GidAllocator {
@@ -25,73 +31,179 @@ func NewGidAllocator() GidAllocator {
 }
 
 // Retrieves the next available GID
-func (g *GidAllocator) getNextGid(fsId string, accessPoints []*cloud.AccessPoint, gidMin, gidMax int64) (int64, error) {
+func (g *GidAllocator) getNextGid(fsId string, usedGids map[int64]bool, gidMin, gidMax int64) (int64, error) {
+	return g.nextGid(fsId, usedGids, gidMin, gidMax, true)
+}
+
+// peekNextGid returns the GID getNextGid would allocate, without reserving it
+func (g *GidAllocator) peekNextGid(fsId string, usedGids map[int64]bool, gidMin, gidMax int64) (int64, error) {
+	return g.nextGid(fsId, usedGids, gidMin, gidMax, false)
+}
+
+func (g *GidAllocator) nextGid(fsId string, usedGids map[int64]bool, gidMin, gidMax int64, reserve bool) (int64, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	klog.V(5).Infof("Received getNextGid for fsId: %v, min: %v, max: %v", fsId, gidMin, gidMax)
+	klog.V(5).Infof("Received getNextGid for fsId: %v, min: %v, max: %v, reserve: %t", fsId, gidMin, gidMax, reserve)
 
-	usedGids, err := g.getUsedGids(fsId, accessPoints)
-	if err != nil {
-		return 0, status.Errorf(codes.Internal, "Failed to discover used GIDs for filesystem: %v: %v ", fsId, err)
+	if g.reserved == nil {
+		g.reserved = map[string]map[int64]time.Time{}
+	}
+	reserved := g.reserved[fsId]
+	if len(reserved) > 0 {
+		listed := usedGids
+		usedGids = make(map[int64]bool, len(listed)+len(reserved))
+		for gid := range listed {
+			usedGids[gid] = true
+		}
+		for gid, allocated := range reserved {
+			if time.Since(allocated) > gidReservationTTL {
+				delete(reserved, gid)
+				continue
+			}
+			usedGids[gid] = true
+		}
 	}
 
 	gid, err := getNextUnusedGid(usedGids, gidMin, gidMax)
 
 	if err != nil {
-		return 0, status.Errorf(codes.Internal, "Failed to locate a free GID for given file system: %v. "+
-			"Please create a new storage class with a new file-system", fsId)
+		return 0, fmt.Errorf("failed to locate a free GID for file system %v, please create a new storage class with a new file system: %w", fsId, err)
 	}
 
+	if !reserve {
+		return gid, nil
+	}
+	if reserved == nil {
+		reserved = map[int64]time.Time{}
+		g.reserved[fsId] = reserved
+	}
+	reserved[gid] = time.Now()
 	return gid, nil
 }
 
-func (g *GidAllocator) getUsedGids(fsId string, accessPoints []*cloud.AccessPoint) (gids []int64, err error) {
-	gids = []int64{}
-	if len(accessPoints) == 0 {
-		return gids, nil
-	}
-	for _, ap := range accessPoints {
-		// This should happen only in tests - skip nil pointers.
-		if ap == nil {
-			continue
-		}
-		if ap.PosixUser != nil {
-			gids = append(gids, ap.PosixUser.Gid)
+// listUsedGids streams the pages of access points of the file system and collects the GIDs in use within the range,
+// without keeping the access points. It stops listing once every GID of the range is in use, as none can be allocated.
+func listUsedGids(ctx context.Context, localCloud cloud.Cloud, fsId string, gidMin, gidMax int64) (map[int64]bool, error) {
+	gidMax = limitGidRange(gidMin, gidMax)
+	usedGids := map[int64]bool{}
+	err := localCloud.ListAccessPointsPages(ctx, fsId, func(accessPoints []*cloud.AccessPoint) bool {
+		for _, ap := range accessPoints {
+			// This should happen only in tests - skip nil pointers.
+			if ap == nil || ap.PosixUser == nil {
+				continue
+			}
+			if gid := ap.PosixUser.Gid; gid >= gidMin && gid <= gidMax {
+				usedGids[gid] = true
+			}
 		}
+		return int64(len(usedGids)) <= gidMax-gidMin
+	})
+	if err != nil {
+		return nil, err
 	}
-	klog.V(5).Infof("Discovered used GIDs: %+v for FS ID: %v", gids, fsId)
-	return
+	klog.V(5).Infof("Discovered %d used GIDs in range (%v:%v) for FS ID: %v", len(usedGids), gidMin, gidMax, fsId)
+	return usedGids, nil
 }
 
-func getNextUnusedGid(usedGids []int64, gidMin, gidMax int64) (nextGid int64, err error) {
-	requestedRange := gidMax - gidMin
-
-	if requestedRange > cloud.AccessPointPerFsLimit {
+// limitGidRange returns the maximum GID of the range, limited to the number of access points per file system
+func limitGidRange(gidMin, gidMax int64) int64 {
+	if gidMax-gidMin > cloud.AccessPointPerFsLimit {
 		overrideGidMax := gidMin + cloud.AccessPointPerFsLimit
 		klog.Warningf("Requested GID range (%v:%v) exceeds EFS Access Point limit (%v) per Filesystem. Driver will use limited GID range (%v:%v)", gidMin, gidMax, cloud.AccessPointPerFsLimit, gidMin, overrideGidMax)
-		gidMax = overrideGidMax
+		return overrideGidMax
 	}
+	return gidMax
+}
 
-	var lookup func(usedGids []int64)
-	lookup = func(usedGids []int64) {
-		for gid := gidMin; gid <= gidMax; gid++ {
-			if !slices.Contains(usedGids, gid) {
-				nextGid = gid
-				return
-			}
-			klog.V(5).Infof("Allocator found GID which is already in use: %v, trying next one.", gid)
+func getNextUnusedGid(usedGids map[int64]bool, gidMin, gidMax int64) (nextGid int64, err error) {
+	gidMax = limitGidRange(gidMin, gidMax)
+	for gid := gidMin; gid <= gidMax; gid++ {
+		if !usedGids[gid] {
+			klog.V(5).Infof("Allocator found unused GID: %v", gid)
+			return gid, nil
 		}
-		return
 	}
+	return -1, errGidRangeExhausted
+}
 
-	nextGid = -1
-	lookup(usedGids)
-	if nextGid == -1 {
-		err = fmt.Errorf("allocator failed to find available GID")
-		return
+// errGidRangeExhausted is returned when every GID of the range is used by an access point of the file system
+var errGidRangeExhausted = errors.New("allocator failed to find available GID")
+
+// errGidCollision is returned when the GID of a new access point was taken by an access point created concurrently,
+// e.g. by another controller between the listing of the used GIDs and the creation
+var errGidCollision = errors.New("GID taken by another access point")
+
+// createAccessPointWithAllocatedGid creates the access point with the GID allocated to it, and checks that no other
+// access point took the GID in the meantime before marking it as provisioned. On collision, the access point is
+// deleted and created again with a GID allocated from a fresh listing of the used GIDs, until the deadline of ctx.
+// The uid is allocated again along with the GID if it was allocated with it.
+func (d *Driver) createAccessPointWithAllocatedGid(ctx context.Context, localCloud cloud.Cloud, clientToken string, accessPointOpts *cloud.AccessPointOptions, uidAllocated bool, gidMin, gidMax int64) (*cloud.AccessPoint, error) {
+	fsId := accessPointOpts.FileSystemId
+	for {
+		if ctx.Err() != nil {
+			return nil, cloud.ErrDeadlineExceeded
+		}
+		// The client token is kept across attempts: the access point of a collision is deleted before the next
+		// attempt, so that a retried CreateVolume finds the access point of its last attempt by client token
+		accessPoint, err := createPendingAccessPoint(ctx, localCloud, clientToken, accessPointOpts)
+		if err != nil {
+			return nil, err
+		}
+		if accessPoint.Pending {
+			err = checkGidCollision(ctx, localCloud, accessPoint, accessPointOpts.Gid)
+			if errors.Is(err, errGidCollision) {
+				klog.Warningf("Deleting access point %v and allocating another GID: %v", accessPoint.AccessPointId, err)
+				if err := localCloud.DeleteAccessPoint(ctx, accessPoint.AccessPointId); err != nil {
+					return nil, err
+				}
+				usedGids, err := listUsedGids(ctx, localCloud, fsId, gidMin, gidMax)
+				if err != nil {
+					return nil, err
+				}
+				gid, err := d.gidAllocator.getNextGid(fsId, usedGids, gidMin, gidMax)
+				if err != nil {
+					return nil, err
+				}
+				if uidAllocated {
+					accessPointOpts.Uid = gid
+				}
+				accessPointOpts.Gid = gid
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := markAccessPointProvisioned(ctx, localCloud, accessPoint); err != nil {
+			return nil, err
+		}
+		return accessPoint, nil
 	}
+}
 
-	klog.V(5).Infof("Allocator found unused GID: %v", nextGid)
-	return
+// checkGidCollision returns errGidCollision if another access point of the file system uses the GID of the pending
+// access point and keeps it: it is provisioned already, or it is pending too and has a smaller ID, so that exactly
+// one of the access points created concurrently with the same GID keeps it.
+func checkGidCollision(ctx context.Context, localCloud cloud.Cloud, accessPoint *cloud.AccessPoint, gid int64) error {
+	var collision string
+	err := localCloud.ListAccessPointsPages(ctx, accessPoint.FileSystemId, func(accessPoints []*cloud.AccessPoint) bool {
+		for _, ap := range accessPoints {
+			if ap == nil || ap.PosixUser == nil || ap.PosixUser.Gid != gid || ap.AccessPointId == accessPoint.AccessPointId {
+				continue
+			}
+			if !ap.Pending || ap.AccessPointId < accessPoint.AccessPointId {
+				collision = ap.AccessPointId
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if collision != "" {
+		return fmt.Errorf("%w: GID %d of access point %v is used by access point %v", errGidCollision, gid, accessPoint.AccessPointId, collision)
+	}
+	return nil
 }
@@ -0,0 +1,213 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func accessPointsWithGids(gids ...int64) []*cloud.AccessPoint {
+	var accessPoints []*cloud.AccessPoint
+	for _, gid := range gids {
+		accessPoints = append(accessPoints, &cloud.AccessPoint{PosixUser: &cloud.PosixUser{Gid: gid, Uid: gid}})
+	}
+	return accessPoints
+}
+
+func TestListUsedGids(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	ctx := context.Background()
+
+	// GIDs out of the range are not collected, and all the pages are listed while a GID is free
+	pages := [][]*cloud.AccessPoint{accessPointsWithGids(999, 1000), accessPointsWithGids(1001, 2000), {nil}}
+	mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), "fs-abcd1234", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, fn func([]*cloud.AccessPoint) bool) error {
+			for _, page := range pages {
+				if !fn(page) {
+					t.Fatal("Expected all the pages to be listed")
+				}
+			}
+			return nil
+		})
+	usedGids, err := listUsedGids(ctx, mockCloud, "fs-abcd1234", 1000, 1002)
+	if err != nil {
+		t.Fatalf("Failed to list used GIDs: %v", err)
+	}
+	if expected := map[int64]bool{1000: true, 1001: true}; !reflect.DeepEqual(usedGids, expected) {
+		t.Fatalf("Expected %v, got %v", expected, usedGids)
+	}
+	if gid, err := getNextUnusedGid(usedGids, 1000, 1002); err != nil || gid != 1002 {
+		t.Fatalf("Expected GID 1002, got %v: %v", gid, err)
+	}
+
+	// Listing stops once the range is exhausted
+	mockCloud.EXPECT().ListAccessPointsPages(gomock.Eq(ctx), "fs-abcd1234", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, fn func([]*cloud.AccessPoint) bool) error {
+			if fn(accessPointsWithGids(1000, 1001)) {
+				t.Fatal("Expected listing to stop once every GID is in use")
+			}
+			return nil
+		})
+	usedGids, err = listUsedGids(ctx, mockCloud, "fs-abcd1234", 1000, 1001)
+	if err != nil {
+		t.Fatalf("Failed to list used GIDs: %v", err)
+	}
+	if _, err := getNextUnusedGid(usedGids, 1000, 1001); err == nil {
+		t.Fatal("Expected no GID to be available")
+	}
+}
+
+func TestGidAllocatorReservations(t *testing.T) {
+	allocator := NewGidAllocator()
+	usedGids := map[int64]bool{1000: true}
+
+	// Concurrent CreateVolume calls sharing the same listing get distinct GIDs
+	for _, expected := range []int64{1001, 1002} {
+		gid, err := allocator.getNextGid("fs-abcd1234", usedGids, 1000, 1010)
+		if err != nil || gid != expected {
+			t.Fatalf("Expected GID %d, got %v: %v", expected, gid, err)
+		}
+	}
+	if len(usedGids) != 1 {
+		t.Fatalf("Expected the listed GIDs to be left as is, got %v", usedGids)
+	}
+	// Reservations are per file system
+	if gid, err := allocator.getNextGid("fs-efgh5678", usedGids, 1000, 1010); err != nil || gid != 1001 {
+		t.Fatalf("Expected GID 1001, got %v: %v", gid, err)
+	}
+	// Expired reservations are released
+	allocator.reserved["fs-abcd1234"][1001] = time.Now().Add(-2 * gidReservationTTL)
+	if gid, err := allocator.getNextGid("fs-abcd1234", usedGids, 1000, 1010); err != nil || gid != 1001 {
+		t.Fatalf("Expected GID 1001, got %v: %v", gid, err)
+	}
+	// Exhausted ranges are reported as such
+	if _, err := allocator.getNextGid("fs-abcd1234", usedGids, 1000, 1001); !errors.Is(err, errGidRangeExhausted) {
+		t.Fatalf("Expected errGidRangeExhausted, got %v", err)
+	}
+}
+
+func TestCreateAccessPointWithAllocatedGid(t *testing.T) {
+	fsId := "fs-abcd1234"
+	clientToken := "pvc-1"
+	gidOf := func(id string, gid int64, pending bool) *cloud.AccessPoint {
+		return &cloud.AccessPoint{AccessPointId: id, FileSystemId: fsId, PosixUser: &cloud.PosixUser{Gid: gid, Uid: gid}, Pending: pending}
+	}
+
+	testCases := []struct {
+		name     string
+		testFunc func(t *testing.T, mockCloud *mocks.MockCloud, driver *Driver)
+	}{
+		{
+			name: "Success: no collision",
+			testFunc: func(t *testing.T, mockCloud *mocks.MockCloud, driver *Driver) {
+				created := gidOf("fsap-b", 1000, true)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Any(), clientToken, gomock.Any()).Return(created, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{gidOf("fsap-a", 999, false), created}, nil))
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Any(), "fsap-b").Return(nil)
+
+				opts := &cloud.AccessPointOptions{FileSystemId: fsId, Uid: 1000, Gid: 1000}
+				ap, err := driver.createAccessPointWithAllocatedGid(context.Background(), mockCloud, clientToken, opts, true, 999, 1010)
+				if err != nil || ap.AccessPointId != "fsap-b" || ap.Pending {
+					t.Fatalf("Expected provisioned access point fsap-b, got %+v: %v", ap, err)
+				}
+			},
+		},
+		{
+			name: "Success: access point created by another controller in between takes the GID",
+			testFunc: func(t *testing.T, mockCloud *mocks.MockCloud, driver *Driver) {
+				// fsap-a was created by another controller after the GIDs were listed
+				other := gidOf("fsap-a", 1000, false)
+				gomock.InOrder(
+					mockCloud.EXPECT().CreateAccessPoint(gomock.Any(), clientToken, gomock.Any()).Return(gidOf("fsap-b", 1000, true), nil),
+					mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{other, gidOf("fsap-b", 1000, true)}, nil)),
+					mockCloud.EXPECT().DeleteAccessPoint(gomock.Any(), "fsap-b").Return(nil),
+					mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{other}, nil)),
+					mockCloud.EXPECT().CreateAccessPoint(gomock.Any(), clientToken, gomock.Any()).DoAndReturn(
+						func(_ context.Context, _ string, opts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+							if opts.Gid != 1001 || opts.Uid != 1001 {
+								t.Fatalf("Expected uid and gid 1001, got %d and %d", opts.Uid, opts.Gid)
+							}
+							return gidOf("fsap-c", 1001, true), nil
+						}),
+					mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{other, gidOf("fsap-c", 1001, true)}, nil)),
+					mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Any(), "fsap-c").Return(nil),
+				)
+
+				opts := &cloud.AccessPointOptions{FileSystemId: fsId, Uid: 1000, Gid: 1000}
+				ap, err := driver.createAccessPointWithAllocatedGid(context.Background(), mockCloud, clientToken, opts, true, 1000, 1010)
+				if err != nil || ap.AccessPointId != "fsap-c" {
+					t.Fatalf("Expected access point fsap-c, got %+v: %v", ap, err)
+				}
+			},
+		},
+		{
+			name: "Success: concurrent pending access point with a greater ID yields the GID",
+			testFunc: func(t *testing.T, mockCloud *mocks.MockCloud, driver *Driver) {
+				created := gidOf("fsap-a", 1000, true)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Any(), clientToken, gomock.Any()).Return(created, nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{created, gidOf("fsap-b", 1000, true)}, nil))
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Any(), "fsap-a").Return(nil)
+
+				opts := &cloud.AccessPointOptions{FileSystemId: fsId, Uid: 1000, Gid: 1000}
+				if _, err := driver.createAccessPointWithAllocatedGid(context.Background(), mockCloud, clientToken, opts, true, 1000, 1010); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			},
+		},
+		{
+			name: "Fail: deadline exceeded while retrying",
+			testFunc: func(t *testing.T, mockCloud *mocks.MockCloud, driver *Driver) {
+				ctx, cancel := context.WithCancel(context.Background())
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Any(), clientToken, gomock.Any()).Return(gidOf("fsap-b", 1000, true), nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(listAccessPointsPages([]*cloud.AccessPoint{gidOf("fsap-a", 1000, false)}, nil))
+				mockCloud.EXPECT().DeleteAccessPoint(gomock.Any(), "fsap-b").Return(nil)
+				mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), fsId, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, fsId string, fn func([]*cloud.AccessPoint) bool) error {
+						cancel()
+						fn([]*cloud.AccessPoint{gidOf("fsap-a", 1000, false)})
+						return nil
+					})
+
+				opts := &cloud.AccessPointOptions{FileSystemId: fsId, Uid: 0, Gid: 1000}
+				if _, err := driver.createAccessPointWithAllocatedGid(ctx, mockCloud, clientToken, opts, false, 1000, 1010); err != cloud.ErrDeadlineExceeded {
+					t.Fatalf("Expected ErrDeadlineExceeded, got %v", err)
+				}
+				if opts.Uid != 0 {
+					t.Fatalf("Expected the uid which was not allocated to be kept, got %d", opts.Uid)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			tc.testFunc(t, mocks.NewMockCloud(mockCtl), &Driver{gidAllocator: NewGidAllocator()})
+		})
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// GidRangeAuditAnnotation requests an audit of the GIDs of the access points of the volumes of a
+	// storage class against its current GID range, e.g. after changing gidRangeStart and gidRangeEnd.
+	// It is removed once the audit is done.
+	GidRangeAuditAnnotation = "efs.csi.aws.com/gid-range-audit"
+	// GidRangeAuditResultAnnotation holds the JSON result of the last audit of a storage class
+	GidRangeAuditResultAnnotation = "efs.csi.aws.com/gid-range-audit-result"
+	// GidRangeAuditReport only reports the access points outside the range
+	GidRangeAuditReport = "report"
+	// GidRangeAuditTag also tags the access points outside the range with GidRangeConflictTagKey
+	GidRangeAuditTag = "tag"
+	// GidRangeConflictTagKey records the GID range of the storage class an access point is outside of
+	GidRangeConflictTagKey = "efs.csi.aws.com/gid-range-conflict"
+
+	GidRangeAuditEventReason = "GidRangeAudit"
+)
+
+// gidRangeAuditResult is the result of the audit of a storage class. CoveringGidRangeStart and
+// CoveringGidRangeEnd are the smallest range including the range of the storage class and the GIDs of
+// all its access points, which can be set on the storage class to keep the existing volumes valid.
+type gidRangeAuditResult struct {
+	Time                  string             `json:"time"`
+	Mode                  string             `json:"mode"`
+	GidRangeStart         int64              `json:"gidRangeStart,omitempty"`
+	GidRangeEnd           int64              `json:"gidRangeEnd,omitempty"`
+	AccessPoints          int                `json:"accessPoints"`
+	Conflicts             []gidRangeConflict `json:"conflicts,omitempty"`
+	CoveringGidRangeStart int64              `json:"coveringGidRangeStart,omitempty"`
+	CoveringGidRangeEnd   int64              `json:"coveringGidRangeEnd,omitempty"`
+	Error                 string             `json:"error,omitempty"`
+}
+
+// gidRangeConflict is an access point of a storage class whose GID is outside of its range
+type gidRangeConflict struct {
+	AccessPointId         string `json:"accessPointId"`
+	Gid                   int64  `json:"gid"`
+	PersistentVolume      string `json:"persistentVolume"`
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	Tagged                bool   `json:"tagged,omitempty"`
+}
+
+// gidRangeAuditor polls the storage classes of the driver for GidRangeAuditAnnotation, audits the
+// access points of their volumes and records the result on the storage class and in an event
+type gidRangeAuditor struct {
+	interval  time.Duration
+	k8sClient cloud.KubernetesAPIClient
+	aliases   *fileSystemAliases
+}
+
+// newGidRangeAuditor returns the auditor polling once per interval, or nil if the interval is 0
+func newGidRangeAuditor(interval time.Duration, k8sClient cloud.KubernetesAPIClient) *gidRangeAuditor {
+	if interval <= 0 {
+		return nil
+	}
+	return &gidRangeAuditor{
+		interval:  interval,
+		k8sClient: k8sClient,
+	}
+}
+
+// run audits the annotated storage classes once per interval until stopCh is closed, using the cloud
+// returned by storageClassCloud for each of them
+func (a *gidRangeAuditor) run(storageClassCloud func(*storagev1.StorageClass) (cloud.Cloud, error), stopCh <-chan struct{}) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		if err := a.poll(context.Background(), storageClassCloud); err != nil {
+			klog.Warningf("Failed to audit the GID ranges of the storage classes: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (a *gidRangeAuditor) poll(ctx context.Context, storageClassCloud func(*storagev1.StorageClass) (cloud.Cloud, error)) error {
+	clientset, err := a.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list storage classes: %v", err)
+	}
+	for idx := range scs.Items {
+		sc := &scs.Items[idx]
+		mode, ok := sc.Annotations[GidRangeAuditAnnotation]
+		if sc.Provisioner != driverName || !ok {
+			continue
+		}
+		klog.Infof("Auditing the GID range of storage class %s", sc.Name)
+		result := a.audit(ctx, clientset, sc, mode, storageClassCloud)
+		if err := a.record(ctx, clientset, sc, result); err != nil {
+			klog.Warningf("Failed to record the GID range audit of storage class %s: %v", sc.Name, err)
+		}
+	}
+	return nil
+}
+
+// audit lists the access points of the file system of the storage class and compares the GIDs of those
+// of its volumes to its range, tagging them in GidRangeAuditTag mode
+func (a *gidRangeAuditor) audit(ctx context.Context, clientset kubernetes.Interface, sc *storagev1.StorageClass, mode string, storageClassCloud func(*storagev1.StorageClass) (cloud.Cloud, error)) *gidRangeAuditResult {
+	result := &gidRangeAuditResult{Time: time.Now().UTC().Format(time.RFC3339), Mode: mode}
+	if mode != GidRangeAuditReport && mode != GidRangeAuditTag {
+		result.Error = fmt.Sprintf("invalid mode %q, must be %s or %s", mode, GidRangeAuditReport, GidRangeAuditTag)
+		return result
+	}
+	gidMin, gidMax, err := storageClassGidRange(sc.Parameters)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.GidRangeStart, result.GidRangeEnd = gidMin, gidMax
+
+	fsId, err := a.aliases.storageClassFileSystemId(sc.Parameters)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	localCloud, err := storageClassCloud(sc)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create EFS API client: %v", err)
+		return result
+	}
+
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to list persistent volumes: %v", err)
+		return result
+	}
+	volumes := map[string]*corev1.PersistentVolume{}
+	for idx := range pvs.Items {
+		pv := &pvs.Items[idx]
+		if pv.Spec.StorageClassName != sc.Name || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		pvFsId, _, apId, err := parseVolumeId(pv.Spec.CSI.VolumeHandle)
+		if err != nil || apId == "" || pvFsId != fsId {
+			continue
+		}
+		volumes[apId] = pv
+	}
+
+	accessPoints, err := localCloud.ListAccessPoints(ctx, fsId)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to list access points of file system %s: %v", fsId, err)
+		return result
+	}
+	result.CoveringGidRangeStart, result.CoveringGidRangeEnd = gidMin, gidMax
+	for _, ap := range accessPoints {
+		pv, ok := volumes[ap.AccessPointId]
+		if !ok || ap.PosixUser == nil {
+			continue
+		}
+		result.AccessPoints++
+		gid := ap.PosixUser.Gid
+		if gid >= gidMin && gid <= gidMax {
+			continue
+		}
+		conflict := gidRangeConflict{AccessPointId: ap.AccessPointId, Gid: gid, PersistentVolume: pv.Name}
+		if pv.Spec.ClaimRef != nil {
+			conflict.PersistentVolumeClaim = pv.Spec.ClaimRef.Namespace + "/" + pv.Spec.ClaimRef.Name
+		}
+		if mode == GidRangeAuditTag {
+			tags := map[string]string{GidRangeConflictTagKey: fmt.Sprintf("%d-%d", gidMin, gidMax)}
+			if err := localCloud.TagResource(ctx, ap.AccessPointId, tags); err != nil {
+				klog.Warningf("Failed to tag access point %s outside of the GID range of storage class %s: %v", ap.AccessPointId, sc.Name, err)
+			} else {
+				conflict.Tagged = true
+			}
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+		if gid < result.CoveringGidRangeStart {
+			result.CoveringGidRangeStart = gid
+		}
+		if gid > result.CoveringGidRangeEnd {
+			result.CoveringGidRangeEnd = gid
+		}
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].AccessPointId < result.Conflicts[j].AccessPointId
+	})
+	return result
+}
+
+// record stores the result on the storage class, removes the audit annotation and reports the result
+// in an event of the storage class
+func (a *gidRangeAuditor) record(ctx context.Context, clientset kubernetes.Interface, sc *storagev1.StorageClass, result *gidRangeAuditResult) error {
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				GidRangeAuditAnnotation:       nil,
+				GidRangeAuditResultAnnotation: string(content),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := clientset.StorageV1().StorageClasses().Patch(ctx, sc.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch storage class: %v", err)
+	}
+
+	eventType := corev1.EventTypeNormal
+	var message string
+	switch {
+	case result.Error != "":
+		eventType = corev1.EventTypeWarning
+		message = fmt.Sprintf("GID range audit failed: %s", result.Error)
+	case len(result.Conflicts) > 0:
+		eventType = corev1.EventTypeWarning
+		message = fmt.Sprintf("%d of %d access points are outside of the GID range %d-%d, the range %d-%d covers them all",
+			len(result.Conflicts), result.AccessPoints, result.GidRangeStart, result.GidRangeEnd, result.CoveringGidRangeStart, result.CoveringGidRangeEnd)
+	default:
+		message = fmt.Sprintf("All %d access points are within the GID range %d-%d", result.AccessPoints, result.GidRangeStart, result.GidRangeEnd)
+	}
+	if eventType == corev1.EventTypeWarning {
+		klog.Warningf("Storage class %s: %s", sc.Name, message)
+	} else {
+		klog.Infof("Storage class %s: %s", sc.Name, message)
+	}
+
+	// Events of cluster scoped objects are stored in the default namespace
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: sc.Name + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "storage.k8s.io/v1",
+			Kind:       "StorageClass",
+			Name:       sc.Name,
+			UID:        sc.UID,
+		},
+		Reason:         GidRangeAuditEventReason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: driverName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err = clientset.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
+
+// storageClassGidRange returns the GID range the access points of the storage class are allocated in,
+// which is the single GID of the gid parameter if set
+func storageClassGidRange(parameters map[string]string) (int64, int64, error) {
+	if value, ok := parameters[Gid]; ok {
+		gid, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || gid < 0 {
+			return 0, 0, fmt.Errorf("invalid %v: %v", Gid, value)
+		}
+		return gid, gid, nil
+	}
+	start, hasStart := parameters[GidMin]
+	end, hasEnd := parameters[GidMax]
+	if !hasStart && !hasEnd {
+		return DefaultGidMin, DefaultGidMax, nil
+	}
+	gidMin, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || gidMin <= 0 {
+		return 0, 0, fmt.Errorf("invalid %v: %v", GidMin, start)
+	}
+	gidMax, err := strconv.ParseInt(end, 10, 64)
+	if err != nil || gidMax <= gidMin {
+		return 0, 0, fmt.Errorf("invalid %v: %v", GidMax, end)
+	}
+	return gidMin, gidMax, nil
+}
+
+// storageClassCloud returns the cloud CreateVolume would use for the storage class, without the roles
+// passed in the provisioner secrets, which are not known in advance
+func (d *Driver) storageClassCloud(sc *storagev1.StorageClass) (cloud.Cloud, error) {
+	apiConfig, err := storageClassAPIConfig(sc.Parameters, d.fileSystemAliases)
+	if err != nil {
+		return nil, err
+	}
+	if d.isDriverAPIConfig(apiConfig) {
+		return d.cloud, nil
+	}
+	return d.apiClients.get(apiConfig, d.cloudOptions)
+}
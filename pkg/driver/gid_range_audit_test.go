@@ -0,0 +1,204 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestStorageClassGidRange(t *testing.T) {
+	testCases := []struct {
+		name        string
+		parameters  map[string]string
+		expectedMin int64
+		expectedMax int64
+		expectErr   bool
+	}{
+		{name: "default range", parameters: map[string]string{}, expectedMin: DefaultGidMin, expectedMax: DefaultGidMax},
+		{name: "range", parameters: map[string]string{GidMin: "1000", GidMax: "2000"}, expectedMin: 1000, expectedMax: 2000},
+		{name: "fixed gid", parameters: map[string]string{Gid: "1500", GidMin: "1000", GidMax: "2000"}, expectedMin: 1500, expectedMax: 1500},
+		{name: "missing range end", parameters: map[string]string{GidMin: "1000"}, expectErr: true},
+		{name: "inverted range", parameters: map[string]string{GidMin: "2000", GidMax: "1000"}, expectErr: true},
+		{name: "invalid gid", parameters: map[string]string{Gid: "group"}, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gidMin, gidMax, err := storageClassGidRange(tc.parameters)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if gidMin != tc.expectedMin || gidMax != tc.expectedMax {
+				t.Fatalf("Expected range %d-%d, got %d-%d", tc.expectedMin, tc.expectedMax, gidMin, gidMax)
+			}
+		})
+	}
+}
+
+func TestGidRangeAudit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		tagged   bool
+		expected *gidRangeAuditResult
+	}{
+		{
+			name: "report",
+			mode: GidRangeAuditReport,
+			expected: &gidRangeAuditResult{
+				Mode:          GidRangeAuditReport,
+				GidRangeStart: 2000,
+				GidRangeEnd:   3000,
+				AccessPoints:  3,
+				Conflicts: []gidRangeConflict{
+					{AccessPointId: "fsap-high", Gid: 3500, PersistentVolume: "pv-3", PersistentVolumeClaim: "team-a/cache"},
+					{AccessPointId: "fsap-low", Gid: 1000, PersistentVolume: "pv-1", PersistentVolumeClaim: "team-a/data"},
+				},
+				CoveringGidRangeStart: 1000,
+				CoveringGidRangeEnd:   3500,
+			},
+		},
+		{
+			name:   "tag",
+			mode:   GidRangeAuditTag,
+			tagged: true,
+			expected: &gidRangeAuditResult{
+				Mode:          GidRangeAuditTag,
+				GidRangeStart: 2000,
+				GidRangeEnd:   3000,
+				AccessPoints:  3,
+				Conflicts: []gidRangeConflict{
+					{AccessPointId: "fsap-high", Gid: 3500, PersistentVolume: "pv-3", PersistentVolumeClaim: "team-a/cache", Tagged: true},
+					{AccessPointId: "fsap-low", Gid: 1000, PersistentVolume: "pv-1", PersistentVolumeClaim: "team-a/data", Tagged: true},
+				},
+				CoveringGidRangeStart: 1000,
+				CoveringGidRangeEnd:   3500,
+			},
+		},
+		{
+			name:     "invalid mode",
+			mode:     "fix",
+			expected: &gidRangeAuditResult{Mode: "fix", Error: `invalid mode "fix", must be report or tag`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+
+			sc := &storagev1.StorageClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "efs-sc",
+					Annotations: map[string]string{GidRangeAuditAnnotation: tc.mode},
+				},
+				Provisioner: driverName,
+				Parameters:  map[string]string{FsId: "fs-abcd1234", GidMin: "2000", GidMax: "3000"},
+			}
+			other := &storagev1.StorageClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "ebs-sc",
+					Annotations: map[string]string{GidRangeAuditAnnotation: GidRangeAuditReport},
+				},
+				Provisioner: "ebs.csi.aws.com",
+			}
+			pvs := []*corev1.PersistentVolume{
+				newAccessPointPV("pv-1", "fs-abcd1234::fsap-low", "team-a", "data"),
+				newAccessPointPV("pv-2", "fs-abcd1234::fsap-in", "team-a", "logs"),
+				newAccessPointPV("pv-3", "fs-abcd1234::fsap-high", "team-a", "cache"),
+				newAccessPointPV("pv-4", "fs-abcd1234::fsap-other", "team-b", "data"),
+			}
+			for _, pv := range pvs[:3] {
+				pv.Spec.StorageClassName = sc.Name
+			}
+			pvs[3].Spec.StorageClassName = "efs-other"
+			clientset := fake.NewSimpleClientset(sc, other, pvs[0], pvs[1], pvs[2], pvs[3])
+			auditor := newGidRangeAuditor(time.Minute, func() (kubernetes.Interface, error) {
+				return clientset, nil
+			})
+
+			ctx := context.Background()
+			if tc.expected.Error == "" {
+				mockCloud.EXPECT().ListAccessPoints(gomock.Eq(ctx), "fs-abcd1234").Return([]*cloud.AccessPoint{
+					{AccessPointId: "fsap-low", PosixUser: &cloud.PosixUser{Gid: 1000}},
+					{AccessPointId: "fsap-in", PosixUser: &cloud.PosixUser{Gid: 2500}},
+					{AccessPointId: "fsap-high", PosixUser: &cloud.PosixUser{Gid: 3500}},
+					{AccessPointId: "fsap-other", PosixUser: &cloud.PosixUser{Gid: 100}},
+					{AccessPointId: "fsap-unused", PosixUser: &cloud.PosixUser{Gid: 100}},
+				}, nil)
+			}
+			if tc.tagged {
+				tags := map[string]string{GidRangeConflictTagKey: "2000-3000"}
+				mockCloud.EXPECT().TagResource(gomock.Eq(ctx), "fsap-low", tags).Return(nil)
+				mockCloud.EXPECT().TagResource(gomock.Eq(ctx), "fsap-high", tags).Return(nil)
+			}
+
+			storageClassCloud := func(*storagev1.StorageClass) (cloud.Cloud, error) {
+				return mockCloud, nil
+			}
+			if err := auditor.poll(ctx, storageClassCloud); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated, err := clientset.StorageV1().StorageClasses().Get(ctx, sc.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := updated.Annotations[GidRangeAuditAnnotation]; ok {
+				t.Fatalf("Expected the audit annotation to be removed, got %v", updated.Annotations)
+			}
+			actual := &gidRangeAuditResult{}
+			if err := json.Unmarshal([]byte(updated.Annotations[GidRangeAuditResultAnnotation]), actual); err != nil {
+				t.Fatal(err)
+			}
+			actual.Time = ""
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Expected result %+v, got %+v", tc.expected, actual)
+			}
+
+			events, err := clientset.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events.Items) != 1 || events.Items[0].Reason != GidRangeAuditEventReason || events.Items[0].Type != corev1.EventTypeWarning {
+				t.Fatalf("Expected a warning event, got %+v", events.Items)
+			}
+
+			// Storage classes of other provisioners are ignored
+			ignored, err := clientset.StorageV1().StorageClasses().Get(ctx, other.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := ignored.Annotations[GidRangeAuditAnnotation]; !ok {
+				t.Fatalf("Expected storage class %s to be ignored", other.Name)
+			}
+		})
+	}
+}
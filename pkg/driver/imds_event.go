@@ -0,0 +1,80 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// IMDSv2HopLimitEventReason is the reason of the Event recorded on the node when the driver cannot start
+// because the hop limit of the instance metadata options blocks the IMDSv2 tokens
+const IMDSv2HopLimitEventReason = "IMDSv2HopLimit"
+
+// reportIMDSv2HopLimit records the Event of recordIMDSv2HopLimit on the node of the driver if the cloud could
+// not be created because of the hop limit
+func reportIMDSv2HopLimit(err error) {
+	if !errors.Is(err, cloud.ErrIMDSv2HopLimit) {
+		return
+	}
+	if eventErr := recordIMDSv2HopLimit(cloud.DefaultKubernetesAPIClient, os.Getenv("CSI_NODE_NAME"), err); eventErr != nil {
+		klog.Warningf("Failed to record the IMDSv2 hop limit Event: %v", eventErr)
+	}
+}
+
+// recordIMDSv2HopLimit records a warning Event with the remediation of the hop limit on the node, as the
+// driver exits before its logs are looked at
+func recordIMDSv2HopLimit(k8sClient cloud.KubernetesAPIClient, nodeName string, cause error) error {
+	if nodeName == "" {
+		return fmt.Errorf("CSI_NODE_NAME missing")
+	}
+	clientset, err := k8sClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	now := metav1.Now()
+	// Events of cluster scoped objects are stored in the default namespace
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: nodeName + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       nodeName,
+		},
+		Reason:         IMDSv2HopLimitEventReason,
+		Message:        fmt.Sprintf("The EFS CSI driver cannot start: %v", cause),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: driverName, Host: nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err = clientset.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+func TestRecordIMDSv2HopLimit(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	k8sClient := func() (kubernetes.Interface, error) { return clientset, nil }
+	cause := fmt.Errorf("%w: %s", cloud.ErrIMDSv2HopLimit, cloud.IMDSv2HopLimitRemediation)
+
+	if err := recordIMDSv2HopLimit(k8sClient, "", cause); err == nil {
+		t.Fatal("Expected an error without node name")
+	}
+	if err := recordIMDSv2HopLimit(k8sClient, "ip-10-0-0-1", cause); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	events, err := clientset.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("Expected one event, got %+v", events.Items)
+	}
+	event := events.Items[0]
+	if event.Reason != IMDSv2HopLimitEventReason || event.Type != corev1.EventTypeWarning || event.InvolvedObject.Kind != "Node" ||
+		event.InvolvedObject.Name != "ip-10-0-0-1" || !strings.Contains(event.Message, "hop-limit 2") {
+		t.Fatalf("Expected a warning event on the node with the remediation, got %+v", event)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+)
+
+// ipFamily is the address family of the mount target of a volume, set by its IpFamily volume attribute
+type ipFamily string
+
+const (
+	ipFamilyIPv4 ipFamily = "ipv4"
+	ipFamilyIPv6 ipFamily = "ipv6"
+	// ipFamilyDualStack prefers the IPv4 address of the mount target and falls back to its IPv6 address
+	ipFamilyDualStack ipFamily = "dualstack"
+)
+
+// ipFamilies are the values of the IpFamily volume attribute
+var ipFamilies = []ipFamily{ipFamilyIPv4, ipFamilyIPv6, ipFamilyDualStack}
+
+func isIPFamily(value string) bool {
+	for _, family := range ipFamilies {
+		if ipFamily(value) == family {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeIPFamily returns the address family of the volume, IPv4 unless set
+func volumeIPFamily(volContext volumeContext) ipFamily {
+	if value, ok := volContext.get(IpFamily); ok {
+		return ipFamily(value)
+	}
+	return ipFamilyIPv4
+}
+
+// allows reports whether the address is of the family
+func (f ipFamily) allows(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	switch f {
+	case ipFamilyIPv6:
+		return ip.To4() == nil
+	case ipFamilyDualStack:
+		return true
+	}
+	return ip.To4() != nil
+}
+
+// pick returns the first address of the family among the addresses, preferring IPv4 for dual stack
+func (f ipFamily) pick(addrs []string) (string, bool) {
+	preferred := f
+	if f == ipFamilyDualStack {
+		preferred = ipFamilyIPv4
+	}
+	for _, addr := range addrs {
+		if preferred.allows(addr) {
+			return addr, true
+		}
+	}
+	if f == ipFamilyDualStack {
+		return ipFamilyIPv6.pick(addrs)
+	}
+	return "", false
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+
+	cloudmocks "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestIPFamilyPick(t *testing.T) {
+	testCases := []struct {
+		family   ipFamily
+		addrs    []string
+		expected string
+	}{
+		{family: ipFamilyIPv4, addrs: []string{"fd00::1", "10.0.0.1"}, expected: "10.0.0.1"},
+		{family: ipFamilyIPv4, addrs: []string{"fd00::1"}},
+		{family: ipFamilyIPv6, addrs: []string{"10.0.0.1", "fd00::1"}, expected: "fd00::1"},
+		{family: ipFamilyIPv6, addrs: []string{"10.0.0.1"}},
+		{family: ipFamilyDualStack, addrs: []string{"fd00::1", "10.0.0.1"}, expected: "10.0.0.1"},
+		{family: ipFamilyDualStack, addrs: []string{"fd00::1"}, expected: "fd00::1"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s %v", tc.family, tc.addrs), func(t *testing.T) {
+			addr, ok := tc.family.pick(tc.addrs)
+			if ok != (tc.expected != "") || addr != tc.expected {
+				t.Fatalf("Expected address %q, got %q", tc.expected, addr)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeIPFamilyAndPort(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		volumeId      string
+		volumeContext map[string]string
+		expectOpts    []string
+		expectError   errtyp
+	}{
+		{
+			name:          "success: IPv6 mount target IP",
+			volumeContext: map[string]string{"mountTargetIp": "fd00::10", "ipFamily": "ipv6"},
+			expectOpts:    []string{"mounttargetip=fd00::10", "tls"},
+		},
+		{
+			name:          "success: IPv6 address resolved",
+			volumeContext: map[string]string{"ipFamily": "ipv6"},
+			expectOpts:    []string{"tls", "mounttargetip=fd00::2"},
+		},
+		{
+			name:          "success: IPv4 address resolved for dual stack",
+			volumeContext: map[string]string{"ipFamily": "dualstack"},
+			expectOpts:    []string{"tls", "mounttargetip=10.0.0.2"},
+		},
+		{
+			name:          "success: custom port",
+			volumeContext: map[string]string{"mountTargetIp": "192.168.0.10", "mountTargetPort": "12049", "encryptInTransit": "false"},
+			expectOpts:    []string{"mounttargetip=192.168.0.10", "port=12049"},
+		},
+		{
+			name:          "fail: IPv6 mount target IP without ipFamily",
+			volumeContext: map[string]string{"mountTargetIp": "fd00::10"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "mounttargetip" fd00::10 is not an address of the "ipfamily" ipv4`,
+			},
+		},
+		{
+			name:          "fail: mount target IP not an IP address",
+			volumeContext: map[string]string{"mountTargetIp": "fs-abc123.efs.us-east-1.amazonaws.com"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "mountTargetIp" must be an IP address`,
+			},
+		},
+		{
+			name:          "fail: invalid port",
+			volumeContext: map[string]string{"mountTargetPort": "70000", "encryptInTransit": "false"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "mountTargetPort" must be a port between 1 and 65535`,
+			},
+		},
+		{
+			name:          "fail: custom port with encryption in transit",
+			volumeContext: map[string]string{"mountTargetPort": "12049"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "mounttargetport" conflicts with "encryptintransit"`,
+			},
+		},
+		{
+			name:          "fail: custom port with an access point",
+			volumeId:      volumeId + "::fsap-abcd1234",
+			volumeContext: map[string]string{"mountTargetPort": "12049", "encryptInTransit": "false"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "mounttargetport" is not supported with an access point, which is mounted with TLS`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			mockCloud := mocks.NewMockCloud(mockCtrl)
+			mockMetadata := cloudmocks.NewMockMetadataService(mockCtrl)
+			driver.cloud = mockCloud
+			driver.dnsResolver = &dnsResolver{
+				lookupHost: func(_ context.Context, host string) ([]string, error) {
+					if host == "us-east-1a."+volumeId+".efs.us-east-1.amazonaws.com" {
+						return []string{"fd00::2", "10.0.0.2"}, nil
+					}
+					return nil, fmt.Errorf("no such host %s", host)
+				},
+			}
+			mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+			mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+			mockMetadata.EXPECT().GetAvailabilityZone().Return("us-east-1a").AnyTimes()
+
+			if tc.expectError.code == "" {
+				mockMounter.EXPECT().MakeDir(targetPath).Return(nil)
+				mockMounter.EXPECT().Mount(volumeId+":/", targetPath, "efs", tc.expectOpts).Return(nil)
+			}
+
+			id := tc.volumeId
+			if id == "" {
+				id = volumeId
+			}
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         id,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+				VolumeContext:    tc.volumeContext,
+			})
+			testResult(t, "NodePublishVolume", ret, err, tc.expectError)
+		})
+	}
+}
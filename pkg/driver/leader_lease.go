@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod of the driver
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// leaderLease elects the controller replica running a background loop with a coordination.k8s.io Lease, so that
+// the loops acting on the whole cluster run on a single replica. The holder renews the Lease each time it runs
+// the loop, and another replica takes it over once it was not renewed for the duration, e.g. after the holder
+// was deleted. A nil leaderLease is valid and always leads.
+type leaderLease struct {
+	name      string
+	namespace string
+	identity  string
+	duration  time.Duration
+	k8sClient cloud.KubernetesAPIClient
+	now       func() time.Time
+}
+
+// newLeaderLease returns the Lease of the name in the namespace of the driver, held by the replica of the host
+func newLeaderLease(name string, duration time.Duration, k8sClient cloud.KubernetesAPIClient) *leaderLease {
+	namespace := metav1.NamespaceSystem
+	if content, err := os.ReadFile(serviceAccountNamespaceFile); err == nil && strings.TrimSpace(string(content)) != "" {
+		namespace = strings.TrimSpace(string(content))
+	}
+	identity, _ := os.Hostname()
+	return &leaderLease{
+		name:      name,
+		namespace: namespace,
+		identity:  identity,
+		duration:  duration,
+		k8sClient: k8sClient,
+		now:       time.Now,
+	}
+}
+
+// acquire creates, renews or takes over the Lease and returns whether this replica holds it. The replica that
+// loses a race for the Lease does not hold it.
+func (l *leaderLease) acquire(ctx context.Context) (bool, error) {
+	if l == nil {
+		return true, nil
+	}
+	clientset, err := l.k8sClient()
+	if err != nil {
+		return false, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	leases := clientset.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	durationSeconds := int32(l.duration.Seconds())
+
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: l.name, Namespace: l.namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to create lease %s/%s: %v", l.namespace, l.name, err)
+		}
+		klog.Infof("Acquired lease %s/%s", l.namespace, l.name)
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease %s/%s: %v", l.namespace, l.name, err)
+	}
+
+	held := lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == l.identity
+	if !held && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" && lease.Spec.RenewTime != nil {
+		duration := l.duration
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+		if l.now().Before(lease.Spec.RenewTime.Add(duration)) {
+			return false, nil
+		}
+	}
+	if !held {
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.HolderIdentity = &l.identity
+		lease.Spec.AcquireTime = &now
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update lease %s/%s: %v", l.namespace, l.name, err)
+	}
+	if !held {
+		klog.Infof("Took over lease %s/%s", l.namespace, l.name)
+	}
+	return true, nil
+}
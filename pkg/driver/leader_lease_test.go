@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaderLeaseAcquire(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newLease := func(identity string) *leaderLease {
+		l := newLeaderLease("test", time.Minute, func() (kubernetes.Interface, error) { return clientset, nil })
+		l.namespace = "kube-system"
+		l.identity = identity
+		l.now = func() time.Time { return now }
+		return l
+	}
+	a, b := newLease("controller-a"), newLease("controller-b")
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		lease    *leaderLease
+		elapsed  time.Duration
+		expected bool
+	}{
+		{name: "created", lease: a, expected: true},
+		{name: "held by another replica", lease: b, elapsed: 30 * time.Second, expected: false},
+		{name: "renewed", lease: a, expected: true},
+		{name: "still held after the renewal", lease: b, elapsed: 45 * time.Second, expected: false},
+		{name: "taken over once expired", lease: b, elapsed: 30 * time.Second, expected: true},
+		{name: "lost", lease: a, expected: false},
+	}
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		leader, err := step.lease.acquire(ctx)
+		if err != nil {
+			t.Fatalf("%s: acquire failed: %v", step.name, err)
+		}
+		if leader != step.expected {
+			t.Fatalf("%s: expected leader %v, got %v", step.name, step.expected, leader)
+		}
+	}
+	lease, err := clientset.CoordinationV1().Leases("kube-system").Get(ctx, "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *lease.Spec.HolderIdentity != "controller-b" || *lease.Spec.LeaseTransitions != 1 {
+		t.Fatalf("Unexpected lease %+v", lease.Spec)
+	}
+
+	var nilLease *leaderLease
+	if leader, err := nilLease.acquire(ctx); !leader || err != nil {
+		t.Fatalf("Expected a nil lease to lead, got %v: %v", leader, err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// LegacyMigrationReport only reports which legacy volumes can be migrated
+	LegacyMigrationReport = "report"
+	// LegacyMigrationDryRun prints the CSI persistent volumes that would replace the legacy ones
+	LegacyMigrationDryRun = "dry-run"
+	// LegacyMigrationApply replaces the legacy persistent volumes that are not bound
+	LegacyMigrationApply = "apply"
+
+	// DefaultLegacyProvisionerName is the provisioner name used in the efs-provisioner examples
+	DefaultLegacyProvisionerName = "example.com/aws-efs"
+
+	provisionedByAnnotation   = "pv.kubernetes.io/provisioned-by"
+	legacyVolumeDeleteTimeout = 30 * time.Second
+	// migratedFromAnnotation records the legacy provisioner of a migrated persistent volume
+	migratedFromAnnotation = "efs.csi.aws.com/migrated-from"
+)
+
+const (
+	legacyVolumeMigratable = "migratable"
+	legacyVolumeMigrated   = "migrated"
+	legacyVolumeSkipped    = "skipped"
+	legacyVolumeInvalid    = "invalid"
+)
+
+// legacyNfsServerRegex matches the EFS DNS names used by the efs-provisioner as NFS server
+var legacyNfsServerRegex = regexp.MustCompile(`^(?:[a-z0-9-]+\.)?(fs-[0-9a-f]+)\.efs\.[a-z0-9-]+\.amazonaws\.com(?:\.cn)?$`)
+
+// LegacyVolumeReport is the migration result of a single persistent volume
+type LegacyVolumeReport struct {
+	Name         string `json:"name"`
+	Phase        string `json:"phase"`
+	Server       string `json:"server"`
+	Path         string `json:"path"`
+	VolumeHandle string `json:"volumeHandle,omitempty"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// MigrateLegacyVolumes scans the persistent volumes created by the legacy efs-provisioner and, depending on the mode,
+// reports, prints or applies their CSI replacement. The spec of a persistent volume is immutable, so applying
+// recreates the volume with the same name, which is only done for volumes that are not bound to a claim.
+// The reclaim policy of the replaced volumes is set to Retain beforehand so their data is never deleted.
+func MigrateLegacyVolumes(k8sClient cloud.KubernetesAPIClient, provisionerName, mode string, out io.Writer) error {
+	if mode != LegacyMigrationReport && mode != LegacyMigrationDryRun && mode != LegacyMigrationApply {
+		return fmt.Errorf("unsupported legacy migration mode %q, must be one of %s, %s or %s", mode, LegacyMigrationReport, LegacyMigrationDryRun, LegacyMigrationApply)
+	}
+
+	clientset, err := k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+
+	ctx := context.Background()
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+
+	var reports []*LegacyVolumeReport
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Annotations[provisionedByAnnotation] != provisionerName || pv.Spec.NFS == nil {
+			continue
+		}
+
+		report, migrated := migrateLegacyVolume(pv, provisionerName)
+		if migrated != nil {
+			switch mode {
+			case LegacyMigrationDryRun:
+				data, err := json.MarshalIndent(migrated, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(out, string(data))
+			case LegacyMigrationApply:
+				if err := replaceVolume(ctx, clientset, pv, migrated); err != nil {
+					report.Status = legacyVolumeInvalid
+					report.Reason = err.Error()
+				} else {
+					report.Status = legacyVolumeMigrated
+				}
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	klog.Infof("Found %d persistent volumes provisioned by %s", len(reports), provisionerName)
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(data))
+	return nil
+}
+
+// migrateLegacyVolume validates the legacy persistent volume and returns its CSI replacement, if any
+func migrateLegacyVolume(pv *corev1.PersistentVolume, provisionerName string) (*LegacyVolumeReport, *corev1.PersistentVolume) {
+	report := &LegacyVolumeReport{
+		Name:   pv.Name,
+		Phase:  string(pv.Status.Phase),
+		Server: pv.Spec.NFS.Server,
+		Path:   pv.Spec.NFS.Path,
+	}
+
+	match := legacyNfsServerRegex.FindStringSubmatch(pv.Spec.NFS.Server)
+	if match == nil {
+		report.Status = legacyVolumeInvalid
+		report.Reason = fmt.Sprintf("NFS server %q is not an EFS DNS name", pv.Spec.NFS.Server)
+		return report, nil
+	}
+	volumeHandle := match[1]
+	if subpath := path.Clean("/" + pv.Spec.NFS.Path); subpath != "/" {
+		volumeHandle = volumeHandle + ":" + subpath
+	}
+	if _, _, _, err := parseVolumeId(volumeHandle); err != nil {
+		report.Status = legacyVolumeInvalid
+		report.Reason = err.Error()
+		return report, nil
+	}
+	report.VolumeHandle = volumeHandle
+
+	if pv.Status.Phase == corev1.VolumeBound {
+		report.Status = legacyVolumeSkipped
+		report.Reason = "Volume is bound. Delete its claim after setting the reclaim policy to Retain, then migrate it again"
+		return report, nil
+	}
+
+	migrated := &corev1.PersistentVolume{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "PersistentVolume",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pv.Name,
+			Labels:      pv.Labels,
+			Annotations: map[string]string{migratedFromAnnotation: provisionerName},
+		},
+		Spec: *pv.Spec.DeepCopy(),
+	}
+	for k, v := range pv.Annotations {
+		if k != provisionedByAnnotation {
+			migrated.Annotations[k] = v
+		}
+	}
+	migrated.Spec.NFS = nil
+	migrated.Spec.PersistentVolumeSource.CSI = &corev1.CSIPersistentVolumeSource{
+		Driver:       driverName,
+		VolumeHandle: volumeHandle,
+	}
+	// The claim of a released volume is gone, let the volume be bound again
+	migrated.Spec.ClaimRef = nil
+	// The driver does not delete statically provisioned volumes
+	migrated.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+
+	report.Status = legacyVolumeMigratable
+	return report, migrated
+}
+
+func replaceVolume(ctx context.Context, clientset kubernetes.Interface, pv, migrated *corev1.PersistentVolume) error {
+	if pv.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+		retained := pv.DeepCopy()
+		retained.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+		if _, err := clientset.CoreV1().PersistentVolumes().Update(ctx, retained, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to retain persistent volume: %v", err)
+		}
+	}
+	if err := clientset.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete persistent volume: %v", err)
+	}
+	// Wait for the finalizers of the legacy volume before reusing its name
+	err := wait.PollImmediate(time.Second, legacyVolumeDeleteTimeout, func() (bool, error) {
+		_, err := clientset.CoreV1().PersistentVolumes().Get(ctx, pv.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to wait for persistent volume deletion: %v", err)
+	}
+	if _, err := clientset.CoreV1().PersistentVolumes().Create(ctx, migrated, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create CSI persistent volume, recreate it from the dry-run output: %v", err)
+	}
+	klog.Infof("Migrated persistent volume %s to volume handle %s", pv.Name, migrated.Spec.CSI.VolumeHandle)
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func legacyVolume(name, server, path string, phase corev1.PersistentVolumePhase) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{provisionedByAnnotation: DefaultLegacyProvisionerName},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: server, Path: path},
+			},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: phase},
+	}
+}
+
+func TestMigrateLegacyVolumes(t *testing.T) {
+	newClient := func() (*fake.Clientset, func() (kubernetes.Interface, error)) {
+		otherPv := legacyVolume("pv-other", "fs-abcd1234.efs.us-east-1.amazonaws.com", "/", corev1.VolumeAvailable)
+		otherPv.Annotations[provisionedByAnnotation] = "ebs.csi.aws.com"
+		clientset := fake.NewSimpleClientset(
+			legacyVolume("pv-available", "fs-abcd1234.efs.us-east-1.amazonaws.com", "/persistentvolumes/claim-pv-available", corev1.VolumeAvailable),
+			legacyVolume("pv-bound", "us-east-1a.fs-abcd1234.efs.us-east-1.amazonaws.com", "/persistentvolumes/claim-pv-bound", corev1.VolumeBound),
+			legacyVolume("pv-invalid", "10.0.0.1", "/", corev1.VolumeReleased),
+			otherPv,
+		)
+		return clientset, func() (kubernetes.Interface, error) {
+			return clientset, nil
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		mode             string
+		expectedStatuses map[string]string
+		expectError      bool
+	}{
+		{
+			name: "Success: report",
+			mode: LegacyMigrationReport,
+			expectedStatuses: map[string]string{
+				"pv-available": legacyVolumeMigratable,
+				"pv-bound":     legacyVolumeSkipped,
+				"pv-invalid":   legacyVolumeInvalid,
+			},
+		},
+		{
+			name: "Success: dry-run",
+			mode: LegacyMigrationDryRun,
+			expectedStatuses: map[string]string{
+				"pv-available": legacyVolumeMigratable,
+				"pv-bound":     legacyVolumeSkipped,
+				"pv-invalid":   legacyVolumeInvalid,
+			},
+		},
+		{
+			name: "Success: apply",
+			mode: LegacyMigrationApply,
+			expectedStatuses: map[string]string{
+				"pv-available": legacyVolumeMigrated,
+				"pv-bound":     legacyVolumeSkipped,
+				"pv-invalid":   legacyVolumeInvalid,
+			},
+		},
+		{
+			name:        "Fail: unsupported mode",
+			mode:        "migrate",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset, k8sClient := newClient()
+			out := &bytes.Buffer{}
+			err := MigrateLegacyVolumes(k8sClient, DefaultLegacyProvisionerName, tc.mode, out)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MigrateLegacyVolumes failed: %v", err)
+			}
+
+			// The report is always printed last
+			output := out.String()
+			var reports []*LegacyVolumeReport
+			if err := json.Unmarshal([]byte(output[strings.LastIndex(output, "\n[")+1:]), &reports); err != nil {
+				t.Fatalf("Failed to parse report %q: %v", output, err)
+			}
+			if len(reports) != len(tc.expectedStatuses) {
+				t.Fatalf("Expected %d reports, got %d", len(tc.expectedStatuses), len(reports))
+			}
+			for _, r := range reports {
+				if r.Status != tc.expectedStatuses[r.Name] {
+					t.Fatalf("Expected status %q for %s, got %q (%s)", tc.expectedStatuses[r.Name], r.Name, r.Status, r.Reason)
+				}
+			}
+
+			pv, err := clientset.CoreV1().PersistentVolumes().Get(context.Background(), "pv-available", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Failed to get persistent volume: %v", err)
+			}
+			if tc.mode == LegacyMigrationApply {
+				if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle != "fs-abcd1234:/persistentvolumes/claim-pv-available" || pv.Spec.NFS != nil {
+					t.Fatalf("Expected persistent volume to be migrated, got %+v", pv.Spec.PersistentVolumeSource)
+				}
+				if pv.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+					t.Fatalf("Expected migrated persistent volume to be retained, got %v", pv.Spec.PersistentVolumeReclaimPolicy)
+				}
+			} else if pv.Spec.NFS == nil {
+				t.Fatalf("Did not expect persistent volume to be migrated in %s mode", tc.mode)
+			}
+		})
+	}
+}
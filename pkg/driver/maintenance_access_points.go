@@ -0,0 +1,61 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// parseMaintenanceAccessPoints parses the comma separated fileSystemId:accessPointId pairs of the maintenance
+// access points, through which the controller mounts the file systems instead of their root
+func parseMaintenanceAccessPoints(value string) (map[string]string, error) {
+	accessPoints := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || !isValidFileSystemId(parts[0]) || !isValidAccessPointId(parts[1]) {
+			return nil, fmt.Errorf("invalid maintenance access point %q, must be of the form fs-...:fsap-...", pair)
+		}
+		if _, ok := accessPoints[parts[0]]; ok {
+			return nil, fmt.Errorf("duplicate maintenance access point of file system %s", parts[0])
+		}
+		accessPoints[parts[0]] = parts[1]
+	}
+	if len(accessPoints) == 0 {
+		return nil, nil
+	}
+	return accessPoints, nil
+}
+
+// rootMountOptions returns the options used by the controller to mount the root of the file system, through its
+// maintenance access point if any. The access point has the root directory / and the posix user the controller
+// creates, checks and deletes the directories as, so that the IAM policy of the controller does not need
+// elasticfilesystem:ClientRootAccess.
+func (d *Driver) rootMountOptions(ctx context.Context, localCloud cloud.Cloud, fileSystemId, roleArn, region string, crossAccountDNSEnabled bool) []string {
+	mountOptions := getRootMountOptions(ctx, localCloud, fileSystemId, roleArn, region, crossAccountDNSEnabled)
+	if accessPointId, ok := d.maintenanceAccessPoints[fileSystemId]; ok {
+		mountOptions = append(mountOptions, "accesspoint="+accessPointId)
+	}
+	return mountOptions
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseMaintenanceAccessPoints(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{name: "empty", value: ""},
+		{
+			name:     "pairs",
+			value:    "fs-abcd1234:fsap-abcd1234, fs-1234abcd:fsap-1234abcd",
+			expected: map[string]string{"fs-abcd1234": "fsap-abcd1234", "fs-1234abcd": "fsap-1234abcd"},
+		},
+		{name: "missing access point", value: "fs-abcd1234", expectErr: true},
+		{name: "invalid access point", value: "fs-abcd1234:ap-1", expectErr: true},
+		{name: "duplicate file system", value: "fs-abcd1234:fsap-abcd1234,fs-abcd1234:fsap-1234abcd", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			accessPoints, err := parseMaintenanceAccessPoints(tc.value)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(accessPoints, tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, accessPoints)
+			}
+		})
+	}
+}
+
+func TestRootMountOptions(t *testing.T) {
+	driver := &Driver{maintenanceAccessPoints: map[string]string{"fs-abcd1234": "fsap-abcd1234"}}
+	options := driver.rootMountOptions(context.Background(), nil, "fs-abcd1234", "", "", false)
+	if expected := []string{"tls", "iam", "accesspoint=fsap-abcd1234"}; !reflect.DeepEqual(options, expected) {
+		t.Fatalf("Expected options %v, got %v", expected, options)
+	}
+	options = driver.rootMountOptions(context.Background(), nil, "fs-1234abcd", "", "", false)
+	if expected := []string{"tls", "iam"}; !reflect.DeepEqual(options, expected) {
+		t.Fatalf("Expected the root of the file system without maintenance access point, got %v", options)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net/http"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+)
+
+const (
+	metricsNamespace = "efs_csi"
+	metricsPath      = "/metrics"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	mountDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "node",
+		Name:      "mount_duration_seconds",
+		Help:      "Latency of NodePublishVolume mount attempts per volume.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"volume_id", "result"})
+
+	attachedVolumes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "attached_volumes",
+		Help:      "Number of volumes published to each node by ControllerPublishVolume.",
+	}, []string{"node"})
+
+	configDirRemediations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "node",
+		Name:      "config_dir_remediations_total",
+		Help:      "Number of repairs of the efs-utils config directory after it drifted, per repaired object: symlink, directory or config.",
+	}, []string{"object"})
+
+	mountQueueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "node",
+		Name:      "mount_queue_length",
+		Help:      "Number of NodePublishVolume calls waiting for their turn to mount with max-concurrent-mounts.",
+	})
+
+	mountQueueWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "node",
+		Name:      "mount_queue_wait_seconds",
+		Help:      "Time NodePublishVolume calls waited for their turn to mount with max-concurrent-mounts.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+
+	tempMountCleanups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "stale_temp_mount_cleanups_total",
+		Help:      "Number of temporary paths left by a previous controller cleaned up on startup, per result: unmounted, removed or failed.",
+	}, []string{"result"})
+
+	efsAPIAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "efs_api_available",
+		Help:      "Whether the preflight EFS API call of the controller succeeded (1) or was denied (0), in which case dynamic provisioning is disabled.",
+	})
+
+	busyUnmounts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "node",
+		Name:      "busy_unmounts_total",
+		Help:      "Number of NodeUnpublishVolume targets found busy, per outcome: unmounted once no longer busy, lazy when unmounted lazily after the timeout, or failed.",
+	}, []string{"result"})
+
+	driftedTargets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "node",
+		Name:      "drifted_targets",
+		Help:      "Number of targets published on the node with mount options or attributes that their persistent volume no longer has, at the last published options check.",
+	})
+
+	orphanedDirectories = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "orphaned_directories",
+		Help:      "Number of directories of the base paths of the efs-ap storage classes of each file system that hold no persistent volume, at the last orphaned directory report.",
+	}, []string{"file_system_id"})
+
+	volumeUsageBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "volume_usage_bytes",
+		Help:      "Bytes used by the files of each persistent volume of a dedicated access point, at the last quota enforcement.",
+	}, []string{"persistent_volume"})
+
+	burstCreditBalanceBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "burst_credit_balance_bytes",
+		Help:      "Burst credit balance of each file system in bursting throughput mode, at the last CreateVolume checking it.",
+	}, []string{"file_system_id"})
+
+	lowBurstCreditProvisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "controller",
+		Name:      "low_burst_credit_provisions_total",
+		Help:      "Number of CreateVolume calls on a file system whose burst credit balance was at or below burst-credit-min-balance, per outcome: warned or failed.",
+	}, []string{"file_system_id", "result"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(mountDurationSeconds, attachedVolumes, configDirRemediations, efsAPIAvailable, mountQueueLength, mountQueueWaitSeconds, tempMountCleanups, busyUnmounts, driftedTargets, orphanedDirectories, volumeUsageBytes, burstCreditBalanceBytes, lowBurstCreditProvisions, util.DependencyCallDuration, util.DependencyCalls)
+}
+
+// startMetricsServer serves the driver metrics on the given address in the background
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	go func() {
+		klog.Infof("Serving metrics on %s%s", addr, metricsPath)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			klog.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+}
@@ -56,6 +56,46 @@ func (mr *MockEfsMockRecorder) CreateAccessPoint(arg0, arg1 interface{}, arg2 ..
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessPoint", reflect.TypeOf((*MockEfs)(nil).CreateAccessPoint), varargs...)
 }
 
+// CreateFileSystem mocks base method.
+func (m *MockEfs) CreateFileSystem(arg0 context.Context, arg1 *efs.CreateFileSystemInput, arg2 ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CreateFileSystem", varargs...)
+	ret0, _ := ret[0].(*efs.CreateFileSystemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateFileSystem indicates an expected call of CreateFileSystem.
+func (mr *MockEfsMockRecorder) CreateFileSystem(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFileSystem", reflect.TypeOf((*MockEfs)(nil).CreateFileSystem), varargs...)
+}
+
+// CreateMountTarget mocks base method.
+func (m *MockEfs) CreateMountTarget(arg0 context.Context, arg1 *efs.CreateMountTargetInput, arg2 ...func(*efs.Options)) (*efs.CreateMountTargetOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CreateMountTarget", varargs...)
+	ret0, _ := ret[0].(*efs.CreateMountTargetOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMountTarget indicates an expected call of CreateMountTarget.
+func (mr *MockEfsMockRecorder) CreateMountTarget(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMountTarget", reflect.TypeOf((*MockEfs)(nil).CreateMountTarget), varargs...)
+}
+
 // DeleteAccessPoint mocks base method.
 func (m *MockEfs) DeleteAccessPoint(arg0 context.Context, arg1 *efs.DeleteAccessPointInput, arg2 ...func(*efs.Options)) (*efs.DeleteAccessPointOutput, error) {
 	m.ctrl.T.Helper()
@@ -76,6 +116,46 @@ func (mr *MockEfsMockRecorder) DeleteAccessPoint(arg0, arg1 interface{}, arg2 ..
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccessPoint", reflect.TypeOf((*MockEfs)(nil).DeleteAccessPoint), varargs...)
 }
 
+// DeleteFileSystem mocks base method.
+func (m *MockEfs) DeleteFileSystem(arg0 context.Context, arg1 *efs.DeleteFileSystemInput, arg2 ...func(*efs.Options)) (*efs.DeleteFileSystemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteFileSystem", varargs...)
+	ret0, _ := ret[0].(*efs.DeleteFileSystemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteFileSystem indicates an expected call of DeleteFileSystem.
+func (mr *MockEfsMockRecorder) DeleteFileSystem(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileSystem", reflect.TypeOf((*MockEfs)(nil).DeleteFileSystem), varargs...)
+}
+
+// DeleteMountTarget mocks base method.
+func (m *MockEfs) DeleteMountTarget(arg0 context.Context, arg1 *efs.DeleteMountTargetInput, arg2 ...func(*efs.Options)) (*efs.DeleteMountTargetOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteMountTarget", varargs...)
+	ret0, _ := ret[0].(*efs.DeleteMountTargetOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMountTarget indicates an expected call of DeleteMountTarget.
+func (mr *MockEfsMockRecorder) DeleteMountTarget(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMountTarget", reflect.TypeOf((*MockEfs)(nil).DeleteMountTarget), varargs...)
+}
+
 // DescribeAccessPoints mocks base method.
 func (m *MockEfs) DescribeAccessPoints(arg0 context.Context, arg1 *efs.DescribeAccessPointsInput, arg2 ...func(*efs.Options)) (*efs.DescribeAccessPointsOutput, error) {
 	m.ctrl.T.Helper()
@@ -136,6 +216,66 @@ func (mr *MockEfsMockRecorder) DescribeMountTargets(arg0, arg1 interface{}, arg2
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeMountTargets", reflect.TypeOf((*MockEfs)(nil).DescribeMountTargets), varargs...)
 }
 
+// ListTagsForResource mocks base method.
+func (m *MockEfs) ListTagsForResource(arg0 context.Context, arg1 *efs.ListTagsForResourceInput, arg2 ...func(*efs.Options)) (*efs.ListTagsForResourceOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListTagsForResource", varargs...)
+	ret0, _ := ret[0].(*efs.ListTagsForResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTagsForResource indicates an expected call of ListTagsForResource.
+func (mr *MockEfsMockRecorder) ListTagsForResource(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTagsForResource", reflect.TypeOf((*MockEfs)(nil).ListTagsForResource), varargs...)
+}
+
+// TagResource mocks base method.
+func (m *MockEfs) TagResource(arg0 context.Context, arg1 *efs.TagResourceInput, arg2 ...func(*efs.Options)) (*efs.TagResourceOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "TagResource", varargs...)
+	ret0, _ := ret[0].(*efs.TagResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TagResource indicates an expected call of TagResource.
+func (mr *MockEfsMockRecorder) TagResource(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagResource", reflect.TypeOf((*MockEfs)(nil).TagResource), varargs...)
+}
+
+// UntagResource mocks base method.
+func (m *MockEfs) UntagResource(arg0 context.Context, arg1 *efs.UntagResourceInput, arg2 ...func(*efs.Options)) (*efs.UntagResourceOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "UntagResource", varargs...)
+	ret0, _ := ret[0].(*efs.UntagResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UntagResource indicates an expected call of UntagResource.
+func (mr *MockEfsMockRecorder) UntagResource(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UntagResource", reflect.TypeOf((*MockEfs)(nil).UntagResource), varargs...)
+}
+
 // MockCloud is a mock of Cloud interface.
 type MockCloud struct {
 	ctrl     *gomock.Controller
@@ -159,6 +299,20 @@ func (m *MockCloud) EXPECT() *MockCloudMockRecorder {
 	return m.recorder
 }
 
+// CheckAccess mocks base method.
+func (m *MockCloud) CheckAccess(ctx context.Context, fileSystemId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckAccess", ctx, fileSystemId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckAccess indicates an expected call of CheckAccess.
+func (mr *MockCloudMockRecorder) CheckAccess(ctx, fileSystemId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAccess", reflect.TypeOf((*MockCloud)(nil).CheckAccess), ctx, fileSystemId)
+}
+
 // CreateAccessPoint mocks base method.
 func (m *MockCloud) CreateAccessPoint(ctx context.Context, clientToken string, accessPointOpts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
 	m.ctrl.T.Helper()
@@ -174,6 +328,21 @@ func (mr *MockCloudMockRecorder) CreateAccessPoint(ctx, clientToken, accessPoint
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessPoint", reflect.TypeOf((*MockCloud)(nil).CreateAccessPoint), ctx, clientToken, accessPointOpts)
 }
 
+// CreateFileSystem mocks base method.
+func (m *MockCloud) CreateFileSystem(ctx context.Context, creationToken string, fileSystemOpts *cloud.FileSystemOptions) (*cloud.FileSystem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateFileSystem", ctx, creationToken, fileSystemOpts)
+	ret0, _ := ret[0].(*cloud.FileSystem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateFileSystem indicates an expected call of CreateFileSystem.
+func (mr *MockCloudMockRecorder) CreateFileSystem(ctx, creationToken, fileSystemOpts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFileSystem", reflect.TypeOf((*MockCloud)(nil).CreateFileSystem), ctx, creationToken, fileSystemOpts)
+}
+
 // DeleteAccessPoint mocks base method.
 func (m *MockCloud) DeleteAccessPoint(ctx context.Context, accessPointId string) error {
 	m.ctrl.T.Helper()
@@ -188,6 +357,20 @@ func (mr *MockCloudMockRecorder) DeleteAccessPoint(ctx, accessPointId interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccessPoint", reflect.TypeOf((*MockCloud)(nil).DeleteAccessPoint), ctx, accessPointId)
 }
 
+// DeleteFileSystem mocks base method.
+func (m *MockCloud) DeleteFileSystem(ctx context.Context, fileSystemId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFileSystem", ctx, fileSystemId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFileSystem indicates an expected call of DeleteFileSystem.
+func (mr *MockCloudMockRecorder) DeleteFileSystem(ctx, fileSystemId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileSystem", reflect.TypeOf((*MockCloud)(nil).DeleteFileSystem), ctx, fileSystemId)
+}
+
 // DescribeAccessPoint mocks base method.
 func (m *MockCloud) DescribeAccessPoint(ctx context.Context, accessPointId string) (*cloud.AccessPoint, error) {
 	m.ctrl.T.Helper()
@@ -233,6 +416,36 @@ func (mr *MockCloudMockRecorder) DescribeMountTargets(ctx, fileSystemId, az inte
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeMountTargets", reflect.TypeOf((*MockCloud)(nil).DescribeMountTargets), ctx, fileSystemId, az)
 }
 
+// DescribeTags mocks base method.
+func (m *MockCloud) DescribeTags(ctx context.Context, resourceId string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeTags", ctx, resourceId)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeTags indicates an expected call of DescribeTags.
+func (mr *MockCloudMockRecorder) DescribeTags(ctx, resourceId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeTags", reflect.TypeOf((*MockCloud)(nil).DescribeTags), ctx, resourceId)
+}
+
+// EnsureMountTargets mocks base method.
+func (m *MockCloud) EnsureMountTargets(ctx context.Context, fileSystemId string, subnetIds, securityGroupIds []string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureMountTargets", ctx, fileSystemId, subnetIds, securityGroupIds)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnsureMountTargets indicates an expected call of EnsureMountTargets.
+func (mr *MockCloudMockRecorder) EnsureMountTargets(ctx, fileSystemId, subnetIds, securityGroupIds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureMountTargets", reflect.TypeOf((*MockCloud)(nil).EnsureMountTargets), ctx, fileSystemId, subnetIds, securityGroupIds)
+}
+
 // FindAccessPointByClientToken mocks base method.
 func (m *MockCloud) FindAccessPointByClientToken(ctx context.Context, clientToken, fileSystemId string) (*cloud.AccessPoint, error) {
 	m.ctrl.T.Helper()
@@ -276,3 +489,89 @@ func (mr *MockCloudMockRecorder) ListAccessPoints(ctx, fileSystemId interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccessPoints", reflect.TypeOf((*MockCloud)(nil).ListAccessPoints), ctx, fileSystemId)
 }
+
+// ListAccessPointsPages mocks base method.
+func (m *MockCloud) ListAccessPointsPages(ctx context.Context, fileSystemId string, fn func([]*cloud.AccessPoint) bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccessPointsPages", ctx, fileSystemId, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ListAccessPointsPages indicates an expected call of ListAccessPointsPages.
+func (mr *MockCloudMockRecorder) ListAccessPointsPages(ctx, fileSystemId, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccessPointsPages", reflect.TypeOf((*MockCloud)(nil).ListAccessPointsPages), ctx, fileSystemId, fn)
+}
+
+// ListMountTargets mocks base method.
+func (m *MockCloud) ListMountTargets(ctx context.Context, fileSystemId string) ([]*cloud.MountTarget, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMountTargets", ctx, fileSystemId)
+	ret0, _ := ret[0].([]*cloud.MountTarget)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMountTargets indicates an expected call of ListMountTargets.
+func (mr *MockCloudMockRecorder) ListMountTargets(ctx, fileSystemId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMountTargets", reflect.TypeOf((*MockCloud)(nil).ListMountTargets), ctx, fileSystemId)
+}
+
+// ListPendingAccessPoints mocks base method.
+func (m *MockCloud) ListPendingAccessPoints(ctx context.Context, tags map[string]string) ([]*cloud.AccessPoint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPendingAccessPoints", ctx, tags)
+	ret0, _ := ret[0].([]*cloud.AccessPoint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPendingAccessPoints indicates an expected call of ListPendingAccessPoints.
+func (mr *MockCloudMockRecorder) ListPendingAccessPoints(ctx, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPendingAccessPoints", reflect.TypeOf((*MockCloud)(nil).ListPendingAccessPoints), ctx, tags)
+}
+
+// MarkAccessPointProvisioned mocks base method.
+func (m *MockCloud) MarkAccessPointProvisioned(ctx context.Context, accessPointId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkAccessPointProvisioned", ctx, accessPointId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkAccessPointProvisioned indicates an expected call of MarkAccessPointProvisioned.
+func (mr *MockCloudMockRecorder) MarkAccessPointProvisioned(ctx, accessPointId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkAccessPointProvisioned", reflect.TypeOf((*MockCloud)(nil).MarkAccessPointProvisioned), ctx, accessPointId)
+}
+
+// TagResource mocks base method.
+func (m *MockCloud) TagResource(ctx context.Context, resourceId string, tags map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TagResource", ctx, resourceId, tags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TagResource indicates an expected call of TagResource.
+func (mr *MockCloudMockRecorder) TagResource(ctx, resourceId, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagResource", reflect.TypeOf((*MockCloud)(nil).TagResource), ctx, resourceId, tags)
+}
+
+// UntagResource mocks base method.
+func (m *MockCloud) UntagResource(ctx context.Context, resourceId string, tagKeys []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UntagResource", ctx, resourceId, tagKeys)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UntagResource indicates an expected call of UntagResource.
+func (mr *MockCloudMockRecorder) UntagResource(ctx, resourceId, tagKeys interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UntagResource", reflect.TypeOf((*MockCloud)(nil).UntagResource), ctx, resourceId, tagKeys)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import "fmt"
+
+// Mode selects the CSI services that the driver serves
+type Mode string
+
+const (
+	// ControllerMode serves the identity and controller services
+	ControllerMode Mode = "controller"
+	// NodeMode serves the identity and node services, without calling the EFS API
+	NodeMode Mode = "node"
+	// AllMode serves all the services
+	AllMode Mode = "all"
+	// SmokeTestMode serves no service, it mounts a volume once with RunSmokeTest and exits
+	SmokeTestMode Mode = "smoke-test"
+)
+
+// ParseMode returns the mode, or an error if it is not one of controller, node, all or smoke-test
+func ParseMode(mode string) (Mode, error) {
+	switch m := Mode(mode); m {
+	case ControllerMode, NodeMode, AllMode, SmokeTestMode:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q, must be one of %s, %s, %s or %s", mode, ControllerMode, NodeMode, AllMode, SmokeTestMode)
+	}
+}
+
+// servesController returns whether the mode serves the controller service. An empty mode serves all the services.
+func (m Mode) servesController() bool {
+	return m != NodeMode
+}
+
+// servesNode returns whether the mode serves the node service. An empty mode serves all the services.
+func (m Mode) servesNode() bool {
+	return m != ControllerMode
+}
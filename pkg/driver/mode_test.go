@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []string{"controller", "node", "all", "smoke-test"} {
+		if m, err := ParseMode(mode); err != nil || string(m) != mode {
+			t.Fatalf("Failed to parse mode %q: %v", mode, err)
+		}
+	}
+	if _, err := ParseMode("agent"); err == nil {
+		t.Fatal("Expected an invalid mode to be rejected")
+	}
+}
+
+func TestGetPluginCapabilitiesMode(t *testing.T) {
+	testCases := []struct {
+		mode              Mode
+		expectsController bool
+	}{
+		{mode: "", expectsController: true},
+		{mode: AllMode, expectsController: true},
+		{mode: ControllerMode, expectsController: true},
+		{mode: NodeMode, expectsController: false},
+	}
+	for _, tc := range testCases {
+		driver := &Driver{mode: tc.mode}
+		res, err := driver.GetPluginCapabilities(context.Background(), &csi.GetPluginCapabilitiesRequest{})
+		if err != nil {
+			t.Fatalf("GetPluginCapabilities failed: %v", err)
+		}
+		hasController := len(res.Capabilities) > 0 &&
+			res.Capabilities[0].GetService().GetType() == csi.PluginCapability_Service_CONTROLLER_SERVICE
+		if hasController && res.Capabilities[len(res.Capabilities)-1].GetVolumeExpansion().GetType() != csi.PluginCapability_VolumeExpansion_ONLINE {
+			t.Fatalf("Mode %q: expected online volume expansion, got %v", tc.mode, res.Capabilities)
+		}
+		if hasController != tc.expectsController {
+			t.Fatalf("Mode %q: expected controller service %v, got %v", tc.mode, tc.expectsController, res.Capabilities)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// MountDiagnosticsEvent records the diagnostics of a failed mount in an Event of the pod
+	MountDiagnosticsEvent = "event"
+	// MountDiagnosticsEventReason is the reason of the Event holding the diagnostics of a failed mount
+	MountDiagnosticsEventReason = "MountDiagnostics"
+
+	// Volume context properties of the pod of the volume, passed by the kubelet with podInfoOnMount
+	PodName               = "csi.storage.k8s.io/pod.name"
+	PodNamespace          = "csi.storage.k8s.io/pod.namespace"
+	PodUid                = "csi.storage.k8s.io/pod.uid"
+	PodServiceAccountName = "csi.storage.k8s.io/serviceaccount.name"
+	EphemeralVolume       = "csi.storage.k8s.io/ephemeral"
+
+	// mountDiagnosticsMaxOutputLines is the number of lines of the output of the mount helper in the diagnostics
+	mountDiagnosticsMaxOutputLines = 5
+	// mountDiagnosticsMaxLen truncates the diagnostics, which end up in objects of the API server
+	mountDiagnosticsMaxLen = 2048
+)
+
+var mountExitStatus = regexp.MustCompile(`exit status (\d+)`)
+
+// mountDiagnostics records the mount command, exit code and first lines of the output of the mount helper of
+// the failed mounts of NodePublishVolume on the pod of the volume, so that the teams running the pod can debug
+// the mount without access to the node. They are recorded in an Event of the pod, which the node may create
+// without write access to the pods. The pod is known from the volume context when the CSIDriver object has
+// podInfoOnMount set. A nil mountDiagnostics is valid and records nothing.
+type mountDiagnostics struct {
+	nodeName  string
+	k8sClient cloud.KubernetesAPIClient
+}
+
+func newMountDiagnostics(mode, nodeName string, k8sClient cloud.KubernetesAPIClient) (*mountDiagnostics, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case MountDiagnosticsEvent:
+		return &mountDiagnostics{nodeName: nodeName, k8sClient: k8sClient}, nil
+	default:
+		return nil, fmt.Errorf("invalid mount failure diagnostics %q, must be %s", mode, MountDiagnosticsEvent)
+	}
+}
+
+// record records the diagnostics of the failed mount on the pod of the volume context, if any
+func (m *mountDiagnostics) record(attributes map[string]string, volumeId, source, target string, mountOptions []string, mountErr error) {
+	if m == nil {
+		return
+	}
+	podName, namespace := attributes[PodName], attributes[PodNamespace]
+	if podName == "" || namespace == "" {
+		klog.V(4).Infof("NodePublishVolume: no pod in the volume context of %s to record the mount diagnostics on, set podInfoOnMount in the CSIDriver object", volumeId)
+		return
+	}
+	diagnostics := formatMountDiagnostics(source, target, mountOptions, mountErr)
+
+	clientset, err := m.k8sClient()
+	if err != nil {
+		klog.Warningf("Failed to record the mount diagnostics of volume %s on pod %s/%s: %v", volumeId, namespace, podName, err)
+		return
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: podName + ".",
+			Namespace:    namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       podName,
+			Namespace:  namespace,
+			UID:        types.UID(attributes[PodUid]),
+		},
+		Reason:         MountDiagnosticsEventReason,
+		Message:        fmt.Sprintf("Volume %s could not be mounted on node %s:\n%s", volumeId, m.nodeName, diagnostics),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: driverName, Host: m.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := clientset.CoreV1().Events(namespace).Create(context.Background(), event, metav1.CreateOptions{}); err != nil {
+		klog.Warningf("Failed to record the mount diagnostics of volume %s on pod %s/%s: %v", volumeId, namespace, podName, err)
+	}
+}
+
+// formatMountDiagnostics returns the mount command, the exit code of the mount helper if known and the first
+// lines of its output, truncated to mountDiagnosticsMaxLen
+func formatMountDiagnostics(source, target string, mountOptions []string, mountErr error) string {
+	var b strings.Builder
+	b.WriteString("command: mount -t efs")
+	if len(mountOptions) > 0 {
+		fmt.Fprintf(&b, " -o %s", strings.Join(mountOptions, ","))
+	}
+	fmt.Fprintf(&b, " %s %s\n", source, target)
+
+	message := mountErr.Error()
+	if match := mountExitStatus.FindStringSubmatch(message); match != nil {
+		fmt.Fprintf(&b, "exit code: %s\n", match[1])
+	}
+	// The mounter reports the output of the mount helper after "Output: ", otherwise the error is reported as is
+	output := message
+	if i := strings.Index(message, "Output: "); i >= 0 {
+		output = message[i+len("Output: "):]
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > mountDiagnosticsMaxOutputLines {
+		lines = lines[:mountDiagnosticsMaxOutputLines]
+	}
+	fmt.Fprintf(&b, "output: %s", strings.Join(lines, "\n"))
+
+	diagnostics := b.String()
+	if len(diagnostics) > mountDiagnosticsMaxLen {
+		diagnostics = truncateUTF8(diagnostics, mountDiagnosticsMaxLen-len("...")) + "..."
+	}
+	return diagnostics
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFormatMountDiagnostics(t *testing.T) {
+	mountErr := errors.New("mount failed: exit status 32\nMounting command: mount\nMounting arguments: -t efs -o tls fs-abcd1234:/ /target\n" +
+		"Output: Failed to resolve \"fs-abcd1234.efs.us-east-1.amazonaws.com\"\nline 2\nline 3\nline 4\nline 5\nline 6")
+	diagnostics := formatMountDiagnostics("fs-abcd1234:/", "/target", []string{"tls", "accesspoint=fsap-1234"}, mountErr)
+
+	expected := "command: mount -t efs -o tls,accesspoint=fsap-1234 fs-abcd1234:/ /target\n" +
+		"exit code: 32\n" +
+		"output: Failed to resolve \"fs-abcd1234.efs.us-east-1.amazonaws.com\"\nline 2\nline 3\nline 4\nline 5"
+	if diagnostics != expected {
+		t.Fatalf("Expected diagnostics:\n%s\ngot:\n%s", expected, diagnostics)
+	}
+
+	diagnostics = formatMountDiagnostics("fs-abcd1234:/", "/target", nil, errors.New(strings.Repeat("x", 2*mountDiagnosticsMaxLen)))
+	if len(diagnostics) != mountDiagnosticsMaxLen || !strings.HasSuffix(diagnostics, "...") {
+		t.Fatalf("Expected the diagnostics to be truncated to %d characters, got %d", mountDiagnosticsMaxLen, len(diagnostics))
+	}
+
+	diagnostics = formatMountDiagnostics("fs-abcd1234:/", "/target", nil, errors.New(strings.Repeat("é", mountDiagnosticsMaxLen)))
+	if len(diagnostics) > mountDiagnosticsMaxLen || !utf8.ValidString(diagnostics) {
+		t.Fatalf("Expected the diagnostics to be truncated on a rune boundary, got %d bytes", len(diagnostics))
+	}
+}
+
+func TestMountDiagnosticsRecord(t *testing.T) {
+	attributes := map[string]string{PodName: "app-0", PodNamespace: "team-a", PodUid: "1234"}
+	mountErr := errors.New("mount failed: exit status 1\nOutput: mount.nfs4: access denied by server")
+
+	clientset := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: "team-a"}})
+	diagnostics, err := newMountDiagnostics(MountDiagnosticsEvent, "ip-10-0-0-1", func() (kubernetes.Interface, error) { return clientset, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics.record(attributes, "fs-abcd1234", "fs-abcd1234:/", "/target", []string{"tls"}, mountErr)
+
+	events, err := clientset.CoreV1().Events("team-a").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("Expected an Event with the diagnostics, got %+v", events.Items)
+	}
+	event := events.Items[0]
+	if event.Reason != MountDiagnosticsEventReason || event.InvolvedObject.Name != "app-0" || !strings.Contains(event.Message, "exit code: 1") {
+		t.Fatalf("Unexpected Event %+v", event)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "pods" {
+			t.Fatalf("Expected the pod not to be written, got %v", action)
+		}
+	}
+}
+
+func TestNewMountDiagnostics(t *testing.T) {
+	if diagnostics, err := newMountDiagnostics("", "", nil); diagnostics != nil || err != nil {
+		t.Fatalf("Expected no diagnostics, got %v, %v", diagnostics, err)
+	}
+	for _, mode := range []string{"pod", "annotation"} {
+		if _, err := newMountDiagnostics(mode, "", nil); err == nil {
+			t.Fatalf("Expected mode %q to fail", mode)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// MountHelperFeaturesAnnotationKey is the CSINode annotation listing the mount helper features supported by the node
+	MountHelperFeaturesAnnotationKey = "efs.csi.aws.com/mount-helper-features"
+
+	// RequiredMountHelperFeaturesAnnotationKey is the CSIDriver annotation listing the mount helper features
+	// every volume of the driver needs, in addition to the ones needed by its volume context
+	RequiredMountHelperFeaturesAnnotationKey = "efs.csi.aws.com/required-mount-helper-features"
+
+	// DefaultMountHelperPath is the path of the efs-utils mount helper in the driver image
+	DefaultMountHelperPath = "/sbin/mount.efs"
+
+	// AccessPointSource is the mount helper feature of the access point mount sources, e.g.
+	// fsap-0123456789abcdef0.fs-abcd1234:/, which the mount helper resolves with the DNS name of the
+	// access point instead of the accesspoint mount option
+	AccessPointSource = "fsap"
+
+	mountHelperFeaturesPublishInterval = 10 * time.Second
+)
+
+// knownMountHelperFeatures are the mount options the controller may ask the nodes to use, which are not
+// understood by every efs-utils version
+var knownMountHelperFeatures = []string{CrossAccount, MountTargetIp}
+
+var (
+	errMountHelperFeaturesUnsupported = errors.New("no schedulable node supports the required mount helper features")
+	errMountHelperFeaturesNotSynced   = errors.New("nodes are not synced yet")
+)
+
+// detectMountHelperFeatures returns the known mount helper features supported by the mount helper.
+// The mount helper is a python script, it supports an option if it looks the option up by name.
+func detectMountHelperFeatures(helperPath string) ([]string, error) {
+	data, err := os.ReadFile(helperPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount helper %s: %v", helperPath, err)
+	}
+	features := []string{}
+	for _, feature := range knownMountHelperFeatures {
+		if mountHelperLooksUp(data, feature) {
+			features = append(features, feature)
+		}
+	}
+	return features, nil
+}
+
+// detectAccessPointSource tells whether the mount helper supports the access point mount sources, so that
+// NodePublishVolume uses them. Older mount helpers only support the accesspoint mount option.
+func detectAccessPointSource(helperPath string) bool {
+	data, err := os.ReadFile(helperPath)
+	if err != nil {
+		klog.V(4).Infof("Not using access point mount sources, failed to read mount helper %s: %v", helperPath, err)
+		return false
+	}
+	supported := mountHelperLooksUp(data, AccessPointSource)
+	klog.Infof("Mount helper %s supports access point mount sources: %t", helperPath, supported)
+	return supported
+}
+
+func mountHelperLooksUp(data []byte, name string) bool {
+	return bytes.Contains(data, []byte(`"`+name+`"`)) || bytes.Contains(data, []byte(`'`+name+`'`))
+}
+
+// publishMountHelperFeatures advertises the mount helper features of the node on its CSINode object
+func publishMountHelperFeatures(k8sClient cloud.KubernetesAPIClient, features []string) error {
+	nodeName := os.Getenv("CSI_NODE_NAME")
+	if nodeName == "" {
+		klog.V(4).InfoS("CSI_NODE_NAME missing, skipping mount helper features publishing")
+		return nil
+	}
+
+	clientset, err := k8sClient()
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				MountHelperFeaturesAnnotationKey: strings.Join(features, ","),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The CSINode object is created by the kubelet once the driver is registered, it may not exist yet
+	_, err = clientset.StorageV1().CSINodes().Patch(context.Background(), nodeName, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	klog.Infof("Published mount helper features on CSINode %s: %v", nodeName, features)
+	return nil
+}
+
+func publishMountHelperFeaturesUntilSucceed(interval time.Duration, helperPath string, k8sClient cloud.KubernetesAPIClient) {
+	features, err := detectMountHelperFeatures(helperPath)
+	if err != nil {
+		klog.Errorf("Not publishing mount helper features: %v", err)
+		return
+	}
+	for {
+		err := publishMountHelperFeatures(k8sClient, features)
+		if err == nil {
+			return
+		}
+		klog.Warningf("Failed to publish mount helper features: %v", err)
+		time.Sleep(interval)
+	}
+}
+
+// requiredMountHelperFeatures returns the mount helper features the nodes need to mount a volume
+// provisioned with the role and cross account DNS setting
+func requiredMountHelperFeatures(roleArn string, crossAccountDNSEnabled bool) []string {
+	if roleArn == "" {
+		return nil
+	}
+	if crossAccountDNSEnabled {
+		return []string{CrossAccount}
+	}
+	return []string{MountTargetIp}
+}
+
+func parseMountHelperFeatures(value string) []string {
+	var features []string
+	for _, feature := range strings.Split(value, ",") {
+		if feature = strings.TrimSpace(feature); feature != "" {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// mountHelperFeatureGate rejects volumes which no schedulable node could mount because of its mount helper.
+// The CSIDriver object, the nodes and their CSINode objects are read from the informers shared by the
+// controller. A nil gate is valid and accepts every volume.
+type mountHelperFeatureGate struct {
+	csiDrivers storagelisters.CSIDriverLister
+	nodes      corelisters.NodeLister
+	csiNodes   storagelisters.CSINodeLister
+	synced     []cache.InformerSynced
+}
+
+func newMountHelperFeatureGate(enabled bool, factory informers.SharedInformerFactory) *mountHelperFeatureGate {
+	if !enabled {
+		return nil
+	}
+	csiDrivers := factory.Storage().V1().CSIDrivers()
+	nodes := factory.Core().V1().Nodes()
+	csiNodes := factory.Storage().V1().CSINodes()
+	return &mountHelperFeatureGate{
+		csiDrivers: csiDrivers.Lister(),
+		nodes:      nodes.Lister(),
+		csiNodes:   csiNodes.Lister(),
+		synced:     []cache.InformerSynced{csiDrivers.Informer().HasSynced, nodes.Informer().HasSynced, csiNodes.Informer().HasSynced},
+	}
+}
+
+// check returns an error wrapping errMountHelperFeaturesUnsupported if no schedulable node advertises
+// the features, and those required by the CSIDriver object
+func (g *mountHelperFeatureGate) check(ctx context.Context, features []string) error {
+	if g == nil {
+		return nil
+	}
+	for _, synced := range g.synced {
+		if !synced() {
+			return errMountHelperFeaturesNotSynced
+		}
+	}
+
+	csiDriver, err := g.csiDrivers.Get(driverName)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get CSIDriver %s: %v", driverName, err)
+	}
+	required := map[string]bool{}
+	for _, feature := range features {
+		required[feature] = true
+	}
+	if err == nil {
+		for _, feature := range parseMountHelperFeatures(csiDriver.Annotations[RequiredMountHelperFeaturesAnnotationKey]) {
+			required[feature] = true
+		}
+	}
+	if len(required) == 0 {
+		return nil
+	}
+
+	nodes, err := g.nodes.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+	schedulable := map[string]bool{}
+	for _, node := range nodes {
+		if !node.Spec.Unschedulable {
+			schedulable[node.Name] = true
+		}
+	}
+
+	csiNodes, err := g.csiNodes.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list CSINodes: %v", err)
+	}
+	for _, csiNode := range csiNodes {
+		if !schedulable[csiNode.Name] {
+			continue
+		}
+		value, ok := csiNode.Annotations[MountHelperFeaturesAnnotationKey]
+		if !ok {
+			continue
+		}
+		supported := map[string]bool{}
+		for _, feature := range parseMountHelperFeatures(value) {
+			supported[feature] = true
+		}
+		missing := false
+		for feature := range required {
+			if !supported[feature] {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			return nil
+		}
+	}
+
+	names := make([]string, 0, len(required))
+	for feature := range required {
+		names = append(names, feature)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("%w: %s", errMountHelperFeaturesUnsupported, strings.Join(names, ", "))
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDetectMountHelperFeatures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		helper   string
+		expected []string
+	}{
+		{
+			name:     "all features",
+			helper:   "if \"crossaccount\" in options:\n    ip = options['mounttargetip']\n",
+			expected: []string{CrossAccount, MountTargetIp},
+		},
+		{
+			name:     "old mount helper",
+			helper:   "if \"tls\" in options:\n    pass\n",
+			expected: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			helperPath := filepath.Join(t.TempDir(), "mount.efs")
+			if err := os.WriteFile(helperPath, []byte(tc.helper), 0755); err != nil {
+				t.Fatal(err)
+			}
+			features, err := detectMountHelperFeatures(helperPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(features, tc.expected) {
+				t.Fatalf("Expected features %v, got %v", tc.expected, features)
+			}
+		})
+	}
+
+	if _, err := detectMountHelperFeatures(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("Expected an error for a missing mount helper")
+	}
+}
+
+func TestDetectAccessPointSource(t *testing.T) {
+	dir := t.TempDir()
+	newHelper, oldHelper := filepath.Join(dir, "new"), filepath.Join(dir, "old")
+	if err := os.WriteFile(newHelper, []byte("if source.startswith('fsap'):\n    pass\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(oldHelper, []byte("ap_id = options['accesspoint']\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !detectAccessPointSource(newHelper) {
+		t.Fatal("Expected the access point mount sources to be supported")
+	}
+	if detectAccessPointSource(oldHelper) || detectAccessPointSource(filepath.Join(dir, "missing")) {
+		t.Fatal("Expected the access point mount sources to be unsupported")
+	}
+}
+
+func TestPublishMountHelperFeatures(t *testing.T) {
+	nodeName := "test-node-123"
+	t.Setenv("CSI_NODE_NAME", nodeName)
+
+	clientset := fake.NewSimpleClientset(&storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+	})
+	err := publishMountHelperFeatures(func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}, []string{CrossAccount, MountTargetIp})
+	if err != nil {
+		t.Fatalf("Failed to publish mount helper features: %v", err)
+	}
+
+	csiNode, err := clientset.StorageV1().CSINodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get CSINode: %v", err)
+	}
+	if value := csiNode.Annotations[MountHelperFeaturesAnnotationKey]; value != "crossaccount,mounttargetip" {
+		t.Fatalf("Unexpected annotation %q", value)
+	}
+}
+
+func TestMountHelperFeatureGateCheck(t *testing.T) {
+	node := func(name string, unschedulable bool) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+		}
+	}
+	csiNode := func(name string, annotations map[string]string) *storagev1.CSINode {
+		return &storagev1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+		}
+	}
+	csiDriver := func(required string) *storagev1.CSIDriver {
+		return &storagev1.CSIDriver{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        driverName,
+				Annotations: map[string]string{RequiredMountHelperFeaturesAnnotationKey: required},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		objects        []runtime.Object
+		features       []string
+		expectRejected bool
+	}{
+		{
+			name:     "Success: nothing required",
+			objects:  []runtime.Object{node("node-1", false)},
+			features: nil,
+		},
+		{
+			name: "Success: a node supports the features",
+			objects: []runtime.Object{
+				node("node-1", false), csiNode("node-1", nil),
+				node("node-2", false), csiNode("node-2", map[string]string{MountHelperFeaturesAnnotationKey: "crossaccount,mounttargetip"}),
+			},
+			features: []string{CrossAccount},
+		},
+		{
+			name: "Fail: only an unschedulable node supports the features",
+			objects: []runtime.Object{
+				node("node-1", false), csiNode("node-1", map[string]string{MountHelperFeaturesAnnotationKey: "mounttargetip"}),
+				node("node-2", true), csiNode("node-2", map[string]string{MountHelperFeaturesAnnotationKey: "crossaccount"}),
+			},
+			features:       []string{CrossAccount},
+			expectRejected: true,
+		},
+		{
+			name: "Fail: no node supports the features required by the CSIDriver",
+			objects: []runtime.Object{
+				csiDriver("crossaccount"),
+				node("node-1", false), csiNode("node-1", map[string]string{MountHelperFeaturesAnnotationKey: "mounttargetip"}),
+			},
+			features:       nil,
+			expectRejected: true,
+		},
+		{
+			name: "Fail: no node publishes its features",
+			objects: []runtime.Object{
+				node("node-1", false), csiNode("node-1", nil),
+			},
+			features:       []string{MountTargetIp},
+			expectRejected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.objects...)
+			factory := informers.NewSharedInformerFactory(clientset, 0)
+			gate := newMountHelperFeatureGate(true, factory)
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			factory.Start(stopCh)
+			factory.WaitForCacheSync(stopCh)
+			err := gate.check(context.Background(), tc.features)
+			if tc.expectRejected != errors.Is(err, errMountHelperFeaturesUnsupported) {
+				t.Fatalf("Expected rejected: %v, got error: %v", tc.expectRejected, err)
+			}
+			if !tc.expectRejected && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	// A disabled gate accepts every volume
+	if err := newMountHelperFeatureGate(false, nil).check(context.Background(), []string{CrossAccount}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRequiredMountHelperFeatures(t *testing.T) {
+	roleArn := "arn:aws:iam::111122223333:role/EFSRole"
+	if features := requiredMountHelperFeatures("", true); len(features) != 0 {
+		t.Fatalf("Expected no features without a role, got %v", features)
+	}
+	if features := requiredMountHelperFeatures(roleArn, true); !reflect.DeepEqual(features, []string{CrossAccount}) {
+		t.Fatalf("Unexpected features %v", features)
+	}
+	if features := requiredMountHelperFeatures(roleArn, false); !reflect.DeepEqual(features, []string{MountTargetIp}) {
+		t.Fatalf("Unexpected features %v", features)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const mountOptionRulesResync = 10 * time.Minute
+
+// mountOptionRule appends mount options to the volumes published on the nodes selected by its node selector
+type mountOptionRule struct {
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector"`
+	MountOptions []string              `json:"mountOptions"`
+}
+
+// mountOptionRules are the rules of a ConfigMap, one JSON rule per key, applied in the order of the keys.
+// The ConfigMap and the node are watched, so that changes to the rules or the labels of the node apply to
+// the next published volumes without restarting the driver.
+// A nil mountOptionRules is valid and never appends anything.
+type mountOptionRules struct {
+	namespace string
+	name      string
+	nodeName  string
+
+	configMaps cache.SharedIndexInformer
+	nodes      cache.SharedIndexInformer
+}
+
+// newMountOptionRules returns the rules stored in the ConfigMap referenced as namespace/name, or nil if empty
+func newMountOptionRules(configMap, nodeName string, k8sClient cloud.KubernetesAPIClient) (*mountOptionRules, error) {
+	if configMap == "" {
+		return nil, nil
+	}
+	parts := strings.Split(configMap, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("mount option rules ConfigMap %q must be of the form namespace/name", configMap)
+	}
+	if nodeName == "" {
+		return nil, fmt.Errorf("mount option rules require the CSI_NODE_NAME environment variable")
+	}
+	clientset, err := k8sClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	namespace, name := parts[0], parts[1]
+	return &mountOptionRules{
+		namespace:  namespace,
+		name:       name,
+		nodeName:   nodeName,
+		configMaps: newSingleObjectInformer(clientset, &corev1.ConfigMap{}, namespace, name),
+		nodes:      newSingleObjectInformer(clientset, &corev1.Node{}, "", nodeName),
+	}, nil
+}
+
+// newSingleObjectInformer returns an informer watching the ConfigMap or Node of the name only
+func newSingleObjectInformer(clientset kubernetes.Interface, obj runtime.Object, namespace, name string) cache.SharedIndexInformer {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	var lw *cache.ListWatch
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = selector
+				return clientset.CoreV1().ConfigMaps(namespace).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = selector
+				return clientset.CoreV1().ConfigMaps(namespace).Watch(context.Background(), options)
+			},
+		}
+	default:
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = selector
+				return clientset.CoreV1().Nodes().List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = selector
+				return clientset.CoreV1().Nodes().Watch(context.Background(), options)
+			},
+		}
+	}
+	return cache.NewSharedIndexInformer(lw, obj, mountOptionRulesResync, cache.Indexers{})
+}
+
+func (r *mountOptionRules) run(stopCh <-chan struct{}) {
+	go r.configMaps.Run(stopCh)
+	go r.nodes.Run(stopCh)
+}
+
+// mountOptions returns the mount options of the rules selecting the node, in the order of the rules
+func (r *mountOptionRules) mountOptions() ([]string, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if !r.configMaps.HasSynced() || !r.nodes.HasSynced() {
+		return nil, fmt.Errorf("mount option rules are not synced yet")
+	}
+	obj, ok, err := r.configMaps.GetStore().GetByKey(r.namespace + "/" + r.name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	cm := obj.(*corev1.ConfigMap)
+	obj, ok, err = r.nodes.GetStore().GetByKey(r.nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", r.nodeName)
+	}
+	node := obj.(*corev1.Node)
+	return matchMountOptionRules(cm.Data, node.Labels)
+}
+
+// matchMountOptionRules returns the mount options of the rules of the ConfigMap data selecting the labels
+func matchMountOptionRules(data map[string]string, nodeLabels map[string]string) ([]string, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var mountOptions []string
+	for _, key := range keys {
+		rule := &mountOptionRule{}
+		if err := json.Unmarshal([]byte(data[key]), rule); err != nil {
+			return nil, fmt.Errorf("invalid mount option rule %s: %v", key, err)
+		}
+		if rule.NodeSelector == nil {
+			return nil, fmt.Errorf("invalid mount option rule %s: missing nodeSelector", key)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(rule.NodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node selector of mount option rule %s: %v", key, err)
+		}
+		if selector.Matches(labels.Set(nodeLabels)) {
+			mountOptions = append(mountOptions, rule.MountOptions...)
+		}
+	}
+	return mountOptions, nil
+}
+
+// appendMountOptionRules appends the options of the rules whose name is not among the options yet, so
+// that the mount options of the volume and the earlier rules win
+func appendMountOptionRules(mountOptions, ruleOptions []string) []string {
+	for _, option := range ruleOptions {
+		name := strings.SplitN(option, "=", 2)[0]
+		if hasOption(mountOptions, name) || hasOptionPrefix(mountOptions, name+"=") {
+			continue
+		}
+		mountOptions = append(mountOptions, option)
+	}
+	return mountOptions
+}
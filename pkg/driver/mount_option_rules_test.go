@@ -0,0 +1,195 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMatchMountOptionRules(t *testing.T) {
+	nodeLabels := map[string]string{
+		"topology.kubernetes.io/zone":      "us-east-1a",
+		"node.kubernetes.io/instance-type": "c6in.xlarge",
+	}
+	testCases := []struct {
+		name      string
+		data      map[string]string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name: "match labels and expressions, in the order of the keys",
+			data: map[string]string{
+				"b-zone":    `{"nodeSelector": {"matchLabels": {"topology.kubernetes.io/zone": "us-east-1a"}}, "mountOptions": ["noresvport"]}`,
+				"a-network": `{"nodeSelector": {"matchExpressions": [{"key": "node.kubernetes.io/instance-type", "operator": "In", "values": ["c6in.xlarge"]}]}, "mountOptions": ["rsize=1048576"]}`,
+			},
+			expected: []string{"rsize=1048576", "noresvport"},
+		},
+		{
+			name: "no match",
+			data: map[string]string{
+				"zone": `{"nodeSelector": {"matchLabels": {"topology.kubernetes.io/zone": "us-east-1b"}}, "mountOptions": ["noresvport"]}`,
+			},
+		},
+		{
+			name: "empty selector matches every node",
+			data: map[string]string{
+				"all": `{"nodeSelector": {}, "mountOptions": ["iam"]}`,
+			},
+			expected: []string{"iam"},
+		},
+		{
+			name: "missing selector",
+			data: map[string]string{
+				"all": `{"mountOptions": ["iam"]}`,
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid json",
+			data: map[string]string{
+				"all": `nodeSelector: {}`,
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid operator",
+			data: map[string]string{
+				"zone": `{"nodeSelector": {"matchExpressions": [{"key": "topology.kubernetes.io/zone", "operator": "Near"}]}, "mountOptions": ["iam"]}`,
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options, err := matchMountOptionRules(tc.data, nodeLabels)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(options, tc.expected) {
+				t.Fatalf("Expected options %v, got %v", tc.expected, options)
+			}
+		})
+	}
+}
+
+func TestAppendMountOptionRules(t *testing.T) {
+	options := appendMountOptionRules(
+		[]string{"tls", "rsize=65536", "ro"},
+		[]string{"rsize=1048576", "wsize=1048576", "tls", "noresvport", "wsize=65536"},
+	)
+	expected := []string{"tls", "rsize=65536", "ro", "wsize=1048576", "noresvport"}
+	if !reflect.DeepEqual(options, expected) {
+		t.Fatalf("Expected options %v, got %v", expected, options)
+	}
+}
+
+func TestNewMountOptionRules(t *testing.T) {
+	k8sClient := func() (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(), nil
+	}
+	testCases := []struct {
+		name      string
+		configMap string
+		nodeName  string
+		expectNil bool
+		expectErr bool
+	}{
+		{name: "disabled", configMap: "", expectNil: true},
+		{name: "enabled", configMap: "kube-system/efs-mount-options", nodeName: "node-1"},
+		{name: "missing namespace", configMap: "efs-mount-options", nodeName: "node-1", expectErr: true},
+		{name: "missing node name", configMap: "kube-system/efs-mount-options", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := newMountOptionRules(tc.configMap, tc.nodeName, k8sClient)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && tc.expectNil != (rules == nil) {
+				t.Fatalf("Expected nil rules: %v, got %v", tc.expectNil, rules)
+			}
+		})
+	}
+}
+
+func TestMountOptionRulesReload(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{"node.kubernetes.io/instance-type": "m5.large"},
+		}},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "efs-mount-options"},
+			Data: map[string]string{
+				"network": `{"nodeSelector": {"matchLabels": {"node.kubernetes.io/instance-type": "c6in.xlarge"}}, "mountOptions": ["rsize=1048576"]}`,
+			},
+		},
+	)
+	rules, err := newMountOptionRules("kube-system/efs-mount-options", "node-1", func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	rules.run(stopCh)
+
+	waitForOptions := func(expected []string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			options, err := rules.mountOptions()
+			if err == nil && reflect.DeepEqual(options, expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected options %v, got %v (error %v)", expected, options, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitForOptions(nil)
+
+	ctx := context.Background()
+	node, _ := clientset.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+	node.Labels["node.kubernetes.io/instance-type"] = "c6in.xlarge"
+	if _, err := clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForOptions([]string{"rsize=1048576"})
+
+	cm, _ := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "efs-mount-options", metav1.GetOptions{})
+	cm.Data["network"] = `{"nodeSelector": {"matchLabels": {"node.kubernetes.io/instance-type": "c6in.xlarge"}}, "mountOptions": ["rsize=524288"]}`
+	if _, err := clientset.CoreV1().ConfigMaps("kube-system").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForOptions([]string{"rsize=524288"})
+
+	var disabled *mountOptionRules
+	if options, err := disabled.mountOptions(); options != nil || err != nil {
+		t.Fatalf("Expected no options from nil rules, got %v, %v", options, err)
+	}
+}
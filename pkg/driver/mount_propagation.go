@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// MountPropagationCheckFail stops the node service if the mount propagation of the kubelet directory is wrong
+	MountPropagationCheckFail = "fail"
+	// MountPropagationCheckReport keeps the node service running and logs the cause as a warning
+	MountPropagationCheckReport = "report"
+
+	mountInfoPath     = "/proc/self/mountinfo"
+	defaultKubeletDir = "/var/lib/kubelet"
+)
+
+// mountPropagationCheck verifies that the mounts made by the node service in the kubelet directory are
+// visible to the kubelet, and therefore to the pods: the kubelet directory must be mounted from the host
+// with Bidirectional mount propagation. Otherwise NodePublishVolume succeeds but the pods see an empty
+// directory. A nil mountPropagationCheck is valid and never fails.
+type mountPropagationCheck struct {
+	mode          string
+	kubeletDir    string
+	mountInfoPath string
+}
+
+// newMountPropagationCheck returns the check of the mode, or nil if the mode is empty
+func newMountPropagationCheck(mode, kubeletDir string) (*mountPropagationCheck, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case MountPropagationCheckFail, MountPropagationCheckReport:
+		return &mountPropagationCheck{mode: mode, kubeletDir: kubeletDir, mountInfoPath: mountInfoPath}, nil
+	default:
+		return nil, fmt.Errorf("invalid mount propagation check %q, must be one of %s or %s", mode, MountPropagationCheckFail, MountPropagationCheckReport)
+	}
+}
+
+// run verifies the mount propagation. It only returns the error in the fail mode, and logs it in the report
+// mode, so that a wrong mount propagation never affects the liveness of the node service.
+func (c *mountPropagationCheck) run() error {
+	if c == nil {
+		return nil
+	}
+	err := verifyMountPropagation(c.mountInfoPath, c.kubeletDir)
+	if err != nil && c.mode == MountPropagationCheckReport {
+		klog.Warningf("Mount propagation check failed, the volumes mounted by the node service may not be visible to the pods: %v", err)
+		return nil
+	}
+	return err
+}
+
+// verifyMountPropagation returns an error if the mount of the directory listed in the mountinfo file is
+// not a shared mount from the host, which is how the container runtime sets up Bidirectional propagation
+func verifyMountPropagation(mountInfoPath, dir string) error {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", mountInfoPath, err)
+	}
+	defer f.Close()
+
+	dir = filepath.Clean(dir)
+	var mountPoint string
+	var optionalFields []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// <id> <parent id> <major:minor> <root> <mount point> <options> [optional fields...] - <fs type> <source> <super options>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		mp := unescapeMountInfo(fields[4])
+		if !isUnderDir(dir, mp) || len(mp) < len(mountPoint) {
+			continue
+		}
+		// A later entry for the same mount point is mounted over the earlier one
+		mountPoint = mp
+		optionalFields = nil
+		for _, field := range fields[6:] {
+			if field == "-" {
+				break
+			}
+			optionalFields = append(optionalFields, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", mountInfoPath, err)
+	}
+
+	if mountPoint == "" {
+		return fmt.Errorf("no mount of the kubelet directory %s in %s", dir, mountInfoPath)
+	}
+	for _, field := range optionalFields {
+		if strings.HasPrefix(field, "shared:") {
+			return nil
+		}
+	}
+	// Unless the driver runs in the mount namespace of the host, the root is the private root of the container
+	if mountPoint == "/" {
+		return fmt.Errorf("kubelet directory %s is not mounted from the host: mount it with a hostPath volume and mountPropagation: Bidirectional in the node DaemonSet, and set --kubelet-root-dir if the root directory of the kubelet is not %s", dir, defaultKubeletDir)
+	}
+	return fmt.Errorf("mount %s of the kubelet directory %s is not shared with the host (propagation %q): set mountPropagation: Bidirectional on its volume mount in the node DaemonSet, otherwise the volumes mounted by the driver are not visible to the pods", mountPoint, dir, strings.Join(optionalFields, " "))
+}
+
+// isUnderDir returns true if the mount point is dir or one of its parents
+func isUnderDir(dir, mountPoint string) bool {
+	return mountPoint == "/" || dir == mountPoint || strings.HasPrefix(dir, mountPoint+"/")
+}
+
+// unescapeMountInfo decodes the octal escapes of the space, tab, newline and backslash in mountinfo paths
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	mountInfoRoot          = "1500 1400 0:120 / / rw,relatime - overlay overlay rw,lowerdir=/l,upperdir=/u,workdir=/w\n"
+	mountInfoBidirectional = mountInfoRoot + "1510 1500 259:1 /var/lib/kubelet /var/lib/kubelet rw,relatime shared:1 - xfs /dev/nvme0n1p1 rw\n"
+	mountInfoHostToCont    = mountInfoRoot + "1510 1500 259:1 /var/lib/kubelet /var/lib/kubelet rw,relatime master:1 - xfs /dev/nvme0n1p1 rw\n"
+	mountInfoParentShared  = mountInfoRoot + "1510 1500 259:1 /var /var rw,relatime shared:1 - xfs /dev/nvme0n1p1 rw\n"
+	mountInfoEscaped       = mountInfoRoot + "1510 1500 259:1 /kubelet /my\\040kubelet rw,relatime shared:1 - xfs /dev/nvme0n1p1 rw\n"
+)
+
+func TestVerifyMountPropagation(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mountInfo  string
+		kubeletDir string
+		expectErr  bool
+	}{
+		{
+			name:       "Success: Bidirectional",
+			mountInfo:  mountInfoBidirectional,
+			kubeletDir: "/var/lib/kubelet/",
+		},
+		{
+			name:       "Success: shared parent mount",
+			mountInfo:  mountInfoParentShared,
+			kubeletDir: "/var/lib/kubelet",
+		},
+		{
+			name:       "Success: escaped mount point",
+			mountInfo:  mountInfoEscaped,
+			kubeletDir: "/my kubelet",
+		},
+		{
+			name:       "Fail: HostToContainer",
+			mountInfo:  mountInfoHostToCont,
+			kubeletDir: "/var/lib/kubelet",
+			expectErr:  true,
+		},
+		{
+			name:       "Fail: not mounted from the host",
+			mountInfo:  mountInfoBidirectional,
+			kubeletDir: "/var/lib/k0s/kubelet",
+			expectErr:  true,
+		},
+		{
+			name:       "Fail: no mount",
+			mountInfo:  "",
+			kubeletDir: "/var/lib/kubelet",
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mountinfo")
+			if err := os.WriteFile(path, []byte(tc.mountInfo), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := verifyMountPropagation(path, tc.kubeletDir)
+			if tc.expectErr && err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMountPropagationCheck(t *testing.T) {
+	if _, err := newMountPropagationCheck("strict", defaultKubeletDir); err == nil {
+		t.Fatal("Expected an invalid mode to be rejected")
+	}
+	if c, err := newMountPropagationCheck("", defaultKubeletDir); c != nil || err != nil {
+		t.Fatalf("Expected no check, got %v: %v", c, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(path, []byte(mountInfoHostToCont), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{MountPropagationCheckFail, MountPropagationCheckReport} {
+		t.Run(mode, func(t *testing.T) {
+			c, err := newMountPropagationCheck(mode, defaultKubeletDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.mountInfoPath = path
+			err = c.run()
+			if (err != nil) != (mode == MountPropagationCheckFail) {
+				t.Fatalf("Unexpected run error in mode %s: %v", mode, err)
+			}
+
+			driver := &Driver{mountPropagation: c}
+			if _, err = driver.Probe(context.Background(), &csi.ProbeRequest{}); err != nil {
+				t.Fatalf("Expected Probe to ignore the mount propagation, got %v", err)
+			}
+		})
+	}
+}
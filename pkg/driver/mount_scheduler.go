@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// mountScheduler limits the mounts of NodePublishVolume in progress on the node. When the kubelet replays the
+// NodePublishVolume calls of hundreds of pods after a reboot, the waiting calls are queued per volume and the
+// volumes take turns, so that a volume with a few pods is not stuck behind all the pods of another volume as
+// with a single FIFO queue. Within a volume, the calls are served in order.
+// A nil mountScheduler is valid and does not limit the mounts.
+type mountScheduler struct {
+	slots int
+
+	mu      sync.Mutex
+	running int
+	queues  map[string][]*mountWaiter
+	// turns holds the volumes with waiting calls, in the order they are served
+	turns []string
+}
+
+type mountWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// newMountScheduler returns the scheduler of the maximum number of mounts in progress, or nil if it is 0
+func newMountScheduler(maxConcurrentMounts int) *mountScheduler {
+	if maxConcurrentMounts <= 0 {
+		return nil
+	}
+	return &mountScheduler{
+		slots:  maxConcurrentMounts,
+		queues: map[string][]*mountWaiter{},
+	}
+}
+
+// acquire waits for the turn of the volume to mount, and returns the function to call once mounted
+func (s *mountScheduler) acquire(ctx context.Context, volumeId string) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	s.mu.Lock()
+	if s.running < s.slots && len(s.turns) == 0 {
+		s.running++
+		s.mu.Unlock()
+		mountQueueWaitSeconds.Observe(0)
+		return s.release, nil
+	}
+	w := &mountWaiter{ready: make(chan struct{})}
+	if len(s.queues[volumeId]) == 0 {
+		s.turns = append(s.turns, volumeId)
+	}
+	s.queues[volumeId] = append(s.queues[volumeId], w)
+	mountQueueLength.Inc()
+	s.mu.Unlock()
+	klog.V(4).Infof("NodePublishVolume: waiting for the turn of volume %s to mount", volumeId)
+
+	select {
+	case <-w.ready:
+		mountQueueWaitSeconds.Observe(time.Since(start).Seconds())
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.granted {
+			// The turn came along with the cancellation, pass it on
+			s.running--
+			s.dispatch()
+		} else {
+			s.remove(volumeId, w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *mountScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.dispatch()
+}
+
+// dispatch grants the free slots to the first waiter of each volume in turn. It must be called with the lock held.
+func (s *mountScheduler) dispatch() {
+	for s.running < s.slots && len(s.turns) > 0 {
+		volumeId := s.turns[0]
+		s.turns = s.turns[1:]
+		queue := s.queues[volumeId]
+		w := queue[0]
+		if len(queue) > 1 {
+			s.queues[volumeId] = queue[1:]
+			s.turns = append(s.turns, volumeId)
+		} else {
+			delete(s.queues, volumeId)
+		}
+		w.granted = true
+		close(w.ready)
+		s.running++
+		mountQueueLength.Dec()
+	}
+}
+
+// remove drops the waiter of the volume that gave up. It must be called with the lock held.
+func (s *mountScheduler) remove(volumeId string, w *mountWaiter) {
+	queue := s.queues[volumeId]
+	for i := range queue {
+		if queue[i] == w {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			mountQueueLength.Dec()
+			break
+		}
+	}
+	if len(queue) > 0 {
+		s.queues[volumeId] = queue
+		return
+	}
+	delete(s.queues, volumeId)
+	for i := range s.turns {
+		if s.turns[i] == volumeId {
+			s.turns = append(s.turns[:i:i], s.turns[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// waitForWaiters waits until the number of calls waiting for their turn reaches n
+func waitForWaiters(t *testing.T, s *mountScheduler, n int) {
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		waiters := 0
+		for _, queue := range s.queues {
+			waiters += len(queue)
+		}
+		s.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d waiting calls", n)
+}
+
+func TestMountSchedulerFairness(t *testing.T) {
+	s := newMountScheduler(1)
+	release, err := s.acquire(context.Background(), "fs-busy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The pods of volume a are queued before the one of volume b
+	granted := make(chan string)
+	calls := []struct{ volumeId, pod string }{
+		{"fs-a", "a1"}, {"fs-a", "a2"}, {"fs-a", "a3"}, {"fs-b", "b1"},
+	}
+	for i, call := range calls {
+		call := call
+		go func() {
+			if _, err := s.acquire(context.Background(), call.volumeId); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			granted <- call.pod
+		}()
+		waitForWaiters(t, s, i+1)
+	}
+	if length := testutil.ToFloat64(mountQueueLength); length != 4 {
+		t.Fatalf("Expected 4 queued calls, got %v", length)
+	}
+
+	var order []string
+	for range calls {
+		release()
+		order = append(order, <-granted)
+		release = s.release
+	}
+	release()
+	if expected := []string{"a1", "b1", "a2", "a3"}; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Expected the volumes to take turns %v, got %v", expected, order)
+	}
+	if s.running != 0 || len(s.turns) != 0 || testutil.ToFloat64(mountQueueLength) != 0 {
+		t.Fatalf("Expected an idle scheduler, got %d running and turns %v", s.running, s.turns)
+	}
+}
+
+func TestMountSchedulerCancellation(t *testing.T) {
+	s := newMountScheduler(1)
+	release, err := s.acquire(context.Background(), "fs-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, "fs-b"); err == nil {
+		t.Fatal("Expected the call to give up waiting")
+	}
+	if len(s.queues) != 0 || len(s.turns) != 0 || testutil.ToFloat64(mountQueueLength) != 0 {
+		t.Fatalf("Expected the call to leave the queue, got %v", s.queues)
+	}
+	release()
+	if _, err := s.acquire(context.Background(), "fs-b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var disabled *mountScheduler
+	if release, err := disabled.acquire(context.Background(), "fs-a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else {
+		release()
+	}
+}
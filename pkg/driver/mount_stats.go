@@ -0,0 +1,244 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// MountStatsAnnotationKey is the CSINode annotation holding the per volume mount summary of the node
+	MountStatsAnnotationKey = "efs.csi.aws.com/mount-stats"
+
+	// maxMountErrorLength caps the length of the last error kept per volume, to keep the annotation compact
+	maxMountErrorLength = 256
+
+	// unpublishedMountStatsTTL is how long the stats of a volume not published at any target, e.g. whose mounts
+	// failed, are kept after its last mount attempt, so that the annotation shows the failures for a while
+	// without growing with every volume that ever failed to mount on the node
+	unpublishedMountStatsTTL = time.Hour
+)
+
+// volumeMountStats summarizes the mount attempts of a published volume
+type volumeMountStats struct {
+	Attempts      int    `json:"attempts"`
+	Failures      int    `json:"failures"`
+	LastLatencyMs int64  `json:"lastLatencyMs"`
+	LastError     string `json:"lastError,omitempty"`
+	LastErrorTime string `json:"lastErrorTime,omitempty"`
+	lastAttempt   time.Time
+}
+
+// mountStatsRecorder keeps track of the mount attempts of the volumes published on the node.
+// A nil recorder is valid and discards everything.
+type mountStatsRecorder struct {
+	mu    sync.Mutex
+	stats map[string]*volumeMountStats
+	// targets are the targets of the published volumes, whose stats are kept until their last target is
+	// unpublished
+	targets map[string]map[string]bool
+	// dirty is set when the stats changed since they were last published
+	dirty bool
+	now   func() time.Time
+}
+
+func newMountStatsRecorder() *mountStatsRecorder {
+	return &mountStatsRecorder{
+		stats:   make(map[string]*volumeMountStats),
+		targets: make(map[string]map[string]bool),
+		now:     time.Now,
+	}
+}
+
+// record records a mount attempt of the volume
+func (r *mountStatsRecorder) record(volumeId string, latency time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	mountDurationSeconds.WithLabelValues(volumeId, result).Observe(latency.Seconds())
+
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stats[volumeId]
+	if !ok {
+		s = &volumeMountStats{}
+		r.stats[volumeId] = s
+	}
+	s.Attempts++
+	s.LastLatencyMs = latency.Milliseconds()
+	s.lastAttempt = r.now()
+	if err != nil {
+		s.Failures++
+		s.LastError = truncateUTF8(err.Error(), maxMountErrorLength)
+		s.LastErrorTime = s.lastAttempt.UTC().Format(time.RFC3339)
+	}
+	r.dirty = true
+	r.expireLocked()
+}
+
+// expireLocked forgets the volumes not published at any target whose last mount attempt is older than
+// unpublishedMountStatsTTL. Only a successful NodePublishVolume adds a target, and NodeUnpublishVolume removes
+// the stats of the volumes it unpublishes, so these are the volumes that failed to mount.
+func (r *mountStatsRecorder) expireLocked() {
+	for volumeId, s := range r.stats {
+		if len(r.targets[volumeId]) > 0 || r.now().Sub(s.lastAttempt) < unpublishedMountStatsTTL {
+			continue
+		}
+		delete(r.stats, volumeId)
+		mountDurationSeconds.DeletePartialMatch(prometheus.Labels{"volume_id": volumeId})
+		r.dirty = true
+	}
+}
+
+// add records that the volume is published at the target
+func (r *mountStatsRecorder) add(volumeId, target string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.targets[volumeId] == nil {
+		r.targets[volumeId] = map[string]bool{}
+	}
+	r.targets[volumeId][target] = true
+}
+
+// remove forgets the target of the volume, and the volume once it is no longer published at any target of
+// the node
+func (r *mountStatsRecorder) remove(volumeId, target string) {
+	if r == nil {
+		mountDurationSeconds.DeletePartialMatch(prometheus.Labels{"volume_id": volumeId})
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.targets[volumeId], target)
+	if len(r.targets[volumeId]) > 0 {
+		return
+	}
+	delete(r.targets, volumeId)
+	mountDurationSeconds.DeletePartialMatch(prometheus.Labels{"volume_id": volumeId})
+	if _, ok := r.stats[volumeId]; ok {
+		delete(r.stats, volumeId)
+		r.dirty = true
+	}
+}
+
+// truncateUTF8 returns the first bytes of s, at most n, without splitting a multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// marshalIfDirty returns the JSON summary of all volumes if it changed since the last call
+func (r *mountStatsRecorder) marshalIfDirty() ([]byte, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireLocked()
+	if !r.dirty {
+		return nil, false, nil
+	}
+	data, err := json.Marshal(r.stats)
+	if err != nil {
+		return nil, false, err
+	}
+	r.dirty = false
+	return data, true, nil
+}
+
+// markDirty makes the next publish attempt retry after a failed one
+func (r *mountStatsRecorder) markDirty() {
+	r.mu.Lock()
+	r.dirty = true
+	r.mu.Unlock()
+}
+
+// runMountStatsPublisher publishes the mount stats as an annotation on the CSINode object of the
+// local node at most once per interval, and only when they changed.
+func (r *mountStatsRecorder) runMountStatsPublisher(interval time.Duration, k8sClient cloud.KubernetesAPIClient, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.publish(k8sClient); err != nil {
+				klog.Warningf("Failed to publish mount stats: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (r *mountStatsRecorder) publish(k8sClient cloud.KubernetesAPIClient) error {
+	nodeName := os.Getenv("CSI_NODE_NAME")
+	if nodeName == "" {
+		klog.V(4).InfoS("CSI_NODE_NAME missing, skipping mount stats publishing")
+		return nil
+	}
+
+	data, ok, err := r.marshalIfDirty()
+	if err != nil || !ok {
+		return err
+	}
+
+	clientset, err := k8sClient()
+	if err != nil {
+		r.markDirty()
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				MountStatsAnnotationKey: string(data),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.StorageV1().CSINodes().Patch(context.Background(), nodeName, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		r.markDirty()
+		return err
+	}
+	klog.V(5).Infof("Published mount stats on CSINode %s: %s", nodeName, string(data))
+	return nil
+}
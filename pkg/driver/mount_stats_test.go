@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMountStatsRecorder(t *testing.T) {
+	r := newMountStatsRecorder()
+	r.record("fs-abcd1234", 100*time.Millisecond, nil)
+	r.record("fs-abcd1234", 200*time.Millisecond, errors.New(strings.Repeat("x", 2*maxMountErrorLength)))
+	r.record("fs-efgh5678", 300*time.Millisecond, nil)
+
+	data, ok, err := r.marshalIfDirty()
+	if err != nil || !ok {
+		t.Fatalf("Expected dirty stats, got ok: %v, err: %v", ok, err)
+	}
+	stats := map[string]*volumeMountStats{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatalf("Failed to unmarshal stats: %v", err)
+	}
+	s := stats["fs-abcd1234"]
+	if s.Attempts != 2 || s.Failures != 1 || s.LastLatencyMs != 200 {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+	if len(s.LastError) != maxMountErrorLength || s.LastErrorTime == "" {
+		t.Fatalf("Expected truncated last error with a timestamp, got %+v", s)
+	}
+
+	if _, ok, _ := r.marshalIfDirty(); ok {
+		t.Fatal("Expected stats not to be dirty after they were marshaled")
+	}
+
+	// The stats of a volume are kept until its last target is unpublished
+	r.add("fs-efgh5678", "/target-1")
+	r.add("fs-efgh5678", "/target-2")
+	r.remove("fs-efgh5678", "/target-1")
+	if _, ok, _ := r.marshalIfDirty(); ok {
+		t.Fatal("Expected the stats of a volume still published to be kept")
+	}
+	r.remove("fs-efgh5678", "/target-2")
+	data, ok, _ = r.marshalIfDirty()
+	if !ok || strings.Contains(string(data), "fs-efgh5678") {
+		t.Fatalf("Expected removed volume to be gone from stats, got %s", string(data))
+	}
+
+	// A nil recorder discards everything
+	var nilRecorder *mountStatsRecorder
+	nilRecorder.record("fs-abcd1234", time.Second, nil)
+	nilRecorder.add("fs-abcd1234", "/target")
+	nilRecorder.remove("fs-abcd1234", "/target")
+}
+
+func TestMountStatsRecorderExpiresFailedVolumes(t *testing.T) {
+	now := time.Now()
+	r := newMountStatsRecorder()
+	r.now = func() time.Time { return now }
+
+	// A volume that failed to mount has no target, one mounted since has one
+	r.record("fs-abcd1234", time.Second, errors.New("mount failed"))
+	r.record("fs-efgh5678", time.Second, errors.New("mount failed"))
+	r.record("fs-efgh5678", time.Second, nil)
+	r.add("fs-efgh5678", "/target")
+	data, ok, _ := r.marshalIfDirty()
+	if !ok || !strings.Contains(string(data), "fs-abcd1234") {
+		t.Fatalf("Expected the failed volume to be kept for a while, got %s", string(data))
+	}
+
+	now = now.Add(unpublishedMountStatsTTL)
+	data, ok, _ = r.marshalIfDirty()
+	if !ok || strings.Contains(string(data), "fs-abcd1234") || !strings.Contains(string(data), "fs-efgh5678") {
+		t.Fatalf("Expected only the failed volume to expire, got %s", string(data))
+	}
+	if len(r.stats) != 1 {
+		t.Fatalf("Expected the stats of 1 volume, got %d", len(r.stats))
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{s: "short", n: 10, expected: "short"},
+		{s: "truncated", n: 5, expected: "trunc"},
+		// é is 2 bytes, 日 is 3 bytes
+		{s: "caf\u00e9", n: 4, expected: "caf"},
+		{s: "\u65e5\u672c", n: 5, expected: "\u65e5"},
+	} {
+		actual := truncateUTF8(tc.s, tc.n)
+		if actual != tc.expected || !utf8.ValidString(actual) {
+			t.Errorf("Expected %q truncated to %d bytes to be %q, got %q", tc.s, tc.n, tc.expected, actual)
+		}
+	}
+}
+
+func TestMountStatsPublish(t *testing.T) {
+	nodeName := "test-node-123"
+	t.Setenv("CSI_NODE_NAME", nodeName)
+
+	clientset := fake.NewSimpleClientset(&storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+	})
+	k8sClient := func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+
+	r := newMountStatsRecorder()
+	r.record("fs-abcd1234", time.Second, errors.New("mount failed"))
+	if err := r.publish(k8sClient); err != nil {
+		t.Fatalf("Failed to publish mount stats: %v", err)
+	}
+
+	csiNode, err := clientset.StorageV1().CSINodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get CSINode: %v", err)
+	}
+	annotation := csiNode.Annotations[MountStatsAnnotationKey]
+	if !strings.Contains(annotation, "mount failed") {
+		t.Fatalf("Expected annotation to contain the last error, got %q", annotation)
+	}
+
+	// Failing to publish keeps the stats dirty for the next attempt
+	r.record("fs-abcd1234", time.Second, nil)
+	if err := r.publish(func() (kubernetes.Interface, error) {
+		return nil, errors.New("no client")
+	}); err == nil {
+		t.Fatal("Expected publish to fail")
+	}
+	if _, ok, _ := r.marshalIfDirty(); !ok {
+		t.Fatal("Expected stats to stay dirty after a failed publish")
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// mountTargetCache is a ConfigMap mapping every file system and availability zone to the IP address of
+// its mount target. The controller maintains it and the nodes consult it before falling back to DNS,
+// so that nodes neither need to resolve nor describe the mount targets themselves. The nodes watch the
+// ConfigMap instead of getting it on every lookup.
+// A nil cache is valid and never finds anything.
+type mountTargetCache struct {
+	namespace string
+	name      string
+	k8sClient cloud.KubernetesAPIClient
+	aliases   *fileSystemAliases
+
+	configMaps cache.SharedIndexInformer
+}
+
+// newMountTargetCache returns the cache stored in the ConfigMap referenced as namespace/name, or nil if empty
+func newMountTargetCache(configMap string, k8sClient cloud.KubernetesAPIClient) (*mountTargetCache, error) {
+	if configMap == "" {
+		return nil, nil
+	}
+	parts := strings.Split(configMap, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("mount target cache ConfigMap %q must be of the form namespace/name", configMap)
+	}
+	return &mountTargetCache{
+		namespace: parts[0],
+		name:      parts[1],
+		k8sClient: k8sClient,
+	}, nil
+}
+
+func mountTargetCacheKey(fileSystemId, az string) string {
+	return fileSystemId + "." + az
+}
+
+// run watches the ConfigMap until stopCh is closed. It must be called before the lookups.
+func (c *mountTargetCache) run(stopCh <-chan struct{}) error {
+	clientset, err := c.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	c.configMaps = newSingleObjectInformer(clientset, &corev1.ConfigMap{}, c.namespace, c.name)
+	go c.configMaps.Run(stopCh)
+	return nil
+}
+
+// lookup returns the IP address of the mount target of the file system in the availability zone. Nothing is
+// found until the ConfigMap is synced.
+func (c *mountTargetCache) lookup(fileSystemId, az string) (string, bool) {
+	if c == nil || c.configMaps == nil || az == "" {
+		return "", false
+	}
+	if !c.configMaps.HasSynced() {
+		klog.V(4).Infof("Mount target cache %s/%s is not synced yet", c.namespace, c.name)
+		return "", false
+	}
+	obj, ok, err := c.configMaps.GetStore().GetByKey(c.namespace + "/" + c.name)
+	if err != nil || !ok {
+		klog.Warningf("Failed to get mount target cache %s/%s: found %t: %v", c.namespace, c.name, ok, err)
+		return "", false
+	}
+	cm := obj.(*corev1.ConfigMap)
+	ip, ok := cm.Data[mountTargetCacheKey(fileSystemId, az)]
+	return ip, ok && ip != ""
+}
+
+// runRefresher refreshes the cache once per interval until stopCh is closed
+func (c *mountTargetCache) runRefresher(interval time.Duration, localCloud cloud.Cloud, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.refresh(context.Background(), localCloud); err != nil {
+			klog.Warningf("Failed to refresh mount target cache: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// refresh describes the mount targets of the file systems used by the storage classes and persistent
+// volumes of the driver and stores them in the ConfigMap. The entries of a file system whose mount targets
+// cannot be described, e.g. because it belongs to another account, are kept as is.
+func (c *mountTargetCache) refresh(ctx context.Context, localCloud cloud.Cloud) error {
+	clientset, err := c.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+
+	fileSystemIds, err := listFileSystemIds(ctx, clientset, c.aliases)
+	if err != nil {
+		return err
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: c.namespace, Name: c.name},
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s/%s: %v", c.namespace, c.name, err)
+	}
+
+	data := map[string]string{}
+	for _, fileSystemId := range fileSystemIds {
+		mountTargets, err := localCloud.ListMountTargets(ctx, fileSystemId)
+		if err != nil {
+			klog.Warningf("Failed to list mount targets of file system %v, keeping its cached mount targets: %v", fileSystemId, err)
+			for k, v := range cm.Data {
+				if strings.HasPrefix(k, fileSystemId+".") {
+					data[k] = v
+				}
+			}
+			continue
+		}
+		// The mount targets are sorted by preference, the first one of every availability zone is cached
+		for _, mt := range mountTargets {
+			if key := mountTargetCacheKey(fileSystemId, mt.AZName); data[key] == "" {
+				data[key] = mt.IPAddress
+			}
+		}
+	}
+	cm.Data = data
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(c.namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(c.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store ConfigMap %s/%s: %v", c.namespace, c.name, err)
+	}
+	klog.V(4).Infof("Cached %d mount targets of %d file systems in ConfigMap %s/%s", len(data), len(fileSystemIds), c.namespace, c.name)
+	return nil
+}
+
+// listFileSystemIds returns the file systems used by the storage classes and persistent volumes of the driver,
+// resolving the ARNs and aliases of the storage classes
+func listFileSystemIds(ctx context.Context, clientset kubernetes.Interface, aliases *fileSystemAliases) ([]string, error) {
+	ids := map[string]bool{}
+
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %v", err)
+	}
+	for _, sc := range scs.Items {
+		if sc.Provisioner != driverName {
+			continue
+		}
+		fsId, err := aliases.storageClassFileSystemId(sc.Parameters)
+		if err != nil {
+			klog.V(4).Infof("Not caching the mount targets of storage class %s: %v", sc.Name, err)
+			continue
+		}
+		if isValidFileSystemId(fsId) {
+			ids[fsId] = true
+		}
+	}
+
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		if fsid, _, _, err := parseVolumeId(pv.Spec.CSI.VolumeHandle); err == nil {
+			ids[fsid] = true
+		}
+	}
+
+	var fileSystemIds []string
+	for id := range ids {
+		fileSystemIds = append(fileSystemIds, id)
+	}
+	sort.Strings(fileSystemIds)
+	return fileSystemIds, nil
+}
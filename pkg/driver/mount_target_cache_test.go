@@ -0,0 +1,288 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestNewMountTargetCache(t *testing.T) {
+	testCases := []struct {
+		configMap string
+		expectNil bool
+		expectErr bool
+	}{
+		{configMap: "", expectNil: true},
+		{configMap: "kube-system/efs-mount-targets"},
+		{configMap: "efs-mount-targets", expectErr: true},
+		{configMap: "kube-system/", expectErr: true},
+		{configMap: "a/b/c", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.configMap, func(t *testing.T) {
+			c, err := newMountTargetCache(tc.configMap, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (c == nil) != tc.expectNil {
+				t.Fatalf("Expected nil cache: %v, got %+v", tc.expectNil, c)
+			}
+		})
+	}
+}
+
+func TestMountTargetCacheRefresh(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	ctx := context.Background()
+
+	clientset := fake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs-sc"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "fs-abcd1234"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "ebs-sc"},
+			Provisioner: "ebs.csi.aws.com",
+			Parameters:  map[string]string{FsId: "fs-ignored"},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-static"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: "fs-efgh5678::fsap-abcd1234"},
+				},
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "efs-mount-targets", ResourceVersion: "1"},
+			Data: map[string]string{
+				"fs-efgh5678.us-east-1a": "10.0.1.5",
+				"fs-stale.us-east-1a":    "10.0.1.6",
+			},
+		},
+	)
+	c, err := newMountTargetCache("kube-system/efs-mount-targets", func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockCloud.EXPECT().ListMountTargets(gomock.Eq(ctx), gomock.Eq("fs-abcd1234")).Return([]*cloud.MountTarget{
+		{AZName: "us-east-1a", IPAddress: "10.0.0.1"},
+		{AZName: "us-east-1b", IPAddress: "10.0.0.2"},
+	}, nil)
+	// The entries of a file system whose mount targets cannot be listed are kept
+	mockCloud.EXPECT().ListMountTargets(gomock.Eq(ctx), gomock.Eq("fs-efgh5678")).Return(nil, cloud.ErrAccessDenied)
+
+	if err := c.refresh(ctx, mockCloud); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "efs-mount-targets", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"fs-abcd1234.us-east-1a": "10.0.0.1",
+		"fs-abcd1234.us-east-1b": "10.0.0.2",
+		"fs-efgh5678.us-east-1a": "10.0.1.5",
+	}
+	if !reflect.DeepEqual(cm.Data, expected) {
+		t.Fatalf("Expected cache %v, got %v", expected, cm.Data)
+	}
+
+	runSyncedMountTargetCache(t, c)
+	if ip, ok := c.lookup("fs-abcd1234", "us-east-1b"); !ok || ip != "10.0.0.2" {
+		t.Fatalf("Expected cached mount target IP 10.0.0.2, got %q", ip)
+	}
+	if _, ok := c.lookup("fs-abcd1234", "us-east-1c"); ok {
+		t.Fatal("Expected no mount target in us-east-1c")
+	}
+
+	// A nil cache never finds anything
+	var nilCache *mountTargetCache
+	if _, ok := nilCache.lookup("fs-abcd1234", "us-east-1a"); ok {
+		t.Fatal("Expected nil cache to find nothing")
+	}
+}
+
+// runSyncedMountTargetCache watches the ConfigMap of the cache until the end of the test, once synced
+func runSyncedMountTargetCache(t *testing.T, c *mountTargetCache) {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := c.run(stopCh); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !c.configMaps.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the mount target cache to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListFileSystemIdsAliases(t *testing.T) {
+	aliases := newSyncedFileSystemAliases(t, map[string]string{
+		"team-a-prod": "fs-abcd1234",
+		"team-b-prod": "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-1234abcd",
+	})
+	clientset := fake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "team-a"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "team-a-prod"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "team-b"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "team-b-prod"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "team-c"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "team-c-prod"},
+		},
+	)
+	ids, err := listFileSystemIds(context.Background(), clientset, aliases)
+	if err != nil {
+		t.Fatalf("listFileSystemIds failed: %v", err)
+	}
+	sort.Strings(ids)
+	if expected := []string{"fs-1234abcd", "fs-abcd1234"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("Expected file systems %v, got %v", expected, ids)
+	}
+}
+
+func TestMountTargetCacheRefreshCreatesConfigMap(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	ctx := context.Background()
+
+	clientset := fake.NewSimpleClientset(&storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "efs-sc"},
+		Provisioner: driverName,
+		Parameters:  map[string]string{FsId: "fs-abcd1234"},
+	})
+	c, err := newMountTargetCache("kube-system/efs-mount-targets", func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockCloud.EXPECT().ListMountTargets(gomock.Eq(ctx), gomock.Eq("fs-abcd1234")).Return([]*cloud.MountTarget{
+		{AZName: "us-east-1a", IPAddress: "10.0.0.1"},
+	}, nil)
+	if err := c.refresh(ctx, mockCloud); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	runSyncedMountTargetCache(t, c)
+	if ip, ok := c.lookup("fs-abcd1234", "us-east-1a"); !ok || ip != "10.0.0.1" {
+		t.Fatalf("Expected cached mount target IP 10.0.0.1, got %q", ip)
+	}
+}
+
+func TestNodePublishVolumeMountTargetCache(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+	fakeCloud := cloud.NewFakeCloudProvider()
+	az := fakeCloud.GetMetadata().GetAvailabilityZone()
+
+	testCases := []struct {
+		name          string
+		volumeContext map[string]string
+		expectOpts    []string
+	}{
+		{
+			name:       "success: cached mount target IP is used",
+			expectOpts: []string{"tls", "mounttargetip=10.0.0.1"},
+		},
+		{
+			name:          "success: mount target IP of the volume context takes precedence",
+			volumeContext: map[string]string{"mounttargetip": "10.0.0.9"},
+			expectOpts:    []string{"mounttargetip=10.0.0.9", "tls"},
+		},
+		{
+			name:          "success: cross account mounts resolve the mount target",
+			volumeContext: map[string]string{"crossaccount": "true"},
+			expectOpts:    []string{"tls", "crossaccount"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			driver.cloud = fakeCloud
+
+			clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "efs-mount-targets"},
+				Data:       map[string]string{mountTargetCacheKey(volumeId, az): "10.0.0.1"},
+			})
+			driver.mountTargetCache, _ = newMountTargetCache("kube-system/efs-mount-targets", func() (kubernetes.Interface, error) {
+				return clientset, nil
+			})
+			runSyncedMountTargetCache(t, driver.mountTargetCache)
+
+			mockMounter.EXPECT().MakeDir(targetPath).Return(nil)
+			mockMounter.EXPECT().Mount(volumeId+":/", targetPath, "efs", tc.expectOpts).Return(nil)
+
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+				VolumeContext:    tc.volumeContext,
+			})
+			testResult(t, "NodePublishVolume", ret, err, errtyp{})
+		})
+	}
+}
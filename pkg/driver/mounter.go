@@ -14,11 +14,16 @@ limitations under the License.
 package driver
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
+	"time"
 
 	mount_utils "k8s.io/mount-utils"
 )
 
+//go:generate go run ../../hack/instrumentgen -type nodeMounter -name instrumentedMounter -dependency mounter -output zz_generated.instrumented_mounter.go
+
 // Mounter is an interface for mount operations
 type Mounter interface {
 	mount_utils.Interface
@@ -26,14 +31,22 @@ type Mounter interface {
 	GetDeviceName(mountPath string) (string, int, error)
 }
 
+// nodeMounter is the Mounter of the node, which may also unmount with force or lazily. The mounter of the node
+// is wrapped with a decorator of it, so that the optional interfaces are still implemented.
+type nodeMounter interface {
+	Mounter
+	mount_utils.MounterForceUnmounter
+	LazyUnmounter
+}
+
 type NodeMounter struct {
 	mount_utils.Interface
 }
 
 func newNodeMounter() Mounter {
-	return &NodeMounter{
+	return newInstrumentedMounter(&NodeMounter{
 		Interface: mount_utils.New(""),
-	}
+	})
 }
 
 func (m *NodeMounter) MakeDir(pathname string) error {
@@ -46,6 +59,23 @@ func (m *NodeMounter) MakeDir(pathname string) error {
 	return nil
 }
 
+// UnmountWithForce unmounts the target, with force if it takes longer than the timeout
+func (m *NodeMounter) UnmountWithForce(target string, umountTimeout time.Duration) error {
+	if forceUnmounter, ok := m.Interface.(mount_utils.MounterForceUnmounter); ok {
+		return forceUnmounter.UnmountWithForce(target, umountTimeout)
+	}
+	return m.Unmount(target)
+}
+
+// UnmountLazy detaches the target with umount -l, even if it is busy
+func (m *NodeMounter) UnmountLazy(target string) error {
+	output, err := exec.Command("umount", "-l", target).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("umount -l %s failed: %v, output: %s", target, err, string(output))
+	}
+	return nil
+}
+
 func (m *NodeMounter) GetDeviceName(mountPath string) (string, int, error) {
 	return mount_utils.GetDeviceNameFromMount(m, mountPath)
 }
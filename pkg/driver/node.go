@@ -19,12 +19,14 @@ package driver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -45,6 +47,12 @@ var (
 	}
 	volumeIdCounter  = make(map[string]int)
 	supportedFSTypes = []string{"efs", ""}
+	// volumeIdCounterMu guards volumeIdCounter, updated by the gRPC calls and the admin server
+	volumeIdCounterMu sync.Mutex
+
+	// volMetricsOverrides holds the volume metrics options set via volume attributes, per volume ID
+	volMetricsOverrides   = make(map[string]volMetricsOptions)
+	volMetricsOverridesMu sync.RWMutex
 )
 
 func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
@@ -63,6 +71,11 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 	if len(target) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Target path not provided")
 	}
+	// The kubelet publishes the volumes of the pods under its root directory, a mount elsewhere is not
+	// visible to the pods when the root directory is the only one mounted with Bidirectional propagation
+	if d.kubeletDir != "" && !isKubeletPodPath(d.kubeletDir, target) && !d.volumePrewarm.isStagingPath(target) {
+		klog.Warningf("NodePublishVolume: target path %s is not in the pods directory of the kubelet root directory %s, set --kubelet-root-dir to the --root-dir of the kubelet", target, d.kubeletDir)
+	}
 
 	volCap := req.GetVolumeCapability()
 	if volCap == nil {
@@ -77,47 +90,44 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 		return nil, status.Error(codes.InvalidArgument, "Volume capability access type must be mount")
 	}
 
-	// TODO when CreateVolume is implemented, it must use the same key names
-	subpath := "/"
-	encryptInTransit := true
-	crossAccountDNSEnabled := false
-	volContext := req.GetVolumeContext()
-	for k, v := range volContext {
-		switch strings.ToLower(k) {
-		//Deprecated
-		case "path":
-			klog.Warning("Use of path under volumeAttributes is deprecated. This field will be removed in future release")
-			if !filepath.IsAbs(v) {
-				return nil, status.Errorf(codes.InvalidArgument, "Volume context property %q must be an absolute path", k)
-			}
-			subpath = filepath.Join(subpath, v)
-		case "storage.kubernetes.io/csiprovisioneridentity":
-			continue
-		case "encryptintransit":
-			var err error
-			encryptInTransit, err = strconv.ParseBool(v)
-			if err != nil {
-				return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume context property %q must be a boolean value: %v", k, err))
-			}
-		case MountTargetIp:
-			ipAddr := volContext[MountTargetIp]
-			mountOptions = append(mountOptions, MountTargetIp+"="+ipAddr)
-		case CrossAccount:
-			var err error
-			crossAccountDNSEnabled, err = strconv.ParseBool(v)
-			if err != nil {
-				return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume context property %q must be a boolean value: %v", k, err))
+	volContext, err := parseVolumeContext(nodePublishVolumeContext, req.GetVolumeContext())
+	if err != nil {
+		return nil, err
+	}
+
+	// The target may have been published before the node plugin restarted
+	if published, ok := d.nodeState.lookup(target); ok {
+		if notMnt, err := d.mounter.IsLikelyNotMountPoint(target); err == nil && !notMnt {
+			if published.VolumeId != req.GetVolumeId() || published.RequestHash != publishRequestHash(req) {
+				return nil, status.Errorf(codes.AlreadyExists, "Target %q is already published with volume %s or other options", target, published.VolumeId)
 			}
-		default:
-			return nil, status.Errorf(codes.InvalidArgument, "Volume context property %s not supported.", k)
+			klog.V(4).Infof("NodePublishVolume: %s is already published", target)
+			return &csi.NodePublishVolumeResponse{}, nil
 		}
+		d.nodeState.remove(target)
+		d.publishedOptions.remove(target)
 	}
 
-	fsid, vpath, apid, err := parseVolumeId(req.GetVolumeId())
+	subpath := "/"
+	if p, ok := volContext.get("path"); ok {
+		subpath = filepath.Join(subpath, p)
+	}
+	family := volumeIPFamily(volContext)
+	if ipAddr, ok := volContext.get(MountTargetIp); ok {
+		if !family.allows(ipAddr) {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume context property %q %s is not an address of the %q %s", MountTargetIp, ipAddr, IpFamily, family)
+		}
+		mountOptions = append(mountOptions, MountTargetIp+"="+ipAddr)
+	}
+	encryptInTransit := volContext.getBool("encryptintransit")
+	crossAccountDNSEnabled := volContext.getBool(CrossAccount)
+
+	handle, err := parseVolumeHandle(req.GetVolumeId())
 	if err != nil {
-		// parseVolumeId returns the appropriate error
+		// parseVolumeHandle returns the appropriate error
 		return nil, err
 	}
+	fsid, vpath, apid := handle.fileSystemId, handle.subpath, handle.accessPointId
 	// The `vpath` takes precedence if specified. If not specified, we'll either use the
 	// (deprecated) `path` from the volContext, or default to "/" from above.
 	if vpath != "" {
@@ -130,10 +140,22 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 	//   also specified in the incoming mount options and react appropriately.)
 	// - The TLS option. Access point mounts won't work without it. (For ease of use, we won't
 	//   require this to be present in the mountOptions already, but we won't complain if it is.)
-	if apid != "" {
+	// A mount helper supporting the access point mount sources gets the access point in the source instead.
+	if apid != "" && d.accessPointSource {
+		source = fmt.Sprintf("%s.%s:%s", apid, fsid, subpath)
+		mountOptions = append(mountOptions, "tls")
+	} else if apid != "" {
 		mountOptions = append(mountOptions, fmt.Sprintf("accesspoint=%s", apid), "tls")
 	}
 
+	// A mount target behind NAT or port forwarding listens on another port than the NFS port
+	if port, ok := volContext.get(MountTargetPort); ok {
+		if apid != "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume context property %q is not supported with an access point, which is mounted with TLS", MountTargetPort)
+		}
+		mountOptions = append(mountOptions, "port="+port)
+	}
+
 	if encryptInTransit {
 		// The TLS option may have been added above if apid was set
 		// TODO: mountOptions should be a set to avoid all this hasOption checking
@@ -144,10 +166,18 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 
 	if crossAccountDNSEnabled {
 		mountOptions = append(mountOptions, CrossAccount)
+		if d.crossAccountRoles != nil {
+			if err := d.crossAccountRoles.validate(ctx, req.GetVolumeId(), d.cloud.GetMetadata().GetRegion(), req.GetSecrets()); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if req.GetReadonly() {
 		mountOptions = append(mountOptions, "ro")
+	} else if apid != "" && vpath == "" && d.quotaEnforcer.publishReadOnly(ctx, target) {
+		klog.Warningf("NodePublishVolume: volume %s is over the capacity of its claim, publishing it read-only", req.GetVolumeId())
+		mountOptions = append(mountOptions, "ro")
 	}
 
 	if m := volCap.GetMount(); m != nil {
@@ -169,6 +199,10 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 					return nil, status.Errorf(codes.InvalidArgument,
 						"Found conflicting access point IDs in mountOptions (%s) and volumeHandle (%s)", moapid, apid)
 				}
+				// The access point is already in the source
+				if apid != "" && d.accessPointSource {
+					continue
+				}
 				// Fall through; the code below will uniq for us.
 			}
 
@@ -193,30 +227,228 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 			}
 		}
 	}
+
+	// Options of the node are appended after the options of the volume, which win
+	ruleOptions, err := d.mountOptionRules.mountOptions()
+	if err != nil {
+		klog.Warningf("NodePublishVolume: not applying the mount option rules of the node: %v", err)
+	} else if len(ruleOptions) > 0 {
+		klog.V(4).Infof("NodePublishVolume: applying mount options %v of the node", ruleOptions)
+		mountOptions = appendMountOptionRules(mountOptions, ruleOptions)
+	}
+
+	mountOptions, err = d.secureMountOptions.apply(req.GetVolumeId(), mountOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// A replica file system in another region than the node is mounted with the region of the volume. Its DNS
+	// name suffix cannot be passed to efs-utils, which derives it from the region, so the node resolves the
+	// DNS name of the file system itself and passes the mount target IP instead.
+	volRegion, hasVolRegion := volContext.get(VolumeRegion)
+	// The v2 volume handle of a file system in another region than the controller has its region
+	if handle.region != "" {
+		if hasVolRegion && volRegion != handle.region {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume context property %q %v does not match the region %v of volume ID %v", VolumeRegion, volRegion, handle.region, req.GetVolumeId())
+		}
+		volRegion, hasVolRegion = handle.region, true
+	}
+	if hasVolRegion && !hasOptionPrefix(mountOptions, "region=") {
+		mountOptions = append(mountOptions, "region="+volRegion)
+	}
+	if suffix, ok := volContext.get(DnsNameSuffix); ok && !hasOptionPrefix(mountOptions, MountTargetIp+"=") {
+		region := volRegion
+		if !hasVolRegion {
+			region = d.cloud.GetMetadata().GetRegion()
+		}
+		resolver := d.dnsResolver
+		if resolver == nil {
+			resolver = systemDNSResolver
+		}
+		ipAddr, ok := resolver.resolveWithSuffix(ctx, fsid, region, suffix, "", family)
+		if !ok {
+			return nil, status.Errorf(codes.Unavailable, "Could not resolve file system %v in region %v with DNS name suffix %v", fsid, region, suffix)
+		}
+		klog.V(4).Infof("NodePublishVolume: using resolved mount target IP %s of file system %s", ipAddr, fsid)
+		mountOptions = append(mountOptions, MountTargetIp+"="+ipAddr)
+	}
+
+	// A file system identified by its ARN is owned by another account or in another region, where its
+	// default DNS name does not resolve. Unless its mount target IP is known, efs-utils resolves the
+	// DNS name of the mount target in the same availability zone ID as the node instead.
+	fsArnValue, hasFsArn := volContext.get(FileSystemArn)
+	if hasFsArn {
+		fsArn, _ := cloud.ParseFileSystemArn(fsArnValue)
+		if fsArn.FileSystemId != fsid {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume context property %q refers to file system %v instead of %v", FileSystemArn, fsArn.FileSystemId, fsid)
+		}
+		if hasVolRegion && fsArn.Region != volRegion {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume context property %q refers to region %v instead of %v", FileSystemArn, fsArn.Region, volRegion)
+		}
+		if fsArn.Region != d.cloud.GetMetadata().GetRegion() && !hasOptionPrefix(mountOptions, "region=") {
+			mountOptions = append(mountOptions, "region="+fsArn.Region)
+		}
+		if !hasOptionPrefix(mountOptions, MountTargetIp+"=") && !hasOption(mountOptions, CrossAccount) {
+			mountOptions = append(mountOptions, CrossAccount)
+		}
+	}
+
+	// Without a mount target IP, look it up in the cache instead of letting efs-utils resolve it
+	// The cache only holds the IPv4 addresses of the mount targets
+	if d.mountTargetCache != nil && family != ipFamilyIPv6 && !hasFsArn && !hasVolRegion && !crossAccountDNSEnabled && !hasOptionPrefix(mountOptions, MountTargetIp+"=") {
+		if ipAddr, ok := d.mountTargetCache.lookup(fsid, d.cloud.GetMetadata().GetAvailabilityZone()); ok {
+			klog.V(4).Infof("NodePublishVolume: using cached mount target IP %s of file system %s", ipAddr, fsid)
+			mountOptions = append(mountOptions, MountTargetIp+"="+ipAddr)
+		}
+	}
+	// Otherwise resolve it with the nameservers of the driver instead of letting efs-utils use those of the node
+	if d.dnsResolver != nil && !hasFsArn && !crossAccountDNSEnabled && !hasOptionPrefix(mountOptions, MountTargetIp+"=") {
+		metadata := d.cloud.GetMetadata()
+		region, az := metadata.GetRegion(), metadata.GetAvailabilityZone()
+		// The availability zones of the node are not those of a replica in another region
+		if hasVolRegion {
+			region, az = volRegion, ""
+		}
+		if ipAddr, ok := d.dnsResolver.resolve(ctx, fsid, region, az, family); ok {
+			klog.V(4).Infof("NodePublishVolume: using resolved mount target IP %s of file system %s", ipAddr, fsid)
+			mountOptions = append(mountOptions, MountTargetIp+"="+ipAddr)
+		}
+	}
+	// efs-utils resolves the IPv4 address of the mount target, so the node resolves the IPv6 one itself
+	if family == ipFamilyIPv6 && !hasFsArn && !crossAccountDNSEnabled && !hasOptionPrefix(mountOptions, MountTargetIp+"=") {
+		region, az := d.cloud.GetMetadata().GetRegion(), d.cloud.GetMetadata().GetAvailabilityZone()
+		if hasVolRegion {
+			region, az = volRegion, ""
+		}
+		ipAddr, ok := systemDNSResolver.resolve(ctx, fsid, region, az, family)
+		if !ok {
+			return nil, status.Errorf(codes.Unavailable, "Could not resolve an IPv6 address of file system %v in region %v", fsid, region)
+		}
+		klog.V(4).Infof("NodePublishVolume: using resolved mount target IP %s of file system %s", ipAddr, fsid)
+		mountOptions = append(mountOptions, MountTargetIp+"="+ipAddr)
+	}
+
 	klog.V(5).Infof("NodePublishVolume: creating dir %s", target)
-	if err := d.mounter.MakeDir(target); err != nil {
-		return nil, status.Errorf(codes.Internal, "Could not create dir %q: %v", target, err)
+	if err := d.makeTargetDir(target); err != nil {
+		return nil, err
 	}
 
-	klog.V(5).Infof("NodePublishVolume: mounting %s at %s with options %v", source, target, mountOptions)
-	if err := d.mounter.Mount(source, target, "efs", mountOptions); err != nil {
+	release, err := d.mountScheduler.acquire(ctx, req.GetVolumeId())
+	if err != nil {
 		os.Remove(target)
-		return nil, status.Errorf(codes.Internal, "Could not mount %q at %q: %v", source, target, err)
+		return nil, status.Errorf(codes.DeadlineExceeded, "Timed out waiting for the turn of volume %s to mount: %v", req.GetVolumeId(), err)
+	}
+	defer release()
+
+	// With a sub path, the volume is mounted in a staging directory shared by its targets, and the sub path
+	// is bind mounted at the target
+	shared := d.sharedMounts
+	var subPath func(mountPath string) (string, error)
+	if p, ok := volContext.get(SubPath); ok {
+		shared = d.subPathStaging
+		subPath = func(mountPath string) (string, error) {
+			return d.resolveSubPath(mountPath, p, volContext.getBool(CreateSubPathIfMissing))
+		}
 	}
-	klog.V(5).Infof("NodePublishVolume: %s was mounted", target)
+	if shared != nil {
+		if volContext.getBool(DisableWatchdog) {
+			klog.V(4).Infof("NodePublishVolume: the watchdog of the shared mount of %s stays enabled", target)
+		}
+		if err := d.publishSharedMount(shared, req.GetVolumeId(), fsid, source, target, mountOptions, subPath); err != nil {
+			os.Remove(target)
+			return nil, err
+		}
+		klog.V(5).Infof("NodePublishVolume: %s was mounted", target)
+		d.countPublishedVolume(req.GetVolumeId(), volContext)
+		d.mountStats.add(req.GetVolumeId(), target)
+		d.nodeState.add(req, filepath.Join(shared.mountDir(req.GetVolumeId(), mountOptions), "mount"))
+		d.publishedOptions.add(req)
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+	if subPath != nil {
+		return nil, status.Error(codes.FailedPrecondition, "Sub paths require the kubelet directory")
+	}
+	mountPath := target
+
+	klog.V(5).Infof("NodePublishVolume: mounting %s at %s with options %v", source, mountPath, mountOptions)
+	mountStart := time.Now()
+	err = d.mounter.Mount(source, mountPath, "efs", mountOptions)
+	d.mountStats.record(req.GetVolumeId(), time.Since(mountStart), err)
+	if err != nil {
+		os.Remove(mountPath)
+		d.mountDiagnostics.record(req.GetVolumeContext(), req.GetVolumeId(), source, mountPath, mountOptions, err)
+		return nil, status.Errorf(codes.Internal, "Could not mount %q at %q: %v", source, mountPath, err)
+	}
+	klog.V(5).Infof("NodePublishVolume: %s was mounted", mountPath)
 
-	//Increment volume Id counter
-	if d.volMetricsOptIn {
-		if value, ok := volumeIdCounter[req.GetVolumeId()]; ok {
-			volumeIdCounter[req.GetVolumeId()] = value + 1
+	if err := d.fsIdentityCheck.verify(fsid, mountPath, mountOptions); err != nil {
+		if unmountErr := d.mounter.Unmount(mountPath); unmountErr != nil {
+			klog.Warningf("Failed to unmount %s after failed identity check: %v", mountPath, unmountErr)
 		} else {
-			volumeIdCounter[req.GetVolumeId()] = 1
+			os.Remove(mountPath)
 		}
+		return nil, status.Errorf(codes.FailedPrecondition, "Could not verify that file system %v is mounted at %q: %v", fsid, mountPath, err)
+	}
+
+	if volContext.getBool(DisableWatchdog) {
+		d.unwatchedMounts.unwatch(target, mountPath)
 	}
 
+	d.countPublishedVolume(req.GetVolumeId(), volContext)
+	d.mountStats.add(req.GetVolumeId(), target)
+	d.nodeState.add(req, mountPath)
+	d.publishedOptions.add(req)
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// countPublishedVolume increments the volume Id counter of the volume metrics
+func (d *Driver) countPublishedVolume(volumeId string, volContext volumeContext) {
+	if d.volMetricsOptIn {
+		volumeIdCounterMu.Lock()
+		defer volumeIdCounterMu.Unlock()
+		if value, ok := volumeIdCounter[volumeId]; ok {
+			volumeIdCounter[volumeId] = value + 1
+		} else {
+			volumeIdCounter[volumeId] = 1
+		}
+		if opts, ok := d.volMetricsOptionsFromContext(volContext); ok {
+			klog.V(4).Infof("Overriding volume metrics options of vol ID: %v with %+v", volumeId, opts)
+			volMetricsOverridesMu.Lock()
+			volMetricsOverrides[volumeId] = opts
+			volMetricsOverridesMu.Unlock()
+		}
+	}
+}
+
+// resolveSubPath returns the directory of the sub path of the volume mounted at the staging path, creating
+// it if missing and createIfMissing is set
+func (d *Driver) resolveSubPath(stagingPath, subPath string, createIfMissing bool) (string, error) {
+	source := filepath.Join(stagingPath, subPath)
+	if createIfMissing {
+		klog.V(5).Infof("NodePublishVolume: creating sub path %s", source)
+		if err := d.mounter.MakeDir(source); err != nil {
+			return "", status.Errorf(codes.Internal, "Could not create sub path %q: %v", subPath, err)
+		}
+	}
+
+	// Symbolic links in the volume must not expose directories of the node
+	resolved, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", status.Errorf(codes.FailedPrecondition, "Sub path %q does not exist in the volume", subPath)
+		}
+		return "", status.Errorf(codes.Internal, "Could not resolve sub path %q: %v", subPath, err)
+	}
+	resolvedStagingPath, err := filepath.EvalSymlinks(stagingPath)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "Could not resolve staging path %q: %v", stagingPath, err)
+	}
+	if rel, err := filepath.Rel(resolvedStagingPath, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", status.Errorf(codes.InvalidArgument, "Sub path %q resolves outside of the volume", subPath)
+	}
+	return resolved, nil
+}
+
 func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	klog.V(4).Infof("NodeUnpublishVolume: called with args %+v", util.SanitizeRequest(*req))
 
@@ -239,32 +471,55 @@ func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublish
 	// reply 0 OK.
 	if refCount == 0 {
 		klog.V(5).Infof("NodeUnpublishVolume: %s target not mounted", target)
+		// A previous call may have failed to unmount the shared mount of the target
+		if err := d.releaseSharedMount(target); err != nil {
+			return nil, err
+		}
+		d.nodeState.remove(target)
+		d.publishedOptions.remove(target)
+		d.unwatchedMounts.release(target)
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
 
 	klog.V(5).Infof("NodeUnpublishVolume: unmounting %s", target)
-	err = d.mounter.Unmount(target)
+	err = d.busyUnmount.unmount(ctx, d.mounter, req.GetVolumeId(), target)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Could not unmount %q: %v", target, err)
 	}
 	klog.V(5).Infof("NodeUnpublishVolume: %s unmounted", target)
+	if err := d.releaseSharedMount(target); err != nil {
+		return nil, err
+	}
+	d.mountStats.remove(req.GetVolumeId(), target)
+	d.nodeState.remove(target)
+	d.publishedOptions.remove(target)
+	d.unwatchedMounts.release(target)
 
 	//TODO: If `du` is running on a volume, unmount waits for it to complete. We should stop `du` on unmount in the future for NodeUnpublish
-	//Decrement Volume ID counter and evict cache if counter is 0.
+	d.uncountPublishedVolume(req.GetVolumeId(), target)
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// uncountPublishedVolume decrements the volume Id counter of the volume metrics and evicts the cache if it is 0
+func (d *Driver) uncountPublishedVolume(volumeId, target string) {
 	if d.volMetricsOptIn {
-		if value, ok := volumeIdCounter[req.GetVolumeId()]; ok {
+		volumeIdCounterMu.Lock()
+		defer volumeIdCounterMu.Unlock()
+		if value, ok := volumeIdCounter[volumeId]; ok {
 			value -= 1
 			if value < 1 {
-				klog.V(4).Infof("Evicting vol ID: %v, vol path : %v from cache", req.VolumeId, target)
-				d.volStatter.removeFromCache(req.VolumeId)
-				delete(volumeIdCounter, req.GetVolumeId())
+				klog.V(4).Infof("Evicting vol ID: %v, vol path : %v from cache", volumeId, target)
+				d.volStatter.removeFromCache(volumeId)
+				delete(volumeIdCounter, volumeId)
+				volMetricsOverridesMu.Lock()
+				delete(volMetricsOverrides, volumeId)
+				volMetricsOverridesMu.Unlock()
 			} else {
-				volumeIdCounter[req.GetVolumeId()] = value
+				volumeIdCounter[volumeId] = value
 			}
 		}
 	}
-
-	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
 func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
@@ -289,7 +544,14 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 		return nil, status.Errorf(codes.Internal, "Failed to invoke stat on volume path %s: %v", target, err)
 	}
 
-	volMetrics, err := d.volStatter.computeVolumeMetrics(volId, target, d.volMetricsRefreshPeriod, d.volMetricsFsRateLimit)
+	opts := d.defaultVolMetricsOptions()
+	volMetricsOverridesMu.RLock()
+	if override, ok := volMetricsOverrides[volId]; ok {
+		opts = override
+	}
+	volMetricsOverridesMu.RUnlock()
+
+	volMetrics, err := d.volStatter.computeVolumeMetrics(volId, target, opts)
 
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Could not get metrics: %v ", err)
@@ -300,8 +562,82 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 	}, nil
 }
 
+// defaultVolMetricsOptions returns the volume metrics options configured on the node
+func (d *Driver) defaultVolMetricsOptions() volMetricsOptions {
+	return volMetricsOptions{
+		refreshPeriod: d.volMetricsRefreshPeriod,
+		fsRateLimit:   d.volMetricsFsRateLimit,
+		jitter:        true,
+	}
+}
+
+// volMetricsOptionsFromContext returns the volume metrics options of the node overridden by
+// the volume attributes, and whether any of them was set.
+func (d *Driver) volMetricsOptionsFromContext(volContext volumeContext) (volMetricsOptions, bool) {
+	opts := d.defaultVolMetricsOptions()
+	overridden := false
+	if _, ok := volContext[VolMetricsRefreshPeriod]; ok {
+		opts.refreshPeriod = volContext.getFloat(VolMetricsRefreshPeriod)
+		overridden = true
+	}
+	if _, ok := volContext[VolMetricsFsRateLimit]; ok {
+		opts.fsRateLimit = volContext.getInt(VolMetricsFsRateLimit)
+		overridden = true
+	}
+	if _, ok := volContext[VolMetricsJitter]; ok {
+		opts.jitter = volContext.getBool(VolMetricsJitter)
+		overridden = true
+	}
+	return opts, overridden
+}
+
+// NodeExpandVolume has nothing to expand, EFS file systems being elastic, but completes the resize of the
+// volume on the node so that the resize of its claim completes. The cached stats of the volume are refreshed,
+// so that the next NodeGetVolumeStats does not wait for the refresh period to report them.
 func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	klog.V(4).Infof("NodeExpandVolume: called with args %+v", util.SanitizeRequest(*req))
+
+	volId := req.GetVolumeId()
+	if volId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
+	}
+	target := req.GetVolumePath()
+	if target == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume Path not provided")
+	}
+	if volCap := req.GetVolumeCapability(); volCap != nil {
+		if err := d.isValidVolumeCapabilities([]*csi.VolumeCapability{volCap}); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume capability not supported: %s", err)
+		}
+	}
+	if _, _, _, err := parseVolumeId(volId); err != nil {
+		return nil, status.Errorf(codes.NotFound, "Volume not found, err: %v", err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "Volume Path %s does not exist", target)
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to invoke stat on volume path %s: %v", target, err)
+	}
+
+	if d.volMetricsOptIn {
+		opts := d.defaultVolMetricsOptions()
+		volMetricsOverridesMu.RLock()
+		if override, ok := volMetricsOverrides[volId]; ok {
+			opts = override
+		}
+		volMetricsOverridesMu.RUnlock()
+		// A refresh period of 0 recomputes the cached stats right away
+		opts.refreshPeriod = 0
+		opts.jitter = false
+		if _, err := d.volStatter.computeVolumeMetrics(volId, target, opts); err != nil {
+			klog.Warningf("NodeExpandVolume: could not refresh the metrics of volume %v: %v", volId, err)
+		}
+	}
+
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
+	}, nil
 }
 
 func (d *Driver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
@@ -401,6 +737,9 @@ func (d *Driver) validateFStype(volCaps []*csi.VolumeCapability) error {
 //   - The `{mountPath}`, if specified, is not required to be absolute.
 //   - The `{accessPointID}` is expected to be of the form `fsap-...`.
 //
+// It also accepts the v2 volume handles, `efs://{fileSystemID}?ap={accessPointID}&path={mountPath}`,
+// without their region, endpoint and role, which parseVolumeHandle returns.
+//
 // parseVolumeId returns the parsed values, of which `subpath` and `apid` may be empty; and an
 // error, which will be a `status.Error` with `codes.InvalidArgument`, or `nil` if the `volumeId`
 // was parsed successfully.
@@ -408,6 +747,10 @@ func (d *Driver) validateFStype(volCaps []*csi.VolumeCapability) error {
 // - https://github.com/kubernetes-sigs/aws-efs-csi-driver/issues/100
 // - https://github.com/kubernetes-sigs/aws-efs-csi-driver/issues/167
 func parseVolumeId(volumeId string) (fsid, subpath, apid string, err error) {
+	if strings.HasPrefix(volumeId, volumeHandleV2Prefix) {
+		h, err := parseVolumeHandleV2(volumeId)
+		return h.fileSystemId, h.subpath, h.accessPointId, err
+	}
 	// Might as well do this up front, since the FSID is required and first in the string
 	if !isValidFileSystemId(volumeId) {
 		err = status.Errorf(codes.InvalidArgument, "volume ID '%s' is invalid: Expected a file system ID of the form 'fs-...'", volumeId)
@@ -440,6 +783,29 @@ func parseVolumeId(volumeId string) (fsid, subpath, apid string, err error) {
 	return
 }
 
+// makeTargetDir creates the target directory of NodePublishVolume. On a read-only file system, e.g. the
+// root of an immutable OS, the kubelet or the OS must have created it beforehand.
+func (d *Driver) makeTargetDir(target string) error {
+	err := d.mounter.MakeDir(target)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EROFS) {
+		return status.Errorf(codes.Internal, "Could not create dir %q: %v", target, err)
+	}
+	if info, statErr := os.Stat(target); statErr == nil && info.IsDir() {
+		klog.V(4).Infof("NodePublishVolume: using dir %s created beforehand on a read-only file system", target)
+		return nil
+	}
+	return status.Errorf(codes.FailedPrecondition, "Could not create dir %q on a read-only file system, it must be created beforehand or the kubelet root directory %q must be on a writable file system, set --kubelet-root-dir to the --root-dir of the kubelet: %v", target, d.kubeletDir, err)
+}
+
+// isKubeletPodPath tells whether the path is in the pods directory of the kubelet root directory
+func isKubeletPodPath(kubeletDir, p string) bool {
+	podsDir := filepath.Join(kubeletDir, "pods")
+	return strings.HasPrefix(filepath.Clean(p), podsDir+string(filepath.Separator))
+}
+
 // Check and avoid adding duplicate mount options
 func hasOption(options []string, opt string) bool {
 	for _, o := range options {
@@ -450,6 +816,15 @@ func hasOption(options []string, opt string) bool {
 	return false
 }
 
+func hasOptionPrefix(options []string, prefix string) bool {
+	for _, o := range options {
+		if strings.HasPrefix(o, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func isValidFileSystemId(filesystemId string) bool {
 	return strings.HasPrefix(filesystemId, "fs-")
 }
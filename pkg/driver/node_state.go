@@ -0,0 +1,242 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/klog/v2"
+)
+
+// nodeStateVersion is the version of the format of the node state file
+const nodeStateVersion = 1
+
+// publishedVolume is a target published by NodePublishVolume, as recorded in the node state file
+type publishedVolume struct {
+	VolumeId string `json:"volumeId"`
+	// RequestHash identifies the publish request, so that the same request is recognized after a restart
+	RequestHash   string            `json:"requestHash"`
+	VolumeContext map[string]string `json:"volumeContext,omitempty"`
+	// MountFlags are the mount options of the publish, missing from the state of older node plugins
+	MountFlags []string `json:"mountFlags"`
+	// ProxyPort is the port of the efs-proxy or stunnel process of a TLS mount, found in its efs-utils state
+	ProxyPort int `json:"proxyPort,omitempty"`
+}
+
+type nodeStateFile struct {
+	Version int                         `json:"version"`
+	Volumes map[string]*publishedVolume `json:"volumes"`
+}
+
+// nodeState persists the targets published on the node to a file, so that the node plugin replacing another
+// one, e.g. during an upgrade of the DaemonSet, rebuilds its tracking of the published volumes instead of
+// starting blind: the republish of an already published target succeeds without mounting again, and the
+// volume metrics of the published volumes are restored. The file is rewritten on every publish and unpublish.
+// A nil nodeState is valid and records nothing.
+type nodeState struct {
+	path     string
+	stateDir string
+
+	mu      sync.Mutex
+	volumes map[string]*publishedVolume
+}
+
+// newNodeState returns the node state persisted at the path, or nil if the path is empty
+func newNodeState(path string) *nodeState {
+	if path == "" {
+		return nil
+	}
+	return &nodeState{path: path, stateDir: efsUtilsStateDir, volumes: map[string]*publishedVolume{}}
+}
+
+// publishRequestHash returns the hash of the parts of the publish request set by the kubelet
+func publishRequestHash(req *csi.NodePublishVolumeRequest) string {
+	flags := append([]string{}, req.GetVolumeCapability().GetMount().GetMountFlags()...)
+	sort.Strings(flags)
+	attributes := []string{}
+	for k, v := range req.GetVolumeContext() {
+		attributes = append(attributes, k+"="+v)
+	}
+	sort.Strings(attributes)
+	parts := []string{req.GetVolumeId(), strconv.FormatBool(req.GetReadonly()), strings.Join(flags, ","), strings.Join(attributes, "\n")}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the volume published at the target
+func (s *nodeState) lookup(target string) (*publishedVolume, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	volume, ok := s.volumes[target]
+	return volume, ok
+}
+
+// add records the volume of the request published at the target, mounted at the mount path
+func (s *nodeState) add(req *csi.NodePublishVolumeRequest, mountPath string) {
+	if s == nil {
+		return
+	}
+	volume := &publishedVolume{
+		VolumeId:      req.GetVolumeId(),
+		RequestHash:   publishRequestHash(req),
+		VolumeContext: req.GetVolumeContext(),
+		MountFlags:    sortedMountFlags(req.GetVolumeCapability().GetMount().GetMountFlags()),
+		ProxyPort:     s.proxyPort(mountPath),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.volumes[req.GetTargetPath()] = volume
+	s.save()
+}
+
+// remove forgets the volume published at the target
+func (s *nodeState) remove(target string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.volumes[target]; !ok {
+		return
+	}
+	delete(s.volumes, target)
+	s.save()
+}
+
+// restore loads the state file left by the previous node plugin, forgetting the targets no longer mounted,
+// and returns the volumes still published by target
+func (s *nodeState) restore(mounter Mounter) (map[string]*publishedVolume, error) {
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := &nodeStateFile{}
+	if err := json.Unmarshal(content, file); err != nil {
+		return nil, fmt.Errorf("failed to parse node state %s: %v", s.path, err)
+	}
+	if file.Version != nodeStateVersion {
+		return nil, fmt.Errorf("node state %s has unsupported version %d", s.path, file.Version)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for target, volume := range file.Volumes {
+		notMnt, err := mounter.IsLikelyNotMountPoint(target)
+		if err != nil || notMnt {
+			klog.V(4).Infof("Forgetting target %s of volume %s, no longer mounted", target, volume.VolumeId)
+			continue
+		}
+		if volume.ProxyPort > 0 && !s.hasProxyState(volume.ProxyPort) {
+			klog.Warningf("The efs-utils state of the proxy on port %d of target %s of volume %s is gone, the watchdog will not restart it", volume.ProxyPort, target, volume.VolumeId)
+		}
+		s.volumes[target] = volume
+	}
+	s.save()
+	restored := map[string]*publishedVolume{}
+	for target, volume := range s.volumes {
+		restored[target] = volume
+	}
+	return restored, nil
+}
+
+// save writes the state file, replacing the previous one atomically. It must be called with mu held.
+func (s *nodeState) save() {
+	content, err := json.Marshal(&nodeStateFile{Version: nodeStateVersion, Volumes: s.volumes})
+	if err != nil {
+		klog.Warningf("Failed to encode node state: %v", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		klog.Warningf("Failed to write node state %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		klog.Warningf("Failed to replace node state %s: %v", s.path, err)
+	}
+}
+
+// proxyPort returns the port of the proxy of the mount at the path from its efs-utils state, or 0 if the
+// mount has no proxy
+func (s *nodeState) proxyPort(mountPath string) int {
+	entries, err := os.ReadDir(s.stateDir)
+	if err != nil {
+		return 0
+	}
+	mountPoint := strings.TrimLeft(strings.ReplaceAll(filepath.Clean(mountPath), "/", "."), ".")
+	for _, entry := range entries {
+		match := efsUtilsStateFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil || match[2] != mountPoint {
+			continue
+		}
+		port, _ := strconv.Atoi(match[3])
+		return port
+	}
+	return 0
+}
+
+// hasProxyState returns whether an efs-utils state of a mount has the proxy port
+func (s *nodeState) hasProxyState(port int) bool {
+	entries, err := os.ReadDir(s.stateDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		match := efsUtilsStateFileRegex.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() && match != nil && match[3] == strconv.Itoa(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreNodeState rebuilds the tracking of the volumes still published by the previous node plugin
+func (d *Driver) restoreNodeState() error {
+	restored, err := d.nodeState.restore(d.mounter)
+	if err != nil {
+		return err
+	}
+	for target, volume := range restored {
+		volContext, err := parseVolumeContext(nodePublishVolumeContext, volume.VolumeContext)
+		if err != nil {
+			klog.Warningf("Ignoring the volume context of target %s of volume %s: %v", target, volume.VolumeId, err)
+		}
+		d.countPublishedVolume(volume.VolumeId, volContext)
+		d.mountStats.add(volume.VolumeId, target)
+		if volume.MountFlags != nil {
+			d.publishedOptions.track(target, volume.MountFlags, volume.VolumeContext)
+		}
+	}
+	klog.Infof("Restored %d published targets from node state %s", len(restored), d.nodeState.path)
+	return nil
+}
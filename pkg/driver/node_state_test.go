@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNodeStateAcrossRestarts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "node-state.json")
+	target := filepath.Join(dir, "pods", "pod", "volume")
+	efsUtilsState := t.TempDir()
+	proxyState := volumeId + "." + strings.TrimLeft(strings.ReplaceAll(target, "/", "."), ".") + ".20049"
+	if err := os.WriteFile(filepath.Join(efsUtilsState, proxyState), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(volumeIdCounter, volumeId)
+
+	newDriver := func() (*Driver, func(readOnly bool) error) {
+		mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), true)
+		mockMounter.EXPECT().MakeDir(gomock.Any()).Return(nil).AnyTimes()
+		mockMounter.EXPECT().Mount(volumeId+":/", target, "efs", gomock.Any()).Return(nil).MaxTimes(1)
+		mockMounter.EXPECT().IsLikelyNotMountPoint(target).Return(false, nil).AnyTimes()
+		mockMounter.EXPECT().IsLikelyNotMountPoint("/stale").Return(true, nil).AnyTimes()
+		driver.nodeState = newNodeState(statePath)
+		driver.nodeState.stateDir = efsUtilsState
+		return driver, func(readOnly bool) error {
+			_, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId: volumeId,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+				},
+				VolumeContext: map[string]string{"encryptInTransit": "true"},
+				TargetPath:    target,
+				Readonly:      readOnly,
+			})
+			return err
+		}
+	}
+
+	driver, publish := newDriver()
+	if err := publish(false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if published, ok := driver.nodeState.lookup(target); !ok || published.VolumeId != volumeId || published.ProxyPort != 20049 {
+		t.Fatalf("Expected target %s to be recorded with proxy port 20049, got %+v", target, published)
+	}
+
+	// The state of a target unpublished while the driver was down is forgotten
+	content, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &nodeStateFile{}
+	if err := json.Unmarshal(content, file); err != nil {
+		t.Fatal(err)
+	}
+	file.Volumes["/stale"] = &publishedVolume{VolumeId: "fs-stale"}
+	content, _ = json.Marshal(file)
+	if err := os.WriteFile(statePath, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replacing driver recognizes the published target without mounting it again
+	delete(volumeIdCounter, volumeId)
+	driver, publish = newDriver()
+	if err := driver.restoreNodeState(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := driver.nodeState.lookup("/stale"); ok {
+		t.Errorf("Expected the unmounted target to be forgotten")
+	}
+	if volumeIdCounter[volumeId] != 1 {
+		t.Errorf("Expected the volume metrics of the target to be restored, got counter %d", volumeIdCounter[volumeId])
+	}
+	if err := publish(false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := publish(true); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("Expected AlreadyExists for another request, got %v", err)
+	}
+}
+
+func TestNodeStateRestoreMissingFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	_, driver, _ := setup(mockCtrl, NewVolStatter(), false)
+	driver.nodeState = newNodeState(filepath.Join(t.TempDir(), "node-state.json"))
+	if err := driver.restoreNodeState(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if newNodeState("") != nil {
+		t.Errorf("Expected no node state without a file")
+	}
+}
@@ -21,14 +21,18 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
+	cloudmocks "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
 	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -99,13 +103,14 @@ func TestNodePublishVolume(t *testing.T) {
 	)
 
 	testCases := []struct {
-		name            string
-		req             *csi.NodePublishVolumeRequest
-		expectMakeDir   bool
-		mountArgs       []interface{}
-		mountSuccess    bool
-		volMetricsOptIn bool
-		expectError     errtyp
+		name              string
+		req               *csi.NodePublishVolumeRequest
+		expectMakeDir     bool
+		mountArgs         []interface{}
+		mountSuccess      bool
+		volMetricsOptIn   bool
+		accessPointSource bool
+		expectError       errtyp
 	}{
 		{
 			name: "success: normal",
@@ -282,6 +287,39 @@ func TestNodePublishVolume(t *testing.T) {
 			mountArgs:     []interface{}{volumeId + ":/", targetPath, "efs", []string{"accesspoint=" + accessPointID, "tls"}},
 			mountSuccess:  true,
 		},
+		{
+			name: "success: access point in the mount source",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId + ":/a/b:" + accessPointID,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+			},
+			accessPointSource: true,
+			expectMakeDir:     true,
+			mountArgs:         []interface{}{accessPointID + "." + volumeId + ":/a/b", targetPath, "efs", []string{"tls"}},
+			mountSuccess:      true,
+		},
+		{
+			name: "success: same access point in mount options and the mount source",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId: volumeId + "::" + accessPointID,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							MountFlags: []string{"accesspoint=" + accessPointID, "noresvport"},
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+					},
+				},
+				TargetPath: targetPath,
+			},
+			accessPointSource: true,
+			expectMakeDir:     true,
+			mountArgs:         []interface{}{accessPointID + "." + volumeId + ":/", targetPath, "efs", []string{"tls", "noresvport"}},
+			mountSuccess:      true,
+		},
 		{
 			name: "success: normal with encryptInTransit true volume context",
 			req: &csi.NodePublishVolumeRequest{
@@ -343,6 +381,18 @@ func TestNodePublishVolume(t *testing.T) {
 			mountArgs:     []interface{}{volumeId + ":/", targetPath, "efs", []string{"mounttargetip=127.0.0.1", "tls"}},
 			mountSuccess:  true,
 		},
+		{
+			name: "success: crossaccount and mounttargetip volume context",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"crossaccount": "true", "mounttargetip": "127.0.0.1"},
+			},
+			expectMakeDir: true,
+			mountArgs:     []interface{}{volumeId + ":/", targetPath, "efs", []string{"mounttargetip=127.0.0.1", "tls", "crossaccount"}},
+			mountSuccess:  true,
+		},
 		{
 			name: "success: supported volume fstype capability",
 			req: &csi.NodePublishVolumeRequest{
@@ -596,6 +646,7 @@ func TestNodePublishVolume(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
 			defer mockCtrl.Finish()
 			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), tc.volMetricsOptIn)
+			driver.accessPointSource = tc.accessPointSource
 
 			if tc.expectMakeDir {
 				var err error
@@ -619,6 +670,456 @@ func TestNodePublishVolume(t *testing.T) {
 	}
 }
 
+func TestNodePublishVolumeSubPath(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		volumeContext   map[string]string
+		readOnly        bool
+		expectBindMount string
+		expectBindOpts  []string
+		invalidContext  bool
+		expectError     errtyp
+	}{
+		{
+			name:            "success: existing sub path",
+			volumeContext:   map[string]string{"subPath": "data"},
+			expectBindMount: "data",
+			expectBindOpts:  []string{"bind"},
+		},
+		{
+			name:            "success: read only sub path",
+			volumeContext:   map[string]string{"subPath": "data/nested"},
+			readOnly:        true,
+			expectBindMount: "data/nested",
+			expectBindOpts:  []string{"bind", "ro"},
+		},
+		{
+			name:            "success: missing sub path is created",
+			volumeContext:   map[string]string{"subPath": "new", "createSubPathIfMissing": "true"},
+			expectBindMount: "new",
+			expectBindOpts:  []string{"bind"},
+		},
+		{
+			name:          "fail: missing sub path",
+			volumeContext: map[string]string{"subPath": "new"},
+			expectError: errtyp{
+				code:    "FailedPrecondition",
+				message: `Sub path "new" does not exist in the volume`,
+			},
+		},
+		{
+			name:          "fail: sub path resolves outside of the volume",
+			volumeContext: map[string]string{"subPath": "escape"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Sub path "escape" resolves outside of the volume`,
+			},
+		},
+		{
+			name:           "fail: sub path escapes the volume",
+			volumeContext:  map[string]string{"subPath": "../data"},
+			invalidContext: true,
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "subPath" must be a relative path within the volume`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			driver.subPathStaging = newSubPathStaging(t.TempDir())
+
+			dir, err := filepath.EvalSymlinks(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := filepath.Join(dir, "mount")
+			stagingPath := filepath.Join(driver.subPathStaging.mountDir(volumeId, []string{"tls"}), "mount")
+			makeDir := func(path string) error {
+				return os.MkdirAll(path, 0755)
+			}
+
+			if !tc.invalidContext {
+				mockMounter.EXPECT().MakeDir(target).DoAndReturn(makeDir)
+				mockMounter.EXPECT().MakeDir(stagingPath).DoAndReturn(makeDir)
+				// Simulate the content of the volume, staged read-write for the targets of every mode
+				mockMounter.EXPECT().Mount(volumeId+":/", stagingPath, "efs", []string{"tls"}).DoAndReturn(
+					func(_, _, _ string, _ []string) error {
+						if err := os.MkdirAll(filepath.Join(stagingPath, "data", "nested"), 0755); err != nil {
+							return err
+						}
+						return os.Symlink(dir, filepath.Join(stagingPath, "escape"))
+					})
+				if tc.volumeContext["createSubPathIfMissing"] == "true" {
+					mockMounter.EXPECT().MakeDir(filepath.Join(stagingPath, tc.volumeContext["subPath"])).DoAndReturn(makeDir)
+				}
+				if tc.expectBindMount != "" {
+					// The staging mount is kept for the target
+					mockMounter.EXPECT().Mount(filepath.Join(stagingPath, tc.expectBindMount), target, "", tc.expectBindOpts).Return(nil)
+				} else {
+					mockMounter.EXPECT().Unmount(stagingPath).Return(nil)
+				}
+			}
+
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       target,
+				VolumeContext:    tc.volumeContext,
+				Readonly:         tc.readOnly,
+			})
+			testResult(t, "NodePublishVolume", ret, err, tc.expectError)
+		})
+	}
+}
+
+func TestNodePublishVolumeReadOnlyFileSystem(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+	erofs := &os.PathError{Op: "mkdir", Path: "/", Err: syscall.EROFS}
+
+	testCases := []struct {
+		name          string
+		targetExists  bool
+		volumeContext map[string]string
+		expectError   errtyp
+	}{
+		{
+			name:         "success: target created beforehand",
+			targetExists: true,
+		},
+		{
+			name:          "success: sub path staged in the plugin directory",
+			targetExists:  true,
+			volumeContext: map[string]string{"subPath": "data"},
+		},
+		{
+			name: "fail: target not created beforehand",
+			expectError: errtyp{
+				code:    "FailedPrecondition",
+				message: "Could not create dir",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			driver.kubeletDir = t.TempDir()
+			driver.subPathStaging = newSubPathStaging(driver.kubeletDir)
+
+			dir, err := filepath.EvalSymlinks(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := filepath.Join(dir, "mount")
+			if tc.targetExists {
+				if err := os.Mkdir(target, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mockMounter.EXPECT().MakeDir(target).Return(erofs)
+
+			if tc.expectError.code == "" && tc.volumeContext == nil {
+				mockMounter.EXPECT().Mount(volumeId+":/", target, "efs", []string{"tls"}).Return(nil)
+			}
+			if tc.expectError.code == "" && tc.volumeContext != nil {
+				stagingPath := filepath.Join(driver.subPathStaging.mountDir(volumeId, []string{"tls"}), "mount")
+				mockMounter.EXPECT().MakeDir(stagingPath).DoAndReturn(func(path string) error {
+					return os.MkdirAll(path, 0755)
+				})
+				mockMounter.EXPECT().Mount(volumeId+":/", stagingPath, "efs", []string{"tls"}).DoAndReturn(
+					func(_, _, _ string, _ []string) error {
+						return os.MkdirAll(filepath.Join(stagingPath, "data"), 0755)
+					})
+				mockMounter.EXPECT().Mount(filepath.Join(stagingPath, "data"), target, "", []string{"bind"}).Return(nil)
+			}
+
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       target,
+				VolumeContext:    tc.volumeContext,
+			})
+			if tc.expectError.code != "" {
+				if status.Code(err).String() != tc.expectError.code || !strings.Contains(err.Error(), tc.expectError.message) {
+					t.Fatalf("Expected %s error %q, got: %v", tc.expectError.code, tc.expectError.message, err)
+				}
+				return
+			}
+			testResult(t, "NodePublishVolume", ret, err, tc.expectError)
+		})
+	}
+}
+
+func TestNodePublishVolumeFileSystemArn(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		volumeContext map[string]string
+		expectOpts    []string
+		expectError   errtyp
+	}{
+		{
+			name:          "success: file system of another account",
+			volumeContext: map[string]string{"fileSystemArn": "arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/" + volumeId},
+			expectOpts:    []string{"tls", "crossaccount"},
+		},
+		{
+			name:          "success: file system in another region",
+			volumeContext: map[string]string{"fileSystemArn": "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/" + volumeId},
+			expectOpts:    []string{"tls", "region=us-west-2", "crossaccount"},
+		},
+		{
+			name: "success: mount target IP is used instead of DNS",
+			volumeContext: map[string]string{
+				"fileSystemArn": "arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/" + volumeId,
+				"mounttargetip": "10.0.0.1",
+			},
+			expectOpts: []string{"mounttargetip=10.0.0.1", "tls"},
+		},
+		{
+			name:          "fail: ARN of another file system",
+			volumeContext: map[string]string{"fileSystemArn": "arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/fs-other"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "filesystemarn" refers to file system fs-other instead of fs-abc123`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			mockCloud := mocks.NewMockCloud(mockCtrl)
+			mockMetadata := cloudmocks.NewMockMetadataService(mockCtrl)
+			driver.cloud = mockCloud
+
+			if tc.expectError.code == "" {
+				mockCloud.EXPECT().GetMetadata().Return(mockMetadata)
+				mockMetadata.EXPECT().GetRegion().Return("us-east-1")
+				mockMounter.EXPECT().MakeDir(targetPath).Return(nil)
+				mockMounter.EXPECT().Mount(volumeId+":/", targetPath, "efs", tc.expectOpts).Return(nil)
+			}
+
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+				VolumeContext:    tc.volumeContext,
+			})
+			testResult(t, "NodePublishVolume", ret, err, tc.expectError)
+		})
+	}
+}
+
+func TestNodePublishVolumeRegion(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		volumeContext map[string]string
+		expectOpts    []string
+		expectError   errtyp
+	}{
+		{
+			name:          "success: replica in another region",
+			volumeContext: map[string]string{"region": "eu-west-1"},
+			expectOpts:    []string{"tls", "region=eu-west-1"},
+		},
+		{
+			name:          "success: replica with a DNS name suffix",
+			volumeContext: map[string]string{"region": "eu-west-1", "dnsNameSuffix": "example.com"},
+			expectOpts:    []string{"tls", "region=eu-west-1", "mounttargetip=10.0.0.2"},
+		},
+		{
+			name:          "success: mount target IP is used instead of the DNS name suffix",
+			volumeContext: map[string]string{"region": "eu-west-1", "dnsNameSuffix": "example.com", "mounttargetip": "10.0.0.1"},
+			expectOpts:    []string{"mounttargetip=10.0.0.1", "tls", "region=eu-west-1"},
+		},
+		{
+			name:          "fail: DNS name suffix not resolved",
+			volumeContext: map[string]string{"region": "eu-west-1", "dnsNameSuffix": "example.org"},
+			expectError: errtyp{
+				code:    "Unavailable",
+				message: "Could not resolve file system fs-abc123 in region eu-west-1 with DNS name suffix example.org",
+			},
+		},
+		{
+			name:          "fail: DNS name suffix with cross account DNS",
+			volumeContext: map[string]string{"dnsNameSuffix": "example.com", "crossaccount": "true"},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "dnsnamesuffix" conflicts with "crossaccount"`,
+			},
+		},
+		{
+			name: "fail: region of the file system ARN",
+			volumeContext: map[string]string{
+				"region":        "eu-west-1",
+				"fileSystemArn": "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/" + volumeId,
+			},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: `Volume context property "filesystemarn" refers to region us-west-2 instead of eu-west-1`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			mockCloud := mocks.NewMockCloud(mockCtrl)
+			mockMetadata := cloudmocks.NewMockMetadataService(mockCtrl)
+			driver.cloud = mockCloud
+			driver.dnsResolver = &dnsResolver{
+				lookupHost: func(_ context.Context, host string) ([]string, error) {
+					if host == volumeId+".efs.eu-west-1.example.com" {
+						return []string{"10.0.0.2"}, nil
+					}
+					return nil, fmt.Errorf("no such host %s", host)
+				},
+			}
+			mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+			mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+			mockMetadata.EXPECT().GetAvailabilityZone().Return("us-east-1a").AnyTimes()
+
+			if tc.expectError.code == "" {
+				mockMounter.EXPECT().MakeDir(targetPath).Return(nil)
+				mockMounter.EXPECT().Mount(volumeId+":/", targetPath, "efs", tc.expectOpts).Return(nil)
+			}
+
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+				VolumeContext:    tc.volumeContext,
+			})
+			testResult(t, "NodePublishVolume", ret, err, tc.expectError)
+		})
+	}
+}
+
+func TestNodePublishVolumeFileSystemIdentity(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		sentinel    string
+		expectError errtyp
+	}{
+		{
+			name:     "success: sentinel of the file system",
+			sentinel: volumeId,
+		},
+		{
+			name:     "fail: sentinel of another file system",
+			sentinel: "fs-other",
+			expectError: errtyp{
+				code:    "FailedPrecondition",
+				message: `Could not verify that file system fs-abc123 is mounted at "%s": sentinel file .efs-csi-file-system-id contains file system ID "fs-other"`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			driver.fsIdentityCheck = &fileSystemIdentityCheck{mode: FileSystemIdentityCheckSentinel}
+
+			// The sentinel file is written in the target path as if the file system was mounted there
+			target := filepath.Join(t.TempDir(), "mount")
+			mockMounter.EXPECT().MakeDir(target).Return(os.Mkdir(target, 0755))
+			mockMounter.EXPECT().Mount(volumeId+":/", target, "efs", gomock.Any()).DoAndReturn(
+				func(source, target, fstype string, options []string) error {
+					return os.WriteFile(filepath.Join(target, FileSystemIdSentinelFile), []byte(tc.sentinel), 0644)
+				})
+			if tc.expectError.code != "" {
+				mockMounter.EXPECT().Unmount(target).Return(nil)
+				tc.expectError.message = fmt.Sprintf(tc.expectError.message, target)
+			}
+
+			ret, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       target,
+			})
+			testResult(t, "NodePublishVolume", ret, err, tc.expectError)
+		})
+	}
+}
+
+func TestIsKubeletPodPath(t *testing.T) {
+	testCases := []struct {
+		name       string
+		kubeletDir string
+		path       string
+		expected   bool
+	}{
+		{name: "default root dir", kubeletDir: "/var/lib/kubelet", path: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount", expected: true},
+		{name: "custom root dir", kubeletDir: "/data/kubelet/", path: "/data/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount", expected: true},
+		{name: "default path with custom root dir", kubeletDir: "/data/kubelet", path: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount"},
+		{name: "sibling of the pods directory", kubeletDir: "/var/lib/kubelet", path: "/var/lib/kubelet/podsbackup/uid"},
+		{name: "escaping the pods directory", kubeletDir: "/var/lib/kubelet", path: "/var/lib/kubelet/pods/../plugins/efs"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := isKubeletPodPath(tc.kubeletDir, tc.path); actual != tc.expected {
+				t.Fatalf("Expected %v for %s in %s, got %v", tc.expected, tc.path, tc.kubeletDir, actual)
+			}
+		})
+	}
+}
+
 func TestNodeUnpublishVolume(t *testing.T) {
 	var metrics = &volMetrics{
 		volPath:   targetPath,
@@ -875,6 +1376,139 @@ func TestNodeGetVolumeStats(t *testing.T) {
 	os.RemoveAll(validPath)
 }
 
+// refreshRecordingVolStatter records the options of the volume metrics computations
+type refreshRecordingVolStatter struct {
+	VolStatterImpl
+	computed []volMetricsOptions
+}
+
+func (v *refreshRecordingVolStatter) computeVolumeMetrics(volId, volPath string, opts volMetricsOptions) (*volMetrics, error) {
+	v.computed = append(v.computed, opts)
+	return &volMetrics{volPath: volPath}, nil
+}
+
+func TestNodeExpandVolume(t *testing.T) {
+	validPath := t.TempDir()
+	testCases := []struct {
+		name          string
+		req           *csi.NodeExpandVolumeRequest
+		expectError   errtyp
+		expectRefresh bool
+	}{
+		{
+			name: "Success: stats refreshed",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:      volumeId,
+				VolumePath:    validPath,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 10 * 1024 * 1024 * 1024},
+			},
+			expectRefresh: true,
+		},
+		{
+			name: "Fail: Volume ID not provided",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumePath: validPath,
+			},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: "Volume ID not provided",
+			},
+		},
+		{
+			name: "Fail: Volume Path not provided",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId: volumeId,
+			},
+			expectError: errtyp{
+				code:    "InvalidArgument",
+				message: "Volume Path not provided",
+			},
+		},
+		{
+			name: "Fail: Path does not exist",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   volumeId,
+				VolumePath: "/path/does/not/exist",
+			},
+			expectError: errtyp{
+				code:    "NotFound",
+				message: "Volume Path /path/does/not/exist does not exist",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			volStatter := &refreshRecordingVolStatter{}
+			_, driver, ctx := setup(mockCtrl, volStatter, true)
+			driver.volMetricsRefreshPeriod = 240
+
+			ret, err := driver.NodeExpandVolume(ctx, tc.req)
+			testResult(t, "NodeExpandVolume", ret, err, tc.expectError)
+			if tc.expectError.code != "" {
+				return
+			}
+			if ret.CapacityBytes != tc.req.GetCapacityRange().GetRequiredBytes() {
+				t.Fatalf("Expected capacity %d, got %d", tc.req.GetCapacityRange().GetRequiredBytes(), ret.CapacityBytes)
+			}
+			if tc.expectRefresh && (len(volStatter.computed) != 1 || volStatter.computed[0].refreshPeriod != 0) {
+				t.Fatalf("Expected the stats to be refreshed right away, got %+v", volStatter.computed)
+			}
+		})
+	}
+}
+
+func TestNodeVolMetricsOverrides(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), true)
+	driver.volMetricsRefreshPeriod = 240
+	driver.volMetricsFsRateLimit = 5
+	// The volume may still be counted as published by other tests
+	delete(volumeIdCounter, volumeId)
+
+	mockMounter.EXPECT().MakeDir(targetPath).Return(nil)
+	mockMounter.EXPECT().Mount(volumeId+":/", targetPath, "efs", []string{"tls"}).Return(nil)
+	_, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		VolumeId: volumeId,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		},
+		TargetPath: targetPath,
+		VolumeContext: map[string]string{
+			"volMetricsRefreshPeriod": "1",
+			"volMetricsJitter":        "false",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NodePublishVolume failed: %v", err)
+	}
+
+	expected := volMetricsOptions{refreshPeriod: 1, fsRateLimit: 5, jitter: false}
+	if opts := volMetricsOverrides[volumeId]; opts != expected {
+		t.Fatalf("Expected volume metrics options %+v, got %+v", expected, opts)
+	}
+
+	mockMounter.EXPECT().GetDeviceName(targetPath).Return("", 1, nil)
+	mockMounter.EXPECT().Unmount(targetPath).Return(nil)
+	_, err = driver.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   volumeId,
+		TargetPath: targetPath,
+	})
+	if err != nil {
+		t.Fatalf("NodeUnpublishVolume failed: %v", err)
+	}
+	if _, ok := volMetricsOverrides[volumeId]; ok {
+		t.Fatalf("Expected volume metrics options of %s to be removed on unpublish", volumeId)
+	}
+}
+
 func testResponse(t *testing.T, expected, actual *csi.NodeGetVolumeStatsResponse) {
 	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("Expected: %v, Actual: %v", expected, actual)
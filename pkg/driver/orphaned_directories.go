@@ -0,0 +1,312 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	OrphanedDirectoriesEventReason = "OrphanedDirectories"
+
+	// orphanedDirectoriesEventLimit is the number of directories listed in the events and logs
+	orphanedDirectoriesEventLimit = 20
+	// orphanedDirectoryMinAge is how long a directory must be left unmodified before it is reported, so that
+	// the root directory of an access point created after the access points were listed is not reported
+	orphanedDirectoryMinAge = time.Hour
+)
+
+// orphanedDirectory is a directory of a base path of the storage classes of a file system that holds the root
+// directory of no persistent volume. AccessPoints are the access points still rooted in it, whose persistent
+// volumes were deleted, e.g. after being released with the Retain reclaim policy.
+type orphanedDirectory struct {
+	Path         string
+	AccessPoints []string
+}
+
+// orphanedDirectoryReporter mounts the file systems of the efs-ap storage classes of the driver once per interval
+// and reports the directories of their base paths that hold the root directory of no persistent volume, left by
+// the volumes deleted without delete-access-point-root-dir or released with the Retain reclaim policy, so that
+// operators can reclaim their space. With deleteOrphans, the directories in which no access point is rooted are
+// deleted.
+type orphanedDirectoryReporter struct {
+	interval      time.Duration
+	deleteOrphans bool
+	k8sClient     cloud.KubernetesAPIClient
+}
+
+// newOrphanedDirectoryReporter returns the reporter polling once per interval, or nil if the interval is 0
+func newOrphanedDirectoryReporter(interval time.Duration, deleteOrphans bool, k8sClient cloud.KubernetesAPIClient) *orphanedDirectoryReporter {
+	if interval <= 0 {
+		return nil
+	}
+	return &orphanedDirectoryReporter{
+		interval:      interval,
+		deleteOrphans: deleteOrphans,
+		k8sClient:     k8sClient,
+	}
+}
+
+// run reports the orphaned directories once per interval until stopCh is closed
+func (r *orphanedDirectoryReporter) run(d *Driver, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.poll(context.Background(), d); err != nil {
+			klog.Warningf("Failed to report orphaned directories: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// orphanedDirectoryScan is the scan of a file system, shared by its storage classes
+type orphanedDirectoryScan struct {
+	fileSystemId   string
+	storageClasses []*storagev1.StorageClass
+	basePaths      []string
+}
+
+func (r *orphanedDirectoryReporter) poll(ctx context.Context, d *Driver) error {
+	clientset, err := r.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list storage classes: %v", err)
+	}
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+
+	scans := map[string]*orphanedDirectoryScan{}
+	for idx := range scs.Items {
+		sc := &scs.Items[idx]
+		if sc.Provisioner != driverName || sc.Parameters[ProvisioningMode] != AccessPointMode {
+			continue
+		}
+		fsId, err := d.fileSystemAliases.storageClassFileSystemId(sc.Parameters)
+		if err != nil {
+			klog.Warningf("Skipping storage class %s in the orphaned directory report: %v", sc.Name, err)
+			continue
+		}
+		scan, ok := scans[fsId]
+		if !ok {
+			scan = &orphanedDirectoryScan{fileSystemId: fsId}
+			scans[fsId] = scan
+		}
+		scan.storageClasses = append(scan.storageClasses, sc)
+		scan.basePaths = append(scan.basePaths, path.Join("/", sc.Parameters[BasePath]))
+	}
+
+	for fsId, scan := range scans {
+		volumeAccessPoints := map[string]bool{}
+		var staticPaths []string
+		for _, pv := range pvs.Items {
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+				continue
+			}
+			pvFsId, subpath, apId, err := parseVolumeId(pv.Spec.CSI.VolumeHandle)
+			if err != nil || pvFsId != fsId {
+				continue
+			}
+			if apId != "" {
+				volumeAccessPoints[apId] = true
+			} else {
+				staticPaths = append(staticPaths, path.Join("/", subpath))
+			}
+		}
+		orphans, err := r.scan(ctx, d, scan, volumeAccessPoints, staticPaths)
+		if err != nil {
+			klog.Warningf("Failed to report the orphaned directories of file system %s: %v", fsId, err)
+			continue
+		}
+		r.record(ctx, clientset, scan, orphans)
+	}
+	return nil
+}
+
+// scan mounts the root of the file system and returns its orphaned directories, deleting them with deleteOrphans
+func (r *orphanedDirectoryReporter) scan(ctx context.Context, d *Driver, scan *orphanedDirectoryScan, volumeAccessPoints map[string]bool, staticPaths []string) ([]orphanedDirectory, error) {
+	localCloud, err := d.storageClassCloud(scan.storageClasses[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EFS API client: %v", err)
+	}
+	accessPoints, err := localCloud.ListAccessPoints(ctx, scan.fileSystemId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access points: %v", err)
+	}
+
+	// The base paths are in use, e.g. the base path of a storage class under the base path "/" of another one
+	inUse := append([]string{}, scan.basePaths...)
+	inUse = append(inUse, staticPaths...)
+	accessPointRootDirs := map[string]string{}
+	for _, ap := range accessPoints {
+		if volumeAccessPoints[ap.AccessPointId] {
+			inUse = append(inUse, ap.AccessPointRootDir)
+		} else {
+			accessPointRootDirs[ap.AccessPointId] = ap.AccessPointRootDir
+		}
+	}
+
+	apiConfig, err := storageClassAPIConfig(scan.storageClasses[0].Parameters, d.fileSystemAliases)
+	if err != nil {
+		return nil, err
+	}
+	mountOptions := d.rootMountOptions(ctx, localCloud, scan.fileSystemId, "", apiConfig.Region, false)
+	target := TempMountPathPrefix + "/orphaned-directories-" + scan.fileSystemId
+	var orphans []orphanedDirectory
+	err = d.withTempMount(ctx, scan.fileSystemId, target, mountOptions, func(ctx context.Context, target string) error {
+		orphans, err = findOrphanedDirectories(target, scan.basePaths, inUse, accessPointRootDirs, time.Now().Add(-orphanedDirectoryMinAge))
+		if err != nil || !r.deleteOrphans {
+			return err
+		}
+		remaining := orphans[:0]
+		for _, orphan := range orphans {
+			if len(orphan.AccessPoints) > 0 {
+				remaining = append(remaining, orphan)
+				continue
+			}
+			removed, err := removeAllWithContext(ctx, target+orphan.Path)
+			if err != nil {
+				klog.Warningf("Failed to delete orphaned directory %q of file system %s: %v", orphan.Path, scan.fileSystemId, err)
+				remaining = append(remaining, orphan)
+				continue
+			}
+			klog.Infof("Deleted orphaned directory %q of file system %s, %d bytes", orphan.Path, scan.fileSystemId, removed)
+		}
+		orphans = remaining
+		return nil
+	})
+	return orphans, err
+}
+
+// findOrphanedDirectories returns the directories of the base paths under root that are not modified since
+// notAfter and hold none of the in use paths, with the access points rooted in them
+func findOrphanedDirectories(root string, basePaths, inUse []string, accessPointRootDirs map[string]string, notAfter time.Time) ([]orphanedDirectory, error) {
+	seen := map[string]bool{}
+	var orphans []orphanedDirectory
+	for _, basePath := range basePaths {
+		entries, err := os.ReadDir(root + basePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("could not list base path %q: %v", basePath, err)
+		}
+		for _, entry := range entries {
+			dir := path.Join(basePath, entry.Name())
+			if !entry.IsDir() || seen[dir] || holdsAny(dir, inUse) {
+				continue
+			}
+			seen[dir] = true
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(notAfter) {
+				continue
+			}
+			orphan := orphanedDirectory{Path: dir}
+			for apId, rootDir := range accessPointRootDirs {
+				if holdsAny(dir, []string{rootDir}) {
+					orphan.AccessPoints = append(orphan.AccessPoints, apId)
+				}
+			}
+			sort.Strings(orphan.AccessPoints)
+			orphans = append(orphans, orphan)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Path < orphans[j].Path })
+	return orphans, nil
+}
+
+// holdsAny returns whether one of the paths is dir or under it
+func holdsAny(dir string, paths []string) bool {
+	for _, p := range paths {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// record logs the orphaned directories, sets their metric and reports them in an event of the storage classes
+func (r *orphanedDirectoryReporter) record(ctx context.Context, clientset kubernetes.Interface, scan *orphanedDirectoryScan, orphans []orphanedDirectory) {
+	orphanedDirectories.WithLabelValues(scan.fileSystemId).Set(float64(len(orphans)))
+	if len(orphans) == 0 {
+		klog.V(4).Infof("No orphaned directory in file system %s", scan.fileSystemId)
+		return
+	}
+	var descriptions []string
+	for idx, orphan := range orphans {
+		if idx == orphanedDirectoriesEventLimit {
+			descriptions = append(descriptions, fmt.Sprintf("and %d more", len(orphans)-idx))
+			break
+		}
+		description := orphan.Path
+		if len(orphan.AccessPoints) > 0 {
+			description += fmt.Sprintf(" (access points %s)", strings.Join(orphan.AccessPoints, ", "))
+		}
+		descriptions = append(descriptions, description)
+	}
+	message := fmt.Sprintf("%d directories of file system %s hold no persistent volume: %s", len(orphans), scan.fileSystemId, strings.Join(descriptions, ", "))
+	klog.Warning(message)
+
+	// Events of cluster scoped objects are stored in the default namespace
+	for _, sc := range scan.storageClasses {
+		now := metav1.Now()
+		event := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: sc.Name + ".",
+				Namespace:    metav1.NamespaceDefault,
+			},
+			InvolvedObject: corev1.ObjectReference{
+				APIVersion: "storage.k8s.io/v1",
+				Kind:       "StorageClass",
+				Name:       sc.Name,
+				UID:        sc.UID,
+			},
+			Reason:         OrphanedDirectoriesEventReason,
+			Message:        message,
+			Type:           corev1.EventTypeWarning,
+			Source:         corev1.EventSource{Component: driverName},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if _, err := clientset.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+			klog.Warningf("Failed to record the orphaned directories of storage class %s: %v", sc.Name, err)
+		}
+	}
+}
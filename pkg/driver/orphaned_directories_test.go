@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindOrphanedDirectories(t *testing.T) {
+	old := time.Now().Add(-2 * orphanedDirectoryMinAge)
+	testCases := []struct {
+		name                string
+		dirs                []string
+		recentDirs          []string
+		basePaths           []string
+		inUse               []string
+		accessPointRootDirs map[string]string
+		expected            []orphanedDirectory
+	}{
+		{
+			name:      "Success: directories of deleted volumes are orphaned",
+			dirs:      []string{"/dynamic/pvc-1", "/dynamic/pvc-2", "/dynamic/pvc-3"},
+			basePaths: []string{"/dynamic"},
+			inUse:     []string{"/dynamic", "/dynamic/pvc-2"},
+			expected:  []orphanedDirectory{{Path: "/dynamic/pvc-1"}, {Path: "/dynamic/pvc-3"}},
+		},
+		{
+			name:      "Success: directories holding the root directory of a volume are not orphaned",
+			dirs:      []string{"/dynamic/ns-1/pvc-1", "/dynamic/ns-2/pvc-2"},
+			basePaths: []string{"/dynamic"},
+			inUse:     []string{"/dynamic", "/dynamic/ns-1/pvc-1"},
+			expected:  []orphanedDirectory{{Path: "/dynamic/ns-2"}},
+		},
+		{
+			name:      "Success: base paths of other storage classes are not orphaned",
+			dirs:      []string{"/dynamic/pvc-1", "/pvc-2"},
+			basePaths: []string{"/", "/dynamic"},
+			inUse:     []string{"/", "/dynamic"},
+			expected:  []orphanedDirectory{{Path: "/dynamic/pvc-1"}, {Path: "/pvc-2"}},
+		},
+		{
+			name:                "Success: access points rooted in orphaned directories are reported",
+			dirs:                []string{"/dynamic/pvc-1", "/dynamic/pvc-2"},
+			basePaths:           []string{"/dynamic"},
+			inUse:               []string{"/dynamic"},
+			accessPointRootDirs: map[string]string{"fsap-1": "/dynamic/pvc-1", "fsap-2": "/other"},
+			expected:            []orphanedDirectory{{Path: "/dynamic/pvc-1", AccessPoints: []string{"fsap-1"}}, {Path: "/dynamic/pvc-2"}},
+		},
+		{
+			name:       "Success: recently modified directories are not orphaned",
+			dirs:       []string{"/dynamic/pvc-1"},
+			recentDirs: []string{"/dynamic/pvc-2"},
+			basePaths:  []string{"/dynamic"},
+			inUse:      []string{"/dynamic"},
+			expected:   []orphanedDirectory{{Path: "/dynamic/pvc-1"}},
+		},
+		{
+			name:      "Success: missing base path",
+			basePaths: []string{"/dynamic"},
+			inUse:     []string{"/dynamic"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, dir := range append(append([]string{}, tc.dirs...), tc.recentDirs...) {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Parents are created with the children, age them afterwards
+			for _, dir := range tc.dirs {
+				for p := dir; p != "/"; p = filepath.Dir(p) {
+					if err := os.Chtimes(filepath.Join(root, p), old, old); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			orphans, err := findOrphanedDirectories(root, tc.basePaths, tc.inUse, tc.accessPointRootDirs, time.Now().Add(-orphanedDirectoryMinAge))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(orphans, tc.expected) {
+				t.Fatalf("Expected orphans %+v, got %+v", tc.expected, orphans)
+			}
+		})
+	}
+}
+
+func TestStorageClassFileSystemId(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fsId     string
+		expected string
+	}{
+		{
+			name:     "Success: file system ID",
+			fsId:     "fs-abcd1234",
+			expected: "fs-abcd1234",
+		},
+		{
+			name:     "Success: file system ARN",
+			fsId:     "arn:aws:elasticfilesystem:us-west-2:123456789012:file-system/fs-abcd1234",
+			expected: "fs-abcd1234",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &Driver{}
+			sc := &storagev1.StorageClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "efs-sc"},
+				Parameters: map[string]string{FsId: tc.fsId},
+			}
+			fsId, err := driver.fileSystemAliases.storageClassFileSystemId(sc.Parameters)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if fsId != tc.expected {
+				t.Fatalf("Expected file system %s, got %s", tc.expected, fsId)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// removeEmptyParentDirs removes the parents of rootDir, a directory of the file system mounted at target,
+// from the deepest up to basePath excluded, at most maxDepth of them. It stops at the first parent that
+// is not empty, e.g. because it holds the directory of another volume. It returns the number of
+// directories removed.
+func removeEmptyParentDirs(target, rootDir, basePath string, maxDepth int) int {
+	rootDir = path.Join("/", rootDir)
+	basePath = path.Join("/", basePath)
+	if basePath != "/" && !strings.HasPrefix(rootDir, basePath+"/") {
+		klog.Warningf("Not removing the parents of %q, which is not under the base path %q", rootDir, basePath)
+		return 0
+	}
+	removed := 0
+	for dir := path.Dir(rootDir); removed < maxDepth && dir != basePath && dir != "/"; dir = path.Dir(dir) {
+		err := os.Remove(path.Join(target, dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			// Some file systems report a directory that is not empty with EEXIST
+			if !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+				klog.Warningf("Could not remove parent directory %q of %q: %v", dir, rootDir, err)
+			}
+			break
+		}
+		klog.V(4).Infof("Removed empty parent directory %q of %q", dir, rootDir)
+		removed++
+	}
+	return removed
+}
+
+// existingParentDir mounts the root of the file system on a temporary path of the controller and returns
+// the deepest existing parent of rootDir, from basePath down. EFS creates the parents below it when the
+// access point is first mounted, so they are the only ones that may be removed with the volume.
+func (d *Driver) existingParentDir(ctx context.Context, localCloud cloud.Cloud, fileSystemId, rootDir, basePath, volName, roleArn, region string, crossAccountDNSEnabled bool) (string, error) {
+	mountOptions := d.rootMountOptions(ctx, localCloud, fileSystemId, roleArn, region, crossAccountDNSEnabled)
+	var existing string
+	err := d.withTempMount(ctx, fileSystemId, TempMountPathPrefix+"/"+volName, mountOptions, func(ctx context.Context, target string) error {
+		var err error
+		existing, err = deepestExistingParentDir(target, rootDir, basePath)
+		return err
+	})
+	return existing, err
+}
+
+// deepestExistingParentDir returns the deepest parent of rootDir, a directory of the file system mounted at
+// target, that exists under basePath, or basePath if none does.
+func deepestExistingParentDir(target, rootDir, basePath string) (string, error) {
+	rootDir = path.Join("/", rootDir)
+	dir := path.Join("/", basePath)
+	parent := path.Dir(rootDir)
+	if dir != "/" && !strings.HasPrefix(parent+"/", dir+"/") {
+		return dir, nil
+	}
+	for _, name := range strings.Split(strings.TrimPrefix(parent, dir), "/") {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(path.Join(target, dir, name))
+		if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		dir = path.Join(dir, name)
+	}
+	return dir, nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveEmptyParentDirs(t *testing.T) {
+	testCases := []struct {
+		name            string
+		dirs            []string
+		rootDir         string
+		basePath        string
+		maxDepth        int
+		expectedRemoved int
+		expectedExist   []string
+		expectedMissing []string
+	}{
+		{
+			name:            "Remove up to the base path",
+			dirs:            []string{"/base/ns/pvc"},
+			rootDir:         "/base/ns/pvc/volume",
+			basePath:        "/base",
+			maxDepth:        5,
+			expectedRemoved: 2,
+			expectedExist:   []string{"/base"},
+			expectedMissing: []string{"/base/ns"},
+		},
+		{
+			name:            "Stop at a parent used by another volume",
+			dirs:            []string{"/base/ns/pvc", "/base/ns/other"},
+			rootDir:         "/base/ns/pvc/volume",
+			basePath:        "/base",
+			maxDepth:        5,
+			expectedRemoved: 1,
+			expectedExist:   []string{"/base/ns/other"},
+			expectedMissing: []string{"/base/ns/pvc"},
+		},
+		{
+			name:            "Bounded depth",
+			dirs:            []string{"/a/b/c"},
+			rootDir:         "/a/b/c/volume",
+			basePath:        "/",
+			maxDepth:        2,
+			expectedRemoved: 2,
+			expectedExist:   []string{"/a"},
+			expectedMissing: []string{"/a/b"},
+		},
+		{
+			name:            "Root directory outside of the base path",
+			dirs:            []string{"/other/ns"},
+			rootDir:         "/other/ns/volume",
+			basePath:        "/base",
+			maxDepth:        5,
+			expectedRemoved: 0,
+			expectedExist:   []string{"/other/ns"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := t.TempDir()
+			for _, dir := range tc.dirs {
+				if err := os.MkdirAll(filepath.Join(target, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if removed := removeEmptyParentDirs(target, tc.rootDir, tc.basePath, tc.maxDepth); removed != tc.expectedRemoved {
+				t.Fatalf("Expected %d directories removed, got %d", tc.expectedRemoved, removed)
+			}
+			for _, dir := range tc.expectedExist {
+				if _, err := os.Stat(filepath.Join(target, dir)); err != nil {
+					t.Errorf("Expected %s to exist: %v", dir, err)
+				}
+			}
+			for _, dir := range tc.expectedMissing {
+				if _, err := os.Stat(filepath.Join(target, dir)); !os.IsNotExist(err) {
+					t.Errorf("Expected %s to be removed: %v", dir, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeepestExistingParentDir(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dirs     []string
+		rootDir  string
+		basePath string
+		expected string
+	}{
+		{
+			name:     "Parents created with the access point",
+			rootDir:  "/base/ns/pvc/volume",
+			basePath: "/base",
+			expected: "/base",
+		},
+		{
+			name:     "Parent existing before the volume",
+			dirs:     []string{"/base/ns"},
+			rootDir:  "/base/ns/pvc/volume",
+			basePath: "/base",
+			expected: "/base/ns",
+		},
+		{
+			name:     "All parents existing",
+			dirs:     []string{"/ns/pvc"},
+			rootDir:  "/ns/pvc/volume",
+			basePath: "/",
+			expected: "/ns/pvc",
+		},
+		{
+			name:     "Root directory outside of the base path",
+			dirs:     []string{"/other/ns"},
+			rootDir:  "/other/ns/volume",
+			basePath: "/base",
+			expected: "/base",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := t.TempDir()
+			for _, dir := range tc.dirs {
+				if err := os.MkdirAll(filepath.Join(target, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir, err := deepestExistingParentDir(target, tc.rootDir, tc.basePath)
+			if err != nil {
+				t.Fatalf("deepestExistingParentDir failed: %v", err)
+			}
+			if dir != tc.expected {
+				t.Fatalf("Expected %q, got %q", tc.expected, dir)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// createAccessPoint creates the access point in two phases: the access point is created as pending, then
+// marked as provisioned. If an attempt fails in between, or its response is lost, the pending access point
+// is completed by the next attempt with the same client token instead of being orphaned. Its options may
+// differ, e.g. when the gid or the root directory name are allocated again, in which case the creation fails
+// with ErrAlreadyExists.
+func createAccessPoint(ctx context.Context, localCloud cloud.Cloud, clientToken string, accessPointOpts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+	accessPoint, err := createPendingAccessPoint(ctx, localCloud, clientToken, accessPointOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := markAccessPointProvisioned(ctx, localCloud, accessPoint); err != nil {
+		return nil, err
+	}
+	return accessPoint, nil
+}
+
+// createPendingAccessPoint is the first phase of createAccessPoint. The access point returned is pending,
+// unless it was completed by a previous attempt.
+func createPendingAccessPoint(ctx context.Context, localCloud cloud.Cloud, clientToken string, accessPointOpts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+	accessPoint, err := localCloud.CreateAccessPoint(ctx, clientToken, accessPointOpts)
+	if err == cloud.ErrAlreadyExists {
+		existingAP, findErr := localCloud.FindAccessPointByClientToken(ctx, clientToken, accessPointOpts.FileSystemId)
+		if findErr != nil {
+			return nil, findErr
+		}
+		if existingAP == nil || !existingAP.Pending {
+			return nil, err
+		}
+		klog.Infof("Completing access point %v left pending by a previous attempt with client token %v", existingAP.AccessPointId, clientToken)
+		existingAP.CapacityGiB = accessPointOpts.CapacityGiB
+		accessPoint, err = existingAP, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return accessPoint, nil
+}
+
+// markAccessPointProvisioned completes the creation of the access point if it is pending
+func markAccessPointProvisioned(ctx context.Context, localCloud cloud.Cloud, accessPoint *cloud.AccessPoint) error {
+	if !accessPoint.Pending {
+		return nil
+	}
+	if err := localCloud.MarkAccessPointProvisioned(ctx, accessPoint.AccessPointId); err != nil {
+		return err
+	}
+	accessPoint.Pending = false
+	return nil
+}
+
+// reconcilePendingAccessPoints deletes the access points created by the driver, and by the controllers of the
+// cluster if its ID is set, that have been pending for longer than the ttl. Their creation was interrupted and
+// never retried, e.g. because the claim was deleted in between, so no persistent volume refers to them. Their
+// root directory is left as is.
+func reconcilePendingAccessPoints(ctx context.Context, localCloud cloud.Cloud, clusterId string, ttl time.Duration) error {
+	tags := map[string]string{DefaultTagKey: DefaultTagValue}
+	if clusterId != "" {
+		tags[cloud.ClusterIdTagKey] = clusterId
+	}
+	accessPoints, err := localCloud.ListPendingAccessPoints(ctx, tags)
+	if err != nil {
+		return err
+	}
+
+	for _, ap := range accessPoints {
+		if time.Since(ap.PendingSince) < ttl {
+			klog.V(4).Infof("Access point %v of file system %v is pending since %v, keeping it", ap.AccessPointId, ap.FileSystemId, ap.PendingSince)
+			continue
+		}
+		klog.Infof("Deleting access point %v of file system %v left pending since %v", ap.AccessPointId, ap.FileSystemId, ap.PendingSince)
+		err := localCloud.DeleteAccessPoint(ctx, ap.AccessPointId)
+		if err != nil && err != cloud.ErrNotFound {
+			klog.Warningf("Failed to delete pending access point %v: %v", ap.AccessPointId, err)
+		}
+	}
+	return nil
+}
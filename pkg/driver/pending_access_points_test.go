@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestCreateAccessPointTwoPhase(t *testing.T) {
+	var (
+		fsId        = "fs-abcd1234"
+		apId        = "fsap-abcd1234xyz987"
+		clientToken = "pvc-1234"
+	)
+	pendingAP := func() *cloud.AccessPoint {
+		return &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, Pending: true}
+	}
+	opts := &cloud.AccessPointOptions{FileSystemId: fsId, CapacityGiB: 5}
+
+	testCases := []struct {
+		name     string
+		testFunc func(t *testing.T)
+	}{
+		{
+			name: "Success: created and marked as provisioned",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				ctx := context.Background()
+
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(pendingAP(), nil)
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+
+				ap, err := createAccessPoint(ctx, mockCloud, clientToken, opts)
+				if err != nil {
+					t.Fatalf("createAccessPoint failed: %v", err)
+				}
+				if ap.Pending {
+					t.Fatal("Expected access point to be provisioned")
+				}
+			},
+		},
+		{
+			name: "Success: retry completes the access point after a failure between the two phases",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				ctx := context.Background()
+
+				// First attempt fails to mark the access point as provisioned
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(pendingAP(), nil)
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Eq(ctx), gomock.Eq(apId)).Return(errors.New("connection reset"))
+				if _, err := createAccessPoint(ctx, mockCloud, clientToken, opts); err == nil {
+					t.Fatal("Expected first attempt to fail")
+				}
+
+				// The retry allocated other options, so the creation conflicts with the pending access point
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(nil, cloud.ErrAlreadyExists)
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(pendingAP(), nil)
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				ap, err := createAccessPoint(ctx, mockCloud, clientToken, opts)
+				if err != nil {
+					t.Fatalf("createAccessPoint failed: %v", err)
+				}
+				if ap.AccessPointId != apId || ap.Pending || ap.CapacityGiB != opts.CapacityGiB {
+					t.Fatalf("Expected pending access point %v to be completed, got %+v", apId, ap)
+				}
+			},
+		},
+		{
+			name: "Success: retry completes the access point after a lost response",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				ctx := context.Background()
+
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(nil, cloud.ErrDeadlineExceeded)
+				if _, err := createAccessPoint(ctx, mockCloud, clientToken, opts); err != cloud.ErrDeadlineExceeded {
+					t.Fatalf("Expected first attempt to time out, got %v", err)
+				}
+
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(nil, cloud.ErrAlreadyExists)
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(pendingAP(), nil)
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+				if _, err := createAccessPoint(ctx, mockCloud, clientToken, opts); err != nil {
+					t.Fatalf("createAccessPoint failed: %v", err)
+				}
+			},
+		},
+		{
+			name: "Fail: client token used by a provisioned access point",
+			testFunc: func(t *testing.T) {
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+				mockCloud := mocks.NewMockCloud(mockCtl)
+				ctx := context.Background()
+
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(nil, cloud.ErrAlreadyExists)
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(&cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId}, nil)
+				if _, err := createAccessPoint(ctx, mockCloud, clientToken, opts); err != cloud.ErrAlreadyExists {
+					t.Fatalf("Expected ErrAlreadyExists, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.testFunc)
+	}
+}
+
+func TestReconcilePendingAccessPoints(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	ctx := context.Background()
+
+	tags := map[string]string{DefaultTagKey: DefaultTagValue, cloud.ClusterIdTagKey: "cluster-a"}
+	mockCloud.EXPECT().ListPendingAccessPoints(gomock.Eq(ctx), gomock.Eq(tags)).Return([]*cloud.AccessPoint{
+		{AccessPointId: "fsap-orphaned", FileSystemId: "fs-abcd1234", Pending: true, PendingSince: time.Now().Add(-2 * time.Hour)},
+		{AccessPointId: "fsap-deleted", FileSystemId: "fs-abcd1234", Pending: true, PendingSince: time.Now().Add(-2 * time.Hour)},
+		{AccessPointId: "fsap-in-flight", FileSystemId: "fs-abcd1234", Pending: true, PendingSince: time.Now()},
+	}, nil)
+	mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq("fsap-orphaned")).Return(nil)
+	mockCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq("fsap-deleted")).Return(cloud.ErrNotFound)
+
+	if err := reconcilePendingAccessPoints(ctx, mockCloud, "cluster-a", time.Hour); err != nil {
+		t.Fatalf("reconcilePendingAccessPoints failed: %v", err)
+	}
+}
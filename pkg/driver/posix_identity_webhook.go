@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const posixIdentityWebhookTimeout = 10 * time.Second
+
+// PosixIdentityRequest is the payload posted to the posix identity webhook
+type PosixIdentityRequest struct {
+	FileSystemId string `json:"fileSystemId"`
+	PvName       string `json:"pvName"`
+	PvcName      string `json:"pvcName"`
+	PvcNamespace string `json:"pvcNamespace"`
+}
+
+// PosixIdentity is the posix user returned by the posix identity webhook
+type PosixIdentity struct {
+	Uid           *int64  `json:"uid"`
+	Gid           *int64  `json:"gid"`
+	SecondaryGids []int64 `json:"secondaryGids,omitempty"`
+}
+
+// PosixIdentityWebhook delegates the allocation of access point posix users to an external service
+type PosixIdentityWebhook interface {
+	GetPosixIdentity(ctx context.Context, req *PosixIdentityRequest) (*PosixIdentity, error)
+}
+
+type httpPosixIdentityWebhook struct {
+	url    string
+	client *http.Client
+}
+
+func newPosixIdentityWebhook(url string) PosixIdentityWebhook {
+	if url == "" {
+		return nil
+	}
+	return &httpPosixIdentityWebhook{
+		url:    url,
+		client: &http.Client{Timeout: posixIdentityWebhookTimeout},
+	}
+}
+
+func (w *httpPosixIdentityWebhook) GetPosixIdentity(ctx context.Context, req *PosixIdentityRequest) (*PosixIdentity, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	klog.V(5).Infof("Calling posix identity webhook %s with %+v", redactURL(w.url), *req)
+	res, err := w.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("posix identity webhook call failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read posix identity webhook response: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("posix identity webhook returned status %d: %s", res.StatusCode, string(resBody))
+	}
+
+	identity := &PosixIdentity{}
+	if err := json.Unmarshal(resBody, identity); err != nil {
+		return nil, fmt.Errorf("failed to decode posix identity webhook response: %v", err)
+	}
+	if err := identity.validate(); err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("Posix identity webhook returned uid: %d, gid: %d, secondaryGids: %v", *identity.Uid, *identity.Gid, identity.SecondaryGids)
+	return identity, nil
+}
+
+func (p *PosixIdentity) validate() error {
+	if p.Uid == nil || p.Gid == nil {
+		return fmt.Errorf("posix identity webhook response must contain uid and gid")
+	}
+	if *p.Uid < 0 || *p.Gid < 0 {
+		return fmt.Errorf("posix identity webhook returned negative uid or gid")
+	}
+	for _, gid := range p.SecondaryGids {
+		if gid < 0 {
+			return fmt.Errorf("posix identity webhook returned negative secondary gid %d", gid)
+		}
+	}
+	return nil
+}
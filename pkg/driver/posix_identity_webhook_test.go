@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakePosixIdentityWebhook struct {
+	req      *PosixIdentityRequest
+	identity *PosixIdentity
+	err      error
+}
+
+func (f *fakePosixIdentityWebhook) GetPosixIdentity(ctx context.Context, req *PosixIdentityRequest) (*PosixIdentity, error) {
+	f.req = req
+	return f.identity, f.err
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestHttpPosixIdentityWebhook(t *testing.T) {
+	testCases := []struct {
+		name         string
+		statusCode   int
+		response     string
+		expectError  bool
+		expectedUid  int64
+		expectedGid  int64
+		expectedGids []int64
+	}{
+		{
+			name:         "Success",
+			statusCode:   http.StatusOK,
+			response:     `{"uid": 1000, "gid": 1001, "secondaryGids": [1002, 1003]}`,
+			expectedUid:  1000,
+			expectedGid:  1001,
+			expectedGids: []int64{1002, 1003},
+		},
+		{
+			name:        "Success: without secondary gids",
+			statusCode:  http.StatusOK,
+			response:    `{"uid": 0, "gid": 0}`,
+			expectedUid: 0,
+			expectedGid: 0,
+		},
+		{
+			name:        "Fail: error status code",
+			statusCode:  http.StatusInternalServerError,
+			response:    "out of ids",
+			expectError: true,
+		},
+		{
+			name:        "Fail: missing gid",
+			statusCode:  http.StatusOK,
+			response:    `{"uid": 1000}`,
+			expectError: true,
+		},
+		{
+			name:        "Fail: negative uid",
+			statusCode:  http.StatusOK,
+			response:    `{"uid": -1, "gid": 1000}`,
+			expectError: true,
+		},
+		{
+			name:        "Fail: malformed response",
+			statusCode:  http.StatusOK,
+			response:    "not json",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received PosixIdentityRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("Expected POST request, got %s", r.Method)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("Failed to decode request: %v", err)
+				}
+				w.WriteHeader(tc.statusCode)
+				w.Write([]byte(tc.response))
+			}))
+			defer server.Close()
+
+			webhook := newPosixIdentityWebhook(server.URL)
+			req := &PosixIdentityRequest{
+				FileSystemId: "fs-abcd1234",
+				PvName:       "pv",
+				PvcName:      "pvc",
+				PvcNamespace: "ns",
+			}
+			identity, err := webhook.GetPosixIdentity(context.Background(), req)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if received != *req {
+				t.Fatalf("Webhook received %+v, expected %+v", received, *req)
+			}
+			if *identity.Uid != tc.expectedUid || *identity.Gid != tc.expectedGid {
+				t.Fatalf("Expected uid/gid %d/%d, got %d/%d", tc.expectedUid, tc.expectedGid, *identity.Uid, *identity.Gid)
+			}
+			if len(identity.SecondaryGids) != len(tc.expectedGids) {
+				t.Fatalf("Expected secondary gids %v, got %v", tc.expectedGids, identity.SecondaryGids)
+			}
+		})
+	}
+}
+
+func TestNewPosixIdentityWebhookDisabled(t *testing.T) {
+	if webhook := newPosixIdentityWebhook(""); webhook != nil {
+		t.Fatalf("Expected no webhook for empty url, got %v", webhook)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// PrewarmAnnotation marks the persistent volumes mounted by every node at startup
+	PrewarmAnnotation = "efs.csi.aws.com/prewarm"
+
+	// prewarmTimeout bounds how long the node waits for the prewarmed volumes before removing its taint
+	prewarmTimeout = 2 * time.Minute
+)
+
+// volumePrewarm mounts the persistent volumes annotated with PrewarmAnnotation when the node starts, in
+// a staging directory of the plugin directory, so that the pods scheduled once the node is ready do not
+// wait for the first mount of their volume, e.g. its DNS resolution, TLS tunnel and IAM credentials.
+// With shared volume mounts the pods then only bind mount the prewarmed mount. The staging directories
+// of the volumes no longer annotated are unmounted at the next start. A nil volumePrewarm is valid and
+// prewarms no volume.
+type volumePrewarm struct {
+	dir       string
+	k8sClient cloud.KubernetesAPIClient
+}
+
+func newVolumePrewarm(kubeletDir string, k8sClient cloud.KubernetesAPIClient) *volumePrewarm {
+	return &volumePrewarm{
+		dir:       filepath.Join(kubeletDir, "plugins", driverName, "prewarm"),
+		k8sClient: k8sClient,
+	}
+}
+
+// stagingPath returns the directory where the volume is prewarmed
+func (p *volumePrewarm) stagingPath(volumeId string) string {
+	return filepath.Join(p.dir, hashPath(volumeId))
+}
+
+// isStagingPath returns whether the target is the staging directory of a prewarmed volume
+func (p *volumePrewarm) isStagingPath(target string) bool {
+	if p == nil {
+		return false
+	}
+	return strings.HasPrefix(filepath.Clean(target), p.dir+string(filepath.Separator))
+}
+
+// prewarmVolumes mounts the volumes to prewarm in the background and returns a channel closed once done
+func (d *Driver) prewarmVolumes(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := d.volumePrewarm.run(ctx, d); err != nil {
+			klog.Warningf("Failed to prewarm volumes: %v", err)
+		}
+	}()
+	return done
+}
+
+// run publishes every persistent volume of the driver annotated with PrewarmAnnotation at its staging
+// path, and unpublishes the staging paths of the other volumes
+func (p *volumePrewarm) run(ctx context.Context, d *Driver) error {
+	clientset, err := p.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+
+	prewarmed := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName || pv.Annotations[PrewarmAnnotation] != "true" {
+			continue
+		}
+		if pv.Status.Phase != corev1.VolumeBound {
+			continue
+		}
+		target := p.stagingPath(pv.Spec.CSI.VolumeHandle)
+		prewarmed[filepath.Base(target)] = true
+		// The driver restarted without the node rebooting
+		if notMounted, err := d.mounter.IsLikelyNotMountPoint(target); err == nil && !notMounted {
+			klog.V(4).Infof("Volume %s of persistent volume %s is already prewarmed", pv.Spec.CSI.VolumeHandle, pv.Name)
+			continue
+		}
+		start := time.Now()
+		if _, err := d.NodePublishVolume(ctx, prewarmRequest(&pv, target)); err != nil {
+			klog.Warningf("Failed to prewarm volume %s of persistent volume %s: %v", pv.Spec.CSI.VolumeHandle, pv.Name, err)
+			continue
+		}
+		klog.Infof("Prewarmed volume %s of persistent volume %s in %v", pv.Spec.CSI.VolumeHandle, pv.Name, time.Since(start))
+	}
+
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read prewarm directory %s: %v", p.dir, err)
+	}
+	for _, entry := range entries {
+		if prewarmed[entry.Name()] {
+			continue
+		}
+		target := filepath.Join(p.dir, entry.Name())
+		if _, err := d.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{TargetPath: target}); err != nil {
+			klog.Warningf("Failed to unmount the prewarmed volume at %s: %v", target, err)
+			continue
+		}
+		klog.Infof("Unmounted the volume prewarmed at %s, no longer annotated with %s", target, PrewarmAnnotation)
+	}
+	return nil
+}
+
+// prewarmRequest returns the NodePublishVolume request of the persistent volume at the target, as the
+// kubelet would send it for a pod. A volume only ReadOnlyMany is prewarmed read-only.
+func prewarmRequest(pv *corev1.PersistentVolume, target string) *csi.NodePublishVolumeRequest {
+	readOnly := pv.Spec.CSI.ReadOnly
+	if len(pv.Spec.AccessModes) == 1 && pv.Spec.AccessModes[0] == corev1.ReadOnlyMany {
+		readOnly = true
+	}
+	return &csi.NodePublishVolumeRequest{
+		VolumeId:   pv.Spec.CSI.VolumeHandle,
+		TargetPath: target,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{
+					MountFlags: pv.Spec.MountOptions,
+				},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		},
+		Readonly:      readOnly,
+		VolumeContext: pv.Spec.CSI.VolumeAttributes,
+	}
+}
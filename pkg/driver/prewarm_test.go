@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func prewarmVolume(name, driver, volumeHandle string, prewarm bool, phase corev1.PersistentVolumePhase) *corev1.PersistentVolume {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: volumeHandle},
+			},
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: phase},
+	}
+	if prewarm {
+		pv.Annotations = map[string]string{PrewarmAnnotation: "true"}
+	}
+	return pv
+}
+
+func TestPrewarmVolumes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter := mocks.NewMockMounter(mockCtrl)
+
+	clientset := fake.NewSimpleClientset(
+		prewarmVolume("pv-prewarm", driverName, "fs-abcd1234", true, corev1.VolumeBound),
+		prewarmVolume("pv-mounted", driverName, "fs-abcd1234::fsap-abcd1234xyz987", true, corev1.VolumeBound),
+		prewarmVolume("pv-released", driverName, "fs-abcd5678", true, corev1.VolumeReleased),
+		prewarmVolume("pv-cold", driverName, "fs-abcd9012", false, corev1.VolumeBound),
+		prewarmVolume("pv-other", "ebs.csi.aws.com", "vol-abcd1234", true, corev1.VolumeBound),
+	)
+	prewarm := newVolumePrewarm(t.TempDir(), func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+	stale := filepath.Join(prewarm.dir, hashPath("fs-abcd9012"))
+	if err := os.MkdirAll(stale, 0750); err != nil {
+		t.Fatal(err)
+	}
+	d := &Driver{
+		mounter:       mockMounter,
+		volumePrewarm: prewarm,
+	}
+
+	target := prewarm.stagingPath("fs-abcd1234")
+	mounted := prewarm.stagingPath("fs-abcd1234::fsap-abcd1234xyz987")
+	mockMounter.EXPECT().IsLikelyNotMountPoint(target).Return(true, nil)
+	mockMounter.EXPECT().MakeDir(target).Return(nil)
+	mockMounter.EXPECT().Mount("fs-abcd1234:/", target, "efs", gomock.Any()).Return(nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(mounted).Return(false, nil)
+	mockMounter.EXPECT().GetDeviceName(stale).Return("fs-abcd9012:/", 1, nil)
+	mockMounter.EXPECT().Unmount(stale).Return(nil)
+
+	<-d.prewarmVolumes(context.Background())
+}
+
+func TestPrewarmRequest(t *testing.T) {
+	pv := prewarmVolume("pv", driverName, "fs-abcd1234", true, corev1.VolumeBound)
+	pv.Spec.MountOptions = []string{"tls"}
+	pv.Spec.CSI.VolumeAttributes = map[string]string{"path": "/a"}
+	req := prewarmRequest(pv, "/target")
+	if req.GetVolumeId() != "fs-abcd1234" || req.GetTargetPath() != "/target" || req.GetReadonly() {
+		t.Fatalf("Unexpected request %+v", req)
+	}
+	if flags := req.GetVolumeCapability().GetMount().GetMountFlags(); len(flags) != 1 || flags[0] != "tls" {
+		t.Fatalf("Unexpected mount flags %v", flags)
+	}
+	if req.GetVolumeContext()["path"] != "/a" {
+		t.Fatalf("Unexpected volume context %v", req.GetVolumeContext())
+	}
+
+	pv.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany}
+	if !prewarmRequest(pv, "/target").GetReadonly() {
+		t.Fatal("Expected a read-only request for a ReadOnlyMany volume")
+	}
+}
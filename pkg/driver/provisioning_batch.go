@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// batchedCallTimeout is the timeout of a call shared by the CreateVolume calls
+const batchedCallTimeout = time.Minute
+
+// provisioningBatcher speeds up bursts of CreateVolume calls for the same file system. The calls describing
+// the file system or listing the GIDs of its access points are shared by the CreateVolume calls within the
+// window: a call in flight is waited for, and its result is reused until the window expires after it ends.
+// Failed calls are not reused. A shared call runs with its own timeout, detached from the CreateVolume call
+// that started it, so that its cancellation does not fail the others; each CreateVolume call only stops
+// waiting for it once its own context is done. The GIDs allocated from a shared listing are kept apart by the reservations
+// of the GidAllocator. The CreateAccessPoint calls are limited to maxCreations at a time, if set.
+// A nil provisioningBatcher is valid and calls the EFS API for every CreateVolume without limit.
+type provisioningBatcher struct {
+	window    time.Duration
+	creations chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]*batchedCall
+}
+
+// batchedCall is a call shared by the CreateVolume calls, done once its result is set
+type batchedCall struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+// newProvisioningBatcher returns the batcher of the window and limit, or nil if both are 0
+func newProvisioningBatcher(window time.Duration, maxCreations int) *provisioningBatcher {
+	if window <= 0 && maxCreations <= 0 {
+		return nil
+	}
+	b := &provisioningBatcher{
+		window: window,
+		calls:  map[string]*batchedCall{},
+	}
+	if maxCreations > 0 {
+		b.creations = make(chan struct{}, maxCreations)
+	}
+	return b
+}
+
+// describeFileSystem describes the file system, sharing the call within the window
+func (b *provisioningBatcher) describeFileSystem(ctx context.Context, localCloud cloud.Cloud, fileSystemId string) (*cloud.FileSystem, error) {
+	value, err := b.do(ctx, batchKey(localCloud, "describe", fileSystemId), func(ctx context.Context) (interface{}, error) {
+		return localCloud.DescribeFileSystem(ctx, fileSystemId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*cloud.FileSystem), nil
+}
+
+// listUsedGids lists the GIDs in use within the range, sharing the call within the window. The returned
+// map may be shared and must not be modified.
+func (b *provisioningBatcher) listUsedGids(ctx context.Context, localCloud cloud.Cloud, fileSystemId string, gidMin, gidMax int64) (map[int64]bool, error) {
+	value, err := b.do(ctx, batchKey(localCloud, "gids", fmt.Sprintf("%s/%d-%d", fileSystemId, gidMin, gidMax)), func(ctx context.Context) (interface{}, error) {
+		return listUsedGids(ctx, localCloud, fileSystemId, gidMin, gidMax)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[int64]bool), nil
+}
+
+// acquireCreation waits until an access point may be created, and returns the function to call once done
+func (b *provisioningBatcher) acquireCreation(ctx context.Context) (func(), error) {
+	if b == nil || b.creations == nil {
+		return func() {}, nil
+	}
+	select {
+	case b.creations <- struct{}{}:
+		return func() { <-b.creations }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *provisioningBatcher) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if b == nil || b.window <= 0 {
+		return fn(ctx)
+	}
+	b.mu.Lock()
+	call, ok := b.calls[key]
+	if ok && isDone(call.done) && time.Now().Before(call.expires) {
+		b.mu.Unlock()
+		klog.V(5).Infof("Reusing the result of %s", key)
+		return call.value, call.err
+	}
+	if ok && !isDone(call.done) {
+		b.mu.Unlock()
+		klog.V(5).Infof("Waiting for the call in flight of %s", key)
+	} else {
+		call = &batchedCall{done: make(chan struct{})}
+		b.calls[key] = call
+		b.mu.Unlock()
+		go b.run(context.WithoutCancel(ctx), key, call, fn)
+	}
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run runs the shared call with its own timeout and records its result
+func (b *provisioningBatcher) run(ctx context.Context, key string, call *batchedCall, fn func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(ctx, batchedCallTimeout)
+	defer cancel()
+	value, err := fn(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	call.value, call.err = value, err
+	call.expires = time.Now().Add(b.window)
+	if err != nil && b.calls[key] == call {
+		delete(b.calls, key)
+	}
+	// Expired calls are dropped as new calls are made, so that the calls of deleted file systems do not pile up
+	for k, c := range b.calls {
+		if c != call && c.expires.Before(time.Now()) && isDone(c.done) {
+			delete(b.calls, k)
+		}
+	}
+	close(call.done)
+}
+
+// batchKey identifies a call of the cloud, as different clouds may reach different accounts or regions
+func batchKey(localCloud cloud.Cloud, operation, args string) string {
+	return fmt.Sprintf("%p/%s/%s", localCloud, operation, args)
+}
+
+func isDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestProvisioningBatcherSharesCalls(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	ctx := context.Background()
+	batcher := newProvisioningBatcher(time.Hour, 0)
+
+	// Concurrent calls wait for the call in flight
+	release := make(chan struct{})
+	mockCloud.EXPECT().DescribeFileSystem(gomock.Any(), "fs-abcd1234").DoAndReturn(
+		func(_ context.Context, fileSystemId string) (*cloud.FileSystem, error) {
+			<-release
+			return &cloud.FileSystem{FileSystemId: fileSystemId}, nil
+		}).Times(1)
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := batcher.describeFileSystem(ctx, mockCloud, "fs-abcd1234")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// The result is reused within the window
+	if fs, err := batcher.describeFileSystem(ctx, mockCloud, "fs-abcd1234"); err != nil || fs.FileSystemId != "fs-abcd1234" {
+		t.Fatalf("Unexpected file system %+v: %v", fs, err)
+	}
+
+	// Failed calls are not reused
+	mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), "fs-abcd1234", gomock.Any()).Return(errors.New("throttled"))
+	if _, err := batcher.listUsedGids(ctx, mockCloud, "fs-abcd1234", 1000, 2000); err == nil {
+		t.Fatal("Expected an error")
+	}
+	mockCloud.EXPECT().ListAccessPointsPages(gomock.Any(), "fs-abcd1234", gomock.Any()).DoAndReturn(listAccessPointsPages(accessPointsWithGids(1000), nil))
+	for i := 0; i < 2; i++ {
+		usedGids, err := batcher.listUsedGids(ctx, mockCloud, "fs-abcd1234", 1000, 2000)
+		if err != nil || !usedGids[1000] {
+			t.Fatalf("Expected GID 1000 in use, got %v: %v", usedGids, err)
+		}
+	}
+
+	// Calls expire with the window
+	batcher.window = time.Millisecond
+	mockCloud.EXPECT().DescribeFileSystem(gomock.Any(), "fs-efgh5678").Return(&cloud.FileSystem{}, nil).Times(2)
+	for i := 0; i < 2; i++ {
+		if _, err := batcher.describeFileSystem(ctx, mockCloud, "fs-efgh5678"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProvisioningBatcherDetachesCalls(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	batcher := newProvisioningBatcher(time.Hour, 0)
+
+	// The call started by a CreateVolume call that is cancelled completes for the CreateVolume calls waiting for it
+	release := make(chan struct{})
+	mockCloud.EXPECT().DescribeFileSystem(gomock.Any(), "fs-abcd1234").DoAndReturn(
+		func(ctx context.Context, fileSystemId string) (*cloud.FileSystem, error) {
+			<-release
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return &cloud.FileSystem{FileSystemId: fileSystemId}, nil
+		}).Times(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := batcher.describeFileSystem(ctx, mockCloud, "fs-abcd1234")
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan error, 1)
+	go func() {
+		_, err := batcher.describeFileSystem(context.Background(), mockCloud, "fs-abcd1234")
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("Expected the cancelled call to stop waiting, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestProvisioningBatcherLimitsCreations(t *testing.T) {
+	if newProvisioningBatcher(0, 0) != nil {
+		t.Fatal("Expected no batcher")
+	}
+	var disabled *provisioningBatcher
+	release, err := disabled.acquireCreation(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	release()
+
+	batcher := newProvisioningBatcher(0, 1)
+	release, err = batcher.acquireCreation(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := batcher.acquireCreation(ctx); err == nil {
+		t.Fatal("Expected to wait for the creation in progress")
+	}
+	release()
+	release, err = batcher.acquireCreation(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	release()
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"strconv"
+)
+
+// ProvisioningDetailsPrefix is the prefix of the volume context properties recording the decisions of
+// CreateVolume. NodePublishVolume ignores them.
+const ProvisioningDetailsPrefix = "provisioning.efs.csi.aws.com/"
+
+// Sources of the uid and gid of the posix user of the access point of a volume
+const (
+	posixUserFromParameters     = "parameters"
+	posixUserFromAllocation     = "allocated"
+	posixUserFromWebhook        = "webhook"
+	posixUserFromFileSystemTags = "fileSystemTags"
+	posixUserNone               = "none"
+)
+
+// provisioningDetails are the decisions of CreateVolume for a volume, published in its volume context with
+// --volume-provisioning-details so that audit and observability controllers can analyze them from the
+// persistent volumes instead of the logs of the controller. They hold no secret, e.g. no role.
+type provisioningDetails struct {
+	provisioningMode  string
+	reusedAccessPoint bool
+	// posixUserSource is one of the posixUser constants, empty for a reused access point
+	posixUserSource string
+	// uid and gid are -1 when unknown or not set
+	uid           int64
+	gid           int64
+	rootDirectory string
+	mountTargetIp string
+}
+
+func newProvisioningDetails(provisioningMode string) *provisioningDetails {
+	return &provisioningDetails{
+		provisioningMode: provisioningMode,
+		uid:              -1,
+		gid:              -1,
+	}
+}
+
+// volumeContext returns the volume context properties of the details
+func (p *provisioningDetails) volumeContext() map[string]string {
+	volContext := map[string]string{
+		ProvisioningDetailsPrefix + "provisioningMode":  p.provisioningMode,
+		ProvisioningDetailsPrefix + "reusedAccessPoint": strconv.FormatBool(p.reusedAccessPoint),
+	}
+	if p.posixUserSource != "" {
+		volContext[ProvisioningDetailsPrefix+"posixUserSource"] = p.posixUserSource
+	}
+	if p.uid >= 0 {
+		volContext[ProvisioningDetailsPrefix+"uid"] = strconv.FormatInt(p.uid, 10)
+	}
+	if p.gid >= 0 {
+		volContext[ProvisioningDetailsPrefix+"gid"] = strconv.FormatInt(p.gid, 10)
+	}
+	if p.rootDirectory != "" {
+		volContext[ProvisioningDetailsPrefix+"rootDirectory"] = p.rootDirectory
+	}
+	if p.mountTargetIp != "" {
+		volContext[ProvisioningDetailsPrefix+"mountTargetIp"] = p.mountTargetIp
+	}
+	return volContext
+}
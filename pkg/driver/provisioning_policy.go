@@ -0,0 +1,223 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// provisioningPolicyResource is the namespaced EFSProvisioningPolicy custom resource
+var provisioningPolicyResource = schema.GroupVersionResource{
+	Group:    "efs.csi.aws.com",
+	Version:  "v1alpha1",
+	Resource: "efsprovisioningpolicies",
+}
+
+const provisioningPolicyResync = 10 * time.Minute
+
+var errProvisioningPoliciesNotSynced = errors.New("provisioning policies are not synced yet")
+
+// DynamicKubernetesAPIClient returns the dynamic client used to watch the provisioning policies
+var DynamicKubernetesAPIClient = func() (dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+// idRange is an inclusive range of uids or gids
+type idRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+func (r *idRange) validate() error {
+	if r != nil && (r.Min < 0 || r.Max < r.Min) {
+		return fmt.Errorf("must have 0 <= min (%d) <= max (%d)", r.Min, r.Max)
+	}
+	return nil
+}
+
+func (r *idRange) contains(id int64) bool {
+	return r == nil || (id >= r.Min && id <= r.Max)
+}
+
+// provisioningPolicySpec is the spec of an EFSProvisioningPolicy. An empty field does not constrain anything.
+type provisioningPolicySpec struct {
+	FileSystemIds []string `json:"fileSystemIds,omitempty"`
+	BasePaths     []string `json:"basePaths,omitempty"`
+	UidRange      *idRange `json:"uidRange,omitempty"`
+	GidRange      *idRange `json:"gidRange,omitempty"`
+}
+
+// provisioningRequest is the access point that CreateVolume is about to create for a claim of the namespace
+type provisioningRequest struct {
+	namespace    string
+	fileSystemId string
+	basePath     string
+	uid          int64
+	gid          int64
+	// identityUnknown is set when the uid and gid are not known, in a simulation with the posix identity webhook
+	identityUnknown bool
+}
+
+// allows returns why the policy rejects the request, or nil if it allows it
+func (s *provisioningPolicySpec) allows(req *provisioningRequest) error {
+	if len(s.FileSystemIds) > 0 && !hasOption(s.FileSystemIds, req.fileSystemId) {
+		return fmt.Errorf("file system %v is not allowed", req.fileSystemId)
+	}
+	if len(s.BasePaths) > 0 && !underAnyPath(s.BasePaths, req.basePath) {
+		return fmt.Errorf("base path %q is not allowed", req.basePath)
+	}
+	if req.identityUnknown {
+		return nil
+	}
+	if !s.UidRange.contains(req.uid) {
+		return fmt.Errorf("uid %d is not in range %d-%d", req.uid, s.UidRange.Min, s.UidRange.Max)
+	}
+	if !s.GidRange.contains(req.gid) {
+		return fmt.Errorf("gid %d is not in range %d-%d", req.gid, s.GidRange.Min, s.GidRange.Max)
+	}
+	return nil
+}
+
+// underAnyPath returns true if p is one of the paths or a subdirectory of one of them
+func underAnyPath(paths []string, p string) bool {
+	p = path.Join("/", p)
+	for _, allowed := range paths {
+		allowed = path.Join("/", allowed)
+		if p == allowed || allowed == "/" || strings.HasPrefix(p, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// provisioningPolicies is the cache of the EFSProvisioningPolicy objects of the cluster. A namespace
+// without policy may provision any access point, otherwise the access point must be allowed by at
+// least one of the policies of the namespace. A nil provisioningPolicies is valid and allows anything.
+type provisioningPolicies struct {
+	informer cache.SharedIndexInformer
+	indexer  cache.Indexer
+	synced   cache.InformerSynced
+}
+
+// newProvisioningPolicies returns the cache of the policies, or nil if the policies are disabled
+func newProvisioningPolicies(enabled bool, dynamicClient func() (dynamic.Interface, error)) (*provisioningPolicies, error) {
+	if !enabled {
+		return nil, nil
+	}
+	client, err := dynamicClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic Kubernetes client: %v", err)
+	}
+	resource := client.Resource(provisioningPolicyResource)
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return resource.List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return resource.Watch(context.Background(), options)
+			},
+		},
+		&unstructured.Unstructured{},
+		provisioningPolicyResync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+	return &provisioningPolicies{
+		informer: informer,
+		indexer:  informer.GetIndexer(),
+		synced:   informer.HasSynced,
+	}, nil
+}
+
+// run watches the policies until stopCh is closed
+func (p *provisioningPolicies) run(stopCh <-chan struct{}) {
+	p.informer.Run(stopCh)
+}
+
+// check returns an error if the policies of the namespace do not allow the request
+func (p *provisioningPolicies) check(req *provisioningRequest) error {
+	if p == nil {
+		return nil
+	}
+	if !p.synced() {
+		return errProvisioningPoliciesNotSynced
+	}
+	objs, err := p.indexer.ByIndex(cache.NamespaceIndex, req.namespace)
+	if err != nil {
+		return fmt.Errorf("failed to list provisioning policies of namespace %v: %v", req.namespace, err)
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+	var reasons []string
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		spec, err := parseProvisioningPolicySpec(u)
+		if err != nil {
+			klog.Warningf("Ignoring invalid provisioning policy %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+			reasons = append(reasons, fmt.Sprintf("%s: invalid policy", u.GetName()))
+			continue
+		}
+		if err := spec.allows(req); err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", u.GetName(), err))
+			continue
+		}
+		klog.V(4).Infof("Provisioning policy %s/%s allows access point of file system %v", u.GetNamespace(), u.GetName(), req.fileSystemId)
+		return nil
+	}
+	return fmt.Errorf("no provisioning policy of namespace %v allows the access point (%s)", req.namespace, strings.Join(reasons, "; "))
+}
+
+func parseProvisioningPolicySpec(u *unstructured.Unstructured) (*provisioningPolicySpec, error) {
+	content, _, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+	spec := &provisioningPolicySpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, spec); err != nil {
+		return nil, err
+	}
+	if err := spec.UidRange.validate(); err != nil {
+		return nil, fmt.Errorf("invalid uidRange: %v", err)
+	}
+	if err := spec.GidRange.validate(); err != nil {
+		return nil, fmt.Errorf("invalid gidRange: %v", err)
+	}
+	return spec, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestProvisioningPolicy(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "efs.csi.aws.com/v1alpha1",
+		"kind":       "EFSProvisioningPolicy",
+		"spec":       spec,
+	}}
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func newTestProvisioningPolicies(t *testing.T, policies ...*unstructured.Unstructured) *provisioningPolicies {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, policy := range policies {
+		if err := indexer.Add(policy); err != nil {
+			t.Fatalf("Failed to add policy: %v", err)
+		}
+	}
+	return &provisioningPolicies{
+		indexer: indexer,
+		synced:  func() bool { return true },
+	}
+}
+
+func TestProvisioningPoliciesCheck(t *testing.T) {
+	shared := newTestProvisioningPolicy("team-a", "shared", map[string]interface{}{
+		"fileSystemIds": []interface{}{"fs-abcd1234"},
+		"basePaths":     []interface{}{"/team-a"},
+		"uidRange":      map[string]interface{}{"min": int64(1000), "max": int64(1999)},
+		"gidRange":      map[string]interface{}{"min": int64(1000), "max": int64(1999)},
+	})
+	other := newTestProvisioningPolicy("team-a", "other", map[string]interface{}{
+		"fileSystemIds": []interface{}{"fs-5678abcd"},
+	})
+	invalid := newTestProvisioningPolicy("team-b", "invalid", map[string]interface{}{
+		"uidRange": map[string]interface{}{"min": int64(2000), "max": int64(1000)},
+	})
+	p := newTestProvisioningPolicies(t, shared, other, invalid)
+
+	testCases := []struct {
+		name      string
+		policies  *provisioningPolicies
+		req       provisioningRequest
+		expectErr bool
+	}{
+		{
+			name:     "Success: policies disabled",
+			policies: nil,
+			req:      provisioningRequest{namespace: "team-a", fileSystemId: "fs-0000000", uid: 0, gid: 0},
+		},
+		{
+			name:     "Success: namespace without policy",
+			policies: p,
+			req:      provisioningRequest{namespace: "team-c", fileSystemId: "fs-0000000", uid: 0, gid: 0},
+		},
+		{
+			name:     "Success: allowed by policy",
+			policies: p,
+			req:      provisioningRequest{namespace: "team-a", fileSystemId: "fs-abcd1234", basePath: "team-a/dynamic", uid: 1000, gid: 1999},
+		},
+		{
+			name:     "Success: allowed by the other policy",
+			policies: p,
+			req:      provisioningRequest{namespace: "team-a", fileSystemId: "fs-5678abcd", basePath: "/", uid: 0, gid: 0},
+		},
+		{
+			name:      "Fail: file system not allowed",
+			policies:  p,
+			req:       provisioningRequest{namespace: "team-a", fileSystemId: "fs-0000000", basePath: "/team-a", uid: 1000, gid: 1000},
+			expectErr: true,
+		},
+		{
+			name:      "Fail: base path not allowed",
+			policies:  p,
+			req:       provisioningRequest{namespace: "team-a", fileSystemId: "fs-abcd1234", basePath: "/team-ab", uid: 1000, gid: 1000},
+			expectErr: true,
+		},
+		{
+			name:      "Fail: uid out of range",
+			policies:  p,
+			req:       provisioningRequest{namespace: "team-a", fileSystemId: "fs-abcd1234", basePath: "/team-a", uid: 999, gid: 1000},
+			expectErr: true,
+		},
+		{
+			name:      "Fail: gid out of range",
+			policies:  p,
+			req:       provisioningRequest{namespace: "team-a", fileSystemId: "fs-abcd1234", basePath: "/team-a", uid: 1000, gid: 2000},
+			expectErr: true,
+		},
+		{
+			name:      "Fail: invalid policy allows nothing",
+			policies:  p,
+			req:       provisioningRequest{namespace: "team-b", fileSystemId: "fs-abcd1234", uid: 1500, gid: 1500},
+			expectErr: true,
+		},
+		{
+			name: "Fail: not synced",
+			policies: &provisioningPolicies{
+				indexer: p.indexer,
+				synced:  func() bool { return false },
+			},
+			req:       provisioningRequest{namespace: "team-c", fileSystemId: "fs-abcd1234"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policies.check(&tc.req)
+			if tc.expectErr && err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnderAnyPath(t *testing.T) {
+	testCases := []struct {
+		paths  []string
+		p      string
+		expect bool
+	}{
+		{paths: []string{"/"}, p: "/anything", expect: true},
+		{paths: []string{"team"}, p: "/team", expect: true},
+		{paths: []string{"/team/"}, p: "team/sub", expect: true},
+		{paths: []string{"/team"}, p: "/teams", expect: false},
+		{paths: []string{"/team"}, p: "/team/../other", expect: false},
+		{paths: []string{"/team"}, p: "", expect: false},
+	}
+
+	for _, tc := range testCases {
+		if got := underAnyPath(tc.paths, tc.p); got != tc.expect {
+			t.Errorf("underAnyPath(%v, %q) = %v, expected %v", tc.paths, tc.p, got, tc.expect)
+		}
+	}
+}
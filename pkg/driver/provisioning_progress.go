@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// ProvisioningEventReason is the reason of the events reporting the progress of slow CreateVolume calls
+	ProvisioningEventReason = "Provisioning"
+
+	provisioningEventTimeout = 10 * time.Second
+)
+
+// provisioningProgress reports the step of a CreateVolume call that is slower than the threshold
+// as an event of its claim, so that users describing the claim see what the driver is waiting for.
+// A nil provisioningProgress is valid and reports nothing.
+type provisioningProgress struct {
+	threshold    time.Duration
+	k8sClient    cloud.KubernetesAPIClient
+	volName      string
+	pvcName      string
+	pvcNamespace string
+	start        time.Time
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// newProvisioningProgress returns the progress of the volume, or nil if the threshold is 0 or the claim
+// of the volume is unknown because the external-provisioner does not pass --extra-create-metadata
+func newProvisioningProgress(threshold time.Duration, k8sClient cloud.KubernetesAPIClient, volName string, volumeParams map[string]string) *provisioningProgress {
+	pvcName, pvcNamespace := volumeParams[PvcName], volumeParams[PvcNamespace]
+	if threshold <= 0 || pvcName == "" || pvcNamespace == "" {
+		return nil
+	}
+	return &provisioningProgress{
+		threshold:    threshold,
+		k8sClient:    k8sClient,
+		volName:      volName,
+		pvcName:      pvcName,
+		pvcNamespace: pvcNamespace,
+		start:        time.Now(),
+	}
+}
+
+// step starts the step of the call, which is reported if it is still running after the threshold
+func (p *provisioningProgress) step(description string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(p.threshold, func() {
+		if err := p.report(description); err != nil {
+			klog.Warningf("Failed to report provisioning progress of volume %v to claim %s/%s: %v", p.volName, p.pvcNamespace, p.pvcName, err)
+		}
+	})
+}
+
+// done stops reporting the progress of the call
+func (p *provisioningProgress) done() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+func (p *provisioningProgress) report(description string) error {
+	clientset, err := p.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), provisioningEventTimeout)
+	defer cancel()
+
+	// The UID of the claim is required for the event to be listed by kubectl describe
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(p.pvcNamespace).Get(ctx, p.pvcName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get claim: %v", err)
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: p.pvcName + ".",
+			Namespace:    p.pvcNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "PersistentVolumeClaim",
+			Namespace:       p.pvcNamespace,
+			Name:            p.pvcName,
+			UID:             pvc.UID,
+			ResourceVersion: pvc.ResourceVersion,
+		},
+		Reason:         ProvisioningEventReason,
+		Message:        fmt.Sprintf("Still provisioning volume %s after %v: %s", p.volName, time.Since(p.start).Round(time.Second), description),
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: driverName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err = clientset.CoreV1().Events(p.pvcNamespace).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewProvisioningProgress(t *testing.T) {
+	params := map[string]string{PvcName: "claim", PvcNamespace: "default"}
+	if p := newProvisioningProgress(0, nil, "pvc-1234", params); p != nil {
+		t.Fatal("Expected no progress without threshold")
+	}
+	if p := newProvisioningProgress(time.Second, nil, "pvc-1234", map[string]string{}); p != nil {
+		t.Fatal("Expected no progress without claim")
+	}
+	if p := newProvisioningProgress(time.Second, nil, "pvc-1234", params); p == nil {
+		t.Fatal("Expected progress")
+	}
+
+	// A nil progress reports nothing
+	var nilProgress *provisioningProgress
+	nilProgress.step("creating access point")
+	nilProgress.done()
+}
+
+func TestProvisioningProgressEvents(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim", UID: "claim-uid"},
+	})
+	k8sClient := func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+	listEvents := func() []corev1.Event {
+		events, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("Failed to list events: %v", err)
+		}
+		return events.Items
+	}
+
+	p := newProvisioningProgress(50*time.Millisecond, k8sClient, "pvc-1234", map[string]string{PvcName: "claim", PvcNamespace: "default"})
+
+	// A step completed before the threshold is not reported
+	p.step("describing file system")
+	p.step("discovering the mount targets of the file system")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(listEvents()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the slow step to be reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.done()
+
+	events := listEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected a single event, got %d", len(events))
+	}
+	event := events[0]
+	if event.Reason != ProvisioningEventReason || event.Type != corev1.EventTypeNormal {
+		t.Fatalf("Expected a normal %s event, got %s %s", ProvisioningEventReason, event.Type, event.Reason)
+	}
+	if event.InvolvedObject.Kind != "PersistentVolumeClaim" || event.InvolvedObject.UID != "claim-uid" {
+		t.Fatalf("Expected the event to refer to the claim, got %+v", event.InvolvedObject)
+	}
+	if !strings.Contains(event.Message, "pvc-1234") || !strings.Contains(event.Message, "discovering the mount targets") {
+		t.Fatalf("Expected the event to describe the slow step, got %q", event.Message)
+	}
+
+	// Nothing is reported once the call is done
+	time.Sleep(100 * time.Millisecond)
+	if len(listEvents()) != 1 {
+		t.Fatal("Expected no event after done")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+// procUserHZ is the unit of the CPU times of /proc/<pid>/stat, fixed to 100 on the supported architectures
+const procUserHZ = 100
+
+var (
+	proxyCPUSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "node", "proxy_cpu_seconds_total"),
+		"User and system CPU time of the efs-proxy or stunnel process of each TLS mount.",
+		[]string{"file_system_id", "mount_point"}, nil,
+	)
+	proxyResidentMemoryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "node", "proxy_resident_memory_bytes"),
+		"Resident memory of the efs-proxy or stunnel process of each TLS mount.",
+		[]string{"file_system_id", "mount_point"}, nil,
+	)
+)
+
+// efsUtilsMountState is the part of the efs-utils state file of a mount used to find its proxy, and the files
+// the watchdog removes with the state once the mount is gone
+type efsUtilsMountState struct {
+	Pid           int      `json:"pid"`
+	MountPoint    string   `json:"mountpoint"`
+	Files         []string `json:"files"`
+	MountStateDir string   `json:"mountStateDir"`
+}
+
+// proxyUsageCollector reports the resource usage of the proxy processes of the mounts of the node at
+// scrape time. The process of a mount is found by the PID of its efs-utils state file, and skipped if it
+// exited or the PID was reused by another command.
+type proxyUsageCollector struct {
+	stateDir string
+	procDir  string
+}
+
+func newProxyUsageCollector(stateDir, procDir string) *proxyUsageCollector {
+	return &proxyUsageCollector{stateDir: stateDir, procDir: procDir}
+}
+
+func (c *proxyUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- proxyCPUSecondsDesc
+	ch <- proxyResidentMemoryDesc
+}
+
+func (c *proxyUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	entries, err := os.ReadDir(c.stateDir)
+	if err != nil {
+		klog.V(4).Infof("Not collecting proxy usage, failed to read efs-utils state directory %s: %v", c.stateDir, err)
+		return
+	}
+	for _, entry := range entries {
+		match := efsUtilsStateFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(c.stateDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		state := &efsUtilsMountState{}
+		if err := json.Unmarshal(content, state); err != nil || state.Pid <= 0 {
+			klog.V(4).Infof("Ignoring efs-utils state %s without proxy PID: %v", entry.Name(), err)
+			continue
+		}
+		mountPoint := state.MountPoint
+		if mountPoint == "" {
+			// Older efs-utils only record the mount point in the name of the state file
+			mountPoint = "/" + strings.ReplaceAll(match[2], ".", "/")
+		}
+		cpuSeconds, rssBytes, err := c.processUsage(state.Pid)
+		if err != nil {
+			klog.V(4).Infof("Ignoring proxy %d of efs-utils state %s: %v", state.Pid, entry.Name(), err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(proxyCPUSecondsDesc, prometheus.CounterValue, cpuSeconds, match[1], mountPoint)
+		ch <- prometheus.MustNewConstMetric(proxyResidentMemoryDesc, prometheus.GaugeValue, rssBytes, match[1], mountPoint)
+	}
+}
+
+// processUsage returns the CPU seconds and resident bytes of the proxy process of the PID
+func (c *proxyUsageCollector) processUsage(pid int) (float64, float64, error) {
+	stat, err := os.ReadFile(filepath.Join(c.procDir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command is between parentheses and may contain spaces, the fields after it are space separated
+	start, end := strings.IndexByte(string(stat), '('), strings.LastIndexByte(string(stat), ')')
+	if start < 0 || end < start {
+		return 0, 0, fmt.Errorf("invalid stat %q", stat)
+	}
+	comm := string(stat[start+1 : end])
+	if comm != "efs-proxy" && !strings.HasPrefix(comm, "stunnel") {
+		return 0, 0, fmt.Errorf("process %q is not a proxy", comm)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	// utime and stime are the 14th and 15th fields, the state after the command being the 3rd
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("invalid stat %q", stat)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	statm, err := os.ReadFile(filepath.Join(c.procDir, strconv.Itoa(pid), "statm"))
+	if err != nil {
+		return 0, 0, err
+	}
+	pages := strings.Fields(string(statm))
+	if len(pages) < 2 {
+		return 0, 0, fmt.Errorf("invalid statm %q", statm)
+	}
+	residentPages, err := strconv.ParseUint(pages[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return float64(utime+stime) / procUserHZ, float64(residentPages * uint64(os.Getpagesize())), nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProxyUsageCollector(t *testing.T) {
+	stateDir, procDir := t.TempDir(), t.TempDir()
+	writeFile := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProcess := func(pid int, comm string, utime, stime, residentPages int) {
+		writeFile(filepath.Join(procDir, fmt.Sprint(pid), "stat"),
+			fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 1 0 100 1000 %d", pid, comm, pid, pid, utime, stime, residentPages))
+		writeFile(filepath.Join(procDir, fmt.Sprint(pid), "statm"), fmt.Sprintf("1000 %d 100 10 0 200 0", residentPages))
+	}
+
+	mountPoint := "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount"
+	writeFile(filepath.Join(stateDir, "fs-abcd1234.var.lib.kubelet.pods.uid.volumes.kubernetes.io~csi.pv-1.mount.20049"),
+		fmt.Sprintf(`{"pid": 101, "mountpoint": %q}`, mountPoint))
+	writeProcess(101, "efs-proxy", 250, 50, 1024)
+	// An older state without mount point, served by stunnel
+	writeFile(filepath.Join(stateDir, "fs-0123beef.mnt.data.20050"), `{"pid": 102}`)
+	writeProcess(102, "stunnel5", 100, 0, 512)
+	// The proxy exited
+	writeFile(filepath.Join(stateDir, "fs-abcd1234.mnt.gone.20051"), `{"pid": 103}`)
+	// The PID was reused by another process
+	writeFile(filepath.Join(stateDir, "fs-abcd1234.mnt.reused.20052"), `{"pid": 104}`)
+	writeProcess(104, "bash", 1, 1, 1)
+	// Not a state file
+	writeFile(filepath.Join(stateDir, "stunnel-config.fs-abcd1234"), `{"pid": 101}`)
+
+	pageSize := os.Getpagesize()
+	expected := fmt.Sprintf(`
+# HELP efs_csi_node_proxy_cpu_seconds_total User and system CPU time of the efs-proxy or stunnel process of each TLS mount.
+# TYPE efs_csi_node_proxy_cpu_seconds_total counter
+efs_csi_node_proxy_cpu_seconds_total{file_system_id="fs-abcd1234",mount_point=%q} 3
+efs_csi_node_proxy_cpu_seconds_total{file_system_id="fs-0123beef",mount_point="/mnt/data"} 1
+# HELP efs_csi_node_proxy_resident_memory_bytes Resident memory of the efs-proxy or stunnel process of each TLS mount.
+# TYPE efs_csi_node_proxy_resident_memory_bytes gauge
+efs_csi_node_proxy_resident_memory_bytes{file_system_id="fs-abcd1234",mount_point=%q} %d
+efs_csi_node_proxy_resident_memory_bytes{file_system_id="fs-0123beef",mount_point="/mnt/data"} %d
+`, mountPoint, mountPoint, 1024*pageSize, 512*pageSize)
+
+	collector := newProxyUsageCollector(stateDir, procDir)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing state directory reports nothing
+	if count := testutil.CollectAndCount(newProxyUsageCollector(filepath.Join(stateDir, "missing"), procDir)); count != 0 {
+		t.Fatalf("Expected no metrics, got %d", count)
+	}
+}
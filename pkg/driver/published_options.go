@@ -0,0 +1,258 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// RemountRequiredEventReason is the reason of the Event recorded on a persistent volume whose mount options or
+	// attributes changed since it was published on the node
+	RemountRequiredEventReason = "RemountRequired"
+
+	// kubeletVolumeContextPrefix prefixes the keys added by the kubelet to the volume context, e.g. the pod info
+	// of podInfoOnMount, which are not attributes of the persistent volume
+	kubeletVolumeContextPrefix = "csi.storage.k8s.io/"
+)
+
+// publishedOptions are the options of the persistent volume with which a target was published
+type publishedOptions struct {
+	volumeName       string
+	mountFlags       []string
+	volumeAttributes map[string]string
+	// reported is the hash of the mount options and attributes of the persistent volume whose drift was
+	// reported, not reported again until they change, whatever other updates the persistent volume gets
+	reported string
+}
+
+// publishedOptionsCheck checks periodically that the mount options and the attributes of the persistent volumes
+// are still the ones with which their targets were published on the node. A volume edited since, e.g. to add a
+// mount option, keeps running with the options of its publish until its pods are restarted, the mounts of the
+// running containers being their own, so the drift is reported instead: the efs_csi_node_drifted_targets metric
+// counts the targets published with stale options, and a RemountRequired Event is recorded on each drifted
+// persistent volume. The targets published before the node plugin started are only checked if restored from
+// the node state. A nil publishedOptionsCheck is valid and checks nothing.
+type publishedOptionsCheck struct {
+	interval  time.Duration
+	nodeName  string
+	k8sClient cloud.KubernetesAPIClient
+
+	mu      sync.Mutex
+	targets map[string]*publishedOptions
+}
+
+// newPublishedOptionsCheck returns the check of the interval, or nil if the interval is 0
+func newPublishedOptionsCheck(interval time.Duration, nodeName string, k8sClient cloud.KubernetesAPIClient) *publishedOptionsCheck {
+	if interval <= 0 {
+		return nil
+	}
+	return &publishedOptionsCheck{
+		interval:  interval,
+		nodeName:  nodeName,
+		k8sClient: k8sClient,
+		targets:   map[string]*publishedOptions{},
+	}
+}
+
+// add records the options of the publish request, if its target is the one of a persistent volume
+func (c *publishedOptionsCheck) add(req *csi.NodePublishVolumeRequest) {
+	c.track(req.GetTargetPath(), req.GetVolumeCapability().GetMount().GetMountFlags(), req.GetVolumeContext())
+}
+
+// track records the mount flags and the volume context with which the target was published
+func (c *publishedOptionsCheck) track(target string, mountFlags []string, volumeContext map[string]string) {
+	if c == nil {
+		return
+	}
+	volumeName := volumeNameFromTargetPath(target)
+	if volumeName == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets[target] = &publishedOptions{
+		volumeName:       volumeName,
+		mountFlags:       sortedMountFlags(mountFlags),
+		volumeAttributes: volumeAttributes(volumeContext),
+	}
+}
+
+// remove forgets the target once unpublished
+func (c *publishedOptionsCheck) remove(target string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.targets, target)
+}
+
+func (c *publishedOptionsCheck) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.poll(context.Background()); err != nil {
+				klog.Warningf("Failed to check the options of the published volumes: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// poll compares the options of the published targets with their persistent volumes
+func (c *publishedOptionsCheck) poll(ctx context.Context) error {
+	clientset, err := c.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	c.mu.Lock()
+	byVolume := map[string]map[string]*publishedOptions{}
+	for target, options := range c.targets {
+		if byVolume[options.volumeName] == nil {
+			byVolume[options.volumeName] = map[string]*publishedOptions{}
+		}
+		byVolume[options.volumeName][target] = options
+	}
+	c.mu.Unlock()
+
+	drifted := 0
+	for volumeName, targets := range byVolume {
+		pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, volumeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get persistent volume %s: %v", volumeName, err)
+		}
+		var stale []string
+		report := false
+		hash := optionsHash(pv)
+		c.mu.Lock()
+		for target, options := range targets {
+			if !options.drifted(pv) {
+				options.reported = ""
+				continue
+			}
+			stale = append(stale, target)
+			if options.reported != hash {
+				options.reported = hash
+				report = true
+			}
+		}
+		c.mu.Unlock()
+		drifted += len(stale)
+		if len(stale) == 0 {
+			continue
+		}
+		klog.Warningf("Persistent volume %s changed since its targets %v were published, restart their pods to remount them with mount options %v", volumeName, stale, pv.Spec.MountOptions)
+		if report {
+			c.recordEvent(ctx, clientset, pv, len(stale))
+		}
+	}
+	driftedTargets.Set(float64(drifted))
+	return nil
+}
+
+// optionsHash returns the hash of the mount options and the attributes of the persistent volume
+func optionsHash(pv *corev1.PersistentVolume) string {
+	var attributes map[string]string
+	if pv.Spec.CSI != nil {
+		attributes = pv.Spec.CSI.VolumeAttributes
+	}
+	// The keys of maps are encoded sorted
+	options, _ := json.Marshal(struct {
+		MountOptions []string
+		Attributes   map[string]string
+	}{sortedMountFlags(pv.Spec.MountOptions), volumeAttributes(attributes)})
+	return get64LenHash(string(options))
+}
+
+// drifted returns whether the mount options or the attributes of the persistent volume changed since the publish
+func (o *publishedOptions) drifted(pv *corev1.PersistentVolume) bool {
+	var attributes map[string]string
+	if pv.Spec.CSI != nil {
+		attributes = pv.Spec.CSI.VolumeAttributes
+	}
+	return !reflect.DeepEqual(o.mountFlags, sortedMountFlags(pv.Spec.MountOptions)) || !reflect.DeepEqual(o.volumeAttributes, volumeAttributes(attributes))
+}
+
+func (c *publishedOptionsCheck) recordEvent(ctx context.Context, clientset kubernetes.Interface, pv *corev1.PersistentVolume, targets int) {
+	now := metav1.Now()
+	// Events of cluster scoped objects are stored in the default namespace
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pv.Name + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "PersistentVolume",
+			Name:            pv.Name,
+			UID:             pv.UID,
+			ResourceVersion: pv.ResourceVersion,
+		},
+		Reason:         RemountRequiredEventReason,
+		Message:        fmt.Sprintf("The mount options or attributes of volume %s changed since %d of its targets were published on node %s, which keep the previous ones: restart their pods to remount them", pv.Name, targets, c.nodeName),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: driverName, Host: c.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := clientset.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		klog.Warningf("Failed to record the %s Event of persistent volume %s: %v", RemountRequiredEventReason, pv.Name, err)
+	}
+}
+
+// sortedMountFlags returns the mount flags sorted, an empty list if there are none
+func sortedMountFlags(flags []string) []string {
+	sorted := append([]string{}, flags...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// volumeAttributes returns the attributes of the persistent volume in the volume context, an empty map if
+// there are none
+func volumeAttributes(volumeContext map[string]string) map[string]string {
+	attributes := map[string]string{}
+	for k, v := range volumeContext {
+		if !strings.HasPrefix(k, kubeletVolumeContextPrefix) {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
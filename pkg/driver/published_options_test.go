@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testPublishedTarget = "/var/lib/kubelet/pods/uid-1/volumes/kubernetes.io~csi/pv-1/mount"
+
+func newPublishRequest(target string, mountFlags []string, volumeContext map[string]string) *csi.NodePublishVolumeRequest {
+	return &csi.NodePublishVolumeRequest{
+		VolumeId:   "fs-abcd1234::fsap-abcd1234",
+		TargetPath: target,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: mountFlags}},
+		},
+		VolumeContext: volumeContext,
+	}
+}
+
+func TestNewPublishedOptionsCheck(t *testing.T) {
+	if c := newPublishedOptionsCheck(0, "node-1", nil); c != nil {
+		t.Errorf("Expected no check without interval, got %v", c)
+	}
+	var disabled *publishedOptionsCheck
+	disabled.add(newPublishRequest(testPublishedTarget, nil, nil))
+	disabled.remove(testPublishedTarget)
+}
+
+func TestPublishedOptionsCheck(t *testing.T) {
+	pv := newAccessPointPV("pv-1", "fs-abcd1234::fsap-abcd1234", "team-a", "data")
+	pv.ResourceVersion = "1"
+	pv.Spec.MountOptions = []string{"tls", "iam"}
+	pv.Spec.CSI.VolumeAttributes = map[string]string{"encryptInTransit": "true"}
+	clientset := fake.NewSimpleClientset(pv)
+	check := newPublishedOptionsCheck(time.Minute, "node-1", func() (kubernetes.Interface, error) { return clientset, nil })
+	ctx := context.Background()
+
+	// The pod info added by the kubelet is not an attribute of the persistent volume
+	check.add(newPublishRequest(testPublishedTarget, []string{"iam", "tls"}, map[string]string{"encryptInTransit": "true", "csi.storage.k8s.io/pod.name": "app"}))
+	// The targets of inline volumes have no persistent volume
+	check.add(newPublishRequest("/var/lib/kubelet/pods/uid-2/volumes/kubernetes.io~csi/inline/mount", []string{"tls"}, nil))
+
+	poll := func(expectedDrifted float64, expectedEvents int) {
+		t.Helper()
+		if err := check.poll(ctx); err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+		if drifted := testutil.ToFloat64(driftedTargets); drifted != expectedDrifted {
+			t.Fatalf("Expected %v drifted targets, got %v", expectedDrifted, drifted)
+		}
+		// The fake clientset does not generate the names of the events, so their creations are counted instead
+		var events []*corev1.Event
+		for _, action := range clientset.Actions() {
+			if create, ok := action.(k8stesting.CreateAction); ok && action.GetResource().Resource == "events" {
+				events = append(events, create.GetObject().(*corev1.Event))
+			}
+		}
+		if len(events) != expectedEvents {
+			t.Fatalf("Expected %d events, got %v", expectedEvents, events)
+		}
+		for _, event := range events {
+			if event.Namespace != metav1.NamespaceDefault || event.Reason != RemountRequiredEventReason || event.InvolvedObject.Kind != "PersistentVolume" || event.InvolvedObject.Name != "pv-1" || event.Type != corev1.EventTypeWarning {
+				t.Fatalf("Unexpected event %+v", event)
+			}
+		}
+	}
+	update := func(resourceVersion string, mountOptions []string) {
+		t.Helper()
+		pv.ResourceVersion = resourceVersion
+		pv.Spec.MountOptions = mountOptions
+		if _, err := clientset.CoreV1().PersistentVolumes().Update(ctx, pv, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	poll(0, 0)
+	update("2", []string{"tls", "iam", "noresvport"})
+	poll(1, 1)
+	// The drift of a version of the persistent volume is reported once
+	poll(1, 1)
+	// Updates of the persistent volume that keep its options, e.g. of its status or labels, are not reported
+	update("2a", []string{"noresvport", "iam", "tls"})
+	poll(1, 1)
+	update("3", []string{"tls", "noresvport"})
+	poll(1, 2)
+	update("4", []string{"iam", "tls"})
+	poll(0, 2)
+	update("5", []string{"tls"})
+	check.remove(testPublishedTarget)
+	poll(0, 2)
+}
+
+func TestPublishedOptionsRestoredFromNodeState(t *testing.T) {
+	pv := newAccessPointPV("pv-1", "fs-abcd1234::fsap-abcd1234", "team-a", "data")
+	pv.Spec.MountOptions = []string{"tls", "noresvport"}
+	clientset := fake.NewSimpleClientset(pv)
+	check := newPublishedOptionsCheck(time.Minute, "node-1", func() (kubernetes.Interface, error) { return clientset, nil })
+
+	state := newNodeState(t.TempDir() + "/state.json")
+	state.add(newPublishRequest(testPublishedTarget, []string{"tls"}, nil), testPublishedTarget)
+	published, _ := state.lookup(testPublishedTarget)
+	check.track(testPublishedTarget, published.MountFlags, published.VolumeContext)
+
+	if err := check.poll(context.Background()); err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if drifted := testutil.ToFloat64(driftedTargets); drifted != 1 {
+		t.Fatalf("Expected the restored target to be drifted, got %v drifted targets", drifted)
+	}
+}
@@ -0,0 +1,436 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	QuotaEnforcementEvent    = "event"
+	QuotaEnforcementReadOnly = "read-only"
+
+	// QuotaExceededAnnotation holds the bytes used by a persistent volume over the capacity requested by its
+	// claim, with the read-only quota enforcement. The nodes publish the annotated volumes read-only.
+	QuotaExceededAnnotation  = "efs.csi.aws.com/quota-exceeded"
+	QuotaExceededEventReason = "QuotaExceeded"
+
+	// csiVolumesDir is the directory of the kubelet holding the directory of every CSI volume of a pod, named
+	// after its persistent volume, in which the volume is published at the mount target path
+	csiVolumesDir = "kubernetes.io~csi"
+
+	// quotaEnforcementLeaseName is the name of the Lease electing the controller replica enforcing the quotas
+	quotaEnforcementLeaseName = "efs-csi-quota-enforcement"
+)
+
+// quotaEnforcer enforces the capacity requested by the claims of the volumes of the dedicated access points
+// created by the driver, EFS having no quota. Once per interval, the controller mounts the file systems and
+// sums the size of the files under the root directory of every access point. The volumes using more than the
+// capacity of their claim are reported in a warning Event of the claim and, in the read-only mode, annotated
+// with QuotaExceededAnnotation so that the nodes publish them read-only to the pods started from then on.
+// The pods already running keep writing to their volume until they are restarted. Only the controller replica
+// holding the lease enforces the quotas, and the Event of a claim is updated on every scan instead of repeated.
+type quotaEnforcer struct {
+	mode      string
+	interval  time.Duration
+	k8sClient cloud.KubernetesAPIClient
+	lease     *leaderLease
+	// reported are the persistent volumes whose usage is exported in volumeUsageBytes
+	reported map[string]bool
+}
+
+// newQuotaEnforcer returns the enforcer of the mode, or nil if the mode is empty
+func newQuotaEnforcer(mode string, interval time.Duration, k8sClient cloud.KubernetesAPIClient) (*quotaEnforcer, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case QuotaEnforcementEvent, QuotaEnforcementReadOnly:
+	default:
+		return nil, fmt.Errorf("invalid quota enforcement %q, must be one of %s or %s", mode, QuotaEnforcementEvent, QuotaEnforcementReadOnly)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("quota enforcement requires a positive quota-enforcement-interval, got %v", interval)
+	}
+	// The lease outlives a scan taking longer than the interval
+	return &quotaEnforcer{
+		mode:      mode,
+		interval:  interval,
+		k8sClient: k8sClient,
+		lease:     newLeaderLease(quotaEnforcementLeaseName, 2*interval, k8sClient),
+		reported:  map[string]bool{},
+	}, nil
+}
+
+// run enforces the quotas once per interval until stopCh is closed
+func (e *quotaEnforcer) run(d *Driver, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.poll(context.Background(), d); err != nil {
+			klog.Warningf("Failed to enforce volume quotas: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// quotaVolume is a volume of a dedicated access point whose claim requests a capacity
+type quotaVolume struct {
+	pv            *corev1.PersistentVolume
+	pvc           *corev1.PersistentVolumeClaim
+	accessPointId string
+	capacity      int64
+}
+
+func (e *quotaEnforcer) poll(ctx context.Context, d *Driver) error {
+	leader, err := e.lease.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	if !leader {
+		// The usage is exported by the leader only
+		klog.V(4).Infof("Not enforcing volume quotas, another controller holds lease %s", quotaEnforcementLeaseName)
+		e.forget(nil)
+		return nil
+	}
+	clientset, err := e.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volume claims: %v", err)
+	}
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list storage classes: %v", err)
+	}
+
+	claims := map[string]*corev1.PersistentVolumeClaim{}
+	for idx := range pvcs.Items {
+		pvc := &pvcs.Items[idx]
+		claims[pvc.Namespace+"/"+pvc.Name] = pvc
+	}
+	storageClasses := map[string]*storagev1.StorageClass{}
+	for idx := range scs.Items {
+		storageClasses[scs.Items[idx].Name] = &scs.Items[idx]
+	}
+
+	volumes := map[string][]*quotaVolume{}
+	fileSystemStorageClasses := map[string]*storagev1.StorageClass{}
+	quotaVolumes := map[string]bool{}
+	for idx := range pvs.Items {
+		pv := &pvs.Items[idx]
+		volume, fsId := newQuotaVolume(pv, claims)
+		if volume == nil {
+			continue
+		}
+		quotaVolumes[pv.Name] = true
+		volumes[fsId] = append(volumes[fsId], volume)
+		if sc, ok := storageClasses[pv.Spec.StorageClassName]; ok && fileSystemStorageClasses[fsId] == nil {
+			fileSystemStorageClasses[fsId] = sc
+		}
+	}
+
+	for fsId, fsVolumes := range volumes {
+		// The volumes of a deleted storage class are scanned with the EFS API client of the driver
+		sc := fileSystemStorageClasses[fsId]
+		if sc == nil {
+			sc = &storagev1.StorageClass{}
+		}
+		usages, err := e.scan(ctx, d, fsId, sc, fsVolumes)
+		if err != nil {
+			klog.Warningf("Failed to enforce the quotas of the volumes of file system %s: %v", fsId, err)
+			continue
+		}
+		for _, volume := range fsVolumes {
+			if usage, ok := usages[volume.accessPointId]; ok {
+				e.enforce(ctx, clientset, volume, usage)
+			}
+		}
+	}
+	e.forget(quotaVolumes)
+	return nil
+}
+
+// forget deletes the usage of the persistent volumes that are not in volumes, e.g. deleted or unbound
+func (e *quotaEnforcer) forget(volumes map[string]bool) {
+	for pvName := range e.reported {
+		if !volumes[pvName] {
+			volumeUsageBytes.DeleteLabelValues(pvName)
+			delete(e.reported, pvName)
+		}
+	}
+}
+
+// newQuotaVolume returns the volume of the persistent volume with its file system, or nil if the persistent
+// volume is not the volume of a dedicated access point bound to a claim requesting a capacity
+func newQuotaVolume(pv *corev1.PersistentVolume, claims map[string]*corev1.PersistentVolumeClaim) (*quotaVolume, string) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName || pv.Spec.ClaimRef == nil {
+		return nil, ""
+	}
+	fsId, subpath, apId, err := parseVolumeId(pv.Spec.CSI.VolumeHandle)
+	if err != nil || apId == "" || subpath != "" {
+		return nil, ""
+	}
+	pvc, ok := claims[pv.Spec.ClaimRef.Namespace+"/"+pv.Spec.ClaimRef.Name]
+	if !ok || pvc.Spec.VolumeName != pv.Name {
+		return nil, ""
+	}
+	capacity, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if !ok || capacity.Value() <= 0 {
+		return nil, ""
+	}
+	return &quotaVolume{pv: pv, pvc: pvc, accessPointId: apId, capacity: capacity.Value()}, fsId
+}
+
+// scan mounts the root of the file system and returns the bytes used under the root directory of the access
+// point of every volume, by access point
+func (e *quotaEnforcer) scan(ctx context.Context, d *Driver, fileSystemId string, sc *storagev1.StorageClass, volumes []*quotaVolume) (map[string]int64, error) {
+	localCloud, err := d.storageClassCloud(sc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EFS API client: %v", err)
+	}
+	accessPoints, err := localCloud.ListAccessPoints(ctx, fileSystemId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access points: %v", err)
+	}
+	rootDirs := map[string]string{}
+	for _, ap := range accessPoints {
+		rootDirs[ap.AccessPointId] = ap.AccessPointRootDir
+	}
+
+	apiConfig, err := storageClassAPIConfig(sc.Parameters, d.fileSystemAliases)
+	if err != nil {
+		return nil, err
+	}
+	mountOptions := d.rootMountOptions(ctx, localCloud, fileSystemId, "", apiConfig.Region, false)
+	target := TempMountPathPrefix + "/quota-enforcement-" + fileSystemId
+	usages := map[string]int64{}
+	err = d.withTempMount(ctx, fileSystemId, target, mountOptions, func(ctx context.Context, target string) error {
+		for _, volume := range volumes {
+			rootDir, ok := rootDirs[volume.accessPointId]
+			if !ok {
+				klog.V(4).Infof("Access point %s of persistent volume %s not found, not enforcing its quota", volume.accessPointId, volume.pv.Name)
+				continue
+			}
+			usage, err := directoryUsage(ctx, filepath.Join(target, rootDir))
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				klog.Warningf("Failed to compute the usage of persistent volume %s: %v", volume.pv.Name, err)
+				continue
+			}
+			usages[volume.accessPointId] = usage
+		}
+		return nil
+	})
+	return usages, err
+}
+
+// directoryUsage returns the sum of the sizes of the regular files under the path, without following symlinks
+func directoryUsage(ctx context.Context, path string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if info.Mode().IsRegular() {
+		return info.Size(), nil
+	}
+	if !info.IsDir() {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var usage int64
+	for _, entry := range entries {
+		n, err := directoryUsage(ctx, filepath.Join(path, entry.Name()))
+		if err != nil {
+			return usage, err
+		}
+		usage += n
+	}
+	return usage, nil
+}
+
+// enforce records the usage of the volume, reports it if over the capacity of its claim and, in the read-only
+// mode, annotates the persistent volume with it. The annotation is removed once the volume is back under.
+func (e *quotaEnforcer) enforce(ctx context.Context, clientset kubernetes.Interface, volume *quotaVolume, usage int64) {
+	pv, pvc := volume.pv, volume.pvc
+	volumeUsageBytes.WithLabelValues(pv.Name).Set(float64(usage))
+	e.reported[pv.Name] = true
+	exceeded := usage > volume.capacity
+	if exceeded {
+		message := fmt.Sprintf("Persistent volume %s uses %d bytes, over the %d bytes requested by the claim", pv.Name, usage, volume.capacity)
+		if e.mode == QuotaEnforcementReadOnly {
+			message += ", it is published read-only to the pods started from now on"
+		}
+		klog.Warningf("%s %s/%s", message, pvc.Namespace, pvc.Name)
+		e.recordEvent(ctx, clientset, pvc, message)
+	}
+
+	value, annotated := pv.Annotations[QuotaExceededAnnotation]
+	var annotation interface{}
+	switch {
+	case exceeded && e.mode == QuotaEnforcementReadOnly:
+		if value == strconv.FormatInt(usage, 10) {
+			return
+		}
+		annotation = strconv.FormatInt(usage, 10)
+	case annotated:
+		klog.Infof("Persistent volume %s is back under the capacity of its claim, %d bytes used", pv.Name, usage)
+	default:
+		return
+	}
+	// A null annotation removes it
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{QuotaExceededAnnotation: annotation},
+		},
+	})
+	if err != nil {
+		klog.Warningf("Failed to annotate persistent volume %s: %v", pv.Name, err)
+		return
+	}
+	if _, err := clientset.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.Warningf("Failed to annotate persistent volume %s: %v", pv.Name, err)
+	}
+}
+
+// recordEvent records a warning Event on the claim, where the users of the volume look. The claim has a single
+// QuotaExceeded Event, whose count and message are updated on every scan finding the volume over its capacity.
+func (e *quotaEnforcer) recordEvent(ctx context.Context, clientset kubernetes.Interface, pvc *corev1.PersistentVolumeClaim, message string) {
+	now := metav1.Now()
+	events := clientset.CoreV1().Events(pvc.Namespace)
+	name := pvc.Name + "." + strings.ToLower(QuotaExceededEventReason)
+	event, err := events.Get(ctx, name, metav1.GetOptions{})
+	if err == nil && event.InvolvedObject.UID == pvc.UID {
+		event.Message = message
+		event.LastTimestamp = now
+		event.Count++
+		if _, err := events.Update(ctx, event, metav1.UpdateOptions{}); err != nil {
+			klog.Warningf("Failed to record the %s Event of claim %s/%s: %v", QuotaExceededEventReason, pvc.Namespace, pvc.Name, err)
+		}
+		return
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("Failed to record the %s Event of claim %s/%s: %v", QuotaExceededEventReason, pvc.Namespace, pvc.Name, err)
+		return
+	}
+	// The Event of a deleted claim of the same name is replaced
+	replaced := err == nil
+	event = &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pvc.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "PersistentVolumeClaim",
+			Namespace:  pvc.Namespace,
+			Name:       pvc.Name,
+			UID:        pvc.UID,
+		},
+		Reason:         QuotaExceededEventReason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: driverName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if replaced {
+		_, err = events.Update(ctx, event, metav1.UpdateOptions{})
+	} else {
+		_, err = events.Create(ctx, event, metav1.CreateOptions{})
+	}
+	if err != nil {
+		klog.Warningf("Failed to record the %s Event of claim %s/%s: %v", QuotaExceededEventReason, pvc.Namespace, pvc.Name, err)
+	}
+}
+
+// publishReadOnly returns whether the node must publish the volume at the target read-only, its persistent
+// volume being annotated with QuotaExceededAnnotation in the read-only mode. The volume is published
+// read-write if its persistent volume cannot be found, so that the enforcement never blocks the pods.
+func (e *quotaEnforcer) publishReadOnly(ctx context.Context, target string) bool {
+	if e == nil || e.mode != QuotaEnforcementReadOnly {
+		return false
+	}
+	pvName := volumeNameFromTargetPath(target)
+	if pvName == "" {
+		return false
+	}
+	clientset, err := e.k8sClient()
+	if err != nil {
+		klog.Warningf("NodePublishVolume: not enforcing the quota of %s: failed to create Kubernetes client: %v", pvName, err)
+		return false
+	}
+	pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("NodePublishVolume: not enforcing the quota of %s: %v", pvName, err)
+		return false
+	}
+	_, exceeded := pv.Annotations[QuotaExceededAnnotation]
+	return exceeded
+}
+
+// volumeNameFromTargetPath returns the name of the persistent volume of the target path of the kubelet,
+// .../pods/<pod uid>/volumes/kubernetes.io~csi/<persistent volume>/mount, or an empty string for other paths
+func volumeNameFromTargetPath(target string) string {
+	target = filepath.Clean(target)
+	volumeDir := filepath.Dir(target)
+	if filepath.Base(target) != "mount" || filepath.Base(filepath.Dir(volumeDir)) != csiVolumesDir {
+		return ""
+	}
+	return filepath.Base(volumeDir)
+}
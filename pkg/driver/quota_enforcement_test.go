@@ -0,0 +1,330 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newQuotaClaim(namespace, name, volumeName, capacity string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			VolumeName: volumeName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+			},
+		},
+	}
+}
+
+func TestNewQuotaEnforcer(t *testing.T) {
+	if e, err := newQuotaEnforcer("", 0, nil); e != nil || err != nil {
+		t.Errorf("Expected no enforcer without mode, got %v: %v", e, err)
+	}
+	if _, err := newQuotaEnforcer("block", time.Hour, nil); err == nil {
+		t.Errorf("Expected an error for an invalid mode")
+	}
+	if _, err := newQuotaEnforcer(QuotaEnforcementEvent, 0, nil); err == nil {
+		t.Errorf("Expected an error without interval")
+	}
+	if e, err := newQuotaEnforcer(QuotaEnforcementReadOnly, time.Hour, nil); e == nil || err != nil {
+		t.Errorf("Expected an enforcer, got %v: %v", e, err)
+	}
+}
+
+func TestNewQuotaVolume(t *testing.T) {
+	claims := map[string]*corev1.PersistentVolumeClaim{
+		"team-a/data":   newQuotaClaim("team-a", "data", "pv-1", "1Gi"),
+		"team-b/other":  newQuotaClaim("team-b", "other", "pv-other", "1Gi"),
+		"team-c/static": newQuotaClaim("team-c", "static", "pv-3", "1Gi"),
+	}
+	testCases := []struct {
+		name       string
+		pv         *corev1.PersistentVolume
+		expectedAP string
+	}{
+		{
+			name:       "Success: dedicated access point",
+			pv:         newAccessPointPV("pv-1", "fs-abcd1234::fsap-abcd1234", "team-a", "data"),
+			expectedAP: "fsap-abcd1234",
+		},
+		{
+			name: "Skipped: claim bound to another volume",
+			pv:   newAccessPointPV("pv-2", "fs-abcd1234::fsap-efgh5678", "team-b", "other"),
+		},
+		{
+			name: "Skipped: static volume",
+			pv:   newAccessPointPV("pv-3", "fs-abcd1234", "team-c", "static"),
+		},
+		{
+			name: "Skipped: volume of a shared access point",
+			pv:   newAccessPointPV("pv-1", "fs-abcd1234:/team-a/data:fsap-abcd1234", "team-a", "data"),
+		},
+		{
+			name: "Skipped: claim not found",
+			pv:   newAccessPointPV("pv-4", "fs-abcd1234::fsap-abcd1234", "team-d", "deleted"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			volume, fsId := newQuotaVolume(tc.pv, claims)
+			if tc.expectedAP == "" {
+				if volume != nil {
+					t.Fatalf("Expected no volume, got %+v", volume)
+				}
+				return
+			}
+			if volume == nil || volume.accessPointId != tc.expectedAP || fsId != "fs-abcd1234" || volume.capacity != 1<<30 {
+				t.Fatalf("Unexpected volume %+v of file system %s", volume, fsId)
+			}
+		})
+	}
+}
+
+func TestDirectoryUsage(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "nested", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, size := range map[string]int{"a": 100, "nested/b": 20, "nested/dir/c": 3} {
+		if err := os.WriteFile(filepath.Join(root, path), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Symlinks are not followed
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "nested", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := directoryUsage(context.Background(), root)
+	if err != nil || usage != 123 {
+		t.Fatalf("Expected usage 123, got %d: %v", usage, err)
+	}
+	if usage, err := directoryUsage(context.Background(), filepath.Join(root, "missing")); err != nil || usage != 0 {
+		t.Fatalf("Expected no usage of a missing directory, got %d: %v", usage, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := directoryUsage(ctx, root); err == nil {
+		t.Fatalf("Expected an error with a canceled context")
+	}
+}
+
+func TestQuotaEnforcerEnforce(t *testing.T) {
+	testCases := []struct {
+		name               string
+		mode               string
+		annotation         string
+		usage              int64
+		expectEvent        bool
+		expectedAnnotation string
+	}{
+		{
+			name:  "Success: under quota",
+			mode:  QuotaEnforcementReadOnly,
+			usage: 512,
+		},
+		{
+			name:        "Success: over quota reported",
+			mode:        QuotaEnforcementEvent,
+			usage:       2048,
+			expectEvent: true,
+		},
+		{
+			name:               "Success: over quota annotated",
+			mode:               QuotaEnforcementReadOnly,
+			usage:              2048,
+			expectEvent:        true,
+			expectedAnnotation: "2048",
+		},
+		{
+			name:       "Success: back under quota",
+			mode:       QuotaEnforcementReadOnly,
+			annotation: "2048",
+			usage:      512,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pv := newAccessPointPV("pv-1", "fs-abcd1234::fsap-abcd1234", "team-a", "data")
+			if tc.annotation != "" {
+				pv.Annotations = map[string]string{QuotaExceededAnnotation: tc.annotation}
+			}
+			pvc := newQuotaClaim("team-a", "data", "pv-1", "1Ki")
+			clientset := fake.NewSimpleClientset(pv, pvc)
+			enforcer, err := newQuotaEnforcer(tc.mode, time.Hour, func() (kubernetes.Interface, error) { return clientset, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			enforcer.enforce(ctx, clientset, &quotaVolume{pv: pv, pvc: pvc, accessPointId: "fsap-abcd1234", capacity: 1024}, tc.usage)
+
+			events, err := clientset.CoreV1().Events("team-a").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectEvent != (len(events.Items) == 1) {
+				t.Fatalf("Expected event %v, got %v", tc.expectEvent, events.Items)
+			}
+			if tc.expectEvent && (events.Items[0].Reason != QuotaExceededEventReason || events.Items[0].InvolvedObject.Name != "data") {
+				t.Fatalf("Unexpected event %+v", events.Items[0])
+			}
+			updated, err := clientset.CoreV1().PersistentVolumes().Get(ctx, "pv-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value := updated.Annotations[QuotaExceededAnnotation]; value != tc.expectedAnnotation {
+				t.Fatalf("Expected annotation %q, got %q", tc.expectedAnnotation, value)
+			}
+			if enforcer.publishReadOnly(ctx, "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount") != (tc.expectedAnnotation != "") {
+				t.Fatalf("Expected the volume to be published read-only only if annotated")
+			}
+		})
+	}
+}
+
+func TestQuotaEnforcerPublishReadOnly(t *testing.T) {
+	pv := newAccessPointPV("pv-1", "fs-abcd1234::fsap-abcd1234", "team-a", "data")
+	pv.Annotations = map[string]string{QuotaExceededAnnotation: "2048"}
+	clientset := fake.NewSimpleClientset(pv)
+	k8sClient := func() (kubernetes.Interface, error) { return clientset, nil }
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		mode     string
+		target   string
+		expected bool
+	}{
+		{
+			name:     "Read-only: annotated volume",
+			mode:     QuotaEnforcementReadOnly,
+			target:   "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount",
+			expected: true,
+		},
+		{
+			name:   "Read-write: event mode",
+			mode:   QuotaEnforcementEvent,
+			target: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount",
+		},
+		{
+			name:   "Read-write: volume not found",
+			mode:   QuotaEnforcementReadOnly,
+			target: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-2/mount",
+		},
+		{
+			name:   "Read-write: target outside of the kubelet",
+			mode:   QuotaEnforcementReadOnly,
+			target: "/mnt/pv-1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			enforcer, err := newQuotaEnforcer(tc.mode, time.Hour, k8sClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if readOnly := enforcer.publishReadOnly(ctx, tc.target); readOnly != tc.expected {
+				t.Fatalf("Expected read-only %v, got %v", tc.expected, readOnly)
+			}
+		})
+	}
+
+	var disabled *quotaEnforcer
+	if disabled.publishReadOnly(ctx, "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount") {
+		t.Fatalf("Expected no read-only publish without quota enforcement")
+	}
+}
+
+func TestVolumeNameFromTargetPath(t *testing.T) {
+	for target, expected := range map[string]string{
+		"/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount":  "pv-1",
+		"/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount/": "pv-1",
+		"/var/lib/kubelet/pods/uid/volumes/kubernetes.io~nfs/pv-1/mount":  "",
+		"/var/lib/kubelet/plugins/efs.csi.aws.com/staging/pv-1":           "",
+	} {
+		if name := volumeNameFromTargetPath(target); name != expected {
+			t.Errorf("Expected volume %q of %s, got %q", expected, target, name)
+		}
+	}
+}
+
+func TestQuotaEnforcerPoll(t *testing.T) {
+	pv := newAccessPointPV("pv-stale", "fs-abcd1234::fsap-abcd1234", "team-a", "data")
+	pvc := newQuotaClaim("team-a", "data", "pv-stale", "1Ki")
+	clientset := fake.NewSimpleClientset(pv, pvc)
+	enforcer, err := newQuotaEnforcer(QuotaEnforcementEvent, time.Hour, func() (kubernetes.Interface, error) { return clientset, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer.lease.identity = "controller-a"
+
+	ctx := context.Background()
+	series := testutil.CollectAndCount(volumeUsageBytes)
+	volume := &quotaVolume{pv: pv, pvc: pvc, accessPointId: "fsap-abcd1234", capacity: 1024}
+	enforcer.enforce(ctx, clientset, volume, 2048)
+	enforcer.enforce(ctx, clientset, volume, 4096)
+	events, err := clientset.CoreV1().Events("team-a").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 || events.Items[0].Count != 2 || !strings.Contains(events.Items[0].Message, "4096 bytes") {
+		t.Fatalf("Expected a single Event of count 2, got %+v", events.Items)
+	}
+	if count := testutil.CollectAndCount(volumeUsageBytes); count != series+1 {
+		t.Fatalf("Expected %d usage series, got %d", series+1, count)
+	}
+
+	// The usage of a deleted persistent volume is deleted
+	if err := clientset.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enforcer.poll(ctx, nil); err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if count := testutil.CollectAndCount(volumeUsageBytes); count != series {
+		t.Fatalf("Expected %d usage series, got %d", series, count)
+	}
+
+	// Another replica does not enforce the quotas while the lease is held
+	other, err := newQuotaEnforcer(QuotaEnforcementEvent, time.Hour, func() (kubernetes.Interface, error) { return clientset, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.lease.identity = "controller-b"
+	other.enforce(ctx, clientset, volume, 2048)
+	if err := other.poll(ctx, nil); err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if count := testutil.CollectAndCount(volumeUsageBytes); count != series || len(other.reported) != 0 {
+		t.Fatalf("Expected the usage of the replica not holding the lease deleted, got %d series", count)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// throttledRetryDelay is suggested when the EFS API still throttles the calls after the retries of
+	// the SDK, longer than their backoff so that the provisioning requests do not retry in lockstep
+	throttledRetryDelay = 30 * time.Second
+	// exhaustedRetryDelay is suggested when the access points or GIDs of the file system are exhausted,
+	// which only deleting volumes solves
+	exhaustedRetryDelay = 5 * time.Minute
+)
+
+// errorWithRetryDelay returns the status error of the code and message with a RetryInfo detail suggesting the
+// delay before retrying, for the clients reading the details of the status. The delay is also appended to the
+// message for human readers.
+func errorWithRetryDelay(code codes.Code, delay time.Duration, format string, a ...interface{}) error {
+	st := status.New(code, fmt.Sprintf("%s, retry in %v", fmt.Sprintf(format, a...), delay))
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		klog.Warningf("Could not add the retry delay to the error %q: %v", st.Message(), err)
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// SecretsManagerPrefix marks a value of the CSI secrets as the ARN of an AWS Secrets Manager secret
+// holding the actual value, e.g. awsRoleArn: secretsmanager:arn:aws:secretsmanager:us-east-1:111122223333:secret:efs-role
+const SecretsManagerPrefix = "secretsmanager:"
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// secretsResolver replaces the values of the CSI secrets that reference a Secrets Manager secret by
+// the value of the secret. Values are cached for ttl, so that rotated secrets are picked up without
+// calling Secrets Manager on every request. A nil secretsResolver is valid and resolves nothing.
+type secretsResolver struct {
+	secretsManager cloud.SecretsManager
+	ttl            time.Duration
+	now            func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+func newSecretsResolver(secretsManager cloud.SecretsManager, ttl time.Duration) *secretsResolver {
+	return &secretsResolver{
+		secretsManager: secretsManager,
+		ttl:            ttl,
+		now:            time.Now,
+		cache:          map[string]cachedSecret{},
+	}
+}
+
+// resolve returns a copy of the secrets with the values referencing Secrets Manager replaced
+func (r *secretsResolver) resolve(ctx context.Context, secrets map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(secrets))
+	for key, value := range secrets {
+		if !strings.HasPrefix(value, SecretsManagerPrefix) {
+			resolved[key] = value
+			continue
+		}
+		if r == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Secret %v references Secrets Manager, which is not enabled", key)
+		}
+		secretArn := strings.TrimPrefix(value, SecretsManagerPrefix)
+		secretValue, err := r.get(ctx, secretArn)
+		if err != nil {
+			if err == cloud.ErrAccessDenied {
+				return nil, status.Errorf(codes.Unauthenticated, "Access Denied to secret %v of %v. Please ensure the controller may read the secret and decrypt it with its KMS key: %v", secretArn, key, err)
+			}
+			if err == cloud.ErrNotFound {
+				return nil, status.Errorf(codes.InvalidArgument, "Secret %v of %v does not exist: %v", secretArn, key, err)
+			}
+			if err == cloud.ErrDeadlineExceeded {
+				return nil, status.Errorf(codes.DeadlineExceeded, "Timed out getting secret %v of %v: %v", secretArn, key, err)
+			}
+			return nil, status.Errorf(codes.Internal, "Failed to get secret %v of %v: %v", secretArn, key, err)
+		}
+		resolved[key] = secretValue
+	}
+	return resolved, nil
+}
+
+// get returns the cached value of the secret, or fetches it if it expired. The expired value is kept
+// if the secret cannot be fetched, so that a transient Secrets Manager error does not fail provisioning.
+func (r *secretsResolver) get(ctx context.Context, secretArn string) (string, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[secretArn]
+	r.mu.Unlock()
+	if ok && r.now().Sub(cached.fetchedAt) < r.ttl {
+		return cached.value, nil
+	}
+
+	value, err := r.secretsManager.GetSecretValue(ctx, secretArn)
+	if err != nil {
+		if ok && err != cloud.ErrAccessDenied && err != cloud.ErrNotFound {
+			klog.Warningf("Failed to refresh secret %s, using the value fetched at %v: %v", secretArn, cached.fetchedAt, err)
+			return cached.value, nil
+		}
+		return "", err
+	}
+	r.mu.Lock()
+	r.cache[secretArn] = cachedSecret{value: value, fetchedAt: r.now()}
+	r.mu.Unlock()
+	return value, nil
+}
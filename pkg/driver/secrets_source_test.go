@@ -0,0 +1,118 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+type fakeSecretsManager struct {
+	values map[string]string
+	err    error
+	calls  int
+}
+
+func (f *fakeSecretsManager) GetSecretValue(ctx context.Context, secretArn string) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	value, ok := f.values[secretArn]
+	if !ok {
+		return "", cloud.ErrNotFound
+	}
+	return value, nil
+}
+
+func TestSecretsResolver(t *testing.T) {
+	secretArn := "arn:aws:secretsmanager:us-east-1:111122223333:secret:efs-role-AbCdEf"
+	secrets := map[string]string{
+		RoleArn:      SecretsManagerPrefix + secretArn,
+		CrossAccount: "true",
+	}
+	ctx := context.Background()
+
+	t.Run("Success: resolve, cache and rotate", func(t *testing.T) {
+		sm := &fakeSecretsManager{values: map[string]string{secretArn: "arn:aws:iam::111122223333:role/efs"}}
+		now := time.Now()
+		r := newSecretsResolver(sm, time.Minute)
+		r.now = func() time.Time { return now }
+
+		resolved, err := r.resolve(ctx, secrets)
+		if err != nil {
+			t.Fatalf("resolve failed: %v", err)
+		}
+		expected := map[string]string{RoleArn: "arn:aws:iam::111122223333:role/efs", CrossAccount: "true"}
+		if !reflect.DeepEqual(resolved, expected) {
+			t.Fatalf("Expected %v, got %v", expected, resolved)
+		}
+		if secrets[RoleArn] != SecretsManagerPrefix+secretArn {
+			t.Fatal("resolve modified the secrets of the request")
+		}
+
+		// The secret is rotated but the cached value has not expired yet
+		sm.values[secretArn] = "arn:aws:iam::111122223333:role/efs-rotated"
+		if resolved, _ := r.resolve(ctx, secrets); resolved[RoleArn] != expected[RoleArn] || sm.calls != 1 {
+			t.Fatalf("Expected the cached value, got %v after %d calls", resolved[RoleArn], sm.calls)
+		}
+
+		now = now.Add(time.Minute)
+		if resolved, _ := r.resolve(ctx, secrets); resolved[RoleArn] != "arn:aws:iam::111122223333:role/efs-rotated" {
+			t.Fatalf("Expected the rotated value, got %v", resolved[RoleArn])
+		}
+
+		// A transient error keeps the expired value
+		now = now.Add(time.Minute)
+		sm.err = errors.New("connection reset")
+		if resolved, err := r.resolve(ctx, secrets); err != nil || resolved[RoleArn] != "arn:aws:iam::111122223333:role/efs-rotated" {
+			t.Fatalf("Expected the expired value, got %v: %v", resolved[RoleArn], err)
+		}
+
+		// A denied access does not
+		sm.err = cloud.ErrAccessDenied
+		if _, err := r.resolve(ctx, secrets); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated, got %v", err)
+		}
+	})
+
+	t.Run("Fail: secret not found", func(t *testing.T) {
+		r := newSecretsResolver(&fakeSecretsManager{}, time.Minute)
+		if _, err := r.resolve(ctx, secrets); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("Nil resolver", func(t *testing.T) {
+		var r *secretsResolver
+		plain := map[string]string{RoleArn: "arn:aws:iam::111122223333:role/efs"}
+		if resolved, err := r.resolve(ctx, plain); err != nil || !reflect.DeepEqual(resolved, plain) {
+			t.Fatalf("Expected %v, got %v: %v", plain, resolved, err)
+		}
+		if _, err := r.resolve(ctx, secrets); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected InvalidArgument, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// secureMountOptionOptOuts holds the mount option lifting each of the secure mount options
+var secureMountOptionOptOuts = map[string]string{
+	"nosuid": "suid",
+	"nodev":  "dev",
+	"noexec": "exec",
+}
+
+// secureMountOptions are the mount options added by default to all the volumes published on the node, e.g.
+// nosuid and nodev, to harden the node without editing the persistent volumes. A persistent volume opts out
+// of an option with the option lifting it in its mount options, e.g. exec for noexec, which is only allowed
+// when allowOptOut is set. A nil secureMountOptions is valid and adds nothing.
+type secureMountOptions struct {
+	options     []string
+	allowOptOut bool
+}
+
+// newSecureMountOptions returns the comma separated secure mount options, or nil if empty
+func newSecureMountOptions(options string, allowOptOut bool) (*secureMountOptions, error) {
+	if options == "" {
+		if allowOptOut {
+			return nil, fmt.Errorf("allow-secure-mount-opt-out requires secure-mount-options")
+		}
+		return nil, nil
+	}
+	s := &secureMountOptions{allowOptOut: allowOptOut}
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		if _, ok := secureMountOptionOptOuts[option]; !ok {
+			return nil, fmt.Errorf("invalid secure mount option %q, must be one of nosuid, nodev or noexec", option)
+		}
+		if !hasOption(s.options, option) {
+			s.options = append(s.options, option)
+		}
+	}
+	return s, nil
+}
+
+// apply appends the secure mount options to the mount options of the volume, except those it opts out of. It
+// returns InvalidArgument if the volume opts out of an option without allowOptOut.
+func (s *secureMountOptions) apply(volumeId string, mountOptions []string) ([]string, error) {
+	if s == nil {
+		return mountOptions, nil
+	}
+	for _, option := range s.options {
+		optOut := secureMountOptionOptOuts[option]
+		if hasOption(mountOptions, optOut) {
+			if !s.allowOptOut {
+				return nil, status.Errorf(codes.InvalidArgument, "Mount option %s of volume %s conflicts with the mount option %s enforced on the node, remove it or set allow-secure-mount-opt-out on the node", optOut, volumeId, option)
+			}
+			klog.V(4).Infof("NodePublishVolume: volume %s opts out of the secure mount option %s with %s", volumeId, option, optOut)
+			continue
+		}
+		if !hasOption(mountOptions, option) {
+			mountOptions = append(mountOptions, option)
+		}
+	}
+	return mountOptions, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewSecureMountOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		options     string
+		allowOptOut bool
+		expected    []string
+		expectErr   bool
+	}{
+		{name: "disabled"},
+		{name: "options", options: "nosuid, nodev,nosuid", expected: []string{"nosuid", "nodev"}},
+		{name: "invalid option", options: "nosuid,ro", expectErr: true},
+		{name: "opt out without options", allowOptOut: true, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newSecureMountOptions(tc.options, tc.allowOptOut)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.expected == nil {
+				if s != nil {
+					t.Fatalf("Expected no secure mount options, got %+v", s)
+				}
+				return
+			}
+			if !reflect.DeepEqual(s.options, tc.expected) {
+				t.Errorf("Expected options %v, got %v", tc.expected, s.options)
+			}
+		})
+	}
+}
+
+func TestSecureMountOptionsApply(t *testing.T) {
+	testCases := []struct {
+		name         string
+		allowOptOut  bool
+		mountOptions []string
+		expected     []string
+		expectCode   codes.Code
+	}{
+		{
+			name:         "added",
+			mountOptions: []string{"tls"},
+			expected:     []string{"tls", "nosuid", "nodev", "noexec"},
+		},
+		{
+			name:         "already set",
+			mountOptions: []string{"nodev", "tls"},
+			expected:     []string{"nodev", "tls", "nosuid", "noexec"},
+		},
+		{
+			name:         "opt out allowed",
+			allowOptOut:  true,
+			mountOptions: []string{"tls", "exec"},
+			expected:     []string{"tls", "exec", "nosuid", "nodev"},
+		},
+		{
+			name:         "opt out denied",
+			mountOptions: []string{"tls", "exec"},
+			expectCode:   codes.InvalidArgument,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newSecureMountOptions("nosuid,nodev,noexec", tc.allowOptOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mountOptions, err := s.apply(volumeId, tc.mountOptions)
+			if tc.expectCode != codes.OK {
+				if status.Code(err) != tc.expectCode {
+					t.Fatalf("Expected code %v, got %v", tc.expectCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mountOptions, tc.expected) {
+				t.Errorf("Expected mount options %v, got %v", tc.expected, mountOptions)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeSecureMountOptions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+	driver.secureMountOptions, _ = newSecureMountOptions("nosuid,nodev", false)
+	target := t.TempDir()
+
+	mockMounter.EXPECT().MakeDir(target).Return(nil)
+	mockMounter.EXPECT().Mount(volumeId+":/", target, "efs", []string{"tls", "noatime", "nosuid", "nodev"}).Return(nil)
+	_, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		VolumeId: volumeId,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"noatime"}}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+		},
+		TargetPath: target,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
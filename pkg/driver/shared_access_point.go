@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// In the efs-shared-ap provisioning mode, the volumes of a namespace share one access point, created
+// with the first volume of the namespace, and each volume is a directory of the access point. The
+// volume ID is of the form fileSystemId:/directory:accessPointId, so that the node mounts the directory
+// of the volume through the access point.
+//
+// With the accessPointId parameter, the volumes are directories of an existing access point managed
+// outside of the driver instead, with volume IDs of the same form, so that the access point and its posix
+// user are owned by the operators while each volume keeps its own directory.
+
+// sharedAccessPointClientToken returns the client token of the shared access point with the root directory,
+// so that concurrent CreateVolume calls for the namespace find or create the same access point
+func sharedAccessPointClientToken(fileSystemId, rootDir string) string {
+	return get64LenHash(SharedAccessPointMode + ":" + fileSystemId + ":" + rootDir)
+}
+
+// findOrCreateSharedAccessPoint returns the shared access point of the client token, creating it with the
+// options if it does not exist yet
+func findOrCreateSharedAccessPoint(ctx context.Context, localCloud cloud.Cloud, clientToken string, accessPointOpts *cloud.AccessPointOptions) (*cloud.AccessPoint, error) {
+	accessPoint, err := localCloud.FindAccessPointByClientToken(ctx, clientToken, accessPointOpts.FileSystemId)
+	if err != nil {
+		return nil, err
+	}
+	if accessPoint == nil {
+		accessPoint, err = createAccessPoint(ctx, localCloud, clientToken, accessPointOpts)
+		if err != cloud.ErrAlreadyExists {
+			return accessPoint, err
+		}
+		// A concurrent CreateVolume of the namespace created it with another identity
+		accessPoint, err = localCloud.FindAccessPointByClientToken(ctx, clientToken, accessPointOpts.FileSystemId)
+		if err != nil {
+			return nil, err
+		}
+		if accessPoint == nil {
+			return nil, cloud.ErrAlreadyExists
+		}
+	}
+	klog.V(4).Infof("Using shared access point %v with root directory %v", accessPoint.AccessPointId, accessPoint.AccessPointRootDir)
+	if err := markAccessPointProvisioned(ctx, localCloud, accessPoint); err != nil {
+		return nil, err
+	}
+	return accessPoint, nil
+}
+
+// withSharedAccessPoint mounts the root directory of the access point on a temporary path of the controller
+// and calls fn with the path. If the file system has a maintenance access point, the root directory is
+// reached through it like the other mounts of the controller, otherwise through the access point itself.
+// The calls are serialized per access point, as they share the temporary path.
+func (d *Driver) withSharedAccessPoint(ctx context.Context, localCloud cloud.Cloud, accessPoint *cloud.AccessPoint, roleArn, region string, crossAccountDNSEnabled bool, fn func(ctx context.Context, target string) error) error {
+	defer d.sharedAccessPointLocks.lock(accessPoint.AccessPointId)()
+	fileSystemId := accessPoint.FileSystemId
+	mountOptions := d.rootMountOptions(ctx, localCloud, fileSystemId, roleArn, region, crossAccountDNSEnabled)
+	rootDir := accessPoint.AccessPointRootDir
+	if _, ok := d.maintenanceAccessPoints[fileSystemId]; !ok {
+		mountOptions = append(mountOptions, "accesspoint="+accessPoint.AccessPointId)
+		rootDir = "/"
+	}
+	return d.withTempMount(ctx, fileSystemId, TempMountPathPrefix+"/"+accessPoint.AccessPointId, mountOptions, func(ctx context.Context, target string) error {
+		return fn(ctx, path.Join(target, rootDir))
+	})
+}
+
+// makeSharedDirectory creates the directory of a volume in the root directory of the access point mounted by
+// withSharedAccessPoint. Through a maintenance access point, the directory is owned by the posix user of the
+// access point, as if it had been created through the access point.
+func (d *Driver) makeSharedDirectory(accessPoint *cloud.AccessPoint, target, dir string) error {
+	dirPath := path.Join(target, dir)
+	if err := d.mounter.MakeDir(dirPath); err != nil {
+		return err
+	}
+	if _, ok := d.maintenanceAccessPoints[accessPoint.FileSystemId]; !ok || accessPoint.PosixUser == nil {
+		return nil
+	}
+	return os.Lchown(dirPath, int(accessPoint.PosixUser.Uid), int(accessPoint.PosixUser.Gid))
+}
+
+// describeExistingAccessPoint returns the access point of the accessPointId parameter, which must be an
+// access point of the file system
+func (d *Driver) describeExistingAccessPoint(ctx context.Context, localCloud cloud.Cloud, accessPointId, fileSystemId string) (*cloud.AccessPoint, error) {
+	accessPoint, err := localCloud.DescribeAccessPoint(ctx, accessPointId)
+	if err != nil {
+		if err == cloud.ErrAccessDenied {
+			return nil, status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
+		}
+		if err == cloud.ErrNotFound {
+			return nil, status.Errorf(codes.InvalidArgument, "Access point %v of parameter %v not found", accessPointId, AccessPointId)
+		}
+		if err == cloud.ErrDeadlineExceeded {
+			return nil, status.Errorf(codes.DeadlineExceeded, "Timed out describing Access Point: %v", accessPointId)
+		}
+		return nil, status.Errorf(codes.Internal, "Could not get describe Access Point: %v , error: %v", accessPointId, err)
+	}
+	if accessPoint.FileSystemId != fileSystemId {
+		return nil, status.Errorf(codes.InvalidArgument, "Access point %v of parameter %v belongs to File System %v, not %v", accessPointId, AccessPointId, accessPoint.FileSystemId, fileSystemId)
+	}
+	return accessPoint, nil
+}
+
+// markDirectoryVolumes tags the existing access point of the accessPointId parameter with DirectoryVolumesTagKey,
+// so that DeleteVolume deletes the directories of its volumes. The access point is managed outside of the driver,
+// which may not be allowed to tag it, in which case the directories of its volumes are kept.
+func markDirectoryVolumes(ctx context.Context, localCloud cloud.Cloud, accessPoint *cloud.AccessPoint) {
+	if accessPoint.Tags[cloud.DirectoryVolumesTagKey] == "true" {
+		return
+	}
+	if err := localCloud.TagResource(ctx, accessPoint.AccessPointId, map[string]string{cloud.DirectoryVolumesTagKey: "true"}); err != nil {
+		klog.Warningf("Failed to tag access point %v with %v, DeleteVolume will keep the directories of its volumes: %v", accessPoint.AccessPointId, cloud.DirectoryVolumesTagKey, err)
+	}
+}
+
+// ownsDirectoryVolumes tells whether the driver created the directories of the volumes of the access point, i.e.
+// it is the access point of a namespace with efs-shared-ap, or one of the accessPointId parameter marked by
+// markDirectoryVolumes. A static volume ID of the same form may refer to any directory of any access point.
+func ownsDirectoryVolumes(accessPoint *cloud.AccessPoint) bool {
+	return accessPoint.SharedNamespace != "" || accessPoint.Tags[cloud.DirectoryVolumesTagKey] == "true"
+}
+
+// deleteSharedVolume deletes the volume of a directory of an access point, of efs-shared-ap or of the
+// accessPointId parameter. The access point is never deleted, as it is shared by the other volumes or managed
+// outside of the driver, and the directory is only deleted with delete-access-point-root-dir, if the driver
+// created it.
+func (d *Driver) deleteSharedVolume(ctx context.Context, localCloud cloud.Cloud, volumeId, fileSystemId, subpath, accessPointId, roleArn, region string, crossAccountDNSEnabled bool) error {
+	if !d.deleteAccessPointRootDir {
+		klog.V(4).Infof("DeleteVolume: keeping directory %v of access point %v", subpath, accessPointId)
+		return nil
+	}
+	if dir := strings.TrimPrefix(subpath, "/"); dir == "" || !filepath.IsLocal(dir) {
+		return status.Errorf(codes.InvalidArgument, "Directory %q of access point %v is not a directory below its root directory", subpath, accessPointId)
+	}
+	accessPoint, err := localCloud.DescribeAccessPoint(ctx, accessPointId)
+	if err != nil {
+		if err == cloud.ErrAccessDenied {
+			return status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
+		}
+		if err == cloud.ErrNotFound {
+			if err := checkAccessPointDeleted(ctx, localCloud, volumeId, fileSystemId, accessPointId); err != nil {
+				return err
+			}
+			klog.V(5).Infof("DeleteVolume: Access Point %v not found, returning success", accessPointId)
+			return nil
+		}
+		if err == cloud.ErrDeadlineExceeded {
+			return status.Errorf(codes.DeadlineExceeded, "Timed out describing Access Point: %v", accessPointId)
+		}
+		return status.Errorf(codes.Internal, "Could not get describe Access Point: %v , error: %v", accessPointId, err)
+	}
+	if !ownsDirectoryVolumes(accessPoint) {
+		klog.Infof("DeleteVolume: keeping directory %v of access point %v, which the driver did not create", subpath, accessPointId)
+		return nil
+	}
+	audit := d.deleteAudit.newRecord(ctx, volumeId, fileSystemId, accessPointId, subpath)
+	err = d.withSharedAccessPoint(ctx, localCloud, accessPoint, roleArn, region, crossAccountDNSEnabled, func(ctx context.Context, target string) error {
+		removed, err := removeSharedDirectory(ctx, target, subpath)
+		d.deleteAudit.write(audit, removed, err)
+		return err
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	if status.Code(err) == codes.InvalidArgument {
+		return err
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not delete directory %q of access point %v: %v", subpath, accessPointId, err)
+	}
+	return nil
+}
+
+// removeSharedDirectory removes the directory of a volume in the root directory of the access point mounted by
+// withSharedAccessPoint. The directory must be strictly below the root directory, so that a volume ID whose sub
+// path is the root directory or escapes it never removes the directories of the other volumes.
+func removeSharedDirectory(ctx context.Context, target, subpath string) (int64, error) {
+	dir := path.Join(target, subpath)
+	if !strings.HasPrefix(dir, path.Clean(target)+"/") {
+		return 0, status.Errorf(codes.InvalidArgument, "Directory %q is not below the root directory of the access point", subpath)
+	}
+	return removeAllWithContext(ctx, dir)
+}
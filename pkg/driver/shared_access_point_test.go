@@ -0,0 +1,236 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestFindOrCreateSharedAccessPoint(t *testing.T) {
+	var (
+		fsId        = "fs-abcd1234"
+		apId        = "fsap-abcd1234xyz987"
+		clientToken = sharedAccessPointClientToken(fsId, "/team-a")
+	)
+
+	testCases := []struct {
+		name      string
+		setup     func(ctx context.Context, mockCloud *mocks.MockCloud)
+		expectErr error
+	}{
+		{
+			name: "Success: existing access point",
+			setup: func(ctx context.Context, mockCloud *mocks.MockCloud) {
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(&cloud.AccessPoint{AccessPointId: apId}, nil)
+			},
+		},
+		{
+			name: "Success: existing access point left pending is completed",
+			setup: func(ctx context.Context, mockCloud *mocks.MockCloud) {
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(&cloud.AccessPoint{AccessPointId: apId, Pending: true}, nil)
+				mockCloud.EXPECT().MarkAccessPointProvisioned(gomock.Eq(ctx), gomock.Eq(apId)).Return(nil)
+			},
+		},
+		{
+			name: "Success: access point created",
+			setup: func(ctx context.Context, mockCloud *mocks.MockCloud) {
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(nil, nil)
+				mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(&cloud.AccessPoint{AccessPointId: apId}, nil)
+			},
+		},
+		{
+			name: "Success: access point created concurrently with another identity",
+			setup: func(ctx context.Context, mockCloud *mocks.MockCloud) {
+				gomock.InOrder(
+					mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(nil, nil),
+					mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Any()).Return(nil, cloud.ErrAlreadyExists),
+					// createAccessPoint looks for an access point left pending
+					mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(&cloud.AccessPoint{AccessPointId: apId}, nil),
+					mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(&cloud.AccessPoint{AccessPointId: apId}, nil),
+				)
+			},
+		},
+		{
+			name: "Fail: find failed",
+			setup: func(ctx context.Context, mockCloud *mocks.MockCloud) {
+				mockCloud.EXPECT().FindAccessPointByClientToken(gomock.Eq(ctx), gomock.Eq(clientToken), gomock.Eq(fsId)).Return(nil, cloud.ErrAccessDenied)
+			},
+			expectErr: cloud.ErrAccessDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+
+			ctx := context.Background()
+			tc.setup(ctx, mockCloud)
+			accessPoint, err := findOrCreateSharedAccessPoint(ctx, mockCloud, clientToken, &cloud.AccessPointOptions{FileSystemId: fsId})
+			if err != tc.expectErr {
+				t.Fatalf("Expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && accessPoint.AccessPointId != apId {
+				t.Fatalf("Expected access point %v, got %v", apId, accessPoint.AccessPointId)
+			}
+		})
+	}
+}
+
+func TestWithSharedAccessPoint(t *testing.T) {
+	var (
+		fsId          = "fs-abcd1234"
+		apId          = "fsap-abcd1234xyz987"
+		maintenanceId = "fsap-1234abcd"
+		target        = TempMountPathPrefix + "/" + apId
+		accessPoint   = &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/shared/team-a"}
+	)
+
+	testCases := []struct {
+		name                    string
+		maintenanceAccessPoints map[string]string
+		expectOptions           []string
+		expectTarget            string
+	}{
+		{
+			name:          "Success: through the access point",
+			expectOptions: []string{"tls", "iam", "accesspoint=" + apId},
+			expectTarget:  target,
+		},
+		{
+			name:                    "Success: through the maintenance access point",
+			maintenanceAccessPoints: map[string]string{fsId: maintenanceId},
+			expectOptions:           []string{"tls", "iam", "accesspoint=" + maintenanceId},
+			expectTarget:            target + "/shared/team-a",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockMounter := mocks.NewMockMounter(mockCtl)
+			driver := &Driver{mounter: mockMounter, maintenanceAccessPoints: tc.maintenanceAccessPoints}
+
+			mockMounter.EXPECT().MakeDir(gomock.Eq(target)).Return(nil)
+			mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(target), gomock.Eq("efs"), gomock.Eq(tc.expectOptions)).Return(nil)
+			mockMounter.EXPECT().Unmount(gomock.Eq(target)).Return(nil)
+
+			err := driver.withSharedAccessPoint(context.Background(), nil, accessPoint, "", "", false, func(ctx context.Context, target string) error {
+				if target != tc.expectTarget {
+					t.Fatalf("Expected the root directory of the access point at %v, got %v", tc.expectTarget, target)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("withSharedAccessPoint failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithSharedAccessPointSerialized(t *testing.T) {
+	var (
+		fsId        = "fs-abcd1234"
+		apId        = "fsap-abcd1234xyz987"
+		target      = TempMountPathPrefix + "/" + apId
+		accessPoint = &cloud.AccessPoint{AccessPointId: apId, FileSystemId: fsId, AccessPointRootDir: "/shared/team-a"}
+	)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockMounter := mocks.NewMockMounter(mockCtl)
+	driver := &Driver{mounter: mockMounter}
+
+	mockMounter.EXPECT().MakeDir(gomock.Eq(target)).Return(nil).Times(2)
+	mockMounter.EXPECT().Mount(gomock.Eq(fsId), gomock.Eq(target), gomock.Eq("efs"), gomock.Any()).Return(nil).Times(2)
+	mockMounter.EXPECT().Unmount(gomock.Eq(target)).Return(nil).Times(2)
+
+	var mu sync.Mutex
+	inside := 0
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- driver.withSharedAccessPoint(context.Background(), nil, accessPoint, "", "", false, func(ctx context.Context, target string) error {
+				mu.Lock()
+				inside++
+				concurrent := inside
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				inside--
+				mu.Unlock()
+				if concurrent > 1 {
+					return fmt.Errorf("%d concurrent calls on the temporary mount of the access point", concurrent)
+				}
+				return nil
+			})
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("withSharedAccessPoint failed: %v", err)
+		}
+	}
+}
+
+func TestRemoveSharedDirectory(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "root")
+	for _, dir := range []string{"pvc-1", "pvc-2"} {
+		if err := os.MkdirAll(filepath.Join(target, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(target, dir, "file"), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, subpath := range []string{"", "/", "/.", "/../..", "/pvc-1/../..", ".."} {
+		if _, err := removeSharedDirectory(context.Background(), target, subpath); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected InvalidArgument for sub path %q, got %v", subpath, err)
+		}
+	}
+	for _, dir := range []string{"pvc-1", "pvc-2"} {
+		if _, err := os.Stat(filepath.Join(target, dir, "file")); err != nil {
+			t.Fatalf("Expected directory %s to be kept: %v", dir, err)
+		}
+	}
+
+	removed, err := removeSharedDirectory(context.Background(), target, "/pvc-1")
+	if err != nil || removed != 4 {
+		t.Fatalf("Expected 4 bytes removed, got %d: %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "pvc-1")); !os.IsNotExist(err) {
+		t.Fatalf("Expected directory pvc-1 to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "pvc-2", "file")); err != nil {
+		t.Fatalf("Expected directory pvc-2 to be kept: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// sharedMounts keeps one mount per volume and mount options on the node, bind mounted read-only or
+// read-write at the target path of every pod publishing the volume, so that a volume published to many
+// pods runs a single mount helper and proxy. The targets referencing a mount are recorded as files in the
+// directory of the mount, so that the references survive restarts of the driver, and the mount is unmounted
+// once the last target is unpublished. A nil sharedMounts is valid and mounts the volume at every target.
+type sharedMounts struct {
+	dir string
+	// locks serializes the calls per mount directory, so that a slow mount of a volume does not block the
+	// publishing of the other volumes
+	locks keyedLocks
+}
+
+// keyedLocks is a set of mutexes created on demand per key and dropped once unused. The zero value is ready
+// to use.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	// users is the number of calls holding or waiting for the lock
+	users int
+}
+
+// lock locks the key and returns the function unlocking it
+func (k *keyedLocks) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.users++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		if l.users--; l.users == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
+
+// newSharedMounts returns the shared mounts kept in the plugin directory of the kubelet, which is mounted
+// with Bidirectional propagation so that the bind mounts reach the pods
+func newSharedMounts(kubeletDir string) *sharedMounts {
+	return &sharedMounts{dir: filepath.Join(kubeletDir, "plugins", driverName, "shared-mounts")}
+}
+
+// newSubPathStaging returns the shared mounts of the volumes with a sub path, whose sub path is bind mounted
+// at the targets. The volume stays mounted until its last target is unpublished, as the watchdog of efs-utils
+// stops the TLS tunnel of an unmounted volume, which the bind mounts still use.
+func newSubPathStaging(kubeletDir string) *sharedMounts {
+	return &sharedMounts{dir: filepath.Join(kubeletDir, "plugins", driverName, "subpath-staging")}
+}
+
+// mountDir returns the directory of the mount of the volume with the options, besides ro which is set
+// on the bind mount of each target
+func (s *sharedMounts) mountDir(volumeId string, mountOptions []string) string {
+	options := []string{}
+	for _, option := range mountOptions {
+		if option != "ro" {
+			options = append(options, option)
+		}
+	}
+	sort.Strings(options)
+	return filepath.Join(s.dir, hashPath(volumeId+"\n"+strings.Join(options, ",")))
+}
+
+// lock locks the mount of the directory and returns the function unlocking it
+func (s *sharedMounts) lock(dir string) func() {
+	return s.locks.lock(dir)
+}
+
+// references returns the names of the reference files of the targets of the mount of the directory
+func (s *sharedMounts) references(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "refs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs := []string{}
+	for _, entry := range entries {
+		refs = append(refs, entry.Name())
+	}
+	return refs, nil
+}
+
+// publishSharedMount bind mounts the shared mount of the volume at the target, mounting it first if the
+// volume is not published to another target with the same options. With subPath, the directory it returns
+// for the mount path is bind mounted instead of the root of the volume.
+func (d *Driver) publishSharedMount(s *sharedMounts, volumeId, fsid, source, target string, mountOptions []string, subPath func(mountPath string) (string, error)) error {
+	dir := s.mountDir(volumeId, mountOptions)
+	defer s.lock(dir)()
+	mountPath := filepath.Join(dir, "mount")
+	refs, err := s.references(dir)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not read the references of shared mount %q: %v", mountPath, err)
+	}
+	if len(refs) > 0 {
+		// The mounts do not survive a reboot of the node, unlike the references
+		notMounted, err := d.mounter.IsLikelyNotMountPoint(mountPath)
+		if err != nil && !os.IsNotExist(err) {
+			return status.Errorf(codes.Internal, "Could not check shared mount %q: %v", mountPath, err)
+		}
+		if err != nil || notMounted {
+			klog.Warningf("NodePublishVolume: shared mount %s is no longer mounted, dropping its references %v", mountPath, refs)
+			os.RemoveAll(filepath.Join(dir, "refs"))
+			refs = nil
+		}
+	}
+
+	mounted := len(refs) > 0
+	if !mounted {
+		sharedOptions := []string{}
+		for _, option := range mountOptions {
+			if option != "ro" {
+				sharedOptions = append(sharedOptions, option)
+			}
+		}
+		klog.V(5).Infof("NodePublishVolume: creating dir %s", mountPath)
+		if err := d.mounter.MakeDir(mountPath); err != nil {
+			return status.Errorf(codes.Internal, "Could not create dir %q: %v", mountPath, err)
+		}
+		klog.V(5).Infof("NodePublishVolume: mounting %s at shared mount %s with options %v", source, mountPath, sharedOptions)
+		mountStart := time.Now()
+		err := d.mounter.Mount(source, mountPath, "efs", sharedOptions)
+		d.mountStats.record(volumeId, time.Since(mountStart), err)
+		if err != nil {
+			os.Remove(mountPath)
+			os.Remove(dir)
+			return status.Errorf(codes.Internal, "Could not mount %q at %q: %v", source, mountPath, err)
+		}
+		if err := d.fsIdentityCheck.verify(fsid, mountPath, sharedOptions); err != nil {
+			s.unmount(d.mounter, dir)
+			return status.Errorf(codes.FailedPrecondition, "Could not verify that file system %v is mounted at %q: %v", fsid, mountPath, err)
+		}
+	}
+
+	bindSource := mountPath
+	if subPath != nil {
+		if bindSource, err = subPath(mountPath); err != nil {
+			if !mounted {
+				s.unmount(d.mounter, dir)
+			}
+			return err
+		}
+	}
+	bindOptions := []string{"bind"}
+	if hasOption(mountOptions, "ro") {
+		bindOptions = append(bindOptions, "ro")
+	}
+	klog.V(5).Infof("NodePublishVolume: bind mounting shared mount %s at %s with options %v", bindSource, target, bindOptions)
+	if err := d.mounter.Mount(bindSource, target, "", bindOptions); err != nil {
+		if !mounted {
+			s.unmount(d.mounter, dir)
+		}
+		return status.Errorf(codes.Internal, "Could not bind mount shared mount %q at %q: %v", mountPath, target, err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "refs"), 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "refs", hashPath(target)), []byte(target), 0644)
+	}
+	if err != nil {
+		// Without its reference, the shared mount would be unmounted while the target still uses it
+		if unmountErr := d.mounter.Unmount(target); unmountErr != nil {
+			klog.Warningf("Failed to unmount %s after failing to reference shared mount %s: %v", target, mountPath, unmountErr)
+		}
+		if !mounted {
+			s.unmount(d.mounter, dir)
+		}
+		return status.Errorf(codes.Internal, "Could not reference shared mount %q: %v", mountPath, err)
+	}
+	return nil
+}
+
+// releaseSharedMount drops the reference of the unmounted target to its shared mount or sub path staging
+// mount, if any, and unmounts the mount if it was the last one. The reference is kept if the mount cannot be
+// unmounted, so that the next NodeUnpublishVolume of the target retries.
+func (d *Driver) releaseSharedMount(target string) error {
+	for _, s := range []*sharedMounts{d.sharedMounts, d.subPathStaging} {
+		if err := s.release(d.mounter, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sharedMounts) release(mounter Mounter, target string) error {
+	if s == nil {
+		return nil
+	}
+	ref := hashPath(target)
+	refFiles, err := filepath.Glob(filepath.Join(s.dir, "*", "refs", ref))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not find the shared mount of %q: %v", target, err)
+	}
+	for _, refFile := range refFiles {
+		if err := s.releaseReference(mounter, target, refFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseReference removes the reference file of the target, unmounting its mount if it was the last one
+func (s *sharedMounts) releaseReference(mounter Mounter, target, refFile string) error {
+	dir := filepath.Dir(filepath.Dir(refFile))
+	defer s.lock(dir)()
+
+	// The references are read again once locked, as another call may have changed them
+	ref := filepath.Base(refFile)
+	refs, err := s.references(dir)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not read the references of shared mount %q: %v", dir, err)
+	}
+	if len(refs) == 1 && refs[0] == ref {
+		klog.V(5).Infof("NodeUnpublishVolume: unmounting shared mount %s of its last target %s", dir, target)
+		if err := s.unmount(mounter, dir); err != nil {
+			return status.Errorf(codes.Internal, "Could not unmount shared mount %q: %v", dir, err)
+		}
+		return nil
+	}
+	if err := os.Remove(refFile); err != nil && !os.IsNotExist(err) {
+		return status.Errorf(codes.Internal, "Could not release shared mount %q: %v", dir, err)
+	}
+	return nil
+}
+
+// unmount unmounts the shared mount of the directory and removes the directory with its references. The
+// mount point itself is not removed recursively, in case the file system is still mounted there.
+func (s *sharedMounts) unmount(mounter Mounter, dir string) error {
+	mountPath := filepath.Join(dir, "mount")
+	if err := mounter.Unmount(mountPath); err != nil {
+		klog.Warningf("Failed to unmount shared mount %s: %v", mountPath, err)
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "refs")); err != nil {
+		return err
+	}
+	os.Remove(mountPath)
+	return os.Remove(dir)
+}
+
+// hashPath returns a name for the path that is safe as a file name
+func hashPath(p string) string {
+	sum := sha256.Sum256([]byte(p))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+)
+
+func TestSharedMounts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+	kubeletDir := t.TempDir()
+	driver.sharedMounts = newSharedMounts(kubeletDir)
+	mountPath := filepath.Join(driver.sharedMounts.mountDir(volumeId, []string{"tls"}), "mount")
+	makeDir := func(p string) error { return os.MkdirAll(p, 0755) }
+
+	volCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"tls"}},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+	publish := func(target string, readOnly bool) error {
+		_, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+			VolumeId:         volumeId,
+			VolumeCapability: volCap,
+			TargetPath:       target,
+			Readonly:         readOnly,
+		})
+		return err
+	}
+	unpublish := func(target string) error {
+		_, err := driver.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   volumeId,
+			TargetPath: target,
+		})
+		return err
+	}
+
+	// The first pod mounts the volume, the second one only bind mounts it read-only
+	writer, reader := filepath.Join(kubeletDir, "pods", "writer"), filepath.Join(kubeletDir, "pods", "reader")
+	mockMounter.EXPECT().MakeDir(writer).DoAndReturn(makeDir)
+	mockMounter.EXPECT().MakeDir(mountPath).DoAndReturn(makeDir)
+	mockMounter.EXPECT().Mount(volumeId+":/", mountPath, "efs", []string{"tls"}).Return(nil)
+	mockMounter.EXPECT().Mount(mountPath, writer, "", []string{"bind"}).Return(nil)
+	if err := publish(writer, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mockMounter.EXPECT().MakeDir(reader).DoAndReturn(makeDir)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(mountPath).Return(false, nil)
+	mockMounter.EXPECT().Mount(mountPath, reader, "", []string{"bind", "ro"}).Return(nil)
+	if err := publish(reader, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The volume stays mounted until its last pod is unpublished
+	mockMounter.EXPECT().GetDeviceName(writer).Return("", 1, nil)
+	mockMounter.EXPECT().Unmount(writer).Return(nil)
+	if err := unpublish(writer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mockMounter.EXPECT().GetDeviceName(reader).Return("", 1, nil)
+	mockMounter.EXPECT().Unmount(reader).Return(nil)
+	mockMounter.EXPECT().Unmount(mountPath).Return(errors.New("device busy"))
+	if err := unpublish(reader); err == nil {
+		t.Fatal("Expected the failure to unmount the shared mount")
+	}
+	// The retry of the target, which is no longer mounted, unmounts the shared mount
+	mockMounter.EXPECT().GetDeviceName(reader).Return("", 0, nil)
+	mockMounter.EXPECT().Unmount(mountPath).Return(nil)
+	if err := unpublish(reader); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(mountPath)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the shared mount directory to be removed, got %v", err)
+	}
+}
+
+func TestSharedMountsAfterReboot(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter, driver, _ := setup(mockCtrl, NewVolStatter(), false)
+	driver.sharedMounts = newSharedMounts(t.TempDir())
+	mountPath := filepath.Join(driver.sharedMounts.mountDir(volumeId, nil), "mount")
+	makeDir := func(p string) error { return os.MkdirAll(p, 0755) }
+
+	// The references of the pods of the node before its reboot are left behind
+	refsDir := filepath.Join(filepath.Dir(mountPath), "refs")
+	if err := os.MkdirAll(refsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(refsDir, hashPath("/stale")), []byte("/stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockMounter.EXPECT().IsLikelyNotMountPoint(mountPath).Return(true, nil)
+	mockMounter.EXPECT().MakeDir(mountPath).DoAndReturn(makeDir)
+	mockMounter.EXPECT().Mount(volumeId+":/", mountPath, "efs", []string{}).Return(nil)
+	mockMounter.EXPECT().Mount(mountPath, targetPath, "", []string{"bind"}).Return(nil)
+	if err := driver.publishSharedMount(driver.sharedMounts, volumeId, volumeId, volumeId+":/", targetPath, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	refs, err := driver.sharedMounts.references(filepath.Dir(mountPath))
+	if err != nil || len(refs) != 1 || refs[0] != hashPath(targetPath) {
+		t.Fatalf("Expected the reference of %s only, got %v: %v", targetPath, refs, err)
+	}
+}
+
+func TestSubPathStaging(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+	kubeletDir := t.TempDir()
+	driver.subPathStaging = newSubPathStaging(kubeletDir)
+	stagingPath := filepath.Join(driver.subPathStaging.mountDir(volumeId, nil), "mount")
+	makeDir := func(p string) error { return os.MkdirAll(p, 0755) }
+
+	volCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+	publish := func(target, subPath string) error {
+		_, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+			VolumeId:         volumeId,
+			VolumeCapability: volCap,
+			TargetPath:       target,
+			VolumeContext:    map[string]string{"subPath": subPath, "encryptInTransit": "false"},
+		})
+		return err
+	}
+	unpublish := func(target string) error {
+		_, err := driver.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   volumeId,
+			TargetPath: target,
+		})
+		return err
+	}
+
+	// The sub paths of both pods are bind mounted from the same staging mount
+	first, second := filepath.Join(kubeletDir, "pods", "first"), filepath.Join(kubeletDir, "pods", "second")
+	mockMounter.EXPECT().MakeDir(first).DoAndReturn(makeDir)
+	mockMounter.EXPECT().MakeDir(stagingPath).DoAndReturn(makeDir)
+	mockMounter.EXPECT().Mount(volumeId+":/", stagingPath, "efs", []string{}).DoAndReturn(
+		func(_, _, _ string, _ []string) error {
+			if err := os.MkdirAll(filepath.Join(stagingPath, "a"), 0755); err != nil {
+				return err
+			}
+			return os.MkdirAll(filepath.Join(stagingPath, "b"), 0755)
+		})
+	mockMounter.EXPECT().Mount(filepath.Join(stagingPath, "a"), first, "", []string{"bind"}).Return(nil)
+	if err := publish(first, "a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mockMounter.EXPECT().MakeDir(second).DoAndReturn(makeDir)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(stagingPath).Return(false, nil)
+	mockMounter.EXPECT().Mount(filepath.Join(stagingPath, "b"), second, "", []string{"bind"}).Return(nil)
+	if err := publish(second, "b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The staging mount, and the TLS tunnel of its volume, stay until the last target is unpublished
+	mockMounter.EXPECT().GetDeviceName(first).Return("", 1, nil)
+	mockMounter.EXPECT().Unmount(first).Return(nil)
+	if err := unpublish(first); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mockMounter.EXPECT().GetDeviceName(second).Return("", 1, nil)
+	mockMounter.EXPECT().Unmount(second).Return(nil)
+	mockMounter.EXPECT().Unmount(stagingPath).DoAndReturn(func(p string) error {
+		// The content of the volume goes with the mount
+		return os.RemoveAll(p)
+	})
+	if err := unpublish(second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(stagingPath)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the staging directory to be removed, got %v", err)
+	}
+}
+
+func TestSharedMountsLockPerVolume(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter, driver, _ := setup(mockCtrl, NewVolStatter(), false)
+	driver.sharedMounts = newSharedMounts(t.TempDir())
+	const otherVolumeId = "fs-5678abcd"
+	slowPath := filepath.Join(driver.sharedMounts.mountDir(volumeId, nil), "mount")
+	otherPath := filepath.Join(driver.sharedMounts.mountDir(otherVolumeId, nil), "mount")
+	makeDir := func(p string) error { return os.MkdirAll(p, 0755) }
+
+	// The mount of the first volume hangs until the second volume is published
+	mounting, unblock := make(chan struct{}), make(chan struct{})
+	mockMounter.EXPECT().MakeDir(slowPath).DoAndReturn(makeDir)
+	mockMounter.EXPECT().Mount(volumeId+":/", slowPath, "efs", []string{}).DoAndReturn(func(_, _, _ string, _ []string) error {
+		close(mounting)
+		<-unblock
+		return nil
+	})
+	mockMounter.EXPECT().Mount(slowPath, "/slow", "", []string{"bind"}).Return(nil)
+	slowErr := make(chan error)
+	go func() {
+		slowErr <- driver.publishSharedMount(driver.sharedMounts, volumeId, volumeId, volumeId+":/", "/slow", nil, nil)
+	}()
+	<-mounting
+
+	mockMounter.EXPECT().MakeDir(otherPath).DoAndReturn(makeDir)
+	mockMounter.EXPECT().Mount(otherVolumeId+":/", otherPath, "efs", []string{}).Return(nil)
+	mockMounter.EXPECT().Mount(otherPath, "/other", "", []string{"bind"}).Return(nil)
+	if err := driver.publishSharedMount(driver.sharedMounts, otherVolumeId, otherVolumeId, otherVolumeId+":/", "/other", nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	close(unblock)
+	if err := <-slowErr; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(driver.sharedMounts.locks.locks) != 0 {
+		t.Fatalf("Expected the locks to be released, got %v", driver.sharedMounts.locks.locks)
+	}
+}
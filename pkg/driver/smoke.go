@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+)
+
+// smokeTestFilePrefix prefixes the sentinel file written and removed by the smoke test
+const smokeTestFilePrefix = ".efs-csi-smoke-test-"
+
+const (
+	smokeTestStepParse   = "parse"
+	smokeTestStepMount   = "mount"
+	smokeTestStepWrite   = "write"
+	smokeTestStepRead    = "read"
+	smokeTestStepUnmount = "unmount"
+)
+
+// SmokeTestResult is the machine-readable result of the smoke test, printed as a single JSON line
+type SmokeTestResult struct {
+	VolumeHandle         string   `json:"volumeHandle"`
+	FileSystemId         string   `json:"fileSystemId,omitempty"`
+	AccessPointId        string   `json:"accessPointId,omitempty"`
+	MountOptions         []string `json:"mountOptions,omitempty"`
+	Success              bool     `json:"success"`
+	FailedStep           string   `json:"failedStep,omitempty"`
+	Error                string   `json:"error,omitempty"`
+	MountDurationSeconds float64  `json:"mountDurationSeconds,omitempty"`
+	Time                 string   `json:"time"`
+}
+
+// RunSmokeTest mounts the volume handle once, writes, reads back and removes a sentinel file at the root of
+// the volume, unmounts it and prints the result to out. It returns an error if any step failed, so that a
+// Job running it fails. The volume is mounted as by the node, with the efs-utils config rendered and the
+// watchdog of efs-utils running, which starts the TLS tunnel of the mount.
+func RunSmokeTest(cfg *Config, volumeHandle string, mountOptions []string, out io.Writer) error {
+	if err := setEfsUtilsEnv(cfg); err != nil {
+		return err
+	}
+	watchdog := newExecWatchdog(cfg.EfsUtilsCfgPath, cfg.EfsUtilsStaticFilesPath, "amazon-efs-mount-watchdog")
+	return runSmokeTest(newNodeMounter(), watchdog, os.TempDir(), volumeHandle, mountOptions, out)
+}
+
+func runSmokeTest(mounter Mounter, watchdog Watchdog, tempDir, volumeHandle string, mountOptions []string, out io.Writer) error {
+	result := &SmokeTestResult{VolumeHandle: volumeHandle}
+	err := smokeTest(mounter, watchdog, tempDir, volumeHandle, mountOptions, result)
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Time = time.Now().UTC().Format(time.RFC3339)
+	data, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	fmt.Fprintln(out, string(data))
+	if err != nil {
+		return fmt.Errorf("smoke test of %s failed at step %s: %v", volumeHandle, result.FailedStep, err)
+	}
+	return nil
+}
+
+func smokeTest(mounter Mounter, watchdog Watchdog, tempDir, volumeHandle string, mountOptions []string, result *SmokeTestResult) (err error) {
+	result.FailedStep = smokeTestStepParse
+	fsid, subpath, apid, err := parseVolumeId(volumeHandle)
+	if err != nil {
+		return err
+	}
+	result.FileSystemId, result.AccessPointId = fsid, apid
+	if subpath == "" {
+		subpath = "/"
+	}
+	// The volume is mounted as NodePublishVolume does with its default volume context
+	options := []string{}
+	if apid != "" {
+		options = append(options, "accesspoint="+apid)
+	}
+	options = append(options, "tls")
+	for _, option := range mountOptions {
+		if !hasOption(options, option) {
+			options = append(options, option)
+		}
+	}
+	result.MountOptions = options
+
+	result.FailedStep = smokeTestStepMount
+	// Stopped after the volume is unmounted, by the deferred calls in reverse order
+	if err := watchdog.start(); err != nil {
+		return err
+	}
+	defer watchdog.stop()
+	target, err := os.MkdirTemp(tempDir, "efs-smoke-test-")
+	if err != nil {
+		return err
+	}
+	source := fmt.Sprintf("%s:%s", fsid, subpath)
+	klog.V(4).Infof("Smoke test: mounting %s at %s with options %v", source, target, options)
+	mountStart := time.Now()
+	if err := mounter.Mount(source, target, "efs", options); err != nil {
+		os.Remove(target)
+		return err
+	}
+	result.MountDurationSeconds = time.Since(mountStart).Seconds()
+	defer func() {
+		if unmountErr := mounter.Unmount(target); unmountErr != nil {
+			if err == nil {
+				result.FailedStep = smokeTestStepUnmount
+				err = unmountErr
+			}
+			return
+		}
+		os.Remove(target)
+	}()
+
+	result.FailedStep = smokeTestStepWrite
+	sentinel := filepath.Join(target, smokeTestFilePrefix+uuid.New().String())
+	content := []byte(fmt.Sprintf("%s %s\n", volumeHandle, time.Now().UTC().Format(time.RFC3339Nano)))
+	if err := os.WriteFile(sentinel, content, 0600); err != nil {
+		return err
+	}
+	defer os.Remove(sentinel)
+
+	result.FailedStep = smokeTestStepRead
+	read, err := os.ReadFile(sentinel)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(read, content) {
+		return fmt.Errorf("sentinel file %s contains %q instead of %q", filepath.Base(sentinel), read, content)
+	}
+	result.FailedStep = ""
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+// smokeTestWatchdog records whether the watchdog of the smoke test is running
+type smokeTestWatchdog struct {
+	started, stopped bool
+}
+
+func (w *smokeTestWatchdog) start() error {
+	w.started = true
+	return nil
+}
+
+func (w *smokeTestWatchdog) stop() {
+	w.stopped = true
+}
+
+func TestRunSmokeTest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		volumeHandle string
+		mountOptions []string
+		mountErr     error
+		unmountErr   error
+		expected     SmokeTestResult
+	}{
+		{
+			name:         "success with access point",
+			volumeHandle: "fs-abcd1234::fsap-abcd1234",
+			mountOptions: []string{"tls", "iam"},
+			expected: SmokeTestResult{
+				FileSystemId:  "fs-abcd1234",
+				AccessPointId: "fsap-abcd1234",
+				MountOptions:  []string{"accesspoint=fsap-abcd1234", "tls", "iam"},
+				Success:       true,
+			},
+		},
+		{
+			name:         "invalid volume handle",
+			volumeHandle: "efs-volume",
+			expected:     SmokeTestResult{FailedStep: smokeTestStepParse},
+		},
+		{
+			name:         "mount fails",
+			volumeHandle: "fs-abcd1234:/data",
+			mountErr:     errors.New("mount.nfs4: access denied by server"),
+			expected: SmokeTestResult{
+				FileSystemId: "fs-abcd1234",
+				MountOptions: []string{"tls"},
+				FailedStep:   smokeTestStepMount,
+				Error:        "mount.nfs4: access denied by server",
+			},
+		},
+		{
+			name:         "unmount fails",
+			volumeHandle: "fs-abcd1234",
+			unmountErr:   errors.New("device busy"),
+			expected: SmokeTestResult{
+				FileSystemId: "fs-abcd1234",
+				MountOptions: []string{"tls"},
+				FailedStep:   smokeTestStepUnmount,
+				Error:        "device busy",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter := mocks.NewMockMounter(mockCtrl)
+			tempDir := t.TempDir()
+
+			if tc.expected.FailedStep != smokeTestStepParse {
+				// The temporary directory stands for the volume, where the sentinel file is written
+				mockMounter.EXPECT().Mount(gomock.Any(), gomock.Any(), "efs", tc.expected.MountOptions).Return(tc.mountErr)
+				if tc.mountErr == nil {
+					mockMounter.EXPECT().Unmount(gomock.Any()).Return(tc.unmountErr)
+				}
+			}
+
+			out := &bytes.Buffer{}
+			watchdog := &smokeTestWatchdog{}
+			err := runSmokeTest(mockMounter, watchdog, tempDir, tc.volumeHandle, tc.mountOptions, out)
+			if tc.expected.Success != (err == nil) {
+				t.Fatalf("Expected success: %v, got %v", tc.expected.Success, err)
+			}
+			actual := SmokeTestResult{}
+			if err := json.Unmarshal(out.Bytes(), &actual); err != nil {
+				t.Fatalf("Expected a JSON result, got %q: %v", out.String(), err)
+			}
+			if actual.Time == "" || (tc.expected.Success && actual.MountDurationSeconds <= 0) {
+				t.Fatalf("Expected the time and mount duration, got %+v", actual)
+			}
+			if tc.expected.FailedStep == smokeTestStepParse {
+				if actual.Error == "" {
+					t.Fatal("Expected the parse error")
+				}
+				tc.expected.Error = actual.Error
+			}
+			tc.expected.VolumeHandle = tc.volumeHandle
+			actual.Time, actual.MountDurationSeconds = "", 0
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Expected result %+v, got %+v", tc.expected, actual)
+			}
+
+			// The watchdog runs during the mount, once the volume handle is parsed
+			if running := tc.expected.FailedStep != smokeTestStepParse; watchdog.started != running || watchdog.stopped != running {
+				t.Fatalf("Expected the watchdog to be started and stopped: %v, got %+v", running, watchdog)
+			}
+
+			// The sentinel file is removed, and the mount point once unmounted
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.unmountErr == nil && len(entries) != 0 {
+				t.Fatalf("Expected the temporary directory to be empty, got %v", entries)
+			}
+		})
+	}
+}
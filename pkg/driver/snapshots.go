@@ -0,0 +1,320 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// SnapshotNameTagKey records the name of the CSI snapshot of the recovery points created by the driver
+	SnapshotNameTagKey = "efs.csi.aws.com/snapshot-name"
+	// SnapshotSourceVolumeTagKey records the volume of the CSI snapshot of the recovery points created by the driver
+	SnapshotSourceVolumeTagKey = "efs.csi.aws.com/source-volume-id"
+)
+
+// backupSnapshots takes the CSI snapshots of the volumes as recovery points of AWS Backup of their file system,
+// in a backup vault of the account and region of the controller. The snapshot of a volume of an access point or
+// subpath would be a backup of the whole file system, with the data of the other volumes of the file system, so
+// only the volumes of whole file systems have snapshots unless subpathVolumes is set. A nil backupSnapshots is
+// valid and takes no snapshots.
+type backupSnapshots struct {
+	backup         cloud.Backup
+	vaultName      string
+	iamRoleArn     string
+	subpathVolumes bool
+
+	// sourceVolumes are the source volume tags of the recovery points of the vault by ARN, empty for the
+	// recovery points that are not snapshots of the driver, so that ListSnapshots lists the tags of each
+	// recovery point once. The tags of the recovery points of the driver do not change.
+	mu            sync.Mutex
+	sourceVolumes map[string]string
+}
+
+// newBackupSnapshots returns the snapshots backed up to the vault by AWS Backup, which assumes the IAM role,
+// or nil if the vault is empty. The volumes of access points and subpaths have snapshots if subpathVolumes is set.
+func newBackupSnapshots(backup cloud.Backup, vaultName, iamRoleArn string, subpathVolumes bool) *backupSnapshots {
+	if vaultName == "" {
+		return nil
+	}
+	return &backupSnapshots{
+		backup:         backup,
+		vaultName:      vaultName,
+		iamRoleArn:     iamRoleArn,
+		subpathVolumes: subpathVolumes,
+		sourceVolumes:  map[string]string{},
+	}
+}
+
+// sourceVolume returns the source volume tag of the recovery point, empty if it is not a snapshot of the driver,
+// or ErrNotFound if it was deleted since listed. The recovery points of backup plans are not snapshots of the
+// driver, whose backup jobs are on-demand.
+func (s *backupSnapshots) sourceVolume(ctx context.Context, recoveryPoint *cloud.RecoveryPoint) (string, error) {
+	if recoveryPoint.BackupPlanId != "" {
+		return "", nil
+	}
+	s.mu.Lock()
+	volumeId, ok := s.sourceVolumes[recoveryPoint.RecoveryPointArn]
+	s.mu.Unlock()
+	if ok {
+		return volumeId, nil
+	}
+	tags, err := s.backup.ListTags(ctx, recoveryPoint.RecoveryPointArn)
+	if err != nil {
+		return "", err
+	}
+	s.setSourceVolume(recoveryPoint.RecoveryPointArn, tags[SnapshotSourceVolumeTagKey])
+	return tags[SnapshotSourceVolumeTagKey], nil
+}
+
+func (s *backupSnapshots) setSourceVolume(recoveryPointArn, volumeId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sourceVolumes[recoveryPointArn] = volumeId
+}
+
+func (s *backupSnapshots) forget(recoveryPointArn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sourceVolumes, recoveryPointArn)
+}
+
+// snapshotId returns the ID of the snapshot of the recovery point, <vault name>/<recovery point ARN>
+func snapshotId(vaultName, recoveryPointArn string) string {
+	return vaultName + "/" + recoveryPointArn
+}
+
+// parseSnapshotId returns the vault and recovery point of the snapshot, or false if the ID is not a snapshot ID
+// of the driver. The vault names have no slashes.
+func parseSnapshotId(snapshotId string) (vaultName, recoveryPointArn string, ok bool) {
+	tokens := strings.SplitN(snapshotId, "/", 2)
+	if len(tokens) != 2 || tokens[0] == "" || !cloud.IsArn(tokens[1]) {
+		return "", "", false
+	}
+	return tokens[0], tokens[1], true
+}
+
+// snapshotSourceTag returns the value of the source volume tag of the snapshots of the volume. The v2 volume
+// handles are tagged in the legacy format, as the tag values may not have '?' or '&'. They lose no region,
+// the snapshots being of the file systems of the region of the controller.
+func snapshotSourceTag(volumeId string) string {
+	if !strings.HasPrefix(volumeId, volumeHandleV2Prefix) {
+		return volumeId
+	}
+	if handle, err := parseVolumeHandleV2(volumeId); err == nil {
+		return handle.legacy()
+	}
+	return volumeId
+}
+
+func recoveryPointSnapshot(vaultName string, recoveryPoint *cloud.RecoveryPoint, sourceVolumeId string) *csi.Snapshot {
+	snapshot := &csi.Snapshot{
+		SnapshotId:     snapshotId(vaultName, recoveryPoint.RecoveryPointArn),
+		SourceVolumeId: sourceVolumeId,
+		SizeBytes:      recoveryPoint.SizeBytes,
+		ReadyToUse:     recoveryPoint.Ready(),
+	}
+	if !recoveryPoint.CreationTime.IsZero() {
+		snapshot.CreationTime = timestamppb.New(recoveryPoint.CreationTime)
+	}
+	return snapshot
+}
+
+func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	klog.V(4).Infof("CreateSnapshot: called with args %+v", util.SanitizeRequest(*req))
+	if d.snapshots == nil {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	name, volumeId := req.GetName(), req.GetSourceVolumeId()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot name not provided")
+	}
+	if volumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Source volume ID not provided")
+	}
+	fsId, subpath, apId, err := parseVolumeId(volumeId)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "Volume %v not found: %v", volumeId, err)
+	}
+	if (apId != "" || (subpath != "" && subpath != "/")) && !d.snapshots.subpathVolumes {
+		return nil, status.Errorf(codes.FailedPrecondition, "Volume %v is an access point or subpath of file system %v, whose snapshot would be a backup of the whole file system, with the data of its other volumes. Set snapshot-subpath-volumes to snapshot it.", volumeId, fsId)
+	}
+
+	fileSystem, err := d.cloud.DescribeFileSystem(ctx, fsId)
+	if err == cloud.ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "File system %v of volume %v not found, only the volumes of the file systems of the account and region of the controller have snapshots", fsId, volumeId)
+	}
+	if err != nil {
+		return nil, snapshotError(err, "describe file system "+fsId)
+	}
+
+	tags := map[string]string{
+		DefaultTagKey:              DefaultTagValue,
+		SnapshotNameTagKey:         name,
+		SnapshotSourceVolumeTagKey: snapshotSourceTag(volumeId),
+	}
+	if d.clusterId != "" {
+		tags[cloud.ClusterIdTagKey] = d.clusterId
+	}
+	for k, v := range d.tags {
+		tags[k] = v
+	}
+	// The name of the snapshot is the idempotency token, so that the retries of CreateSnapshot, until the
+	// snapshot is ready, find the backup job of the first call
+	recoveryPoint, err := d.snapshots.backup.StartBackup(ctx, d.snapshots.vaultName, name, fileSystem.FileSystemArn, d.snapshots.iamRoleArn, tags)
+	if err != nil {
+		return nil, snapshotError(err, "back up file system "+fsId)
+	}
+	if recoveryPoint.ResourceArn != "" && recoveryPoint.ResourceArn != fileSystem.FileSystemArn {
+		return nil, status.Errorf(codes.AlreadyExists, "Snapshot %v is the backup of file system %v instead of %v", name, recoveryPoint.ResourceArn, fileSystem.FileSystemArn)
+	}
+	d.snapshots.setSourceVolume(recoveryPoint.RecoveryPointArn, tags[SnapshotSourceVolumeTagKey])
+	if recoveryPoint.Failed() {
+		return nil, status.Errorf(codes.Internal, "Backup of volume %v to recovery point %v is %v: %v", volumeId, recoveryPoint.RecoveryPointArn, recoveryPoint.Status, recoveryPoint.StatusMessage)
+	}
+	return &csi.CreateSnapshotResponse{Snapshot: recoveryPointSnapshot(d.snapshots.vaultName, recoveryPoint, volumeId)}, nil
+}
+
+func (d *Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	klog.V(4).Infof("DeleteSnapshot: called with args %+v", util.SanitizeRequest(*req))
+	if d.snapshots == nil {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	if req.GetSnapshotId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID not provided")
+	}
+	vaultName, recoveryPointArn, ok := parseSnapshotId(req.GetSnapshotId())
+	if !ok {
+		klog.Warningf("DeleteSnapshot: %v is not a snapshot of the driver, nothing to delete", req.GetSnapshotId())
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+	err := d.snapshots.backup.DeleteRecoveryPoint(ctx, vaultName, recoveryPointArn)
+	if err == nil || err == cloud.ErrNotFound {
+		d.snapshots.forget(recoveryPointArn)
+	}
+	if err == cloud.ErrNotFound {
+		klog.V(4).Infof("DeleteSnapshot: recovery point %v not found, assuming it is already deleted", recoveryPointArn)
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+	if err != nil {
+		return nil, snapshotError(err, "delete recovery point "+recoveryPointArn)
+	}
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+func (d *Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	klog.V(4).Infof("ListSnapshots: called with args %+v", util.SanitizeRequest(*req))
+	if d.snapshots == nil {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	sourceVolumeId := req.GetSourceVolumeId()
+
+	if req.GetSnapshotId() != "" {
+		vaultName, recoveryPointArn, ok := parseSnapshotId(req.GetSnapshotId())
+		if !ok {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		recoveryPoint, err := d.snapshots.backup.DescribeRecoveryPoint(ctx, vaultName, recoveryPointArn)
+		if err == cloud.ErrNotFound {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if err != nil {
+			return nil, snapshotError(err, "describe recovery point "+recoveryPointArn)
+		}
+		volumeId := recoveryPoint.Tags[SnapshotSourceVolumeTagKey]
+		if sourceVolumeId != "" {
+			if volumeId != snapshotSourceTag(sourceVolumeId) {
+				return &csi.ListSnapshotsResponse{}, nil
+			}
+			volumeId = sourceVolumeId
+		}
+		return &csi.ListSnapshotsResponse{Entries: []*csi.ListSnapshotsResponse_Entry{
+			{Snapshot: recoveryPointSnapshot(vaultName, recoveryPoint, volumeId)},
+		}}, nil
+	}
+
+	// The recovery points of the source volume are the ones of its file system
+	var fileSystemArn string
+	if sourceVolumeId != "" {
+		fsId, _, _, err := parseVolumeId(sourceVolumeId)
+		if err != nil {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		fileSystem, err := d.cloud.DescribeFileSystem(ctx, fsId)
+		if err == cloud.ErrNotFound {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if err != nil {
+			return nil, snapshotError(err, "describe file system "+fsId)
+		}
+		fileSystemArn = fileSystem.FileSystemArn
+	}
+	recoveryPoints, nextToken, err := d.snapshots.backup.ListRecoveryPoints(ctx, d.cloud.GetMetadata().GetRegion(), d.snapshots.vaultName, fileSystemArn, req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		if req.GetStartingToken() != "" && !errors.Is(err, cloud.ErrThrottled) && err != cloud.ErrAccessDenied && err != cloud.ErrDeadlineExceeded {
+			return nil, status.Errorf(codes.Aborted, "Failed to list the recovery points from token %v: %v", req.GetStartingToken(), err)
+		}
+		return nil, snapshotError(err, "list the recovery points of backup vault "+d.snapshots.vaultName)
+	}
+	res := &csi.ListSnapshotsResponse{NextToken: nextToken}
+	for _, recoveryPoint := range recoveryPoints {
+		volumeId, err := d.snapshots.sourceVolume(ctx, recoveryPoint)
+		if err == cloud.ErrNotFound {
+			// Deleted since listed
+			continue
+		}
+		if err != nil {
+			return nil, snapshotError(err, "list the tags of recovery point "+recoveryPoint.RecoveryPointArn)
+		}
+		// The other recovery points of the vault are not snapshots of the driver
+		if volumeId == "" || (sourceVolumeId != "" && volumeId != snapshotSourceTag(sourceVolumeId)) {
+			continue
+		}
+		if sourceVolumeId != "" {
+			volumeId = sourceVolumeId
+		}
+		res.Entries = append(res.Entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: recoveryPointSnapshot(d.snapshots.vaultName, recoveryPoint, volumeId),
+		})
+	}
+	return res, nil
+}
+
+func snapshotError(err error, action string) error {
+	switch {
+	case err == cloud.ErrAccessDenied:
+		return status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions to %v: %v", action, err)
+	case err == cloud.ErrDeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, "Timed out trying to %v", action)
+	case errors.Is(err, cloud.ErrInvalidBackupRequest):
+		return status.Errorf(codes.FailedPrecondition, "Failed to %v: %v", action, err)
+	case errors.Is(err, cloud.ErrThrottled):
+		return errorWithRetryDelay(codes.ResourceExhausted, throttledRetryDelay, "Throttled trying to %v: %v", action, err)
+	}
+	return status.Errorf(codes.Internal, "Failed to %v: %v", action, err)
+}
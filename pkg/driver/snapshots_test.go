@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	cloudmocks "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testFileSystemArn    = "arn:aws:elasticfilesystem:us-east-1:111122223333:file-system/fs-abcd1234"
+	testRecoveryPointArn = "arn:aws:backup:us-east-1:111122223333:recovery-point:1EB3B5E7"
+)
+
+// fakeBackup keeps the recovery points of one vault, by ARN
+type fakeBackup struct {
+	recoveryPoints map[string]*cloud.RecoveryPoint
+	deleteErr      error
+	listTagsCalls  int
+}
+
+func (f *fakeBackup) StartBackup(ctx context.Context, vaultName, idempotencyToken, fileSystemArn, iamRoleArn string, tags map[string]string) (*cloud.RecoveryPoint, error) {
+	for _, rp := range f.recoveryPoints {
+		if rp.Tags[SnapshotNameTagKey] == idempotencyToken {
+			return rp, nil
+		}
+	}
+	rp := &cloud.RecoveryPoint{RecoveryPointArn: testRecoveryPointArn, ResourceArn: fileSystemArn, Status: "RUNNING", Tags: tags}
+	f.recoveryPoints[rp.RecoveryPointArn] = rp
+	return rp, nil
+}
+
+func (f *fakeBackup) DescribeRecoveryPoint(ctx context.Context, vaultName, recoveryPointArn string) (*cloud.RecoveryPoint, error) {
+	if rp, ok := f.recoveryPoints[recoveryPointArn]; ok {
+		return rp, nil
+	}
+	return nil, cloud.ErrNotFound
+}
+
+func (f *fakeBackup) DeleteRecoveryPoint(ctx context.Context, vaultName, recoveryPointArn string) error {
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	if _, ok := f.recoveryPoints[recoveryPointArn]; !ok {
+		return cloud.ErrNotFound
+	}
+	delete(f.recoveryPoints, recoveryPointArn)
+	return nil
+}
+
+func (f *fakeBackup) ListRecoveryPoints(ctx context.Context, region, vaultName, resourceArn, nextToken string, maxResults int32) ([]*cloud.RecoveryPoint, string, error) {
+	var rps []*cloud.RecoveryPoint
+	for _, rp := range f.recoveryPoints {
+		if resourceArn != "" && rp.ResourceArn != resourceArn {
+			continue
+		}
+		// Listed without their tags
+		listed := *rp
+		listed.Tags = nil
+		rps = append(rps, &listed)
+	}
+	return rps, "", nil
+}
+
+func (f *fakeBackup) ListTags(ctx context.Context, recoveryPointArn string) (map[string]string, error) {
+	f.listTagsCalls++
+	if rp, ok := f.recoveryPoints[recoveryPointArn]; ok {
+		return rp.Tags, nil
+	}
+	return nil, cloud.ErrNotFound
+}
+
+func TestSnapshots(t *testing.T) {
+	const volumeId = "fs-abcd1234::fsap-abcd1234"
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	backup := &fakeBackup{recoveryPoints: map[string]*cloud.RecoveryPoint{
+		// Recovery points of the vault that are not snapshots of the driver
+		"arn:aws:backup:us-east-1:111122223333:recovery-point:other": {RecoveryPointArn: "arn:aws:backup:us-east-1:111122223333:recovery-point:other", Status: cloud.BackupStateCompleted},
+		"arn:aws:backup:us-east-1:111122223333:recovery-point:plan":  {RecoveryPointArn: "arn:aws:backup:us-east-1:111122223333:recovery-point:plan", ResourceArn: testFileSystemArn, BackupPlanId: "plan-1", Status: cloud.BackupStateCompleted},
+	}}
+	driver := &Driver{cloud: mockCloud, clusterId: "cluster-1", snapshots: newBackupSnapshots(backup, "efs-csi", "arn:aws:iam::111122223333:role/backup", true)}
+	ctx := context.Background()
+
+	caps, err := driver.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := caps.Capabilities[len(caps.Capabilities)-1]; last.GetRpc().GetType() != csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS {
+		t.Fatalf("Expected the snapshot capabilities, got %v", caps.Capabilities)
+	}
+
+	// The snapshot is not ready until the backup job completes
+	mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), "fs-abcd1234").Return(&cloud.FileSystem{FileSystemId: "fs-abcd1234", FileSystemArn: testFileSystemArn}, nil).Times(3)
+	req := &csi.CreateSnapshotRequest{Name: "snapshot-1234", SourceVolumeId: volumeId}
+	res, err := driver.CreateSnapshot(ctx, req)
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	expectedId := "efs-csi/" + testRecoveryPointArn
+	if res.Snapshot.SnapshotId != expectedId || res.Snapshot.SourceVolumeId != volumeId || res.Snapshot.ReadyToUse {
+		t.Fatalf("Unexpected snapshot %+v", res.Snapshot)
+	}
+	if tags := backup.recoveryPoints[testRecoveryPointArn].Tags; tags[SnapshotSourceVolumeTagKey] != volumeId || tags[cloud.ClusterIdTagKey] != "cluster-1" {
+		t.Fatalf("Unexpected tags %v", tags)
+	}
+	backup.recoveryPoints[testRecoveryPointArn].Status = cloud.BackupStateCompleted
+	if res, err = driver.CreateSnapshot(ctx, req); err != nil || !res.Snapshot.ReadyToUse || res.Snapshot.SnapshotId != expectedId {
+		t.Fatalf("Expected the snapshot to be ready, got %+v: %v", res, err)
+	}
+
+	mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
+	mockCloud.EXPECT().GetMetadata().Return(mockMetadata).Times(3)
+	mockMetadata.EXPECT().GetRegion().Return("us-east-1").Times(3)
+	for i := 0; i < 2; i++ {
+		list, err := driver.ListSnapshots(ctx, &csi.ListSnapshotsRequest{})
+		if err != nil || len(list.Entries) != 1 || list.Entries[0].Snapshot.SnapshotId != expectedId {
+			t.Fatalf("Expected the snapshot of the driver only, got %+v: %v", list, err)
+		}
+	}
+	// The tags of the snapshot are known since CreateSnapshot, and the ones of the recovery point of the
+	// backup plan are never listed
+	if backup.listTagsCalls != 1 {
+		t.Fatalf("Expected the tags of the other recovery point to be listed once, got %d calls", backup.listTagsCalls)
+	}
+	list, err := driver.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SourceVolumeId: volumeId})
+	if err != nil || len(list.Entries) != 1 || list.Entries[0].Snapshot.SourceVolumeId != volumeId {
+		t.Fatalf("Expected the snapshot of the volume, got %+v: %v", list, err)
+	}
+	list, err = driver.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SnapshotId: expectedId, SourceVolumeId: "fs-other"})
+	if err != nil || len(list.Entries) != 0 {
+		t.Fatalf("Expected no snapshot of another volume, got %+v: %v", list, err)
+	}
+
+	backup.deleteErr = cloud.ErrInvalidBackupRequest
+	if _, err := driver.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: expectedId}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition, got %v", err)
+	}
+	backup.deleteErr = nil
+	for i := 0; i < 2; i++ {
+		if _, err := driver.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: expectedId}); err != nil {
+			t.Fatalf("DeleteSnapshot failed: %v", err)
+		}
+	}
+	if _, ok := backup.recoveryPoints[testRecoveryPointArn]; ok {
+		t.Fatalf("Expected the recovery point to be deleted")
+	}
+}
+
+func TestSnapshotsDisabled(t *testing.T) {
+	driver := &Driver{}
+	if _, err := driver.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snapshot-1234"}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("Expected Unimplemented, got %v", err)
+	}
+}
+
+func TestCreateSnapshotSubpathVolume(t *testing.T) {
+	driver := &Driver{snapshots: newBackupSnapshots(&fakeBackup{}, "efs-csi", "arn:aws:iam::111122223333:role/backup", false)}
+	for _, volumeId := range []string{"fs-abcd1234::fsap-abcd1234", "fs-abcd1234:/dir"} {
+		_, err := driver.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snapshot-1234", SourceVolumeId: volumeId})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected FailedPrecondition for volume %s, got %v", volumeId, err)
+		}
+	}
+}
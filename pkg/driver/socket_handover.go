@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+)
+
+// shutdownGracePeriod bounds the time for which the requests in flight are drained on termination.
+// It is below the default termination grace period of 30 seconds of the pods.
+const shutdownGracePeriod = 25 * time.Second
+
+// unixSocket is a unix domain socket served by the driver. During a DaemonSet upgrade with maxSurge, the
+// new driver takes over the socket of the registration path while the old driver still serves the
+// requests in flight: the new socket is created next to the old one and renamed over it, so that the
+// path always refers to a socket accepting connections and the kubelet never fails to connect.
+type unixSocket struct {
+	addr     string
+	listener net.Listener
+	// info identifies the socket file created by this driver, to detect that a newer driver replaced it
+	info os.FileInfo
+}
+
+// listenUnixSocket listens on a new socket at addr, atomically replacing any existing socket
+func listenUnixSocket(addr string) (*unixSocket, error) {
+	if err := os.MkdirAll(filepath.Dir(addr), 0750); err != nil {
+		return nil, err
+	}
+	tmp := fmt.Sprintf("%s.%d", addr, os.Getpid())
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not remove unix domain socket %q: %v", tmp, err)
+	}
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is renamed, and only removed by this driver if a newer one did not replace it
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Rename(tmp, addr); err != nil {
+		listener.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("could not move unix domain socket %q to %q: %v", tmp, addr, err)
+	}
+	info, err := os.Stat(addr)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &unixSocket{addr: addr, listener: listener, info: info}, nil
+}
+
+// replaced returns true if the socket file is no longer the one created by this driver
+func (s *unixSocket) replaced() bool {
+	info, err := os.Stat(s.addr)
+	return err != nil || !os.SameFile(info, s.info)
+}
+
+// remove removes the socket file unless a newer driver replaced it
+func (s *unixSocket) remove() {
+	if s.replaced() {
+		klog.Infof("Unix domain socket %s was taken over by another instance of the driver, leaving it", s.addr)
+		return
+	}
+	if err := os.Remove(s.addr); err != nil && !os.IsNotExist(err) {
+		klog.Warningf("Failed to remove unix domain socket %s: %v", s.addr, err)
+	}
+}
+
+// stopOnTermination drains the requests in flight on SIGTERM, for at most the grace period, then removes
+// the versioned sockets. The socket of the registration path is left for the next driver to replace.
+func stopOnTermination(srv *grpc.Server, versioned []*unixSocket) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigs
+		klog.Infof("Received %v, draining the requests in flight", sig)
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownGracePeriod):
+			klog.Warningf("Requests still in flight after %v, stopping", shutdownGracePeriod)
+			srv.Stop()
+		}
+		for _, s := range versioned {
+			s.remove()
+		}
+	}()
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenUnixSocketTakesOver(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "csi", "csi.sock")
+
+	old, err := listenUnixSocket(addr)
+	if err != nil {
+		t.Fatalf("listenUnixSocket failed: %v", err)
+	}
+	defer old.listener.Close()
+
+	// A new driver takes over the socket while the old one still runs
+	current, err := listenUnixSocket(addr)
+	if err != nil {
+		t.Fatalf("listenUnixSocket failed: %v", err)
+	}
+	defer current.listener.Close()
+
+	if !old.replaced() {
+		t.Fatal("Expected the socket of the old driver to be replaced")
+	}
+	if current.replaced() {
+		t.Fatal("Did not expect the socket of the new driver to be replaced")
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := current.listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	conn, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", addr, err)
+	}
+	defer conn.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the new driver to accept the connection")
+	}
+
+	// The old driver leaves the socket of the new one
+	old.remove()
+	if _, err := os.Stat(addr); err != nil {
+		t.Fatalf("Expected socket %s to be left: %v", addr, err)
+	}
+	current.remove()
+	if _, err := os.Stat(addr); !os.IsNotExist(err) {
+		t.Fatalf("Expected socket %s to be removed: %v", addr, err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const socketWatcherInterval = 10 * time.Second
+
+// socketWatcher recreates the unix domain socket of the CSI endpoint when it
+// disappears from disk. This happens when the kubelet plugin directory is wiped,
+// e.g. on node reboot or kubelet reinstall. Once the socket is back, the
+// node-driver-registrar registers the driver again and kubelet re-fetches the
+// node info, without the driver pod having to be restarted.
+type socketWatcher struct {
+	addr     string
+	interval time.Duration
+	// serve starts serving the CSI services on a new listener
+	serve  func(net.Listener) error
+	stopCh chan struct{}
+}
+
+func newSocketWatcher(addr string, serve func(net.Listener) error) *socketWatcher {
+	return &socketWatcher{
+		addr:     addr,
+		interval: socketWatcherInterval,
+		serve:    serve,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// start starts the socket watcher
+func (w *socketWatcher) start() {
+	go w.runLoop()
+}
+
+func (w *socketWatcher) runLoop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.check(); err != nil {
+				klog.Warningf("socket watcher: failed to recreate socket %s: %v", w.addr, err)
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// check recreates the socket if it no longer exists on disk.
+func (w *socketWatcher) check() error {
+	_, err := os.Stat(w.addr)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	klog.Warningf("socket watcher: socket %s was removed, recreating it", w.addr)
+	if err := os.MkdirAll(filepath.Dir(w.addr), 0750); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", w.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := w.serve(listener); err != nil {
+			klog.Errorf("socket watcher: failed to serve on %s: %v", w.addr, err)
+		}
+	}()
+	klog.Infof("socket watcher: listening for connections on recreated socket %s", w.addr)
+	return nil
+}
+
+// stop stops the socket watcher
+func (w *socketWatcher) stop() {
+	close(w.stopCh)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSocketWatcherRecreatesRemovedSocket(t *testing.T) {
+	dir := t.TempDir()
+	addr := filepath.Join(dir, "plugins", "efs.csi.aws.com", "csi.sock")
+
+	served := make(chan net.Listener, 1)
+	w := newSocketWatcher(addr, func(l net.Listener) error {
+		served <- l
+		return nil
+	})
+
+	// The plugin directory was wiped, so neither the socket nor its parent exist.
+	if err := w.check(); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	select {
+	case l := <-served:
+		defer l.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the recreated socket to be served")
+	}
+
+	if _, err := os.Stat(addr); err != nil {
+		t.Fatalf("Expected socket %s to be recreated: %v", addr, err)
+	}
+
+	// The socket exists now, so nothing should be served again.
+	if err := w.check(); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	select {
+	case <-served:
+		t.Fatal("Did not expect an existing socket to be recreated")
+	default:
+	}
+}
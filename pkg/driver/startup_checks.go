@@ -0,0 +1,285 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+)
+
+// Exit codes of the startup checks, one per prerequisite, so that the exit code of a restarting container
+// tells which prerequisite is missing
+const (
+	StartupCheckConfigDirExitCode   = 10
+	StartupCheckSocketExitCode      = 11
+	StartupCheckIMDSExitCode        = 12
+	StartupCheckIRSAExitCode        = 13
+	StartupCheckMountHelperExitCode = 14
+)
+
+const (
+	startupCheckPassed  = "ok"
+	startupCheckFailed  = "FAILED"
+	startupCheckSkipped = "skipped"
+
+	startupCheckIMDSTimeout = 5 * time.Second
+
+	// terminationMessagePath is where kubelet reads the termination message of the container from, shown in
+	// the last state of the container in the pod status
+	terminationMessagePath = "/dev/termination-log"
+)
+
+// StartupCheckOptions are the prerequisites checked by RunStartupChecks
+type StartupCheckOptions struct {
+	// EtcAmazonEfs is the efs-utils config directory set up by InitConfigDir
+	EtcAmazonEfs string
+	// ConfigDirErr is the error returned by InitConfigDir, if any
+	ConfigDirErr error
+	// Endpoints are the CSI endpoints served by the driver, empty ones are ignored
+	Endpoints     []string
+	RequireIMDSv2 bool
+	Mode          Mode
+}
+
+type startupCheckResult struct {
+	name     string
+	status   string
+	exitCode int
+	detail   string
+}
+
+// startupChecks checks the prerequisites of the driver before it serves, instead of letting the first
+// request or the first mount fail on them
+type startupChecks struct {
+	options                StartupCheckOptions
+	mountHelperPath        string
+	imdsEndpoint           string
+	terminationMessagePath string
+}
+
+// RunStartupChecks checks the prerequisites of the mode of the driver: the efs-utils config directory is
+// writable, the unix domain sockets of the endpoints can be created, the web identity token of IAM roles for
+// service accounts is readable or the instance metadata service is reachable when the driver needs them, and
+// the efs-utils mount helper is installed on the nodes. It prints a summary table of the checks to out and
+// returns the exit code of the first failed check, or 0 if all passed. The failed checks are also written
+// to the termination message of the container.
+func RunStartupChecks(options StartupCheckOptions, out io.Writer) int {
+	c := &startupChecks{
+		options:                options,
+		mountHelperPath:        DefaultMountHelperPath,
+		imdsEndpoint:           cloud.DefaultIMDSEndpoint,
+		terminationMessagePath: terminationMessagePath,
+	}
+	return c.run(out)
+}
+
+func (c *startupChecks) run(out io.Writer) int {
+	results := []startupCheckResult{
+		c.checkConfigDir(),
+		c.checkSockets(),
+		c.checkIRSA(),
+		c.checkIMDS(),
+		c.checkMountHelper(),
+	}
+
+	exitCode := 0
+	var summary, failures bytes.Buffer
+	w := tabwriter.NewWriter(&summary, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tEXIT CODE\tDETAIL")
+	for _, result := range results {
+		code := "-"
+		if result.status == startupCheckFailed {
+			code = fmt.Sprint(result.exitCode)
+			if exitCode == 0 {
+				exitCode = result.exitCode
+			}
+			klog.Errorf("Startup check %s failed: %s", result.name, result.detail)
+			fmt.Fprintf(&failures, "startup check %s failed (exit code %d): %s\n", result.name, result.exitCode, result.detail)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.name, result.status, code, result.detail)
+	}
+	w.Flush()
+	fmt.Fprint(out, summary.String())
+
+	if failures.Len() > 0 {
+		c.writeTerminationMessage(failures.Bytes())
+	}
+	return exitCode
+}
+
+// writeTerminationMessage writes the message to the termination message file if kubelet mounted one
+func (c *startupChecks) writeTerminationMessage(message []byte) {
+	if c.terminationMessagePath == "" {
+		return
+	}
+	if _, err := os.Stat(c.terminationMessagePath); err != nil {
+		return
+	}
+	if err := os.WriteFile(c.terminationMessagePath, message, 0644); err != nil {
+		klog.Warningf("Failed to write the termination message to %s: %v", c.terminationMessagePath, err)
+	}
+}
+
+func (c *startupChecks) checkConfigDir() startupCheckResult {
+	result := startupCheckResult{name: "config-dir", exitCode: StartupCheckConfigDirExitCode}
+	if c.options.ConfigDirErr != nil {
+		return result.fail("%v", c.options.ConfigDirErr)
+	}
+	f, err := os.CreateTemp(c.options.EtcAmazonEfs, ".startup-check-")
+	if err != nil {
+		return result.fail("%s is not writable: %v", c.options.EtcAmazonEfs, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return result.pass("%s is writable", c.options.EtcAmazonEfs)
+}
+
+func (c *startupChecks) checkSockets() startupCheckResult {
+	result := startupCheckResult{name: "socket", exitCode: StartupCheckSocketExitCode}
+	if c.options.Mode == SmokeTestMode {
+		return result.skip("no endpoint is served in %s mode", c.options.Mode)
+	}
+	var addrs []string
+	for _, endpoint := range c.options.Endpoints {
+		if endpoint == "" {
+			continue
+		}
+		scheme, addr, err := util.ParseEndpoint(endpoint)
+		if err != nil {
+			return result.fail("invalid endpoint %s: %v", endpoint, err)
+		}
+		if scheme != "unix" {
+			continue
+		}
+		// The socket is created next to its address and renamed, as listenUnixSocket does
+		if err := os.MkdirAll(filepath.Dir(addr), 0750); err != nil {
+			return result.fail("cannot create the directory of %s: %v", addr, err)
+		}
+		listener, err := net.Listen("unix", fmt.Sprintf("%s.%d", addr, os.Getpid()))
+		if err != nil {
+			return result.fail("cannot create unix domain socket %s: %v", addr, err)
+		}
+		listener.Close()
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return result.skip("no unix domain socket endpoint")
+	}
+	return result.pass("%v can be created", addrs)
+}
+
+func (c *startupChecks) checkIRSA() startupCheckResult {
+	result := startupCheckResult{name: "irsa", exitCode: StartupCheckIRSAExitCode}
+	if !c.needsCredentials() {
+		return result.skip("no AWS credentials needed in %s mode", c.options.Mode)
+	}
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if tokenFile == "" {
+		return result.skip("AWS_WEB_IDENTITY_TOKEN_FILE is not set")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return result.fail("web identity token of role %s is not readable: %v", os.Getenv("AWS_ROLE_ARN"), err)
+	}
+	if len(bytes.TrimSpace(token)) == 0 {
+		return result.fail("web identity token file %s of role %s is empty", tokenFile, os.Getenv("AWS_ROLE_ARN"))
+	}
+	return result.pass("web identity token of role %s is readable", os.Getenv("AWS_ROLE_ARN"))
+}
+
+func (c *startupChecks) checkIMDS() startupCheckResult {
+	result := startupCheckResult{name: "imds", exitCode: StartupCheckIMDSExitCode}
+	if cloud.RunsInECS() {
+		return result.skip("the metadata and credentials come from the ECS task metadata endpoint")
+	}
+	if c.options.RequireIMDSv2 {
+		if err := cloud.CheckIMDSv2(context.Background(), c.imdsEndpoint, startupCheckIMDSTimeout); err != nil {
+			return result.fail("%v", err)
+		}
+		return result.pass("IMDSv2 token fetched from %s", c.imdsEndpoint)
+	}
+	if !c.needsCredentials() {
+		return result.skip("the metadata can come from the Kubernetes API in %s mode", c.options.Mode)
+	}
+	if source := credentialsEnvSource(); source != "" {
+		return result.skip("the credentials come from %s", source)
+	}
+	if err := cloud.CheckIMDSReachable(context.Background(), c.imdsEndpoint, startupCheckIMDSTimeout); err != nil {
+		return result.fail("the credentials come from the instance profile, but %v", err)
+	}
+	return result.pass("%s is reachable", c.imdsEndpoint)
+}
+
+func (c *startupChecks) checkMountHelper() startupCheckResult {
+	result := startupCheckResult{name: "mount-helper", exitCode: StartupCheckMountHelperExitCode}
+	if !c.options.Mode.servesNode() {
+		return result.skip("no volume is mounted in %s mode", c.options.Mode)
+	}
+	info, err := os.Stat(c.mountHelperPath)
+	if err != nil {
+		return result.fail("efs-utils mount helper %s is not installed: %v", c.mountHelperPath, err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return result.fail("efs-utils mount helper %s is not an executable file", c.mountHelperPath)
+	}
+	return result.pass("efs-utils mount helper %s is installed", c.mountHelperPath)
+}
+
+// needsCredentials returns true if the mode calls the EFS API
+func (c *startupChecks) needsCredentials() bool {
+	return c.options.Mode.servesController() && c.options.Mode != SmokeTestMode
+}
+
+// credentialsEnvSource returns the credentials set by the environment instead of the instance profile, if any
+func credentialsEnvSource() string {
+	switch {
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		return "IAM roles for service accounts"
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "", os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "":
+		return "the container credentials endpoint"
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "":
+		return "AWS_ACCESS_KEY_ID"
+	}
+	return ""
+}
+
+func (r startupCheckResult) pass(format string, args ...interface{}) startupCheckResult {
+	r.status, r.detail = startupCheckPassed, fmt.Sprintf(format, args...)
+	return r
+}
+
+func (r startupCheckResult) fail(format string, args ...interface{}) startupCheckResult {
+	r.status, r.detail = startupCheckFailed, fmt.Sprintf(format, args...)
+	return r
+}
+
+func (r startupCheckResult) skip(format string, args ...interface{}) startupCheckResult {
+	r.status, r.detail = startupCheckSkipped, fmt.Sprintf(format, args...)
+	return r
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartupChecks(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("token"))
+	}))
+	defer imds.Close()
+	// Nothing listens on the port of a closed listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	unreachableIMDS := "http://" + listener.Addr().String()
+
+	testCases := []struct {
+		name             string
+		mode             Mode
+		configDirErr     error
+		readOnlyDir      bool
+		noMountHelper    bool
+		imdsEndpoint     string
+		requireIMDSv2    bool
+		tokenFile        string
+		expectedExitCode int
+		expectedFailures []string
+	}{
+		{
+			name: "all passed",
+			mode: AllMode,
+		},
+		{
+			name:             "config dir not set up",
+			mode:             NodeMode,
+			configDirErr:     errors.New("unable to create directory"),
+			expectedExitCode: StartupCheckConfigDirExitCode,
+			expectedFailures: []string{"config-dir"},
+		},
+		{
+			name:             "mount helper not installed",
+			mode:             NodeMode,
+			noMountHelper:    true,
+			expectedExitCode: StartupCheckMountHelperExitCode,
+			expectedFailures: []string{"mount-helper"},
+		},
+		{
+			name:          "mount helper not needed by the controller",
+			mode:          ControllerMode,
+			noMountHelper: true,
+		},
+		{
+			name:             "instance metadata service unreachable",
+			mode:             ControllerMode,
+			imdsEndpoint:     unreachableIMDS,
+			expectedExitCode: StartupCheckIMDSExitCode,
+			expectedFailures: []string{"imds"},
+		},
+		{
+			name:         "instance metadata service not needed by the node",
+			mode:         NodeMode,
+			imdsEndpoint: unreachableIMDS,
+		},
+		{
+			name:             "instance metadata service required by the node",
+			mode:             NodeMode,
+			imdsEndpoint:     unreachableIMDS,
+			requireIMDSv2:    true,
+			expectedExitCode: StartupCheckIMDSExitCode,
+			expectedFailures: []string{"imds"},
+		},
+		{
+			name:         "instance metadata service not needed with IRSA",
+			mode:         ControllerMode,
+			imdsEndpoint: unreachableIMDS,
+			tokenFile:    "token",
+		},
+		{
+			name:             "IRSA token not readable",
+			mode:             ControllerMode,
+			tokenFile:        "missing",
+			expectedExitCode: StartupCheckIRSAExitCode,
+			expectedFailures: []string{"irsa"},
+		},
+		{
+			name:             "first failure sets the exit code",
+			mode:             AllMode,
+			configDirErr:     errors.New("unable to create directory"),
+			noMountHelper:    true,
+			expectedExitCode: StartupCheckConfigDirExitCode,
+			expectedFailures: []string{"config-dir", "mount-helper"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configDir := filepath.Join(dir, "efs")
+			if err := os.Mkdir(configDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			mountHelper := filepath.Join(dir, "mount.efs")
+			if !tc.noMountHelper {
+				if err := os.WriteFile(mountHelper, []byte("#!/usr/bin/env python3\n"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tokenPath := filepath.Join(dir, "token")
+			if err := os.WriteFile(tokenPath, []byte("eyJhbGciOiJSUzI1NiJ9\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+			if tc.tokenFile != "" {
+				t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", filepath.Join(dir, tc.tokenFile))
+			}
+			t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+			t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+			t.Setenv("AWS_ACCESS_KEY_ID", "")
+			t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "")
+			terminationLog := filepath.Join(dir, "termination-log")
+			if err := os.WriteFile(terminationLog, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			imdsEndpoint := tc.imdsEndpoint
+			if imdsEndpoint == "" {
+				imdsEndpoint = imds.URL
+			}
+
+			c := &startupChecks{
+				options: StartupCheckOptions{
+					EtcAmazonEfs:  configDir,
+					ConfigDirErr:  tc.configDirErr,
+					Endpoints:     []string{"unix:" + filepath.Join(dir, "csi", "csi.sock"), ""},
+					RequireIMDSv2: tc.requireIMDSv2,
+					Mode:          tc.mode,
+				},
+				mountHelperPath:        mountHelper,
+				imdsEndpoint:           imdsEndpoint,
+				terminationMessagePath: terminationLog,
+			}
+			var out bytes.Buffer
+			exitCode := c.run(&out)
+			if exitCode != tc.expectedExitCode {
+				t.Fatalf("Expected exit code %d, got %d:\n%s", tc.expectedExitCode, exitCode, out.String())
+			}
+
+			failures := []string{}
+			for _, line := range strings.Split(out.String(), "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 && fields[1] == startupCheckFailed {
+					failures = append(failures, fields[0])
+				}
+			}
+			if strings.Join(failures, ",") != strings.Join(tc.expectedFailures, ",") {
+				t.Fatalf("Expected failed checks %v, got %v:\n%s", tc.expectedFailures, failures, out.String())
+			}
+
+			message, err := os.ReadFile(terminationLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(message) > 0) != (len(tc.expectedFailures) > 0) {
+				t.Fatalf("Expected a termination message only on failure, got %q", message)
+			}
+			if entries, _ := os.ReadDir(filepath.Join(dir, "csi")); len(entries) > 0 {
+				t.Fatalf("Expected the socket probes to be removed, found %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const apiStatusPath = "/status/efs-api"
+
+// startStatusServer serves the retry and backoff state of the EFS API calls of the controller as JSON
+// on the given address in the background
+func startStatusServer(addr string, apiStatus *cloud.APIStatus) {
+	mux := http.NewServeMux()
+	mux.Handle(apiStatusPath, apiStatusHandler(apiStatus))
+	go func() {
+		klog.Infof("Serving EFS API status on %s%s", addr, apiStatusPath)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			klog.Errorf("Status server stopped: %v", err)
+		}
+	}()
+}
+
+func apiStatusHandler(apiStatus *cloud.APIStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(apiStatus.Snapshot()); err != nil {
+			klog.Warningf("Failed to write EFS API status: %v", err)
+		}
+	})
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// EFS limits of the root directory of an access point
+	efsMaxPathDepth  = 5
+	efsMaxPathLength = 100
+)
+
+// SubPathPatternLimits bounds the root directory of the access points of dynamically provisioned volumes,
+// including the basePath and the directory rendered from the subPathPattern.
+type SubPathPatternLimits struct {
+	// MaxDepth is the maximum number of directories of the root directory
+	MaxDepth int
+	// MaxLength is the maximum length of the root directory
+	MaxLength int
+}
+
+// NewSubPathPatternLimits returns the limits, or an error if they exceed the limits of EFS.
+// A limit of 0 defaults to the limit of EFS.
+func NewSubPathPatternLimits(maxDepth, maxLength int) (*SubPathPatternLimits, error) {
+	limits := &SubPathPatternLimits{MaxDepth: efsMaxPathDepth, MaxLength: efsMaxPathLength}
+	if maxDepth < 0 || maxDepth > efsMaxPathDepth {
+		return nil, fmt.Errorf("max sub path depth %d must be between 1 and the EFS limit of %d", maxDepth, efsMaxPathDepth)
+	}
+	if maxLength < 0 || maxLength > efsMaxPathLength {
+		return nil, fmt.Errorf("max sub path length %d must be between 1 and the EFS limit of %d", maxLength, efsMaxPathLength)
+	}
+	if maxDepth != 0 {
+		limits.MaxDepth = maxDepth
+	}
+	if maxLength != 0 {
+		limits.MaxLength = maxLength
+	}
+	return limits, nil
+}
+
+// validate returns an InvalidArgument error if the path exceeds the limits, or the limits of EFS if nil
+func (l *SubPathPatternLimits) validate(proposedPath string) error {
+	maxDepth, maxLength := efsMaxPathDepth, efsMaxPathLength
+	if l != nil {
+		maxDepth, maxLength = l.MaxDepth, l.MaxLength
+	}
+	if len(proposedPath) > maxLength {
+		return status.Errorf(codes.InvalidArgument, "Proposed path '%s' exceeds the limit of %d characters", proposedPath, maxLength)
+	}
+	if depth := len(strings.FieldsFunc(proposedPath, func(r rune) bool { return r == '/' })); depth > maxDepth {
+		return status.Errorf(codes.InvalidArgument, "Proposed path '%s' exceeds the limit of %d directories", proposedPath, maxDepth)
+	}
+	return nil
+}
+
+// subPathPatternContext resolves the variables of a subPathPattern. The claim is only fetched
+// from the Kubernetes API if the pattern refers to its labels, annotations or storage class.
+type subPathPatternContext struct {
+	ctx          context.Context
+	volumeParams map[string]string
+	k8sClient    cloud.KubernetesAPIClient
+	pvc          *corev1.PersistentVolumeClaim
+}
+
+func (c *subPathPatternContext) getPvc() (*corev1.PersistentVolumeClaim, error) {
+	if c.pvc != nil {
+		return c.pvc, nil
+	}
+	name, namespace := c.volumeParams[PvcName], c.volumeParams[PvcNamespace]
+	if name == "" || namespace == "" {
+		return nil, status.Error(codes.InvalidArgument, "subPathPattern refers to the claim, which requires the --extra-create-metadata argument of the external-provisioner")
+	}
+	clientset, err := c.k8sClient()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create Kubernetes client: %v", err)
+	}
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(c.ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to get claim %s/%s: %v", namespace, name, err)
+	}
+	c.pvc = pvc
+	return pvc, nil
+}
+
+// subPathPatternVariable resolves a variable of a subPathPattern. Variables taking a key, written
+// ${.PVC.labels[key]}, are called with the key, and all the other ones with an empty key.
+type subPathPatternVariable struct {
+	hasKey  bool
+	resolve func(c *subPathPatternContext, key string) (string, error)
+}
+
+func volumeParamVariable(param string) subPathPatternVariable {
+	return subPathPatternVariable{
+		resolve: func(c *subPathPatternContext, _ string) (string, error) {
+			return c.volumeParams[param], nil
+		},
+	}
+}
+
+// subPathPatternVariables are the variables that a subPathPattern can refer to
+var subPathPatternVariables = map[string]subPathPatternVariable{
+	".PVC.name":      volumeParamVariable(PvcName),
+	".PVC.namespace": volumeParamVariable(PvcNamespace),
+	".PV.name":       volumeParamVariable(PvName),
+	".PVC.labels": {
+		hasKey: true,
+		resolve: func(c *subPathPatternContext, key string) (string, error) {
+			pvc, err := c.getPvc()
+			if err != nil {
+				return "", err
+			}
+			value, ok := pvc.Labels[key]
+			if !ok {
+				return "", status.Errorf(codes.InvalidArgument, "Claim %s/%s has no label %q", pvc.Namespace, pvc.Name, key)
+			}
+			return value, nil
+		},
+	},
+	".PVC.annotations": {
+		hasKey: true,
+		resolve: func(c *subPathPatternContext, key string) (string, error) {
+			pvc, err := c.getPvc()
+			if err != nil {
+				return "", err
+			}
+			value, ok := pvc.Annotations[key]
+			if !ok {
+				return "", status.Errorf(codes.InvalidArgument, "Claim %s/%s has no annotation %q", pvc.Namespace, pvc.Name, key)
+			}
+			return value, nil
+		},
+	},
+	".SC.name": {
+		resolve: func(c *subPathPatternContext, _ string) (string, error) {
+			pvc, err := c.getPvc()
+			if err != nil {
+				return "", err
+			}
+			if pvc.Spec.StorageClassName == nil {
+				return "", status.Errorf(codes.InvalidArgument, "Claim %s/%s has no storage class", pvc.Namespace, pvc.Name)
+			}
+			return *pvc.Spec.StorageClassName, nil
+		},
+	},
+}
+
+// interpolateRootDirectoryName renders the subPathPattern. Variables are written ${.PVC.name}, or
+// ${.PVC.labels[key]} for those taking a key, and $$ is a literal $. The value of a variable is
+// escaped so that it is a single directory name: any character other than letters, digits, '.',
+// '-' and '_' is replaced with '_', and an empty value renders as empty, as it always has. The
+// rendered path cannot contain '.' or '..' directories.
+func interpolateRootDirectoryName(pattern string, c *subPathPatternContext) (string, error) {
+	invalid := func(reason string) error {
+		return status.Errorf(codes.InvalidArgument,
+			"Path specified \"%v\" contains invalid elements: %s. Can only contain %v", pattern, reason,
+			getSupportedComponentNames())
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "$$"):
+			result.WriteByte('$')
+			i++
+		case strings.HasPrefix(pattern[i:], "${"):
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return "", invalid("unterminated variable")
+			}
+			expr := pattern[i+2 : i+end]
+			i += end
+
+			name, key := expr, ""
+			hasKey := strings.HasSuffix(expr, "]") && strings.Contains(expr, "[")
+			if hasKey {
+				open := strings.IndexByte(expr, '[')
+				name, key = expr[:open], expr[open+1:len(expr)-1]
+			}
+			variable, ok := subPathPatternVariables[name]
+			if !ok || variable.hasKey != hasKey || (hasKey && key == "") {
+				return "", invalid(fmt.Sprintf("unsupported variable ${%s}", expr))
+			}
+			value, err := variable.resolve(c, key)
+			if err != nil {
+				return "", err
+			}
+			value = escapeSubPathValue(value)
+			if value == "." || value == ".." {
+				return "", invalid(fmt.Sprintf("variable ${%s} resolves to the invalid directory name %q", expr, value))
+			}
+			result.WriteString(value)
+		case pattern[i] == '$' || pattern[i] == '{' || pattern[i] == '}':
+			return "", invalid(fmt.Sprintf("unexpected %q, use $$ for a literal $", pattern[i]))
+		default:
+			result.WriteByte(pattern[i])
+		}
+	}
+
+	rendered := result.String()
+	for _, dir := range strings.Split(rendered, "/") {
+		if dir == "." || dir == ".." {
+			return "", invalid(fmt.Sprintf("%q directory", dir))
+		}
+	}
+	return rendered, nil
+}
+
+// escapeSubPathValue replaces the characters that are not safe in a directory name with '_'
+func escapeSubPathValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+func getSupportedComponentNames() []string {
+	var names []string
+	for name, variable := range subPathPatternVariables {
+		if variable.hasKey {
+			name += "[key]"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestSubPathPatternContext(labelValue string) *subPathPatternContext {
+	storageClassName := "efs-sc"
+	clientset := fake.NewSimpleClientset(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "team-a",
+			Name:        "data",
+			Labels:      map[string]string{"app": labelValue},
+			Annotations: map[string]string{"example.com/owner": "alice@example.com"},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClassName},
+	})
+	return &subPathPatternContext{
+		ctx: context.Background(),
+		volumeParams: map[string]string{
+			PvcName:      "data",
+			PvcNamespace: "team-a",
+			PvName:       "pvc-1234",
+		},
+		k8sClient: func() (kubernetes.Interface, error) {
+			return clientset, nil
+		},
+	}
+}
+
+func TestInterpolateRootDirectoryName(t *testing.T) {
+	testCases := []struct {
+		name       string
+		pattern    string
+		labelValue string
+		expected   string
+		expectCode codes.Code
+	}{
+		{
+			name:     "success: volume parameters",
+			pattern:  "${.PVC.namespace}/${.PVC.name}/${.PV.name}",
+			expected: "team-a/data/pvc-1234",
+		},
+		{
+			name:       "success: claim labels, annotations and storage class",
+			pattern:    "${.SC.name}/${.PVC.labels[app]}/${.PVC.annotations[example.com/owner]}",
+			labelValue: "web",
+			expected:   "efs-sc/web/alice_example.com",
+		},
+		{
+			name:     "success: literal dollar",
+			pattern:  "$$HOME-${.PVC.name}",
+			expected: "$HOME-data",
+		},
+		{
+			name:       "success: values cannot introduce directories",
+			pattern:    "${.PVC.labels[app]}",
+			labelValue: "../../etc",
+			expected:   ".._.._etc",
+		},
+		{
+			name:       "success: empty value renders as empty",
+			pattern:    "base/${.PVC.labels[app]}-data",
+			labelValue: "",
+			expected:   "base/-data",
+		},
+		{
+			name:       "fail: value resolves to the parent directory",
+			pattern:    "base/${.PVC.labels[app]}",
+			labelValue: "..",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: pattern refers to the parent directory",
+			pattern:    "../${.PVC.name}",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: unsupported variable",
+			pattern:    "${.PVC.name}/${foo}",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: missing key",
+			pattern:    "${.PVC.labels}",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: unexpected key",
+			pattern:    "${.PVC.name[app]}",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: missing label",
+			pattern:    "${.PVC.labels[team]}",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: unterminated variable",
+			pattern:    "${.PVC.name",
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name:       "fail: stray brace",
+			pattern:    "data}",
+			expectCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := interpolateRootDirectoryName(tc.pattern, newTestSubPathPatternContext(tc.labelValue))
+			if tc.expectCode != codes.OK {
+				if status.Code(err) != tc.expectCode {
+					t.Fatalf("Expected %v, got %v", tc.expectCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to interpolate %q: %v", tc.pattern, err)
+			}
+			if result != tc.expected {
+				t.Fatalf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestInterpolateRootDirectoryNameWithoutClaimMetadata(t *testing.T) {
+	c := &subPathPatternContext{ctx: context.Background(), volumeParams: map[string]string{PvName: "pvc-1234"}}
+	if _, err := interpolateRootDirectoryName("${.SC.name}", c); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	// The claim is only fetched if the pattern refers to it
+	if result, err := interpolateRootDirectoryName("${.PV.name}", c); err != nil || result != "pvc-1234" {
+		t.Fatalf("Expected pvc-1234, got %q: %v", result, err)
+	}
+}
+
+func TestSubPathPatternLimits(t *testing.T) {
+	if _, err := NewSubPathPatternLimits(6, 0); err == nil {
+		t.Fatal("Expected depth above the EFS limit to be rejected")
+	}
+	if _, err := NewSubPathPatternLimits(0, 101); err == nil {
+		t.Fatal("Expected length above the EFS limit to be rejected")
+	}
+	limits, err := NewSubPathPatternLimits(2, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		limits *SubPathPatternLimits
+		path   string
+		valid  bool
+	}{
+		{limits: nil, path: "/a/b/c/d/e", valid: true},
+		{limits: nil, path: "/a/b/c/d/e/f", valid: false},
+		{limits: nil, path: "/" + strings.Repeat("a", 100), valid: false},
+		{limits: limits, path: "/a/b", valid: true},
+		{limits: limits, path: "/a/b/c", valid: false},
+		{limits: limits, path: "/" + strings.Repeat("a", 20), valid: false},
+	}
+	for _, tc := range testCases {
+		err := tc.limits.validate(tc.path)
+		if tc.valid && err != nil {
+			t.Fatalf("Expected %q to be valid, got %v", tc.path, err)
+		}
+		if !tc.valid && status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected %q to be invalid, got %v", tc.path, err)
+		}
+	}
+}
+
+func FuzzInterpolateRootDirectoryName(f *testing.F) {
+	f.Add("${.PVC.namespace}/${.PVC.name}", "web")
+	f.Add("${.PVC.labels[app]}/${.SC.name}", "../..")
+	f.Add("$${.PVC.name}/${.PVC.annotations[example.com/owner]}", "a/b")
+	f.Add("${${}}/./..", "")
+	f.Add("${.PVC.labels[app]", "x")
+
+	f.Fuzz(func(t *testing.T, pattern, labelValue string) {
+		result, err := interpolateRootDirectoryName(pattern, newTestSubPathPatternContext(labelValue))
+		if err != nil {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected InvalidArgument for %q, got %v", pattern, err)
+			}
+			return
+		}
+		for _, dir := range strings.Split(result, "/") {
+			if dir == "." || dir == ".." {
+				t.Fatalf("Pattern %q rendered %q with a %q directory", pattern, result, dir)
+			}
+		}
+		if !strings.Contains(pattern, "$") && result != pattern {
+			t.Fatalf("Pattern %q without variables rendered %q", pattern, result)
+		}
+
+		// A value is always rendered as a single safe directory name
+		label, err := interpolateRootDirectoryName("${.PVC.labels[app]}", newTestSubPathPatternContext(labelValue))
+		if err != nil {
+			return
+		}
+		if label != escapeSubPathValue(labelValue) || strings.ContainsAny(label, "/${}") {
+			t.Fatalf("Label %q rendered as %q", labelValue, label)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+	mount_utils "k8s.io/mount-utils"
+)
+
+// forceUnmountTimeout is how long a temporary mount of an abandoned request may take to unmount before
+// it is unmounted with force
+const forceUnmountTimeout = 10 * time.Second
+
+// withTempMount mounts the file system on target, a temporary path of the controller, for the duration of fn.
+// The mount and fn are abandoned when ctx is done, e.g. when the deadline of the RPC expires, and the error
+// of ctx is returned. The mount is then unmounted with force and target removed in the background, once the
+// mount attempt returns, so that timed out requests leak neither mounts nor directories.
+func (d *Driver) withTempMount(ctx context.Context, fileSystemId, target string, mountOptions []string, fn func(ctx context.Context, target string) error) error {
+	if err := d.mounter.MakeDir(target); err != nil {
+		return fmt.Errorf("could not create dir %q: %v", target, err)
+	}
+
+	mounted := make(chan error, 1)
+	go func() {
+		mounted <- d.mounter.Mount(fileSystemId, target, "efs", mountOptions)
+	}()
+	select {
+	case err := <-mounted:
+		if err != nil {
+			os.Remove(target)
+			return fmt.Errorf("could not mount %q at %q: %v", fileSystemId, target, err)
+		}
+	case <-ctx.Done():
+		klog.Warningf("Abandoning the mount of %q at %q: %v", fileSystemId, target, ctx.Err())
+		go func() {
+			if err := <-mounted; err == nil {
+				d.cleanupTempMount(target, true)
+			} else {
+				os.Remove(target)
+			}
+		}()
+		return ctx.Err()
+	}
+
+	fnErr := fn(ctx, target)
+	if err := d.cleanupTempMount(target, ctx.Err() != nil); err != nil && fnErr == nil {
+		return err
+	}
+	return fnErr
+}
+
+// cleanupTempMount unmounts target, with force if asked and supported by the mounter, and removes it
+func (d *Driver) cleanupTempMount(target string, force bool) error {
+	var err error
+	if forceUnmounter, ok := d.mounter.(mount_utils.MounterForceUnmounter); ok && force {
+		err = forceUnmounter.UnmountWithForce(target, forceUnmountTimeout)
+	} else {
+		err = d.mounter.Unmount(target)
+	}
+	if err != nil {
+		klog.Warningf("Could not unmount %q: %v", target, err)
+		return fmt.Errorf("could not unmount %q: %v", target, err)
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete %q: %v", target, err)
+	}
+	return nil
+}
+
+// cleanupStaleTempMounts unmounts and removes the temporary paths left in dir by a controller that crashed or
+// was killed during a request, before the controller serves requests. The paths are only removed once empty,
+// so that the content of a file system is never deleted when a mount is not detected.
+func (d *Driver) cleanupStaleTempMounts(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("Could not list the temporary mounts in %q: %v", dir, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		target := filepath.Join(dir, entry.Name())
+		notMnt, err := d.mounter.IsLikelyNotMountPoint(target)
+		if err != nil && !mount_utils.IsCorruptedMnt(err) {
+			klog.Warningf("Could not check whether stale temporary path %q is mounted: %v", target, err)
+			tempMountCleanups.WithLabelValues("failed").Inc()
+			continue
+		}
+		if err != nil || !notMnt {
+			if err := d.cleanupTempMount(target, true); err != nil {
+				tempMountCleanups.WithLabelValues("failed").Inc()
+				continue
+			}
+			klog.Infof("Unmounted and removed stale temporary mount %q", target)
+			tempMountCleanups.WithLabelValues("unmounted").Inc()
+			continue
+		}
+		if err := os.Remove(target); err != nil {
+			klog.Warningf("Could not remove stale temporary path %q: %v", target, err)
+			tempMountCleanups.WithLabelValues("failed").Inc()
+			continue
+		}
+		klog.V(4).Infof("Removed stale temporary path %q", target)
+		tempMountCleanups.WithLabelValues("removed").Inc()
+	}
+}
+
+// removeAllWithContext removes path and its children like os.RemoveAll, but stops with the error of ctx
+// as soon as it is done. It returns the size of the regular files removed, even on error.
+func removeAllWithContext(ctx context.Context, path string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var removed int64
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		for _, entry := range entries {
+			n, err := removeAllWithContext(ctx, filepath.Join(path, entry.Name()))
+			removed += n
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+	if info.Mode().IsRegular() {
+		removed += info.Size()
+	}
+	return removed, nil
+}
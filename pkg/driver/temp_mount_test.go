@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestWithTempMount(t *testing.T) {
+	fsId := "fs-abcd1234"
+
+	testCases := []struct {
+		name     string
+		testFunc func(t *testing.T, mockMounter *mocks.MockMounter, target string)
+	}{
+		{
+			name: "Success: fn runs on the mounted target",
+			testFunc: func(t *testing.T, mockMounter *mocks.MockMounter, target string) {
+				mockMounter.EXPECT().MakeDir(target).DoAndReturn(func(target string) error { return os.MkdirAll(target, 0755) })
+				mockMounter.EXPECT().Mount(fsId, target, "efs", gomock.Any()).Return(nil)
+				mockMounter.EXPECT().Unmount(target).Return(nil)
+
+				called := false
+				err := (&Driver{mounter: mockMounter}).withTempMount(context.Background(), fsId, target, nil, func(ctx context.Context, mounted string) error {
+					called = mounted == target
+					return nil
+				})
+				if err != nil || !called {
+					t.Fatalf("Expected fn to be called on %s, got called: %v, err: %v", target, called, err)
+				}
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Fatalf("Expected %s to be removed, got %v", target, err)
+				}
+			},
+		},
+		{
+			name: "Fail: mount error removes the target",
+			testFunc: func(t *testing.T, mockMounter *mocks.MockMounter, target string) {
+				mockMounter.EXPECT().MakeDir(target).DoAndReturn(func(target string) error { return os.MkdirAll(target, 0755) })
+				mockMounter.EXPECT().Mount(fsId, target, "efs", gomock.Any()).Return(errors.New("mount failed"))
+
+				err := (&Driver{mounter: mockMounter}).withTempMount(context.Background(), fsId, target, nil, func(ctx context.Context, mounted string) error {
+					t.Fatal("fn must not be called")
+					return nil
+				})
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Fatalf("Expected %s to be removed, got %v", target, err)
+				}
+			},
+		},
+		{
+			name: "Fail: abandoned mount is cleaned up once it returns",
+			testFunc: func(t *testing.T, mockMounter *mocks.MockMounter, target string) {
+				release := make(chan struct{})
+				unmounted := make(chan struct{})
+				mockMounter.EXPECT().MakeDir(target).DoAndReturn(func(target string) error { return os.MkdirAll(target, 0755) })
+				mockMounter.EXPECT().Mount(fsId, target, "efs", gomock.Any()).DoAndReturn(func(source, target, fstype string, options []string) error {
+					<-release
+					return nil
+				})
+				mockMounter.EXPECT().Unmount(target).DoAndReturn(func(target string) error {
+					close(unmounted)
+					return nil
+				})
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				err := (&Driver{mounter: mockMounter}).withTempMount(ctx, fsId, target, nil, func(ctx context.Context, mounted string) error {
+					t.Fatal("fn must not be called")
+					return nil
+				})
+				if err != context.DeadlineExceeded {
+					t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+				}
+
+				close(release)
+				select {
+				case <-unmounted:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Expected the abandoned mount to be unmounted")
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			tc.testFunc(t, mocks.NewMockMounter(mockCtl), filepath.Join(t.TempDir(), "fsap-abcd1234"))
+		})
+	}
+}
+
+func TestCleanupStaleTempMounts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMounter := mocks.NewMockMounter(mockCtrl)
+	dir := t.TempDir()
+	mounted, corrupted, empty, notEmpty := filepath.Join(dir, "fsap-1"), filepath.Join(dir, "fsap-2"), filepath.Join(dir, "pvc-1"), filepath.Join(dir, "pvc-2")
+	for _, p := range []string{mounted, corrupted, empty, notEmpty} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(notEmpty, "data"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	count := func(result string) float64 { return testutil.ToFloat64(tempMountCleanups.WithLabelValues(result)) }
+	unmounted, removed, failed := count("unmounted"), count("removed"), count("failed")
+
+	mockMounter.EXPECT().IsLikelyNotMountPoint(mounted).Return(false, nil)
+	mockMounter.EXPECT().Unmount(mounted).Return(nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(corrupted).Return(false, &os.PathError{Op: "stat", Path: corrupted, Err: syscall.ESTALE})
+	mockMounter.EXPECT().Unmount(corrupted).Return(nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(empty).Return(true, nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(notEmpty).Return(true, nil)
+	(&Driver{mounter: mockMounter}).cleanupStaleTempMounts(dir)
+
+	for _, p := range []string{mounted, corrupted, empty} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("Expected %s to be removed, got %v", p, err)
+		}
+	}
+	// The content of a path that is not mounted is never deleted
+	if _, err := os.Stat(filepath.Join(notEmpty, "data")); err != nil {
+		t.Fatalf("Expected the content of %s to be kept, got %v", notEmpty, err)
+	}
+	if count("unmounted")-unmounted != 2 || count("removed")-removed != 1 || count("failed")-failed != 1 {
+		t.Fatalf("Unexpected cleanup counts: unmounted %v, removed %v, failed %v",
+			count("unmounted")-unmounted, count("removed")-removed, count("failed")-failed)
+	}
+
+	// A missing directory is not an error
+	(&Driver{mounter: mockMounter}).cleanupStaleTempMounts(filepath.Join(dir, "missing"))
+}
+
+func TestRemoveAllWithContext(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := removeAllWithContext(ctx, root); err != context.Canceled {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("Expected %s to be kept after cancellation: %v", root, err)
+	}
+
+	removed, err := removeAllWithContext(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if removed != 4 {
+		t.Fatalf("Expected 4 bytes removed, got %d", removed)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed, got %v", root, err)
+	}
+	if _, err := removeAllWithContext(context.Background(), root); err != nil {
+		t.Fatalf("Expected no error for a missing path, got %v", err)
+	}
+}
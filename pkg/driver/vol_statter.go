@@ -23,6 +23,16 @@ import (
 	"time"
 )
 
+// volMetricsOptions controls how often the usage of a volume is computed
+type volMetricsOptions struct {
+	// refreshPeriod is the age in minutes after which cached stats are refreshed
+	refreshPeriod float64
+	// fsRateLimit caps the number of concurrent stat routines per file system
+	fsRateLimit int
+	// jitter delays each stat routine by a random duration to spread the load on the file system
+	jitter bool
+}
+
 type volMetrics struct {
 	volPath   string
 	timeStamp time.Time
@@ -38,7 +48,7 @@ var (
 )
 
 type VolStatter interface {
-	computeVolumeMetrics(volId, volPath string, refreshRate float64, fsRateLimit int) (*volMetrics, error)
+	computeVolumeMetrics(volId, volPath string, opts volMetricsOptions) (*volMetrics, error)
 	retrieveFromCache(volId string) (*volMetrics, bool)
 	removeFromCache(volId string)
 }
@@ -50,18 +60,18 @@ func NewVolStatter() VolStatter {
 	return &VolStatterImpl{}
 }
 
-func (v VolStatterImpl) computeVolumeMetrics(volId, volPath string, refreshRate float64, fsRateLimit int) (*volMetrics, error) {
+func (v VolStatterImpl) computeVolumeMetrics(volId, volPath string, opts volMetricsOptions) (*volMetrics, error) {
 	if value, ok := v.retrieveFromCache(volId); ok {
-		if time.Since(value.timeStamp).Minutes() > refreshRate {
+		if time.Since(value.timeStamp).Minutes() > opts.refreshPeriod {
 			// Time to refresh volume stats
-			v.launchVolStatsRoutine(volId, volPath, fsRateLimit)
+			v.launchVolStatsRoutine(volId, volPath, opts)
 		}
 		return value, nil
 	} else {
 		klog.V(4).Infof("Did not find volume metrics in cache for vol ID: %v , vol path: %v. Computing now!", volId, volPath)
 	}
 
-	v.launchVolStatsRoutine(volId, volPath, fsRateLimit)
+	v.launchVolStatsRoutine(volId, volPath, opts)
 
 	// Return nil as kubelet might timeout waiting for volume stats
 	klog.Warningf("Volume metrics computation is underway for Vol ID: %v and metrics are not available yet.", volId)
@@ -92,7 +102,7 @@ func (v VolStatterImpl) removeFromCache(volId string) {
 	mu.Unlock()
 }
 
-func (v VolStatterImpl) launchVolStatsRoutine(volId, volPath string, fsRateLimit int) {
+func (v VolStatterImpl) launchVolStatsRoutine(volId, volPath string, opts volMetricsOptions) {
 	fsId, _, _, err := parseVolumeId(volId)
 	if err != nil {
 		klog.Errorf("Failed to launch Stat routine: Could not parse File System ID from volume Id - %s.", volId)
@@ -103,9 +113,9 @@ func (v VolStatterImpl) launchVolStatsRoutine(volId, volPath string, fsRateLimit
 	if _, ok := volStatterJobTracker[volId]; ok {
 		klog.V(5).Infof("Volume stats computation job is underway for volume Id : %v. Awaiting results", volId)
 	} else {
-		if ok := canStatFS(fsId, fsRateLimit); ok {
+		if ok := canStatFS(fsId, opts.fsRateLimit); ok {
 			volStatterJobTracker[volId] = true
-			go v.computeDiskUsage(fsId, volId, volPath)
+			go v.computeDiskUsage(fsId, volId, volPath, opts.jitter)
 		} else {
 			klog.V(5).Infof("Too many stat routines are running against FS : %s. Retry stat for volume Id: %s later", fsId, volId)
 		}
@@ -113,12 +123,14 @@ func (v VolStatterImpl) launchVolStatsRoutine(volId, volPath string, fsRateLimit
 	mu.Unlock()
 }
 
-func (v VolStatterImpl) computeDiskUsage(fsId, volId, volPath string) {
-	waitTime := wait.Jitter(jitter, 2.0)
-	klog.V(5).Infof("Compute Volume Metrics invoked for Vol ID: %v, Sleeping for %v before execution", volId, waitTime)
+func (v VolStatterImpl) computeDiskUsage(fsId, volId, volPath string, useJitter bool) {
+	if useJitter {
+		waitTime := wait.Jitter(jitter, 2.0)
+		klog.V(5).Infof("Compute Volume Metrics invoked for Vol ID: %v, Sleeping for %v before execution", volId, waitTime)
 
-	//jittered execution
-	time.Sleep(waitTime)
+		//jittered execution
+		time.Sleep(waitTime)
+	}
 
 	used, err := fs.DiskUsage(volPath)
 	if err != nil {
@@ -0,0 +1,322 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// volumeContextValueType describes how the value of a volume context property is validated.
+type volumeContextValueType int
+
+const (
+	volumeContextString volumeContextValueType = iota
+	volumeContextBool
+	volumeContextAbsPath
+	// volumeContextRelPath is a relative path that cannot escape its parent directory
+	volumeContextRelPath
+	// volumeContextPositiveInt is an integer greater than zero
+	volumeContextPositiveInt
+	// volumeContextFloat is a finite non-negative floating point number
+	volumeContextFloat
+	// volumeContextFileSystemArn is the ARN of a file system
+	volumeContextFileSystemArn
+	// volumeContextIPAddress is an IPv4 or IPv6 address
+	volumeContextIPAddress
+	// volumeContextPort is a TCP port, between 1 and 65535
+	volumeContextPort
+	// volumeContextIPFamily is one of the ipFamilies
+	volumeContextIPFamily
+)
+
+// volumeContextProperty declares a volume context property accepted by NodePublishVolume.
+type volumeContextProperty struct {
+	// valueType is used to validate the value of the property
+	valueType volumeContextValueType
+	// defaultValue is used when the property is not set
+	defaultValue string
+	// deprecated, if not empty, is logged as a warning when the property is set
+	deprecated string
+	// ignored properties are accepted but never reported back to the caller
+	ignored bool
+	// conflicts lists the properties that cannot be set while this property is enabled
+	conflicts []string
+}
+
+// nodePublishVolumeContext is the schema of the volume context accepted by NodePublishVolume.
+// Keys are matched case-insensitively and must be lower case here.
+var nodePublishVolumeContext = map[string]volumeContextProperty{
+	"path": {
+		valueType:  volumeContextAbsPath,
+		deprecated: "Use of path under volumeAttributes is deprecated. This field will be removed in future release",
+	},
+	"storage.kubernetes.io/csiprovisioneridentity": {
+		ignored: true,
+	},
+	"encryptintransit": {
+		valueType:    volumeContextBool,
+		defaultValue: "true",
+	},
+	MountTargetIp: {
+		valueType: volumeContextIPAddress,
+	},
+	MountTargetPort: {
+		valueType: volumeContextPort,
+		// The TLS tunnel of efs-utils always connects to the NFS port of the mount target
+		conflicts: []string{"encryptintransit"},
+	},
+	IpFamily: {
+		valueType: volumeContextIPFamily,
+	},
+	CrossAccount: {
+		valueType:    volumeContextBool,
+		defaultValue: "false",
+	},
+	VolMetricsRefreshPeriod: {
+		valueType: volumeContextFloat,
+	},
+	VolMetricsFsRateLimit: {
+		valueType: volumeContextPositiveInt,
+	},
+	VolMetricsJitter: {
+		valueType: volumeContextBool,
+	},
+	SubPath: {
+		valueType: volumeContextRelPath,
+	},
+	CreateSubPathIfMissing: {
+		valueType: volumeContextBool,
+	},
+	FileSystemArn: {
+		valueType: volumeContextFileSystemArn,
+	},
+	MountCommand: {
+		ignored: true,
+	},
+	DisableWatchdog: {
+		valueType: volumeContextBool,
+	},
+	VolumeRegion: {
+		valueType: volumeContextString,
+	},
+	DnsNameSuffix: {
+		valueType: volumeContextString,
+		conflicts: []string{CrossAccount},
+	},
+	// The pod of the volume, passed by the kubelet when the CSIDriver object has podInfoOnMount set
+	PodName:                                {ignored: true},
+	PodNamespace:                           {ignored: true},
+	PodUid:                                 {ignored: true},
+	strings.ToLower(PodServiceAccountName): {ignored: true},
+	EphemeralVolume:                        {ignored: true},
+}
+
+// volumeContext holds volume context properties validated against a schema,
+// keyed by their lower case name and with defaults applied.
+type volumeContext map[string]string
+
+// get returns the value of the property and whether it was set or defaulted.
+func (c volumeContext) get(key string) (string, bool) {
+	v, ok := c[key]
+	return v, ok
+}
+
+// getInt returns the value of an integer property. It must only be called for
+// properties declared with volumeContextPositiveInt, which are validated on parse.
+func (c volumeContext) getInt(key string) int {
+	i, _ := strconv.Atoi(c[key])
+	return i
+}
+
+// getFloat returns the value of a floating point property. It must only be called for
+// properties declared with volumeContextFloat, which are validated on parse.
+func (c volumeContext) getFloat(key string) float64 {
+	f, _ := strconv.ParseFloat(c[key], 64)
+	return f
+}
+
+// getBool returns the value of a boolean property. It must only be called for
+// properties declared with volumeContextBool, which are validated on parse.
+func (c volumeContext) getBool(key string) bool {
+	b, _ := strconv.ParseBool(c[key])
+	return b
+}
+
+// parseVolumeContext validates the given volume context against the schema and
+// returns the normalized properties. All violations are reported together in a
+// single InvalidArgument error.
+func parseVolumeContext(schema map[string]volumeContextProperty, attributes map[string]string) (volumeContext, error) {
+	parsed := volumeContext{}
+	var errs []string
+
+	for k, v := range attributes {
+		key := strings.ToLower(k)
+		if strings.HasPrefix(key, ProvisioningDetailsPrefix) {
+			continue
+		}
+		prop, ok := schema[key]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("Volume context property %s not supported.", k))
+			continue
+		}
+		if prop.ignored {
+			continue
+		}
+		if prop.deprecated != "" {
+			klog.Warning(prop.deprecated)
+		}
+		if err := validateVolumeContextValue(k, v, prop.valueType); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		parsed[key] = v
+	}
+
+	for key, prop := range schema {
+		if _, ok := parsed[key]; !ok && prop.defaultValue != "" {
+			parsed[key] = prop.defaultValue
+		}
+	}
+
+	for key, prop := range schema {
+		if !parsed.isEnabled(key, prop) {
+			continue
+		}
+		for _, other := range prop.conflicts {
+			if parsed.isEnabled(other, schema[other]) {
+				errs = append(errs, fmt.Sprintf("Volume context property %q conflicts with %q", key, other))
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		sort.Strings(errs)
+		return nil, status.Error(codes.InvalidArgument, strings.Join(errs, "; "))
+	}
+	return parsed, nil
+}
+
+// isEnabled reports whether a property is set to a value that activates it:
+// true for boolean properties and any non-empty value otherwise.
+func (c volumeContext) isEnabled(key string, prop volumeContextProperty) bool {
+	v, ok := c[key]
+	if !ok {
+		return false
+	}
+	if prop.valueType == volumeContextBool {
+		return c.getBool(key)
+	}
+	return v != ""
+}
+
+func validateVolumeContextValue(key, value string, valueType volumeContextValueType) error {
+	switch valueType {
+	case volumeContextBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("Volume context property %q must be a boolean value: %v", key, err)
+		}
+	case volumeContextAbsPath:
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf("Volume context property %q must be an absolute path", key)
+		}
+	case volumeContextRelPath:
+		if filepath.IsAbs(value) || !filepath.IsLocal(value) {
+			return fmt.Errorf("Volume context property %q must be a relative path within the volume", key)
+		}
+	case volumeContextPositiveInt:
+		if i, err := strconv.Atoi(value); err != nil || i < 1 {
+			return fmt.Errorf("Volume context property %q must be a positive integer", key)
+		}
+	case volumeContextFloat:
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("Volume context property %q must be a non-negative number", key)
+		}
+	case volumeContextFileSystemArn:
+		if _, err := cloud.ParseFileSystemArn(value); err != nil {
+			return fmt.Errorf("Volume context property %q must be the ARN of a file system: %v", key, err)
+		}
+	case volumeContextIPAddress:
+		if net.ParseIP(value) == nil {
+			return fmt.Errorf("Volume context property %q must be an IP address", key)
+		}
+	case volumeContextPort:
+		if i, err := strconv.Atoi(value); err != nil || i < 1 || i > 65535 {
+			return fmt.Errorf("Volume context property %q must be a port between 1 and 65535", key)
+		}
+	case volumeContextIPFamily:
+		if !isIPFamily(value) {
+			return fmt.Errorf("Volume context property %q must be one of %v", key, ipFamilies)
+		}
+	}
+	return nil
+}
+
+// mountCommand returns a mount command equivalent to the mount of the volume by NodePublishVolume with the
+// volume context and the mount flags of the volume capabilities, in a node of the region. The mount target
+// IP address found by the node and the mount option rules of the node are not included.
+func mountCommand(volumeId string, volContext map[string]string, volCaps []*csi.VolumeCapability, region string) string {
+	handle, err := parseVolumeHandle(volumeId)
+	if err != nil {
+		return ""
+	}
+	fsid, subpath, apid := handle.fileSystemId, handle.subpath, handle.accessPointId
+	if subpath == "" {
+		subpath = "/"
+	}
+	options := []string{"tls"}
+	if apid != "" {
+		options = append(options, "accesspoint="+apid)
+	}
+	if ip, ok := volContext[MountTargetIp]; ok {
+		options = append(options, MountTargetIp+"="+ip)
+	}
+	if volContext[CrossAccount] == "true" {
+		options = append(options, CrossAccount)
+	}
+	if handle.region != "" && handle.region != region {
+		options = append(options, "region="+handle.region)
+	}
+	if fsArnValue, ok := volContext[FileSystemArn]; ok {
+		if fsArn, err := cloud.ParseFileSystemArn(fsArnValue); err == nil && fsArn.Region != region && !hasOptionPrefix(options, "region=") {
+			options = append(options, "region="+fsArn.Region)
+		}
+		if !hasOptionPrefix(options, MountTargetIp+"=") && !hasOption(options, CrossAccount) {
+			options = append(options, CrossAccount)
+		}
+	}
+	for _, volCap := range volCaps {
+		for _, f := range volCap.GetMount().GetMountFlags() {
+			if f = strings.ToLower(f); !hasOption(options, f) && !strings.HasPrefix(f, "awscredsuri") {
+				options = append(options, f)
+			}
+		}
+	}
+	return fmt.Sprintf("mount -t efs -o %s %s:%s /mnt/efs", strings.Join(options, ","), fsid, subpath)
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestParseVolumeContext(t *testing.T) {
+	testCases := []struct {
+		name        string
+		attributes  map[string]string
+		expected    volumeContext
+		expectError errtyp
+	}{
+		{
+			name:       "success: defaults applied",
+			attributes: map[string]string{},
+			expected:   volumeContext{"encryptintransit": "true", CrossAccount: "false"},
+		},
+		{
+			name: "success: keys are case-insensitive and ignored keys are dropped",
+			attributes: map[string]string{
+				"encryptInTransit": "false",
+				"storage.kubernetes.io/csiProvisionerIdentity": "efs.csi.aws.com",
+				"MountTargetIp": "127.0.0.1",
+			},
+			expected: volumeContext{"encryptintransit": "false", CrossAccount: "false", MountTargetIp: "127.0.0.1"},
+		},
+		{
+			name: "success: provisioning details are dropped",
+			attributes: map[string]string{
+				ProvisioningDetailsPrefix + "gid":               "1001",
+				ProvisioningDetailsPrefix + "reusedAccessPoint": "false",
+			},
+			expected: volumeContext{"encryptintransit": "true", CrossAccount: "false"},
+		},
+		{
+			name: "success: pod info is dropped",
+			attributes: map[string]string{
+				PodName:               "app-0",
+				PodNamespace:          "team-a",
+				PodUid:                "1234",
+				PodServiceAccountName: "default",
+				EphemeralVolume:       "false",
+			},
+			expected: volumeContext{"encryptintransit": "true", CrossAccount: "false"},
+		},
+		{
+			name: "success: crossaccount disabled does not conflict with mounttargetip",
+			attributes: map[string]string{
+				"crossaccount":  "false",
+				"mounttargetip": "127.0.0.1",
+			},
+			expected: volumeContext{"encryptintransit": "true", CrossAccount: "false", MountTargetIp: "127.0.0.1"},
+		},
+		{
+			name: "success: crossaccount enabled with mounttargetip",
+			attributes: map[string]string{
+				"crossaccount":  "true",
+				"mounttargetip": "127.0.0.1",
+			},
+			expected: volumeContext{"encryptintransit": "true", CrossAccount: "true", MountTargetIp: "127.0.0.1"},
+		},
+		{
+			name: "success: volume metrics overrides",
+			attributes: map[string]string{
+				"volMetricsRefreshPeriod": "0.5",
+				"volMetricsFsRateLimit":   "10",
+				"volMetricsJitter":        "false",
+			},
+			expected: volumeContext{
+				"encryptintransit":      "true",
+				CrossAccount:            "false",
+				VolMetricsRefreshPeriod: "0.5",
+				VolMetricsFsRateLimit:   "10",
+				VolMetricsJitter:        "false",
+			},
+		},
+		{
+			name: "fail: invalid volume metrics overrides",
+			attributes: map[string]string{
+				"volMetricsRefreshPeriod": "-1",
+				"volMetricsFsRateLimit":   "1.5",
+			},
+			expectError: errtyp{
+				code: "InvalidArgument",
+				message: `Volume context property "volMetricsFsRateLimit" must be a positive integer; ` +
+					`Volume context property "volMetricsRefreshPeriod" must be a non-negative number`,
+			},
+		},
+		{
+			name: "fail: zero rate limit and NaN refresh period",
+			attributes: map[string]string{
+				"volMetricsRefreshPeriod": "NaN",
+				"volMetricsFsRateLimit":   "0",
+			},
+			expectError: errtyp{
+				code: "InvalidArgument",
+				message: `Volume context property "volMetricsFsRateLimit" must be a positive integer; ` +
+					`Volume context property "volMetricsRefreshPeriod" must be a non-negative number`,
+			},
+		},
+		{
+			name: "fail: negative rate limit and infinite refresh period",
+			attributes: map[string]string{
+				"volMetricsRefreshPeriod": "+Inf",
+				"volMetricsFsRateLimit":   "-5",
+			},
+			expectError: errtyp{
+				code: "InvalidArgument",
+				message: `Volume context property "volMetricsFsRateLimit" must be a positive integer; ` +
+					`Volume context property "volMetricsRefreshPeriod" must be a non-negative number`,
+			},
+		},
+		{
+			name: "fail: invalid file system ARN",
+			attributes: map[string]string{
+				"fileSystemArn": "arn:aws:elasticfilesystem:us-east-1:111122223333:access-point/fsap-abcd1234",
+			},
+			expectError: errtyp{
+				code: "InvalidArgument",
+				message: `Volume context property "fileSystemArn" must be the ARN of a file system: ` +
+					`ARN "arn:aws:elasticfilesystem:us-east-1:111122223333:access-point/fsap-abcd1234" is not the ARN of a file system`,
+			},
+		},
+		{
+			name: "fail: all errors are aggregated",
+			attributes: map[string]string{
+				"asdf":             "qwer",
+				"encryptInTransit": "asdf",
+				"path":             "a/b",
+			},
+			expectError: errtyp{
+				code: "InvalidArgument",
+				message: `Volume context property "encryptInTransit" must be a boolean value: strconv.ParseBool: parsing "asdf": invalid syntax; ` +
+					`Volume context property "path" must be an absolute path; ` +
+					`Volume context property asdf not supported.`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ret, err := parseVolumeContext(nodePublishVolumeContext, tc.attributes)
+			if tc.expectError.code != "" {
+				testResult(t, "parseVolumeContext", ret, err, tc.expectError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVolumeContext failed: %v", err)
+			}
+			if !reflect.DeepEqual(ret, tc.expected) {
+				t.Fatalf("Expected %v but got %v", tc.expected, ret)
+			}
+		})
+	}
+}
+
+func TestMountCommand(t *testing.T) {
+	mountVolCap := func(flags ...string) []*csi.VolumeCapability {
+		return []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{MountFlags: flags},
+			},
+		}}
+	}
+	testCases := []struct {
+		name       string
+		volumeId   string
+		volContext map[string]string
+		volCaps    []*csi.VolumeCapability
+		expected   string
+	}{
+		{
+			name:     "access point",
+			volumeId: "fs-abcd1234::fsap-abcd1234xyz987",
+			expected: "mount -t efs -o tls,accesspoint=fsap-abcd1234xyz987 fs-abcd1234:/ /mnt/efs",
+		},
+		{
+			name:       "mount target ip and mount flags",
+			volumeId:   "fs-abcd1234:/dynamic/pv-1:fsap-abcd1234xyz987",
+			volContext: map[string]string{MountTargetIp: "10.0.0.1"},
+			volCaps:    mountVolCap("TLS", "iam", "awscredsuri=/creds"),
+			expected:   "mount -t efs -o tls,accesspoint=fsap-abcd1234xyz987,mounttargetip=10.0.0.1,iam fs-abcd1234:/dynamic/pv-1 /mnt/efs",
+		},
+		{
+			name:       "file system in another region",
+			volumeId:   "fs-abcd1234::fsap-abcd1234xyz987",
+			volContext: map[string]string{FileSystemArn: "arn:aws:elasticfilesystem:us-west-2:111122223333:file-system/fs-abcd1234"},
+			expected:   "mount -t efs -o tls,accesspoint=fsap-abcd1234xyz987,region=us-west-2,crossaccount fs-abcd1234:/ /mnt/efs",
+		},
+		{
+			name:     "v2 volume handle of another region",
+			volumeId: "efs://fs-abcd1234?ap=fsap-abcd1234xyz987&path=/dynamic/pv-1&region=us-west-2",
+			expected: "mount -t efs -o tls,accesspoint=fsap-abcd1234xyz987,region=us-west-2 fs-abcd1234:/dynamic/pv-1 /mnt/efs",
+		},
+		{
+			name:     "invalid volume id",
+			volumeId: "invalid",
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mountCommand(tc.volumeId, tc.volContext, tc.volCaps, "us-east-1"); got != tc.expected {
+				t.Fatalf("Expected %q but got %q", tc.expected, got)
+			}
+		})
+	}
+}
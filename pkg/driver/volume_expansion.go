@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// ControllerExpandVolume accepts the resize of any volume, EFS file systems being elastic, so that the
+// capacity of the persistent volume follows the one requested by its claim. The new capacity of the volumes
+// of a dedicated access point created by the driver is recorded in its CapacityTagKey tag. The volumes of
+// efs-shared-ap and efs-fs, and the static volumes, have no capacity recorded outside of Kubernetes.
+func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	klog.V(4).Infof("ControllerExpandVolume: called with args %+v", util.SanitizeRequest(*req))
+
+	volId := req.GetVolumeId()
+	if volId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
+	}
+	capRange := req.GetCapacityRange()
+	if capRange == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity range not provided")
+	}
+	capacity := capRange.GetRequiredBytes()
+	if limit := capRange.GetLimitBytes(); limit > 0 && capacity > limit {
+		return nil, status.Errorf(codes.OutOfRange, "Required bytes %d exceed the limit bytes %d", capacity, limit)
+	}
+	if volCap := req.GetVolumeCapability(); volCap != nil {
+		if err := d.isValidVolumeCapabilities([]*csi.VolumeCapability{volCap}); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Volume capability not supported: %s", err)
+		}
+	}
+	_, subpath, accessPointId, err := parseVolumeId(volId)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "Volume not found, err: %v", err)
+	}
+
+	if accessPointId != "" && subpath == "" {
+		secrets, err := d.secretsResolver.resolve(ctx, req.GetSecrets())
+		if err != nil {
+			return nil, err
+		}
+		apiConfig, err := parseAPIConfig(secrets)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid API secrets: %v", err)
+		}
+		if apiConfig.Region == "" {
+			apiConfig.Region = secrets[AwsRegion]
+		}
+		localCloud, _, _, err := getCloud(secrets, d, apiConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := recordAccessPointCapacity(ctx, localCloud, accessPointId, capacity); err != nil {
+			return nil, err
+		}
+	}
+
+	// NodeExpandVolume completes the resize, refreshing the stats of the volume on the nodes
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         capacity,
+		NodeExpansionRequired: true,
+	}, nil
+}
+
+// recordAccessPointCapacity tags the access point with the capacity of its volume, unless it is not managed by the
+// driver or already records at least this capacity, so that the retries of a resize do not tag it again
+func recordAccessPointCapacity(ctx context.Context, localCloud cloud.Cloud, accessPointId string, capacity int64) error {
+	accessPoint, err := localCloud.DescribeAccessPoint(ctx, accessPointId)
+	if err == nil && (accessPoint.Tags[DefaultTagKey] != DefaultTagValue || accessPoint.SharedNamespace != "") {
+		klog.V(4).Infof("ControllerExpandVolume: access point %v is not a dedicated access point of the driver, not recording its capacity", accessPointId)
+		return nil
+	}
+	if err == nil && accessPoint.CapacityBytes >= capacity {
+		return nil
+	}
+	if err == nil {
+		err = localCloud.TagResource(ctx, accessPointId, map[string]string{cloud.CapacityTagKey: strconv.FormatInt(capacity, 10)})
+	}
+	switch {
+	case err == nil:
+		klog.V(4).Infof("ControllerExpandVolume: recorded capacity %d of access point %v", capacity, accessPointId)
+		return nil
+	case err == cloud.ErrNotFound:
+		return status.Errorf(codes.NotFound, "Access point %v not found", accessPointId)
+	case err == cloud.ErrAccessDenied:
+		return status.Errorf(codes.Unauthenticated, "Access Denied. Please ensure you have the right AWS permissions: %v", err)
+	case err == cloud.ErrDeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, "Timed out recording the capacity of access point %v", accessPointId)
+	}
+	return status.Errorf(codes.Internal, "Failed to record the capacity of access point %v: %v", accessPointId, err)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestControllerExpandVolume(t *testing.T) {
+	const (
+		apId     = "fsap-abcd1234"
+		capacity = int64(10 * 1024 * 1024 * 1024)
+	)
+	capacityRange := &csi.CapacityRange{RequiredBytes: capacity}
+	testCases := []struct {
+		name         string
+		req          *csi.ControllerExpandVolumeRequest
+		accessPoint  *cloud.AccessPoint
+		describeErr  error
+		expectTag    bool
+		tagErr       error
+		expectedCode codes.Code
+	}{
+		{
+			name:        "Success: capacity recorded on the access point",
+			req:         &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId, CapacityRange: capacityRange},
+			accessPoint: &cloud.AccessPoint{AccessPointId: apId, Tags: map[string]string{DefaultTagKey: DefaultTagValue}, CapacityBytes: capacity / 2},
+			expectTag:   true,
+		},
+		{
+			name:        "Success: capacity already recorded",
+			req:         &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId, CapacityRange: capacityRange},
+			accessPoint: &cloud.AccessPoint{AccessPointId: apId, Tags: map[string]string{DefaultTagKey: DefaultTagValue}, CapacityBytes: capacity},
+		},
+		{
+			name:        "Success: access point managed outside of the driver",
+			req:         &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId, CapacityRange: capacityRange},
+			accessPoint: &cloud.AccessPoint{AccessPointId: apId},
+		},
+		{
+			name: "Success: volume of a shared access point",
+			req:  &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234:/ns/pvc-1:" + apId, CapacityRange: capacityRange},
+		},
+		{
+			name: "Success: static volume",
+			req:  &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234", CapacityRange: capacityRange},
+		},
+		{
+			name:         "Fail: access point not found",
+			req:          &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId, CapacityRange: capacityRange},
+			describeErr:  cloud.ErrNotFound,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "Fail: tagging denied",
+			req:          &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId, CapacityRange: capacityRange},
+			accessPoint:  &cloud.AccessPoint{AccessPointId: apId, Tags: map[string]string{DefaultTagKey: DefaultTagValue}},
+			expectTag:    true,
+			tagErr:       cloud.ErrAccessDenied,
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "Fail: capacity above the limit",
+			req:          &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId, CapacityRange: &csi.CapacityRange{RequiredBytes: capacity, LimitBytes: capacity / 2}},
+			expectedCode: codes.OutOfRange,
+		},
+		{
+			name:         "Fail: capacity range not provided",
+			req:          &csi.ControllerExpandVolumeRequest{VolumeId: "fs-abcd1234::" + apId},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Fail: volume ID not provided",
+			req:          &csi.ControllerExpandVolumeRequest{CapacityRange: capacityRange},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			driver := &Driver{cloud: mockCloud}
+			ctx := context.Background()
+
+			if tc.accessPoint != nil || tc.describeErr != nil {
+				mockCloud.EXPECT().DescribeAccessPoint(gomock.Eq(ctx), apId).Return(tc.accessPoint, tc.describeErr)
+			}
+			if tc.expectTag {
+				mockCloud.EXPECT().TagResource(gomock.Eq(ctx), apId, map[string]string{cloud.CapacityTagKey: "10737418240"}).Return(tc.tagErr)
+			}
+
+			res, err := driver.ControllerExpandVolume(ctx, tc.req)
+			if tc.expectedCode != codes.OK {
+				if status.Code(err) != tc.expectedCode {
+					t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ControllerExpandVolume failed: %v", err)
+			}
+			if res.CapacityBytes != capacity || !res.NodeExpansionRequired {
+				t.Fatalf("Unexpected response %+v", res)
+			}
+		})
+	}
+}
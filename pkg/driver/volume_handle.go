@@ -0,0 +1,189 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	// VolumeHandleFormatLegacy is the colon separated volume handle, {fileSystemId}:{mountPath}:{accessPointId}
+	VolumeHandleFormatLegacy = "legacy"
+	// VolumeHandleFormatV2 is the volume handle with key=value fields,
+	// efs://{fileSystemId}?ap={accessPointId}&path={mountPath}&region={region}&endpoint={endpoint}&role={roleArn}
+	VolumeHandleFormatV2 = "v2"
+
+	volumeHandleV2Prefix = "efs://"
+
+	// The fields of the v2 volume handles
+	volumeHandleAccessPoint = "ap"
+	volumeHandlePath        = "path"
+	volumeHandleRegion      = "region"
+	volumeHandleEndpoint    = "endpoint"
+	volumeHandleRole        = "role"
+)
+
+var volumeHandleRegionRegex = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// volumeHandle is the parsed ID of a volume, in either format. The region is only set by the v2 handles of
+// the file systems in another region than the controller, the endpoint and the role by the ones of the
+// storage classes with the apiEndpoint and roleArn parameters.
+type volumeHandle struct {
+	fileSystemId  string
+	subpath       string
+	accessPointId string
+	region        string
+	endpoint      string
+	roleArn       string
+}
+
+// parseVolumeHandleFormat returns whether the format is the v2 volume handle
+func parseVolumeHandleFormat(format string) (bool, error) {
+	switch format {
+	case "", VolumeHandleFormatLegacy:
+		return false, nil
+	case VolumeHandleFormatV2:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid volume handle format %q, must be %s or %s", format, VolumeHandleFormatLegacy, VolumeHandleFormatV2)
+}
+
+// parseVolumeHandle parses the volume ID in either format. The error is a status.Error with
+// codes.InvalidArgument.
+func parseVolumeHandle(volumeId string) (volumeHandle, error) {
+	if strings.HasPrefix(volumeId, volumeHandleV2Prefix) {
+		return parseVolumeHandleV2(volumeId)
+	}
+	fsid, subpath, apid, err := parseVolumeId(volumeId)
+	return volumeHandle{fileSystemId: fsid, subpath: subpath, accessPointId: apid}, err
+}
+
+// parseVolumeHandleV2 parses a v2 volume handle. Its fields may be in any order, but an unknown or repeated
+// field is rejected rather than ignored, so that a node not knowing a field added later does not mount the
+// volume without it.
+func parseVolumeHandleV2(volumeId string) (volumeHandle, error) {
+	invalid := func(format string, args ...interface{}) (volumeHandle, error) {
+		return volumeHandle{}, status.Errorf(codes.InvalidArgument, "volume ID '%s' is invalid: %s", volumeId, fmt.Sprintf(format, args...))
+	}
+	u, err := url.Parse(volumeId)
+	if err != nil {
+		return invalid("%v", err)
+	}
+	if u.User != nil || u.Port() != "" || (u.Path != "" && u.Path != "/") || u.Fragment != "" {
+		return invalid("Expected efs://{fileSystemId}?{field}={value}&...")
+	}
+	h := volumeHandle{fileSystemId: u.Hostname()}
+	if !isValidFileSystemId(h.fileSystemId) {
+		return invalid("Expected a file system ID of the form 'fs-...'")
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return invalid("%v", err)
+	}
+	for key, values := range query {
+		if len(values) != 1 || values[0] == "" {
+			return invalid("Expected a single non-empty value of field '%s'", key)
+		}
+		value := values[0]
+		switch key {
+		case volumeHandleAccessPoint:
+			if !isValidAccessPointId(value) {
+				return invalid("Expected the access point ID '%s' to be of the form 'fsap-...'", value)
+			}
+			h.accessPointId = value
+		case volumeHandlePath:
+			if !path.IsAbs(value) || strings.Contains(value, ":") {
+				return invalid("Expected the path '%s' to be absolute and without ':'", value)
+			}
+			h.subpath = path.Clean(value)
+		case volumeHandleRegion:
+			if !volumeHandleRegionRegex.MatchString(value) {
+				return invalid("Expected the region '%s' to be of the form 'us-east-1'", value)
+			}
+			h.region = value
+		case volumeHandleEndpoint:
+			if !cloud.IsEndpointURL(value) {
+				return invalid("Expected the endpoint '%s' to be an http or https URL", value)
+			}
+			h.endpoint = value
+		case volumeHandleRole:
+			if !cloud.IsArn(value) {
+				return invalid("Expected the role '%s' to be the ARN of an IAM role", value)
+			}
+			h.roleArn = value
+		default:
+			return invalid("Unknown field '%s', expected %s, %s, %s, %s or %s", key, volumeHandleAccessPoint, volumeHandlePath, volumeHandleRegion, volumeHandleEndpoint, volumeHandleRole)
+		}
+	}
+	return h, nil
+}
+
+// legacy returns the volume handle in the legacy format, which has no region
+func (h volumeHandle) legacy() string {
+	volumeId := h.fileSystemId
+	if h.subpath != "" || h.accessPointId != "" {
+		volumeId += ":" + h.subpath
+	}
+	if h.accessPointId != "" {
+		volumeId += ":" + h.accessPointId
+	}
+	return volumeId
+}
+
+// v2 returns the volume handle in the v2 format, with its fields in a fixed order so that the retries of
+// CreateVolume return the same volume ID
+func (h volumeHandle) v2() string {
+	var fields []string
+	for _, field := range [][2]string{{volumeHandleAccessPoint, h.accessPointId}, {volumeHandlePath, h.subpath}, {volumeHandleRegion, h.region}, {volumeHandleEndpoint, h.endpoint}, {volumeHandleRole, h.roleArn}} {
+		if field[1] != "" {
+			// The slashes of the paths are kept readable, they need no escaping in a query
+			fields = append(fields, field[0]+"="+strings.ReplaceAll(url.QueryEscape(field[1]), "%2F", "/"))
+		}
+	}
+	if len(fields) == 0 {
+		return volumeHandleV2Prefix + h.fileSystemId
+	}
+	return volumeHandleV2Prefix + h.fileSystemId + "?" + strings.Join(fields, "&")
+}
+
+// volumeId returns the ID of the volume in the volume handle format of the driver. The region of the file
+// system is only kept if it is not the region of the controller. The volumes whose EFS API is not the one of
+// the controller always have a v2 volume handle, which records it so that DeleteVolume needs no secrets.
+func (d *Driver) volumeId(fileSystemId, subpath, accessPointId string, apiConfig cloud.APIConfig) string {
+	h := volumeHandle{fileSystemId: fileSystemId, subpath: subpath, accessPointId: accessPointId, endpoint: apiConfig.Endpoint, roleArn: apiConfig.RoleArn}
+	if apiConfig.Region != "" && apiConfig.Region != d.cloud.GetMetadata().GetRegion() {
+		h.region = apiConfig.Region
+	}
+	if !d.volumeHandleV2 && h.region == "" && h.endpoint == "" && h.roleArn == "" {
+		return h.legacy()
+	}
+	return h.v2()
+}
+
+// apiConfig returns the EFS API configuration recorded by the volume handle
+func (h volumeHandle) apiConfig() cloud.APIConfig {
+	return cloud.APIConfig{Region: h.region, Endpoint: h.endpoint, RoleArn: h.roleArn}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	cloudmocks "github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud/mocks"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func TestParseVolumeHandle(t *testing.T) {
+	testCases := []struct {
+		volumeId       string
+		expected       volumeHandle
+		expectedLegacy string
+		expectErr      bool
+	}{
+		{
+			volumeId:       "fs-abcd1234:/dir:fsap-abcd1234",
+			expected:       volumeHandle{fileSystemId: "fs-abcd1234", subpath: "/dir", accessPointId: "fsap-abcd1234"},
+			expectedLegacy: "fs-abcd1234:/dir:fsap-abcd1234",
+		},
+		{
+			volumeId:       "efs://fs-abcd1234",
+			expected:       volumeHandle{fileSystemId: "fs-abcd1234"},
+			expectedLegacy: "fs-abcd1234",
+		},
+		{
+			volumeId:       "efs://fs-abcd1234?ap=fsap-abcd1234",
+			expected:       volumeHandle{fileSystemId: "fs-abcd1234", accessPointId: "fsap-abcd1234"},
+			expectedLegacy: "fs-abcd1234::fsap-abcd1234",
+		},
+		{
+			volumeId:       "efs://fs-abcd1234?region=eu-west-1&path=/a/b/../c&ap=fsap-abcd1234",
+			expected:       volumeHandle{fileSystemId: "fs-abcd1234", subpath: "/a/c", accessPointId: "fsap-abcd1234", region: "eu-west-1"},
+			expectedLegacy: "fs-abcd1234:/a/c:fsap-abcd1234",
+		},
+		{
+			volumeId:       "efs://fs-abcd1234?ap=fsap-abcd1234&endpoint=https%3A//efs.example.com&role=arn%3Aaws%3Aiam%3A%3A111122223333%3Arole/efs",
+			expected:       volumeHandle{fileSystemId: "fs-abcd1234", accessPointId: "fsap-abcd1234", endpoint: "https://efs.example.com", roleArn: "arn:aws:iam::111122223333:role/efs"},
+			expectedLegacy: "fs-abcd1234::fsap-abcd1234",
+		},
+		{
+			volumeId:       "efs://fs-abcd1234?path=%2Fdata%20set",
+			expected:       volumeHandle{fileSystemId: "fs-abcd1234", subpath: "/data set"},
+			expectedLegacy: "fs-abcd1234:/data set",
+		},
+		{volumeId: "efs://fsap-abcd1234", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?ap=fs-abcd1234", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?path=dir", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?path=/a:b", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?region=us_east_1", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?endpoint=efs.example.com", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?role=EFSRole", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?ap=fsap-abcd1234&ap=fsap-efgh5678", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?ap=", expectErr: true},
+		{volumeId: "efs://fs-abcd1234?account=111122223333", expectErr: true},
+		{volumeId: "efs://fs-abcd1234/dir", expectErr: true},
+		{volumeId: "efs://user@fs-abcd1234", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.volumeId, func(t *testing.T) {
+			h, err := parseVolumeHandle(tc.volumeId)
+			if tc.expectErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected InvalidArgument, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVolumeHandle failed: %v", err)
+			}
+			if h != tc.expected {
+				t.Fatalf("Expected %+v, got %+v", tc.expected, h)
+			}
+			if legacy := h.legacy(); legacy != tc.expectedLegacy {
+				t.Fatalf("Expected legacy volume ID %v, got %v", tc.expectedLegacy, legacy)
+			}
+			// Both formats are parsed to the same volume, without the region in the legacy format
+			fsid, subpath, apid, err := parseVolumeId(tc.volumeId)
+			if err != nil || fsid != h.fileSystemId || subpath != h.subpath || apid != h.accessPointId {
+				t.Fatalf("Expected parseVolumeId to return %+v, got %v, %v, %v: %v", h, fsid, subpath, apid, err)
+			}
+			if reparsed, err := parseVolumeHandle(h.v2()); err != nil || reparsed != h {
+				t.Fatalf("Expected %v to be parsed back to %+v, got %+v: %v", h.v2(), h, reparsed, err)
+			}
+		})
+	}
+}
+
+func TestVolumeHandleV2(t *testing.T) {
+	h := volumeHandle{fileSystemId: "fs-abcd1234", subpath: "/base/pvc-1", accessPointId: "fsap-abcd1234", region: "eu-west-1"}
+	if volumeId := h.v2(); volumeId != "efs://fs-abcd1234?ap=fsap-abcd1234&path=/base/pvc-1&region=eu-west-1" {
+		t.Fatalf("Unexpected volume ID %v", volumeId)
+	}
+	if _, err := parseVolumeHandleFormat("v3"); err == nil {
+		t.Fatalf("Expected an error for an unknown format")
+	}
+}
+
+func TestCreateVolumeVolumeHandleV2(t *testing.T) {
+	testCases := []struct {
+		name             string
+		params           map[string]string
+		legacy           bool
+		expectedVolumeId string
+	}{
+		{
+			name:             "Success: file system of the region of the controller",
+			expectedVolumeId: "efs://fs-abcd1234?ap=fsap-abcd1234",
+		},
+		{
+			name:             "Success: file system of another region",
+			params:           map[string]string{APIRegion: "eu-west-1"},
+			expectedVolumeId: "efs://fs-abcd1234?ap=fsap-abcd1234&region=eu-west-1",
+		},
+		{
+			name:             "Success: legacy format for the API of the controller",
+			legacy:           true,
+			expectedVolumeId: "fs-abcd1234::fsap-abcd1234",
+		},
+		{
+			name:             "Success: API of the storage class recorded despite the legacy format",
+			params:           map[string]string{APIEndpoint: "https://efs.example.com", APIRoleArn: "arn:aws:iam::111122223333:role/efs"},
+			legacy:           true,
+			expectedVolumeId: "efs://fs-abcd1234?ap=fsap-abcd1234&endpoint=https%3A//efs.example.com&role=arn%3Aaws%3Aiam%3A%3A111122223333%3Arole/efs",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockCloud := mocks.NewMockCloud(mockCtl)
+			mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
+			mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+			mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+			clients := newAPIClients()
+			clients.newCloud = func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+				return mockCloud, nil
+			}
+			driver := &Driver{
+				endpoint:       "endpoint",
+				cloud:          mockCloud,
+				gidAllocator:   NewGidAllocator(),
+				apiClients:     clients,
+				volumeHandleV2: !tc.legacy,
+			}
+
+			params := map[string]string{
+				ProvisioningMode: "efs-ap",
+				FsId:             "fs-abcd1234",
+				DirectoryPerms:   "777",
+				Uid:              "1000",
+				Gid:              "1000",
+			}
+			for k, v := range tc.params {
+				params[k] = v
+			}
+			ctx := context.Background()
+			mockCloud.EXPECT().DescribeFileSystem(gomock.Eq(ctx), gomock.Eq("fs-abcd1234")).Return(&cloud.FileSystem{FileSystemId: "fs-abcd1234"}, nil)
+			mockCloud.EXPECT().CreateAccessPoint(gomock.Eq(ctx), gomock.Eq("pvc-1"), gomock.Any()).Return(&cloud.AccessPoint{AccessPointId: "fsap-abcd1234", FileSystemId: "fs-abcd1234"}, nil)
+			if _, ok := tc.params[APIRoleArn]; ok {
+				// The mount target of the file system of the other account is looked up with its role
+				mockCloud.EXPECT().DescribeMountTargets(gomock.Eq(ctx), gomock.Eq("fs-abcd1234"), gomock.Eq("")).Return(&cloud.MountTarget{IPAddress: "10.0.0.1"}, nil)
+			}
+
+			res, err := driver.CreateVolume(ctx, &csi.CreateVolumeRequest{
+				Name: "pvc-1",
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+				}},
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 5368709120},
+				Parameters:    params,
+			})
+			if err != nil {
+				t.Fatalf("CreateVolume failed: %v", err)
+			}
+			if res.Volume.VolumeId != tc.expectedVolumeId {
+				t.Fatalf("Expected volume ID %v, got %v", tc.expectedVolumeId, res.Volume.VolumeId)
+			}
+		})
+	}
+}
+
+func TestDeleteVolumeRegionOfVolumeHandleV2(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
+	apiCloud := mocks.NewMockCloud(mockCtl)
+	mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+	mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+
+	clients := newAPIClients()
+	clients.newCloud = func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+		if apiConfig.Region != "eu-west-1" {
+			t.Fatalf("Expected the region of the volume handle, got %+v", apiConfig)
+		}
+		return apiCloud, nil
+	}
+	driver := &Driver{
+		endpoint:     "endpoint",
+		cloud:        mockCloud,
+		gidAllocator: NewGidAllocator(),
+		apiClients:   clients,
+	}
+
+	// The region of the volume is not in the secrets of DeleteVolume
+	ctx := context.Background()
+	apiCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq("fsap-abcd1234")).Return(nil)
+	if _, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "efs://fs-abcd1234?ap=fsap-abcd1234&region=eu-west-1"}); err != nil {
+		t.Fatalf("DeleteVolume failed: %v", err)
+	}
+}
+
+func TestDeleteVolumeAPIOfVolumeHandleV2(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	mockMetadata := cloudmocks.NewMockMetadataService(mockCtl)
+	apiCloud := mocks.NewMockCloud(mockCtl)
+	mockCloud.EXPECT().GetMetadata().Return(mockMetadata).AnyTimes()
+	mockMetadata.EXPECT().GetRegion().Return("us-east-1").AnyTimes()
+
+	expected := cloud.APIConfig{Endpoint: "https://efs.example.com", RoleArn: "arn:aws:iam::111122223333:role/efs"}
+	clients := newAPIClients()
+	clients.newCloud = func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+		if apiConfig != expected {
+			t.Fatalf("Expected the API of the volume handle %+v, got %+v", expected, apiConfig)
+		}
+		return apiCloud, nil
+	}
+	driver := &Driver{
+		endpoint:     "endpoint",
+		cloud:        mockCloud,
+		gidAllocator: NewGidAllocator(),
+		apiClients:   clients,
+	}
+
+	// The storage class of the volume has no provisioner secrets
+	ctx := context.Background()
+	apiCloud.EXPECT().DeleteAccessPoint(gomock.Eq(ctx), gomock.Eq("fsap-abcd1234")).Return(nil)
+	volumeId := "efs://fs-abcd1234?ap=fsap-abcd1234&endpoint=https%3A//efs.example.com&role=arn%3Aaws%3Aiam%3A%3A111122223333%3Arole/efs"
+	if _, err := driver.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeId}); err != nil {
+		t.Fatalf("DeleteVolume failed: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+// AccessPointIdLabel holds the access point of a persistent volume labeled by the volume labeler
+const AccessPointIdLabel = "efs.csi.aws.com/access-point-id"
+
+// volumeLabeler labels the persistent volumes of the driver with their file system and access point, so that
+// they can be selected per file system with label selectors. The external-provisioner creates the persistent
+// volumes without the labels of CreateVolume, so they are labeled once created. Other labels are kept.
+type volumeLabeler struct {
+	interval  time.Duration
+	k8sClient cloud.KubernetesAPIClient
+}
+
+// newVolumeLabeler returns the labeler syncing the labels once per interval, or nil if the interval is 0
+func newVolumeLabeler(interval time.Duration, k8sClient cloud.KubernetesAPIClient) *volumeLabeler {
+	if interval <= 0 {
+		return nil
+	}
+	return &volumeLabeler{interval: interval, k8sClient: k8sClient}
+}
+
+// run labels the persistent volumes once per interval until stopCh is closed
+func (l *volumeLabeler) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		if err := l.sync(context.Background()); err != nil {
+			klog.Warningf("Failed to label persistent volumes: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// sync patches the labels of the persistent volumes of the driver missing or with other values
+func (l *volumeLabeler) sync(ctx context.Context) error {
+	clientset, err := l.k8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		fsid, _, apid, err := parseVolumeId(pv.Spec.CSI.VolumeHandle)
+		if err != nil {
+			continue
+		}
+		labels := map[string]string{FileSystemIdLabel: fsid}
+		if apid != "" {
+			labels[AccessPointIdLabel] = apid
+		}
+		missing := map[string]string{}
+		for k, v := range labels {
+			if pv.Labels[k] != v {
+				missing[k] = v
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": missing},
+		})
+		if err != nil {
+			return err
+		}
+		klog.V(4).Infof("Labeling persistent volume %s with %v", pv.Name, missing)
+		if _, err := clientset.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			klog.Warningf("Failed to label persistent volume %s: %v", pv.Name, err)
+		}
+	}
+	return nil
+}
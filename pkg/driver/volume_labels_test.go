@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestVolumeLabelerSync(t *testing.T) {
+	labeled := newAccessPointPV("pv-labeled", "fs-abcd1234::fsap-abcd1234", "team-a", "data")
+	labeled.Labels = map[string]string{"team": "a"}
+	other := newAccessPointPV("pv-other", "fs-abcd1234::fsap-abcd1234", "team-b", "data")
+	other.Spec.CSI.Driver = "other.csi.aws.com"
+	clientset := fake.NewSimpleClientset(
+		labeled,
+		newAccessPointPV("pv-static", "fs-efgh5678:/static", "team-c", "static"),
+		other,
+	)
+	labeler := newVolumeLabeler(time.Minute, func() (kubernetes.Interface, error) { return clientset, nil })
+	if newVolumeLabeler(0, nil) != nil {
+		t.Errorf("Expected no labeler without interval")
+	}
+
+	ctx := context.Background()
+	if err := labeler.sync(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]map[string]string{
+		"pv-labeled": {"team": "a", FileSystemIdLabel: "fs-abcd1234", AccessPointIdLabel: "fsap-abcd1234"},
+		"pv-static":  {FileSystemIdLabel: "fs-efgh5678"},
+		"pv-other":   nil,
+	}
+	for name, labels := range expected {
+		pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(pv.Labels, labels) {
+			t.Errorf("Expected labels %v of %s, got %v", labels, name, pv.Labels)
+		}
+	}
+
+	// Volumes already labeled are not patched again
+	clientset.ClearActions()
+	if err := labeler.sync(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("Unexpected patch of %v", action.GetResource())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+)
+
+const (
+	warmupInitialBackoff = time.Second
+	warmupMaxBackoff     = 30 * time.Second
+)
+
+// warmUp initializes the EFS API clients of the controller in the background, so that the first
+// CreateVolume does not pay for resolving the credentials, assuming the roles and creating the clients.
+// The client of the driver is retried until its credentials work, unless accessVerified, then one
+// client per API config of the storage classes of the driver is created and checked once. Probe
+// reports the driver not ready until the warm up ends, or for at most the timeout, so that a rolling
+// update of the controller waits for it.
+func (d *Driver) warmUp(accessVerified bool, timeout time.Duration, k8sClient cloud.KubernetesAPIClient) {
+	d.warming.Store(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx := context.Background()
+		if !accessVerified {
+			d.warmUpCloud(ctx, d.cloud, d.accessCheckFileSystemId(ctx, k8sClient))
+		}
+		d.warmUpStorageClassClouds(ctx, k8sClient)
+		klog.Info("EFS API clients warmed up")
+	}()
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			klog.Warningf("EFS API clients still warming up after %v, reporting the driver ready", timeout)
+		}
+		d.warming.Store(false)
+	}()
+}
+
+// warmUpCloud calls the EFS API on the file system until the credentials of the cloud work or are denied
+func (d *Driver) warmUpCloud(ctx context.Context, localCloud cloud.Cloud, fileSystemId string) {
+	backoff := warmupInitialBackoff
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, efsAccessCheckTimeout)
+		err := localCloud.CheckAccess(checkCtx, fileSystemId)
+		cancel()
+		if err == nil || err == cloud.ErrNotFound {
+			return
+		}
+		if err == cloud.ErrAccessDenied || err == cloud.ErrDeniedByPolicy {
+			klog.Errorf("EFS API access denied while warming up: %v", err)
+			return
+		}
+		klog.Warningf("Could not call the EFS API while warming up, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > warmupMaxBackoff {
+			backoff = warmupMaxBackoff
+		}
+	}
+}
+
+// warmUpStorageClassClouds creates and checks the cloud of every API config of the storage classes of
+// the driver, as CreateVolume would. Roles passed in the provisioner secrets are not known in advance.
+func (d *Driver) warmUpStorageClassClouds(ctx context.Context, k8sClient cloud.KubernetesAPIClient) {
+	clientset, err := k8sClient()
+	if err != nil {
+		klog.Warningf("Could not list the storage classes to warm up their EFS API clients: %v", err)
+		return
+	}
+	scs, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("Could not list the storage classes to warm up their EFS API clients: %v", err)
+		return
+	}
+	warmed := map[cloud.APIConfig]bool{}
+	for _, sc := range scs.Items {
+		if sc.Provisioner != driverName {
+			continue
+		}
+		apiConfig, err := storageClassAPIConfig(sc.Parameters, d.fileSystemAliases)
+		if err != nil {
+			klog.Warningf("Not warming up the EFS API client of storage class %s: %v", sc.Name, err)
+			continue
+		}
+		if d.isDriverAPIConfig(apiConfig) {
+			continue
+		}
+		if warmed[apiConfig] {
+			continue
+		}
+		warmed[apiConfig] = true
+
+		localCloud, err := d.apiClients.get(apiConfig, d.cloudOptions)
+		if err != nil {
+			klog.Warningf("Could not create the EFS API client of storage class %s: %v", sc.Name, err)
+			continue
+		}
+		// The access is checked without a file system if it cannot be resolved
+		fileSystemId, err := d.fileSystemAliases.storageClassFileSystemId(sc.Parameters)
+		if err != nil {
+			klog.V(4).Infof("Warming up the EFS API client of storage class %s without its file system: %v", sc.Name, err)
+			fileSystemId = ""
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, efsAccessCheckTimeout)
+		err = localCloud.CheckAccess(checkCtx, fileSystemId)
+		cancel()
+		if err != nil {
+			klog.Warningf("Could not call the EFS API of storage class %s while warming up: %v", sc.Name, err)
+			continue
+		}
+		klog.V(4).Infof("Warmed up the EFS API client of storage class %s", sc.Name)
+	}
+}
+
+// storageClassAPIConfig returns the API config of the parameters of a storage class, in the region of its
+// file system when given as an ARN, or as an alias of an ARN
+func storageClassAPIConfig(parameters map[string]string, aliases *fileSystemAliases) (cloud.APIConfig, error) {
+	apiConfig, err := parseAPIConfig(parameters)
+	if err != nil {
+		return apiConfig, err
+	}
+	if fileSystemId, err := aliases.resolveParameter(parameters[FsId]); err == nil && cloud.IsArn(fileSystemId) {
+		if fsArn, err := cloud.ParseFileSystemArn(fileSystemId); err == nil {
+			apiConfig.Region = fsArn.Region
+		}
+	}
+	return apiConfig, nil
+}
+
+// isDriverAPIConfig returns whether the API config is served by the cloud of the driver
+func (d *Driver) isDriverAPIConfig(apiConfig cloud.APIConfig) bool {
+	return apiConfig.RoleArn == "" && apiConfig.Endpoint == "" && (apiConfig.Region == "" || apiConfig.Region == d.cloud.GetMetadata().GetRegion())
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/driver/mocks"
+)
+
+func waitForReady(t *testing.T, d *Driver) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		res, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+		if err != nil {
+			t.Fatalf("Probe failed: %v", err)
+		}
+		if res.Ready == nil || res.Ready.Value {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the driver to become ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	roleArn := "arn:aws:iam::111122223333:role/EFSRole"
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+	roleCloud := mocks.NewMockCloud(mockCtl)
+
+	release := make(chan struct{})
+	gomock.InOrder(
+		mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).DoAndReturn(func(ctx context.Context, fileSystemId string) error {
+			<-release
+			return errors.New("no EC2 IMDS role found")
+		}),
+		mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).Return(nil),
+	)
+	roleCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("fs-abcd1234")).Return(nil)
+
+	var created []cloud.APIConfig
+	clients := newAPIClients()
+	clients.newCloud = func(apiConfig cloud.APIConfig, options cloud.Options) (cloud.Cloud, error) {
+		created = append(created, apiConfig)
+		return roleCloud, nil
+	}
+	clientset := fake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs-cross-account"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "fs-abcd1234", APIRoleArn: roleArn},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs-cross-account-2"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "fs-efgh5678", APIRoleArn: roleArn},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs"},
+			Provisioner: driverName,
+			Parameters:  map[string]string{FsId: "fs-abcd1234"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "ebs"},
+			Provisioner: "ebs.csi.aws.com",
+			Parameters:  map[string]string{APIRoleArn: roleArn},
+		},
+	)
+
+	d := &Driver{mode: ControllerMode, cloud: mockCloud, apiClients: clients}
+	d.warmUp(false, time.Minute, func() (kubernetes.Interface, error) {
+		return clientset, nil
+	})
+
+	res, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if res.Ready == nil || res.Ready.Value {
+		t.Fatalf("Expected the driver not to be ready while warming up, got %v", res.Ready)
+	}
+
+	close(release)
+	waitForReady(t, d)
+	if len(created) != 1 || created[0].RoleArn != roleArn {
+		t.Fatalf("Expected one client created for the role, got %+v", created)
+	}
+}
+
+func TestWarmUpTimeout(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCloud := mocks.NewMockCloud(mockCtl)
+
+	release := make(chan struct{})
+	defer close(release)
+	mockCloud.EXPECT().CheckAccess(gomock.Any(), gomock.Eq("")).DoAndReturn(func(ctx context.Context, fileSystemId string) error {
+		<-release
+		return cloud.ErrAccessDenied
+	}).AnyTimes()
+
+	d := &Driver{mode: ControllerMode, cloud: mockCloud}
+	d.warmUp(false, 50*time.Millisecond, func() (kubernetes.Interface, error) {
+		return nil, errors.New("not in a cluster")
+	})
+	waitForReady(t, d)
+}
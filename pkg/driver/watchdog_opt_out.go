@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+// unwatchedStateDir is the directory of the efs-utils state directory holding the state of the mounts opted out
+// of the watchdog. The watchdog only reads the state files at the root of the state directory.
+const unwatchedStateDir = "unwatched"
+
+// unwatchedMounts opts the mounts of the volumes with the DisableWatchdog volume attribute out of the efs-utils
+// watchdog, for short-lived pods whose mounts the watchdog would only track to clean them up seconds later.
+// efs-utils only keeps the state of TLS mounts: once mounted, their state is moved out of the directory scanned
+// by the watchdog, and on unpublish the driver does the cleanup of the watchdog itself: it stops the proxy of
+// the mount and removes its state. The proxy of an unwatched mount is not restarted if it exits, and its
+// certificate is not renewed. A nil unwatchedMounts is valid and keeps all the mounts watched.
+type unwatchedMounts struct {
+	stateDir string
+	procDir  string
+}
+
+func newUnwatchedMounts(stateDir, procDir string) *unwatchedMounts {
+	return &unwatchedMounts{stateDir: stateDir, procDir: procDir}
+}
+
+// unwatch moves the efs-utils state of the mount at the mount path out of the watchdog, under the target it is
+// published at. It returns false if the mount has no state, e.g. without TLS.
+func (u *unwatchedMounts) unwatch(target, mountPath string) bool {
+	if u == nil {
+		return false
+	}
+	entries, err := os.ReadDir(u.stateDir)
+	if err != nil {
+		klog.Warningf("Not disabling the watchdog of %s, failed to read efs-utils state directory %s: %v", target, u.stateDir, err)
+		return false
+	}
+	mountPoint := strings.TrimLeft(strings.ReplaceAll(filepath.Clean(mountPath), "/", "."), ".")
+	for _, entry := range entries {
+		match := efsUtilsStateFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil || match[2] != mountPoint {
+			continue
+		}
+		dir := filepath.Join(u.stateDir, unwatchedStateDir, hashPath(target))
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			klog.Warningf("Not disabling the watchdog of %s: %v", target, err)
+			return false
+		}
+		if err := os.Rename(filepath.Join(u.stateDir, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			klog.Warningf("Not disabling the watchdog of %s: %v", target, err)
+			return false
+		}
+		klog.V(4).Infof("Disabled the watchdog of %s, moved efs-utils state %s to %s", target, entry.Name(), dir)
+		return true
+	}
+	return false
+}
+
+// release stops the proxy and removes the efs-utils state of the unwatched mount published at the target, once
+// it is unmounted
+func (u *unwatchedMounts) release(target string) {
+	if u == nil {
+		return
+	}
+	dir := filepath.Join(u.stateDir, unwatchedStateDir, hashPath(target))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("Failed to read the unwatched efs-utils state of %s: %v", target, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			klog.Warningf("Failed to read the unwatched efs-utils state %s of %s: %v", entry.Name(), target, err)
+			continue
+		}
+		state := &efsUtilsMountState{}
+		if err := json.Unmarshal(content, state); err != nil {
+			klog.Warningf("Failed to parse the unwatched efs-utils state %s of %s: %v", entry.Name(), target, err)
+			continue
+		}
+		u.stopProxy(state.Pid)
+		for _, file := range state.Files {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				klog.Warningf("Failed to remove file %s of the unwatched mount %s: %v", file, target, err)
+			}
+		}
+		if state.MountStateDir != "" {
+			if err := os.RemoveAll(filepath.Join(u.stateDir, filepath.Base(state.MountStateDir))); err != nil {
+				klog.Warningf("Failed to remove the mount state directory of the unwatched mount %s: %v", target, err)
+			}
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		klog.Warningf("Failed to remove the unwatched efs-utils state of %s: %v", target, err)
+		return
+	}
+	klog.V(4).Infof("Released the unwatched efs-utils state of %s", target)
+}
+
+// stopProxy terminates the process group of the proxy, as the watchdog does, unless the PID was reused by
+// another command
+func (u *unwatchedMounts) stopProxy(pid int) {
+	if pid <= 0 {
+		return
+	}
+	comm, err := os.ReadFile(filepath.Join(u.procDir, strconv.Itoa(pid), "comm"))
+	if err != nil {
+		klog.V(4).Infof("Proxy %d of the unwatched mount already exited: %v", pid, err)
+		return
+	}
+	if name := strings.TrimSpace(string(comm)); name != "efs-proxy" && !strings.HasPrefix(name, "stunnel") {
+		klog.V(4).Infof("Not stopping process %d %q, it is not a proxy", pid, name)
+		return
+	}
+	pgid, err := syscall.Getpgid(pid)
+	if err != nil {
+		klog.V(4).Infof("Proxy %d of the unwatched mount already exited: %v", pid, err)
+		return
+	}
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		klog.Warningf("Failed to stop proxy %d of the unwatched mount: %v", pid, err)
+	}
+}
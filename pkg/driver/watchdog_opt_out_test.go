@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+)
+
+// writeEfsUtilsState writes the efs-utils state of a TLS mount at the mount path, as the mount helper does
+func writeEfsUtilsState(t *testing.T, stateDir, mountPath string, pid int) (string, []string) {
+	mountStateDir := "fs-abc123.target.path+"
+	if err := os.Mkdir(filepath.Join(stateDir, mountStateDir), 0750); err != nil {
+		t.Fatal(err)
+	}
+	stunnelConfig := filepath.Join(stateDir, "stunnel-config.fs-abc123.target.path")
+	if err := os.WriteFile(stunnelConfig, nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(stateDir, fmt.Sprintf("fs-abc123.%s.20049", strings.ReplaceAll(strings.TrimLeft(mountPath, "/"), "/", ".")))
+	content := fmt.Sprintf(`{"pid": %d, "mountpoint": %q, "files": [%q], "mountStateDir": %q}`, pid, mountPath, stunnelConfig, mountStateDir)
+	if err := os.WriteFile(name, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Base(name), []string{stunnelConfig, filepath.Join(stateDir, mountStateDir)}
+}
+
+func TestUnwatchedMounts(t *testing.T) {
+	stateDir, procDir := t.TempDir(), t.TempDir()
+	u := newUnwatchedMounts(stateDir, procDir)
+
+	// The proxy is a process group leader, as stunnel started by the mount helper
+	proxy := exec.Command("sleep", "60")
+	proxy.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := proxy.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- proxy.Wait() }()
+	defer proxy.Process.Kill()
+	if err := os.MkdirAll(filepath.Join(procDir, strconv.Itoa(proxy.Process.Pid)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procDir, strconv.Itoa(proxy.Process.Pid), "comm"), []byte("stunnel\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stateFile, files := writeEfsUtilsState(t, stateDir, targetPath, proxy.Process.Pid)
+	if !u.unwatch(targetPath, targetPath) {
+		t.Fatalf("Expected the state of %s to be unwatched", targetPath)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, stateFile)); !os.IsNotExist(err) {
+		t.Fatalf("Expected state %s to be moved out of the watchdog, got %v", stateFile, err)
+	}
+	if u.unwatch("/other/path", "/other/path") {
+		t.Fatalf("Expected no state for a mount without TLS")
+	}
+
+	u.release(targetPath)
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected proxy %d to be stopped", proxy.Process.Pid)
+	}
+	for _, file := range append(files, filepath.Join(stateDir, unwatchedStateDir, hashPath(targetPath))) {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Fatalf("Expected %s to be removed, got %v", file, err)
+		}
+	}
+
+	// Releasing a target without unwatched state does nothing
+	u.release(targetPath)
+}
+
+func TestNodePublishVolumeDisableWatchdog(t *testing.T) {
+	stdVolCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
+	for _, disableWatchdog := range []string{"true", "false"} {
+		t.Run("disableWatchdog="+disableWatchdog, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMounter, driver, ctx := setup(mockCtrl, NewVolStatter(), false)
+			stateDir := t.TempDir()
+			driver.unwatchedMounts = newUnwatchedMounts(stateDir, t.TempDir())
+
+			var stateFile string
+			mockMounter.EXPECT().MakeDir(targetPath).Return(nil)
+			mockMounter.EXPECT().Mount(volumeId+":/", targetPath, "efs", []string{"tls"}).DoAndReturn(
+				func(source, target, fstype string, options []string) error {
+					stateFile, _ = writeEfsUtilsState(t, stateDir, target, 0)
+					return nil
+				})
+			_, err := driver.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:         volumeId,
+				VolumeCapability: stdVolCap,
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"disableWatchdog": disableWatchdog},
+			})
+			if err != nil {
+				t.Fatalf("NodePublishVolume failed: %v", err)
+			}
+			_, err = os.Stat(filepath.Join(stateDir, stateFile))
+			if watched := err == nil; watched != (disableWatchdog == "false") {
+				t.Fatalf("Expected the state to be watched: %t, got %v", disableWatchdog == "false", err)
+			}
+
+			mockMounter.EXPECT().GetDeviceName(targetPath).Return("", 1, nil)
+			mockMounter.EXPECT().Unmount(targetPath).Return(nil)
+			_, err = driver.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: volumeId, TargetPath: targetPath})
+			if err != nil {
+				t.Fatalf("NodeUnpublishVolume failed: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(stateDir, unwatchedStateDir, hashPath(targetPath))); !os.IsNotExist(err) {
+				t.Fatalf("Expected the unwatched state to be released, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Code generated by instrumentgen. DO NOT EDIT.
+
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-efs-csi-driver/pkg/util"
+	mount_utils "k8s.io/mount-utils"
+)
+
+// instrumentedMounter times, counts and traces the calls to the wrapped nodeMounter
+type instrumentedMounter struct {
+	nodeMounter
+}
+
+func newInstrumentedMounter(wrapped nodeMounter) nodeMounter {
+	return &instrumentedMounter{nodeMounter: wrapped}
+}
+
+func (i *instrumentedMounter) GetDeviceName(a0 string) (string, int, error) {
+	_, done := util.Instrument(context.Background(), "mounter", "GetDeviceName")
+	r0, r1, r2 := i.nodeMounter.GetDeviceName(a0)
+	done(r2)
+	return r0, r1, r2
+}
+
+func (i *instrumentedMounter) GetMountRefs(a0 string) ([]string, error) {
+	_, done := util.Instrument(context.Background(), "mounter", "GetMountRefs")
+	r0, r1 := i.nodeMounter.GetMountRefs(a0)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedMounter) IsLikelyNotMountPoint(a0 string) (bool, error) {
+	_, done := util.Instrument(context.Background(), "mounter", "IsLikelyNotMountPoint")
+	r0, r1 := i.nodeMounter.IsLikelyNotMountPoint(a0)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedMounter) IsMountPoint(a0 string) (bool, error) {
+	_, done := util.Instrument(context.Background(), "mounter", "IsMountPoint")
+	r0, r1 := i.nodeMounter.IsMountPoint(a0)
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedMounter) List() ([]mount_utils.MountPoint, error) {
+	_, done := util.Instrument(context.Background(), "mounter", "List")
+	r0, r1 := i.nodeMounter.List()
+	done(r1)
+	return r0, r1
+}
+
+func (i *instrumentedMounter) MakeDir(a0 string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "MakeDir")
+	r0 := i.nodeMounter.MakeDir(a0)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) Mount(a0 string, a1 string, a2 string, a3 []string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "Mount")
+	r0 := i.nodeMounter.Mount(a0, a1, a2, a3)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) MountSensitive(a0 string, a1 string, a2 string, a3 []string, a4 []string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "MountSensitive")
+	r0 := i.nodeMounter.MountSensitive(a0, a1, a2, a3, a4)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) MountSensitiveWithoutSystemd(a0 string, a1 string, a2 string, a3 []string, a4 []string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "MountSensitiveWithoutSystemd")
+	r0 := i.nodeMounter.MountSensitiveWithoutSystemd(a0, a1, a2, a3, a4)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) MountSensitiveWithoutSystemdWithMountFlags(a0 string, a1 string, a2 string, a3 []string, a4 []string, a5 []string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "MountSensitiveWithoutSystemdWithMountFlags")
+	r0 := i.nodeMounter.MountSensitiveWithoutSystemdWithMountFlags(a0, a1, a2, a3, a4, a5)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) Unmount(a0 string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "Unmount")
+	r0 := i.nodeMounter.Unmount(a0)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) UnmountLazy(a0 string) error {
+	_, done := util.Instrument(context.Background(), "mounter", "UnmountLazy")
+	r0 := i.nodeMounter.UnmountLazy(a0)
+	done(r0)
+	return r0
+}
+
+func (i *instrumentedMounter) UnmountWithForce(a0 string, a1 time.Duration) error {
+	_, done := util.Instrument(context.Background(), "mounter", "UnmountWithForce")
+	r0 := i.nodeMounter.UnmountWithForce(a0, a1)
+	done(r0)
+	return r0
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/component-base/tracing"
+)
+
+// instrumentLogThreshold is the duration above which a call to a dependency is logged with its trace
+const instrumentLogThreshold = 5 * time.Second
+
+var (
+	// DependencyCallDuration is the latency of the calls to the dependencies of the driver, e.g. the EFS API
+	// or the mounter, per dependency and method
+	DependencyCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "efs_csi",
+		Subsystem: "dependency",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of the calls to the dependencies of the driver, per dependency and method.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"dependency", "method"})
+
+	// DependencyCalls is the number of calls to the dependencies of the driver, per dependency, method and
+	// result: success or error
+	DependencyCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "efs_csi",
+		Subsystem: "dependency",
+		Name:      "calls_total",
+		Help:      "Number of calls to the dependencies of the driver, per dependency, method and result: success or error.",
+	}, []string{"dependency", "method", "result"})
+)
+
+// Instrument starts a span of the call to the method of the dependency. The returned function must be called
+// with the error of the call once it returns, to end the span and record the latency and result of the call.
+// The decorators generated by hack/instrumentgen call it for every method of the interface they wrap.
+func Instrument(ctx context.Context, dependency, method string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, dependency+"."+method)
+	return ctx, func(err error) {
+		result := "success"
+		if err != nil {
+			result = "error"
+			span.AddEvent("error", attribute.String("error", err.Error()))
+		}
+		span.End(instrumentLogThreshold)
+		DependencyCallDuration.WithLabelValues(dependency, method).Observe(time.Since(start).Seconds())
+		DependencyCalls.WithLabelValues(dependency, method, result).Inc()
+	}
+}
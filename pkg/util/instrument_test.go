@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	count := func(result string) float64 {
+		return testutil.ToFloat64(DependencyCalls.WithLabelValues("test", "Call", result))
+	}
+	successes, errs := count("success"), count("error")
+
+	ctx, done := Instrument(context.Background(), "test", "Call")
+	if ctx == nil {
+		t.Fatalf("Expected a context")
+	}
+	done(nil)
+	_, done = Instrument(context.Background(), "test", "Call")
+	done(errors.New("failed"))
+	_, done = Instrument(context.Background(), "test", "Call")
+	done(errors.New("failed"))
+
+	if got := count("success") - successes; got != 1 {
+		t.Errorf("Expected 1 successful call, got %v", got)
+	}
+	if got := count("error") - errs; got != 2 {
+		t.Errorf("Expected 2 failed calls, got %v", got)
+	}
+	if got := testutil.CollectAndCount(DependencyCallDuration, "efs_csi_dependency_call_duration_seconds"); got != 1 {
+		t.Errorf("Expected the latency of 1 method, got %d", got)
+	}
+}
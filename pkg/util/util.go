@@ -21,7 +21,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -41,9 +40,6 @@ func ParseEndpoint(endpoint string) (string, string, error) {
 	case "tcp":
 	case "unix":
 		addr = path.Join("/", addr)
-		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
-			return "", "", fmt.Errorf("could not remove unix domain socket %q: %v", addr, err)
-		}
 	default:
 		return "", "", fmt.Errorf("unsupported protocol: %s", scheme)
 	}
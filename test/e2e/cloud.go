@@ -26,10 +26,12 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/efs"
 	efstypes "github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 type cloud struct {
@@ -45,11 +47,23 @@ func NewCloud(region string) *cloud {
 	}
 }
 
+// NewCloudWithRole returns a cloud calling the APIs with the role, e.g. in the account of a cross account file system
+func NewCloudWithRole(region, roleArn string) *cloud {
+	cfg, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleArn))
+	return &cloud{
+		efsclient: efs.NewFromConfig(cfg),
+		ec2client: ec2.NewFromConfig(cfg),
+	}
+}
+
 type CreateOptions struct {
 	Name             string
 	ClusterName      string
 	SecurityGroupIds []string
 	SubnetIds        []string
+	// VpcId is the VPC whose subnets get the mount targets when SubnetIds is empty, instead of those of the cluster
+	VpcId string
 }
 
 func (c *cloud) CreateFileSystem(opts CreateOptions) (string, error) {
@@ -99,6 +113,13 @@ func (c *cloud) CreateFileSystem(opts CreateOptions) (string, error) {
 			securityGroupId,
 		}
 	}
+	if len(opts.SubnetIds) == 0 && opts.VpcId != "" {
+		matchingSubnetIds, err := c.getVpcSubnetIds(opts.VpcId)
+		if err != nil {
+			return "", err
+		}
+		opts.SubnetIds = matchingSubnetIds
+	}
 	if len(opts.SubnetIds) == 0 {
 		matchingSubnetIds, err := c.getSubnetIds(opts.ClusterName)
 		if err != nil {
@@ -249,6 +270,54 @@ func (c *cloud) getSubnetIds(clusterName string) ([]string, error) {
 	return subnetIds, nil
 }
 
+// getVpcSubnetIds returns the IDs of the subnets of the VPC, one per availability zone
+func (c *cloud) getVpcSubnetIds(vpcId string) ([]string, error) {
+	request := &ec2.DescribeSubnetsInput{
+		Filters: []ec2types.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []string{vpcId},
+			},
+		},
+	}
+	response, err := c.ec2client.DescribeSubnets(context.TODO(), request)
+	if err != nil {
+		return nil, err
+	}
+
+	// A file system has at most one mount target per availability zone
+	subnetIds := []string{}
+	zones := map[string]bool{}
+	for _, subnet := range response.Subnets {
+		if zones[*subnet.AvailabilityZone] {
+			continue
+		}
+		zones[*subnet.AvailabilityZone] = true
+		subnetIds = append(subnetIds, *subnet.SubnetId)
+	}
+	if len(subnetIds) == 0 {
+		return nil, fmt.Errorf("no subnets found in vpc %s", vpcId)
+	}
+	return subnetIds, nil
+}
+
+// GetMountTargetIp returns the IP address of an available mount target of the file system
+func (c *cloud) GetMountTargetIp(fileSystemId string) (string, error) {
+	request := &efs.DescribeMountTargetsInput{
+		FileSystemId: aws.String(fileSystemId),
+	}
+	response, err := c.efsclient.DescribeMountTargets(context.TODO(), request)
+	if err != nil {
+		return "", err
+	}
+	for _, mountTarget := range response.MountTargets {
+		if mountTarget.LifeCycleState == efstypes.LifeCycleStateAvailable && mountTarget.IpAddress != nil {
+			return *mountTarget.IpAddress, nil
+		}
+	}
+	return "", fmt.Errorf("no available mount target found for file system %s", fileSystemId)
+}
+
 // kops names the node security group nodes.$clustername and tags it
 // Name=nodes.$clustername. As opposed to masters.$clustername and
 // api.$clustername
@@ -448,6 +517,29 @@ func (c *cloud) ensureAccessPointStatus(accessPointId, status string) error {
 	}
 }
 
+func (c *cloud) ensureAccessPointDeleted(accessPointId string) error {
+	request := &efs.DescribeAccessPointsInput{
+		AccessPointId: aws.String(accessPointId),
+	}
+	ctx := context.TODO()
+
+	for {
+		response, err := c.efsclient.DescribeAccessPoints(ctx, request)
+		if err != nil {
+			var AccessPointNotFoundErr *efstypes.AccessPointNotFound
+			if errors.As(err, &AccessPointNotFoundErr) {
+				return nil
+			}
+			return err
+		}
+
+		if len(response.AccessPoints) == 0 || response.AccessPoints[0].LifeCycleState == efstypes.LifeCycleStateDeleted {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
 func (c *cloud) ensureNoMountTarget(fileSystemId string) error {
 	request := &efs.DescribeFileSystemsInput{
 		FileSystemId: aws.String(fileSystemId),
@@ -0,0 +1,177 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ginkgo "github.com/onsi/ginkgo/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	"k8s.io/kubernetes/test/e2e/framework/kubectl"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	e2epv "k8s.io/kubernetes/test/e2e/framework/pv"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+// crossAccountSecretName is the name of the secret holding the role of the cross account file system
+const crossAccountSecretName = "efs-cross-account"
+
+var _ = ginkgo.Describe("[efs-csi] EFS CSI cross account", func() {
+	f := framework.NewDefaultFramework("efs-cross-account")
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	ginkgo.BeforeEach(func() {
+		if CrossAccountFileSystemId == "" || CrossAccountRoleArn == "" {
+			e2eskipper.Skipf("Set -cross-account-file-system-id and -cross-account-role-arn to run the cross account tests")
+		}
+	})
+
+	ginkgo.It("should mount a cross account file system with a static volume", func() {
+		ginkgo.By(fmt.Sprintf("Creating efs pvc & pv of cross account file system %q", CrossAccountFileSystemId))
+		pvc, pv, err := createEFSPVCPVOfFileSystem(f.ClientSet, CrossAccountFileSystemId, f.Namespace.Name, f.Namespace.Name, "/", crossAccountVolumeAttributes())
+		framework.ExpectNoError(err, "creating efs pvc & pv of cross account file system")
+		defer func() {
+			_ = f.ClientSet.CoreV1().PersistentVolumes().Delete(context.TODO(), pv.Name, metav1.DeleteOptions{})
+		}()
+
+		testCrossAccountReadWrite(f, pvc)
+	})
+
+	ginkgo.It("should provision, mount and delete a cross account volume dynamically", func() {
+		ginkgo.By(fmt.Sprintf("Creating secret %q with role %q", crossAccountSecretName, CrossAccountRoleArn))
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      crossAccountSecretName,
+				Namespace: f.Namespace.Name,
+			},
+			StringData: map[string]string{
+				"awsRoleArn":   CrossAccountRoleArn,
+				"crossaccount": strconv.FormatBool(CrossAccountDNS),
+			},
+		}
+		if CrossAccountRegion != "" && CrossAccountRegion != Region {
+			// DeleteVolume is not given the storage class, so the region is taken from the secret
+			secret.StringData["awsRegion"] = CrossAccountRegion
+		}
+		_, err := f.ClientSet.CoreV1().Secrets(f.Namespace.Name).Create(context.TODO(), secret, metav1.CreateOptions{})
+		framework.ExpectNoError(err, "creating secret")
+
+		ginkgo.By("Creating EFS Storage Class and PVC of the cross account file system")
+		params := map[string]string{
+			"provisioningMode": "efs-ap",
+			"fileSystemId":     CrossAccountFileSystemId,
+			"directoryPerms":   "700",
+			"basePath":         "/cross_account",
+			"csi.storage.k8s.io/provisioner-secret-name":      crossAccountSecretName,
+			"csi.storage.k8s.io/provisioner-secret-namespace": f.Namespace.Name,
+		}
+		if CrossAccountRegion != "" && CrossAccountRegion != Region {
+			params["apiRegion"] = CrossAccountRegion
+		}
+		sc, err := f.ClientSet.StorageV1().StorageClasses().Create(context.TODO(), GetStorageClass(params), metav1.CreateOptions{})
+		framework.ExpectNoError(err, "creating storage class")
+		defer func() {
+			_ = f.ClientSet.StorageV1().StorageClasses().Delete(context.TODO(), sc.Name, metav1.DeleteOptions{})
+		}()
+		pvc, err := createEFSPVCPVDynamicProvisioning(f.ClientSet, f.Namespace.Name, f.Namespace.Name, sc.Name)
+		framework.ExpectNoError(err, "creating pvc")
+		pvs, err := e2epv.WaitForPVClaimBoundPhase(f.ClientSet, []*v1.PersistentVolumeClaim{pvc}, f.Timeouts.ClaimProvision)
+		framework.ExpectNoError(err, "waiting for pvc to be bound")
+		pv := pvs[0]
+
+		handle := strings.SplitN(pv.Spec.CSI.VolumeHandle, "::", 2)
+		if len(handle) != 2 || handle[0] != CrossAccountFileSystemId {
+			framework.Failf("Expected an access point of file system %q, got volume handle %q", CrossAccountFileSystemId, pv.Spec.CSI.VolumeHandle)
+		}
+		accessPointId := handle[1]
+		framework.Logf("Provisioned access point %q of cross account file system %q", accessPointId, CrossAccountFileSystemId)
+
+		testCrossAccountReadWrite(f, pvc)
+
+		ginkgo.By(fmt.Sprintf("Deleting pvc %q and waiting for the deletion of access point %q", pvc.Name, accessPointId))
+		err = f.ClientSet.CoreV1().PersistentVolumeClaims(f.Namespace.Name).Delete(context.TODO(), pvc.Name, metav1.DeleteOptions{})
+		framework.ExpectNoError(err, "deleting pvc")
+		framework.ExpectNoError(e2epv.WaitForPersistentVolumeDeleted(f.ClientSet, pv.Name, framework.Poll, f.Timeouts.PVDelete), "waiting for pv deletion")
+		framework.ExpectNoError(newCrossAccountCloud().ensureAccessPointDeleted(accessPointId), "waiting for access point deletion")
+	})
+})
+
+// newCrossAccountCloud returns a cloud calling the APIs of the account of the cross account file system
+func newCrossAccountCloud() *cloud {
+	region := CrossAccountRegion
+	if region == "" {
+		region = Region
+	}
+	return NewCloudWithRole(region, CrossAccountRoleArn)
+}
+
+// crossAccountVolumeAttributes returns the volume attributes mounting the cross account file system, either with
+// the crossaccount option or with the IP address of one of its mount targets
+func crossAccountVolumeAttributes() map[string]string {
+	volumeAttributes := map[string]string{}
+	if CrossAccountRegion != "" && CrossAccountRegion != Region {
+		volumeAttributes["region"] = CrossAccountRegion
+	}
+	if CrossAccountDNS {
+		volumeAttributes["crossaccount"] = "true"
+		return volumeAttributes
+	}
+	mountTargetIp, err := newCrossAccountCloud().GetMountTargetIp(CrossAccountFileSystemId)
+	framework.ExpectNoError(err, "getting mount target ip of cross account file system")
+	volumeAttributes["mounttargetip"] = mountTargetIp
+	return volumeAttributes
+}
+
+// testCrossAccountReadWrite writes to the volume of the pvc from one pod and reads it back from another
+func testCrossAccountReadWrite(f *framework.Framework, pvc *v1.PersistentVolumeClaim) {
+	const testData = "CROSS ACCOUNT TEST"
+	writePath := "/mnt/volume1/" + f.Namespace.Name
+
+	ginkgo.By(fmt.Sprintf("Deploying a pod that mounts pvc %q and writes data", pvc.Name))
+	writeCommand := fmt.Sprintf("echo \"%s\" > %s", testData, writePath)
+	pod := e2epod.MakePod(f.Namespace.Name, nil, []*v1.PersistentVolumeClaim{pvc}, false, writeCommand)
+	pod.Spec.RestartPolicy = v1.RestartPolicyNever
+	pod, err := f.ClientSet.CoreV1().Pods(f.Namespace.Name).Create(context.TODO(), pod, metav1.CreateOptions{})
+	framework.ExpectNoError(err, "creating pod")
+	framework.ExpectNoError(e2epod.WaitForPodSuccessInNamespace(f.ClientSet, pod.Name, f.Namespace.Name), "waiting for pod success")
+	deletePod(f.ClientSet, pod)
+
+	ginkgo.By("Deploying a second pod that reads the data")
+	pod = e2epod.MakePod(f.Namespace.Name, nil, []*v1.PersistentVolumeClaim{pvc}, false, "while true; do sleep 5; done")
+	pod, err = f.ClientSet.CoreV1().Pods(f.Namespace.Name).Create(context.TODO(), pod, metav1.CreateOptions{})
+	framework.ExpectNoError(err, "creating pod")
+	defer deletePod(f.ClientSet, pod)
+	framework.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(f.ClientSet, pod.Name, f.Namespace.Name), "waiting for pod running")
+
+	output := kubectl.RunKubectlOrDie(f.Namespace.Name, "exec", pod.Name, "--", "/bin/sh", "-c", "cat "+writePath)
+	if strings.TrimSuffix(output, "\n") != testData {
+		framework.Failf("Read data %q does not match write data %q", output, testData)
+	}
+}
+
+// deletePod deletes the pod and waits for it to be gone, so that its volumes are unmounted
+func deletePod(c clientset.Interface, pod *v1.Pod) {
+	_ = c.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+	_ = e2epod.WaitForPodNotFoundInNamespace(c, pod.Name, pod.Namespace, framework.PodDeleteTimeout)
+}
@@ -38,6 +38,25 @@ var (
 	EfsDriverNamespace          string
 	EfsDriverLabelSelectors     map[string]string
 
+	// VpcId is the VPC of the mount targets of the file system created before
+	// tests, for clusters in a VPC of their own whose subnets are not tagged
+	// with the cluster name. Ignored if MountTargetSubnetIds is set.
+	VpcId string
+
+	// CrossAccountFileSystemId is an existing file system in another account
+	// or VPC, peered with the VPC of the cluster, and CrossAccountRoleArn the
+	// IAM role of its account assumed by the controller. The cross account
+	// tests are skipped unless both are set.
+	CrossAccountFileSystemId string
+	CrossAccountRoleArn      string
+	// CrossAccountRegion is the region of CrossAccountFileSystemId, Region if empty.
+	CrossAccountRegion string
+	// CrossAccountDNS if set true mounts the cross account file system with
+	// the crossaccount option of efs-utils, which resolves the mount target in
+	// the availability zone of the node and requires the DNS prerequisites of
+	// efs-utils. Otherwise the volumes are mounted by mount target IP.
+	CrossAccountDNS bool
+
 	// CreateFileSystem if set true will create a file system before tests.
 	// Alternatively, provide an existing file system via FileSystemId. If this
 	// is true, ClusterName and Region must be set. For CI it should be true
@@ -162,6 +181,7 @@ var _ = ginkgo.SynchronizedBeforeSuite(func() []byte {
 				ClusterName:      ClusterName,
 				SecurityGroupIds: MountTargetSecurityGroupIds,
 				SubnetIds:        MountTargetSubnetIds,
+				VpcId:            VpcId,
 			}
 			id, err := c.CreateFileSystem(opts)
 			if err != nil {
@@ -463,7 +483,11 @@ func GetStorageClass(params map[string]string) *storagev1.StorageClass {
 }
 
 func createEFSPVCPV(c clientset.Interface, namespace, name, path string, volumeAttributes map[string]string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume, error) {
-	pvc, pv := makeEFSPVCPV(namespace, name, path, volumeAttributes)
+	return createEFSPVCPVOfFileSystem(c, FileSystemId, namespace, name, path, volumeAttributes)
+}
+
+func createEFSPVCPVOfFileSystem(c clientset.Interface, fileSystemId, namespace, name, path string, volumeAttributes map[string]string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume, error) {
+	pvc, pv := makeEFSPVCPV(fileSystemId, namespace, name, path, volumeAttributes)
 	pvc, err := c.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
 	if err != nil {
 		return nil, nil, err
@@ -475,9 +499,9 @@ func createEFSPVCPV(c clientset.Interface, namespace, name, path string, volumeA
 	return pvc, pv, nil
 }
 
-func makeEFSPVCPV(namespace, name, path string, volumeAttributes map[string]string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+func makeEFSPVCPV(fileSystemId, namespace, name, path string, volumeAttributes map[string]string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume) {
 	pvc := makeEFSPVC(namespace, name)
-	pv := makeEFSPV(name, path, volumeAttributes)
+	pv := makeEFSPV(fileSystemId, name, path, volumeAttributes)
 	pvc.Spec.VolumeName = pv.Name
 	pv.Spec.ClaimRef = &v1.ObjectReference{
 		Namespace: pvc.Namespace,
@@ -505,8 +529,8 @@ func makeEFSPVC(namespace, name string) *v1.PersistentVolumeClaim {
 	}
 }
 
-func makeEFSPV(name, path string, volumeAttributes map[string]string) *v1.PersistentVolume {
-	volumeHandle := FileSystemId
+func makeEFSPV(fileSystemId, name, path string, volumeAttributes map[string]string) *v1.PersistentVolume {
+	volumeHandle := fileSystemId
 	if path != "" {
 		volumeHandle += ":" + path
 	}
@@ -67,6 +67,11 @@ func init() {
 	flag.BoolVar(&DeployDriver, "deploy-driver", false, "deploy a driver. Either this should be true or a driver should already be deployed, otherwise the tests will fail")
 	flag.StringVar(&combinedMountTargetSecurityGroupIds, "mount-target-security-group-ids", "", "comma-separated list of security group IDs to use for mount targets of provisioned EFS file system, only used if -file-system-id is not set")
 	flag.StringVar(&combinedMountTargetSubnetIds, "mount-target-subnet-ids", "", "comma-separated list of subnet IDs to use for mount targets of provisioned EFS file system, only used if -file-system-id is not set")
+	flag.StringVar(&VpcId, "vpc-id", "", "VPC whose subnets get the mount targets of provisioned EFS file system instead of the subnets of the cluster, only used if -file-system-id and -mount-target-subnet-ids are not set")
+	flag.StringVar(&CrossAccountFileSystemId, "cross-account-file-system-id", "", "the ID of an existing file system in another account or VPC peered with the VPC of the cluster, the cross account tests are skipped if not set")
+	flag.StringVar(&CrossAccountRoleArn, "cross-account-role-arn", "", "the ARN of the IAM role of the account of -cross-account-file-system-id assumed by the controller, the cross account tests are skipped if not set")
+	flag.StringVar(&CrossAccountRegion, "cross-account-region", "", "the region of -cross-account-file-system-id, -region if not set")
+	flag.BoolVar(&CrossAccountDNS, "cross-account-dns", false, "mount -cross-account-file-system-id with the crossaccount mount option instead of the IP address of its mount target, requires the cross account DNS prerequisites of efs-utils")
 	flag.StringVar(&EfsDriverNamespace, "efs-driver-namespace", "kube-system", "namespace of EFS driver pods")
 	flag.StringVar(&combinedEfsDriverLabelSelectors, "efs-driver-label-selectors", "app=efs-csi-node", "comma-separated label selectors for EFS driver pods, follows the form key1=value1,key2=value2")
 
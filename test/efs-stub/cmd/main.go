@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	efsstub "github.com/kubernetes-sigs/aws-efs-csi-driver/test/efs-stub"
+)
+
+func main() {
+	var (
+		address     = flag.String("address", ":4566", "The TCP network address where the stub serves the EFS API, the port of localstack by default")
+		region      = flag.String("region", "us-east-1", "The region of the ARNs and availability zones of the resources of the stub")
+		fileSystems = flag.Int("file-systems", 1, "Number of file systems created on startup, each with a mount target")
+	)
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	stub := efsstub.New(*region)
+	for i := 0; i < *fileSystems; i++ {
+		fileSystemId := stub.AddFileSystem(map[string]string{"Name": fmt.Sprintf("efs-stub-%d", i)})
+		mountTargetId, err := stub.AddMountTarget(fileSystemId, "subnet-stub")
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		klog.Infof("Created file system %s with mount target %s", fileSystemId, mountTargetId)
+	}
+
+	klog.Infof("Serving the EFS API stub on %s", *address)
+	if err := http.ListenAndServe(*address, stub); err != nil {
+		klog.Fatalln(err)
+	}
+}
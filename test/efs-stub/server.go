@@ -0,0 +1,745 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package efsstub is an in-memory stub of the operations of the EFS API called by the driver. It speaks the
+// REST-JSON protocol of the AWS SDKs, so that the driver calls it instead of the EFS API of the region when its
+// efs-endpoint-url flag, or the AWS_ENDPOINT_URL_EFS environment variable, is the URL of the stub, as it would
+// call localstack.
+package efsstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OwnerId is the account owning the resources of the stub
+	OwnerId = "111122223333"
+	// DefaultAccessPointLimit is the quota of access points per file system of EFS
+	DefaultAccessPointLimit = 1000
+
+	apiVersionPath  = "/2015-02-01"
+	defaultPageSize = 100
+	nameTagKey      = "Name"
+)
+
+// Tag is a tag of a file system or access point
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// PosixUser is the POSIX identity of the NFS requests through an access point
+type PosixUser struct {
+	Uid           int64
+	Gid           int64
+	SecondaryGids []int64 `json:",omitempty"`
+}
+
+// CreationInfo is the owner and permissions of the root directory of an access point, if created by EFS
+type CreationInfo struct {
+	OwnerUid    int64
+	OwnerGid    int64
+	Permissions string
+}
+
+// RootDirectory is the directory of the file system exposed by an access point
+type RootDirectory struct {
+	Path         string
+	CreationInfo *CreationInfo `json:",omitempty"`
+}
+
+// AccessPoint is the description of an access point returned by the API
+type AccessPoint struct {
+	AccessPointArn string
+	AccessPointId  string
+	ClientToken    string
+	FileSystemId   string
+	LifeCycleState string
+	Name           string `json:",omitempty"`
+	OwnerId        string
+	PosixUser      *PosixUser     `json:",omitempty"`
+	RootDirectory  *RootDirectory `json:",omitempty"`
+	Tags           []Tag
+}
+
+// SizeInBytes is the metered size of a file system
+type SizeInBytes struct {
+	Value int64
+}
+
+// FileSystem is the description of a file system returned by the API
+type FileSystem struct {
+	AvailabilityZoneName         string `json:",omitempty"`
+	CreationTime                 float64
+	CreationToken                string
+	Encrypted                    bool
+	FileSystemArn                string
+	FileSystemId                 string
+	KmsKeyId                     string `json:",omitempty"`
+	LifeCycleState               string
+	Name                         string `json:",omitempty"`
+	NumberOfMountTargets         int
+	OwnerId                      string
+	PerformanceMode              string
+	ProvisionedThroughputInMibps *float64 `json:",omitempty"`
+	SizeInBytes                  SizeInBytes
+	Tags                         []Tag
+	ThroughputMode               string
+}
+
+// MountTarget is the description of a mount target returned by the API
+type MountTarget struct {
+	AvailabilityZoneId   string
+	AvailabilityZoneName string
+	FileSystemId         string
+	IpAddress            string
+	LifeCycleState       string
+	MountTargetId        string
+	OwnerId              string
+	SubnetId             string
+}
+
+// APIError is an error of the API, returned with its HTTP status code
+type APIError struct {
+	StatusCode int
+	ErrorCode  string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode, e.Message)
+}
+
+func newAPIError(statusCode int, errorCode, format string, args ...interface{}) *APIError {
+	return &APIError{StatusCode: statusCode, ErrorCode: errorCode, Message: fmt.Sprintf(format, args...)}
+}
+
+// Server is the stub of the EFS API of a region. The resources are available as soon as they are created, and
+// deleted at once.
+type Server struct {
+	region string
+	mux    *http.ServeMux
+
+	mu               sync.Mutex
+	lastId           int
+	fileSystems      map[string]*FileSystem
+	accessPoints     map[string]*AccessPoint
+	mountTargets     map[string]*MountTarget
+	subnetZones      map[string]int
+	accessPointLimit int
+	faults           map[string][]*APIError
+	calls            map[string]int
+}
+
+// New returns a stub of the EFS API of the region, without resources
+func New(region string) *Server {
+	s := &Server{
+		region:           region,
+		mux:              http.NewServeMux(),
+		fileSystems:      map[string]*FileSystem{},
+		accessPoints:     map[string]*AccessPoint{},
+		mountTargets:     map[string]*MountTarget{},
+		subnetZones:      map[string]int{},
+		accessPointLimit: DefaultAccessPointLimit,
+		faults:           map[string][]*APIError{},
+		calls:            map[string]int{},
+	}
+	s.handle("POST /access-points", "CreateAccessPoint", http.StatusOK, s.createAccessPoint)
+	s.handle("DELETE /access-points/{AccessPointId}", "DeleteAccessPoint", http.StatusNoContent, s.deleteAccessPoint)
+	s.handle("GET /access-points", "DescribeAccessPoints", http.StatusOK, s.describeAccessPoints)
+	s.handle("POST /file-systems", "CreateFileSystem", http.StatusCreated, s.createFileSystem)
+	s.handle("DELETE /file-systems/{FileSystemId}", "DeleteFileSystem", http.StatusNoContent, s.deleteFileSystem)
+	s.handle("GET /file-systems", "DescribeFileSystems", http.StatusOK, s.describeFileSystems)
+	s.handle("POST /mount-targets", "CreateMountTarget", http.StatusOK, s.createMountTarget)
+	s.handle("DELETE /mount-targets/{MountTargetId}", "DeleteMountTarget", http.StatusNoContent, s.deleteMountTarget)
+	s.handle("GET /mount-targets", "DescribeMountTargets", http.StatusOK, s.describeMountTargets)
+	s.handle("POST /resource-tags/{ResourceId}", "TagResource", http.StatusOK, s.tagResource)
+	s.handle("DELETE /resource-tags/{ResourceId}", "UntagResource", http.StatusOK, s.untagResource)
+	s.handle("GET /resource-tags/{ResourceId}", "ListTagsForResource", http.StatusOK, s.listTagsForResource)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, newAPIError(http.StatusBadRequest, "UnsupportedOperation", "%s %s is not implemented by the stub", r.Method, r.URL.Path))
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle serves the operation of the pattern, whose handler returns the response with the status code
+func (s *Server) handle(pattern, operation string, statusCode int, handler func(r *http.Request) (interface{}, *APIError)) {
+	method, path, _ := strings.Cut(pattern, " ")
+	s.mux.HandleFunc(method+" "+apiVersionPath+path, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.calls[operation]++
+		if faults := s.faults[operation]; len(faults) > 0 {
+			s.faults[operation] = faults[1:]
+			writeError(w, faults[0])
+			return
+		}
+		res, err := handler(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		if res != nil {
+			_ = json.NewEncoder(w).Encode(res)
+		}
+	})
+}
+
+func writeError(w http.ResponseWriter, err *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-ErrorType", err.ErrorCode)
+	w.WriteHeader(err.StatusCode)
+	_ = json.NewEncoder(w).Encode(map[string]string{"ErrorCode": err.ErrorCode, "Message": err.Message})
+}
+
+// InjectError fails the next call of the operation, e.g. CreateAccessPoint, with the error. The errors injected
+// for an operation fail its calls in order.
+func (s *Server) InjectError(operation string, err APIError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[operation] = append(s.faults[operation], &err)
+}
+
+// Calls returns the number of calls of the operation, including the failed ones
+func (s *Server) Calls(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[operation]
+}
+
+// SetAccessPointLimit sets the quota of access points per file system
+func (s *Server) SetAccessPointLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessPointLimit = limit
+}
+
+// AddFileSystem adds an available file system with the tags, and returns its ID
+func (s *Server) AddFileSystem(tags map[string]string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var efsTags []Tag
+	for k, v := range tags {
+		efsTags = append(efsTags, Tag{Key: k, Value: v})
+	}
+	fs := s.newFileSystem(createFileSystemRequest{CreationToken: s.nextId("token"), Tags: efsTags})
+	return fs.FileSystemId
+}
+
+// AddMountTarget adds an available mount target of the file system in the subnet, and returns its ID
+func (s *Server) AddMountTarget(fileSystemId, subnetId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mt, err := s.newMountTarget(createMountTargetRequest{FileSystemId: fileSystemId, SubnetId: subnetId})
+	if err != nil {
+		return "", err
+	}
+	return mt.MountTargetId, nil
+}
+
+// FileSystems returns the file systems, sorted by ID
+func (s *Server) FileSystems() []FileSystem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedFileSystems(func(fs *FileSystem) bool { return true })
+}
+
+// AccessPoints returns the access points of the file system, or of all the file systems if empty, sorted by ID
+func (s *Server) AccessPoints(fileSystemId string) []AccessPoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedAccessPoints(func(ap *AccessPoint) bool { return fileSystemId == "" || ap.FileSystemId == fileSystemId })
+}
+
+// nextId returns a new ID with the prefix, in the form of the IDs of EFS
+func (s *Server) nextId(prefix string) string {
+	s.lastId++
+	return fmt.Sprintf("%s-%017x", prefix, s.lastId)
+}
+
+func (s *Server) arn(resourceType, id string) string {
+	return fmt.Sprintf("arn:aws:elasticfilesystem:%s:%s:%s/%s", s.region, OwnerId, resourceType, id)
+}
+
+type createAccessPointRequest struct {
+	ClientToken   string
+	FileSystemId  string
+	PosixUser     *PosixUser
+	RootDirectory *RootDirectory
+	Tags          []Tag
+}
+
+func (s *Server) createAccessPoint(r *http.Request) (interface{}, *APIError) {
+	var req createAccessPointRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	if _, ok := s.fileSystems[req.FileSystemId]; !ok {
+		return nil, fileSystemNotFound(req.FileSystemId)
+	}
+	count := 0
+	for _, ap := range s.accessPoints {
+		if ap.FileSystemId != req.FileSystemId {
+			continue
+		}
+		// The retries of a creation return the access point of their client token
+		if ap.ClientToken == req.ClientToken {
+			return *ap, nil
+		}
+		count++
+	}
+	if count >= s.accessPointLimit {
+		return nil, newAPIError(http.StatusForbidden, "AccessPointLimitExceeded", "You have reached the maximum number of access points (%d) for your file system %s.", s.accessPointLimit, req.FileSystemId)
+	}
+	rootDirectory := req.RootDirectory
+	if rootDirectory == nil || rootDirectory.Path == "" {
+		rootDirectory = &RootDirectory{Path: "/"}
+		if req.RootDirectory != nil {
+			rootDirectory.CreationInfo = req.RootDirectory.CreationInfo
+		}
+	}
+	id := s.nextId("fsap")
+	ap := &AccessPoint{
+		AccessPointArn: s.arn("access-point", id),
+		AccessPointId:  id,
+		ClientToken:    req.ClientToken,
+		FileSystemId:   req.FileSystemId,
+		LifeCycleState: "available",
+		OwnerId:        OwnerId,
+		PosixUser:      req.PosixUser,
+		RootDirectory:  rootDirectory,
+	}
+	setTags(&ap.Tags, &ap.Name, req.Tags)
+	s.accessPoints[id] = ap
+	return *ap, nil
+}
+
+func (s *Server) deleteAccessPoint(r *http.Request) (interface{}, *APIError) {
+	id := r.PathValue("AccessPointId")
+	if _, ok := s.accessPoints[id]; !ok {
+		return nil, accessPointNotFound(id)
+	}
+	delete(s.accessPoints, id)
+	return nil, nil
+}
+
+func (s *Server) describeAccessPoints(r *http.Request) (interface{}, *APIError) {
+	query := r.URL.Query()
+	accessPointId, fileSystemId := query.Get("AccessPointId"), query.Get("FileSystemId")
+	var accessPoints []AccessPoint
+	switch {
+	case accessPointId != "" && fileSystemId != "":
+		return nil, newAPIError(http.StatusBadRequest, "BadRequest", "AccessPointId and FileSystemId cannot both be specified")
+	case accessPointId != "":
+		ap, ok := s.accessPoints[accessPointId]
+		if !ok {
+			return nil, accessPointNotFound(accessPointId)
+		}
+		accessPoints = []AccessPoint{*ap}
+	case fileSystemId != "":
+		if _, ok := s.fileSystems[fileSystemId]; !ok {
+			return nil, fileSystemNotFound(fileSystemId)
+		}
+		accessPoints = s.sortedAccessPoints(func(ap *AccessPoint) bool { return ap.FileSystemId == fileSystemId })
+	default:
+		accessPoints = s.sortedAccessPoints(func(ap *AccessPoint) bool { return true })
+	}
+	page, nextToken, err := paginate(accessPoints, query.Get("NextToken"), query.Get("MaxResults"))
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		AccessPoints []AccessPoint
+		NextToken    *string `json:",omitempty"`
+	}{page, nextToken}, nil
+}
+
+type createFileSystemRequest struct {
+	AvailabilityZoneName         string
+	CreationToken                string
+	Encrypted                    bool
+	KmsKeyId                     string
+	PerformanceMode              string
+	ProvisionedThroughputInMibps *float64
+	Tags                         []Tag
+	ThroughputMode               string
+}
+
+func (s *Server) createFileSystem(r *http.Request) (interface{}, *APIError) {
+	var req createFileSystemRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	if req.CreationToken == "" {
+		return nil, newAPIError(http.StatusBadRequest, "BadRequest", "CreationToken is required")
+	}
+	for _, fs := range s.fileSystems {
+		if fs.CreationToken == req.CreationToken {
+			return nil, newAPIError(http.StatusConflict, "FileSystemAlreadyExists", "File system '%s' already exists with creation token '%s'", fs.FileSystemId, req.CreationToken)
+		}
+	}
+	return *s.newFileSystem(req), nil
+}
+
+func (s *Server) newFileSystem(req createFileSystemRequest) *FileSystem {
+	id := s.nextId("fs")
+	fs := &FileSystem{
+		AvailabilityZoneName:         req.AvailabilityZoneName,
+		CreationTime:                 float64(time.Now().Unix()),
+		CreationToken:                req.CreationToken,
+		Encrypted:                    req.Encrypted,
+		FileSystemArn:                s.arn("file-system", id),
+		FileSystemId:                 id,
+		KmsKeyId:                     req.KmsKeyId,
+		LifeCycleState:               "available",
+		OwnerId:                      OwnerId,
+		PerformanceMode:              req.PerformanceMode,
+		ProvisionedThroughputInMibps: req.ProvisionedThroughputInMibps,
+		SizeInBytes:                  SizeInBytes{Value: 6144},
+		ThroughputMode:               req.ThroughputMode,
+	}
+	if fs.PerformanceMode == "" {
+		fs.PerformanceMode = "generalPurpose"
+	}
+	if fs.ThroughputMode == "" {
+		fs.ThroughputMode = "bursting"
+	}
+	setTags(&fs.Tags, &fs.Name, req.Tags)
+	s.fileSystems[id] = fs
+	return fs
+}
+
+func (s *Server) deleteFileSystem(r *http.Request) (interface{}, *APIError) {
+	id := r.PathValue("FileSystemId")
+	fs, ok := s.fileSystems[id]
+	if !ok {
+		return nil, fileSystemNotFound(id)
+	}
+	if fs.NumberOfMountTargets > 0 {
+		return nil, newAPIError(http.StatusConflict, "FileSystemInUse", "File system '%s' has mount targets", id)
+	}
+	delete(s.fileSystems, id)
+	for apid, ap := range s.accessPoints {
+		if ap.FileSystemId == id {
+			delete(s.accessPoints, apid)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) describeFileSystems(r *http.Request) (interface{}, *APIError) {
+	query := r.URL.Query()
+	fileSystemId, creationToken := query.Get("FileSystemId"), query.Get("CreationToken")
+	if _, ok := s.fileSystems[fileSystemId]; fileSystemId != "" && !ok {
+		return nil, fileSystemNotFound(fileSystemId)
+	}
+	fileSystems := s.sortedFileSystems(func(fs *FileSystem) bool {
+		return (fileSystemId == "" || fs.FileSystemId == fileSystemId) && (creationToken == "" || fs.CreationToken == creationToken)
+	})
+	marker := query.Get("Marker")
+	page, nextMarker, err := paginate(fileSystems, marker, query.Get("MaxItems"))
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		FileSystems []FileSystem
+		Marker      string  `json:",omitempty"`
+		NextMarker  *string `json:",omitempty"`
+	}{page, marker, nextMarker}, nil
+}
+
+type createMountTargetRequest struct {
+	FileSystemId   string
+	IpAddress      string
+	SecurityGroups []string
+	SubnetId       string
+}
+
+func (s *Server) createMountTarget(r *http.Request) (interface{}, *APIError) {
+	var req createMountTargetRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	mt, err := s.newMountTarget(req)
+	if err != nil {
+		return nil, err
+	}
+	return *mt, nil
+}
+
+// newMountTarget creates a mount target. The subnets are placed in the availability zones a, b, c... of the
+// region, in the order of their first mount target.
+func (s *Server) newMountTarget(req createMountTargetRequest) (*MountTarget, *APIError) {
+	fs, ok := s.fileSystems[req.FileSystemId]
+	if !ok {
+		return nil, fileSystemNotFound(req.FileSystemId)
+	}
+	if req.SubnetId == "" {
+		return nil, newAPIError(http.StatusBadRequest, "BadRequest", "SubnetId is required")
+	}
+	zone, ok := s.subnetZones[req.SubnetId]
+	if !ok {
+		zone = len(s.subnetZones)
+		s.subnetZones[req.SubnetId] = zone
+	}
+	for _, mt := range s.mountTargets {
+		if mt.FileSystemId == req.FileSystemId && s.subnetZones[mt.SubnetId] == zone {
+			return nil, newAPIError(http.StatusConflict, "MountTargetConflict", "File system '%s' already has a mount target in the availability zone of subnet '%s'", req.FileSystemId, req.SubnetId)
+		}
+	}
+	id := s.nextId("fsmt")
+	ipAddress := req.IpAddress
+	if ipAddress == "" {
+		ipAddress = fmt.Sprintf("10.0.%d.%d", zone, s.lastId%256)
+	}
+	mt := &MountTarget{
+		AvailabilityZoneId:   fmt.Sprintf("%s-az%d", zoneIdPrefix(s.region), zone+1),
+		AvailabilityZoneName: fmt.Sprintf("%s%c", s.region, 'a'+zone),
+		FileSystemId:         req.FileSystemId,
+		IpAddress:            ipAddress,
+		LifeCycleState:       "available",
+		MountTargetId:        id,
+		OwnerId:              OwnerId,
+		SubnetId:             req.SubnetId,
+	}
+	s.mountTargets[id] = mt
+	fs.NumberOfMountTargets++
+	return mt, nil
+}
+
+// zoneIdPrefix returns the prefix of the IDs of the availability zones of the region, e.g. use1 for us-east-1
+func zoneIdPrefix(region string) string {
+	parts := strings.Split(region, "-")
+	prefix := parts[0]
+	for _, part := range parts[1 : len(parts)-1] {
+		prefix += part[:1]
+	}
+	return prefix + parts[len(parts)-1]
+}
+
+func (s *Server) deleteMountTarget(r *http.Request) (interface{}, *APIError) {
+	id := r.PathValue("MountTargetId")
+	mt, ok := s.mountTargets[id]
+	if !ok {
+		return nil, newAPIError(http.StatusNotFound, "MountTargetNotFound", "Mount target '%s' does not exist.", id)
+	}
+	delete(s.mountTargets, id)
+	if fs, ok := s.fileSystems[mt.FileSystemId]; ok {
+		fs.NumberOfMountTargets--
+	}
+	return nil, nil
+}
+
+func (s *Server) describeMountTargets(r *http.Request) (interface{}, *APIError) {
+	query := r.URL.Query()
+	fileSystemId, mountTargetId := query.Get("FileSystemId"), query.Get("MountTargetId")
+	if accessPointId := query.Get("AccessPointId"); accessPointId != "" {
+		ap, ok := s.accessPoints[accessPointId]
+		if !ok {
+			return nil, accessPointNotFound(accessPointId)
+		}
+		fileSystemId = ap.FileSystemId
+	}
+	if fileSystemId == "" && mountTargetId == "" {
+		return nil, newAPIError(http.StatusBadRequest, "BadRequest", "FileSystemId, MountTargetId or AccessPointId is required")
+	}
+	if _, ok := s.fileSystems[fileSystemId]; fileSystemId != "" && !ok {
+		return nil, fileSystemNotFound(fileSystemId)
+	}
+	if _, ok := s.mountTargets[mountTargetId]; mountTargetId != "" && !ok {
+		return nil, newAPIError(http.StatusNotFound, "MountTargetNotFound", "Mount target '%s' does not exist.", mountTargetId)
+	}
+	var mountTargets []MountTarget
+	for _, mt := range s.mountTargets {
+		if (fileSystemId == "" || mt.FileSystemId == fileSystemId) && (mountTargetId == "" || mt.MountTargetId == mountTargetId) {
+			mountTargets = append(mountTargets, *mt)
+		}
+	}
+	sort.Slice(mountTargets, func(i, j int) bool { return mountTargets[i].MountTargetId < mountTargets[j].MountTargetId })
+	marker := query.Get("Marker")
+	page, nextMarker, err := paginate(mountTargets, marker, query.Get("MaxItems"))
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Marker       string `json:",omitempty"`
+		MountTargets []MountTarget
+		NextMarker   *string `json:",omitempty"`
+	}{marker, page, nextMarker}, nil
+}
+
+// resourceTags returns the tags and name of the file system or access point
+func (s *Server) resourceTags(resourceId string) (*[]Tag, *string, *APIError) {
+	switch {
+	case strings.HasPrefix(resourceId, "fsap-"):
+		if ap, ok := s.accessPoints[resourceId]; ok {
+			return &ap.Tags, &ap.Name, nil
+		}
+		return nil, nil, accessPointNotFound(resourceId)
+	case strings.HasPrefix(resourceId, "fs-"):
+		if fs, ok := s.fileSystems[resourceId]; ok {
+			return &fs.Tags, &fs.Name, nil
+		}
+		return nil, nil, fileSystemNotFound(resourceId)
+	}
+	return nil, nil, newAPIError(http.StatusBadRequest, "BadRequest", "Invalid resource ID '%s'", resourceId)
+}
+
+func (s *Server) tagResource(r *http.Request) (interface{}, *APIError) {
+	var req struct {
+		Tags []Tag
+	}
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	tags, name, err := s.resourceTags(r.PathValue("ResourceId"))
+	if err != nil {
+		return nil, err
+	}
+	setTags(tags, name, req.Tags)
+	return nil, nil
+}
+
+func (s *Server) untagResource(r *http.Request) (interface{}, *APIError) {
+	tags, name, err := s.resourceTags(r.PathValue("ResourceId"))
+	if err != nil {
+		return nil, err
+	}
+	removed := map[string]bool{}
+	for _, key := range r.URL.Query()["tagKeys"] {
+		removed[key] = true
+	}
+	var kept []Tag
+	for _, tag := range *tags {
+		if !removed[tag.Key] {
+			kept = append(kept, tag)
+		}
+	}
+	*tags = kept
+	if removed[nameTagKey] {
+		*name = ""
+	}
+	return nil, nil
+}
+
+func (s *Server) listTagsForResource(r *http.Request) (interface{}, *APIError) {
+	tags, _, err := s.resourceTags(r.PathValue("ResourceId"))
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	page, nextToken, err := paginate(*tags, query.Get("NextToken"), query.Get("MaxResults"))
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		NextToken *string `json:",omitempty"`
+		Tags      []Tag
+	}{nextToken, page}, nil
+}
+
+// setTags adds the tags to the tags of a resource, replacing the values of their keys, and sets the name of the
+// resource from its Name tag. The tags are sorted by key, and replaced rather than updated in place, so that the
+// descriptions already returned are not changed.
+func setTags(tags *[]Tag, name *string, added []Tag) {
+	values := map[string]string{}
+	for _, tag := range *tags {
+		values[tag.Key] = tag.Value
+	}
+	for _, tag := range added {
+		values[tag.Key] = tag.Value
+	}
+	merged := []Tag{}
+	for k, v := range values {
+		merged = append(merged, Tag{Key: k, Value: v})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Key < merged[j].Key })
+	*tags = merged
+	*name = values[nameTagKey]
+}
+
+func (s *Server) sortedFileSystems(filter func(fs *FileSystem) bool) []FileSystem {
+	fileSystems := []FileSystem{}
+	for _, fs := range s.fileSystems {
+		if filter(fs) {
+			fileSystems = append(fileSystems, *fs)
+		}
+	}
+	sort.Slice(fileSystems, func(i, j int) bool { return fileSystems[i].FileSystemId < fileSystems[j].FileSystemId })
+	return fileSystems
+}
+
+func (s *Server) sortedAccessPoints(filter func(ap *AccessPoint) bool) []AccessPoint {
+	accessPoints := []AccessPoint{}
+	for _, ap := range s.accessPoints {
+		if filter(ap) {
+			accessPoints = append(accessPoints, *ap)
+		}
+	}
+	sort.Slice(accessPoints, func(i, j int) bool { return accessPoints[i].AccessPointId < accessPoints[j].AccessPointId })
+	return accessPoints
+}
+
+// paginate returns the page of the items starting at the token, which is the index of its first item, and the
+// token of the next page if any
+func paginate[T any](items []T, token, maxItems string) ([]T, *string, *APIError) {
+	start, size := 0, defaultPageSize
+	var err error
+	if token != "" {
+		if start, err = strconv.Atoi(token); err != nil || start < 0 || start > len(items) {
+			return nil, nil, newAPIError(http.StatusBadRequest, "BadRequest", "Invalid pagination token '%s'", token)
+		}
+	}
+	if maxItems != "" {
+		if size, err = strconv.Atoi(maxItems); err != nil || size <= 0 {
+			return nil, nil, newAPIError(http.StatusBadRequest, "BadRequest", "Invalid maximum number of items '%s'", maxItems)
+		}
+	}
+	end := start + size
+	if end >= len(items) {
+		return items[start:], nil, nil
+	}
+	next := strconv.Itoa(end)
+	return items[start:end], &next, nil
+}
+
+func decodeBody(r *http.Request, v interface{}) *APIError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newAPIError(http.StatusBadRequest, "BadRequest", "Invalid request body: %v", err)
+	}
+	return nil
+}
+
+func fileSystemNotFound(fileSystemId string) *APIError {
+	return newAPIError(http.StatusNotFound, "FileSystemNotFound", "File system '%s' does not exist.", fileSystemId)
+}
+
+func accessPointNotFound(accessPointId string) *APIError {
+	return newAPIError(http.StatusNotFound, "AccessPointNotFound", "Access point '%s' does not exist.", accessPointId)
+}